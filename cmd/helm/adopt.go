@@ -0,0 +1,60 @@
+package helm_v3
+
+import (
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/werf/3p-helm/cmd/helm/require"
+	"github.com/werf/3p-helm/pkg/action"
+	"github.com/werf/3p-helm/pkg/cli/output"
+)
+
+const adoptDesc = `
+This command turns resources that already exist in the cluster, e.g. created
+by hand, into the first revision of a new release.
+
+Resources are selected by kind and label selector, by name, or both:
+
+    $ helm adopt backend --kinds deployments,services -l app=backend
+    $ helm adopt backend --resource configmap/backend-config
+
+The live objects are stored as the manifest of the release without the fields
+managed by the cluster, such as the status. The objects are annotated and
+labeled as owned by the release, so that 'helm upgrade' manages them from now
+on. Objects managed by a controller, such as the ReplicaSets of a Deployment,
+are not adopted when selected by a label selector.
+`
+
+func newAdoptCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewAdopt(cfg)
+	var outfmt output.Format
+
+	cmd := &cobra.Command{
+		Use:               "adopt RELEASE_NAME",
+		Short:             "create a release from resources existing in the cluster",
+		Long:              adoptDesc,
+		Args:              require.ExactArgs(1),
+		ValidArgsFunction: noCompletions,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client.Namespace = settings.Namespace()
+
+			rel, err := client.Run(args[0])
+			if err != nil {
+				return err
+			}
+
+			return outfmt.Write(out, &statusPrinter{rel, settings.Debug, true, false, false})
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringSliceVar(&client.Kinds, "kinds", nil, "kinds of the resources to adopt, selected by --selector, e.g. deployments,services")
+	f.StringVarP(&client.LabelSelector, "selector", "l", "", "label selector of the resources of --kinds to adopt, e.g. app=backend")
+	f.StringArrayVar(&client.Resources, "resource", nil, "resource to adopt in the <kind>/<name> form, can be specified multiple times")
+	f.StringVar(&client.Description, "description", "", "add a custom description")
+	f.BoolVar(&client.DryRun, "dry-run", false, "show the release that would be created without changing anything")
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
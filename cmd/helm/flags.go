@@ -40,10 +40,17 @@ const (
 	outputFlag         = "output"
 	postRenderFlag     = "post-renderer"
 	postRenderArgsFlag = "post-renderer-args"
+	notifyWebhookFlag  = "notify-webhook"
+	notifySlackFlag    = "notify-slack"
+	notifyReportFlag   = "notify-report-url"
+
+	notifyWebhookTemplateFlag = "notify-webhook-template"
+	notifySlackTemplateFlag   = "notify-slack-template"
 )
 
 func addValueOptionsFlags(f *pflag.FlagSet, v *values.Options) {
-	f.StringSliceVarP(&v.ValueFiles, "values", "f", []string{}, "specify values in a YAML file or a URL (can specify multiple)")
+	f.StringSliceVarP(&v.ValueFiles, "values", "f", []string{}, "specify values in a YAML or JSON (.json) file or a URL (can specify multiple)")
+	f.StringSliceVar(&v.ValueDirs, "values-dir", []string{}, "merge the YAML and JSON files of a directory in lexical order, and all the documents of its YAML files, before the values files (can specify multiple)")
 	f.StringArrayVar(&v.Values, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
 	f.StringArrayVar(&v.StringValues, "set-string", []string{}, "set STRING values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
 	f.StringArrayVar(&v.FileValues, "set-file", []string{}, "set values from respective files specified via the command line (can specify multiple or separate values with commas: key1=path1,key2=path2)")
@@ -69,12 +76,27 @@ func addChartPathOptionsFlags(f *pflag.FlagSet, c *action.ChartPathOptions) {
 // bindOutputFlag will add the output flag to the given command and bind the
 // value to the given format pointer
 func bindOutputFlag(cmd *cobra.Command, varRef *output.Format) {
-	cmd.Flags().VarP(newOutputValue(output.Table, varRef), outputFlag, "o",
-		fmt.Sprintf("prints the output in the specified format. Allowed values: %s", strings.Join(output.Formats(), ", ")))
+	bindOutputFlagWithFormats(cmd, varRef, output.Formats(), output.FormatsWithDesc())
+}
+
+// bindCIOutputFlag is like bindOutputFlag, but also allows the CI formats. It
+// is meant for the commands reporting the deploy results: install, upgrade and
+// rollback.
+func bindCIOutputFlag(cmd *cobra.Command, varRef *output.Format) {
+	formats := output.FormatsWithDesc()
+	for format, desc := range output.CIFormatsWithDesc() {
+		formats[format] = desc
+	}
+	bindOutputFlagWithFormats(cmd, varRef, append(output.Formats(), output.CIFormats()...), formats)
+}
+
+func bindOutputFlagWithFormats(cmd *cobra.Command, varRef *output.Format, names []string, formats map[string]string) {
+	cmd.Flags().VarP(newOutputValue(output.Table, varRef, formats), outputFlag, "o",
+		fmt.Sprintf("prints the output in the specified format. Allowed values: %s", strings.Join(names, ", ")))
 
 	err := cmd.RegisterFlagCompletionFunc(outputFlag, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		var formatNames []string
-		for format, desc := range output.FormatsWithDesc() {
+		for format, desc := range formats {
 			formatNames = append(formatNames, fmt.Sprintf("%s\t%s", format, desc))
 		}
 
@@ -88,18 +110,21 @@ func bindOutputFlag(cmd *cobra.Command, varRef *output.Format) {
 	}
 }
 
-type outputValue output.Format
+type outputValue struct {
+	format  *output.Format
+	allowed map[string]string
+}
 
-func newOutputValue(defaultValue output.Format, p *output.Format) *outputValue {
+func newOutputValue(defaultValue output.Format, p *output.Format, allowed map[string]string) *outputValue {
 	*p = defaultValue
-	return (*outputValue)(p)
+	return &outputValue{format: p, allowed: allowed}
 }
 
 func (o *outputValue) String() string {
 	// It is much cleaner looking (and technically less allocations) to just
 	// convert to a string rather than type asserting to the underlying
 	// output.Format
-	return string(*o)
+	return string(*o.format)
 }
 
 func (o *outputValue) Type() string {
@@ -107,11 +132,15 @@ func (o *outputValue) Type() string {
 }
 
 func (o *outputValue) Set(s string) error {
+	if _, found := o.allowed[s]; !found {
+		return output.ErrInvalidFormatType
+	}
+
 	outfmt, err := output.ParseFormat(s)
 	if err != nil {
 		return err
 	}
-	*o = outputValue(outfmt)
+	*o.format = outfmt
 	return nil
 }
 
@@ -195,6 +224,96 @@ func (p *postRendererArgsSlice) GetSlice() []string {
 	return p.options.args
 }
 
+func bindNotifyFlags(cmd *cobra.Command, notifiers *[]action.Notifier, reportURL *string) {
+	webhooks := &notifierURLs{notifiers: notifiers, newNotifier: func(url, tmpl string) (action.Notifier, error) {
+		return action.NewWebhookNotifier(url, tmpl)
+	}}
+	slacks := &notifierURLs{notifiers: notifiers, newNotifier: func(url, tmpl string) (action.Notifier, error) {
+		return action.NewSlackNotifier(url, tmpl)
+	}}
+
+	cmd.Flags().Var(webhooks, notifyWebhookFlag, "post the JSON notifications of the start and the end of the deploy to the URL (can specify multiple)")
+	cmd.Flags().Var(&notifierTemplate{urls: webhooks}, notifyWebhookTemplateFlag, "the Go template of the body of the --notify-webhook notifications, rendered with the fields of action.DeployNotification, instead of their JSON")
+	cmd.Flags().Var(slacks, notifySlackFlag, "post the notifications of the start and the end of the deploy to the Slack incoming webhook URL (can specify multiple)")
+	cmd.Flags().Var(&notifierTemplate{urls: slacks}, notifySlackTemplateFlag, "the Go template of the text of the --notify-slack messages, rendered with the fields of action.DeployNotification")
+	cmd.Flags().StringVar(reportURL, notifyReportFlag, "", "the link to the deploy report included into the notifications, e.g. the one of the published --deploy-report-path")
+}
+
+// notifierURLs adds a notifier to the notifiers for every URL, with the
+// template of the notifierTemplate of the same notifiers.
+type notifierURLs struct {
+	notifiers   *[]action.Notifier
+	newNotifier func(url, tmpl string) (action.Notifier, error)
+	urls        []string
+	template    string
+	// created are the notifiers of the urls.
+	created []action.Notifier
+}
+
+func (n *notifierURLs) String() string {
+	return "[" + strings.Join(n.urls, ",") + "]"
+}
+
+func (n *notifierURLs) Type() string {
+	return "stringArray"
+}
+
+func (n *notifierURLs) Set(val string) error {
+	notifier, err := n.newNotifier(val, n.template)
+	if err != nil {
+		return err
+	}
+
+	n.urls = append(n.urls, val)
+	n.created = append(n.created, notifier)
+	*n.notifiers = append(*n.notifiers, notifier)
+	return nil
+}
+
+// setTemplate sets the template of the notifiers of the URLs, including the
+// ones of the URLs set before it.
+func (n *notifierURLs) setTemplate(tmpl string) error {
+	for i, url := range n.urls {
+		notifier, err := n.newNotifier(url, tmpl)
+		if err != nil {
+			return err
+		}
+
+		for j, existing := range *n.notifiers {
+			if existing == n.created[i] {
+				(*n.notifiers)[j] = notifier
+			}
+		}
+		n.created[i] = notifier
+	}
+
+	n.template = tmpl
+	return nil
+}
+
+// notifierTemplate sets the template of the notifiers of the URLs, whatever
+// the order of the flags.
+type notifierTemplate struct {
+	urls *notifierURLs
+}
+
+func (t *notifierTemplate) String() string {
+	return t.urls.template
+}
+
+func (t *notifierTemplate) Type() string {
+	return "string"
+}
+
+func (t *notifierTemplate) Set(val string) error {
+	// The template is checked even if there are no URLs yet.
+	if _, err := t.urls.newNotifier("", val); err != nil {
+		return err
+	}
+
+	return t.urls.setTemplate(val)
+}
+
 func compVersionFlag(chartRef string, _ string) ([]string, cobra.ShellCompDirective) {
 	chartInfo := strings.Split(chartRef, "/")
 	if len(chartInfo) != 2 {
@@ -20,12 +20,25 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/spf13/cobra"
+
+	"github.com/werf/3p-helm/pkg/action"
 	"github.com/werf/3p-helm/pkg/chart"
 	"github.com/werf/3p-helm/pkg/release"
 	helmtime "github.com/werf/3p-helm/pkg/time"
 )
 
 func outputFlagCompletionTest(t *testing.T, cmdName string) {
+	outputFlagCompletionTestWithGolden(t, cmdName, "output/output-comp.txt")
+}
+
+// ciOutputFlagCompletionTest is like outputFlagCompletionTest for the commands
+// also allowing the CI formats.
+func ciOutputFlagCompletionTest(t *testing.T, cmdName string) {
+	outputFlagCompletionTestWithGolden(t, cmdName, "output/output-ci-comp.txt")
+}
+
+func outputFlagCompletionTestWithGolden(t *testing.T, cmdName, golden string) {
 	releasesMockWithStatus := func(info *release.Info, hooks ...*release.Hook) []*release.Release {
 		info.LastDeployed = helmtime.Unix(1452902400, 0).UTC()
 		return []*release.Release{{
@@ -58,38 +71,70 @@ func outputFlagCompletionTest(t *testing.T, cmdName string) {
 	tests := []cmdTestCase{{
 		name:   "completion for output flag long and before arg",
 		cmd:    fmt.Sprintf("__complete %s --output ''", cmdName),
-		golden: "output/output-comp.txt",
+		golden: golden,
 		rels: releasesMockWithStatus(&release.Info{
 			Status: release.StatusDeployed,
 		}),
 	}, {
 		name:   "completion for output flag long and after arg",
 		cmd:    fmt.Sprintf("__complete %s aramis --output ''", cmdName),
-		golden: "output/output-comp.txt",
+		golden: golden,
 		rels: releasesMockWithStatus(&release.Info{
 			Status: release.StatusDeployed,
 		}),
 	}, {
 		name:   "completion for output flag short and before arg",
 		cmd:    fmt.Sprintf("__complete %s -o ''", cmdName),
-		golden: "output/output-comp.txt",
+		golden: golden,
 		rels: releasesMockWithStatus(&release.Info{
 			Status: release.StatusDeployed,
 		}),
 	}, {
 		name:   "completion for output flag short and after arg",
 		cmd:    fmt.Sprintf("__complete %s aramis -o ''", cmdName),
-		golden: "output/output-comp.txt",
+		golden: golden,
 		rels: releasesMockWithStatus(&release.Info{
 			Status: release.StatusDeployed,
 		}),
 	}, {
 		name:   "completion for output flag, no filter",
 		cmd:    fmt.Sprintf("__complete %s --output jso", cmdName),
-		golden: "output/output-comp.txt",
+		golden: golden,
 		rels: releasesMockWithStatus(&release.Info{
 			Status: release.StatusDeployed,
 		}),
 	}}
 	runTestCmd(t, tests)
 }
+
+func TestNotifyFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"--notify-webhook-template", "{{ .Release }}", "--notify-webhook", "https://example.com/a", "--notify-slack", "https://hooks.slack.com/b"},
+		{"--notify-webhook", "https://example.com/a", "--notify-slack", "https://hooks.slack.com/b", "--notify-webhook-template", "{{ .Release }}"},
+	} {
+		var notifiers []action.Notifier
+		var reportURL string
+		cmd := &cobra.Command{}
+		bindNotifyFlags(cmd, &notifiers, &reportURL)
+		if err := cmd.ParseFlags(args); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(notifiers) != 2 {
+			t.Fatalf("expected 2 notifiers for %v, got %d", args, len(notifiers))
+		}
+		webhook, ok := notifiers[0].(*action.WebhookNotifier)
+		if !ok || webhook.URL != "https://example.com/a" || webhook.Template == nil {
+			t.Errorf("expected the webhook notifier to have the template for %v, got %+v", args, notifiers[0])
+		}
+		if slack, ok := notifiers[1].(*action.SlackNotifier); !ok || slack.WebhookURL != "https://hooks.slack.com/b" {
+			t.Errorf("expected the Slack notifier for %v, got %+v", args, notifiers[1])
+		}
+	}
+
+	cmd := &cobra.Command{}
+	bindNotifyFlags(cmd, new([]action.Notifier), new(string))
+	if err := cmd.ParseFlags([]string{"--notify-slack-template", "{{ .Release"}); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
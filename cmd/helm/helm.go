@@ -30,6 +30,7 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"github.com/werf/3p-helm/pkg/action"
+	"github.com/werf/3p-helm/pkg/cachestats"
 	"github.com/werf/3p-helm/pkg/cli"
 	"github.com/werf/3p-helm/pkg/kube"
 	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
@@ -78,9 +79,15 @@ func main() {
 		if helmDriver == "memory" {
 			loadReleasesInMemory(actionConfig)
 		}
+		if os.Getenv("HELM_METRICS_PUSHGATEWAY") != "" {
+			actionConfig.Metrics = action.NewMetrics()
+		}
 	})
 
-	if err := cmd.Execute(); err != nil {
+	err = cmd.Execute()
+	logCacheStats()
+	pushMetrics(actionConfig)
+	if err != nil {
 		debug("%+v", err)
 		switch e := err.(type) {
 		case pluginError:
@@ -91,6 +98,27 @@ func main() {
 	}
 }
 
+// pushMetrics pushes the metrics of the deploys made by the command to the
+// Pushgateway of HELM_METRICS_PUSHGATEWAY, if it is set.
+func pushMetrics(actionConfig *action.Configuration) {
+	url := os.Getenv("HELM_METRICS_PUSHGATEWAY")
+	if url == "" || actionConfig.Metrics == nil {
+		return
+	}
+
+	if err := actionConfig.Metrics.Push(url, "helm"); err != nil {
+		warning("%s", err)
+	}
+}
+
+// logCacheStats logs the statistics of the caches used by the command in the
+// debug mode.
+func logCacheStats() {
+	for _, stats := range cachestats.Snapshot() {
+		debug("%s cache: %d hits, %d misses, hit rate %.2f, %d entries", stats.Name, stats.Hits, stats.Misses, stats.HitRate(), stats.Entries)
+	}
+}
+
 // This function loads releases into the memory storage if the
 // environment variable is properly set.
 func loadReleasesInMemory(actionConfig *action.Configuration) {
@@ -43,11 +43,13 @@ configures the maximum length of the revision list returned.
 The historical release set is printed as a formatted table, e.g:
 
     $ helm history angry-bird
-    REVISION    UPDATED                     STATUS          CHART             APP VERSION     DESCRIPTION
-    1           Mon Oct 3 10:15:13 2016     superseded      alpine-0.1.0      1.0             Initial install
-    2           Mon Oct 3 10:15:13 2016     superseded      alpine-0.1.0      1.0             Upgraded successfully
-    3           Mon Oct 3 10:15:13 2016     superseded      alpine-0.1.0      1.0             Rolled back to 2
-    4           Mon Oct 3 10:15:13 2016     deployed        alpine-0.1.0      1.0             Upgraded successfully
+    REVISION    UPDATED                     STATUS          PINNED    CHART             APP VERSION     DESCRIPTION
+    1           Mon Oct 3 10:15:13 2016     superseded                alpine-0.1.0      1.0             Initial install
+    2           Mon Oct 3 10:15:13 2016     superseded      yes       alpine-0.1.0      1.0             Upgraded successfully
+    3           Mon Oct 3 10:15:13 2016     superseded                alpine-0.1.0      1.0             Rolled back to 2
+    4           Mon Oct 3 10:15:13 2016     deployed                  alpine-0.1.0      1.0             Upgraded successfully
+
+Revisions pinned with 'helm pin' are marked in the PINNED column.
 `
 
 func newHistoryCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
@@ -87,9 +89,12 @@ type releaseInfo struct {
 	Revision    int           `json:"revision"`
 	Updated     helmtime.Time `json:"updated"`
 	Status      string        `json:"status"`
+	Pinned      bool          `json:"pinned,omitempty"`
 	Chart       string        `json:"chart"`
 	AppVersion  string        `json:"app_version"`
 	Description string        `json:"description"`
+	// Metadata is only included in the JSON and YAML output
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 type releaseHistory []releaseInfo
@@ -104,9 +109,13 @@ func (r releaseHistory) WriteYAML(out io.Writer) error {
 
 func (r releaseHistory) WriteTable(out io.Writer) error {
 	tbl := uitable.New()
-	tbl.AddRow("REVISION", "UPDATED", "STATUS", "CHART", "APP VERSION", "DESCRIPTION")
+	tbl.AddRow("REVISION", "UPDATED", "STATUS", "PINNED", "CHART", "APP VERSION", "DESCRIPTION")
 	for _, item := range r {
-		tbl.AddRow(item.Revision, item.Updated.Format(time.ANSIC), item.Status, item.Chart, item.AppVersion, item.Description)
+		pinned := ""
+		if item.Pinned {
+			pinned = "yes"
+		}
+		tbl.AddRow(item.Revision, item.Updated.Format(time.ANSIC), item.Status, pinned, item.Chart, item.AppVersion, item.Description)
 	}
 	return output.EncodeTable(out, tbl)
 }
@@ -145,9 +154,11 @@ func getReleaseHistory(rls []*release.Release) (history releaseHistory) {
 		rInfo := releaseInfo{
 			Revision:    v,
 			Status:      s,
+			Pinned:      r.Info.Pinned,
 			Chart:       c,
 			AppVersion:  a,
 			Description: d,
+			Metadata:    r.Metadata,
 		}
 		if !r.Info.LastDeployed.IsZero() {
 			rInfo.Updated = r.Info.LastDeployed
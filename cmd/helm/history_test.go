@@ -32,6 +32,9 @@ func TestHistoryCmd(t *testing.T) {
 		})
 	}
 
+	pinned := mk("angry-bird", 3, release.StatusSuperseded)
+	pinned.Info.Pinned = true
+
 	tests := []cmdTestCase{{
 		name: "get history for release",
 		cmd:  "history angry-bird",
@@ -50,6 +53,14 @@ func TestHistoryCmd(t *testing.T) {
 			mk("angry-bird", 3, release.StatusSuperseded),
 		},
 		golden: "output/history-limit.txt",
+	}, {
+		name: "get history with a pinned revision",
+		cmd:  "history angry-bird",
+		rels: []*release.Release{
+			mk("angry-bird", 4, release.StatusDeployed),
+			pinned,
+		},
+		golden: "output/history-pinned.txt",
 	}, {
 		name: "get history with yaml output format",
 		cmd:  "history angry-bird --output yaml",
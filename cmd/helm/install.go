@@ -130,6 +130,10 @@ charts in a repository, use 'helm search'.
 
 func NewInstallCmd(cfg *action.Configuration, out io.Writer, opts InstallCmdOptions) (*cobra.Command, *action.Install) {
 	client := action.NewInstall(cfg, opts.StagesSplitter, opts.StagesExternalDepsGenerator)
+	if opts.DeployExtender != nil {
+		client.DeployExtender = opts.DeployExtender
+	}
+	client.Notifiers = opts.Notifiers
 	valueOpts := &values.Options{}
 	var outfmt output.Format
 
@@ -180,6 +184,9 @@ func NewInstallCmd(cfg *action.Configuration, out io.Writer, opts InstallCmdOpti
 			if opts.DeployReportPath != nil {
 				client.DeployReportPath = *opts.DeployReportPath
 			}
+			if opts.DeployReportFormat != nil {
+				client.DeployReportFormat = *opts.DeployReportFormat
+			}
 
 			rel, err := runInstall(args, client, valueOpts, out)
 			if err != nil {
@@ -191,8 +198,9 @@ func NewInstallCmd(cfg *action.Configuration, out io.Writer, opts InstallCmdOpti
 	}
 
 	addInstallFlags(cmd, cmd.Flags(), client, valueOpts)
-	bindOutputFlag(cmd, &outfmt)
+	bindCIOutputFlag(cmd, &outfmt)
 	bindPostRenderFlag(cmd, &client.PostRenderer)
+	bindNotifyFlags(cmd, &client.Notifiers, &client.NotificationReportURL)
 
 	return cmd, client
 }
@@ -210,8 +218,13 @@ func addInstallFlags(cmd *cobra.Command, f *pflag.FlagSet, client *action.Instal
 	f.BoolVar(&client.DisableHooks, "no-hooks", false, "prevent hooks from running during install")
 	f.BoolVar(&client.Replace, "replace", false, "re-use the given name, only if that name is a deleted release which remains in the history. This is unsafe in production")
 	f.DurationVar(&client.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	f.DurationVar(&client.HooksTimeout, "hooks-timeout", 0, "time to wait for each hook to complete, overridden by the werf.io/hook-timeout annotation of the hook (defaults to --timeout)")
+	f.IntVar(&client.HooksConcurrency, "hooks-concurrency", 1, "how many hooks of the same weight to execute at once")
+	f.IntVar(&client.HooksMaxFailures, "hooks-max-failures", 1, "how many hooks of the same weight may fail before the remaining ones are not executed, a negative number executes all of them")
 	f.BoolVar(&client.Wait, "wait", false, "if set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful. It will wait for as long as --timeout")
 	f.BoolVar(&client.WaitForJobs, "wait-for-jobs", false, "if set and --wait enabled, will wait until all Jobs have been completed before marking the release as successful. It will wait for as long as --timeout")
+	f.BoolVar(&client.WaitForOwnedResources, "wait-for-owned-resources", false, "if set and --wait enabled, will also wait for the resources owned by custom resources, such as the workloads created by operators, and report their failures")
+	f.BoolVar(&client.InjectDeployMetadata, "inject-deploy-metadata", false, "annotate the pod templates of changed workloads with werf.io/release-revision and werf.io/deployed-at")
 	f.BoolVarP(&client.GenerateName, "generate-name", "g", false, "generate the name (and omit the NAME parameter)")
 	f.StringVar(&client.NameTemplate, "name-template", "", "specify template used to name the release")
 	f.StringVar(&client.Description, "description", "", "add a custom description")
@@ -222,12 +235,40 @@ func addInstallFlags(cmd *cobra.Command, f *pflag.FlagSet, client *action.Instal
 	f.BoolVar(&client.SkipCRDs, "skip-crds", false, "if set, no CRDs will be installed. By default, CRDs are installed if not already present")
 	f.BoolVar(&client.SubNotes, "render-subchart-notes", false, "if set, render subchart notes along with the parent")
 	f.StringToStringVarP(&client.Labels, "labels", "l", nil, "Labels that would be added to release metadata. Should be divided by comma.")
+	f.StringVar(&client.RenderDebugDir, "render-debug-dir", "", "write the output, the context, with the values redacted, and the render time of every template into this directory")
+	f.DurationVar(&client.RenderTimeout, "render-timeout", 0, "time to wait for all chart templates to render (e.g. 1m). Unlimited by default")
+	f.DurationVar(&client.TemplateRenderTimeout, "template-render-timeout", 0, "time to wait for any single chart template to render (e.g. 10s). Unlimited by default")
+	f.StringVar(&client.ImageDigestCacheFile, "image-digest-cache", "", "JSON file to store the image digests resolved by werf_image in and to read them from when the registry is unreachable")
+	f.IntVar(&client.ManifestLimits.MaxResources, "max-resources", 0, "fail if the release has more resources, hooks included. Unlimited by default")
+	f.IntVar(&client.ManifestLimits.MaxManifestSize, "max-manifest-size", 0, "fail if any single rendered manifest is larger in bytes. Unlimited by default")
+	f.IntVar(&client.ManifestLimits.MaxTotalManifestSize, "max-total-manifest-size", 0, "fail if all rendered manifests of the release are larger in bytes in total. Unlimited by default")
+	f.StringArrayVar(&client.IncludeResources, "include", nil, "deploy only the chart resources matching any of these matchers: <kind>/<name> or label:<key>=<value>, globs are allowed")
+	f.StringArrayVar(&client.ExcludeResources, "exclude", nil, "do not deploy the chart resources matching any of these matchers: <kind>/<name> or label:<key>=<value>, globs are allowed")
+	f.BoolVar(&client.WatchEvents, "watch-events", false, "include Warning events of the release resources and of the Pods they create into the error if the installation fails")
+	f.DurationVar(&client.APIUnavailabilityBudget, "api-unavailability-budget", 0, "pause the installation while the Kubernetes API server is unavailable and resume it once the API server is back, failing if it stays unavailable longer than this (0 disables pausing)")
+	f.IntVar(&client.ImmutableGenerationsToKeep, "keep-immutable-generations", 0, "keep the generations of immutable ConfigMaps and Secrets used by this many last revisions instead of deleting them after the installation")
+	f.StringVar(&client.PrunePolicy, "prune-policy", string(phases.PrunePolicyPrune), "what to do with the resources removed from the chart after the installation: \"prune\" deletes them, \"warn-only\" keeps them with a warning, \"keep\" keeps them")
+	f.StringVar(&client.UnsupportedResourcesPolicy, "unsupported-resources-policy", string(phases.UnsupportedResourcesPolicyWarn), "what to do with the resources whose readiness can't be tracked when waiting for them: \"warn\" applies them without tracking with a warning, \"fail\" fails the installation, \"skip\" skips them")
+	f.BoolVar(&client.RelaxPodDisruptionBudgets, "relax-pod-disruption-budgets", false, "let the pods selected by the PodDisruptionBudgets of the workloads be disrupted during the rollout, restoring the budgets afterwards")
+	f.BoolVar(&client.VerifyCronJobs, "verify-cronjobs", false, "create a Job from the template of every CronJob with a server-side dry-run to fail the installation if the Jobs would be rejected on the next scheduled run")
+	f.BoolVar(&client.MigrateCRDStoredVersions, "migrate-crd-stored-versions", false, "migrate the stored objects of the CustomResourceDefinitions whose update removes the versions still listed in their status.storedVersions instead of failing the installation")
+	f.StringArrayVar(&client.ReleaseDependencies, "wait-for-release", nil, "wait up to --timeout for a release, given as [<namespace>/]<name>[@<min revision>], to be deployed before the installation (can specify multiple)")
+	f.StringArrayVar(&client.AdoptResources, "adopt", nil, "adopt the existing resources not belonging to any release which match any of these matchers: <kind>/<name> or label:<key>=<value>, globs are allowed")
+	f.StringToStringVar(&client.Metadata, "metadata", nil, "arbitrary key=value data (e.g. ticket ID or git commit) to store in the release. Should be divided by comma.")
 	f.BoolVar(&client.EnableDNS, "enable-dns", false, "enable DNS lookups when rendering templates")
 	addValueOptionsFlags(f, valueOpts)
 	addChartPathOptionsFlags(f, &client.ChartPathOptions)
 
 	f.BoolVar(&client.CleanupOnFail, "cleanup-on-fail", false, "allow deletion of new resources created in this installation when install fails")
-	f.StringVar(&client.DeployReportPath, "deploy-report-path", "", "save deploy report in JSON to the specified path")
+	f.StringVar(&client.DeployReportPath, "deploy-report-path", "", "save deploy report to the specified path")
+	f.StringVar(&client.DeployReportFormat, "deploy-report-format", release.DeployReportFormatJSON, "format of the deploy report, \"json\" or \"yaml\"")
+	f.StringVar(&client.PlanOutputPath, "plan-output-path", "", "save the plan of the deploy to the specified path before deploying")
+	f.StringVar(&client.PlanOutputFormat, "plan-output-format", action.DeployPlanFormatJSON, "format of the deploy plan, \"json\" or \"yaml\"")
+	f.Var(&client.LogsTailWindow, "logs-tail-window", "show only the last lines, the logs of the last period or both of every container of the tracked resources, given as <lines>, <duration> or <lines>,<duration>, e.g. 100,5m")
+	f.BoolVar(&client.HideLogs, "hide-logs", false, "do not show the logs of the containers of the tracked resources, only the other messages of the tracking")
+	f.StringVar(&client.LogsDir, "logs-dir", "", "also write the logs of the containers of the tracked resources to <dir>/<namespace>/<kind>-<name>/<container>.log, e.g. to keep them as CI artifacts")
+	f.BoolVar(&client.ClusterScoped, "cluster-scoped", false, "the release contains only cluster-scoped resources: do not create the release namespace and fail on namespaced resources. The release namespace is only used to store the release records")
+	f.StringVar(&client.ControlNamespace, "control-namespace", "", "with --cluster-scoped, the namespace of the release, which its records are stored in, instead of the namespace of the command")
 
 	err := cmd.RegisterFlagCompletionFunc("version", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		requiredArgs := 2
@@ -282,6 +323,9 @@ func runInstall(args []string, client *action.Install, valueOpts *values.Options
 	if err != nil {
 		return nil, err
 	}
+	if client.ValuesFiles, err = valueOpts.ResolvedValueFiles(); err != nil {
+		return nil, err
+	}
 
 	// Check chart dependencies to make sure all are present in /charts
 	chartRequested, err := loader.Load(cp)
@@ -398,14 +442,18 @@ func newInstallCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
 }
 
 type InstallCmdOptions struct {
-	StagesSplitter   phases.Splitter
-	ValueOpts        *values.Options
-	CreateNamespace  *bool
-	Wait             *bool
-	Atomic           *bool
-	Timeout          *time.Duration
-	CleanupOnFail    *bool
-	DeployReportPath *string
+	StagesSplitter     phases.Splitter
+	ValueOpts          *values.Options
+	CreateNamespace    *bool
+	Wait               *bool
+	Atomic             *bool
+	Timeout            *time.Duration
+	CleanupOnFail      *bool
+	DeployReportPath   *string
+	DeployReportFormat *string
+	// Notifiers are notified of the deploy in addition to the ones of the flags.
+	Notifiers []action.Notifier
 
 	StagesExternalDepsGenerator phases.ExternalDepsGenerator
+	DeployExtender              phases.DeployExtender
 }
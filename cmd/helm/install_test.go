@@ -258,7 +258,7 @@ func TestInstall(t *testing.T) {
 }
 
 func TestInstallOutputCompletion(t *testing.T) {
-	outputFlagCompletionTest(t, "install")
+	ciOutputFlagCompletionTest(t, "install")
 }
 
 func TestInstallVersionCompletion(t *testing.T) {
@@ -28,6 +28,7 @@ import (
 
 	"github.com/werf/3p-helm/pkg/action"
 	"github.com/werf/3p-helm/pkg/chartutil"
+	"github.com/werf/3p-helm/pkg/cli/output"
 	"github.com/werf/3p-helm/pkg/cli/values"
 	"github.com/werf/3p-helm/pkg/getter"
 	"github.com/werf/3p-helm/pkg/lint/support"
@@ -40,12 +41,16 @@ the chart is well-formed.
 If the linter encounters things that will cause the chart to fail installation,
 it will emit [ERROR] messages. If it encounters issues that break with convention
 or recommendation, it will emit [WARNING] messages.
+
+Use '--output github' or '--output gitlab' to report warnings and errors in a
+format understood by GitHub Actions or GitLab CI.
 `
 
 func newLintCmd(out io.Writer) *cobra.Command {
 	client := action.NewLint()
 	valueOpts := &values.Options{}
 	var kubeVersion string
+	var outfmt output.Format
 
 	cmd := &cobra.Command{
 		Use:   "lint PATH",
@@ -57,6 +62,15 @@ func newLintCmd(out io.Writer) *cobra.Command {
 				paths = args
 			}
 
+			var reporter *output.CIReporter
+			switch outfmt {
+			case output.Table:
+			case output.GitHub, output.GitLab:
+				reporter = output.NewCIReporter(out, outfmt)
+			default:
+				return errors.Errorf("lint does not support the %q output format", outfmt)
+			}
+
 			if kubeVersion != "" {
 				parsedKubeVersion, err := chartutil.ParseKubeVersion(kubeVersion)
 				if err != nil {
@@ -103,6 +117,17 @@ func newLintCmd(out io.Writer) *cobra.Command {
 					continue
 				}
 
+				if len(result.Errors) != 0 {
+					failed++
+				}
+
+				if reporter != nil {
+					if err := writeLintResultCI(reporter, path, result, client.Quiet); err != nil {
+						return err
+					}
+					continue
+				}
+
 				fmt.Fprintf(&message, "==> Linting %s\n", path)
 
 				// All the Errors that are generated by a chart
@@ -121,10 +146,6 @@ func newLintCmd(out io.Writer) *cobra.Command {
 					}
 				}
 
-				if len(result.Errors) != 0 {
-					failed++
-				}
-
 				// Adding extra new line here to break up the
 				// results, stops this from being a big wall of
 				// text and makes it easier to follow.
@@ -150,6 +171,70 @@ func newLintCmd(out io.Writer) *cobra.Command {
 	f.BoolVar(&client.Quiet, "quiet", false, "print only warnings and errors")
 	f.StringVar(&kubeVersion, "kube-version", "", "Kubernetes version used for capabilities and deprecation checks")
 	addValueOptionsFlags(f, valueOpts)
+	// Lint reports its messages as text or as CI annotations only.
+	formats := output.CIFormatsWithDesc()
+	formats[output.Table.String()] = output.FormatsWithDesc()[output.Table.String()]
+	bindOutputFlagWithFormats(cmd, &outfmt, append([]string{output.Table.String()}, output.CIFormats()...), formats)
 
 	return cmd
 }
+
+// writeLintResultCI writes the messages of a single linted chart into a
+// collapsible section and reports warnings and errors as annotations pointing
+// to the offending files.
+func writeLintResultCI(r *output.CIReporter, path string, result *action.LintResult, quiet bool) error {
+	if err := r.Section("lint_"+path, fmt.Sprintf("Linting %s", path), func() error {
+		if len(result.Messages) == 0 {
+			for _, err := range result.Errors {
+				if err := r.Printf("Error %s\n", err); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, msg := range result.Messages {
+			if !quiet || msg.Severity > support.InfoSev {
+				if err := r.Printf("%s\n", msg); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if len(result.Messages) == 0 {
+		for _, err := range result.Errors {
+			if err := r.Annotate(output.Annotation{
+				Level:   output.AnnotationError,
+				File:    path,
+				Title:   "Lint error",
+				Message: err.Error(),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, msg := range result.Messages {
+		level := output.AnnotationWarning
+		switch msg.Severity {
+		case support.ErrorSev:
+			level = output.AnnotationError
+		case support.WarningSev:
+		default:
+			continue
+		}
+
+		if err := r.Annotate(output.Annotation{
+			Level:   level,
+			File:    filepath.Join(path, msg.Path),
+			Title:   "Lint " + string(level),
+			Message: msg.Err.Error(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
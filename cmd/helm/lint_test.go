@@ -17,8 +17,14 @@ limitations under the License.
 package helm_v3
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"testing"
+
+	"github.com/werf/3p-helm/pkg/action"
+	"github.com/werf/3p-helm/pkg/cli/output"
+	"github.com/werf/3p-helm/pkg/lint/support"
 )
 
 func TestLintCmdWithSubchartsFlag(t *testing.T) {
@@ -91,6 +97,49 @@ func TestLintCmdWithKubeVersionFlag(t *testing.T) {
 	runTestCmd(t, tests)
 }
 
+func TestWriteLintResultCI(t *testing.T) {
+	result := &action.LintResult{Messages: []support.Message{
+		support.NewMessage(support.InfoSev, "Chart.yaml", errors.New("icon is recommended")),
+		support.NewMessage(support.WarningSev, "templates/", errors.New("directory not found")),
+		support.NewMessage(support.ErrorSev, "values.yaml", errors.New("unable to parse YAML")),
+	}}
+
+	var out bytes.Buffer
+	if err := writeLintResultCI(output.NewCIReporter(&out, output.GitHub), "mychart", result, true); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `::group::Linting mychart
+[WARNING] templates/: directory not found
+[ERROR] values.yaml: unable to parse YAML
+::endgroup::
+::warning file=mychart/templates,title=Lint warning::directory not found
+::error file=mychart/values.yaml,title=Lint error::unable to parse YAML
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestLintCmdWithOutputFlag(t *testing.T) {
+	tests := []cmdTestCase{{
+		name:      "lint with unsupported output format",
+		cmd:       "lint --output json testdata/testcharts/alpine",
+		golden:    "output/lint-json-output.txt",
+		wantError: true,
+	}}
+	runTestCmd(t, tests)
+}
+
+func TestLintOutputCompletion(t *testing.T) {
+	tests := []cmdTestCase{{
+		name:   "completion for lint output flag",
+		cmd:    "__complete lint --output ''",
+		golden: "output/lint-output-comp.txt",
+	}}
+	runTestCmd(t, tests)
+}
+
 func TestLintFileCompletion(t *testing.T) {
 	checkFileCompletion(t, "lint", true)
 	checkFileCompletion(t, "lint mypath", true) // Multiple paths can be given
@@ -0,0 +1,67 @@
+package helm_v3
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/werf/3p-helm/cmd/helm/require"
+	"github.com/werf/3p-helm/pkg/action"
+)
+
+const pinDesc = `
+This command pins a revision of a release, e.g. a known good one to roll back
+to:
+
+    $ helm pin backend 4
+    $ helm pin backend 4 --unpin
+
+Pinned revisions are never pruned by '--history-max', are left as they are when
+a rollback supersedes the deployed revisions, and are rolled back to by
+'helm rollback --to-last-successful'. They are marked in 'helm history'.
+`
+
+func newPinCmd(cfg *action.Configuration, out io.Writer) *cobra.Command {
+	client := action.NewPin(cfg)
+
+	cmd := &cobra.Command{
+		Use:   "pin RELEASE_NAME REVISION",
+		Short: "pin a revision of a release",
+		Long:  pinDesc,
+		Args:  require.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return compListReleases(toComplete, args, cfg)
+			}
+			if len(args) == 1 {
+				return compListRevisions(toComplete, cfg, args[0])
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("could not convert revision to a number: %v", err)
+			}
+
+			rel, err := client.Run(args[0], version)
+			if err != nil {
+				return err
+			}
+
+			if rel.Info.Pinned {
+				fmt.Fprintf(out, "Revision %d of release %q has been pinned\n", rel.Version, rel.Name)
+			} else {
+				fmt.Fprintf(out, "Revision %d of release %q has been unpinned\n", rel.Version, rel.Name)
+			}
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&client.Unpin, "unpin", false, "unpin the revision instead")
+
+	return cmd
+}
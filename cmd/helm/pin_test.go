@@ -0,0 +1,44 @@
+package helm_v3
+
+import (
+	"testing"
+
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestPinCmd(t *testing.T) {
+	mk := func(vers int, pinned bool) *release.Release {
+		rel := release.Mock(&release.MockReleaseOptions{
+			Name:    "angry-bird",
+			Version: vers,
+			Status:  release.StatusSuperseded,
+		})
+		rel.Info.Pinned = pinned
+		return rel
+	}
+
+	tests := []cmdTestCase{{
+		name:   "pin a revision",
+		cmd:    "pin angry-bird 1",
+		rels:   []*release.Release{mk(1, false)},
+		golden: "output/pin.txt",
+	}, {
+		name:   "unpin a revision",
+		cmd:    "pin angry-bird 1 --unpin",
+		rels:   []*release.Release{mk(1, true)},
+		golden: "output/unpin.txt",
+	}, {
+		name:      "pin a missing revision",
+		cmd:       "pin angry-bird 2",
+		rels:      []*release.Release{mk(1, false)},
+		golden:    "output/pin-missing.txt",
+		wantError: true,
+	}, {
+		name:      "pin an invalid revision",
+		cmd:       "pin angry-bird latest",
+		rels:      []*release.Release{mk(1, false)},
+		golden:    "output/pin-invalid.txt",
+		wantError: true,
+	}}
+	runTestCmd(t, tests)
+}
@@ -17,16 +17,22 @@ limitations under the License.
 package helm_v3
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/werf/3p-helm/cmd/helm/require"
 	"github.com/werf/3p-helm/pkg/action"
+	"github.com/werf/3p-helm/pkg/cli/output"
 	"github.com/werf/3p-helm/pkg/errs"
 	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
 )
 
 const rollbackDesc = `
@@ -35,12 +41,20 @@ This command rolls back a release to a previous revision.
 The first argument of the rollback command is the name of a release, and the
 second is a revision (version) number. If this argument is omitted or set to
 0, it will roll back to the previous release.
+With '--to-last-successful', it rolls back to the last revision pinned with
+'helm pin' or, if none is pinned, to the last successfully deployed revision
+instead, skipping the failed ones.
 
 To see revision numbers, run 'helm history RELEASE'.
 `
 
 func NewRollbackCmd(cfg *action.Configuration, out io.Writer, opts RollbackCmdOptions) *cobra.Command {
 	client := action.NewRollback(cfg, opts.StagesSplitter, opts.StagesExternalDepsGenerator)
+	if opts.DeployExtender != nil {
+		client.DeployExtender = opts.DeployExtender
+	}
+	client.Notifiers = opts.Notifiers
+	var outfmt output.Format
 
 	cmd := &cobra.Command{
 		Use:   "rollback <RELEASE> [REVISION]",
@@ -65,6 +79,9 @@ func NewRollbackCmd(cfg *action.Configuration, out io.Writer, opts RollbackCmdOp
 			if opts.DeployReportPath != nil {
 				client.DeployReportPath = *opts.DeployReportPath
 			}
+			if opts.DeployReportFormat != nil {
+				client.DeployReportFormat = *opts.DeployReportFormat
+			}
 
 			if len(args) > 1 {
 				ver, err := strconv.Atoi(args[1])
@@ -74,27 +91,74 @@ func NewRollbackCmd(cfg *action.Configuration, out io.Writer, opts RollbackCmdOp
 				client.Version = ver
 			}
 
-			if err := client.Run(args[0]); err != nil {
+			// Create context and prepare the handle of SIGTERM
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cSignal := make(chan os.Signal, 2)
+			signal.Notify(cSignal, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(cSignal)
+			go func() {
+				select {
+				case <-cSignal:
+					fmt.Fprintf(out, "Rollback of release %s has been cancelled.\n", args[0])
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+
+			if err := client.RunWithContext(ctx, args[0]); err != nil {
 				return errs.FormatTemplatingError(err)
 			}
 
-			fmt.Fprintf(out, "Rollback was a success! Happy Helming!\n")
-			return nil
+			if outfmt == output.Table {
+				fmt.Fprintf(out, "Rollback was a success! Happy Helming!\n")
+				return nil
+			}
+
+			rel, err := cfg.Releases.Last(args[0])
+			if err != nil {
+				return err
+			}
+			return outfmt.Write(out, &statusPrinter{rel, settings.Debug, false, false, false})
 		},
 	}
 
 	f := cmd.Flags()
 	f.BoolVar(&client.DryRun, "dry-run", false, "simulate a rollback")
+	f.BoolVar(&client.ToLastSuccessful, "to-last-successful", false, "roll back to the last pinned revision or, if none is pinned, to the last successfully deployed revision, skipping the failed ones, instead of the previous revision")
 	f.BoolVar(&client.Recreate, "recreate-pods", false, "performs pods restart for the resource if applicable")
 	f.BoolVar(&client.Force, "force", false, "force resource update through delete/recreate if needed")
 	f.BoolVar(&client.DisableHooks, "no-hooks", false, "prevent hooks from running during rollback")
 	f.DurationVar(&client.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	f.DurationVar(&client.HooksTimeout, "hooks-timeout", 0, "time to wait for each hook to complete, overridden by the werf.io/hook-timeout annotation of the hook (defaults to --timeout)")
+	f.IntVar(&client.HooksConcurrency, "hooks-concurrency", 1, "how many hooks of the same weight to execute at once")
+	f.IntVar(&client.HooksMaxFailures, "hooks-max-failures", 1, "how many hooks of the same weight may fail before the remaining ones are not executed, a negative number executes all of them")
 	f.BoolVar(&client.Wait, "wait", false, "if set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful. It will wait for as long as --timeout")
 	f.BoolVar(&client.WaitForJobs, "wait-for-jobs", false, "if set and --wait enabled, will wait until all Jobs have been completed before marking the release as successful. It will wait for as long as --timeout")
+	f.BoolVar(&client.WaitForOwnedResources, "wait-for-owned-resources", false, "if set and --wait enabled, will also wait for the resources owned by custom resources, such as the workloads created by operators, and report their failures")
+	f.BoolVar(&client.InjectDeployMetadata, "inject-deploy-metadata", false, "annotate the pod templates of changed workloads with werf.io/release-revision and werf.io/deployed-at")
 	f.BoolVar(&client.CleanupOnFail, "cleanup-on-fail", false, "allow deletion of new resources created in this rollback when rollback fails")
+	f.StringVar(&client.Description, "description", "", "add a custom description")
+	f.BoolVar(&client.WatchEvents, "watch-events", false, "include Warning events of the release resources and of the Pods they create into the error if the rollback fails")
+	f.DurationVar(&client.APIUnavailabilityBudget, "api-unavailability-budget", 0, "pause the rollback while the Kubernetes API server is unavailable and resume it once the API server is back, failing if it stays unavailable longer than this (0 disables pausing)")
+	f.IntVar(&client.ImmutableGenerationsToKeep, "keep-immutable-generations", 0, "keep the generations of immutable ConfigMaps and Secrets used by this many last revisions instead of deleting them after the rollback")
+	f.StringVar(&client.PrunePolicy, "prune-policy", string(phases.PrunePolicyPrune), "what to do with the resources removed from the chart after the rollback: \"prune\" deletes them, \"warn-only\" keeps them with a warning, \"keep\" keeps them")
+	f.StringVar(&client.UnsupportedResourcesPolicy, "unsupported-resources-policy", string(phases.UnsupportedResourcesPolicyWarn), "what to do with the resources whose readiness can't be tracked when waiting for them: \"warn\" applies them without tracking with a warning, \"fail\" fails the rollback, \"skip\" skips them")
+	f.BoolVar(&client.RelaxPodDisruptionBudgets, "relax-pod-disruption-budgets", false, "let the pods selected by the PodDisruptionBudgets of the workloads be disrupted during the rollout, restoring the budgets afterwards")
+	f.BoolVar(&client.VerifyCronJobs, "verify-cronjobs", false, "create a Job from the template of every CronJob with a server-side dry-run to fail the rollback if the Jobs would be rejected on the next scheduled run")
+	f.BoolVar(&client.MigrateCRDStoredVersions, "migrate-crd-stored-versions", false, "migrate the stored objects of the CustomResourceDefinitions whose update removes the versions still listed in their status.storedVersions instead of failing the rollback")
+	f.StringArrayVar(&client.ReleaseDependencies, "wait-for-release", nil, "wait up to --timeout for a release, given as [<namespace>/]<name>[@<min revision>], to be deployed before the rollback (can specify multiple)")
+	f.StringToStringVar(&client.Metadata, "metadata", nil, "arbitrary key=value data (e.g. ticket ID or git commit) to store in the new release revision. Should be separated by comma.")
 	f.IntVar(&client.MaxHistory, "history-max", settings.MaxHistory, "limit the maximum number of revisions saved per release. Use 0 for no limit")
 
-	f.StringVar(&client.DeployReportPath, "deploy-report-path", "", "save deploy report in JSON to the specified path")
+	f.StringVar(&client.DeployReportPath, "deploy-report-path", "", "save deploy report to the specified path")
+	f.StringVar(&client.DeployReportFormat, "deploy-report-format", release.DeployReportFormatJSON, "format of the deploy report, \"json\" or \"yaml\"")
+	f.Var(&client.LogsTailWindow, "logs-tail-window", "show only the last lines, the logs of the last period or both of every container of the tracked resources, given as <lines>, <duration> or <lines>,<duration>, e.g. 100,5m")
+	f.BoolVar(&client.HideLogs, "hide-logs", false, "do not show the logs of the containers of the tracked resources, only the other messages of the tracking")
+	f.StringVar(&client.LogsDir, "logs-dir", "", "also write the logs of the containers of the tracked resources to <dir>/<namespace>/<kind>-<name>/<container>.log, e.g. to keep them as CI artifacts")
+	bindNotifyFlags(cmd, &client.Notifiers, &client.NotificationReportURL)
+	bindCIOutputFlag(cmd, &outfmt)
 
 	return cmd
 }
@@ -110,4 +174,8 @@ type RollbackCmdOptions struct {
 
 	StagesExternalDepsGenerator phases.ExternalDepsGenerator
 	DeployReportPath            *string
+	DeployReportFormat          *string
+	DeployExtender              phases.DeployExtender
+	// Notifiers are notified of the deploy in addition to the ones of the flags.
+	Notifiers []action.Notifier
 }
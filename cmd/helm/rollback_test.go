@@ -66,6 +66,11 @@ func TestRollbackCmd(t *testing.T) {
 		cmd:    "rollback funny-honey",
 		golden: "output/rollback-no-revision.txt",
 		rels:   rels,
+	}, {
+		name:   "rollback a release with the github output",
+		cmd:    "rollback funny-honey 1 --output github",
+		golden: "output/rollback-github.txt",
+		rels:   rels,
 	}, {
 		name:      "rollback a release with non-existent version",
 		cmd:       "rollback funny-honey 3",
@@ -82,6 +87,10 @@ func TestRollbackCmd(t *testing.T) {
 	runTestCmd(t, tests)
 }
 
+func TestRollbackOutputCompletion(t *testing.T) {
+	ciOutputFlagCompletionTest(t, "rollback")
+}
+
 func TestRollbackRevisionCompletion(t *testing.T) {
 	mk := func(name string, vers int, status release.Status) *release.Release {
 		return release.Mock(&release.MockReleaseOptions{
@@ -51,9 +51,20 @@ Environment variables:
 | $HELM_CONFIG_HOME                  | set an alternative location for storing Helm configuration.                                                |
 | $HELM_DATA_HOME                    | set an alternative location for storing Helm data.                                                         |
 | $HELM_DEBUG                        | indicate whether or not Helm is running in Debug mode                                                      |
-| $HELM_DRIVER                       | set the backend storage driver. Values are: configmap, secret, memory, sql.                                |
+| $HELM_DRIVER                       | set the backend storage driver. Values are: configmap, secret, chunked-secret, memory, sql.                |
 | $HELM_DRIVER_SQL_CONNECTION_STRING | set the connection string the SQL storage driver should use.                                               |
+| $HELM_DRIVER_SQL_DIALECT           | set the database of the SQL storage driver. Values are: postgres (default), mysql.                         |
+| $HELM_DRIVER_COMPRESSION           | set the compression of stored releases. Values are: gzip (default), zstd.                                  |
+| $HELM_DRIVER_ENCRYPTION_KEY        | set the base64 encoded AES key (16, 24 or 32 bytes) encrypting stored releases.                            |
+| $HELM_DRIVER_ENCRYPTION_KEY_FILE   | set the file holding the base64 encoded key encrypting stored releases.                                    |
+| $HELM_DRIVER_ENCRYPTION_KMS_PLUGIN | set the command printing the base64 encoded key encrypting stored releases.                                |
 | $HELM_MAX_HISTORY                  | set the maximum number of helm release history.                                                            |
+| $HELM_UPDATE_CONCURRENCY           | set how many resources of the same kind are applied at once on upgrade (default 1).                        |
+| $HELM_APPLY_STRATEGY               | set how existing resources are updated: "three-way-merge" (default), "server-side" or "auto".              |
+| $HELM_READINESS_ENGINE             | set how the readiness of resources is checked: "builtin" (default) or "kstatus".                           |
+| $HELM_MAX_ERROR_SIZE               | set the maximum size in bytes of resource errors, longer ones are truncated (default 4096, -1 disables).   |
+| $HELM_ERROR_DUMP_DIR               | set the directory truncated resource errors are written to in full, with the resource manifests.           |
+| $HELM_METRICS_PUSHGATEWAY          | set the URL of the Pushgateway the metrics of the deploys are pushed to.                                   |
 | $HELM_NAMESPACE                    | set the namespace used for the helm operations.                                                            |
 | $HELM_NO_PLUGINS                   | disable plugins. Set HELM_NO_PLUGINS=1 to disable plugins.                                                 |
 | $HELM_PLUGINS                      | set the path to the plugins directory                                                                      |
@@ -173,10 +184,12 @@ func newRootCmd(actionConfig *action.Configuration, out io.Writer, args []string
 		newVerifyCmd(out),
 
 		// release commands
+		newAdoptCmd(actionConfig, out),
 		newGetCmd(actionConfig, out),
 		newHistoryCmd(actionConfig, out),
 		newInstallCmd(actionConfig, out),
 		newListCmd(actionConfig, out),
+		newPinCmd(actionConfig, out),
 		newReleaseTestCmd(actionConfig, out),
 		newRollbackCmd(actionConfig, out),
 		newStatusCmd(actionConfig, out),
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
@@ -142,6 +143,31 @@ func (s statusPrinter) WriteTable(out io.Writer) error {
 	if s.showDescription {
 		_, _ = fmt.Fprintf(out, "DESCRIPTION: %s\n", s.release.Info.Description)
 	}
+	if len(s.release.Metadata) > 0 {
+		_, _ = fmt.Fprintf(out, "METADATA:\n")
+		keys := make([]string, 0, len(s.release.Metadata))
+		for k := range s.release.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			_, _ = fmt.Fprintf(out, "  %s: %s\n", k, s.release.Metadata[k])
+		}
+	}
+	if len(s.release.Dependencies) > 0 {
+		_, _ = fmt.Fprintf(out, "DEPENDENCIES:\n")
+		for _, dep := range s.release.Dependencies {
+			state := "enabled"
+			if !dep.Enabled {
+				state = "disabled"
+			}
+			decidedBy := string(dep.DecidedBy)
+			if dep.Key != "" {
+				decidedBy += " " + dep.Key
+			}
+			_, _ = fmt.Fprintf(out, "  %s: %s (%s)\n", dep.Path, state, decidedBy)
+		}
+	}
 
 	if s.showResources && s.release.Info.Resources != nil && len(s.release.Info.Resources) > 0 {
 		buf := new(bytes.Buffer)
@@ -225,6 +251,41 @@ func (s statusPrinter) WriteTable(out io.Writer) error {
 	return nil
 }
 
+func (s statusPrinter) WriteCI(r *output.CIReporter) error {
+	if s.release == nil {
+		return nil
+	}
+
+	if err := r.Section("release_"+s.release.Name, fmt.Sprintf("Release %s", s.release.Name), func() error {
+		var buf bytes.Buffer
+		if err := s.WriteTable(&buf); err != nil {
+			return err
+		}
+		return r.Printf("%s", buf.String())
+	}); err != nil {
+		return err
+	}
+
+	level := output.AnnotationNotice
+	switch s.release.Info.Status {
+	case release.StatusFailed:
+		level = output.AnnotationError
+	case release.StatusUnknown, release.StatusPendingInstall, release.StatusPendingUpgrade, release.StatusPendingRollback:
+		level = output.AnnotationWarning
+	}
+
+	message := fmt.Sprintf("revision %d in namespace %q is %s", s.release.Version, s.release.Namespace, s.release.Info.Status)
+	if s.release.Info.Description != "" {
+		message = fmt.Sprintf("%s: %s", message, s.release.Info.Description)
+	}
+
+	return r.Annotate(output.Annotation{
+		Level:   level,
+		Title:   fmt.Sprintf("Release %s", s.release.Name),
+		Message: message,
+	})
+}
+
 func executionsByHookEvent(rel *release.Release) map[release.HookEvent][]*release.Hook {
 	result := make(map[release.HookEvent][]*release.Hook)
 	for _, h := range rel.Hooks {
@@ -38,6 +38,14 @@ func TestStatusCmd(t *testing.T) {
 	}
 
 	tests := []cmdTestCase{{
+		name:      "get status with a CI output format",
+		cmd:       "status flummoxed-chickadee --output github",
+		golden:    "output/status-ci-output.txt",
+		wantError: true,
+		rels: releasesMockWithStatus(&release.Info{
+			Status: release.StatusDeployed,
+		}),
+	}, {
 		name:   "get status of a deployed release",
 		cmd:    "status flummoxed-chickadee",
 		golden: "output/status.txt",
@@ -52,6 +60,32 @@ func TestStatusCmd(t *testing.T) {
 			Status:      release.StatusDeployed,
 			Description: "Mock description",
 		}),
+	}, {
+		name:   "get status of a deployed release with metadata",
+		cmd:    "status flummoxed-chickadee",
+		golden: "output/status-with-metadata.txt",
+		rels: func() []*release.Release {
+			rels := releasesMockWithStatus(&release.Info{
+				Status: release.StatusDeployed,
+			})
+			rels[0].Metadata = map[string]string{"ticket": "OPS-42", "commit": "0a1b2c3"}
+			return rels
+		}(),
+	}, {
+		name:   "get status of a deployed release with dependencies",
+		cmd:    "status flummoxed-chickadee",
+		golden: "output/status-with-dependencies.txt",
+		rels: func() []*release.Release {
+			rels := releasesMockWithStatus(&release.Info{
+				Status: release.StatusDeployed,
+			})
+			rels[0].Dependencies = []*chart.DependencyResolution{
+				{Path: "postgresql", Enabled: true, DecidedBy: chart.DependencyDecisionCondition, Key: "postgresql.enabled"},
+				{Path: "redis", Enabled: false, DecidedBy: chart.DependencyDecisionTags, Key: "cache"},
+				{Path: "common", Enabled: true, DecidedBy: chart.DependencyDecisionDefault},
+			}
+			return rels
+		}(),
 	}, {
 		name:   "get status of a deployed release with notes",
 		cmd:    "status flummoxed-chickadee",
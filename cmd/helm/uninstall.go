@@ -17,8 +17,10 @@ limitations under the License.
 package helm_v3
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -35,10 +37,16 @@ as well as the release history, freeing it up for future use.
 
 Use the '--dry-run' flag to see which releases will be uninstalled without actually
 uninstalling them.
+
+Use the '--impact' flag to see which resources will be deleted, including the
+volumes whose data is lost and the custom resources deleted along with their
+CustomResourceDefinitions, without uninstalling anything. With the '--confirm'
+flag the impact is shown and the release is only uninstalled once confirmed.
 `
 
 func NewUninstallCmd(cfg *action.Configuration, out io.Writer, opts UninstallCmdOptions) *cobra.Command {
 	client := action.NewUninstall(cfg, opts.StagesSplitter)
+	var showImpact, confirm bool
 
 	cmd := &cobra.Command{
 		Use:        "uninstall RELEASE_NAME [...]",
@@ -68,6 +76,33 @@ func NewUninstallCmd(cfg *action.Configuration, out io.Writer, opts UninstallCmd
 
 			client.Namespace = Settings.Namespace()
 
+			if showImpact {
+				for i := 0; i < len(args); i++ {
+					impact, err := client.Impact(args[i])
+					if err != nil {
+						return err
+					}
+					fmt.Fprint(out, impact)
+				}
+				return nil
+			}
+
+			if confirm {
+				in := bufio.NewReader(cmd.InOrStdin())
+				client.ConfirmImpact = func(impact *action.DeletionImpact) (bool, error) {
+					fmt.Fprint(out, impact)
+					fmt.Fprintf(out, "Uninstall release %q? [y/N]: ", impact.Release)
+
+					answer, err := in.ReadString('\n')
+					if err != nil && err != io.EOF {
+						return false, err
+					}
+					answer = strings.ToLower(strings.TrimSpace(answer))
+
+					return answer == "y" || answer == "yes", nil
+				}
+			}
+
 			for i := 0; i < len(args); i++ {
 
 				res, err := client.Run(args[i])
@@ -92,7 +127,12 @@ func NewUninstallCmd(cfg *action.Configuration, out io.Writer, opts UninstallCmd
 	f.BoolVar(&client.Wait, "wait", false, "if set, will wait until all the resources are deleted before returning. It will wait for as long as --timeout")
 	f.StringVar(&client.DeletionPropagation, "cascade", "background", "Must be \"background\", \"orphan\", or \"foreground\". Selects the deletion cascading strategy for the dependents. Defaults to background.")
 	f.DurationVar(&client.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	f.DurationVar(&client.HooksTimeout, "hooks-timeout", 0, "time to wait for each hook to complete, overridden by the werf.io/hook-timeout annotation of the hook (defaults to --timeout)")
+	f.IntVar(&client.HooksConcurrency, "hooks-concurrency", 1, "how many hooks of the same weight to execute at once")
+	f.IntVar(&client.HooksMaxFailures, "hooks-max-failures", 1, "how many hooks of the same weight may fail before the remaining ones are not executed, a negative number executes all of them")
 	f.StringVar(&client.Description, "description", "", "add a custom description")
+	f.BoolVar(&showImpact, "impact", false, "show the resources, volumes and custom resources the uninstall would delete, without uninstalling")
+	f.BoolVar(&confirm, "confirm", false, "show the impact of the uninstall and ask for confirmation before deleting anything")
 
 	return cmd
 }
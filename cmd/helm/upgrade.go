@@ -38,6 +38,7 @@ import (
 	"github.com/werf/3p-helm/pkg/errs"
 	"github.com/werf/3p-helm/pkg/getter"
 	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
 	"github.com/werf/3p-helm/pkg/storage/driver"
 )
 
@@ -84,12 +85,14 @@ func NewUpgradeCmd(cfg *action.Configuration, out io.Writer, opts UpgradeCmdOpti
 	upgradeOpts := action.UpgradeOptions{
 		StagesSplitter:              opts.StagesSplitter,
 		StagesExternalDepsGenerator: opts.StagesExternalDepsGenerator,
+		DeployExtender:              opts.DeployExtender,
 	}
 	if opts.IgnorePending != nil {
 		upgradeOpts.IgnorePending = *opts.IgnorePending
 	}
 
 	client := action.NewUpgrade(cfg, upgradeOpts)
+	client.Notifiers = opts.Notifiers
 	valueOpts := &values.Options{}
 	var outfmt output.Format
 	var createNamespace bool
@@ -137,6 +140,9 @@ func NewUpgradeCmd(cfg *action.Configuration, out io.Writer, opts UpgradeCmdOpti
 			if opts.DeployReportPath != nil {
 				client.DeployReportPath = *opts.DeployReportPath
 			}
+			if opts.DeployReportFormat != nil {
+				client.DeployReportFormat = *opts.DeployReportFormat
+			}
 
 			client.Namespace = settings.Namespace()
 
@@ -157,7 +163,17 @@ func NewUpgradeCmd(cfg *action.Configuration, out io.Writer, opts UpgradeCmdOpti
 			// Must load values AFTER determining if we have to call install so that values loaded from stdin are are not read twice
 			if client.Install {
 				// If a release does not exist, install it.
-				histClient := action.NewHistory(cfg)
+				histCfg := cfg
+				if client.ClusterScoped && client.ControlNamespace != "" {
+					releases, err := cfg.ReleasesInNamespace(client.ControlNamespace)
+					if err != nil {
+						return err
+					}
+					controlCfg := *cfg
+					controlCfg.Releases = releases
+					histCfg = &controlCfg
+				}
+				histClient := action.NewHistory(histCfg)
 				histClient.Max = 1
 				if _, err := histClient.Run(args[0]); err == driver.ErrReleaseNotFound {
 					// Only print this to stdout for table output
@@ -165,6 +181,7 @@ func NewUpgradeCmd(cfg *action.Configuration, out io.Writer, opts UpgradeCmdOpti
 						fmt.Fprintf(out, "Release %q does not exist. Installing it now.\n", args[0])
 					}
 					instClient := action.NewInstall(cfg, opts.StagesSplitter, opts.StagesExternalDepsGenerator)
+					instClient.DeployExtender = client.DeployExtender
 					instClient.CreateNamespace = createNamespace
 					instClient.ChartPathOptions = client.ChartPathOptions
 					instClient.Force = client.Force
@@ -173,8 +190,13 @@ func NewUpgradeCmd(cfg *action.Configuration, out io.Writer, opts UpgradeCmdOpti
 					instClient.DisableHooks = client.DisableHooks
 					instClient.SkipCRDs = client.SkipCRDs
 					instClient.Timeout = client.Timeout
+					instClient.HooksTimeout = client.HooksTimeout
+					instClient.HooksConcurrency = client.HooksConcurrency
+					instClient.HooksMaxFailures = client.HooksMaxFailures
 					instClient.Wait = client.Wait
 					instClient.WaitForJobs = client.WaitForJobs
+					instClient.WaitForOwnedResources = client.WaitForOwnedResources
+					instClient.InjectDeployMetadata = client.InjectDeployMetadata
 					instClient.Devel = client.Devel
 					instClient.Namespace = client.Namespace
 					instClient.Atomic = client.Atomic
@@ -184,10 +206,38 @@ func NewUpgradeCmd(cfg *action.Configuration, out io.Writer, opts UpgradeCmdOpti
 					instClient.Description = client.Description
 					instClient.DependencyUpdate = client.DependencyUpdate
 					instClient.Labels = client.Labels
+					instClient.Metadata = client.Metadata
+					instClient.WatchEvents = client.WatchEvents
+					instClient.APIUnavailabilityBudget = client.APIUnavailabilityBudget
+					instClient.ImmutableGenerationsToKeep = client.ImmutableGenerationsToKeep
+					instClient.PrunePolicy = client.PrunePolicy
+					instClient.UnsupportedResourcesPolicy = client.UnsupportedResourcesPolicy
+					instClient.RelaxPodDisruptionBudgets = client.RelaxPodDisruptionBudgets
+					instClient.VerifyCronJobs = client.VerifyCronJobs
+					instClient.MigrateCRDStoredVersions = client.MigrateCRDStoredVersions
+					instClient.ReleaseDependencies = client.ReleaseDependencies
+					instClient.AdoptResources = client.AdoptResources
+					instClient.IncludeResources = client.IncludeResources
+					instClient.RenderDebugDir = client.RenderDebugDir
+					instClient.RenderTimeout = client.RenderTimeout
+					instClient.TemplateRenderTimeout = client.TemplateRenderTimeout
+					instClient.ImageDigestCacheFile = client.ImageDigestCacheFile
+					instClient.ManifestLimits = client.ManifestLimits
+					instClient.ExcludeResources = client.ExcludeResources
 					instClient.EnableDNS = client.EnableDNS
 
 					instClient.CleanupOnFail = client.CleanupOnFail
 					instClient.DeployReportPath = client.DeployReportPath
+					instClient.DeployReportFormat = client.DeployReportFormat
+					instClient.PlanOutputPath = client.PlanOutputPath
+					instClient.PlanOutputFormat = client.PlanOutputFormat
+					instClient.Notifiers = client.Notifiers
+					instClient.NotificationReportURL = client.NotificationReportURL
+					instClient.ClusterScoped = client.ClusterScoped
+					instClient.ControlNamespace = client.ControlNamespace
+					instClient.LogsTailWindow = client.LogsTailWindow
+					instClient.HideLogs = client.HideLogs
+					instClient.LogsDir = client.LogsDir
 
 					rel, err := runInstall(args, instClient, valueOpts, out)
 					if err != nil {
@@ -231,6 +281,9 @@ func NewUpgradeCmd(cfg *action.Configuration, out io.Writer, opts UpgradeCmdOpti
 			if err != nil {
 				return err
 			}
+			if client.ValuesFiles, err = valueOpts.ResolvedValueFiles(); err != nil {
+				return err
+			}
 
 			// Check chart dependencies to make sure all are present in /charts
 			ch, err := loader.Load(chartPath)
@@ -309,24 +362,58 @@ func NewUpgradeCmd(cfg *action.Configuration, out io.Writer, opts UpgradeCmdOpti
 	f.BoolVar(&client.DisableOpenAPIValidation, "disable-openapi-validation", false, "if set, the upgrade process will not validate rendered templates against the Kubernetes OpenAPI Schema")
 	f.BoolVar(&client.SkipCRDs, "skip-crds", false, "if set, no CRDs will be installed when an upgrade is performed with install flag enabled. By default, CRDs are installed if not already present, when an upgrade is performed with install flag enabled")
 	f.DurationVar(&client.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	f.DurationVar(&client.HooksTimeout, "hooks-timeout", 0, "time to wait for each hook to complete, overridden by the werf.io/hook-timeout annotation of the hook (defaults to --timeout)")
+	f.IntVar(&client.HooksConcurrency, "hooks-concurrency", 1, "how many hooks of the same weight to execute at once")
+	f.IntVar(&client.HooksMaxFailures, "hooks-max-failures", 1, "how many hooks of the same weight may fail before the remaining ones are not executed, a negative number executes all of them")
 	f.BoolVar(&client.ResetValues, "reset-values", false, "when upgrading, reset the values to the ones built into the chart")
 	f.BoolVar(&client.ReuseValues, "reuse-values", false, "when upgrading, reuse the last release's values and merge in any overrides from the command line via --set and -f. If '--reset-values' is specified, this is ignored")
 	f.BoolVar(&client.ResetThenReuseValues, "reset-then-reuse-values", false, "when upgrading, reset the values to the ones built into the chart, apply the last release's values and merge in any overrides from the command line via --set and -f. If '--reset-values' or '--reuse-values' is specified, this is ignored")
 	f.BoolVar(&client.Wait, "wait", false, "if set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful. It will wait for as long as --timeout")
 	f.BoolVar(&client.WaitForJobs, "wait-for-jobs", false, "if set and --wait enabled, will wait until all Jobs have been completed before marking the release as successful. It will wait for as long as --timeout")
+	f.BoolVar(&client.WaitForOwnedResources, "wait-for-owned-resources", false, "if set and --wait enabled, will also wait for the resources owned by custom resources, such as the workloads created by operators, and report their failures")
+	f.BoolVar(&client.InjectDeployMetadata, "inject-deploy-metadata", false, "annotate the pod templates of changed workloads with werf.io/release-revision and werf.io/deployed-at")
 	f.BoolVar(&client.Atomic, "atomic", false, "if set, upgrade process rolls back changes made in case of failed upgrade. The --wait flag will be set automatically if --atomic is used")
 	f.IntVar(&client.MaxHistory, "history-max", settings.MaxHistory, "limit the maximum number of revisions saved per release. Use 0 for no limit")
 	f.BoolVar(&client.CleanupOnFail, "cleanup-on-fail", false, "allow deletion of new resources created in this upgrade when upgrade fails")
 	f.BoolVar(&client.SubNotes, "render-subchart-notes", false, "if set, render subchart notes along with the parent")
 	f.StringToStringVarP(&client.Labels, "labels", "l", nil, "Labels that would be added to release metadata. Should be separated by comma. Original release labels will be merged with upgrade labels. You can unset label using null.")
+	f.StringVar(&client.RenderDebugDir, "render-debug-dir", "", "write the output, the context, with the values redacted, and the render time of every template into this directory")
+	f.DurationVar(&client.RenderTimeout, "render-timeout", 0, "time to wait for all chart templates to render (e.g. 1m). Unlimited by default")
+	f.DurationVar(&client.TemplateRenderTimeout, "template-render-timeout", 0, "time to wait for any single chart template to render (e.g. 10s). Unlimited by default")
+	f.StringVar(&client.ImageDigestCacheFile, "image-digest-cache", "", "JSON file to store the image digests resolved by werf_image in and to read them from when the registry is unreachable")
+	f.IntVar(&client.ManifestLimits.MaxResources, "max-resources", 0, "fail if the release has more resources, hooks included. Unlimited by default")
+	f.IntVar(&client.ManifestLimits.MaxManifestSize, "max-manifest-size", 0, "fail if any single rendered manifest is larger in bytes. Unlimited by default")
+	f.IntVar(&client.ManifestLimits.MaxTotalManifestSize, "max-total-manifest-size", 0, "fail if all rendered manifests of the release are larger in bytes in total. Unlimited by default")
+	f.StringArrayVar(&client.IncludeResources, "include", nil, "deploy only the chart resources matching any of these matchers: <kind>/<name> or label:<key>=<value>, globs are allowed")
+	f.StringArrayVar(&client.ExcludeResources, "exclude", nil, "do not deploy the chart resources matching any of these matchers: <kind>/<name> or label:<key>=<value>, globs are allowed")
+	f.BoolVar(&client.WatchEvents, "watch-events", false, "include Warning events of the release resources and of the Pods they create into the error if the upgrade fails")
+	f.DurationVar(&client.APIUnavailabilityBudget, "api-unavailability-budget", 0, "pause the upgrade while the Kubernetes API server is unavailable and resume it once the API server is back, failing if it stays unavailable longer than this (0 disables pausing)")
+	f.IntVar(&client.ImmutableGenerationsToKeep, "keep-immutable-generations", 0, "keep the generations of immutable ConfigMaps and Secrets used by this many last revisions instead of deleting them after the upgrade")
+	f.StringVar(&client.PrunePolicy, "prune-policy", string(phases.PrunePolicyPrune), "what to do with the resources removed from the chart after the upgrade: \"prune\" deletes them, \"warn-only\" keeps them with a warning, \"keep\" keeps them")
+	f.StringVar(&client.UnsupportedResourcesPolicy, "unsupported-resources-policy", string(phases.UnsupportedResourcesPolicyWarn), "what to do with the resources whose readiness can't be tracked when waiting for them: \"warn\" applies them without tracking with a warning, \"fail\" fails the upgrade, \"skip\" skips them")
+	f.BoolVar(&client.RelaxPodDisruptionBudgets, "relax-pod-disruption-budgets", false, "let the pods selected by the PodDisruptionBudgets of the workloads be disrupted during the rollout, restoring the budgets afterwards")
+	f.BoolVar(&client.VerifyCronJobs, "verify-cronjobs", false, "create a Job from the template of every CronJob with a server-side dry-run to fail the upgrade if the Jobs would be rejected on the next scheduled run")
+	f.BoolVar(&client.MigrateCRDStoredVersions, "migrate-crd-stored-versions", false, "migrate the stored objects of the CustomResourceDefinitions whose update removes the versions still listed in their status.storedVersions instead of failing the upgrade")
+	f.StringArrayVar(&client.ReleaseDependencies, "wait-for-release", nil, "wait up to --timeout for a release, given as [<namespace>/]<name>[@<min revision>], to be deployed before the upgrade (can specify multiple)")
+	f.StringArrayVar(&client.AdoptResources, "adopt", nil, "adopt the existing resources not belonging to any release which match any of these matchers: <kind>/<name> or label:<key>=<value>, globs are allowed")
+	f.StringToStringVar(&client.Metadata, "metadata", nil, "arbitrary key=value data (e.g. ticket ID or git commit) to store in the new release revision. Should be separated by comma.")
 	f.StringVar(&client.Description, "description", "", "add a custom description")
 	f.BoolVar(&client.DependencyUpdate, "dependency-update", false, "update dependencies if they are missing before installing the chart")
 	f.BoolVar(&client.EnableDNS, "enable-dns", false, "enable DNS lookups when rendering templates")
-	f.StringVar(&client.DeployReportPath, "deploy-report-path", "", "save deploy report in JSON to the specified path")
+	f.StringVar(&client.DeployReportPath, "deploy-report-path", "", "save deploy report to the specified path")
+	f.StringVar(&client.DeployReportFormat, "deploy-report-format", release.DeployReportFormatJSON, "format of the deploy report, \"json\" or \"yaml\"")
+	f.StringVar(&client.PlanOutputPath, "plan-output-path", "", "save the plan of the deploy to the specified path before deploying")
+	f.StringVar(&client.PlanOutputFormat, "plan-output-format", action.DeployPlanFormatJSON, "format of the deploy plan, \"json\" or \"yaml\"")
+	f.Var(&client.LogsTailWindow, "logs-tail-window", "show only the last lines, the logs of the last period or both of every container of the tracked resources, given as <lines>, <duration> or <lines>,<duration>, e.g. 100,5m")
+	f.BoolVar(&client.HideLogs, "hide-logs", false, "do not show the logs of the containers of the tracked resources, only the other messages of the tracking")
+	f.StringVar(&client.LogsDir, "logs-dir", "", "also write the logs of the containers of the tracked resources to <dir>/<namespace>/<kind>-<name>/<container>.log, e.g. to keep them as CI artifacts")
+	f.BoolVar(&client.ClusterScoped, "cluster-scoped", false, "the release contains only cluster-scoped resources: do not create the release namespace and fail on namespaced resources. The release namespace is only used to store the release records")
+	f.StringVar(&client.ControlNamespace, "control-namespace", "", "with --cluster-scoped, the namespace of the release, which its records are stored in, instead of the namespace of the command")
 	addChartPathOptionsFlags(f, &client.ChartPathOptions)
 	addValueOptionsFlags(f, valueOpts)
-	bindOutputFlag(cmd, &outfmt)
+	bindCIOutputFlag(cmd, &outfmt)
 	bindPostRenderFlag(cmd, &client.PostRenderer)
+	bindNotifyFlags(cmd, &client.Notifiers, &client.NotificationReportURL)
 
 	err := cmd.RegisterFlagCompletionFunc("version", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		if len(args) != 2 {
@@ -359,5 +446,9 @@ type UpgradeCmdOptions struct {
 	IgnorePending               *bool
 	CleanupOnFail               *bool
 	DeployReportPath            *string
+	DeployReportFormat          *string
 	StagesExternalDepsGenerator phases.ExternalDepsGenerator
+	DeployExtender              phases.DeployExtender
+	// Notifiers are notified of the deploy in addition to the ones of the flags.
+	Notifiers []action.Notifier
 }
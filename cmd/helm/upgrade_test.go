@@ -392,7 +392,7 @@ func prepareMockRelease(releaseName string, t *testing.T) (func(n string, v int,
 }
 
 func TestUpgradeOutputCompletion(t *testing.T) {
-	outputFlagCompletionTest(t, "upgrade")
+	ciOutputFlagCompletionTest(t, "upgrade")
 }
 
 func TestUpgradeVersionCompletion(t *testing.T) {
@@ -18,11 +18,13 @@ package action
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -36,6 +38,8 @@ import (
 	"github.com/werf/3p-helm/pkg/chartutil"
 	"github.com/werf/3p-helm/pkg/engine"
 	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/phases/stages/externaldeps"
 	"github.com/werf/3p-helm/pkg/postrender"
 	"github.com/werf/3p-helm/pkg/registry"
 	"github.com/werf/3p-helm/pkg/release"
@@ -94,7 +98,100 @@ type Configuration struct {
 	// Capabilities describes the capabilities of the Kubernetes cluster.
 	Capabilities *chartutil.Capabilities
 
+	// ReleasesInNamespace returns the release storage of another namespace, it
+	// is used to wait for release dependencies. Set by Init.
+	ReleasesInNamespace func(namespace string) (*storage.Storage, error)
+
+	// InstallOrder overrides the order in which manifests are installed by
+	// Kind, releaseutil.InstallOrder if nil. Use KindSortOrder.InsertBefore
+	// and InsertAfter to extend the default ordering.
+	InstallOrder releaseutil.KindSortOrder
+
+	// UninstallOrder overrides the order in which manifests are uninstalled
+	// by Kind. If nil, the reverse of InstallOrder is used if it is set and
+	// releaseutil.UninstallOrder otherwise.
+	UninstallOrder releaseutil.KindSortOrder
+
+	// SQLDialect is the database of the "sql" storage driver set up by Init,
+	// driver.SQLDialectPostgreSQL or driver.SQLDialectMySQL. If empty,
+	// HELM_DRIVER_SQL_DIALECT is used, and PostgreSQL if it is not set.
+	SQLDialect string
+	// SQLConnectionString is the connection string of the "sql" storage
+	// driver set up by Init, HELM_DRIVER_SQL_CONNECTION_STRING if empty.
+	SQLConnectionString string
+
+	// Metrics, if set, records the metrics of the deploys made with the
+	// configuration.
+	Metrics *Metrics
+
 	Log func(string, ...interface{})
+
+	// ctx is the context of the action the configuration is bound to, see
+	// withContext.
+	ctx context.Context
+	// warnings counts the warnings of the deploy, see withWarningsCounter.
+	warnings *int32
+}
+
+// withContext returns a copy of the configuration bound to ctx: the kube
+// client, if it supports it, and the Kubernetes API calls made by the action
+// are cancelled when ctx is done.
+func (cfg *Configuration) withContext(ctx context.Context) *Configuration {
+	c := *cfg
+	c.ctx = ctx
+	if kubeClient, ok := cfg.KubeClient.(kube.InterfaceContext); ok {
+		c.KubeClient = kubeClient.WithContext(ctx)
+	}
+
+	return &c
+}
+
+// withLogsOptions returns a copy of the configuration whose kube client shows
+// the logs of the containers of the tracked resources with the options.
+func (cfg *Configuration) withLogsOptions(opts kube.LogsOptions) *Configuration {
+	c := *cfg
+	if kubeClient, ok := cfg.KubeClient.(kube.InterfaceLogsOptions); ok {
+		c.KubeClient = kubeClient.WithLogsOptions(opts)
+	}
+
+	return &c
+}
+
+// newLogsOptions returns the LogsOptions of the deploy of the release, writing
+// the streamed logs of the containers to the files and to the progress
+// stream, if any.
+func newLogsOptions(hide bool, tailWindow kube.LogsTailWindow, files *kube.ContainerLogFiles, progress *release.ProgressStream, rel *release.Release) kube.LogsOptions {
+	opts := kube.LogsOptions{Hide: hide, TailWindow: tailWindow}
+	if files != nil {
+		opts.Writers = append(opts.Writers, files)
+	}
+	if progress != nil {
+		opts.Writers = append(opts.Writers, &progressLogsWriter{progress: progress, rel: rel})
+	}
+
+	return opts
+}
+
+// progressLogsWriter emits the streamed logs of the containers as the
+// progress events of the release.
+type progressLogsWriter struct {
+	progress *release.ProgressStream
+	rel      *release.Release
+}
+
+func (w *progressLogsWriter) WriteContainerLogs(kind, name, namespace, container string, lines []string) error {
+	w.progress.ContainerLogs(w.rel, kind, name, namespace, container, lines)
+	return nil
+}
+
+// baseContext returns the context the configuration is bound to, or the
+// background context.
+func (cfg *Configuration) baseContext() context.Context {
+	if cfg.ctx != nil {
+		return cfg.ctx
+	}
+
+	return context.Background()
 }
 
 // renderResources renders the templates in a chart
@@ -103,7 +200,7 @@ type Configuration struct {
 // TODO: As part of the refactor the duplicate code in cmd/helm/template.go should be removed
 //
 //	This code has to do with writing files to disk.
-func (cfg *Configuration) renderResources(ch *chart.Chart, values chartutil.Values, releaseName, outputDir string, subNotes, useReleaseName, includeCrds bool, pr postrender.PostRenderer, interactWithRemote, enableDNS bool) ([]*release.Hook, *bytes.Buffer, string, error) {
+func (cfg *Configuration) renderResources(ch *chart.Chart, values chartutil.Values, releaseName, outputDir string, subNotes, useReleaseName, includeCrds bool, pr postrender.PostRenderer, interactWithRemote, enableDNS bool, opts renderOptions) ([]*release.Hook, *bytes.Buffer, string, error) {
 	hs := []*release.Hook{}
 	b := bytes.NewBuffer(nil)
 
@@ -131,10 +228,12 @@ func (cfg *Configuration) renderResources(ch *chart.Chart, values chartutil.Valu
 		}
 		e := engine.New(restConfig)
 		e.EnableDNS = enableDNS
+		opts.apply(&e)
 		files, err2 = e.Render(ch, values)
 	} else {
 		var e engine.Engine
 		e.EnableDNS = enableDNS
+		opts.apply(&e)
 		files, err2 = e.Render(ch, values)
 	}
 
@@ -165,7 +264,7 @@ func (cfg *Configuration) renderResources(ch *chart.Chart, values chartutil.Valu
 	// Sort hooks, manifests, and partials. Only hooks and manifests are returned,
 	// as partials are not used after renderer.Render. Empty manifests are also
 	// removed here.
-	hs, manifests, err := releaseutil.SortManifests(files, caps.APIVersions, releaseutil.InstallOrder)
+	hs, manifests, err := releaseutil.SortManifests(files, caps.APIVersions, cfg.installOrder())
 	if err != nil {
 		// By catching parse errors here, we can prevent bogus releases from going
 		// to Kubernetes.
@@ -225,6 +324,10 @@ func (cfg *Configuration) renderResources(ch *chart.Chart, values chartutil.Valu
 		}
 	}
 
+	if err := opts.Limits.check(b.String(), hs); err != nil {
+		return hs, b, notes, err
+	}
+
 	return hs, b, notes, nil
 }
 
@@ -280,6 +383,40 @@ func (cfg *Configuration) getCapabilities() (*chartutil.Capabilities, error) {
 	return cfg.Capabilities, nil
 }
 
+func (cfg *Configuration) installOrder() releaseutil.KindSortOrder {
+	if cfg.InstallOrder != nil {
+		return cfg.InstallOrder
+	}
+
+	return releaseutil.InstallOrder
+}
+
+func (cfg *Configuration) uninstallOrder() releaseutil.KindSortOrder {
+	switch {
+	case cfg.UninstallOrder != nil:
+		return cfg.UninstallOrder
+	case cfg.InstallOrder != nil:
+		return cfg.InstallOrder.Reverse()
+	default:
+		return releaseutil.UninstallOrder
+	}
+}
+
+// externalDepsGenerator is the ExternalDepsGenerator of the deploy actions
+// created without one. The external dependencies are declared with the
+// annotations of the resources and their types are resolved with the
+// RESTMapper, which is only loaded if a resource declares a dependency.
+func (cfg *Configuration) externalDepsGenerator() phases.ExternalDepsGenerator {
+	mapper := meta.NewLazyRESTMapperLoader(func() (meta.RESTMapper, error) {
+		if cfg.RESTClientGetter == nil {
+			return nil, errors.New("unable to resolve the types of the external dependencies without a kubernetes configuration")
+		}
+		return cfg.RESTClientGetter.ToRESTMapper()
+	})
+
+	return phases.NewAnnotationsExternalDepsGenerator(externaldeps.NewRESTMapperGVKBuilder(mapper), mapper, "")
+}
+
 // KubernetesClientSet creates a new kubernetes ClientSet based on the configuration
 func (cfg *Configuration) KubernetesClientSet() (kubernetes.Interface, error) {
 	conf, err := cfg.RESTClientGetter.ToRESTConfig()
@@ -361,10 +498,50 @@ func GetVersionSet(client discovery.ServerResourcesInterface) (chartutil.Version
 // recordRelease with an update operation in case reuse has been set.
 func (cfg *Configuration) recordRelease(r *release.Release) {
 	if err := cfg.Releases.Update(r); err != nil {
-		cfg.Log("warning: Failed to update release %s: %s", r.Name, err)
+		cfg.warn("Failed to update release %s: %s", r.Name, err)
 	}
 }
 
+// releasesInNamespace returns the storage of the releases of the namespace,
+// with the driver and the configuration of cfg.Releases, which might list
+// the releases of all the namespaces. The memory driver is switched to the
+// namespace.
+func (cfg *Configuration) releasesInNamespace(namespace string) *storage.Storage {
+	newLazyClient := func() *lazyClient {
+		return &lazyClient{
+			namespace: namespace,
+			clientFn: func() (*kubernetes.Clientset, error) {
+				conf, err := cfg.RESTClientGetter.ToRESTConfig()
+				if err != nil {
+					return nil, errors.Wrap(err, "unable to generate config for kubernetes client")
+				}
+				return kubernetes.NewForConfig(conf)
+			},
+		}
+	}
+
+	switch d := cfg.Releases.Driver.(type) {
+	case *driver.Secrets:
+		scoped := driver.NewSecrets(newSecretClient(newLazyClient()))
+		scoped.Log, scoped.Compression, scoped.Encryption = d.Log, d.Compression, d.Encryption
+		return cfg.Releases.WithDriver(scoped)
+	case *driver.ChunkedSecrets:
+		scoped := driver.NewChunkedSecrets(newSecretClient(newLazyClient()))
+		scoped.Log, scoped.Compression, scoped.Encryption, scoped.ChunkSize = d.Log, d.Compression, d.Encryption, d.ChunkSize
+		return cfg.Releases.WithDriver(scoped)
+	case *driver.ConfigMaps:
+		scoped := driver.NewConfigMaps(newConfigMapClient(newLazyClient()))
+		scoped.Log, scoped.Compression, scoped.Encryption = d.Log, d.Compression, d.Encryption
+		return cfg.Releases.WithDriver(scoped)
+	case *driver.SQL:
+		return cfg.Releases.WithDriver(d.ForNamespace(namespace))
+	case *driver.Memory:
+		d.SetNamespace(namespace)
+	}
+
+	return cfg.Releases
+}
+
 // Init initializes the action configuration
 func (cfg *Configuration) Init(getter genericclioptions.RESTClientGetter, namespace, helmDriver string, log DebugLog) error {
 	kc := kube.New(getter)
@@ -375,15 +552,68 @@ func (cfg *Configuration) Init(getter genericclioptions.RESTClientGetter, namesp
 		clientFn:  kc.Factory.KubernetesClientSet,
 	}
 
+	if v, ok := os.LookupEnv("HELM_UPDATE_CONCURRENCY"); ok {
+		concurrency, err := strconv.Atoi(v)
+		if err != nil || concurrency < 0 {
+			return errors.Errorf("invalid HELM_UPDATE_CONCURRENCY %q: expected a non-negative integer", v)
+		}
+		kc.UpdateConcurrency = concurrency
+	}
+
+	applyStrategy, err := kube.ParseApplyStrategy(os.Getenv("HELM_APPLY_STRATEGY"))
+	if err != nil {
+		return errors.Wrap(err, "invalid HELM_APPLY_STRATEGY")
+	}
+	kc.ApplyStrategy = applyStrategy
+
+	readinessEngine, err := kube.ParseReadinessEngine(os.Getenv("HELM_READINESS_ENGINE"))
+	if err != nil {
+		return errors.Wrap(err, "invalid HELM_READINESS_ENGINE")
+	}
+	kc.ReadinessEngine = readinessEngine
+
+	if v, ok := os.LookupEnv("HELM_MAX_ERROR_SIZE"); ok {
+		maxErrorSize, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Errorf("invalid HELM_MAX_ERROR_SIZE %q: expected an integer", v)
+		}
+		kc.MaxErrorSize = maxErrorSize
+	}
+	kc.ErrorDumpDir = os.Getenv("HELM_ERROR_DUMP_DIR")
+
+	compression, err := driver.ParseCompression(os.Getenv("HELM_DRIVER_COMPRESSION"))
+	if err != nil {
+		return err
+	}
+
+	encryption, err := driver.LoadEncryption(driver.EncryptionKeySource{
+		Key:       os.Getenv("HELM_DRIVER_ENCRYPTION_KEY"),
+		File:      os.Getenv("HELM_DRIVER_ENCRYPTION_KEY_FILE"),
+		KMSPlugin: os.Getenv("HELM_DRIVER_ENCRYPTION_KMS_PLUGIN"),
+	})
+	if err != nil {
+		return err
+	}
+
 	var store *storage.Storage
 	switch helmDriver {
 	case "secret", "secrets", "":
 		d := driver.NewSecrets(newSecretClient(lazyClient))
 		d.Log = log
+		d.Compression = compression
+		d.Encryption = encryption
+		store = storage.Init(d)
+	case "chunked-secret", "chunked-secrets":
+		d := driver.NewChunkedSecrets(newSecretClient(lazyClient))
+		d.Log = log
+		d.Compression = compression
+		d.Encryption = encryption
 		store = storage.Init(d)
 	case "configmap", "configmaps":
 		d := driver.NewConfigMaps(newConfigMapClient(lazyClient))
 		d.Log = log
+		d.Compression = compression
+		d.Encryption = encryption
 		store = storage.Init(d)
 	case "memory":
 		var d *driver.Memory
@@ -401,14 +631,29 @@ func (cfg *Configuration) Init(getter genericclioptions.RESTClientGetter, namesp
 		d.SetNamespace(namespace)
 		store = storage.Init(d)
 	case "sql":
-		d, err := driver.NewSQL(
-			os.Getenv("HELM_DRIVER_SQL_CONNECTION_STRING"),
+		dialect := cfg.SQLDialect
+		if dialect == "" {
+			dialect = os.Getenv("HELM_DRIVER_SQL_DIALECT")
+		}
+		if dialect == "" {
+			dialect = driver.SQLDialectPostgreSQL
+		}
+		connectionString := cfg.SQLConnectionString
+		if connectionString == "" {
+			connectionString = os.Getenv("HELM_DRIVER_SQL_CONNECTION_STRING")
+		}
+
+		d, err := driver.NewSQLWithDialect(
+			dialect,
+			connectionString,
 			log,
 			namespace,
 		)
 		if err != nil {
 			panic(fmt.Sprintf("Unable to instantiate SQL driver: %v", err))
 		}
+		d.Compression = compression
+		d.Encryption = encryption
 		store = storage.Init(d)
 	default:
 		// Not sure what to do here.
@@ -418,13 +663,20 @@ func (cfg *Configuration) Init(getter genericclioptions.RESTClientGetter, namesp
 	cfg.RESTClientGetter = getter
 	cfg.KubeClient = kc
 	cfg.Releases = store
+	cfg.ReleasesInNamespace = func(namespace string) (*storage.Storage, error) {
+		other := &Configuration{}
+		if err := other.Init(getter, namespace, helmDriver, log); err != nil {
+			return nil, err
+		}
+		return other.Releases, nil
+	}
 	cfg.Log = log
 
 	return nil
 }
 
 func (cfg *Configuration) RenderResources(ch *chart.Chart, values chartutil.Values, releaseName, outputDir string, subNotes, useReleaseName, includeCrds bool, pr postrender.PostRenderer, interactWithRemote, enableDNS bool) ([]*release.Hook, *bytes.Buffer, string, error) {
-	return cfg.renderResources(ch, values, releaseName, outputDir, subNotes, useReleaseName, includeCrds, pr, interactWithRemote, enableDNS)
+	return cfg.renderResources(ch, values, releaseName, outputDir, subNotes, useReleaseName, includeCrds, pr, interactWithRemote, enableDNS, renderOptions{})
 }
 
 func (cfg *Configuration) GetCapabilities() (*chartutil.Capabilities, error) {
@@ -434,3 +686,26 @@ func (cfg *Configuration) GetCapabilities() (*chartutil.Capabilities, error) {
 func ErrMissingChart() error {
 	return errMissingChart
 }
+
+// verifyCronJobs verifies the Jobs of the CronJobs among the resources, if the
+// kube client supports it.
+func (cfg *Configuration) verifyCronJobs(resources kube.ResourceList) error {
+	verifier, ok := cfg.KubeClient.(kube.InterfaceVerifyCronJobs)
+	if !ok {
+		return nil
+	}
+
+	return verifier.VerifyCronJobs(resources)
+}
+
+// checkCRDStoredVersions checks that the updates of the CustomResourceDefinitions
+// among the resources keep their stored versions, migrating the stored objects
+// if migrate is true, if the kube client supports it.
+func (cfg *Configuration) checkCRDStoredVersions(resources kube.ResourceList, migrate bool) error {
+	checker, ok := cfg.KubeClient.(kube.InterfaceCRDStoredVersions)
+	if !ok {
+		return nil
+	}
+
+	return checker.CheckCRDStoredVersions(resources, migrate)
+}
@@ -20,16 +20,17 @@ import (
 	"io"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	fakeclientset "k8s.io/client-go/kubernetes/fake"
 
-	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/chart/charttest"
 	"github.com/werf/3p-helm/pkg/chartutil"
 	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
 	"github.com/werf/3p-helm/pkg/registry"
 	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
 	"github.com/werf/3p-helm/pkg/storage"
 	"github.com/werf/3p-helm/pkg/storage/driver"
-	"github.com/werf/3p-helm/pkg/time"
 )
 
 var verbose = flag.Bool("test.log", false, "enable test logging")
@@ -56,173 +57,27 @@ func actionConfigFixture(t *testing.T) *Configuration {
 	}
 }
 
-var manifestWithHook = `kind: ConfigMap
-metadata:
-  name: test-cm
-  annotations:
-    "helm.sh/hook": post-install,pre-delete,post-upgrade
-data:
-  name: value`
-
-var manifestWithTestHook = `kind: Pod
-  metadata:
-	name: finding-nemo,
-	annotations:
-	  "helm.sh/hook": test
-  spec:
-	containers:
-	- name: nemo-test
-	  image: fake-image
-	  cmd: fake-command
-  `
-
-var rbacManifests = `apiVersion: rbac.authorization.k8s.io/v1
-kind: Role
-metadata:
-  name: schedule-agents
-rules:
-- apiGroups: [""]
-  resources: ["pods", "pods/exec", "pods/log"]
-  verbs: ["*"]
-
----
-
-apiVersion: rbac.authorization.k8s.io/v1
-kind: RoleBinding
-metadata:
-  name: schedule-agents
-  namespace: {{ default .Release.Namespace}}
-roleRef:
-  apiGroup: rbac.authorization.k8s.io
-  kind: Role
-  name: schedule-agents
-subjects:
-- kind: ServiceAccount
-  name: schedule-agents
-  namespace: {{ .Release.Namespace }}
-`
-
-type chartOptions struct {
-	*chart.Chart
-}
-
-type chartOption func(*chartOptions)
-
-func buildChart(opts ...chartOption) *chart.Chart {
-	c := &chartOptions{
-		Chart: &chart.Chart{
-			// TODO: This should be more complete.
-			Metadata: &chart.Metadata{
-				APIVersion: "v1",
-				Name:       "hello",
-				Version:    "0.1.0",
-			},
-			// This adds a basic template and hooks.
-			Templates: []*chart.File{
-				{Name: "templates/hello", Data: []byte("hello: world")},
-				{Name: "templates/hooks", Data: []byte(manifestWithHook)},
-			},
-		},
-	}
-
-	for _, opt := range opts {
-		opt(c)
-	}
-
-	return c.Chart
-}
-
-func withName(name string) chartOption {
-	return func(opts *chartOptions) {
-		opts.Metadata.Name = name
-	}
-}
-
-func withSampleValues() chartOption {
-	values := map[string]interface{}{
-		"someKey": "someValue",
-		"nestedKey": map[string]interface{}{
-			"simpleKey": "simpleValue",
-			"anotherNestedKey": map[string]interface{}{
-				"yetAnotherNestedKey": map[string]interface{}{
-					"youReadyForAnotherNestedKey": "No",
-				},
-			},
-		},
-	}
-	return func(opts *chartOptions) {
-		opts.Values = values
-	}
-}
-
-func withValues(values map[string]interface{}) chartOption {
-	return func(opts *chartOptions) {
-		opts.Values = values
-	}
-}
-
-func withNotes(notes string) chartOption {
-	return func(opts *chartOptions) {
-		opts.Templates = append(opts.Templates, &chart.File{
-			Name: "templates/NOTES.txt",
-			Data: []byte(notes),
-		})
-	}
-}
-
-func withDependency(dependencyOpts ...chartOption) chartOption {
-	return func(opts *chartOptions) {
-		opts.AddDependency(buildChart(dependencyOpts...))
-	}
-}
-
-func withMetadataDependency(dependency chart.Dependency) chartOption {
-	return func(opts *chartOptions) {
-		opts.Metadata.Dependencies = append(opts.Metadata.Dependencies, &dependency)
-	}
-}
-
-func withSampleTemplates() chartOption {
-	return func(opts *chartOptions) {
-		sampleTemplates := []*chart.File{
-			// This adds basic templates and partials.
-			{Name: "templates/goodbye", Data: []byte("goodbye: world")},
-			{Name: "templates/empty", Data: []byte("")},
-			{Name: "templates/with-partials", Data: []byte(`hello: {{ template "_planet" . }}`)},
-			{Name: "templates/partials/_planet", Data: []byte(`{{define "_planet"}}Earth{{end}}`)},
-		}
-		opts.Templates = append(opts.Templates, sampleTemplates...)
-	}
-}
-
-func withSampleIncludingIncorrectTemplates() chartOption {
-	return func(opts *chartOptions) {
-		sampleTemplates := []*chart.File{
-			// This adds basic templates and partials.
-			{Name: "templates/goodbye", Data: []byte("goodbye: world")},
-			{Name: "templates/empty", Data: []byte("")},
-			{Name: "templates/incorrect", Data: []byte("{{ .Values.bad.doh }}")},
-			{Name: "templates/with-partials", Data: []byte(`hello: {{ template "_planet" . }}`)},
-			{Name: "templates/partials/_planet", Data: []byte(`{{define "_planet"}}Earth{{end}}`)},
-		}
-		opts.Templates = append(opts.Templates, sampleTemplates...)
-	}
-}
-
-func withMultipleManifestTemplate() chartOption {
-	return func(opts *chartOptions) {
-		sampleTemplates := []*chart.File{
-			{Name: "templates/rbac", Data: []byte(rbacManifests)},
-		}
-		opts.Templates = append(opts.Templates, sampleTemplates...)
-	}
-}
+const (
+	manifestWithHook     = charttest.ManifestWithHook
+	manifestWithTestHook = charttest.ManifestWithTestHook
+	rbacManifests        = charttest.RBACManifests
+)
 
-func withKube(version string) chartOption {
-	return func(opts *chartOptions) {
-		opts.Metadata.KubeVersion = version
-	}
-}
+type chartOption = charttest.Option
+
+var (
+	buildChart                            = charttest.Build
+	withName                              = charttest.WithName
+	withSampleValues                      = charttest.WithSampleValues
+	withValues                            = charttest.WithValues
+	withNotes                             = charttest.WithNotes
+	withDependency                        = charttest.WithDependency
+	withMetadataDependency                = charttest.WithMetadataDependency
+	withSampleTemplates                   = charttest.WithSampleTemplates
+	withSampleIncludingIncorrectTemplates = charttest.WithSampleIncludingIncorrectTemplates
+	withMultipleManifestTemplate          = charttest.WithMultipleManifestTemplate
+	withKube                              = charttest.WithKube
+)
 
 // releaseStub creates a release stub, complete with the chartStub as its chart.
 func releaseStub() *release.Release {
@@ -230,40 +85,7 @@ func releaseStub() *release.Release {
 }
 
 func namedReleaseStub(name string, status release.Status) *release.Release {
-	now := time.Now()
-	return &release.Release{
-		Name: name,
-		Info: &release.Info{
-			FirstDeployed: now,
-			LastDeployed:  now,
-			Status:        status,
-			Description:   "Named Release Stub",
-		},
-		Chart:   buildChart(withSampleTemplates()),
-		Config:  map[string]interface{}{"name": "value"},
-		Version: 1,
-		Hooks: []*release.Hook{
-			{
-				Name:     "test-cm",
-				Kind:     "ConfigMap",
-				Path:     "test-cm",
-				Manifest: manifestWithHook,
-				Events: []release.HookEvent{
-					release.HookPostInstall,
-					release.HookPreDelete,
-				},
-			},
-			{
-				Name:     "finding-nemo",
-				Kind:     "Pod",
-				Path:     "finding-nemo",
-				Manifest: manifestWithTestHook,
-				Events: []release.HookEvent{
-					release.HookTest,
-				},
-			},
-		},
-	}
+	return charttest.BuildRelease(name, charttest.WithStatus(status))
 }
 
 func TestGetVersionSet(t *testing.T) {
@@ -281,3 +103,16 @@ func TestGetVersionSet(t *testing.T) {
 		t.Error("Non-existent version is reported found.")
 	}
 }
+
+func TestConfigurationKindOrder(t *testing.T) {
+	cfg := &Configuration{}
+	assert.Equal(t, releaseutil.InstallOrder, cfg.installOrder())
+	assert.Equal(t, releaseutil.UninstallOrder, cfg.uninstallOrder())
+
+	cfg.InstallOrder = releaseutil.InstallOrder.InsertBefore("Issuer", "Secret")
+	assert.Equal(t, cfg.InstallOrder, cfg.installOrder())
+	assert.Equal(t, cfg.InstallOrder.Reverse(), cfg.uninstallOrder())
+
+	cfg.UninstallOrder = releaseutil.UninstallOrder
+	assert.Equal(t, releaseutil.UninstallOrder, cfg.uninstallOrder())
+}
@@ -0,0 +1,179 @@
+package action
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/chartutil"
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+)
+
+// Adopt is the action for turning resources that already exist in the cluster,
+// e.g. created by hand, into the first revision of a new release.
+//
+// The live objects are captured, stripped of the fields managed by the
+// cluster and stored as the manifest of the release. The objects get the
+// ownership metadata of the release, so that subsequent upgrades manage them
+// as if they were installed by the release.
+type Adopt struct {
+	cfg *Configuration
+
+	Namespace string
+	// Kinds of the resources looked up by LabelSelector, e.g. "deployments".
+	Kinds         []string
+	LabelSelector string
+	// Resources are adopted explicitly, regardless of the label selector. Each
+	// one is referenced as "<kind>/<name>", e.g. "configmap/backend".
+	Resources   []string
+	Description string
+	// DryRun returns the release that would be created without changing the
+	// cluster or the release storage.
+	DryRun bool
+}
+
+// NewAdopt creates a new Adopt object with the given configuration.
+func NewAdopt(cfg *Configuration) *Adopt {
+	return &Adopt{
+		cfg: cfg,
+	}
+}
+
+// Run captures the resources and creates the release with the given name.
+func (a *Adopt) Run(name string) (*release.Release, error) {
+	if err := a.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	if err := chartutil.ValidateReleaseName(name); err != nil {
+		return nil, errors.Errorf("release name is invalid: %s", name)
+	}
+
+	if len(a.Kinds) > 0 && a.LabelSelector == "" {
+		return nil, errors.New("a label selector is required to adopt resources by kind")
+	}
+	if len(a.Kinds) == 0 && len(a.Resources) == 0 {
+		return nil, errors.New("no resources to adopt: specify kinds with a label selector or resources by name")
+	}
+
+	if h, err := a.cfg.Releases.History(name); err == nil && len(h) > 0 {
+		return nil, errors.Errorf("release %q already exists, resources can only be adopted into a new release", name)
+	}
+
+	capturer, ok := a.cfg.KubeClient.(kube.InterfaceCapture)
+	if !ok {
+		return nil, errors.New("the kubernetes client does not support capturing resources")
+	}
+
+	a.cfg.Log("capturing resources to adopt into release %s", name)
+	captured, err := capturer.Capture(a.Kinds, a.LabelSelector, a.Resources)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to capture resources")
+	}
+	if len(captured) == 0 {
+		return nil, errors.New("no resources found to adopt")
+	}
+
+	for _, info := range captured {
+		ownerName, ownerNamespace := releaseutil.GetOwnerRelease(info.Object)
+		if ownerName != "" && (ownerName != name || ownerNamespace != a.Namespace) {
+			return nil, errors.Errorf("%s already belongs to release %q in namespace %q", releaseutil.ResourceString(info), ownerName, ownerNamespace)
+		}
+	}
+
+	target := copyResourceList(captured)
+	if err := target.Visit(releaseutil.SetMetadataVisitor(name, a.Namespace, true)); err != nil {
+		return nil, err
+	}
+
+	manifest, err := adoptedManifest(name, target)
+	if err != nil {
+		return nil, err
+	}
+
+	description := a.Description
+	if description == "" {
+		description = fmt.Sprintf("Adopted %d resource(s) from the cluster", len(target))
+	}
+
+	ts := a.cfg.Now()
+	rel := &release.Release{
+		Name:      name,
+		Namespace: a.Namespace,
+		Chart: &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion:  chart.APIVersionV2,
+				Name:        name,
+				Version:     "0.1.0",
+				Description: "Resources adopted from the cluster",
+			},
+		},
+		Config:   map[string]interface{}{},
+		Manifest: manifest,
+		Info: &release.Info{
+			FirstDeployed: ts,
+			LastDeployed:  ts,
+			Status:        release.StatusDeployed,
+			Description:   description,
+		},
+		Version: 1,
+	}
+
+	if a.DryRun {
+		return rel, nil
+	}
+
+	a.cfg.Log("setting ownership metadata of %d resource(s)", len(target))
+	if _, err := a.cfg.KubeClient.Update(captured, target, false, kube.UpdateOptions{}); err != nil {
+		return nil, errors.Wrap(err, "unable to set ownership metadata of the adopted resources")
+	}
+
+	if err := a.cfg.Releases.Create(rel); err != nil {
+		return nil, err
+	}
+
+	return rel, nil
+}
+
+// copyResourceList returns a copy of the resources with deep copies of their
+// objects.
+func copyResourceList(resources kube.ResourceList) kube.ResourceList {
+	result := make(kube.ResourceList, 0, len(resources))
+	for _, info := range resources {
+		infoCopy := *info
+		infoCopy.Object = info.Object.DeepCopyObject()
+		result = append(result, &infoCopy)
+	}
+
+	return result
+}
+
+// adoptedManifest renders the resources as a release manifest with a source
+// comment per resource, as if they were rendered from the templates of a chart.
+func adoptedManifest(chartName string, resources kube.ResourceList) (string, error) {
+	var b strings.Builder
+
+	err := resources.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		data, err := yaml.Marshal(info.Object)
+		if err != nil {
+			return errors.Wrapf(err, "unable to marshal %s", releaseutil.ResourceString(info))
+		}
+
+		kind := strings.ToLower(info.Mapping.GroupVersionKind.Kind)
+		fmt.Fprintf(&b, "---\n# Source: %s/templates/%s-%s.yaml\n%s", chartName, kind, info.Name, data)
+
+		return nil
+	})
+
+	return b.String(), err
+}
@@ -0,0 +1,138 @@
+package action
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+type capturingKubeClient struct {
+	kubefake.PrintingKubeClient
+	captured kube.ResourceList
+	updated  kube.ResourceList
+}
+
+func (c *capturingKubeClient) Capture(_ []string, _ string, _ []string) (kube.ResourceList, error) {
+	return c.captured, nil
+}
+
+func (c *capturingKubeClient) Update(original, target kube.ResourceList, force bool, opts kube.UpdateOptions) (*kube.Result, error) {
+	c.updated = target
+	return c.PrintingKubeClient.Update(original, target, force, opts)
+}
+
+func capturedConfigMap(name string, annotations map[string]string) *resource.Info {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetName(name)
+	obj.SetNamespace("spaced")
+	obj.SetAnnotations(annotations)
+
+	return &resource.Info{
+		Name:      name,
+		Namespace: "spaced",
+		Object:    obj,
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+			Scope:            meta.RESTScopeNamespace,
+		},
+	}
+}
+
+func adoptAction(t *testing.T, captured ...*resource.Info) (*Adopt, *capturingKubeClient) {
+	config := actionConfigFixture(t)
+	kubeClient := &capturingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}, captured: captured}
+	config.KubeClient = kubeClient
+
+	adopt := NewAdopt(config)
+	adopt.Namespace = "spaced"
+	adopt.Resources = []string{"configmap/backend"}
+
+	return adopt, kubeClient
+}
+
+func TestAdopt(t *testing.T) {
+	is := assert.New(t)
+	adopt, kubeClient := adoptAction(t, capturedConfigMap("backend", nil))
+
+	rel, err := adopt.Run("backend")
+	is.NoError(err)
+
+	is.Equal(1, rel.Version)
+	is.Equal(release.StatusDeployed, rel.Info.Status)
+	is.Contains(rel.Manifest, "# Source: backend/templates/configmap-backend.yaml")
+	is.Contains(rel.Manifest, "meta.helm.sh/release-name: backend")
+	is.Contains(rel.Manifest, "app.kubernetes.io/managed-by: Helm")
+
+	stored, err := adopt.cfg.Releases.Get("backend", 1)
+	is.NoError(err)
+	is.Equal(rel.Manifest, stored.Manifest)
+
+	is.Len(kubeClient.updated, 1)
+	is.Equal("spaced", kubeClient.updated[0].Object.(*unstructured.Unstructured).GetAnnotations()["meta.helm.sh/release-namespace"])
+	is.Empty(kubeClient.captured[0].Object.(*unstructured.Unstructured).GetAnnotations(), "captured objects should be left unchanged")
+}
+
+func TestAdoptDryRun(t *testing.T) {
+	is := assert.New(t)
+	adopt, kubeClient := adoptAction(t, capturedConfigMap("backend", nil))
+	adopt.DryRun = true
+
+	rel, err := adopt.Run("backend")
+	is.NoError(err)
+	is.NotEmpty(rel.Manifest)
+
+	is.Nil(kubeClient.updated)
+	_, err = adopt.cfg.Releases.Get("backend", 1)
+	is.Error(err)
+}
+
+func TestAdoptOwnedByAnotherRelease(t *testing.T) {
+	adopt, _ := adoptAction(t, capturedConfigMap("backend", map[string]string{
+		"meta.helm.sh/release-name":      "frontend",
+		"meta.helm.sh/release-namespace": "spaced",
+	}))
+
+	_, err := adopt.Run("backend")
+	if err == nil || !strings.Contains(err.Error(), `already belongs to release "frontend"`) {
+		t.Fatalf("expected an ownership error, got %v", err)
+	}
+}
+
+func TestAdoptExistingRelease(t *testing.T) {
+	adopt, _ := adoptAction(t, capturedConfigMap("backend", nil))
+
+	rel := releaseStub()
+	rel.Name = "backend"
+	if err := adopt.cfg.Releases.Create(rel); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := adopt.Run("backend")
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected an error about the existing release, got %v", err)
+	}
+}
+
+func TestAdoptKindsWithoutSelector(t *testing.T) {
+	adopt, _ := adoptAction(t)
+	adopt.Resources = nil
+	adopt.Kinds = []string{"deployments"}
+
+	_, err := adopt.Run("backend")
+	if err == nil || !strings.Contains(err.Error(), "label selector is required") {
+		t.Fatalf("expected an error about the missing label selector, got %v", err)
+	}
+}
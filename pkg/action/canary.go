@@ -0,0 +1,30 @@
+package action
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+// verifyCanaries waits for the canaries applied by a canary step stage to
+// become ready, even if waiting is disabled, and runs the canary-verify hooks
+// of the release against them, unless the hooks are disabled. The rollout
+// goes on to the next step only if the canaries are verified.
+func (cfg *Configuration) verifyCanaries(rl *release.Release, stage *stages.Stage, runHooks bool, timeout, hooksTimeout time.Duration, concurrency, maxFailures int) error {
+	if err := cfg.KubeClient.Wait(stage.DesiredResources, timeout); err != nil {
+		return messages.Errorf(messages.ExecutorWaitForCanaries, stage.CanaryStep, err)
+	}
+
+	if !runHooks {
+		return nil
+	}
+
+	if err := cfg.execHookOfStep(rl, release.HookCanaryVerify, stage.CanaryStep, timeout, hooksTimeout, concurrency, maxFailures); err != nil {
+		return fmt.Errorf("canary verification of step %d failed: %w", stage.CanaryStep, err)
+	}
+
+	return nil
+}
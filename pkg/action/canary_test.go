@@ -0,0 +1,65 @@
+package action
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestVerifyCanaries(t *testing.T) {
+	is := assert.New(t)
+
+	stage := &stages.Stage{CanaryStep: 2, DesiredResources: kube.ResourceList{&resource.Info{Name: "app-canary"}}}
+	rel := namedReleaseStub("app", release.StatusPendingUpgrade)
+
+	cfg := actionConfigFixture(t)
+	cfg.KubeClient = &kubefake.PrintingKubeClient{Out: io.Discard}
+	is.NoError(cfg.verifyCanaries(rel, stage, false, time.Minute, 0, 1, 0))
+
+	cfg.KubeClient = &kubefake.FailingKubeClient{
+		PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+		WaitError:          errors.New("deadline exceeded"),
+	}
+	is.ErrorContains(cfg.verifyCanaries(rel, stage, true, time.Minute, 0, 1, 0), "error waiting for canaries of step 2 to become ready: deadline exceeded")
+}
+
+func TestVerifyCanariesRunsHooksOfEveryStep(t *testing.T) {
+	is := assert.New(t)
+
+	kubeClient := &hookRecordingKubeClient{
+		PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+		finishedBefore:     map[string][]string{},
+	}
+	cfg := actionConfigFixture(t)
+	cfg.KubeClient = kubeClient
+
+	rel := namedReleaseStub("app", release.StatusPendingUpgrade)
+	rel.Hooks = []*release.Hook{{
+		Name:     "verify",
+		Kind:     "ConfigMap",
+		Path:     "templates/verify",
+		Manifest: "verify",
+		Events:   []release.HookEvent{release.HookCanaryVerify},
+	}}
+	is.NoError(cfg.Releases.Create(rel))
+
+	for _, step := range []int{1, 2} {
+		stage := &stages.Stage{CanaryStep: step, DesiredResources: kube.ResourceList{&resource.Info{Name: "app-canary"}}}
+		is.NoError(cfg.verifyCanaries(rel, stage, true, time.Minute, 0, 1, 0))
+	}
+	is.Equal([]string{"verify", "verify"}, kubeClient.finished)
+
+	// A retried step is not verified again.
+	stage := &stages.Stage{CanaryStep: 2, DesiredResources: kube.ResourceList{&resource.Info{Name: "app-canary"}}}
+	is.NoError(cfg.verifyCanaries(rel, stage, true, time.Minute, 0, 1, 0))
+	is.Equal([]string{"verify", "verify"}, kubeClient.finished)
+}
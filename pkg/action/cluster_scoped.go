@@ -0,0 +1,52 @@
+package action
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+)
+
+// withControlNamespace returns a copy of the configuration storing the release records in the control
+// namespace of a cluster-scoped release.
+func (cfg *Configuration) withControlNamespace(namespace string) *Configuration {
+	c := *cfg
+	c.Releases = cfg.releasesInNamespace(namespace)
+
+	return &c
+}
+
+// validateClusterScoped makes sure that a release deployed in the cluster-scoped mode has no namespaced
+// resources, neither among the regular resources nor among the hooks. In this mode the release namespace
+// is only used as a control namespace for storing the release records.
+func validateClusterScoped(kubeClient kube.Interface, resources kube.ResourceList, hooks []*release.Hook) error {
+	var namespaced []string
+	for _, res := range resources {
+		if res.Namespaced() {
+			namespaced = append(namespaced, releaseutil.ResourceString(res))
+		}
+	}
+
+	for _, h := range hooks {
+		hookResources, err := kubeClient.Build(bytes.NewBufferString(h.Manifest), false)
+		if err != nil {
+			return fmt.Errorf("unable to build kubernetes objects for hook %s: %w", h.Path, err)
+		}
+
+		for _, res := range hookResources {
+			if res.Namespaced() {
+				namespaced = append(namespaced, fmt.Sprintf("%s (hook %s)", releaseutil.ResourceString(res), h.Path))
+			}
+		}
+	}
+
+	if len(namespaced) > 0 {
+		return messages.Errorf(messages.ValidationClusterScoped, len(namespaced), strings.Join(namespaced, ", "))
+	}
+
+	return nil
+}
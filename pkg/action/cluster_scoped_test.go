@@ -0,0 +1,144 @@
+package action
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/kube"
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+	"github.com/werf/3p-helm/pkg/werf/secrets"
+)
+
+// clusterScopedKubeClient builds the ClusterRoles and the Namespaces as
+// cluster-scoped resources.
+type clusterScopedKubeClient struct {
+	logsStreamingKubeClient
+}
+
+func (c *clusterScopedKubeClient) Build(r io.Reader, validate bool) (kube.ResourceList, error) {
+	resources, err := c.logsStreamingKubeClient.Build(r, validate)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, res := range resources {
+		switch res.Mapping.GroupVersionKind.Kind {
+		case "ClusterRole", "Namespace":
+			res.Mapping.Scope = meta.RESTScopeRoot
+		}
+	}
+
+	return resources, nil
+}
+
+func (c *clusterScopedKubeClient) WithLogsOptions(opts kube.LogsOptions) kube.Interface {
+	client := *c
+	client.opts = opts
+	return &client
+}
+
+func newClusterScopedKubeClient() *clusterScopedKubeClient {
+	return &clusterScopedKubeClient{logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}}
+}
+
+const clusterRoleManifest = "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: reader\n"
+
+func TestValidateClusterScoped(t *testing.T) {
+	kubeClient := newClusterScopedKubeClient()
+	build := func(manifests ...string) kube.ResourceList {
+		resources, err := kubeClient.Build(strings.NewReader(strings.Join(manifests, "---\n")), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resources
+	}
+	namespaceManifest := "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: team\n"
+
+	for _, tt := range []struct {
+		name      string
+		resources kube.ResourceList
+		hooks     []*release.Hook
+		expectErr string
+	}{
+		{
+			name: "no resources",
+		},
+		{
+			name:      "cluster-scoped resources",
+			resources: build(clusterRoleManifest, namespaceManifest),
+			hooks:     []*release.Hook{{Path: "templates/hook.yaml", Manifest: namespaceManifest}},
+		},
+		{
+			name:      "namespaced resource",
+			resources: build(clusterRoleManifest, configMapManifest("app")),
+			expectErr: "1 namespaced resource(s): ConfigMap \"app\" in namespace \"spaced\"",
+		},
+		{
+			name:      "namespaced hook",
+			resources: build(clusterRoleManifest),
+			hooks:     []*release.Hook{{Path: "templates/hook.yaml", Manifest: configMapManifest("migrate")}},
+			expectErr: "1 namespaced resource(s): ConfigMap \"migrate\" in namespace \"spaced\" (hook templates/hook.yaml)",
+		},
+		{
+			name:      "namespaced resource and hook",
+			resources: build(configMapManifest("app")),
+			hooks:     []*release.Hook{{Path: "templates/hook.yaml", Manifest: configMapManifest("migrate")}},
+			expectErr: "2 namespaced resource(s)",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateClusterScoped(kubeClient, tt.resources, tt.hooks)
+			if tt.expectErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestClusterScopedControlNamespace(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	newChart := func() *chart.Chart {
+		ch := buildChart()
+		ch.Templates = []*chart.File{{Name: "templates/clusterrole", Data: []byte(clusterRoleManifest)}}
+		ch.SecretsRuntimeData = secrets.NewSecretsRuntimeData()
+		return ch
+	}
+
+	instAction := installAction(t)
+	instAction.cfg.KubeClient = newClusterScopedKubeClient()
+	instAction.ClusterScoped = true
+	instAction.ControlNamespace = "helm-control"
+	rel, err := instAction.Run(newChart(), map[string]interface{}{})
+	req.NoError(err)
+	is.Equal("helm-control", rel.Namespace)
+	is.Equal("spaced", instAction.Namespace, "the namespace of the install is restored")
+
+	upAction := upgradeAction(t)
+	upAction.cfg = instAction.cfg
+	upAction.ClusterScoped = true
+	upAction.ControlNamespace = "helm-control"
+	rel, err = upAction.Run(instAction.ReleaseName, newChart(), map[string]interface{}{})
+	req.NoError(err)
+	is.Equal("helm-control", rel.Namespace)
+	is.Equal(2, rel.Version)
+
+	mem := instAction.cfg.Releases.Driver.(*driver.Memory)
+	mem.SetNamespace("helm-control")
+	_, err = instAction.cfg.Releases.Get(instAction.ReleaseName, 2)
+	is.NoError(err, "the release is stored in the control namespace")
+	mem.SetNamespace("spaced")
+	_, err = instAction.cfg.Releases.Get(instAction.ReleaseName, 1)
+	is.Error(err, "the release is not stored in the namespace of the install")
+}
@@ -0,0 +1,115 @@
+package action
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases/phasemanagers"
+)
+
+// DeployResult is the result of an install, upgrade or rollback, for the
+// command wrappers to map to distinct process exit codes.
+type DeployResult string
+
+const (
+	// DeployResultSucceeded is a deploy which succeeded.
+	DeployResultSucceeded DeployResult = "succeeded"
+	// DeployResultSucceededWithWarnings is a deploy which succeeded, but
+	// logged warnings, e.g. about external dependencies which were not ready
+	// or orphaned resources which were kept.
+	DeployResultSucceededWithWarnings DeployResult = "succeeded-with-warnings"
+	// DeployResultFailedRender is a deploy which failed rendering the chart.
+	DeployResultFailedRender DeployResult = "failed-render"
+	// DeployResultFailedValidation is a deploy which failed before changing
+	// the cluster, as the options, the release or its resources are invalid.
+	DeployResultFailedValidation DeployResult = "failed-validation"
+	// DeployResultFailedApply is a deploy which failed applying the resources.
+	DeployResultFailedApply DeployResult = "failed-apply"
+	// DeployResultFailedTracking is a deploy which failed waiting for the
+	// resources or the external dependencies to be ready.
+	DeployResultFailedTracking DeployResult = "failed-tracking"
+	// DeployResultRolledBack is a deploy which failed and was rolled back, or
+	// uninstalled if it was an install, as Atomic was set.
+	DeployResultRolledBack DeployResult = "rolled-back"
+	// DeployResultFailed is a deploy which failed for any other reason, e.g.
+	// the cluster was unreachable or a hook failed.
+	DeployResultFailed DeployResult = "failed"
+)
+
+// DeployError is an error of a deploy with its result.
+type DeployError struct {
+	Result DeployResult
+	Err    error
+}
+
+func (e *DeployError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeployError) Unwrap() error {
+	return e.Err
+}
+
+// newDeployError returns err with the result, or nil if err is nil. The
+// result of the outermost DeployError of an error is the result of the deploy.
+func newDeployError(result DeployResult, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &DeployError{Result: result, Err: err}
+}
+
+// DeployResultOf returns the result of a deploy which returned err:
+// DeployResultSucceeded if err is nil and DeployResultFailed if the failure
+// is not classified. The warnings of a deploy are only known to the action,
+// see Install.Result.
+func DeployResultOf(err error) DeployResult {
+	if err == nil {
+		return DeployResultSucceeded
+	}
+
+	var deployErr *DeployError
+	var applyErr *phasemanagers.ApplyError
+	var trackErr *phasemanagers.TrackError
+	switch {
+	case errors.As(err, &deployErr):
+		return deployErr.Result
+	case errors.As(err, &applyErr):
+		return DeployResultFailedApply
+	case errors.As(err, &trackErr):
+		return DeployResultFailedTracking
+	default:
+		return DeployResultFailed
+	}
+}
+
+// newDeployResult returns the result of a deploy which returned err and
+// logged the warnings.
+func newDeployResult(err error, warnings int32) DeployResult {
+	if err == nil && warnings > 0 {
+		return DeployResultSucceededWithWarnings
+	}
+
+	return DeployResultOf(err)
+}
+
+// withWarningsCounter returns a copy of the configuration counting the
+// warnings logged with warn.
+func (cfg *Configuration) withWarningsCounter(warnings *int32) *Configuration {
+	c := *cfg
+	c.warnings = warnings
+
+	return &c
+}
+
+// warn logs a warning with messages.WarningPrefix, counted by the warnings
+// counter of the configuration, see withWarningsCounter.
+func (cfg *Configuration) warn(format string, v ...interface{}) {
+	if cfg.warnings != nil {
+		atomic.AddInt32(cfg.warnings, 1)
+	}
+	cfg.Log(messages.WarningPrefix+format, v...)
+}
@@ -0,0 +1,61 @@
+package action
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases/phasemanagers"
+)
+
+func TestDeployResultOf(t *testing.T) {
+	is := assert.New(t)
+
+	applyErr := &phasemanagers.ApplyError{StageIndex: 1, Err: errors.New("conflict")}
+	trackErr := &phasemanagers.TrackError{StageIndex: 1, Err: errors.New("timed out")}
+
+	is.Equal(DeployResultSucceeded, DeployResultOf(nil))
+	is.Equal(DeployResultFailed, DeployResultOf(errors.New("cluster unreachable")))
+	is.Equal(DeployResultFailedRender, DeployResultOf(newDeployError(DeployResultFailedRender, errors.New("parse error"))))
+	is.Equal(DeployResultFailedApply, DeployResultOf(errors.Wrap(applyErr, "upgrade failed")))
+	is.Equal(DeployResultFailedTracking, DeployResultOf(fmt.Errorf("upgrade failed: %w", trackErr)))
+	is.Equal(DeployResultRolledBack, DeployResultOf(newDeployError(DeployResultRolledBack, errors.Wrap(trackErr, "release failed, and has been rolled back"))))
+	is.Nil(newDeployError(DeployResultFailedValidation, nil))
+
+	is.Equal(DeployResultSucceeded, newDeployResult(nil, 0))
+	is.Equal(DeployResultSucceededWithWarnings, newDeployResult(nil, 2))
+	is.Equal(DeployResultFailedApply, newDeployResult(applyErr, 2))
+}
+
+func TestWithWarningsCounter(t *testing.T) {
+	is := assert.New(t)
+
+	var logged []string
+	cfg := &Configuration{Log: func(format string, v ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, v...))
+	}}
+
+	var warnings int32
+	counting := cfg.withWarningsCounter(&warnings)
+	counting.Log("applying %d resources", 3)
+	counting.warn("external dependency %q is not ready", "db")
+
+	// The warnings are counted whatever their translation.
+	messages.SetLocalizer(messages.MapLocalizer{messages.ExecutorUnsupportedResourceNotTracked: "Bereitschaft von %s nicht verfolgbar"})
+	defer messages.SetLocalizer(nil)
+	counting.warn(messages.Format(messages.ExecutorUnsupportedResourceNotTracked), "Deployment/app")
+
+	// The warnings outside of the deploy are not counted.
+	cfg.warn("unable to watch events")
+
+	is.Equal(int32(2), warnings)
+	is.Equal([]string{
+		"applying 3 resources",
+		`warning: external dependency "db" is not ready`,
+		"warning: Bereitschaft von Deployment/app nicht verfolgbar",
+		"warning: unable to watch events",
+	}, logged)
+}
@@ -0,0 +1,37 @@
+package action
+
+import (
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+)
+
+// startEventsWatcher starts collecting the Warning events of the planned
+// resources and external dependencies and of the objects they create. Every
+// namespace of the plan is watched, along with the release namespace. Returns
+// nil if the watcher can not be started, the deploy goes on without it.
+func (cfg *Configuration) startEventsWatcher(releaseNamespace string, sortedStages stages.SortedStageList) *kube.EventsWatcher {
+	clientSet, err := cfg.KubernetesClientSet()
+	if err != nil {
+		cfg.warn("unable to watch events: %s", err)
+		return nil
+	}
+
+	// Resources excluded from tracking do not fail the deploy, neither do
+	// their events.
+	desired, err := kube.TrackedResources(sortedStages.MergedDesiredResources())
+	if err != nil {
+		cfg.warn("unable to watch events: %s", err)
+		return nil
+	}
+
+	watcher := kube.NewEventsWatcher(clientSet, sortedStages.Namespaces(releaseNamespace), cfg.Log)
+	watcher.AddResources(desired)
+	watcher.AddResources(sortedStages.MergedExternalDependencies())
+
+	if err := watcher.Start(); err != nil {
+		cfg.warn("unable to watch events: %s", err)
+		return nil
+	}
+
+	return watcher
+}
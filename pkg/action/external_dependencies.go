@@ -0,0 +1,112 @@
+package action
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/phases/stages/externaldeps"
+)
+
+// waitForExternalDependencies waits for the external dependencies of a stage to
+// become ready. A dependency on the resources matching a label selector is
+// ready once enough of them are, and a dependency with a condition once the
+// resource has it. The dependencies with their own timeout, timeout policy or
+// condition are waited for one by one, the others together up to the given
+// timeout.
+func (cfg *Configuration) waitForExternalDependencies(deps externaldeps.ExternalDependencyList, waitForJobs bool, timeout time.Duration) error {
+	var shared kube.ResourceList
+	var own externaldeps.ExternalDependencyList
+	for _, dep := range deps {
+		if dep.IsSelector() || dep.HasOwnTimeout() || dep.Condition != nil {
+			own = append(own, dep)
+		} else {
+			shared = append(shared, dep.Info)
+		}
+	}
+
+	if len(shared) > 0 {
+		if err := cfg.waitForResources(shared, waitForJobs, timeout); err != nil {
+			return err
+		}
+	}
+
+	for _, dep := range own {
+		depTimeout := timeout
+		if dep.Timeout > 0 {
+			depTimeout = dep.Timeout
+		}
+
+		err := cfg.waitForExternalDependency(dep, waitForJobs, depTimeout)
+		if err == nil {
+			continue
+		}
+		// The wait of a cancelled deploy is interrupted too, but the
+		// dependency didn't time out.
+		if !wait.Interrupted(err) || cfg.baseContext().Err() != nil {
+			return messages.Errorf(messages.ExecutorWaitForExternalDependency, dep.Name, err)
+		}
+
+		switch dep.OnTimeout {
+		case externaldeps.TimeoutPolicyWarn:
+			cfg.warn(messages.Format(messages.ExecutorExternalDependencyGoingOn), dep.Name, depTimeout, err)
+		case externaldeps.TimeoutPolicySkip:
+			cfg.Log(messages.Format(messages.ExecutorExternalDependencySkipped), dep.Name, depTimeout)
+		default:
+			return messages.Errorf(messages.ExecutorExternalDependencyNotReady, dep.Name, depTimeout, err)
+		}
+	}
+
+	return nil
+}
+
+func (cfg *Configuration) waitForExternalDependency(dep *externaldeps.ExternalDependency, waitForJobs bool, timeout time.Duration) error {
+	if dep.Condition != nil {
+		return cfg.waitForCondition(kube.ResourceList{dep.Info}, dep.Condition, timeout)
+	}
+
+	if !dep.IsSelector() {
+		return cfg.waitForResources(kube.ResourceList{dep.Info}, waitForJobs, timeout)
+	}
+
+	kubeClient, ok := cfg.KubeClient.(kube.InterfaceWaitSelected)
+	if !ok {
+		return errors.New("the kube client does not support waiting for resources matching a label selector")
+	}
+
+	return kubeClient.WaitForSelected(dep.Info, dep.Selector, dep.MinReady, waitForJobs, timeout)
+}
+
+// waitForConditionDependencies waits for the resources of the release the
+// stage depends on to have their conditions.
+func (cfg *Configuration) waitForConditionDependencies(deps []*stages.ConditionDependency, timeout time.Duration) error {
+	for _, dep := range deps {
+		if err := cfg.waitForCondition(kube.ResourceList{dep.Resource}, dep.Condition, timeout); err != nil {
+			return fmt.Errorf("error waiting for %q to have condition %s: %w", kube.ResourceNameNamespaceKind(dep.Resource), dep.Condition, err)
+		}
+	}
+
+	return nil
+}
+
+func (cfg *Configuration) waitForCondition(resources kube.ResourceList, cond *kube.ResourceCondition, timeout time.Duration) error {
+	kubeClient, ok := cfg.KubeClient.(kube.InterfaceWaitCondition)
+	if !ok {
+		return errors.New("the kube client does not support waiting for resource conditions")
+	}
+
+	return kubeClient.WaitForCondition(resources, cond, timeout)
+}
+
+func (cfg *Configuration) waitForResources(resources kube.ResourceList, waitForJobs bool, timeout time.Duration) error {
+	if waitForJobs {
+		return cfg.KubeClient.WaitWithJobs(resources, timeout)
+	}
+
+	return cfg.KubeClient.Wait(resources, timeout)
+}
@@ -0,0 +1,170 @@
+package action
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/phases/stages/externaldeps"
+)
+
+type selectorWaitingKubeClient struct {
+	kubefake.PrintingKubeClient
+
+	// slow are the resources which are never ready.
+	slow     map[string]bool
+	waited   kube.ResourceList
+	timeouts []time.Duration
+	selected []string
+	// conditions are the awaited conditions by resource name.
+	conditions map[string]string
+}
+
+func (c *selectorWaitingKubeClient) Wait(resources kube.ResourceList, timeout time.Duration) error {
+	c.waited = append(c.waited, resources...)
+	c.timeouts = append(c.timeouts, timeout)
+	for _, res := range resources {
+		if c.slow[res.Name] {
+			return context.DeadlineExceeded
+		}
+	}
+	return nil
+}
+
+func (c *selectorWaitingKubeClient) WaitForSelected(_ *resource.Info, selector string, minReady int, _ bool, _ time.Duration) error {
+	c.selected = append(c.selected, selector)
+	return nil
+}
+
+func (c *selectorWaitingKubeClient) WaitForCondition(resources kube.ResourceList, cond *kube.ResourceCondition, _ time.Duration) error {
+	if c.conditions == nil {
+		c.conditions = map[string]string{}
+	}
+	for _, res := range resources {
+		c.conditions[res.Name] = cond.String()
+	}
+	return nil
+}
+
+func TestWaitForExternalDependencies(t *testing.T) {
+	is := assert.New(t)
+
+	named := externaldeps.NewExternalDependency("db", "statefulset", "postgres")
+	named.Info = &resource.Info{Name: "postgres"}
+	pool := externaldeps.NewSelectorExternalDependency("workers", "deployment", "pool=workers", 3)
+	pool.Info = &resource.Info{}
+	deps := externaldeps.ExternalDependencyList{named, pool}
+
+	kubeClient := &selectorWaitingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+	cfg := actionConfigFixture(t)
+	cfg.KubeClient = kubeClient
+
+	is.NoError(cfg.waitForExternalDependencies(deps, false, time.Minute))
+	is.Equal(kube.ResourceList{named.Info}, kubeClient.waited)
+	is.Equal([]string{"pool=workers"}, kubeClient.selected)
+
+	cfg.KubeClient = &kubefake.PrintingKubeClient{Out: io.Discard}
+	is.NoError(cfg.waitForExternalDependencies(externaldeps.ExternalDependencyList{named}, false, time.Minute))
+	is.ErrorContains(cfg.waitForExternalDependencies(deps, false, time.Minute), `external dependency "workers"`)
+}
+
+func TestWaitForExternalDependenciesTimeout(t *testing.T) {
+	is := assert.New(t)
+
+	newDep := func(name string, timeout time.Duration, onTimeout externaldeps.TimeoutPolicy) *externaldeps.ExternalDependency {
+		dep := externaldeps.NewExternalDependency(name, "deployment", name)
+		dep.Info = &resource.Info{Name: name}
+		dep.Timeout = timeout
+		dep.OnTimeout = onTimeout
+		return dep
+	}
+
+	for _, test := range []struct {
+		policy externaldeps.TimeoutPolicy
+		err    bool
+	}{
+		{externaldeps.TimeoutPolicyFail, true},
+		{externaldeps.TimeoutPolicyWarn, false},
+		{externaldeps.TimeoutPolicySkip, false},
+	} {
+		kubeClient := &selectorWaitingKubeClient{
+			PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+			slow:               map[string]bool{"cache": true},
+		}
+		cfg := actionConfigFixture(t)
+		cfg.KubeClient = kubeClient
+
+		err := cfg.waitForExternalDependencies(externaldeps.ExternalDependencyList{
+			newDep("db", 0, ""),
+			newDep("queue", 0, externaldeps.TimeoutPolicyFail),
+			newDep("cache", 10*time.Second, test.policy),
+		}, false, time.Minute)
+		if test.err {
+			is.ErrorContains(err, `external dependency "cache" is not ready after 10s`, test.policy)
+		} else {
+			is.NoError(err, test.policy)
+		}
+
+		// The dependencies without their own timeout are waited for together.
+		is.Equal([]time.Duration{time.Minute, 10 * time.Second}, kubeClient.timeouts, test.policy)
+	}
+}
+
+func TestWaitForExternalDependenciesCancelled(t *testing.T) {
+	is := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, policy := range []externaldeps.TimeoutPolicy{externaldeps.TimeoutPolicyWarn, externaldeps.TimeoutPolicySkip} {
+		dep := externaldeps.NewExternalDependency("cache", "deployment", "cache")
+		dep.Info = &resource.Info{Name: "cache"}
+		dep.Timeout = 10 * time.Second
+		dep.OnTimeout = policy
+
+		cfg := actionConfigFixture(t).withContext(ctx)
+		cfg.KubeClient = &selectorWaitingKubeClient{
+			PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+			slow:               map[string]bool{"cache": true},
+		}
+
+		is.ErrorContains(cfg.waitForExternalDependencies(externaldeps.ExternalDependencyList{dep}, false, time.Minute), `error waiting for external dependency "cache"`, policy)
+	}
+}
+
+func TestWaitForConditions(t *testing.T) {
+	is := assert.New(t)
+
+	cond, err := kube.ParseResourceCondition("Synced=True")
+	is.NoError(err)
+
+	named := externaldeps.NewExternalDependency("db", "statefulset", "postgres")
+	named.Info = &resource.Info{Name: "postgres"}
+	synced := externaldeps.NewExternalDependency("bucket", "bucket", "assets")
+	synced.Info = &resource.Info{Name: "assets"}
+	synced.Condition = cond
+
+	kubeClient := &selectorWaitingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+	cfg := actionConfigFixture(t)
+	cfg.KubeClient = kubeClient
+
+	is.NoError(cfg.waitForExternalDependencies(externaldeps.ExternalDependencyList{named, synced}, false, time.Minute))
+	is.Equal(kube.ResourceList{named.Info}, kubeClient.waited)
+
+	ready, err := kube.ParseResourceCondition("Ready=True")
+	is.NoError(err)
+	is.NoError(cfg.waitForConditionDependencies([]*stages.ConditionDependency{
+		{Resource: &resource.Info{Name: "cluster"}, Condition: ready},
+	}, time.Minute))
+	is.Equal(map[string]string{"assets": "Synced=True", "cluster": "Ready=True"}, kubeClient.conditions)
+
+	cfg.KubeClient = &kubefake.PrintingKubeClient{Out: io.Discard}
+	is.ErrorContains(cfg.waitForExternalDependencies(externaldeps.ExternalDependencyList{synced}, false, time.Minute), "does not support waiting for resource conditions")
+}
@@ -32,6 +32,8 @@ import (
 type History struct {
 	cfg *Configuration
 
+	// Max limits the history to the given number of the most recent revisions,
+	// if it is positive.
 	Max     int
 	Version int
 }
@@ -54,5 +56,8 @@ func (h *History) Run(name string) ([]*release.Release, error) {
 	}
 
 	h.cfg.Log("getting history for release %s", name)
+	if h.Max > 0 {
+		return h.cfg.Releases.HistoryPage(name, 0, h.Max)
+	}
 	return h.cfg.Releases.History(name)
 }
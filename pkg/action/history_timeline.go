@@ -0,0 +1,175 @@
+package action
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	stdtime "time"
+
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+	helmtime "github.com/werf/3p-helm/pkg/time"
+)
+
+// ReleaseTimeline is the history of a release prepared for rendering, e.g. in
+// a UI, with the revisions ordered from the oldest to the newest.
+type ReleaseTimeline struct {
+	Release   string              `json:"release"`
+	Namespace string              `json:"namespace"`
+	Revisions []*TimelineRevision `json:"revisions"`
+}
+
+// TimelineRevision is a revision of a ReleaseTimeline.
+type TimelineRevision struct {
+	Revision    int            `json:"revision"`
+	Status      release.Status `json:"status"`
+	Description string         `json:"description,omitempty"`
+	// Pinned is set for the revisions pinned with Pin.
+	Pinned bool `json:"pinned,omitempty"`
+	// LastPhase and LastStage are where the deploy of the revision stopped.
+	LastPhase *release.Phase `json:"last_phase,omitempty"`
+	LastStage *int           `json:"last_stage,omitempty"`
+
+	Chart        string `json:"chart"`
+	ChartVersion string `json:"chart_version"`
+	AppVersion   string `json:"app_version,omitempty"`
+	// ChartChanged is set if the chart name or version differs from the
+	// previous revision.
+	ChartChanged bool `json:"chart_changed"`
+	// ValuesDigest is the digest of the user-supplied values.
+	ValuesDigest string `json:"values_digest"`
+	// ValuesChanged is set if the values differ from the previous revision.
+	ValuesChanged bool `json:"values_changed"`
+
+	// Started is when the deploy of the revision started.
+	Started helmtime.Time `json:"started"`
+	// Ended is when a deployed revision was superseded or uninstalled, or
+	// when the next revision started for the failed and pending ones. Zero
+	// for the revision still deployed and the last one.
+	Ended helmtime.Time `json:"ended,omitempty"`
+	// Duration is the time from Started to Ended, or to now if the revision
+	// has not ended.
+	Duration string `json:"duration"`
+	// Transitions are the statuses the revision went through, derived from
+	// the stored revisions.
+	Transitions []*StatusTransition `json:"transitions"`
+}
+
+// StatusTransition is a status change of a TimelineRevision.
+type StatusTransition struct {
+	Status release.Status `json:"status"`
+	At     helmtime.Time  `json:"at"`
+}
+
+// Timeline returns the timeline of the release, of the Max most recent
+// revisions if Max is positive.
+func (h *History) Timeline(name string) (*ReleaseTimeline, error) {
+	history, err := h.Run(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReleaseTimeline(history), nil
+}
+
+// NewReleaseTimeline builds the timeline of the revisions of a release.
+func NewReleaseTimeline(history []*release.Release) *ReleaseTimeline {
+	revisions := make([]*release.Release, len(history))
+	copy(revisions, history)
+	releaseutil.SortByRevision(revisions)
+
+	timeline := &ReleaseTimeline{Revisions: []*TimelineRevision{}}
+	if len(revisions) > 0 {
+		timeline.Release = revisions[len(revisions)-1].Name
+		timeline.Namespace = revisions[len(revisions)-1].Namespace
+	}
+
+	now := helmtime.Now()
+	for i, rel := range revisions {
+		revision := &TimelineRevision{
+			Revision:     rel.Version,
+			ValuesDigest: valuesDigest(rel.Config),
+		}
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			revision.Chart = rel.Chart.Metadata.Name
+			revision.ChartVersion = rel.Chart.Metadata.Version
+			revision.AppVersion = rel.Chart.Metadata.AppVersion
+		}
+		if rel.Info != nil {
+			revision.Status = rel.Info.Status
+			revision.Description = rel.Info.Description
+			revision.Pinned = rel.Info.Pinned
+			revision.LastPhase = rel.Info.LastPhase
+			revision.LastStage = rel.Info.LastStage
+			revision.Started = rel.Info.LastDeployed
+		}
+
+		if i > 0 {
+			previous := timeline.Revisions[i-1]
+			revision.ChartChanged = revision.Chart != previous.Chart || revision.ChartVersion != previous.ChartVersion
+			revision.ValuesChanged = revision.ValuesDigest != previous.ValuesDigest
+		}
+
+		revision.Transitions, revision.Ended = revisionTransitions(rel, revisions[i+1:])
+		// A deployed revision is still current even if newer revisions failed.
+		if i+1 < len(revisions) && revision.Ended.IsZero() && revision.Status != release.StatusDeployed && revisions[i+1].Info != nil {
+			revision.Ended = revisions[i+1].Info.LastDeployed
+		}
+
+		end := revision.Ended
+		if end.IsZero() {
+			end = now
+		}
+		if !revision.Started.IsZero() {
+			revision.Duration = end.Sub(revision.Started).Round(stdtime.Second).String()
+		}
+
+		timeline.Revisions = append(timeline.Revisions, revision)
+	}
+
+	return timeline
+}
+
+// revisionTransitions returns the statuses the revision went through and when
+// it stopped being deployed, if it did. A successful revision is deployed
+// until the next successful one supersedes it.
+func revisionTransitions(rel *release.Release, newer []*release.Release) ([]*StatusTransition, helmtime.Time) {
+	if rel.Info == nil {
+		return nil, helmtime.Time{}
+	}
+
+	started := rel.Info.LastDeployed
+	switch rel.Info.Status {
+	case release.StatusSuperseded:
+		transitions := []*StatusTransition{{Status: release.StatusDeployed, At: started}}
+		for _, next := range newer {
+			if next.Info != nil && (next.Info.Status == release.StatusDeployed || next.Info.Status == release.StatusSuperseded || next.Info.Status == release.StatusUninstalled) {
+				transitions = append(transitions, &StatusTransition{Status: release.StatusSuperseded, At: next.Info.LastDeployed})
+				return transitions, next.Info.LastDeployed
+			}
+		}
+		return transitions, helmtime.Time{}
+	case release.StatusUninstalled:
+		transitions := []*StatusTransition{{Status: release.StatusDeployed, At: started}}
+		if !rel.Info.Deleted.IsZero() {
+			transitions = append(transitions, &StatusTransition{Status: release.StatusUninstalled, At: rel.Info.Deleted})
+		}
+		return transitions, rel.Info.Deleted
+	default:
+		return []*StatusTransition{{Status: rel.Info.Status, At: started}}, helmtime.Time{}
+	}
+}
+
+func valuesDigest(values map[string]interface{}) string {
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+
+	// Map keys are marshalled sorted, so equal values have equal digests.
+	data, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
@@ -0,0 +1,66 @@
+package action
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/werf/3p-helm/pkg/release"
+	helmtime "github.com/werf/3p-helm/pkg/time"
+)
+
+func TestNewReleaseTimeline(t *testing.T) {
+	is := assert.New(t)
+
+	start := helmtime.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) helmtime.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	revision := func(version int, status release.Status, chartVersion string, values map[string]interface{}, started int) *release.Release {
+		rel := namedReleaseStub("timeline", status)
+		rel.Version = version
+		rel.Chart.Metadata.Version = chartVersion
+		rel.Config = values
+		rel.Info.LastDeployed = at(started)
+		return rel
+	}
+
+	uninstalled := revision(5, release.StatusUninstalled, "0.2.0", map[string]interface{}{"b": 1, "a": 2}, 40)
+	uninstalled.Info.Deleted = at(60)
+
+	timeline := NewReleaseTimeline([]*release.Release{
+		uninstalled,
+		revision(2, release.StatusFailed, "0.1.0", map[string]interface{}{"a": 2}, 10),
+		revision(1, release.StatusSuperseded, "0.1.0", map[string]interface{}{"a": 1}, 0),
+		revision(3, release.StatusSuperseded, "0.2.0", map[string]interface{}{"a": 2}, 20),
+		revision(4, release.StatusFailed, "0.2.0", map[string]interface{}{"a": 2, "b": 1}, 30),
+	})
+
+	is.Equal("timeline", timeline.Release)
+	is.Len(timeline.Revisions, 5)
+
+	first, failed, second, failedAgain, last := timeline.Revisions[0], timeline.Revisions[1], timeline.Revisions[2], timeline.Revisions[3], timeline.Revisions[4]
+
+	is.Equal(1, first.Revision)
+	is.Equal([]*StatusTransition{{Status: release.StatusDeployed, At: at(0)}, {Status: release.StatusSuperseded, At: at(20)}}, first.Transitions)
+	is.Equal(at(20), first.Ended)
+	is.Equal("20m0s", first.Duration)
+
+	is.True(failed.ValuesChanged)
+	is.False(failed.ChartChanged)
+	is.Equal(at(20), failed.Ended)
+
+	is.True(second.ChartChanged)
+	is.False(second.ValuesChanged)
+	is.Equal(at(40), second.Ended)
+
+	is.Equal([]*StatusTransition{{Status: release.StatusFailed, At: at(30)}}, failedAgain.Transitions)
+	is.Equal(failedAgain.ValuesDigest, last.ValuesDigest)
+	is.False(last.ValuesChanged)
+
+	is.Equal([]*StatusTransition{{Status: release.StatusDeployed, At: at(40)}, {Status: release.StatusUninstalled, At: at(60)}}, last.Transitions)
+	is.Equal("20m0s", last.Duration)
+
+	is.Empty(NewReleaseTimeline(nil).Revisions)
+}
@@ -20,16 +20,34 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/cli-runtime/pkg/resource"
+
 	"github.com/werf/3p-helm/pkg/kube"
 	"github.com/werf/3p-helm/pkg/release"
 	helmtime "github.com/werf/3p-helm/pkg/time"
 )
 
-// execHook executes all of the hooks for the given hook event.
-func (cfg *Configuration) execHook(rl *release.Release, hook release.HookEvent, timeout time.Duration) error {
+var accessor = meta.NewAccessor()
+
+// execHook executes all of the hooks for the given hook event. Hooks are waited
+// for up to their own timeout if they have one, otherwise up to hooksTimeout, or
+// up to timeout if hooksTimeout is not set. Up to concurrency hooks of the same
+// weight are executed at once, and the hooks of the next weight only after all
+// the hooks of the previous one have succeeded. Once maxFailures hooks of a
+// weight have failed, its remaining hooks are not executed, see
+// hooksMaxFailures.
+func (cfg *Configuration) execHook(rl *release.Release, hook release.HookEvent, timeout, hooksTimeout time.Duration, concurrency, maxFailures int) error {
+	return cfg.execHookOfStep(rl, hook, 0, timeout, hooksTimeout, concurrency, maxFailures)
+}
+
+// execHookOfStep is execHook for the hooks executed once per canary step, see
+// release.HookStepIdempotencyKey.
+func (cfg *Configuration) execHookOfStep(rl *release.Release, hook release.HookEvent, step int, timeout, hooksTimeout time.Duration, concurrency, maxFailures int) error {
 	executingHooks := []*release.Hook{}
 
 	for _, h := range rl.Hooks {
@@ -43,75 +61,297 @@ func (cfg *Configuration) execHook(rl *release.Release, hook release.HookEvent,
 	// hooke are pre-ordered by kind, so keep order stable
 	sort.Stable(hookByWeight(executingHooks))
 
-	for i, h := range executingHooks {
-		// Set default delete policy to before-hook-creation
-		if h.DeletePolicies == nil || len(h.DeletePolicies) == 0 {
-			// TODO(jlegrone): Only apply before-hook-creation delete policy to run to completion
-			//                 resources. For all other resource types update in place if a
-			//                 resource with the same name already exists and is owned by the
-			//                 current release.
-			h.DeletePolicies = []release.HookDeletePolicy{release.HookBeforeHookCreation}
+	for start := 0; start < len(executingHooks); {
+		end := start + 1
+		for end < len(executingHooks) && executingHooks[end].Weight == executingHooks[start].Weight {
+			end++
+		}
+
+		if err := cfg.execHooksOfWeight(rl, executingHooks[start:end], start, hook, step, timeout, hooksTimeout, concurrency, maxFailures); err != nil {
+			return err
 		}
 
-		if err := cfg.deleteHookByPolicy(h, release.HookBeforeHookCreation, timeout); err != nil {
+		start = end
+	}
+
+	// If all hooks are successful, check the annotation of each hook to determine whether the hook should be deleted
+	// under succeeded condition. If so, then clear the corresponding resource object in each hook
+	for _, h := range executingHooks {
+		if err := cfg.deleteHookByPolicy(h, release.HookSucceeded, timeout); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
+
+// execHooksOfWeight executes hooks of the same weight, up to concurrency of them
+// at once, until the failures budget of the hooks is exhausted. The hooks
+// already running are waited for, and the errors of all the failed hooks are
+// returned together. offset is the index of the first of the hooks among all
+// the hooks of the event.
+func (cfg *Configuration) execHooksOfWeight(rl *release.Release, hooks []*release.Hook, offset int, hook release.HookEvent, step int, timeout, hooksTimeout time.Duration, concurrency, maxFailures int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	budget := hooksMaxFailures(hooks, maxFailures)
+
+	// The release, including the hooks, is stored while hooks are executed.
+	var mu sync.Mutex
+	// failuresMu guards failures, which are counted before the hook releases
+	// its slot, so that no hook is started once the budget is exhausted.
+	var failuresMu sync.Mutex
+	failures := 0
+
+	errs := make([]error, len(hooks))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, h := range hooks {
+		sem <- struct{}{}
+
+		failuresMu.Lock()
+		failed := failures
+		failuresMu.Unlock()
+		if budget > 0 && failed >= budget {
+			<-sem
+			cfg.Log("%d %s hooks with weight %d failed, not executing the remaining %d", failed, hook, h.Weight, len(hooks)-i)
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, h *release.Hook) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
 
-		resources, err := cfg.KubeClient.Build(bytes.NewBufferString(h.Manifest), true)
+			if errs[i] = cfg.execSingleHook(rl, h, offset+i, hook, step, timeout, hooksTimeout, &mu); errs[i] != nil {
+				failuresMu.Lock()
+				failures++
+				failuresMu.Unlock()
+			}
+		}(i, h)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
 		if err != nil {
-			return errors.Wrapf(err, "unable to build kubernetes object for %s hook %s", hook, h.Path)
+			failed = append(failed, err)
 		}
+	}
+
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return errors.Errorf("%d %s hooks failed: %s", len(failed), hook, joinErrors(failed))
+	}
+}
+
+// hooksMaxFailures returns how many of the hooks of the same weight may fail
+// before the remaining ones are not executed, or a negative number if all of
+// them are executed regardless of the failures. The budget is maxFailures, or
+// 1 if it is not set, unless the hooks set it with the
+// werf.io/hook-max-failures annotation, in which case the largest one is used.
+func hooksMaxFailures(hooks []*release.Hook, maxFailures int) int {
+	budget := 0
+	for _, h := range hooks {
+		switch {
+		case h.MaxFailures < 0:
+			return -1
+		case h.MaxFailures > budget:
+			budget = h.MaxFailures
+		}
+	}
+
+	switch {
+	case budget > 0:
+		return budget
+	case maxFailures < 0:
+		return -1
+	case maxFailures == 0:
+		return 1
+	default:
+		return maxFailures
+	}
+}
+
+// execSingleHook executes the hook and waits for it to complete. mu guards the
+// hook execution state and the release storage.
+func (cfg *Configuration) execSingleHook(rl *release.Release, h *release.Hook, index int, hook release.HookEvent, step int, timeout, hooksTimeout time.Duration, mu *sync.Mutex) error {
+	mu.Lock()
+	// Set default delete policy to before-hook-creation
+	if h.DeletePolicies == nil || len(h.DeletePolicies) == 0 {
+		// TODO(jlegrone): Only apply before-hook-creation delete policy to run to completion
+		//                 resources. For all other resource types update in place if a
+		//                 resource with the same name already exists and is owned by the
+		//                 current release.
+		h.DeletePolicies = []release.HookDeletePolicy{release.HookBeforeHookCreation}
+	}
+	mu.Unlock()
+
+	// The hook might have already been executed for this release revision if the
+	// operation is retried or resumed after a partial failure. Never run it twice,
+	// except for the test hooks, which every run of the tests executes anew.
+	idempotencyKey := release.HookStepIdempotencyKey(rl, h, hook, step)
+	rerun := hook == release.HookTest
+	if !rerun && h.LastRun.IdempotencyKey == idempotencyKey && h.LastRun.Phase == release.HookPhaseSucceeded {
+		cfg.Log("%s hook %s has already succeeded for revision %d, skipping", hook, h.Path, rl.Version)
+		return nil
+	}
+
+	resources, err := cfg.KubeClient.Build(bytes.NewBufferString(h.Manifest), true)
+	if err != nil {
+		return errors.Wrapf(err, "unable to build kubernetes object for %s hook %s", hook, h.Path)
+	}
+
+	if err := resources.Visit(setHookIdempotencyKeyVisitor(idempotencyKey)); err != nil {
+		return err
+	}
 
+	// If the previous attempt of this very execution was interrupted, then its resources
+	// might still be in the cluster. Watch them instead of recreating them.
+	resume := !rerun && h.LastRun.IdempotencyKey == idempotencyKey &&
+		(h.LastRun.Phase == release.HookPhaseRunning || h.LastRun.Phase == release.HookPhaseUnknown) &&
+		cfg.hookResourcesExist(resources, idempotencyKey)
+
+	if resume {
+		cfg.Log("resuming %s hook %s interrupted during revision %d", hook, h.Path, rl.Version)
+	} else if err := cfg.deleteHookByPolicy(h, release.HookBeforeHookCreation, timeout); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	if !resume {
 		// Record the time at which the hook was applied to the cluster
 		h.LastRun = release.HookExecution{
-			StartedAt: helmtime.Now(),
-			Phase:     release.HookPhaseRunning,
+			StartedAt:      helmtime.Now(),
+			IdempotencyKey: idempotencyKey,
+			CanaryStep:     step,
 		}
+	}
+	h.LastRun.Phase = release.HookPhaseRunning
 
-		if err := cfg.Releases.Update(release.SetHookPhaseStageInfo(rl, i, hook)); err != nil {
-			return fmt.Errorf("error recording release: %w", err)
-		}
+	err = cfg.Releases.Update(release.SetHookPhaseStageInfo(rl, index, hook))
 
-		// As long as the implementation of WatchUntilReady does not panic, HookPhaseFailed or HookPhaseSucceeded
-		// should always be set by this function. If we fail to do that for any reason, then HookPhaseUnknown is
-		// the most appropriate value to surface.
-		h.LastRun.Phase = release.HookPhaseUnknown
+	// As long as the implementation of WatchUntilReady does not panic, HookPhaseFailed or HookPhaseSucceeded
+	// should always be set by this function. If we fail to do that for any reason, then HookPhaseUnknown is
+	// the most appropriate value to surface.
+	h.LastRun.Phase = release.HookPhaseUnknown
+	mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error recording release: %w", err)
+	}
 
-		// Create hook resources
+	// Create hook resources
+	if !resume {
 		if _, err := cfg.KubeClient.Create(resources, kube.CreateOptions{}); err != nil {
+			mu.Lock()
 			h.LastRun.CompletedAt = helmtime.Now()
 			h.LastRun.Phase = release.HookPhaseFailed
+			mu.Unlock()
 			return errors.Wrapf(err, "warning: Hook %s %s failed", hook, h.Path)
 		}
+	}
 
-		// Watch hook resources until they have completed
-		err = cfg.KubeClient.WatchUntilReady(resources, timeout)
-		// Note the time of success/failure
-		h.LastRun.CompletedAt = helmtime.Now()
-		// Mark hook as succeeded or failed
-		if err != nil {
-			h.LastRun.Phase = release.HookPhaseFailed
-			// If a hook is failed, check the annotation of the hook to determine whether the hook should be deleted
-			// under failed condition. If so, then clear the corresponding resource object in the hook
-			if err := cfg.deleteHookByPolicy(h, release.HookFailed, timeout); err != nil {
-				return err
-			}
-			return err
-		}
+	// Watch hook resources until they have completed
+	hookTimeout, hookTimeoutSource := resolveHookTimeout(h, timeout, hooksTimeout)
+	watchStartedAt := time.Now()
+	err = cfg.KubeClient.WatchUntilReady(resources, hookTimeout)
+
+	mu.Lock()
+	// Note the time of success/failure
+	h.LastRun.CompletedAt = helmtime.Now()
+	// Mark hook as succeeded or failed
+	if err != nil {
+		h.LastRun.Phase = release.HookPhaseFailed
+	} else {
 		h.LastRun.Phase = release.HookPhaseSucceeded
 	}
+	mu.Unlock()
 
-	// If all hooks are successful, check the annotation of each hook to determine whether the hook should be deleted
-	// under succeeded condition. If so, then clear the corresponding resource object in each hook
-	for _, h := range executingHooks {
-		if err := cfg.deleteHookByPolicy(h, release.HookSucceeded, timeout); err != nil {
+	if err != nil {
+		if hookTimeout > 0 && time.Since(watchStartedAt) >= hookTimeout {
+			err = errors.Wrapf(err, "%s hook %s timed out after %s set by %s", hook, h.Path, hookTimeout, hookTimeoutSource)
+		}
+		// If a hook is failed, check the annotation of the hook to determine whether the hook should be deleted
+		// under failed condition. If so, then clear the corresponding resource object in the hook
+		if err := cfg.deleteHookByPolicy(h, release.HookFailed, timeout); err != nil {
 			return err
 		}
+		return err
 	}
 
 	return nil
 }
 
+// resolveHookTimeout returns the time to wait for the hook to complete and what
+// the timeout was set by, to attribute timeout errors.
+func resolveHookTimeout(h *release.Hook, timeout, hooksTimeout time.Duration) (time.Duration, string) {
+	switch {
+	case h.Timeout > 0:
+		return h.Timeout, fmt.Sprintf("the %s annotation", release.HookTimeoutAnnotation)
+	case hooksTimeout > 0:
+		return hooksTimeout, "the hooks timeout"
+	default:
+		return timeout, "the operation timeout"
+	}
+}
+
+// setHookIdempotencyKeyVisitor annotates hook resources with the idempotency key of the hook execution
+func setHookIdempotencyKeyVisitor(idempotencyKey string) resource.VisitorFunc {
+	return func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		annotations, err := accessor.Annotations(info.Object)
+		if err != nil {
+			return err
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[release.HookIdempotencyKeyAnnotation] = idempotencyKey
+
+		return accessor.SetAnnotations(info.Object, annotations)
+	}
+}
+
+// hookResourcesExist checks whether all the hook resources exist in the cluster and were created
+// by the hook execution with the given idempotency key
+func (cfg *Configuration) hookResourcesExist(resources kube.ResourceList, idempotencyKey string) bool {
+	kubeClient, ok := cfg.KubeClient.(kube.InterfaceResources)
+	if !ok || len(resources) == 0 {
+		return false
+	}
+
+	liveObjs, err := kubeClient.Get(resources, false)
+	if err != nil {
+		cfg.Log("unable to get live hook resources: %s", err)
+		return false
+	}
+
+	found := 0
+	for _, objs := range liveObjs {
+		for _, obj := range objs {
+			annotations, err := accessor.Annotations(obj)
+			if err != nil {
+				return false
+			}
+			if annotations[release.HookIdempotencyKeyAnnotation] == idempotencyKey {
+				found++
+			}
+		}
+	}
+
+	return found == len(resources)
+}
+
 // hookByWeight is a sorter for hooks
 type hookByWeight []*release.Hook
 
@@ -0,0 +1,178 @@
+package action
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+// hookRecordingKubeClient builds a ConfigMap named after the manifest of each
+// hook and records the hooks being watched.
+type hookRecordingKubeClient struct {
+	kubefake.PrintingKubeClient
+
+	failing []string
+
+	mu         sync.Mutex
+	running    int
+	maxRunning int
+	finished   []string
+	// finishedBefore are the hooks finished when the hook started.
+	finishedBefore map[string][]string
+}
+
+func (c *hookRecordingKubeClient) Build(r io.Reader, _ bool) (kube.ResourceList, error) {
+	name, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return kube.ResourceList{{
+		Name:   string(name),
+		Object: &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: string(name)}},
+	}}, nil
+}
+
+func (c *hookRecordingKubeClient) WatchUntilReady(resources kube.ResourceList, _ time.Duration) error {
+	name := resources[0].Name
+
+	c.mu.Lock()
+	c.running++
+	if c.running > c.maxRunning {
+		c.maxRunning = c.running
+	}
+	c.finishedBefore[name] = append([]string{}, c.finished...)
+	c.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	c.mu.Lock()
+	c.running--
+	c.finished = append(c.finished, name)
+	c.mu.Unlock()
+
+	if contains(c.failing, name) {
+		return errors.New("hook " + name + " failed")
+	}
+	return nil
+}
+
+func TestExecHookConcurrency(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		concurrency int
+		maxFailures int
+		// annotated hooks have the werf.io/hook-max-failures annotation
+		annotated  map[string]int
+		failing    []string
+		maxRunning int
+		finished   []string
+		err        bool
+	}{
+		{name: "one by one", concurrency: 1, maxRunning: 1, finished: []string{"a", "b", "c", "d"}},
+		{name: "concurrent", concurrency: 2, maxRunning: 2, finished: []string{"a", "b", "c", "d"}},
+		{name: "unlimited by the hooks count", concurrency: 10, maxRunning: 3, finished: []string{"a", "b", "c", "d"}},
+		{name: "one by one failed", concurrency: 1, failing: []string{"b"}, maxRunning: 1, finished: []string{"a", "b"}, err: true},
+		{name: "concurrent failed", concurrency: 3, failing: []string{"b"}, maxRunning: 3, finished: []string{"a", "b", "c"}, err: true},
+		{name: "concurrent aborted", concurrency: 2, failing: []string{"a", "b"}, maxRunning: 2, finished: []string{"a", "b"}, err: true},
+		{name: "aborted after two failures", concurrency: 1, maxFailures: 2, failing: []string{"a", "c"}, maxRunning: 1, finished: []string{"a", "b", "c"}, err: true},
+		{name: "all failures aggregated", concurrency: 1, maxFailures: -1, failing: []string{"a", "b"}, maxRunning: 1, finished: []string{"a", "b", "c"}, err: true},
+		{name: "budget set by annotation", concurrency: 1, annotated: map[string]int{"c": 2}, failing: []string{"a"}, maxRunning: 1, finished: []string{"a", "b", "c"}, err: true},
+		{name: "next weight after tolerated failures is not executed", concurrency: 1, maxFailures: 5, failing: []string{"c"}, maxRunning: 1, finished: []string{"a", "b", "c"}, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			kubeClient := &hookRecordingKubeClient{
+				PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+				failing:            test.failing,
+				finishedBefore:     map[string][]string{},
+			}
+			cfg := actionConfigFixture(t)
+			cfg.KubeClient = kubeClient
+
+			rel := releaseStub()
+			rel.Hooks = nil
+			for _, h := range []struct {
+				name   string
+				weight int
+			}{{"d", 1}, {"c", 0}, {"b", 0}, {"a", 0}} {
+				rel.Hooks = append(rel.Hooks, &release.Hook{
+					Name:        h.name,
+					Kind:        "ConfigMap",
+					Path:        "templates/" + h.name,
+					Manifest:    h.name,
+					Weight:      h.weight,
+					MaxFailures: test.annotated[h.name],
+					Events:      []release.HookEvent{release.HookPreInstall},
+				})
+			}
+			is.NoError(cfg.Releases.Create(rel))
+
+			err := cfg.execHook(rel, release.HookPreInstall, time.Minute, 0, test.concurrency, test.maxFailures)
+			if test.err {
+				is.Error(err)
+				for _, name := range test.failing {
+					if contains(test.finished, name) {
+						is.Contains(err.Error(), name)
+					}
+				}
+			} else {
+				is.NoError(err)
+			}
+
+			is.Equal(test.maxRunning, kubeClient.maxRunning)
+			is.ElementsMatch(test.finished, kubeClient.finished)
+			// The hooks of the next weight start after all the previous ones.
+			if before, found := kubeClient.finishedBefore["d"]; found {
+				is.ElementsMatch([]string{"a", "b", "c"}, before)
+			}
+
+			for _, h := range rel.Hooks {
+				switch {
+				case contains(test.failing, h.Name):
+					is.Equal(release.HookPhaseFailed, h.LastRun.Phase)
+				case contains(test.finished, h.Name):
+					is.Equal(release.HookPhaseSucceeded, h.LastRun.Phase, h.Name)
+				default:
+					is.Equal(release.HookPhase(""), h.LastRun.Phase, h.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestExecHookRerunsTestHooks(t *testing.T) {
+	is := assert.New(t)
+
+	kubeClient := &hookRecordingKubeClient{
+		PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+		finishedBefore:     map[string][]string{},
+	}
+	cfg := actionConfigFixture(t)
+	cfg.KubeClient = kubeClient
+
+	rel := releaseStub()
+	rel.Hooks = []*release.Hook{
+		{Name: "install", Kind: "ConfigMap", Path: "templates/install", Manifest: "install", Events: []release.HookEvent{release.HookPreInstall}},
+		{Name: "test", Kind: "ConfigMap", Path: "templates/test", Manifest: "test", Events: []release.HookEvent{release.HookTest}},
+	}
+	is.NoError(cfg.Releases.Create(rel))
+
+	for i := 0; i < 2; i++ {
+		is.NoError(cfg.execHook(rel, release.HookPreInstall, time.Minute, 0, 1, 0))
+		is.NoError(cfg.execHook(rel, release.HookTest, time.Minute, 0, 1, 0))
+	}
+
+	is.Equal([]string{"install", "test", "test"}, kubeClient.finished)
+}
@@ -27,11 +27,13 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/pkg/errors"
+	"github.com/werf/3p-helm/pkg/messages"
 	"github.com/werf/3p-helm/pkg/phases"
 	"github.com/werf/3p-helm/pkg/phases/phasemanagers"
 	"github.com/werf/3p-helm/pkg/phases/stages"
@@ -69,6 +71,19 @@ const defaultDirectoryPermission = 0755
 // Install performs an installation operation.
 type Install struct {
 	cfg *Configuration
+	// deployReport collects the results of the rollout for DeployReportPath and the DeployExtender.
+	deployReport *release.DeployReport
+	// progress emits the progress events of the deploy to ProgressOutput.
+	progress *release.ProgressStream
+	// metrics records the metrics of the deploy if the configuration has Metrics.
+	metrics *deployMetrics
+	// result is the result of the last run.
+	result DeployResult
+	// untrackedResources are the unsupported resources applied without tracking them.
+	untrackedResources kube.ResourceList
+	// plan, if set, is filled with the plan of the install by a dry run
+	// instead of only completing it, see Install.Plan.
+	plan *DeployPlan
 
 	ChartPathOptions
 
@@ -96,6 +111,94 @@ type Install struct {
 	DisableOpenAPIValidation bool
 	IncludeCRDs              bool
 	Labels                   map[string]string
+	// Metadata is arbitrary data recorded in the release.
+	Metadata map[string]string
+	// RenderDebugDir, if set, is the directory to write the output, the context
+	// and the render time of every chart template into.
+	RenderDebugDir string
+	// RenderTimeout and TemplateRenderTimeout, if set, limit the total render
+	// time of the chart and the render time of every template.
+	RenderTimeout         time.Duration
+	TemplateRenderTimeout time.Duration
+	// ImageDigestCacheFile, if set, is the JSON file the image digests resolved
+	// by the "werf_image" template function are stored in. It is read when the
+	// registry is unreachable.
+	ImageDigestCacheFile string
+	// ManifestLimits are enforced on the rendered manifests.
+	ManifestLimits ManifestLimits
+	// IncludeResources and ExcludeResources select the chart resources to deploy,
+	// e.g. "Deployment/backend-*" or "label:app.kubernetes.io/component=db". The
+	// excluded resources are left as is in the cluster.
+	IncludeResources []string
+	ExcludeResources []string
+	// InjectDeployMetadata annotates the pod templates of workloads with the
+	// release revision and the deploy time. Workloads with an unchanged pod
+	// template keep their annotations, so that they are not restarted.
+	InjectDeployMetadata bool
+	// WaitForOwnedResources, if set with Wait, also waits for the resources owned
+	// by custom resources, such as the workloads created by operators, and reports
+	// their failures.
+	WaitForOwnedResources bool
+	// HooksTimeout, if set, is the time to wait for each hook to complete
+	// instead of Timeout. It is overridden by the werf.io/hook-timeout
+	// annotation of the hook.
+	HooksTimeout time.Duration
+	// HooksConcurrency is how many hooks of the same weight are executed at
+	// once. Hooks are executed one by one if it is 1 or less.
+	HooksConcurrency int
+	// HooksMaxFailures is how many hooks of the same weight may fail before
+	// the remaining ones are not executed: 1, the default, stops at the first
+	// failure, a negative number executes all of them and reports all the
+	// failures. It is overridden by the werf.io/hook-max-failures annotation.
+	HooksMaxFailures int
+	// WatchEvents collects the Warning events of the release resources and of the
+	// objects they create, e.g. Pods, while deploying and adds them to the error
+	// if the deploy fails.
+	WatchEvents bool
+	// APIUnavailabilityBudget is how long the deploy is paused, in total, while
+	// the Kubernetes API server is unavailable before it fails. Zero disables
+	// pausing.
+	APIUnavailabilityBudget time.Duration
+	// ImmutableGenerationsToKeep is how many of the last revisions keep their
+	// generations of immutable ConfigMaps and Secrets instead of deleting them
+	// after the deploy. Zero deletes them as any other orphaned resource.
+	ImmutableGenerationsToKeep int
+	// PrunePolicy is what is done with the orphaned resources after the
+	// rollout: "prune" (default) deletes them, "warn-only" keeps them with a
+	// warning and "keep" keeps them. Resources annotated with
+	// phases.NoPruneAnnotation are always kept.
+	PrunePolicy string
+	// UnsupportedResourcesPolicy is what is done, when waiting for the
+	// resources without their owned resources, with the resources whose
+	// readiness can't be tracked: "warn" (default) applies them without
+	// tracking with a warning, "fail" fails the deploy and "skip" skips them.
+	UnsupportedResourcesPolicy string
+	// RelaxPodDisruptionBudgets lets the pods selected by the
+	// PodDisruptionBudgets of the workloads be disrupted while the resources
+	// are applied and tracked, setting maxUnavailable of the budgets to 100%
+	// and restoring them after the rollout. The budgets which are resources of
+	// the release are not relaxed.
+	RelaxPodDisruptionBudgets bool
+	// VerifyCronJobs creates, in the dry-run mode, a Job from the job template
+	// of every deployed CronJob, so that the Jobs which would be rejected, e.g.
+	// by admission webhooks, fail the deploy instead of the next scheduled run
+	// of the CronJob.
+	VerifyCronJobs bool
+	// MigrateCRDStoredVersions migrates the stored objects of the
+	// CustomResourceDefinitions whose update removes the versions still listed
+	// in their status.storedVersions before the rollout, rather than failing
+	// the deploy.
+	MigrateCRDStoredVersions bool
+	// ReleaseDependencies are releases, in the format of ParseReleaseDependency,
+	// to wait for before the deploy in addition to the ones declared by the
+	// ReleaseDependencyAnnotationPrefix chart annotations. They are waited for
+	// up to Timeout.
+	ReleaseDependencies []string
+	// AdoptResources are matchers, in the format of phases.ParseResourceMatcher,
+	// of the existing resources not belonging to any release which are adopted
+	// by the release instead of failing the deploy. They are matched against
+	// the live objects, e.g. "label:app.kubernetes.io/instance=backend".
+	AdoptResources []string
 	// KubeVersion allows specifying a custom kubernetes version to use and
 	// APIVersions allows a manual set of supported API Versions to be passed
 	// (for things like templating). These are ignored if ClientOnly is false
@@ -115,7 +218,39 @@ type Install struct {
 	CleanupOnFail               bool
 	StagesSplitter              phases.Splitter
 	StagesExternalDepsGenerator phases.ExternalDepsGenerator
+	DeployExtender              phases.DeployExtender
 	DeployReportPath            string
+	// DeployReportFormat is the format of the deploy report, "json" (default) or "yaml".
+	DeployReportFormat string
+	// PlanOutputPath, if set, is the file the DeployPlan of the install is written to before
+	// the install, e.g. for the CI to archive and review what is deployed.
+	PlanOutputPath string
+	// PlanOutputFormat is the format of the deploy plan, "json" (default) or "yaml".
+	PlanOutputFormat string
+	// ProgressOutput, if set, receives the progress events of the deploy as JSON lines, see release.ProgressStream.
+	ProgressOutput io.Writer
+	// LogsTailWindow limits the logs of every container of the tracked resources shown by the
+	// ResourcesWaiter of the kube client to the last lines or the last period, see kube.LogsOptions.
+	LogsTailWindow kube.LogsTailWindow
+	// HideLogs turns the logs of the containers of the tracked resources off, keeping the other
+	// messages of the tracking.
+	HideLogs bool
+	// LogsDir, if set, is the directory the streamed logs of the containers of the tracked resources
+	// are written to, per resource and container, see kube.ContainerLogFiles.
+	LogsDir string
+	// Notifiers are notified of the start and the end of the deploy.
+	Notifiers []Notifier
+	// NotificationReportURL is the link to the deploy report passed to the Notifiers, e.g. the one
+	// of the report of DeployReportPath published by the CI.
+	NotificationReportURL string
+	// ValuesFiles are the values files the values were merged from, in order, recorded in the deploy report.
+	ValuesFiles []string
+	// ClusterScoped is set for releases having only cluster-scoped resources. The release namespace is
+	// not created and only used to store the release records. Namespaced resources are not allowed.
+	ClusterScoped bool
+	// ControlNamespace, if set, is the namespace of the ClusterScoped release, which its records are
+	// stored in, instead of Namespace.
+	ControlNamespace string
 }
 
 // ChartPathOptions captures common options used for controlling chart paths
@@ -145,7 +280,7 @@ func NewInstall(cfg *Configuration, stagesSplitter phases.Splitter, stagesExtern
 	}
 
 	if stagesExternalDepsGenerator == nil {
-		stagesExternalDepsGenerator = &phases.NoExternalDepsGenerator{}
+		stagesExternalDepsGenerator = cfg.externalDepsGenerator()
 	}
 
 	in := &Install{
@@ -153,6 +288,7 @@ func NewInstall(cfg *Configuration, stagesSplitter phases.Splitter, stagesExtern
 
 		StagesSplitter:              stagesSplitter,
 		StagesExternalDepsGenerator: stagesExternalDepsGenerator,
+		DeployExtender:              &phases.NoDeployExtender{},
 	}
 	in.ChartPathOptions.registryClient = cfg.RegistryClient
 
@@ -212,6 +348,9 @@ func (i *Install) installCRDs(crds []chart.CRD) error {
 			discoveryClient.Invalidate()
 
 			_, _ = discoveryClient.ServerGroups()
+
+			// The capabilities are gathered again to include the new CRDs.
+			i.cfg.Capabilities = nil
 		}
 
 		// Invalidate the REST mapper, since it will not have the new CRDs
@@ -239,38 +378,65 @@ func (i *Install) Run(chrt *chart.Chart, vals map[string]interface{}) (*release.
 
 // Run executes the installation with Context
 //
-// When the task is cancelled through ctx, the function returns and the install
-// proceeds in the background.
+// When the task is cancelled through ctx or its deadline is exceeded, the
+// Kubernetes API calls and the waits of the install are cancelled, and the
+// function returns once the install is stopped.
 func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals map[string]interface{}) (*release.Release, error) {
-	// Check reachability of cluster unless in client-only mode (e.g. `helm template` without `--validate`)
-	if !i.ClientOnly {
-		if err := i.cfg.KubeClient.IsReachable(); err != nil {
-			return nil, err
-		}
-	}
+	var warnings int32
+	cfg := i.cfg
+	i.cfg = cfg.withContext(ctx).withWarningsCounter(&warnings)
+	defer func() { i.cfg = cfg }()
 
-	if err := i.availableName(); err != nil {
-		return nil, err
+	rel, err := i.run(ctx, chrt, vals)
+	i.result = newDeployResult(err, atomic.LoadInt32(&warnings))
+
+	return rel, err
+}
+
+// Result returns the result of the last run of the install.
+func (i *Install) Result() DeployResult {
+	return i.result
+}
+
+func (i *Install) run(ctx context.Context, chrt *chart.Chart, vals map[string]interface{}) (*release.Release, error) {
+	if err := release.ValidateDeployReportFormat(i.DeployReportFormat); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+	if err := ValidateDeployPlanFormat(i.PlanOutputFormat); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+	if _, err := phases.ParsePrunePolicy(i.PrunePolicy); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+	if _, err := phases.ParseUnsupportedResourcesPolicy(i.UnsupportedResourcesPolicy); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
 	}
 
-	if err := chartutil.ProcessDependenciesWithMerge(chrt, &vals); err != nil {
-		return nil, err
+	if i.ClusterScoped && i.ControlNamespace != "" {
+		namespace := i.Namespace
+		i.cfg, i.Namespace = i.cfg.withControlNamespace(i.ControlNamespace), i.ControlNamespace
+		defer func() { i.Namespace = namespace }()
 	}
 
-	var interactWithRemote bool
-	if !i.isDryRun() || i.DryRunOption == "server" || i.DryRunOption == "none" || i.DryRunOption == "false" {
-		interactWithRemote = true
+	// Check reachability of cluster unless in client-only mode (e.g. `helm template` without `--validate`)
+	if !i.ClientOnly {
+		if err := i.cfg.KubeClient.IsReachable(); err != nil {
+			return nil, err
+		}
 	}
 
-	// Pre-install anything in the crd/ directory. We do this before Helm
-	// contacts the upstream server and builds the capabilities object.
-	if crds := chrt.CRDObjects(); !i.ClientOnly && !i.SkipCRDs && len(crds) > 0 {
-		// On dry run, bail here
-		if i.isDryRun() {
-			i.cfg.Log("WARNING: This chart or one of its subcharts contains CRDs. Rendering may fail or contain inaccuracies.")
-		} else if err := i.installCRDs(crds); err != nil {
+	// Concurrent deploys of the release wait for each other, if the storage
+	// supports it.
+	if !i.ClientOnly {
+		unlock, err := i.cfg.Releases.LockRelease(i.ReleaseName)
+		if err != nil {
 			return nil, err
 		}
+		defer unlock()
+	}
+
+	if err := i.availableName(); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
 	}
 
 	if i.ClientOnly {
@@ -290,6 +456,39 @@ func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals ma
 		i.cfg.Log("API Version list given outside of client only mode, this list will be ignored")
 	}
 
+	// Dependency conditions may reference the capabilities. The dependencies
+	// decide which CRDs are installed below, so the conditions are evaluated
+	// before that and do not see the CRDs of the chart itself. The templates do,
+	// as installCRDs resets the capabilities.
+	var dependenciesCaps *chartutil.Capabilities
+	if chartutil.DependencyConditionsUseCapabilities(chrt) {
+		var err error
+		if dependenciesCaps, err = i.cfg.getCapabilities(); err != nil {
+			return nil, err
+		}
+	}
+
+	dependencies, err := chartutil.ProcessDependenciesWithMergeAndReport(chrt, &vals, dependenciesCaps)
+	if err != nil {
+		return nil, newDeployError(DeployResultFailedRender, err)
+	}
+
+	var interactWithRemote bool
+	if !i.isDryRun() || i.DryRunOption == "server" || i.DryRunOption == "none" || i.DryRunOption == "false" {
+		interactWithRemote = true
+	}
+
+	// Pre-install anything in the crd/ directory. We do this before Helm
+	// builds the capabilities object used to render the templates.
+	if crds := chrt.CRDObjects(); !i.ClientOnly && !i.SkipCRDs && len(crds) > 0 {
+		// On dry run, bail here
+		if i.isDryRun() {
+			i.cfg.Log("WARNING: This chart or one of its subcharts contains CRDs. Rendering may fail or contain inaccuracies.")
+		} else if err := i.installCRDs(crds); err != nil {
+			return nil, err
+		}
+	}
+
 	// Make sure if Atomic is set, that wait is set as well. This makes it so
 	// the user doesn't have to specify both
 	i.Wait = i.Wait || i.Atomic
@@ -310,32 +509,64 @@ func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals ma
 	}
 	valuesToRender, err := chartutil.ToRenderValues(chrt, vals, options, caps)
 	if err != nil {
-		return nil, err
+		return nil, newDeployError(DeployResultFailedRender, err)
 	}
 
 	if driver.ContainsSystemLabels(i.Labels) {
-		return nil, fmt.Errorf("user suplied labels contains system reserved label name. System labels: %+v", driver.GetSystemLabels())
+		return nil, newDeployError(DeployResultFailedValidation, fmt.Errorf("user suplied labels contains system reserved label name. System labels: %+v", driver.GetSystemLabels()))
 	}
 
 	rel := i.createRelease(chrt, vals, i.Labels)
+	rel.Dependencies = dependencies
+
+	i.deployReport = release.NewDeployReport()
+	i.progress = release.NewProgressStream(i.ProgressOutput)
+	logFiles := kube.NewContainerLogFiles(i.LogsDir)
+	defer func() {
+		if err := logFiles.Close(); err != nil {
+			i.cfg.warn("%s", err)
+		}
+	}()
+	i.cfg = i.cfg.withLogsOptions(newLogsOptions(i.HideLogs, i.LogsTailWindow, logFiles, i.progress, rel))
+	i.metrics = i.cfg.Metrics.startDeploy("install", rel)
+	i.deployReport.ValuesFiles = i.ValuesFiles
 
 	if !i.isDryRun() && i.DeployReportPath != "" {
 		defer func() {
-			deployReportData, err := release.NewDeployReport().FromRelease(rel).ToJSONData()
+			deployReportData, err := i.deployReport.FromRelease(rel).ToData(i.DeployReportFormat)
 			if err != nil {
-				i.cfg.Log("warning: error creating deploy report data: %s", err)
+				i.cfg.warn("error creating deploy report data: %s", err)
 				return
 			}
 
 			if err := os.WriteFile(i.DeployReportPath, deployReportData, 0o644); err != nil {
-				i.cfg.Log("warning: error writing deploy report file: %s", err)
+				i.cfg.warn("error writing deploy report file: %s", err)
 				return
 			}
 		}()
 	}
 
+	if !i.isDryRun() {
+		notifier := startDeployNotifications(i.cfg, i.Notifiers, i.NotificationReportURL, "install", rel)
+		defer func() {
+			report := i.deployReport.FromRelease(rel)
+			i.metrics.finish(report)
+			notifier.finish(report)
+			if err := i.DeployExtender.AfterDeploy(rel, report); err != nil {
+				i.cfg.warn("error after deploy: %s", err)
+			}
+		}()
+	}
+
 	var manifestDoc *bytes.Buffer
-	rel.Hooks, manifestDoc, rel.Info.Notes, err = i.cfg.renderResources(chrt, valuesToRender, i.ReleaseName, i.OutputDir, i.SubNotes, i.UseReleaseName, i.IncludeCRDs, i.PostRenderer, interactWithRemote, i.EnableDNS)
+	rel.Hooks, manifestDoc, rel.Info.Notes, err = i.cfg.renderResources(chrt, valuesToRender, i.ReleaseName, i.OutputDir, i.SubNotes, i.UseReleaseName, i.IncludeCRDs, i.PostRenderer, interactWithRemote, i.EnableDNS, renderOptions{
+		DebugDir:             i.RenderDebugDir,
+		TemplateTimeout:      i.TemplateRenderTimeout,
+		Timeout:              i.RenderTimeout,
+		Limits:               i.ManifestLimits,
+		ImageResolver:        imageResolver(i.registryClient, i.cfg.RegistryClient),
+		ImageDigestCacheFile: i.ImageDigestCacheFile,
+	})
 	// Even for errors, attach this if available
 	if manifestDoc != nil {
 		rel.Manifest = manifestDoc.String()
@@ -344,7 +575,7 @@ func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals ma
 	if err != nil {
 		rel.SetStatus(release.StatusFailed, fmt.Sprintf("failed to render resource: %s", err.Error()))
 		// Return a release with partial data so that the client can show debugging information.
-		return rel, err
+		return rel, newDeployError(DeployResultFailedRender, err)
 	}
 
 	// Mark this release as in-progress
@@ -353,7 +584,7 @@ func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals ma
 	var toBeAdopted kube.ResourceList
 	resources, err := i.cfg.KubeClient.Build(bytes.NewBufferString(rel.Manifest), !i.DisableOpenAPIValidation)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to build kubernetes objects from release manifest")
+		return nil, newDeployError(DeployResultFailedValidation, errors.Wrap(err, "unable to build kubernetes objects from release manifest"))
 	}
 
 	// It is safe to use "force" here because these are resources currently rendered by the chart.
@@ -362,6 +593,52 @@ func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals ma
 		return nil, err
 	}
 
+	if i.InjectDeployMetadata {
+		if err := resources.Visit(releaseutil.SetDeployMetadataVisitor(nil, rel.Version, rel.Info.LastDeployed.Time)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Conflicts and adoption are checked against the names the resources are deployed with.
+	if err := phases.VersionImmutableResources(resources, rel.Hooks, rel.Namespace); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+
+	if i.ClusterScoped {
+		if err := validateClusterScoped(i.cfg.KubeClient, resources, rel.Hooks); err != nil {
+			return nil, newDeployError(DeployResultFailedValidation, err)
+		}
+	}
+
+	if err := kube.ValidateLoggedContainers(resources); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+
+	deployType := phases.DeployTypeInstall
+	if isUpgrade {
+		deployType = phases.DeployTypeUpgrade
+	}
+	resources, skippedResources, err := phases.SplitResourcesByDeployOn(resources, deployType)
+	if err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+
+	resources, excludedResources, err := selectResources(rel, resources, i.IncludeResources, i.ExcludeResources)
+	if err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+	skippedResources.Merge(excludedResources)
+
+	i.untrackedResources = nil
+	if i.Wait && !i.WaitForOwnedResources {
+		var unsupportedResources kube.ResourceList
+		resources, unsupportedResources, i.untrackedResources, err = i.cfg.handleUnsupportedResources(resources, i.UnsupportedResourcesPolicy, i.deployReport)
+		if err != nil {
+			return nil, newDeployError(DeployResultFailedValidation, err)
+		}
+		skippedResources.Merge(unsupportedResources)
+	}
+
 	// Install requires an extra validation step of checking that resources
 	// don't already exist before we actually create resources. If we continue
 	// forward and create the release object with resources that already exist,
@@ -369,19 +646,38 @@ func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals ma
 	// deleting the release because the manifest will be pointing at that
 	// resource
 	if !i.ClientOnly && !isUpgrade && len(resources) > 0 {
-		toBeAdopted, err = existingResourceConflict(resources, rel.Name, rel.Namespace)
+		toBeAdopted, err = existingResourceConflict(resources, rel.Name, rel.Namespace, i.cfg, i.AdoptResources)
 		if err != nil {
-			return nil, errors.Wrap(err, "Unable to continue with install")
+			return nil, newDeployError(DeployResultFailedValidation, errors.Wrap(err, "Unable to continue with install"))
 		}
 	}
 
 	// Bail out here if it is a dry run
 	if i.isDryRun() {
 		rel.Info.Description = "Dry run complete"
+		if i.plan != nil {
+			plan, err := i.cfg.buildDeployPlan(rel, resources, skippedResources, toBeAdopted, i.deployPlanOptions())
+			if err != nil {
+				return nil, err
+			}
+			*i.plan = *plan
+		}
 		return rel, nil
 	}
 
-	if i.CreateNamespace {
+	if i.PlanOutputPath != "" {
+		if err := i.cfg.writeDeployPlan(i.PlanOutputPath, i.PlanOutputFormat, rel, resources, skippedResources, toBeAdopted, i.deployPlanOptions()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := i.cfg.waitForReleaseDependencies(ctx, chrt, i.ReleaseDependencies, i.Namespace, i.Timeout); err != nil {
+		return nil, err
+	}
+
+	if i.CreateNamespace && i.ClusterScoped {
+		i.cfg.Log("release is cluster-scoped, not creating namespace %q", i.Namespace)
+	} else if i.CreateNamespace {
 		ns := &v1.Namespace{
 			TypeMeta: metav1.TypeMeta{
 				APIVersion: "v1",
@@ -417,8 +713,13 @@ func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals ma
 	}
 
 	// Store the release in history before continuing (new in Helm 3). We always know
-	// that this is a create operation.
-	if err := i.cfg.Releases.Create(rel); err != nil {
+	// that this is a create operation. A replaced release fails if another deploy
+	// takes the computed revision concurrently.
+	createRelease := i.cfg.Releases.Create
+	if i.Replace {
+		createRelease = i.cfg.Releases.CreateRevision
+	}
+	if err := createRelease(rel); err != nil {
 		// We could try to recover gracefully here, but since nothing has been installed
 		// yet, this is probably safer than trying to continue when we know storage is
 		// not working.
@@ -426,33 +727,21 @@ func (i *Install) RunWithContext(ctx context.Context, chrt *chart.Chart, vals ma
 	}
 
 	var createdToCleanup kube.ResourceList
-	rel, createdToCleanup, err = i.performInstallCtx(ctx, rel, toBeAdopted, resources)
+	rel, createdToCleanup, err = i.performInstallCtx(ctx, rel, toBeAdopted, resources, skippedResources)
 	if err != nil {
 		rel, err = i.failRelease(rel, createdToCleanup, err)
 	}
 	return rel, err
 }
 
-func (i *Install) performInstallCtx(ctx context.Context, rel *release.Release, toBeAdopted kube.ResourceList, resources kube.ResourceList) (*release.Release, kube.ResourceList, error) {
-	type Msg struct {
-		r *release.Release
-		e error
-
-		createdToCleanup kube.ResourceList
-	}
-	resultChan := make(chan Msg, 1)
-
-	go func() {
-		rel, createdToCleanup, err := i.performInstall(rel, toBeAdopted, resources)
-		resultChan <- Msg{rel, err, createdToCleanup}
-	}()
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		return rel, nil, err
-	case msg := <-resultChan:
-		return msg.r, msg.createdToCleanup, msg.e
+// performInstallCtx performs the install with the kube client bound to ctx, so
+// the install is stopped rather than left running when ctx is done.
+func (i *Install) performInstallCtx(ctx context.Context, rel *release.Release, toBeAdopted, resources, skippedResources kube.ResourceList) (*release.Release, kube.ResourceList, error) {
+	rel, createdToCleanup, err := i.performInstall(rel, toBeAdopted, resources, skippedResources)
+	if err != nil && ctx.Err() != nil {
+		return rel, createdToCleanup, ctx.Err()
 	}
+	return rel, createdToCleanup, err
 }
 
 // isDryRun returns true if Upgrade is set to run as a DryRun
@@ -463,50 +752,106 @@ func (i *Install) isDryRun() bool {
 	return false
 }
 
-func (i *Install) performInstall(rel *release.Release, toBeAdopted kube.ResourceList, resources kube.ResourceList) (*release.Release, kube.ResourceList, error) {
+func (i *Install) performInstall(rel *release.Release, toBeAdopted, resources, skippedResources kube.ResourceList) (*release.Release, kube.ResourceList, error) {
 	var err error
 	// pre-install hooks
 	if !i.DisableHooks {
-		if err := i.cfg.execHook(rel, release.HookPreInstall, i.Timeout); err != nil {
+		if err := i.DeployExtender.BeforePhase(rel, release.PhaseHooksPre); err != nil {
+			return rel, nil, messages.Errorf(messages.ExecutorBeforeHooks, release.HookPreInstall, err)
+		}
+		i.progress.PhaseStarted(rel, release.PhaseHooksPre)
+		i.metrics.phaseStarted(release.PhaseHooksPre)
+		err := i.cfg.execHook(rel, release.HookPreInstall, i.Timeout, i.HooksTimeout, i.HooksConcurrency, i.HooksMaxFailures)
+		i.progress.HooksFinished(rel, release.HookPreInstall)
+		if err != nil {
 			return rel, nil, fmt.Errorf("failed pre-install: %s", err)
 		}
 	}
 
 	history, err := i.cfg.Releases.HistoryUntilRevision(rel.Name, rel.Version)
 	if err != nil {
-		return rel, nil, fmt.Errorf("error getting release history: %w", err)
+		return rel, nil, messages.Errorf(messages.ExecutorGetReleaseHistory, err)
+	}
+
+	if err := i.DeployExtender.BeforePlan(rel, resources); err != nil {
+		return rel, nil, messages.Errorf(messages.ExecutorBeforePlanningRollout, err)
 	}
 
 	rolloutPhase, err := phases.NewRolloutPhase(rel, i.StagesSplitter, i.cfg.KubeClient).
 		ParseStages(resources)
 	if err != nil {
-		return rel, nil, fmt.Errorf("error parsing stages for rollout phase: %w", err)
+		return rel, nil, messages.Errorf(messages.ExecutorParseStages, err)
 	}
+	rolloutPhase.SkipResources(skippedResources)
 
 	if err := rolloutPhase.GenerateStagesExternalDeps(i.StagesExternalDepsGenerator); err != nil {
-		return rel, nil, fmt.Errorf("error generating external deps for rollout phase: %w", err)
+		return rel, nil, messages.Errorf(messages.ExecutorGenerateExternalDependencies, err)
+	}
+
+	if err := i.DeployExtender.AfterPlan(rel, rolloutPhase.SortedStages); err != nil {
+		return rel, nil, messages.Errorf(messages.ExecutorAfterPlanningRollout, err)
 	}
 
 	deployedResourcesCalculator := phases.NewDeployedResourcesCalculator(history, i.StagesSplitter, i.cfg.KubeClient)
 
 	rolloutPhaseManager, err := phasemanagers.NewRolloutPhaseManager(rolloutPhase, deployedResourcesCalculator, rel, i.cfg.Releases, i.cfg.KubeClient).
 		AddPreviouslyDeployedResources(toBeAdopted).
+		WithAPIUnavailabilityBudget(i.APIUnavailabilityBudget, i.cfg.Log).
+		WithWarn(i.cfg.warn).
+		WithImmutableGenerationsToKeep(i.ImmutableGenerationsToKeep).
+		WithPrunePolicy(phases.PrunePolicy(i.PrunePolicy)).
+		WithUnsupportedResources(i.untrackedResources).
+		WithDeployReport(i.deployReport).
+		WithProgressStream(i.progress).
 		AddCalculatedPreviouslyDeployedResources()
 	if err != nil {
-		return rel, nil, fmt.Errorf("error calculating previously deployed resources for rollout phase manager: %w", err)
+		return rel, nil, messages.Errorf(messages.ExecutorCalculatePreviouslyDeployed, err)
+	}
+
+	if err := i.DeployExtender.BeforePhase(rel, release.PhaseRollout); err != nil {
+		return rel, nil, messages.Errorf(messages.ExecutorBeforeRollout, err)
+	}
+	i.progress.PhaseStarted(rel, release.PhaseRollout)
+	i.metrics.phaseStarted(release.PhaseRollout)
+
+	if err := i.cfg.checkCRDStoredVersions(rolloutPhase.SortedStages.MergedDesiredResources(), i.MigrateCRDStoredVersions); err != nil {
+		return rel, nil, messages.Errorf(messages.ExecutorCheckStoredVersions, err)
 	}
 
-	if err := rolloutPhaseManager.DoStage(
+	restorePodDisruptionBudgets := func() {}
+	if i.RelaxPodDisruptionBudgets {
+		restore, err := i.cfg.relaxPodDisruptionBudgets(rolloutPhase.SortedStages.MergedDesiredResources(), i.deployReport)
+		if err != nil {
+			return rel, nil, messages.Errorf(messages.ExecutorRelaxPodDisruptionBudgets, err)
+		}
+		restorePodDisruptionBudgets = restore
+	}
+
+	var eventsWatcher *kube.EventsWatcher
+	if i.WatchEvents {
+		eventsWatcher = i.cfg.startEventsWatcher(rel.Namespace, rolloutPhase.SortedStages)
+		defer eventsWatcher.Stop()
+	}
+
+	err = rolloutPhaseManager.DoStage(
 		func(stgIndex int, stage *stages.Stage) error {
+			// Deploy dependencies with the "ready" state or a condition are awaited even if waiting is disabled.
+			if len(stage.ReadyDependencies) > 0 {
+				if err := i.cfg.KubeClient.WaitWithJobs(stage.ReadyDependencies, i.Timeout); err != nil {
+					return messages.Errorf(messages.ExecutorWaitForDependencies, err)
+				}
+			}
+			if len(stage.ConditionDependencies) > 0 {
+				if err := i.cfg.waitForConditionDependencies(stage.ConditionDependencies, i.Timeout); err != nil {
+					return err
+				}
+			}
+
 			if len(stage.ExternalDependencies) == 0 || !i.Wait {
 				return nil
 			}
 
-			if i.WaitForJobs {
-				return i.cfg.KubeClient.WaitWithJobs(stage.ExternalDependencies.AsResourceList(), i.Timeout)
-			} else {
-				return i.cfg.KubeClient.Wait(stage.ExternalDependencies.AsResourceList(), i.Timeout)
-			}
+			return i.cfg.waitForExternalDependencies(stage.ExternalDependencies, i.WaitForJobs, i.Timeout)
 		},
 		func(stgIndex int, stage *stages.Stage, prevDeployedStgResources kube.ResourceList) error {
 			// At this point, we can do the install. Note that before we were detecting whether to
@@ -531,24 +876,49 @@ func (i *Install) performInstall(rel *release.Release, toBeAdopted kube.Resource
 			return nil
 		},
 		func(stgIndex int, stage *stages.Stage) error {
+			if stage.CanaryStep > 0 {
+				return i.cfg.verifyCanaries(rel, stage, !i.DisableHooks, i.Timeout, i.HooksTimeout, i.HooksConcurrency, i.HooksMaxFailures)
+			}
+
+			if i.VerifyCronJobs {
+				if err := i.cfg.verifyCronJobs(stage.DesiredResources); err != nil {
+					return err
+				}
+			}
+
 			if !i.Wait {
 				return nil
 			}
 
+			tracked, err := kube.TrackedResources(stage.DesiredResources)
+			if err != nil || len(tracked) == 0 {
+				return err
+			}
+
+			if i.WaitForOwnedResources {
+				if kubeClient, ok := i.cfg.KubeClient.(kube.InterfaceWaitOwned); ok {
+					return kubeClient.WaitWithOwned(tracked, i.WaitForJobs, i.Timeout)
+				}
+			}
+
 			if i.WaitForJobs {
-				return i.cfg.KubeClient.WaitWithJobs(stage.DesiredResources, i.Timeout)
+				return i.cfg.KubeClient.WaitWithJobs(tracked, i.Timeout)
 			} else {
-				return i.cfg.KubeClient.Wait(stage.DesiredResources, i.Timeout)
+				return i.cfg.KubeClient.Wait(tracked, i.Timeout)
 			}
 		},
-	); err != nil {
+	)
+	restorePodDisruptionBudgets()
+	if err != nil {
+		err = eventsWatcher.WrapError(err)
+
 		createdResourcesToDelete := kube.ResourceList{}
 		var applyErr *phasemanagers.ApplyError
 		if errors.As(err, &applyErr) {
 			createdResourcesToDelete = rolloutPhaseManager.Phase.SortedStages[applyErr.StageIndex].Result.Created
 		}
 
-		return rel, createdResourcesToDelete, fmt.Errorf("error processing rollout phase stage: %w", err)
+		return rel, createdResourcesToDelete, messages.Errorf(messages.ExecutorProcessStage, err)
 	}
 
 	if err := rolloutPhaseManager.DeleteOrphanedResources(); err != nil {
@@ -556,7 +926,14 @@ func (i *Install) performInstall(rel *release.Release, toBeAdopted kube.Resource
 	}
 
 	if !i.DisableHooks {
-		if err := i.cfg.execHook(rel, release.HookPostInstall, i.Timeout); err != nil {
+		if err := i.DeployExtender.BeforePhase(rel, release.PhaseHooksPost); err != nil {
+			return rel, nil, messages.Errorf(messages.ExecutorBeforeHooks, release.HookPostInstall, err)
+		}
+		i.progress.PhaseStarted(rel, release.PhaseHooksPost)
+		i.metrics.phaseStarted(release.PhaseHooksPost)
+		err := i.cfg.execHook(rel, release.HookPostInstall, i.Timeout, i.HooksTimeout, i.HooksConcurrency, i.HooksMaxFailures)
+		i.progress.HooksFinished(rel, release.HookPostInstall)
+		if err != nil {
 			return rel, nil, fmt.Errorf("failed post-install: %s", err)
 		}
 	}
@@ -584,9 +961,12 @@ func (i *Install) performInstall(rel *release.Release, toBeAdopted kube.Resource
 func (i *Install) failRelease(rel *release.Release, createdToCleanup kube.ResourceList, err error) (*release.Release, error) {
 	rel.SetStatus(release.StatusFailed, fmt.Sprintf("Release %q failed: %s", i.ReleaseName, err.Error()))
 
+	// The cleanup is done even if the install was cancelled.
+	cfg := i.cfg.withContext(context.Background())
+
 	if i.CleanupOnFail && len(createdToCleanup) > 0 {
 		i.cfg.Log("Cleanup on fail set, cleaning up %d resources", len(createdToCleanup))
-		_, errs := i.cfg.KubeClient.Delete(createdToCleanup, kube.DeleteOptions{
+		_, errs := cfg.KubeClient.Delete(createdToCleanup, kube.DeleteOptions{
 			Wait:                   true,
 			WaitTimeout:            i.Timeout,
 			SkipIfInvalidOwnership: true,
@@ -605,14 +985,14 @@ func (i *Install) failRelease(rel *release.Release, createdToCleanup kube.Resour
 
 	if i.Atomic {
 		i.cfg.Log("Install failed and atomic is set, uninstalling release")
-		uninstall := NewUninstall(i.cfg, i.StagesSplitter)
+		uninstall := NewUninstall(cfg, i.StagesSplitter)
 		uninstall.DisableHooks = i.DisableHooks
 		uninstall.KeepHistory = false
 		uninstall.Timeout = i.Timeout
 		if _, uninstallErr := uninstall.Run(i.ReleaseName); uninstallErr != nil {
 			return rel, errors.Wrapf(uninstallErr, "an error occurred while uninstalling the release. original install error: %s", err)
 		}
-		return rel, errors.Wrapf(err, "release %s failed, and has been uninstalled due to atomic being set", i.ReleaseName)
+		return rel, newDeployError(DeployResultRolledBack, errors.Wrapf(err, "release %s failed, and has been uninstalled due to atomic being set", i.ReleaseName))
 	}
 	i.recordRelease(rel) // Ignore the error, since we have another error to deal with.
 	return rel, err
@@ -663,8 +1043,9 @@ func (i *Install) createRelease(chrt *chart.Chart, rawVals map[string]interface{
 			LastDeployed:  ts,
 			Status:        release.StatusUnknown,
 		},
-		Version: 1,
-		Labels:  labels,
+		Version:  1,
+		Labels:   labels,
+		Metadata: i.Metadata,
 	})
 }
 
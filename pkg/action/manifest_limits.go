@@ -0,0 +1,76 @@
+package action
+
+import (
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+)
+
+// ManifestLimits are the guardrails enforced on the rendered manifests of a
+// release, hooks included. Zero values disable the corresponding limit.
+type ManifestLimits struct {
+	// MaxResources is the maximum number of resources in the release.
+	MaxResources int
+	// MaxManifestSize is the maximum size of a single resource manifest in bytes.
+	MaxManifestSize int
+	// MaxTotalManifestSize is the maximum size of all manifests in bytes.
+	MaxTotalManifestSize int
+}
+
+// check returns an error if the rendered manifest and hooks exceed the limits.
+func (l ManifestLimits) check(manifest string, hooks []*release.Hook) error {
+	if l == (ManifestLimits{}) {
+		return nil
+	}
+
+	type document struct {
+		description string
+		size        int
+	}
+
+	splitManifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(splitManifests))
+	for k := range splitManifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var docs []document
+	for _, k := range keys {
+		content := splitManifests[k]
+
+		description := "resource"
+		var head releaseutil.SimpleHead
+		if err := yaml.Unmarshal([]byte(content), &head); err == nil && head.Metadata != nil {
+			description = fmt.Sprintf("%s %q", head.Kind, head.Metadata.Name)
+		}
+
+		docs = append(docs, document{description: description, size: len(content)})
+	}
+	for _, h := range hooks {
+		docs = append(docs, document{description: fmt.Sprintf("hook %s %q (%s)", h.Kind, h.Name, h.Path), size: len(h.Manifest)})
+	}
+
+	if l.MaxResources > 0 && len(docs) > l.MaxResources {
+		return messages.Errorf(messages.ValidationMaxResources, len(docs), l.MaxResources)
+	}
+
+	var total int
+	for _, doc := range docs {
+		if l.MaxManifestSize > 0 && doc.size > l.MaxManifestSize {
+			return messages.Errorf(messages.ValidationMaxManifestSize, doc.description, doc.size, l.MaxManifestSize)
+		}
+		total += doc.size
+	}
+
+	if l.MaxTotalManifestSize > 0 && total > l.MaxTotalManifestSize {
+		return messages.Errorf(messages.ValidationMaxTotalManifestSize, total, l.MaxTotalManifestSize)
+	}
+
+	return nil
+}
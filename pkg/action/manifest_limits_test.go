@@ -0,0 +1,78 @@
+package action
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestManifestLimitsCheck(t *testing.T) {
+	manifest := `---
+# Source: hello/templates/cm.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: small
+---
+# Source: hello/templates/big.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: big
+data:
+  key: 0123456789012345678901234567890123456789
+`
+	hooks := []*release.Hook{{
+		Name:     "job",
+		Kind:     "Job",
+		Path:     "hello/templates/job.yaml",
+		Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: job\n",
+	}}
+
+	tests := []struct {
+		name   string
+		limits ManifestLimits
+		err    string
+	}{
+		{
+			name: "no limits",
+		},
+		{
+			name:   "within limits",
+			limits: ManifestLimits{MaxResources: 3, MaxManifestSize: 200, MaxTotalManifestSize: 1000},
+		},
+		{
+			name:   "too many resources",
+			limits: ManifestLimits{MaxResources: 2},
+			err:    "release has 3 resources including hooks, which exceeds the limit of 2 resources",
+		},
+		{
+			name:   "manifest too large",
+			limits: ManifestLimits{MaxManifestSize: 100},
+			err:    `manifest of ConfigMap "big" is 142 bytes, which exceeds the limit of 100 bytes per manifest`,
+		},
+		{
+			name:   "first manifest exceeding the limit is reported",
+			limits: ManifestLimits{MaxManifestSize: 50},
+			err:    `manifest of ConfigMap "small" is 89 bytes, which exceeds the limit of 50 bytes per manifest`,
+		},
+		{
+			name:   "total too large",
+			limits: ManifestLimits{MaxTotalManifestSize: 250},
+			err:    "manifests of the release are 284 bytes in total, which exceeds the limit of 250 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.check(manifest, hooks)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
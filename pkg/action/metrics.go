@@ -0,0 +1,142 @@
+package action
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+const metricsNamespace = "helm_deploy"
+
+// Metrics records the Prometheus metrics of the installs, upgrades and
+// rollbacks made with a Configuration: their number by status, the duration
+// of their phases, the number of the resources they create, update and delete
+// and the duration of their hooks. The rollbacks, including the automatic
+// ones of the failed upgrades, are the deploys with the "rollback" operation.
+//
+// The metrics are registered in Registry, to be served or pushed to a
+// Pushgateway with Push at the end of the run.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	deploys       *prometheus.CounterVec
+	phaseDuration *prometheus.HistogramVec
+	resources     *prometheus.CounterVec
+	hookDuration  *prometheus.HistogramVec
+}
+
+// NewMetrics creates the Metrics in a new registry.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		deploys: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "total",
+			Help:      "Number of the finished deploys of the release by operation and resulting status.",
+		}, []string{"name", "namespace", "operation", "status"}),
+		phaseDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "phase_duration_seconds",
+			Help:      "Duration of the phases of the deploys of the release.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}, []string{"name", "namespace", "operation", "phase"}),
+		resources: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "resources_total",
+			Help:      "Number of the resources of the release by the operation on them, e.g. created, updated or deleted, and its status.",
+		}, []string{"name", "namespace", "operation", "resource_operation", "status"}),
+		hookDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "hook_duration_seconds",
+			Help:      "Duration of the hooks of the deploys of the release.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}, []string{"name", "namespace", "operation", "phase", "status"}),
+	}
+	m.Registry.MustRegister(m.deploys, m.phaseDuration, m.resources, m.hookDuration)
+
+	return m
+}
+
+// Push pushes the metrics to the Pushgateway at url, replacing the metrics of
+// the job.
+func (m *Metrics) Push(url, job string) error {
+	if err := push.New(url, job).Gatherer(m.Registry).Push(); err != nil {
+		return errors.Wrapf(err, "unable to push metrics to %s", url)
+	}
+
+	return nil
+}
+
+// deployMetrics records the metrics of a deploy. A nil deployMetrics, the one
+// of a Configuration without Metrics, records nothing.
+type deployMetrics struct {
+	metrics   *Metrics
+	operation string
+	rel       *release.Release
+
+	phase      release.Phase
+	phaseStart time.Time
+}
+
+// startDeploy starts recording the metrics of the deploy of the release with
+// the operation, "install", "upgrade" or "rollback".
+func (m *Metrics) startDeploy(operation string, rel *release.Release) *deployMetrics {
+	if m == nil {
+		return nil
+	}
+
+	return &deployMetrics{metrics: m, operation: operation, rel: rel}
+}
+
+// phaseStarted ends the current phase of the deploy, if any, and starts the
+// next one.
+func (d *deployMetrics) phaseStarted(phase release.Phase) {
+	if d == nil {
+		return
+	}
+
+	d.endPhase()
+	d.phase = phase
+	d.phaseStart = time.Now()
+}
+
+func (d *deployMetrics) endPhase() {
+	if d.phase == "" {
+		return
+	}
+
+	d.metrics.phaseDuration.
+		WithLabelValues(d.rel.Name, d.rel.Namespace, d.operation, string(d.phase)).
+		Observe(time.Since(d.phaseStart).Seconds())
+	d.phase = ""
+}
+
+// finish ends the deploy, taking its status, resources and hooks from the
+// report.
+func (d *deployMetrics) finish(report *release.DeployReport) {
+	if d == nil {
+		return
+	}
+
+	d.endPhase()
+	d.metrics.deploys.WithLabelValues(d.rel.Name, d.rel.Namespace, d.operation, string(report.Status)).Inc()
+
+	for _, res := range report.Resources {
+		if res.Operation != release.ResourceOperationHook {
+			d.metrics.resources.WithLabelValues(d.rel.Name, d.rel.Namespace, d.operation, string(res.Operation), string(res.Status)).Inc()
+			continue
+		}
+
+		duration, err := time.ParseDuration(res.Duration)
+		if err != nil {
+			continue
+		}
+		d.metrics.hookDuration.
+			WithLabelValues(d.rel.Name, d.rel.Namespace, d.operation, string(res.Phase), string(res.Status)).
+			Observe(duration.Seconds())
+	}
+}
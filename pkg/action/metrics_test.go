@@ -0,0 +1,39 @@
+package action
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestDeployMetrics(t *testing.T) {
+	is := assert.New(t)
+
+	var unset *Metrics
+	is.Nil(unset.startDeploy("upgrade", namedReleaseStub("backend", release.StatusDeployed)), "nothing is recorded without metrics")
+
+	metrics := NewMetrics()
+	rel := namedReleaseStub("backend", release.StatusDeployed)
+	deploy := metrics.startDeploy("upgrade", rel)
+	deploy.phaseStarted(release.PhaseHooksPre)
+	deploy.phaseStarted(release.PhaseRollout)
+
+	report := release.NewDeployReport()
+	report.Status = release.StatusDeployed
+	report.AddResources(
+		&release.ResourceReport{Kind: "Deployment", Name: "api", Operation: release.ResourceOperationUpdate, Phase: release.PhaseRollout, Status: release.ResourceStatusSucceeded},
+		&release.ResourceReport{Kind: "Service", Name: "api", Operation: release.ResourceOperationCreate, Phase: release.PhaseRollout, Status: release.ResourceStatusSucceeded},
+		&release.ResourceReport{Kind: "ConfigMap", Name: "old", Operation: release.ResourceOperationDelete, Phase: release.PhaseRollout, Status: release.ResourceStatusSucceeded},
+		&release.ResourceReport{Kind: "Job", Name: "migrate", Operation: release.ResourceOperationHook, Phase: release.PhaseHooksPre, Duration: "12s", Status: release.ResourceStatusSucceeded},
+	)
+	deploy.finish(report)
+
+	is.Equal(1.0, testutil.ToFloat64(metrics.deploys.WithLabelValues("backend", rel.Namespace, "upgrade", "deployed")))
+	is.Equal(1.0, testutil.ToFloat64(metrics.resources.WithLabelValues("backend", rel.Namespace, "upgrade", "update", "succeeded")))
+	is.Equal(1.0, testutil.ToFloat64(metrics.resources.WithLabelValues("backend", rel.Namespace, "upgrade", "delete", "succeeded")))
+	is.Equal(2, testutil.CollectAndCount(metrics.phaseDuration), "pre hooks and rollout phases are observed")
+	is.Equal(1, testutil.CollectAndCount(metrics.hookDuration))
+}
@@ -0,0 +1,284 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+// notifyTimeout is the timeout of a single notification, a notifier being
+// down must not hold the deploy.
+const notifyTimeout = 10 * time.Second
+
+// DeployEvent is an event of the lifecycle of a deploy.
+type DeployEvent string
+
+const (
+	DeployEventStarted   DeployEvent = "started"
+	DeployEventSucceeded DeployEvent = "succeeded"
+	DeployEventFailed    DeployEvent = "failed"
+	// DeployEventRolledBack is the success of a rollback, including the
+	// automatic one of a failed upgrade.
+	DeployEventRolledBack DeployEvent = "rolled-back"
+)
+
+// DeployNotification is the notification of an event of a deploy.
+type DeployNotification struct {
+	Event DeployEvent `json:"event"`
+	// Operation is "install", "upgrade" or "rollback".
+	Operation string         `json:"operation"`
+	Release   string         `json:"release"`
+	Namespace string         `json:"namespace"`
+	Revision  int            `json:"revision"`
+	Status    release.Status `json:"status"`
+	// ReportURL is the link to the deploy report, if the deploy has one.
+	ReportURL string `json:"report_url,omitempty"`
+	// Report is the deploy report of the finished deploys, for the templates.
+	Report *release.DeployReport `json:"-"`
+}
+
+// Notifier is notified of the events of the deploys, e.g. to post them to a
+// chat or to a webhook.
+type Notifier interface {
+	Notify(ctx context.Context, notification *DeployNotification) error
+}
+
+// WebhookNotifier posts the notifications to a URL, as JSON or rendered with
+// Template.
+type WebhookNotifier struct {
+	URL string
+	// Template renders the body of the request from the DeployNotification.
+	// The body is the DeployNotification as JSON if it is nil.
+	Template    *template.Template
+	ContentType string
+	Client      *http.Client
+}
+
+// NewWebhookNotifier creates the WebhookNotifier posting to the URL with the
+// body rendered from the template, or the JSON of the notification if the
+// template is empty.
+func NewWebhookNotifier(url, tmpl string) (*WebhookNotifier, error) {
+	n := &WebhookNotifier{URL: url, ContentType: "application/json"}
+
+	if tmpl != "" {
+		t, err := parseNotificationTemplate(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		n.Template = t
+	}
+
+	return n, nil
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification *DeployNotification) error {
+	var body []byte
+	if n.Template != nil {
+		var buf bytes.Buffer
+		if err := n.Template.Execute(&buf, notification); err != nil {
+			return errors.Wrap(err, "unable to render notification")
+		}
+		body = buf.Bytes()
+	} else {
+		data, err := json.Marshal(notification)
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal notification")
+		}
+		body = data
+	}
+
+	return postNotification(ctx, n.Client, n.URL, n.ContentType, body)
+}
+
+// defaultSlackTemplate is the default message of the SlackNotifier.
+const defaultSlackTemplate = `{{ .Operation | title }} of release *{{ .Release }}* in namespace *{{ .Namespace }}*, revision {{ .Revision }}: {{ .Event }}{{ if .ReportURL }} (<{{ .ReportURL }}|report>){{ end }}`
+
+// SlackNotifier posts the notifications to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	// Template renders the text of the message from the DeployNotification.
+	Template *template.Template
+	Client   *http.Client
+}
+
+// NewSlackNotifier creates the SlackNotifier posting to the incoming webhook
+// with the message rendered from the template, or the default one if the
+// template is empty.
+func NewSlackNotifier(webhookURL, tmpl string) (*SlackNotifier, error) {
+	if tmpl == "" {
+		tmpl = defaultSlackTemplate
+	}
+
+	t, err := parseNotificationTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SlackNotifier{WebhookURL: webhookURL, Template: t}, nil
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, notification *DeployNotification) error {
+	var text bytes.Buffer
+	if err := n.Template.Execute(&text, notification); err != nil {
+		return errors.Wrap(err, "unable to render notification")
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text.String()})
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal notification")
+	}
+
+	return postNotification(ctx, n.Client, n.WebhookURL, "application/json", body)
+}
+
+func parseNotificationTemplate(tmpl string) (*template.Template, error) {
+	t, err := template.New("notification").Funcs(template.FuncMap{
+		"title": func(s string) string {
+			if s == "" {
+				return s
+			}
+			return strings.ToUpper(s[:1]) + s[1:]
+		},
+		"toJson": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse notification template")
+	}
+
+	return t, nil
+}
+
+func postNotification(ctx context.Context, client *http.Client, rawURL, contentType string, body []byte) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// The URLs of the webhooks are credentials, so the errors, which end up in
+	// the logs, only have their scheme and host.
+	redacted := redactNotificationURL(rawURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(redactURLError(err, redacted), "unable to create notification request to %s", redacted)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(redactURLError(err, redacted), "unable to post notification to %s", redacted)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unable to post notification to %s: %s: %s", redacted, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// redactNotificationURL returns the URL without its user info, path and
+// query, which hold the secrets of the webhooks, e.g. of the Slack incoming
+// webhooks.
+func redactNotificationURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "<redacted URL>"
+	}
+
+	redacted := u.Scheme + "://" + u.Host
+	if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		redacted += "/<redacted>"
+	}
+
+	return redacted
+}
+
+// redactURLError replaces the URL of the *url.Error returned by the HTTP
+// client, which quotes the whole URL.
+func redactURLError(err error, redacted string) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+
+	return &url.Error{Op: urlErr.Op, URL: redacted, Err: urlErr.Err}
+}
+
+// deployNotifier notifies the Notifiers of the events of a deploy. A nil
+// deployNotifier, the one of a deploy without Notifiers, notifies nobody.
+type deployNotifier struct {
+	cfg       *Configuration
+	notifiers []Notifier
+	operation string
+	reportURL string
+	rel       *release.Release
+}
+
+// startDeployNotifications notifies the Notifiers of the start of the deploy
+// of the release with the operation, "install", "upgrade" or "rollback".
+func startDeployNotifications(cfg *Configuration, notifiers []Notifier, reportURL, operation string, rel *release.Release) *deployNotifier {
+	if len(notifiers) == 0 {
+		return nil
+	}
+
+	d := &deployNotifier{cfg: cfg, notifiers: notifiers, operation: operation, reportURL: reportURL, rel: rel}
+	d.notify(DeployEventStarted, nil)
+
+	return d
+}
+
+// finish notifies the Notifiers of the end of the deploy, successful if the
+// release of the report is deployed.
+func (d *deployNotifier) finish(report *release.DeployReport) {
+	if d == nil {
+		return
+	}
+
+	event := DeployEventFailed
+	if report.Status == release.StatusDeployed {
+		event = DeployEventSucceeded
+		if d.operation == "rollback" {
+			event = DeployEventRolledBack
+		}
+	}
+
+	d.notify(event, report)
+}
+
+// notify notifies the Notifiers in turn. Their errors are only logged, as
+// the notifications don't change the result of the deploy.
+func (d *deployNotifier) notify(event DeployEvent, report *release.DeployReport) {
+	notification := &DeployNotification{
+		Event:     event,
+		Operation: d.operation,
+		Release:   d.rel.Name,
+		Namespace: d.rel.Namespace,
+		Revision:  d.rel.Version,
+		Status:    d.rel.Info.Status,
+		ReportURL: d.reportURL,
+		Report:    report,
+	}
+
+	for _, n := range d.notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		if err := n.Notify(ctx, notification); err != nil {
+			d.cfg.warn("error notifying of deploy %s: %s", event, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,49 @@
+package action
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/werf/3p-helm/pkg/chartutil"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+// Pin is the action for pinning a revision of a release, e.g. a known good
+// one to roll back to.
+//
+// Pinned revisions are never pruned from the history, are left as they are
+// when a rollback supersedes the deployed revisions, and are preferred by
+// Rollback.ToLastSuccessful.
+type Pin struct {
+	cfg *Configuration
+
+	// Unpin reverts the pinning of the revision.
+	Unpin bool
+}
+
+// NewPin creates a new Pin object with the given configuration.
+func NewPin(cfg *Configuration) *Pin {
+	return &Pin{
+		cfg: cfg,
+	}
+}
+
+// Run pins or unpins the revision of the release and returns the revision.
+func (p *Pin) Run(name string, version int) (*release.Release, error) {
+	if err := chartutil.ValidateReleaseName(name); err != nil {
+		return nil, errors.Errorf("release name is invalid: %s", name)
+	}
+
+	if p.Unpin {
+		p.cfg.Log("unpinning revision %d of release %s", version, name)
+		if err := p.cfg.Releases.Unpin(name, version); err != nil {
+			return nil, err
+		}
+	} else {
+		p.cfg.Log("pinning revision %d of release %s", version, name)
+		if err := p.cfg.Releases.Pin(name, version); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.cfg.Releases.Get(name, version)
+}
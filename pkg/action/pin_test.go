@@ -0,0 +1,36 @@
+package action
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestPin(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+	cfg := actionConfigFixture(t)
+
+	rel := namedReleaseStub("backend", release.StatusDeployed)
+	req.NoError(cfg.Releases.Create(rel))
+
+	pin := NewPin(cfg)
+	pinned, err := pin.Run("backend", rel.Version)
+	req.NoError(err)
+	is.True(pinned.Info.Pinned)
+
+	history, err := NewHistory(cfg).Timeline("backend")
+	req.NoError(err)
+	is.True(history.Revisions[0].Pinned)
+
+	pin.Unpin = true
+	unpinned, err := pin.Run("backend", rel.Version)
+	req.NoError(err)
+	is.False(unpinned.Info.Pinned)
+
+	_, err = pin.Run("backend", rel.Version+1)
+	is.Error(err, "a missing revision can't be pinned")
+}
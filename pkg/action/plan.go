@@ -0,0 +1,446 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	policyv1 "k8s.io/api/policy/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/phases/phasemanagers"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+)
+
+// DeployPlan is what a deploy would do. It is built the same way the deploy
+// builds it, but without changing the cluster or the release storage, so it
+// can be inspected or serialized before deploying.
+type DeployPlan struct {
+	// Release is the release that would be stored by the deploy.
+	Release *release.Release `json:"-"`
+	// Stages are the rollout phase stages with their resources and
+	// dependencies.
+	Stages stages.SortedStageList `json:"-"`
+	// Skipped are the resources not deployed because of werf.io/deploy-on or
+	// the resource selection.
+	Skipped kube.ResourceList `json:"-"`
+	// Adopted are the existing resources taken over by the release.
+	Adopted kube.ResourceList `json:"-"`
+	// Orphaned are the previously deployed resources deleted after the
+	// rollout.
+	Orphaned kube.ResourceList `json:"-"`
+	// KeptOrphans are the previously deployed resources not part of the
+	// release anymore which are kept because of the prune policy.
+	KeptOrphans kube.ResourceList `json:"-"`
+
+	ReleaseName string `json:"release"`
+	Namespace   string `json:"namespace"`
+	Revision    int    `json:"revision"`
+	// Operations are the operations of the deploy in the order they are
+	// performed.
+	Operations []*PlannedOperation `json:"operations"`
+	// Tracking is how the deployed resources are tracked, in the order they
+	// are deployed, so external runners can track them the same way.
+	Tracking []*kube.TrackingSpec `json:"tracking"`
+}
+
+// PlannedOperation is an operation of a DeployPlan.
+type PlannedOperation struct {
+	Type  release.ResourceOperation `json:"type"`
+	Phase release.Phase             `json:"phase"`
+	// Stage is the index of the rollout stage of the resource, or of the
+	// weight of the hook among the hooks of the phase, as hooks of the same
+	// weight may be executed concurrently. Orphaned resources, which are
+	// deleted or kept after all stages, and the PodDisruptionBudgets relaxed
+	// during the stages have no stage.
+	Stage *int `json:"stage,omitempty"`
+	// Weight is the weight of the rollout stage or of the hook.
+	Weight *int `json:"weight,omitempty"`
+	// RolloutPhase is the standard phase of the rollout stage, which the
+	// resources are pinned to with phases.PhaseAnnotation.
+	RolloutPhase stages.Phase `json:"rolloutPhase,omitempty"`
+	// Resource is formatted as "<namespace>:<kind>/<name>".
+	Resource string `json:"resource"`
+}
+
+func (o *PlannedOperation) String() string {
+	if o.Stage == nil {
+		return fmt.Sprintf("%s: %s %s", o.Phase, o.Type, o.Resource)
+	}
+
+	if o.RolloutPhase != "" && o.RolloutPhase != stages.PhaseRollout {
+		return fmt.Sprintf("%s stage %d (%s): %s %s", o.Phase, *o.Stage, o.RolloutPhase, o.Type, o.Resource)
+	}
+
+	return fmt.Sprintf("%s stage %d: %s %s", o.Phase, *o.Stage, o.Type, o.Resource)
+}
+
+func (p *DeployPlan) String() string {
+	var lines []string
+	for _, op := range p.Operations {
+		lines = append(lines, op.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (p *DeployPlan) ToJSONData() ([]byte, error) {
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling deploy plan: %w", err)
+	}
+
+	return data, nil
+}
+
+func (p *DeployPlan) ToYAMLData() ([]byte, error) {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling deploy plan: %w", err)
+	}
+
+	return data, nil
+}
+
+// ToData marshals the plan in the format, one of DeployPlanFormatJSON
+// (default) or DeployPlanFormatYAML.
+func (p *DeployPlan) ToData(format string) ([]byte, error) {
+	switch format {
+	case "", DeployPlanFormatJSON:
+		return p.ToJSONData()
+	case DeployPlanFormatYAML:
+		return p.ToYAMLData()
+	default:
+		return nil, ValidateDeployPlanFormat(format)
+	}
+}
+
+const (
+	DeployPlanFormatJSON = "json"
+	DeployPlanFormatYAML = "yaml"
+)
+
+func ValidateDeployPlanFormat(format string) error {
+	switch format {
+	case "", DeployPlanFormatJSON, DeployPlanFormatYAML:
+		return nil
+	default:
+		return fmt.Errorf("unsupported deploy plan format %q: expected %q or %q", format, DeployPlanFormatJSON, DeployPlanFormatYAML)
+	}
+}
+
+// writeDeployPlan builds the plan of deploying the built resources of the
+// release and writes it to the path in the format, before the deploy.
+func (cfg *Configuration) writeDeployPlan(path, format string, rel *release.Release, target, skippedTarget, toBeAdopted kube.ResourceList, opts deployPlanOptions) error {
+	plan, err := cfg.buildDeployPlan(rel, target, skippedTarget, toBeAdopted, opts)
+	if err != nil {
+		return fmt.Errorf("error building deploy plan: %w", err)
+	}
+
+	data, err := plan.ToData(format)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("error writing deploy plan file: %w", err)
+	}
+
+	return nil
+}
+
+// DeployPlanner is a deploy action whose deploy can be planned with
+// BuildDeployPlan: an Install or an Upgrade.
+type DeployPlanner interface {
+	planDeploy(ctx context.Context, name string, chart *chart.Chart, vals map[string]interface{}) (*DeployPlan, error)
+}
+
+var (
+	_ DeployPlanner = (*Install)(nil)
+	_ DeployPlanner = (*Upgrade)(nil)
+)
+
+// BuildDeployPlan renders the chart and builds the plan of deploying it as the
+// named release with the options of the Install or the Upgrade, without
+// deploying it. Nothing is applied, no hooks are run and the release is not
+// stored. The DeployExtender is not called.
+func BuildDeployPlan(ctx context.Context, planner DeployPlanner, name string, chart *chart.Chart, vals map[string]interface{}) (*DeployPlan, error) {
+	return planner.planDeploy(ctx, name, chart, vals)
+}
+
+// Plan renders the chart and builds the plan of upgrading the release to it
+// with the options of the Upgrade, see BuildDeployPlan.
+func (u *Upgrade) Plan(name string, chart *chart.Chart, vals map[string]interface{}) (*DeployPlan, error) {
+	return u.planDeploy(context.Background(), name, chart, vals)
+}
+
+func (u *Upgrade) planDeploy(ctx context.Context, name string, chart *chart.Chart, vals map[string]interface{}) (*DeployPlan, error) {
+	cfg := u.cfg
+	u.cfg = cfg.withContext(ctx)
+	defer func() { u.cfg = cfg }()
+
+	if u.ClusterScoped && u.ControlNamespace != "" {
+		u.cfg = u.cfg.withControlNamespace(u.ControlNamespace)
+	}
+
+	if err := u.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	currentRelease, upgradedRelease, err := u.prepareUpgrade(name, chart, vals)
+	if err != nil {
+		return nil, err
+	}
+
+	target, skippedTarget, toBeCreated, err := u.buildResources(currentRelease, upgradedRelease)
+	if err != nil {
+		return nil, err
+	}
+
+	toBeAdopted, err := existingResourceConflict(toBeCreated, upgradedRelease.Name, upgradedRelease.Namespace, u.cfg, u.AdoptResources)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to continue with update")
+	}
+
+	return u.cfg.buildDeployPlan(upgradedRelease, target, skippedTarget, toBeAdopted, u.deployPlanOptions())
+}
+
+func (u *Upgrade) deployPlanOptions() deployPlanOptions {
+	return deployPlanOptions{
+		StagesSplitter:              u.StagesSplitter,
+		StagesExternalDepsGenerator: u.StagesExternalDepsGenerator,
+		ImmutableGenerationsToKeep:  u.ImmutableGenerationsToKeep,
+		PrunePolicy:                 u.PrunePolicy,
+		RelaxPodDisruptionBudgets:   u.RelaxPodDisruptionBudgets,
+		DisableHooks:                u.DisableHooks,
+		PreHook:                     release.HookPreUpgrade,
+		PostHook:                    release.HookPostUpgrade,
+	}
+}
+
+// Plan renders the chart and builds the plan of installing it as the release
+// with the options of the Install, see BuildDeployPlan. The install is run as
+// a server-side dry run, so the name is checked and the existing resources are
+// found as when installing.
+func (i *Install) Plan(chrt *chart.Chart, vals map[string]interface{}) (*DeployPlan, error) {
+	return i.planDeploy(context.Background(), i.ReleaseName, chrt, vals)
+}
+
+func (i *Install) planDeploy(ctx context.Context, name string, chrt *chart.Chart, vals map[string]interface{}) (*DeployPlan, error) {
+	cfg, releaseName, dryRun, dryRunOption := i.cfg, i.ReleaseName, i.DryRun, i.DryRunOption
+	i.cfg = cfg.withContext(ctx)
+	i.ReleaseName, i.DryRun, i.DryRunOption = name, true, "server"
+	i.plan = &DeployPlan{}
+	defer func() {
+		i.cfg, i.ReleaseName, i.DryRun, i.DryRunOption = cfg, releaseName, dryRun, dryRunOption
+		i.plan = nil
+	}()
+
+	if _, err := i.run(ctx, chrt, vals); err != nil {
+		return nil, err
+	}
+
+	return i.plan, nil
+}
+
+func (i *Install) deployPlanOptions() deployPlanOptions {
+	return deployPlanOptions{
+		StagesSplitter:              i.StagesSplitter,
+		StagesExternalDepsGenerator: i.StagesExternalDepsGenerator,
+		ImmutableGenerationsToKeep:  i.ImmutableGenerationsToKeep,
+		PrunePolicy:                 i.PrunePolicy,
+		RelaxPodDisruptionBudgets:   i.RelaxPodDisruptionBudgets,
+		DisableHooks:                i.DisableHooks,
+		PreHook:                     release.HookPreInstall,
+		PostHook:                    release.HookPostInstall,
+	}
+}
+
+// deployPlanOptions are the options of the deploy action the plan is built
+// with.
+type deployPlanOptions struct {
+	StagesSplitter              phases.Splitter
+	StagesExternalDepsGenerator phases.ExternalDepsGenerator
+	ImmutableGenerationsToKeep  int
+	PrunePolicy                 string
+	RelaxPodDisruptionBudgets   bool
+	DisableHooks                bool
+	// PreHook and PostHook are the events of the hooks run before and after
+	// the rollout.
+	PreHook, PostHook release.HookEvent
+}
+
+// buildDeployPlan builds the plan of deploying the built resources of the
+// release the same way the deploy does.
+func (cfg *Configuration) buildDeployPlan(rel *release.Release, target, skippedTarget, toBeAdopted kube.ResourceList, opts deployPlanOptions) (*DeployPlan, error) {
+	// The release of an install is not stored yet, so it may have no history.
+	history, err := cfg.Releases.HistoryUntilRevision(rel.Name, rel.Version)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, messages.Errorf(messages.ExecutorGetReleaseHistory, err)
+	}
+
+	rolloutPhase, err := phases.NewRolloutPhase(rel, opts.StagesSplitter, cfg.KubeClient).
+		ParseStages(target)
+	if err != nil {
+		return nil, messages.Errorf(messages.ExecutorParseStages, err)
+	}
+	rolloutPhase.SkipResources(skippedTarget)
+
+	if err := rolloutPhase.GenerateStagesExternalDeps(opts.StagesExternalDepsGenerator); err != nil {
+		return nil, messages.Errorf(messages.ExecutorGenerateExternalDependencies, err)
+	}
+
+	deployedResourcesCalculator := phases.NewDeployedResourcesCalculator(history, opts.StagesSplitter, cfg.KubeClient)
+
+	rolloutPhaseManager, err := phasemanagers.NewRolloutPhaseManager(rolloutPhase, deployedResourcesCalculator, rel, cfg.Releases, cfg.KubeClient).
+		AddPreviouslyDeployedResources(toBeAdopted).
+		WithImmutableGenerationsToKeep(opts.ImmutableGenerationsToKeep).
+		AddCalculatedPreviouslyDeployedResources()
+	if err != nil {
+		return nil, messages.Errorf(messages.ExecutorCalculatePreviouslyDeployed, err)
+	}
+
+	orphaned, err := rolloutPhaseManager.OrphanedResources()
+	if err != nil {
+		return nil, err
+	}
+
+	pruned, kept, err := phases.SplitOrphanedResources(orphaned, phases.PrunePolicy(opts.PrunePolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &DeployPlan{
+		Release:     rel,
+		Stages:      rolloutPhase.SortedStages,
+		Skipped:     rolloutPhase.SkippedResources,
+		Adopted:     toBeAdopted,
+		Orphaned:    pruned,
+		KeptOrphans: kept,
+		ReleaseName: rel.Name,
+		Namespace:   rel.Namespace,
+		Revision:    rel.Version,
+	}
+
+	if !opts.DisableHooks {
+		plan.addHooks(opts.PreHook)
+	}
+
+	var budgets []*policyv1.PodDisruptionBudget
+	if opts.RelaxPodDisruptionBudgets {
+		clientSet, err := cfg.KubernetesClientSet()
+		if err != nil {
+			return nil, err
+		}
+		if budgets, err = podDisruptionBudgetsOf(cfg.baseContext(), clientSet, rolloutPhase.SortedStages.MergedDesiredResources()); err != nil {
+			return nil, err
+		}
+	}
+
+	plan.addPodDisruptionBudgets(budgets, release.ResourceOperationRelax)
+
+	previouslyDeployed := rolloutPhaseManager.PreviouslyDeployedResources()
+	for i, stg := range rolloutPhase.SortedStages {
+		stageIndex, weight := i, stg.Weight
+		for _, res := range stg.DesiredResources {
+			opType := release.ResourceOperationCreate
+			switch {
+			case toBeAdopted.Contains(res):
+				opType = release.ResourceOperationAdopt
+			case previouslyDeployed.Contains(res):
+				opType = release.ResourceOperationUpdate
+			}
+
+			plan.Operations = append(plan.Operations, &PlannedOperation{
+				Type:         opType,
+				Phase:        release.PhaseRollout,
+				Stage:        &stageIndex,
+				Weight:       &weight,
+				RolloutPhase: stg.Phase,
+				Resource:     kube.ResourceNameNamespaceKind(res),
+			})
+		}
+	}
+
+	plan.addPodDisruptionBudgets(budgets, release.ResourceOperationRestore)
+
+	var deployed kube.ResourceList
+	for _, stg := range rolloutPhase.SortedStages {
+		deployed = append(deployed, stg.DesiredResources...)
+	}
+	if plan.Tracking, err = kube.TrackingSpecs(deployed); err != nil {
+		return nil, err
+	}
+
+	for _, res := range pruned {
+		plan.Operations = append(plan.Operations, &PlannedOperation{
+			Type:     release.ResourceOperationDelete,
+			Phase:    release.PhaseRollout,
+			Resource: kube.ResourceNameNamespaceKind(res),
+		})
+	}
+	for _, res := range kept {
+		plan.Operations = append(plan.Operations, &PlannedOperation{
+			Type:     release.ResourceOperationKeep,
+			Phase:    release.PhaseRollout,
+			Resource: kube.ResourceNameNamespaceKind(res),
+		})
+	}
+
+	if !opts.DisableHooks {
+		plan.addHooks(opts.PostHook)
+	}
+
+	return plan, nil
+}
+
+// addHooks adds the hooks of the event in the order they are executed.
+func (p *DeployPlan) addHooks(event release.HookEvent) {
+	var hooks []*release.Hook
+	for _, h := range p.Release.Hooks {
+		for _, e := range h.Events {
+			if e == event {
+				hooks = append(hooks, h)
+			}
+		}
+	}
+	sort.Stable(hookByWeight(hooks))
+
+	stage := -1
+	for i, h := range hooks {
+		if i == 0 || h.Weight != hooks[i-1].Weight {
+			stage++
+		}
+		hookStage, weight := stage, h.Weight
+
+		p.Operations = append(p.Operations, &PlannedOperation{
+			Type:     release.ResourceOperationHook,
+			Phase:    release.PhaseFromHookEvent(event),
+			Stage:    &hookStage,
+			Weight:   &weight,
+			Resource: fmt.Sprintf("%s:%s/%s", p.Release.Namespace, h.Kind, h.Name),
+		})
+	}
+}
+
+// addPodDisruptionBudgets adds the operation, relaxing the budgets before the
+// rollout stages or restoring them after, on the budgets.
+func (p *DeployPlan) addPodDisruptionBudgets(budgets []*policyv1.PodDisruptionBudget, operation release.ResourceOperation) {
+	for _, pdb := range budgets {
+		p.Operations = append(p.Operations, &PlannedOperation{
+			Type:     operation,
+			Phase:    release.PhaseRollout,
+			Resource: podDisruptionBudgetName(pdb),
+		})
+	}
+}
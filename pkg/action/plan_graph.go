@@ -0,0 +1,249 @@
+package action
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/phases/stages/externaldeps"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+// GraphFormat is the format of the graph of a DeployPlan.
+type GraphFormat string
+
+const (
+	// GraphFormatDOT is the Graphviz DOT language.
+	GraphFormatDOT GraphFormat = "dot"
+	// GraphFormatMermaid is a Mermaid flowchart.
+	GraphFormatMermaid GraphFormat = "mermaid"
+)
+
+// planGraph is a DeployPlan as a graph. Operations of the same phase and
+// stage are grouped, and groups are connected in the order they are performed.
+type planGraph struct {
+	groups   []*planGraphGroup
+	external []*planGraphNode
+	edges    []*planGraphEdge
+}
+
+type planGraphGroup struct {
+	id    string
+	label string
+	nodes []*planGraphNode
+}
+
+type planGraphNode struct {
+	id    string
+	label string
+}
+
+// planGraphEdge connects nodes or groups.
+type planGraphEdge struct {
+	from, to string
+	label    string
+	// dashed edges are the dependencies detected from the specs of the
+	// resources.
+	dashed bool
+}
+
+// ExportGraph returns the graph of the plan in the format, to show why the
+// resources are deployed in the order they are. The operations are grouped by
+// the hooks weight or the rollout stage they are performed in, and the groups
+// are connected in order. Edges between the resources are their deploy
+// dependencies, dashed if detected rather than annotated, and the external
+// dependencies are connected to the stages waiting for them.
+func (p *DeployPlan) ExportGraph(format GraphFormat) (string, error) {
+	graph, err := p.graph()
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case GraphFormatDOT:
+		return graph.dot(p.ReleaseName), nil
+	case GraphFormatMermaid:
+		return graph.mermaid(), nil
+	default:
+		return "", fmt.Errorf("unknown graph format %q: expected %q or %q", format, GraphFormatDOT, GraphFormatMermaid)
+	}
+}
+
+func (p *DeployPlan) graph() (*planGraph, error) {
+	graph := &planGraph{}
+
+	groups := map[string]*planGraphGroup{}
+	rolloutGroups := map[int]*planGraphGroup{}
+	rolloutNodes := map[string]string{}
+	for i, op := range p.Operations {
+		key := string(op.Phase)
+		label := fmt.Sprintf("%s cleanup", op.Phase)
+		if op.Stage != nil {
+			key = fmt.Sprintf("%s/%d", op.Phase, *op.Stage)
+			label = fmt.Sprintf("%s stage %d", op.Phase, *op.Stage)
+			if op.RolloutPhase != "" && op.RolloutPhase != stages.PhaseRollout {
+				label = fmt.Sprintf("%s (%s)", label, op.RolloutPhase)
+			}
+			if op.Weight != nil {
+				label = fmt.Sprintf("%s, weight %d", label, *op.Weight)
+			}
+		} else if op.Type == release.ResourceOperationRelax || op.Type == release.ResourceOperationRestore {
+			key = fmt.Sprintf("%s/%s", op.Phase, op.Type)
+			label = fmt.Sprintf("%s %s PodDisruptionBudgets", op.Phase, op.Type)
+		}
+
+		group, found := groups[key]
+		if !found {
+			group = &planGraphGroup{id: fmt.Sprintf("g%d", len(graph.groups)), label: label}
+			groups[key] = group
+			graph.groups = append(graph.groups, group)
+			if op.Phase == release.PhaseRollout && op.Stage != nil {
+				rolloutGroups[*op.Stage] = group
+			}
+		}
+
+		node := &planGraphNode{id: fmt.Sprintf("n%d", i), label: fmt.Sprintf("%s %s", op.Type, op.Resource)}
+		group.nodes = append(group.nodes, node)
+		if op.Phase == release.PhaseRollout && op.Stage != nil {
+			rolloutNodes[op.Resource] = node.id
+		}
+	}
+
+	for i := 1; i < len(graph.groups); i++ {
+		graph.edges = append(graph.edges, &planGraphEdge{from: graph.groups[i-1].id, to: graph.groups[i].id})
+	}
+
+	deps, err := phases.DeployDependencies(p.Stages)
+	if err != nil {
+		return nil, err
+	}
+	for _, dep := range deps {
+		from, to := rolloutNodes[kube.ResourceNameNamespaceKind(dep.Target)], rolloutNodes[kube.ResourceNameNamespaceKind(dep.Dependent)]
+		if from == "" || to == "" {
+			continue
+		}
+
+		graph.edges = append(graph.edges, &planGraphEdge{from: from, to: to, label: string(dep.State), dashed: dep.Detected})
+	}
+
+	for i, stg := range p.Stages {
+		group, found := rolloutGroups[i]
+		if !found {
+			continue
+		}
+
+		for _, dep := range stg.ExternalDependencies {
+			node := &planGraphNode{id: fmt.Sprintf("e%d", len(graph.external)), label: externalDependencyLabel(dep)}
+			graph.external = append(graph.external, node)
+			graph.edges = append(graph.edges, &planGraphEdge{from: node.id, to: group.id, label: "ready"})
+		}
+	}
+
+	return graph, nil
+}
+
+func externalDependencyLabel(dep *externaldeps.ExternalDependency) string {
+	target := dep.ResourceType + "/" + dep.ResourceName
+	if dep.IsSelector() {
+		target = fmt.Sprintf("%d of %s %s", dep.MinReady, dep.ResourceType, dep.Selector)
+	}
+	if dep.Namespace != "" {
+		target = dep.Namespace + ":" + target
+	}
+
+	return fmt.Sprintf("external %s %s", dep.Name, target)
+}
+
+// dot returns the graph in the DOT language. As edges can't connect clusters,
+// edges of groups connect their first nodes clipped to the clusters.
+func (g *planGraph) dot(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(name))
+	b.WriteString("\tcompound=true;\n")
+	b.WriteString("\tnode [shape=box];\n")
+
+	firstNodes := map[string]string{}
+	for _, group := range g.groups {
+		firstNodes[group.id] = group.nodes[0].id
+
+		fmt.Fprintf(&b, "\tsubgraph %s {\n", strconv.Quote("cluster_"+group.id))
+		fmt.Fprintf(&b, "\t\tlabel=%s;\n", strconv.Quote(group.label))
+		for _, node := range group.nodes {
+			fmt.Fprintf(&b, "\t\t%s [label=%s];\n", strconv.Quote(node.id), strconv.Quote(node.label))
+		}
+		b.WriteString("\t}\n")
+	}
+
+	for _, node := range g.external {
+		fmt.Fprintf(&b, "\t%s [label=%s, shape=ellipse];\n", strconv.Quote(node.id), strconv.Quote(node.label))
+	}
+
+	for _, edge := range g.edges {
+		from, to := edge.from, edge.to
+		var attrs []string
+		if first, isGroup := firstNodes[from]; isGroup {
+			from = first
+			attrs = append(attrs, "ltail="+strconv.Quote("cluster_"+edge.from))
+		}
+		if first, isGroup := firstNodes[to]; isGroup {
+			to = first
+			attrs = append(attrs, "lhead="+strconv.Quote("cluster_"+edge.to))
+		}
+		if edge.label != "" {
+			attrs = append(attrs, "label="+strconv.Quote(edge.label))
+		}
+		if edge.dashed {
+			attrs = append(attrs, "style=dashed")
+		}
+
+		fmt.Fprintf(&b, "\t%s -> %s", strconv.Quote(from), strconv.Quote(to))
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// mermaid returns the graph as a Mermaid flowchart.
+func (g *planGraph) mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+
+	for _, group := range g.groups {
+		fmt.Fprintf(&b, "\tsubgraph %s[%s]\n", group.id, mermaidText(group.label))
+		for _, node := range group.nodes {
+			fmt.Fprintf(&b, "\t\t%s[%s]\n", node.id, mermaidText(node.label))
+		}
+		b.WriteString("\tend\n")
+	}
+
+	for _, node := range g.external {
+		fmt.Fprintf(&b, "\t%s([%s])\n", node.id, mermaidText(node.label))
+	}
+
+	for _, edge := range g.edges {
+		arrow := "-->"
+		if edge.dashed {
+			arrow = "-.->"
+		}
+		if edge.label != "" {
+			arrow += "|" + mermaidText(edge.label) + "|"
+		}
+
+		fmt.Fprintf(&b, "\t%s %s %s\n", edge.from, arrow, edge.to)
+	}
+
+	return b.String()
+}
+
+// mermaidText quotes the text, which can't contain quotes otherwise.
+func mermaidText(text string) string {
+	return `"` + strings.ReplaceAll(text, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,131 @@
+package action
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/phases/stages/externaldeps"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func graphTestPlan() *DeployPlan {
+	info := func(obj map[string]interface{}) *resource.Info {
+		u := &unstructured.Unstructured{Object: obj}
+		return &resource.Info{Name: u.GetName(), Namespace: "myns", Object: u}
+	}
+	credentials := info(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "credentials"},
+	})
+	serviceAccount := info(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ServiceAccount",
+		"metadata":   map[string]interface{}{"name": "app"},
+	})
+	deployment := info(map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name": "app",
+			"annotations": map[string]interface{}{
+				"werf.io/deploy-dependency-credentials": "v1:Secret:credentials,state=ready",
+				"werf.io/detect-deploy-dependencies":    "true",
+			},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"serviceAccountName": "app"},
+			},
+		},
+	})
+
+	db := externaldeps.NewExternalDependency("db", "statefulset", "postgres")
+	db.Namespace = "data"
+
+	intPtr := func(i int) *int { return &i }
+	return &DeployPlan{
+		ReleaseName: "app",
+		Stages: stages.SortedStageList{
+			{Weight: 0, DesiredResources: kube.ResourceList{credentials, serviceAccount}},
+			{Weight: 0, DesiredResources: kube.ResourceList{deployment}, ExternalDependencies: externaldeps.ExternalDependencyList{db}},
+		},
+		Operations: []*PlannedOperation{
+			{Type: release.ResourceOperationHook, Phase: release.PhaseHooksPre, Stage: intPtr(0), Weight: intPtr(-5), Resource: "myns:Job/migrate"},
+			{Type: release.ResourceOperationCreate, Phase: release.PhaseRollout, Stage: intPtr(0), Weight: intPtr(0), Resource: "myns:Secret/credentials"},
+			{Type: release.ResourceOperationCreate, Phase: release.PhaseRollout, Stage: intPtr(0), Weight: intPtr(0), Resource: "myns:ServiceAccount/app"},
+			{Type: release.ResourceOperationUpdate, Phase: release.PhaseRollout, Stage: intPtr(1), Weight: intPtr(0), Resource: "myns:Deployment/app"},
+			{Type: release.ResourceOperationDelete, Phase: release.PhaseRollout, Resource: "myns:ConfigMap/legacy"},
+		},
+	}
+}
+
+func TestDeployPlanExportGraph(t *testing.T) {
+	is := assert.New(t)
+	plan := graphTestPlan()
+
+	dot, err := plan.ExportGraph(GraphFormatDOT)
+	is.NoError(err)
+	is.Equal(`digraph "app" {
+	compound=true;
+	node [shape=box];
+	subgraph "cluster_g0" {
+		label="hooks-pre stage 0, weight -5";
+		"n0" [label="hook myns:Job/migrate"];
+	}
+	subgraph "cluster_g1" {
+		label="rollout stage 0, weight 0";
+		"n1" [label="create myns:Secret/credentials"];
+		"n2" [label="create myns:ServiceAccount/app"];
+	}
+	subgraph "cluster_g2" {
+		label="rollout stage 1, weight 0";
+		"n3" [label="update myns:Deployment/app"];
+	}
+	subgraph "cluster_g3" {
+		label="rollout cleanup";
+		"n4" [label="delete myns:ConfigMap/legacy"];
+	}
+	"e0" [label="external db data:statefulset/postgres", shape=ellipse];
+	"n0" -> "n1" [ltail="cluster_g0", lhead="cluster_g1"];
+	"n1" -> "n3" [ltail="cluster_g1", lhead="cluster_g2"];
+	"n3" -> "n4" [ltail="cluster_g2", lhead="cluster_g3"];
+	"n1" -> "n3" [label="ready"];
+	"n2" -> "n3" [label="present", style=dashed];
+	"e0" -> "n3" [lhead="cluster_g2", label="ready"];
+}
+`, dot)
+
+	mermaid, err := plan.ExportGraph(GraphFormatMermaid)
+	is.NoError(err)
+	is.Equal(`flowchart TD
+	subgraph g0["hooks-pre stage 0, weight -5"]
+		n0["hook myns:Job/migrate"]
+	end
+	subgraph g1["rollout stage 0, weight 0"]
+		n1["create myns:Secret/credentials"]
+		n2["create myns:ServiceAccount/app"]
+	end
+	subgraph g2["rollout stage 1, weight 0"]
+		n3["update myns:Deployment/app"]
+	end
+	subgraph g3["rollout cleanup"]
+		n4["delete myns:ConfigMap/legacy"]
+	end
+	e0(["external db data:statefulset/postgres"])
+	g0 --> g1
+	g1 --> g2
+	g2 --> g3
+	n1 -->|"ready"| n3
+	n2 -.->|"present"| n3
+	e0 -->|"ready"| g2
+`, mermaid)
+
+	_, err = plan.ExportGraph("svg")
+	is.Error(err)
+}
@@ -0,0 +1,192 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	restfake "k8s.io/client-go/rest/fake"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/chart/charttest"
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/werf/secrets"
+)
+
+// notFoundRESTClient responds to every request that the resource is not found.
+func notFoundRESTClient() *restfake.RESTClient {
+	return &restfake.RESTClient{
+		NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+		Client: restfake.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
+			body := `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`
+			return &http.Response{
+				StatusCode: http.StatusNotFound,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		}),
+	}
+}
+
+func configMapManifest(name string) string {
+	return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\n  namespace: spaced\n"
+}
+
+func planTestChart(names ...string) *chart.Chart {
+	var templates []*chart.File
+	for _, name := range names {
+		templates = append(templates, &chart.File{Name: "templates/" + name, Data: []byte(configMapManifest(name))})
+	}
+	ch := buildChart(charttest.WithTemplates(templates...))
+	ch.SecretsRuntimeData = secrets.NewSecretsRuntimeData()
+
+	return ch
+}
+
+func TestInstallPlan(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	instAction := installAction(t)
+	instAction.cfg.KubeClient = &logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+
+	plan, err := BuildDeployPlan(context.Background(), instAction, instAction.ReleaseName, planTestChart("app"), map[string]interface{}{})
+	req.NoError(err)
+
+	is.Equal(strings.Join([]string{
+		"rollout stage 0: create spaced:ConfigMap/app",
+		"hooks-post stage 0: hook spaced:ConfigMap/test-cm",
+	}, "\n"), plan.String())
+	is.Equal(instAction.ReleaseName, plan.ReleaseName)
+	is.Equal(1, plan.Revision)
+	is.False(instAction.DryRun, "the options of the install are restored")
+	is.Nil(instAction.plan)
+
+	_, err = instAction.cfg.Releases.Get(instAction.ReleaseName, 1)
+	is.Error(err, "the release is not stored")
+}
+
+func TestUpgradePlan(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	upAction := upgradeAction(t)
+	upAction.cfg.KubeClient = &logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+
+	rel := releaseStub()
+	rel.Manifest = configMapManifest("app") + "---\n" + configMapManifest("old")
+	req.NoError(upAction.cfg.Releases.Create(rel))
+
+	plan, err := BuildDeployPlan(context.Background(), upAction, rel.Name, planTestChart("app", "new"), map[string]interface{}{})
+	req.NoError(err)
+
+	// The resources of a stage are in the order of the templates.
+	is.ElementsMatch([]string{
+		"rollout stage 0: create spaced:ConfigMap/new",
+		"rollout stage 0: update spaced:ConfigMap/app",
+		"rollout: delete spaced:ConfigMap/old",
+		"hooks-post stage 0: hook :ConfigMap/test-cm",
+	}, strings.Split(plan.String(), "\n"))
+	is.Len(plan.Orphaned, 1)
+	is.Equal(2, plan.Revision)
+	_, err = upAction.cfg.Releases.Get(rel.Name, 2)
+	is.Error(err, "the release is not stored")
+}
+
+func TestInstallPlanOutput(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	instAction := installAction(t)
+	instAction.cfg.KubeClient = &logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+	instAction.PlanOutputPath = filepath.Join(t.TempDir(), "plan.json")
+
+	_, err := instAction.Run(planTestChart("app"), map[string]interface{}{})
+	req.NoError(err)
+
+	data, err := os.ReadFile(instAction.PlanOutputPath)
+	req.NoError(err)
+	is.Contains(string(data), `"type": "create"`)
+	is.Contains(string(data), `"resource": "spaced:ConfigMap/app"`)
+}
+
+func TestUpgradePlanOutput(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	upAction := upgradeAction(t)
+	upAction.cfg.KubeClient = &logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+	upAction.PlanOutputPath = filepath.Join(t.TempDir(), "plan.yaml")
+	upAction.PlanOutputFormat = DeployPlanFormatYAML
+
+	rel := releaseStub()
+	rel.Manifest = configMapManifest("app") + "---\n" + configMapManifest("old")
+	req.NoError(upAction.cfg.Releases.Create(rel))
+
+	_, err := upAction.Run(rel.Name, planTestChart("app"), map[string]interface{}{})
+	req.NoError(err)
+
+	data, err := os.ReadFile(upAction.PlanOutputPath)
+	req.NoError(err)
+	is.Contains(string(data), "revision: 2\n")
+	is.Contains(string(data), "resource: spaced:ConfigMap/old\n  type: delete\n")
+
+	upAction.PlanOutputFormat = "xml"
+	_, err = upAction.Run(rel.Name, planTestChart("app"), map[string]interface{}{})
+	is.ErrorContains(err, `unsupported deploy plan format "xml"`)
+}
+
+// restMapperGetter is a RESTClientGetter only able to provide the RESTMapper
+// and an empty REST config.
+type restMapperGetter struct {
+	mapper meta.RESTMapper
+}
+
+func (g *restMapperGetter) ToRESTConfig() (*rest.Config, error) {
+	return &rest.Config{}, nil
+}
+
+func (g *restMapperGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	return nil, errors.New("no discovery client")
+}
+
+func (g *restMapperGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	return g.mapper, nil
+}
+
+func TestInstallPlanExternalDependencies(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	instAction := installAction(t)
+	instAction.cfg.KubeClient = &logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+	instAction.cfg.RESTClientGetter = &restMapperGetter{mapper: mapper}
+
+	manifest := configMapManifest("app") + "  annotations:\n    db.external-dependency.werf.io/resource: deployments/postgres\n"
+	ch := planTestChart()
+	ch.Templates = append(ch.Templates, &chart.File{Name: "templates/app", Data: []byte(manifest)})
+
+	plan, err := BuildDeployPlan(context.Background(), instAction, instAction.ReleaseName, ch, map[string]interface{}{})
+	req.NoError(err)
+
+	req.Len(plan.Stages[0].ExternalDependencies, 1, "the external dependencies are generated from the annotations by default")
+	dep := plan.Stages[0].ExternalDependencies[0]
+	is.Equal("spaced", dep.Info.Namespace)
+	is.Equal("Deployment", dep.Info.Object.GetObjectKind().GroupVersionKind().Kind)
+	is.Equal("postgres", dep.Info.Name)
+}
@@ -0,0 +1,238 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+// RelaxedPodDisruptionBudgetAnnotation holds the original minAvailable and
+// maxUnavailable of a PodDisruptionBudget relaxed during a deploy, which it is
+// restored from after the rollout, or by the next deploy relaxing it if the
+// deploy was interrupted.
+const RelaxedPodDisruptionBudgetAnnotation = "werf.io/relaxed-pod-disruption-budget"
+
+// relaxedPodDisruptionBudgetSpec is the part of the spec of a
+// PodDisruptionBudget changed when relaxing it.
+type relaxedPodDisruptionBudgetSpec struct {
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// relaxPodDisruptionBudgets lets every pod selected by the
+// PodDisruptionBudgets of the resources be disrupted until restore is called.
+// The relaxed and the restored budgets are recorded in the report. The budgets
+// are restored even if the deploy was cancelled, and failures to restore them
+// are logged as warnings.
+func (cfg *Configuration) relaxPodDisruptionBudgets(resources kube.ResourceList, report *release.DeployReport) (restore func(), err error) {
+	clientSet, err := cfg.KubernetesClientSet()
+	if err != nil {
+		return nil, err
+	}
+
+	budgets, err := podDisruptionBudgetsOf(cfg.baseContext(), clientSet, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var relaxed []*policyv1.PodDisruptionBudget
+	restore = func() {
+		for _, pdb := range relaxed {
+			start := time.Now()
+			err := restorePodDisruptionBudget(context.Background(), clientSet, pdb.Namespace, pdb.Name)
+			if err != nil {
+				cfg.warn(messages.Format(messages.ExecutorRestorePodDisruptionBudget), pdb.Namespace, pdb.Name, err)
+			}
+			reportPodDisruptionBudget(report, pdb, release.ResourceOperationRestore, time.Since(start), err)
+		}
+	}
+
+	for _, pdb := range budgets {
+		start := time.Now()
+		err := relaxPodDisruptionBudget(cfg.baseContext(), clientSet, pdb)
+		reportPodDisruptionBudget(report, pdb, release.ResourceOperationRelax, time.Since(start), err)
+		if err != nil {
+			restore()
+			return nil, errors.Wrapf(err, "unable to relax PodDisruptionBudget %s/%s", pdb.Namespace, pdb.Name)
+		}
+		cfg.Log("PodDisruptionBudget %s/%s is relaxed until the end of the rollout", pdb.Namespace, pdb.Name)
+		relaxed = append(relaxed, pdb)
+	}
+
+	return restore, nil
+}
+
+// podDisruptionBudgetsOf returns the PodDisruptionBudgets selecting the pods
+// of the resources, sorted by namespace and name. The budgets which are
+// resources themselves are deployed as they are, so they are not returned.
+func podDisruptionBudgetsOf(ctx context.Context, clientSet kubernetes.Interface, resources kube.ResourceList) ([]*policyv1.PodDisruptionBudget, error) {
+	podLabels := map[string][]labels.Set{}
+	own := map[string]bool{}
+	for _, res := range resources {
+		if res.Object.GetObjectKind().GroupVersionKind().Kind == "PodDisruptionBudget" {
+			own[res.Namespace+"/"+res.Name] = true
+			continue
+		}
+
+		podTemplateLabels, found, err := phases.PodTemplateLabels(res)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			podLabels[res.Namespace] = append(podLabels[res.Namespace], podTemplateLabels)
+		}
+	}
+
+	var namespaces []string
+	for namespace := range podLabels {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var result []*policyv1.PodDisruptionBudget
+	for _, namespace := range namespaces {
+		list, err := clientSet.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list PodDisruptionBudgets in namespace %q", namespace)
+		}
+
+		for i := range list.Items {
+			pdb := &list.Items[i]
+			if own[pdb.Namespace+"/"+pdb.Name] || pdb.Spec.Selector == nil {
+				continue
+			}
+
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid selector of PodDisruptionBudget %s/%s", pdb.Namespace, pdb.Name)
+			}
+			for _, set := range podLabels[namespace] {
+				if selector.Matches(set) {
+					result = append(result, pdb)
+					break
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace ||
+			result[i].Namespace == result[j].Namespace && result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// relaxPodDisruptionBudget sets maxUnavailable of the PodDisruptionBudget to
+// 100%, keeping its original spec in RelaxedPodDisruptionBudgetAnnotation. A
+// budget already relaxed by an interrupted deploy keeps its annotation.
+func relaxPodDisruptionBudget(ctx context.Context, clientSet kubernetes.Interface, pdb *policyv1.PodDisruptionBudget) error {
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"minAvailable":   nil,
+			"maxUnavailable": "100%",
+		},
+	}
+
+	if _, relaxed := pdb.Annotations[RelaxedPodDisruptionBudgetAnnotation]; !relaxed {
+		original, err := json.Marshal(relaxedPodDisruptionBudgetSpec{
+			MinAvailable:   pdb.Spec.MinAvailable,
+			MaxUnavailable: pdb.Spec.MaxUnavailable,
+		})
+		if err != nil {
+			return err
+		}
+
+		patch["metadata"] = map[string]interface{}{
+			"annotations": map[string]interface{}{
+				RelaxedPodDisruptionBudgetAnnotation: string(original),
+			},
+		}
+	}
+
+	return patchPodDisruptionBudget(ctx, clientSet, pdb.Namespace, pdb.Name, patch)
+}
+
+// restorePodDisruptionBudget restores the spec of the PodDisruptionBudget from
+// RelaxedPodDisruptionBudgetAnnotation.
+func restorePodDisruptionBudget(ctx context.Context, clientSet kubernetes.Interface, namespace, name string) error {
+	pdb, err := clientSet.PolicyV1().PodDisruptionBudgets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	value, relaxed := pdb.Annotations[RelaxedPodDisruptionBudgetAnnotation]
+	if !relaxed {
+		return nil
+	}
+
+	var original relaxedPodDisruptionBudgetSpec
+	if err := json.Unmarshal([]byte(value), &original); err != nil {
+		return errors.Wrapf(err, "invalid annotation %s", RelaxedPodDisruptionBudgetAnnotation)
+	}
+
+	return patchPodDisruptionBudget(ctx, clientSet, namespace, name, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				RelaxedPodDisruptionBudgetAnnotation: nil,
+			},
+		},
+		"spec": map[string]interface{}{
+			"minAvailable":   original.MinAvailable,
+			"maxUnavailable": original.MaxUnavailable,
+		},
+	})
+}
+
+func patchPodDisruptionBudget(ctx context.Context, clientSet kubernetes.Interface, namespace, name string, patch map[string]interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	_, err = clientSet.PolicyV1().PodDisruptionBudgets(namespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{})
+	return err
+}
+
+func reportPodDisruptionBudget(report *release.DeployReport, pdb *policyv1.PodDisruptionBudget, operation release.ResourceOperation, duration time.Duration, err error) {
+	if report == nil {
+		return
+	}
+
+	resourceReport := &release.ResourceReport{
+		Kind:      "PodDisruptionBudget",
+		Name:      pdb.Name,
+		Namespace: pdb.Namespace,
+		Operation: operation,
+		Phase:     release.PhaseRollout,
+		Duration:  duration.Round(time.Millisecond).String(),
+		Status:    release.ResourceStatusSucceeded,
+	}
+	if err != nil {
+		resourceReport.Status = release.ResourceStatusFailed
+		resourceReport.Error = err.Error()
+	}
+
+	report.AddResources(resourceReport)
+}
+
+// podDisruptionBudgetName formats the PodDisruptionBudget as the resources of
+// a DeployPlan.
+func podDisruptionBudgetName(pdb *policyv1.PodDisruptionBudget) string {
+	return fmt.Sprintf("%s:PodDisruptionBudget/%s", pdb.Namespace, pdb.Name)
+}
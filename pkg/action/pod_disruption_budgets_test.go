@@ -0,0 +1,67 @@
+package action
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+func TestRelaxPodDisruptionBudgets(t *testing.T) {
+	is := assert.New(t)
+	ctx := context.Background()
+
+	pdb := func(name string, matchLabels map[string]string, minAvailable intstr.IntOrString) *policyv1.PodDisruptionBudget {
+		return &policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "spaced"},
+			Spec: policyv1.PodDisruptionBudgetSpec{
+				MinAvailable: &minAvailable,
+				Selector:     &metav1.LabelSelector{MatchLabels: matchLabels},
+			},
+		}
+	}
+	clientSet := fake.NewSimpleClientset(
+		pdb("web", map[string]string{"app": "web"}, intstr.FromInt(2)),
+		pdb("db", map[string]string{"app": "db"}, intstr.FromString("50%")),
+		pdb("own", map[string]string{"app": "web"}, intstr.FromInt(1)),
+	)
+
+	web := impactResource(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "web", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "web"}},
+			},
+		},
+	})
+	own := impactResource(schema.GroupVersionKind{Group: "policy", Version: "v1", Kind: "PodDisruptionBudget"}, "own", nil)
+
+	budgets, err := podDisruptionBudgetsOf(ctx, clientSet, kube.ResourceList{web, own})
+	is.NoError(err)
+	if is.Len(budgets, 1) {
+		is.Equal("web", budgets[0].Name)
+	}
+
+	is.NoError(relaxPodDisruptionBudget(ctx, clientSet, budgets[0]))
+	relaxed, err := clientSet.PolicyV1().PodDisruptionBudgets("spaced").Get(ctx, "web", metav1.GetOptions{})
+	is.NoError(err)
+	is.Nil(relaxed.Spec.MinAvailable)
+	is.Equal(intstr.FromString("100%"), *relaxed.Spec.MaxUnavailable)
+	is.Equal(`{"minAvailable":2}`, relaxed.Annotations[RelaxedPodDisruptionBudgetAnnotation])
+
+	// Relaxing it again, e.g. after an interrupted deploy, keeps the original spec.
+	is.NoError(relaxPodDisruptionBudget(ctx, clientSet, relaxed))
+
+	is.NoError(restorePodDisruptionBudget(ctx, clientSet, "spaced", "web"))
+	restored, err := clientSet.PolicyV1().PodDisruptionBudgets("spaced").Get(ctx, "web", metav1.GetOptions{})
+	is.NoError(err)
+	is.Equal(intstr.FromInt(2), *restored.Spec.MinAvailable)
+	is.Nil(restored.Spec.MaxUnavailable)
+	is.NotContains(restored.Annotations, RelaxedPodDisruptionBudgetAnnotation)
+}
@@ -0,0 +1,141 @@
+package action
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/chart/charttest"
+	"github.com/werf/3p-helm/pkg/kube"
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+	"github.com/werf/3p-helm/pkg/werf/secrets"
+)
+
+// logsStreamingKubeClient builds the resources of the manifests, none of which
+// exists in the cluster, and streams a line of the logs of every resource it
+// waits for.
+type logsStreamingKubeClient struct {
+	kubefake.PrintingKubeClient
+
+	opts kube.LogsOptions
+}
+
+func (c *logsStreamingKubeClient) Build(r io.Reader, _ bool) (kube.ResourceList, error) {
+	manifest, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result kube.ResourceList
+	for _, doc := range releaseutil.SplitManifests(string(manifest)) {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(doc), &obj.Object); err != nil {
+			return nil, err
+		}
+		if obj.GetKind() == "" {
+			continue
+		}
+
+		result = append(result, &resource.Info{
+			Name:      obj.GetName(),
+			Namespace: obj.GetNamespace(),
+			Object:    obj,
+			Client:    notFoundRESTClient(),
+			Mapping:   &meta.RESTMapping{GroupVersionKind: obj.GroupVersionKind(), Scope: meta.RESTScopeNamespace},
+		})
+	}
+
+	return result, nil
+}
+
+func (c *logsStreamingKubeClient) WithLogsOptions(opts kube.LogsOptions) kube.Interface {
+	client := *c
+	client.opts = opts
+	return &client
+}
+
+func (c *logsStreamingKubeClient) Wait(resources kube.ResourceList, _ time.Duration) error {
+	for _, res := range resources {
+		if err := c.opts.WriteContainerLogs(res.Mapping.GroupVersionKind.Kind, res.Name, res.Namespace, "main", []string{"started"}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestUpgradeProgress(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	upAction := upgradeAction(t)
+	upAction.cfg.KubeClient = &logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+	upAction.Wait = true
+	upAction.LogsDir = t.TempDir()
+	var out bytes.Buffer
+	upAction.ProgressOutput = &out
+
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n  namespace: spaced\n"
+	rel := releaseStub()
+	rel.Manifest = manifest
+	req.NoError(upAction.cfg.Releases.Create(rel))
+
+	ch := buildChart(charttest.WithTemplates(&chart.File{Name: "templates/configmap", Data: []byte(manifest)}))
+	ch.SecretsRuntimeData = secrets.NewSecretsRuntimeData()
+	_, err := upAction.Run(rel.Name, ch, map[string]interface{}{})
+	req.NoError(err)
+
+	var events []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event release.ProgressEvent
+		req.NoError(json.Unmarshal([]byte(line), &event), "every line is an event: %s", line)
+		is.False(event.Time.IsZero())
+		is.Equal(rel.Name, event.Release)
+		is.Equal(2, event.Revision)
+
+		described := []string{string(event.Type)}
+		if event.Phase != "" {
+			described = append(described, string(event.Phase))
+		}
+		if event.Stage != nil {
+			described = append(described, fmt.Sprintf("stage %d", *event.Stage))
+		}
+		if event.Kind != "" {
+			described = append(described, event.Namespace+"/"+event.Kind+"/"+event.Name)
+		}
+		if event.Container != "" {
+			described = append(described, event.Container+": "+strings.Join(event.Lines, ","))
+		}
+		events = append(events, strings.Join(described, " "))
+	}
+
+	is.Equal([]string{
+		"phase-started hooks-pre",
+		"phase-started rollout",
+		"resource-applied rollout stage 0 spaced/ConfigMap/app",
+		"container-logs spaced/ConfigMap/app main: started",
+		"resource-ready rollout stage 0 spaced/ConfigMap/app",
+		"phase-started hooks-post",
+		"hook-succeeded hooks-post /ConfigMap/test-cm",
+	}, events)
+
+	logs, err := os.ReadFile(filepath.Join(upAction.LogsDir, "spaced", "configmap-app", "main.log"))
+	req.NoError(err)
+	is.Equal("started\n", string(logs))
+}
@@ -0,0 +1,266 @@
+package action
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/chartutil"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+)
+
+// ReleaseArchiveFormatVersion is the version of the format of the archives
+// written by ExportRelease.
+const ReleaseArchiveFormatVersion = 1
+
+const releaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+
+// ReleaseArchive is the full history of a release, with the charts, values,
+// manifests, hooks and metadata of all its revisions, exported by
+// ExportRelease and restored by ImportRelease. It is stored as gzipped JSON.
+type ReleaseArchive struct {
+	FormatVersion int    `json:"formatVersion"`
+	Name          string `json:"name"`
+	Namespace     string `json:"namespace"`
+	// Revisions are sorted by version.
+	Revisions []*ArchivedRevision `json:"revisions"`
+}
+
+// ArchivedRevision is a revision of a release in a ReleaseArchive.
+type ArchivedRevision struct {
+	Release *release.Release `json:"release"`
+	// Labels of the release, which are stored separately from the release.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ExportRelease is the action for exporting the full history of a release to
+// a portable archive, e.g. to migrate the release to another cluster with
+// ImportRelease.
+type ExportRelease struct {
+	cfg *Configuration
+}
+
+// NewExportRelease creates a new ExportRelease object with the given
+// configuration.
+func NewExportRelease(cfg *Configuration) *ExportRelease {
+	return &ExportRelease{
+		cfg: cfg,
+	}
+}
+
+// Run writes the archive of the release with the given name to out.
+func (e *ExportRelease) Run(name string, out io.Writer) (*ReleaseArchive, error) {
+	if err := chartutil.ValidateReleaseName(name); err != nil {
+		return nil, errors.Errorf("release name is invalid: %s", name)
+	}
+
+	history, err := e.cfg.Releases.History(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get the history of release %s", name)
+	}
+	if len(history) == 0 {
+		return nil, errors.Errorf("release %s has no revisions", name)
+	}
+	releaseutil.SortByRevision(history)
+
+	archive := &ReleaseArchive{
+		FormatVersion: ReleaseArchiveFormatVersion,
+		Name:          name,
+		Namespace:     history[len(history)-1].Namespace,
+	}
+	for _, rel := range history {
+		archive.Revisions = append(archive.Revisions, &ArchivedRevision{Release: rel, Labels: rel.Labels})
+	}
+
+	e.cfg.Log("exporting %d revisions of release %s", len(archive.Revisions), name)
+	w := gzip.NewWriter(out)
+	if err := json.NewEncoder(w).Encode(archive); err != nil {
+		return nil, errors.Wrap(err, "unable to write the release archive")
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "unable to write the release archive")
+	}
+
+	return archive, nil
+}
+
+// ImportRelease is the action for restoring the history of a release
+// exported by ExportRelease, e.g. in another cluster or namespace.
+//
+// Only the release records are restored, all of them whatever the MaxHistory
+// of the release storage, the resources of the release are not created. When
+// the release is imported into another namespace, the resources of the
+// manifests of its revisions in the old namespace are moved to the new one,
+// along with their meta.helm.sh/release-namespace annotations, so that the
+// next upgrade considers the resources its own. The live objects are left as
+// they are: the next upgrade creates the moved resources in the new namespace,
+// and fails on the existing ones still annotated with the old namespace, e.g.
+// the cluster-scoped ones, until their ownership is transferred to the
+// imported release as the error describes.
+type ImportRelease struct {
+	cfg *Configuration
+
+	// Namespace of the imported release, the namespace of the exported
+	// release if empty. The release is stored in this namespace, whatever the
+	// namespace of the configuration.
+	Namespace string
+	// DryRun returns the revisions that would be imported without changing
+	// the release storage.
+	DryRun bool
+}
+
+// NewImportRelease creates a new ImportRelease object with the given
+// configuration.
+func NewImportRelease(cfg *Configuration) *ImportRelease {
+	return &ImportRelease{
+		cfg: cfg,
+	}
+}
+
+// Run reads the archive from in and creates all the revisions of the release,
+// returning them sorted by version. The release must not exist yet.
+func (i *ImportRelease) Run(in io.Reader) ([]*release.Release, error) {
+	r, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the release archive")
+	}
+	defer r.Close()
+
+	var archive ReleaseArchive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, errors.Wrap(err, "unable to read the release archive")
+	}
+	if archive.FormatVersion != ReleaseArchiveFormatVersion {
+		return nil, errors.Errorf("unsupported release archive format version %d, expected %d", archive.FormatVersion, ReleaseArchiveFormatVersion)
+	}
+	if err := chartutil.ValidateReleaseName(archive.Name); err != nil {
+		return nil, errors.Errorf("release name is invalid: %s", archive.Name)
+	}
+	if len(archive.Revisions) == 0 {
+		return nil, errors.Errorf("release archive of %s has no revisions", archive.Name)
+	}
+
+	namespace := i.Namespace
+	if namespace == "" {
+		namespace = archive.Namespace
+	}
+	releases := i.cfg.releasesInNamespace(namespace)
+	// The history is restored as it was exported, without pruning it.
+	releases = releases.WithDriver(releases.Driver)
+	releases.MaxHistory = 0
+
+	if h, err := releases.History(archive.Name); err == nil && len(h) > 0 {
+		return nil, errors.Errorf("release %q already exists in namespace %s, only a new release can be imported", archive.Name, namespace)
+	}
+
+	var revisions []*release.Release
+	for _, revision := range archive.Revisions {
+		rel := revision.Release
+		if rel == nil || rel.Name != archive.Name {
+			return nil, errors.Errorf("release archive of %s has revisions of other releases", archive.Name)
+		}
+
+		if rel.Namespace != namespace {
+			if rel.Manifest, err = relocateManifest(rel.Manifest, rel.Namespace, namespace); err != nil {
+				return nil, errors.Wrapf(err, "unable to move revision %d of release %s to namespace %s", rel.Version, rel.Name, namespace)
+			}
+			for _, hook := range rel.Hooks {
+				if hook.Manifest, err = relocateManifest(hook.Manifest, rel.Namespace, namespace); err != nil {
+					return nil, errors.Wrapf(err, "unable to move hook %s of revision %d of release %s to namespace %s", hook.Name, rel.Version, rel.Name, namespace)
+				}
+			}
+			rel.Namespace = namespace
+		}
+		rel.Labels = revision.Labels
+
+		revisions = append(revisions, rel)
+	}
+	sort.SliceStable(revisions, func(a, b int) bool {
+		return revisions[a].Version < revisions[b].Version
+	})
+
+	if i.DryRun {
+		return revisions, nil
+	}
+
+	i.cfg.Log("importing %d revisions of release %s into namespace %s", len(revisions), archive.Name, namespace)
+	for _, rel := range revisions {
+		if err := releases.Create(rel); err != nil {
+			return nil, errors.Wrapf(err, "unable to import revision %d of release %s", rel.Version, rel.Name)
+		}
+	}
+
+	return revisions, nil
+}
+
+var manifestDocumentSeparator = regexp.MustCompile(`(?m)^---[ \t]*\n`)
+
+// relocateManifest moves the resources of the manifest in the namespace from
+// to the namespace to: their metadata.namespace and their
+// meta.helm.sh/release-namespace annotations equal to from are set to to. The
+// changed documents are re-encoded, keeping their leading comments, e.g.
+// "# Source:", and the other documents are kept as they are.
+func relocateManifest(manifest, from, to string) (string, error) {
+	if from == "" {
+		return manifest, nil
+	}
+
+	docs := manifestDocumentSeparator.Split(manifest, -1)
+	for i, doc := range docs {
+		relocated, err := relocateManifestDocument(doc, from, to)
+		if err != nil {
+			return "", err
+		}
+		docs[i] = relocated
+	}
+
+	return strings.Join(docs, "---\n"), nil
+}
+
+func relocateManifestDocument(doc, from, to string) (string, error) {
+	var content map[string]interface{}
+	if err := yaml.Unmarshal([]byte(doc), &content); err != nil {
+		return "", err
+	}
+	if content == nil {
+		return doc, nil
+	}
+
+	obj := &unstructured.Unstructured{Object: content}
+	changed := false
+	if obj.GetNamespace() == from {
+		obj.SetNamespace(to)
+		changed = true
+	}
+	if annotations := obj.GetAnnotations(); annotations[releaseNamespaceAnnotation] == from {
+		annotations[releaseNamespaceAnnotation] = to
+		obj.SetAnnotations(annotations)
+		changed = true
+	}
+	if !changed {
+		return doc, nil
+	}
+
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+
+	var comments strings.Builder
+	for _, line := range strings.SplitAfter(doc, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		comments.WriteString(line)
+	}
+
+	return comments.String() + string(data), nil
+}
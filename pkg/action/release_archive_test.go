@@ -0,0 +1,120 @@
+package action
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestExportImportRelease(t *testing.T) {
+	is := assert.New(t)
+	source := actionConfigFixture(t)
+
+	for version, status := range []release.Status{release.StatusSuperseded, release.StatusSuperseded, release.StatusDeployed} {
+		rel := namedReleaseStub("backend", status)
+		rel.Namespace = "prod"
+		rel.Version = version + 1
+		rel.Labels = map[string]string{"team": "payments"}
+		rel.Manifest = "---\n# Source: backend/templates/configmap.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: backend\n  namespace: prod\n"
+		rel.Hooks = rel.Hooks[:1]
+		rel.Hooks[0].Manifest = "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  namespace: prod\n"
+		is.NoError(source.Releases.Create(rel))
+	}
+
+	var archive bytes.Buffer
+	exported, err := NewExportRelease(source).Run("backend", &archive)
+	is.NoError(err)
+	is.Equal("prod", exported.Namespace)
+	is.Len(exported.Revisions, 3)
+
+	target := actionConfigFixture(t)
+	target.Releases.MaxHistory = 1
+	imp := NewImportRelease(target)
+	imp.Namespace = "staging"
+	revisions, err := imp.Run(bytes.NewReader(archive.Bytes()))
+	is.NoError(err)
+	is.Len(revisions, 3)
+
+	history, err := target.Releases.History("backend")
+	is.NoError(err)
+	is.Len(history, 3, "the history is not pruned")
+	is.Equal(1, target.Releases.MaxHistory)
+
+	last, err := target.Releases.Last("backend")
+	is.NoError(err)
+	is.Equal(3, last.Version)
+	is.Equal("staging", last.Namespace)
+	is.Equal(release.StatusDeployed, last.Info.Status)
+	is.Equal(map[string]string{"team": "payments"}, last.Labels)
+	is.Contains(last.Manifest, "  namespace: staging\n")
+	is.Contains(last.Hooks[0].Manifest, "  namespace: staging\n")
+
+	_, err = imp.Run(bytes.NewReader(archive.Bytes()))
+	is.Error(err, "an existing release is not overwritten")
+}
+
+func TestRelocateManifest(t *testing.T) {
+	is := assert.New(t)
+
+	manifest := `---
+# Source: backend/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: backend
+  namespace: prod
+  annotations:
+    meta.helm.sh/release-name: backend
+    meta.helm.sh/release-namespace: prod
+data:
+  key: value
+---
+# Source: backend/templates/servicemonitor.yaml
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name:  backend
+  namespace: monitoring
+---
+# Source: backend/templates/clusterrole.yaml
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name:  backend
+`
+
+	relocated, err := relocateManifest(manifest, "prod", "staging")
+	is.NoError(err)
+	is.Equal(`---
+# Source: backend/templates/configmap.yaml
+apiVersion: v1
+data:
+  key: value
+kind: ConfigMap
+metadata:
+  annotations:
+    meta.helm.sh/release-name: backend
+    meta.helm.sh/release-namespace: staging
+  name: backend
+  namespace: staging
+---
+# Source: backend/templates/servicemonitor.yaml
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name:  backend
+  namespace: monitoring
+---
+# Source: backend/templates/clusterrole.yaml
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name:  backend
+`, relocated)
+
+	_, err = relocateManifest("---\nmetadata: [\n", "prod", "staging")
+	is.Error(err)
+}
@@ -0,0 +1,151 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/chartutil"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+)
+
+// ReleaseDependencyAnnotationPrefix prefixes the Chart.yaml annotations
+// declaring the releases to wait for before a deploy, e.g.
+// "release.dependency.werf.io/db: data/postgres@3". The value has the format of
+// ParseReleaseDependency.
+const ReleaseDependencyAnnotationPrefix = "release.dependency.werf.io/"
+
+// releaseDependencyPollInterval is how often the release storage is checked.
+var releaseDependencyPollInterval = 2 * time.Second
+
+// ReleaseDependency is a release which must have a deployed revision not
+// older than MinRevision before a deploy starts.
+type ReleaseDependency struct {
+	Name      string
+	Namespace string
+	// MinRevision is the minimal deployed revision, any if 0.
+	MinRevision int
+}
+
+// ParseReleaseDependency parses "[<namespace>/]<name>[@<min revision>]". The
+// namespace defaults to the given one.
+func ParseReleaseDependency(value, namespace string) (ReleaseDependency, error) {
+	dep := ReleaseDependency{Namespace: namespace}
+
+	value = strings.TrimSpace(value)
+	if i := strings.LastIndex(value, "@"); i != -1 {
+		revision, err := strconv.Atoi(value[i+1:])
+		if err != nil || revision < 1 {
+			return ReleaseDependency{}, errors.Errorf("invalid release dependency %q: revision must be a positive integer", value)
+		}
+		dep.MinRevision = revision
+		value = value[:i]
+	}
+	if i := strings.Index(value, "/"); i != -1 {
+		dep.Namespace = value[:i]
+		value = value[i+1:]
+	}
+	dep.Name = value
+
+	if err := chartutil.ValidateReleaseName(dep.Name); err != nil {
+		return ReleaseDependency{}, errors.Wrapf(err, "invalid release dependency %q", value)
+	}
+
+	return dep, nil
+}
+
+func (d ReleaseDependency) String() string {
+	s := d.Namespace + "/" + d.Name
+	if d.MinRevision > 0 {
+		s += fmt.Sprintf("@%d", d.MinRevision)
+	}
+
+	return s
+}
+
+// releaseDependencies returns the release dependencies declared by the chart
+// annotations followed by the given ones.
+func releaseDependencies(chrt *chart.Chart, values []string, namespace string) ([]ReleaseDependency, error) {
+	var annotated []string
+	if chrt != nil && chrt.Metadata != nil {
+		for key := range chrt.Metadata.Annotations {
+			if strings.HasPrefix(key, ReleaseDependencyAnnotationPrefix) {
+				annotated = append(annotated, key)
+			}
+		}
+	}
+	sort.Strings(annotated)
+
+	var deps []ReleaseDependency
+	for _, key := range annotated {
+		dep, err := ParseReleaseDependency(chrt.Metadata.Annotations[key], namespace)
+		if err != nil {
+			return nil, errors.Wrapf(err, "chart annotation %s", key)
+		}
+		deps = append(deps, dep)
+	}
+	for _, value := range values {
+		dep, err := ParseReleaseDependency(value, namespace)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, dep)
+	}
+
+	return deps, nil
+}
+
+// waitForReleaseDependencies polls the release storage until every dependency
+// has a deployed revision not older than its minimal revision.
+func (cfg *Configuration) waitForReleaseDependencies(ctx context.Context, chrt *chart.Chart, values []string, namespace string, timeout time.Duration) error {
+	deps, err := releaseDependencies(chrt, values, namespace)
+	if err != nil || len(deps) == 0 {
+		return err
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	for _, dep := range deps {
+		releases := cfg.Releases
+		if dep.Namespace != namespace {
+			if cfg.ReleasesInNamespace == nil {
+				return errors.Errorf("unable to wait for release %s: no release storage for namespace %q", dep, dep.Namespace)
+			}
+			if releases, err = cfg.ReleasesInNamespace(dep.Namespace); err != nil {
+				return errors.Wrapf(err, "unable to wait for release %s", dep)
+			}
+		}
+
+		cfg.Log("waiting for release %s", dep)
+		for {
+			deployed, err := releases.Deployed(dep.Name)
+			if err == nil && deployed.Version >= dep.MinRevision {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				status := "no deployed revision"
+				if err == nil {
+					status = fmt.Sprintf("deployed revision %d", deployed.Version)
+				} else if !errors.Is(err, driver.ErrReleaseNotFound) && !errors.Is(err, driver.ErrNoDeployedReleases) {
+					status = err.Error()
+				}
+				return errors.Errorf("release %s is not ready (%s): %s", dep, status, ctx.Err())
+			case <-time.After(releaseDependencyPollInterval):
+			}
+		}
+	}
+
+	return nil
+}
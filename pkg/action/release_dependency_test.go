@@ -0,0 +1,86 @@
+package action
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/storage"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+)
+
+func TestParseReleaseDependency(t *testing.T) {
+	is := assert.New(t)
+
+	for value, expect := range map[string]ReleaseDependency{
+		"db":                {Name: "db", Namespace: "default"},
+		"data/postgres":     {Name: "postgres", Namespace: "data"},
+		" data/postgres@3 ": {Name: "postgres", Namespace: "data", MinRevision: 3},
+		"cache@12":          {Name: "cache", Namespace: "default", MinRevision: 12},
+	} {
+		dep, err := ParseReleaseDependency(value, "default")
+		is.NoError(err, value)
+		is.Equal(expect, dep, value)
+	}
+
+	for _, value := range []string{"", "db@", "db@0", "db@x", "data/", "Bad_Name"} {
+		_, err := ParseReleaseDependency(value, "default")
+		is.Error(err, value)
+	}
+
+	deps, err := releaseDependencies(&chart.Chart{Metadata: &chart.Metadata{Annotations: map[string]string{
+		ReleaseDependencyAnnotationPrefix + "queue": "queue",
+		ReleaseDependencyAnnotationPrefix + "db":    "data/postgres@2",
+		"category":                                  "backend",
+	}}}, []string{"cache"}, "default")
+	is.NoError(err)
+	is.Equal([]ReleaseDependency{
+		{Name: "postgres", Namespace: "data", MinRevision: 2},
+		{Name: "queue", Namespace: "default"},
+		{Name: "cache", Namespace: "default"},
+	}, deps)
+}
+
+func TestWaitForReleaseDependencies(t *testing.T) {
+	is := assert.New(t)
+
+	defer func(interval time.Duration) { releaseDependencyPollInterval = interval }(releaseDependencyPollInterval)
+	releaseDependencyPollInterval = 10 * time.Millisecond
+
+	config := actionConfigFixture(t)
+
+	dataDriver := driver.NewMemory()
+	dataDriver.SetNamespace("data")
+	dataReleases := storage.Init(dataDriver)
+	config.ReleasesInNamespace = func(namespace string) (*storage.Storage, error) {
+		is.Equal("data", namespace)
+		return dataReleases, nil
+	}
+
+	postgres := namedReleaseStub("postgres", release.StatusDeployed)
+	postgres.Namespace = "data"
+	postgres.Version = 1
+	is.NoError(dataReleases.Create(postgres))
+
+	// Revision 1 is deployed, the second one is deployed while waiting.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		next := namedReleaseStub("postgres", release.StatusDeployed)
+		next.Namespace = "data"
+		next.Version = 2
+		is.NoError(dataReleases.Create(next))
+	}()
+	is.NoError(config.waitForReleaseDependencies(context.Background(), nil, []string{"data/postgres@2"}, "default", 5*time.Second))
+
+	failed := namedReleaseStub("queue", release.StatusFailed)
+	is.NoError(config.Releases.Create(failed))
+	err := config.waitForReleaseDependencies(context.Background(), nil, []string{"queue"}, "default", 50*time.Millisecond)
+	is.ErrorContains(err, "release default/queue is not ready (no deployed revision)")
+
+	err = config.waitForReleaseDependencies(context.Background(), nil, []string{"data/postgres@3"}, "default", 50*time.Millisecond)
+	is.ErrorContains(err, "release data/postgres@3 is not ready (deployed revision 2)")
+}
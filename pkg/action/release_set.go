@@ -0,0 +1,377 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/chart/loader"
+	"github.com/werf/3p-helm/pkg/chartutil"
+	"github.com/werf/3p-helm/pkg/cli"
+	clivalues "github.com/werf/3p-helm/pkg/cli/values"
+	"github.com/werf/3p-helm/pkg/getter"
+	"github.com/werf/3p-helm/pkg/registry"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+)
+
+// ReleaseSet is a declarative list of releases deployed together, e.g.:
+//
+//	releases:
+//	- name: db
+//	  namespace: data
+//	  chart: ./charts/db
+//	- name: backend
+//	  chart: oci://registry.example.com/charts/backend
+//	  version: 1.2.0
+//	  values: [backend.yaml]
+//	  set: [image.tag=v42]
+//	  needs: [data/db]
+//
+// Local chart paths starting with "./" or "../" and values files are relative
+// to the directory of the release set file.
+type ReleaseSet struct {
+	Releases []*ReleaseSetRelease `json:"releases"`
+}
+
+// ReleaseSetRelease is a release of a ReleaseSet.
+type ReleaseSetRelease struct {
+	Name string `json:"name"`
+	// Namespace defaults to the namespace of the ReleaseSetDeploy.
+	Namespace string `json:"namespace,omitempty"`
+	// Chart is a chart reference as accepted by "helm install".
+	Chart   string `json:"chart"`
+	Version string `json:"version,omitempty"`
+	// Values are values files, the later ones take precedence.
+	Values []string `json:"values,omitempty"`
+	// Set are values in the "--set" format, taking precedence over Values.
+	Set []string `json:"set,omitempty"`
+	// Needs are the releases deployed before this one, referenced by name or
+	// as "<namespace>/<name>" if the name is ambiguous.
+	Needs []string `json:"needs,omitempty"`
+
+	needs []*ReleaseSetRelease
+}
+
+func (r *ReleaseSetRelease) String() string {
+	if r.Namespace == "" {
+		return r.Name
+	}
+
+	return r.Namespace + "/" + r.Name
+}
+
+// LoadReleaseSet reads and validates a release set file.
+func LoadReleaseSet(path string) (*ReleaseSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read release set")
+	}
+
+	set, err := ParseReleaseSet(data, filepath.Dir(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid release set %s", path)
+	}
+
+	return set, nil
+}
+
+// ParseReleaseSet parses and validates a release set. Relative paths are
+// resolved against dir.
+func ParseReleaseSet(data []byte, dir string) (*ReleaseSet, error) {
+	set := &ReleaseSet{}
+	if err := yaml.UnmarshalStrict(data, set); err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]*ReleaseSetRelease{}
+	byName := map[string][]*ReleaseSetRelease{}
+	for i, rel := range set.Releases {
+		if rel == nil {
+			return nil, errors.Errorf("release %d is empty", i)
+		}
+		if err := chartutil.ValidateReleaseName(rel.Name); err != nil {
+			return nil, errors.Wrapf(err, "release %d has an invalid name %q", i, rel.Name)
+		}
+		if rel.Chart == "" {
+			return nil, errors.Errorf("release %s has no chart", rel)
+		}
+		if _, found := byKey[rel.String()]; found {
+			return nil, errors.Errorf("release %s is listed more than once", rel)
+		}
+		byKey[rel.String()] = rel
+		byName[rel.Name] = append(byName[rel.Name], rel)
+
+		if strings.HasPrefix(rel.Chart, "./") || strings.HasPrefix(rel.Chart, "../") {
+			rel.Chart = filepath.Join(dir, rel.Chart)
+		}
+		for j, file := range rel.Values {
+			if !filepath.IsAbs(file) && !strings.Contains(file, "://") && file != "-" {
+				rel.Values[j] = filepath.Join(dir, file)
+			}
+		}
+	}
+
+	for _, rel := range set.Releases {
+		for _, need := range rel.Needs {
+			var needed *ReleaseSetRelease
+			if strings.Contains(need, "/") {
+				needed = byKey[need]
+			} else if candidates := byName[need]; len(candidates) > 1 {
+				return nil, errors.Errorf("release %s needs %q which is ambiguous, use \"<namespace>/<name>\"", rel, need)
+			} else if len(candidates) == 1 {
+				needed = candidates[0]
+			}
+			if needed == nil {
+				return nil, errors.Errorf("release %s needs %q which is not in the release set", rel, need)
+			}
+			rel.needs = append(rel.needs, needed)
+		}
+	}
+
+	if err := checkReleaseSetCycles(set.Releases); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+func checkReleaseSetCycles(releases []*ReleaseSetRelease) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[*ReleaseSetRelease]int{}
+
+	var visit func(rel *ReleaseSetRelease, path []string) error
+	visit = func(rel *ReleaseSetRelease, path []string) error {
+		path = append(path, rel.String())
+		switch state[rel] {
+		case visiting:
+			return errors.Errorf("releases have a dependency cycle: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+
+		state[rel] = visiting
+		for _, need := range rel.needs {
+			if err := visit(need, path); err != nil {
+				return err
+			}
+		}
+		state[rel] = visited
+
+		return nil
+	}
+
+	for _, rel := range releases {
+		if err := visit(rel, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReleaseSetDeploy installs or upgrades the releases of a ReleaseSet. A
+// release is deployed once all the releases it needs are deployed, releases
+// independent of each other are deployed concurrently. Releases needing a
+// failed release are skipped.
+//
+// Chart references are located and downloaded once for all the releases
+// using them.
+type ReleaseSetDeploy struct {
+	ChartPathOptions
+
+	Settings *cli.EnvSettings
+	// Namespace is the namespace of the releases not specifying one.
+	Namespace string
+	// Concurrency limits how many releases are deployed at once, 0 is unlimited.
+	Concurrency int
+	// Configuration returns the action configuration for a release namespace.
+	// It is called for every release and must not return a configuration
+	// shared by releases deployed concurrently.
+	Configuration func(namespace string) (*Configuration, error)
+	// ConfigureInstall and ConfigureUpgrade customize the actions for a
+	// release, e.g. set Wait or Timeout.
+	ConfigureInstall func(*Install)
+	ConfigureUpgrade func(*Upgrade)
+
+	charts sync.Map
+	// deployRelease is replaced in tests.
+	deployRelease func(ctx context.Context, rel *ReleaseSetRelease, namespace string) (*release.Release, error)
+}
+
+// ReleaseSetResult is the result of deploying a release of a ReleaseSet.
+type ReleaseSetResult struct {
+	Name      string
+	Namespace string
+	Release   *release.Release
+	// Skipped is set if a needed release failed.
+	Skipped bool
+	Err     error
+}
+
+type locatedChart struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// NewReleaseSetDeploy creates a new ReleaseSetDeploy.
+func NewReleaseSetDeploy(settings *cli.EnvSettings, configuration func(namespace string) (*Configuration, error)) *ReleaseSetDeploy {
+	d := &ReleaseSetDeploy{
+		Settings:      settings,
+		Namespace:     settings.Namespace(),
+		Configuration: configuration,
+	}
+	d.deployRelease = d.deploy
+
+	return d
+}
+
+// SetRegistryClient sets the registry client used to locate charts.
+func (d *ReleaseSetDeploy) SetRegistryClient(registryClient *registry.Client) {
+	d.ChartPathOptions.registryClient = registryClient
+}
+
+// Run deploys the releases and returns their results in the order of the
+// release set. The error lists the failed releases.
+func (d *ReleaseSetDeploy) Run(ctx context.Context, set *ReleaseSet) ([]*ReleaseSetResult, error) {
+	results := make(map[*ReleaseSetRelease]*ReleaseSetResult, len(set.Releases))
+	done := make(map[*ReleaseSetRelease]chan struct{}, len(set.Releases))
+	for _, rel := range set.Releases {
+		namespace := rel.Namespace
+		if namespace == "" {
+			namespace = d.Namespace
+		}
+		results[rel] = &ReleaseSetResult{Name: rel.Name, Namespace: namespace}
+		done[rel] = make(chan struct{})
+	}
+
+	var slots chan struct{}
+	if d.Concurrency > 0 {
+		slots = make(chan struct{}, d.Concurrency)
+	}
+
+	var wg sync.WaitGroup
+	for _, rel := range set.Releases {
+		wg.Add(1)
+		go func(rel *ReleaseSetRelease) {
+			defer wg.Done()
+			defer close(done[rel])
+
+			result := results[rel]
+			for _, need := range rel.needs {
+				<-done[need]
+				if results[need].Err != nil {
+					result.Skipped = true
+					result.Err = errors.Errorf("needed release %s failed", need)
+					return
+				}
+			}
+
+			if slots != nil {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+			}
+
+			if err := ctx.Err(); err != nil {
+				result.Err = err
+				return
+			}
+
+			result.Release, result.Err = d.deployRelease(ctx, rel, result.Namespace)
+		}(rel)
+	}
+	wg.Wait()
+
+	var failed []string
+	list := make([]*ReleaseSetResult, 0, len(set.Releases))
+	for _, rel := range set.Releases {
+		result := results[rel]
+		list = append(list, result)
+		if result.Err != nil && !result.Skipped {
+			failed = append(failed, fmt.Sprintf("%s: %s", rel, result.Err))
+		}
+	}
+	if len(failed) > 0 {
+		return list, errors.Errorf("%d release(s) failed:\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+
+	return list, nil
+}
+
+// deploy installs the release if it does not exist and upgrades it otherwise.
+func (d *ReleaseSetDeploy) deploy(ctx context.Context, rel *ReleaseSetRelease, namespace string) (*release.Release, error) {
+	cfg, err := d.Configuration(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	chartPath, err := d.locateChart(rel)
+	if err != nil {
+		return nil, err
+	}
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if req := chrt.Metadata.Dependencies; req != nil {
+		if err := CheckDependencies(chrt, req); err != nil {
+			return nil, err
+		}
+	}
+
+	valueOpts := &clivalues.Options{ValueFiles: rel.Values, Values: rel.Set}
+	vals, err := valueOpts.MergeValues(getter.All(d.Settings))
+	if err != nil {
+		return nil, err
+	}
+
+	history := NewHistory(cfg)
+	history.Max = 1
+	if _, err := history.Run(rel.Name); err == driver.ErrReleaseNotFound {
+		install := NewInstall(cfg, nil, nil)
+		if d.ConfigureInstall != nil {
+			d.ConfigureInstall(install)
+		}
+		install.ReleaseName = rel.Name
+		install.Namespace = namespace
+		install.Version = rel.Version
+
+		return install.RunWithContext(ctx, chrt, vals)
+	} else if err != nil {
+		return nil, err
+	}
+
+	upgrade := NewUpgrade(cfg, UpgradeOptions{})
+	if d.ConfigureUpgrade != nil {
+		d.ConfigureUpgrade(upgrade)
+	}
+	upgrade.Namespace = namespace
+	upgrade.Version = rel.Version
+
+	return upgrade.RunWithContext(ctx, rel.Name, chrt, vals)
+}
+
+// locateChart locates the chart once for all the releases using the same
+// chart reference and version.
+func (d *ReleaseSetDeploy) locateChart(rel *ReleaseSetRelease) (string, error) {
+	value, _ := d.charts.LoadOrStore(rel.Chart+"@"+rel.Version, &locatedChart{})
+	located := value.(*locatedChart)
+
+	located.once.Do(func() {
+		chartPathOptions := d.ChartPathOptions
+		chartPathOptions.Version = rel.Version
+		located.path, located.err = chartPathOptions.LocateChart(rel.Chart, d.Settings)
+	})
+
+	return located.path, located.err
+}
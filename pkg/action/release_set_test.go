@@ -0,0 +1,104 @@
+package action
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestParseReleaseSet(t *testing.T) {
+	is := assert.New(t)
+
+	set, err := ParseReleaseSet([]byte(`
+releases:
+- name: db
+  namespace: data
+  chart: ./charts/db
+- name: db
+  namespace: cache
+  chart: repo/redis
+- name: backend
+  chart: oci://registry.example.com/charts/backend
+  version: 1.2.0
+  values: [backend.yaml, /etc/common.yaml, https://example.com/values.yaml]
+  set: [image.tag=v42]
+  needs: [data/db, cache/db]
+- name: frontend
+  chart: ../frontend
+  needs: [backend]
+`), "/sets")
+	is.NoError(err)
+
+	is.Equal(filepath.Join("/sets", "charts/db"), set.Releases[0].Chart)
+	is.Equal("repo/redis", set.Releases[1].Chart)
+	is.Equal("/frontend", set.Releases[3].Chart)
+	is.Equal([]string{filepath.Join("/sets", "backend.yaml"), "/etc/common.yaml", "https://example.com/values.yaml"}, set.Releases[2].Values)
+	is.Equal([]*ReleaseSetRelease{set.Releases[0], set.Releases[1]}, set.Releases[2].needs)
+	is.Equal([]*ReleaseSetRelease{set.Releases[2]}, set.Releases[3].needs)
+
+	for name, data := range map[string]string{
+		"cycle":         "releases:\n- {name: a, chart: c, needs: [b]}\n- {name: b, chart: c, needs: [c]}\n- {name: c, chart: c, needs: [a]}\n",
+		"ambiguous":     "releases:\n- {name: a, namespace: x, chart: c}\n- {name: a, namespace: y, chart: c}\n- {name: b, chart: c, needs: [a]}\n",
+		"unknown need":  "releases:\n- {name: a, chart: c, needs: [b]}\n",
+		"duplicate":     "releases:\n- {name: a, chart: c}\n- {name: a, chart: d}\n",
+		"no chart":      "releases:\n- {name: a}\n",
+		"invalid name":  "releases:\n- {name: A_, chart: c}\n",
+		"unknown field": "releases:\n- {name: a, chart: c, value: [x.yaml]}\n",
+	} {
+		_, err := ParseReleaseSet([]byte(data), "/sets")
+		is.Error(err, name)
+	}
+}
+
+func TestReleaseSetDeploy(t *testing.T) {
+	is := assert.New(t)
+
+	set, err := ParseReleaseSet([]byte(`
+releases:
+- {name: db, chart: c}
+- {name: cache, chart: c}
+- {name: backend, chart: c, needs: [db, cache]}
+- {name: broken, chart: c, needs: [db]}
+- {name: frontend, chart: c, needs: [backend, broken]}
+- {name: docs, namespace: public, chart: c}
+`), ".")
+	is.NoError(err)
+
+	var mu sync.Mutex
+	deployed := map[string]int{}
+	d := &ReleaseSetDeploy{Namespace: "default", Concurrency: 2}
+	d.deployRelease = func(_ context.Context, rel *ReleaseSetRelease, namespace string) (*release.Release, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, need := range rel.needs {
+			if _, found := deployed[need.Name]; !found {
+				t.Errorf("release %s is deployed before %s it needs", rel.Name, need.Name)
+			}
+		}
+		deployed[rel.Name] = len(deployed)
+
+		if rel.Name == "broken" {
+			return nil, errors.New("boom")
+		}
+		return &release.Release{Name: rel.Name, Namespace: namespace}, nil
+	}
+
+	results, err := d.Run(context.Background(), set)
+	is.EqualError(err, "1 release(s) failed:\nbroken: boom")
+	is.Len(results, 6)
+
+	is.Equal("default", results[0].Namespace)
+	is.NotNil(results[2].Release)
+	is.EqualError(results[3].Err, "boom")
+	is.True(results[4].Skipped)
+	is.NotContains(deployed, "frontend")
+	is.Equal("public", results[5].Namespace)
+	is.Equal("public", results[5].Release.Namespace)
+}
@@ -0,0 +1,45 @@
+package action
+
+import (
+	"time"
+
+	"github.com/werf/3p-helm/pkg/engine"
+	"github.com/werf/3p-helm/pkg/registry"
+)
+
+// renderOptions configures the template engine used by renderResources and the
+// limits enforced on the rendered manifests.
+type renderOptions struct {
+	// DebugDir is the directory to write the debug output of every template into.
+	DebugDir string
+	// TemplateTimeout limits the render time of every template.
+	TemplateTimeout time.Duration
+	// Timeout limits the total render time.
+	Timeout time.Duration
+	// Limits are checked after post-rendering.
+	Limits ManifestLimits
+	// ImageResolver and ImageDigestCacheFile configure the "werf_image"
+	// function.
+	ImageResolver        engine.ImageDigestResolver
+	ImageDigestCacheFile string
+}
+
+func (o renderOptions) apply(e *engine.Engine) {
+	e.DebugDir = o.DebugDir
+	e.TemplateTimeout = o.TemplateTimeout
+	e.RenderTimeout = o.Timeout
+	e.ImageResolver = o.ImageResolver
+	e.ImageDigestCacheFile = o.ImageDigestCacheFile
+}
+
+// imageResolver returns the first of the registry clients which is set, nil if
+// none is.
+func imageResolver(clients ...*registry.Client) engine.ImageDigestResolver {
+	for _, client := range clients {
+		if client != nil {
+			return client
+		}
+	}
+
+	return nil
+}
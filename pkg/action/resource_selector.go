@@ -0,0 +1,30 @@
+package action
+
+import (
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+// selectResources filters resources with the include and exclude matchers and
+// records the excluded resources in the release. The excluded resources are kept
+// in the release manifest, so that they are neither deleted now nor by the next
+// deploy.
+func selectResources(rel *release.Release, resources kube.ResourceList, include, exclude []string) (selected, excluded kube.ResourceList, err error) {
+	selector, err := phases.NewResourceSelector(include, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	selected, excluded, err = selector.Split(resources)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rel.ExcludedResources = nil
+	for _, res := range excluded {
+		rel.ExcludedResources = append(rel.ExcludedResources, kube.ResourceNameNamespaceKind(res))
+	}
+
+	return selected, excluded, nil
+}
@@ -0,0 +1,33 @@
+package action
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+)
+
+func TestSelectResources(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	kubeClient := &logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+	resources, err := kubeClient.Build(strings.NewReader(configMapManifest("app")+"---\n"+configMapManifest("seed")), false)
+	req.NoError(err)
+
+	rel := releaseStub()
+	rel.ExcludedResources = []string{"stale"}
+	selected, excluded, err := selectResources(rel, resources, nil, []string{"ConfigMap/seed"})
+	req.NoError(err)
+	is.Len(selected, 1)
+	is.Len(excluded, 1)
+	is.Equal("app", selected[0].Name)
+	is.Equal([]string{"spaced:ConfigMap/seed"}, rel.ExcludedResources, "the excluded resources of the previous deploy are replaced")
+
+	_, _, err = selectResources(rel, resources, []string{"seed"}, nil)
+	is.ErrorContains(err, `invalid resource matcher "seed"`)
+}
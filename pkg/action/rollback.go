@@ -18,20 +18,23 @@ package action
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/werf/3p-helm/pkg/chartutil"
 	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
 	"github.com/werf/3p-helm/pkg/phases"
 	"github.com/werf/3p-helm/pkg/phases/phasemanagers"
 	"github.com/werf/3p-helm/pkg/phases/stages"
 	"github.com/werf/3p-helm/pkg/release"
 	"github.com/werf/3p-helm/pkg/releaseutil"
-	helmtime "github.com/werf/3p-helm/pkg/time"
 )
 
 // Rollback is the action for rolling back to a given release.
@@ -39,6 +42,20 @@ import (
 // It provides the implementation of 'helm rollback'.
 type Rollback struct {
 	cfg *Configuration
+	// deployReport collects the results of the rollout for DeployReportPath and the DeployExtender.
+	deployReport *release.DeployReport
+	// progress emits the progress events of the deploy to ProgressOutput.
+	progress *release.ProgressStream
+	// metrics records the metrics of the deploy if the configuration has Metrics.
+	metrics *deployMetrics
+	// result is the result of the last run.
+	result DeployResult
+	// untrackedResources are the unsupported resources applied without tracking them.
+	untrackedResources kube.ResourceList
+	// atomicUpgrade is set for the rollback of a failed atomic upgrade, which
+	// already locked the release and calls the AfterDeploy of the
+	// DeployExtender once for both.
+	atomicUpgrade bool
 
 	Version       int
 	Timeout       time.Duration
@@ -50,10 +67,101 @@ type Rollback struct {
 	Force         bool // will (if true) force resource upgrade through uninstall/recreate if needed
 	CleanupOnFail bool
 	MaxHistory    int // MaxHistory limits the maximum number of revisions saved per release
+	// ToLastSuccessful rolls back to the last revision, other than the
+	// current one, which was deployed successfully, skipping the failed
+	// revisions, instead of the previous revision. The last pinned revision,
+	// if any, is preferred as a known good one. Version must not be set.
+	ToLastSuccessful bool
+	// Description is the description of this operation. Defaults to "Rollback to <revision>".
+	Description string
+	// Metadata is arbitrary data recorded in the new revision.
+	Metadata map[string]string
+	// InjectDeployMetadata annotates the pod templates of workloads with the
+	// release revision and the deploy time. Workloads with an unchanged pod
+	// template keep their annotations, so that they are not restarted.
+	InjectDeployMetadata bool
+	// WaitForOwnedResources, if set with Wait, also waits for the resources owned
+	// by custom resources, such as the workloads created by operators, and reports
+	// their failures.
+	WaitForOwnedResources bool
+	// HooksTimeout, if set, is the time to wait for each hook to complete
+	// instead of Timeout. It is overridden by the werf.io/hook-timeout
+	// annotation of the hook.
+	HooksTimeout time.Duration
+	// HooksConcurrency is how many hooks of the same weight are executed at
+	// once. Hooks are executed one by one if it is 1 or less.
+	HooksConcurrency int
+	// HooksMaxFailures is how many hooks of the same weight may fail before
+	// the remaining ones are not executed: 1, the default, stops at the first
+	// failure, a negative number executes all of them and reports all the
+	// failures. It is overridden by the werf.io/hook-max-failures annotation.
+	HooksMaxFailures int
+	// WatchEvents collects the Warning events of the release resources and of the
+	// objects they create, e.g. Pods, while deploying and adds them to the error
+	// if the deploy fails.
+	WatchEvents bool
+	// APIUnavailabilityBudget is how long the deploy is paused, in total, while
+	// the Kubernetes API server is unavailable before it fails. Zero disables
+	// pausing.
+	APIUnavailabilityBudget time.Duration
+	// ImmutableGenerationsToKeep is how many of the last revisions keep their
+	// generations of immutable ConfigMaps and Secrets instead of deleting them
+	// after the deploy. Zero deletes them as any other orphaned resource.
+	ImmutableGenerationsToKeep int
+	// PrunePolicy is what is done with the orphaned resources after the
+	// rollout: "prune" (default) deletes them, "warn-only" keeps them with a
+	// warning and "keep" keeps them. Resources annotated with
+	// phases.NoPruneAnnotation are always kept.
+	PrunePolicy string
+	// UnsupportedResourcesPolicy is what is done, when waiting for the
+	// resources without their owned resources, with the resources whose
+	// readiness can't be tracked: "warn" (default) applies them without
+	// tracking with a warning, "fail" fails the deploy and "skip" skips them.
+	UnsupportedResourcesPolicy string
+	// RelaxPodDisruptionBudgets lets the pods selected by the
+	// PodDisruptionBudgets of the workloads be disrupted while the resources
+	// are applied and tracked, setting maxUnavailable of the budgets to 100%
+	// and restoring them after the rollout. The budgets which are resources of
+	// the release are not relaxed.
+	RelaxPodDisruptionBudgets bool
+	// VerifyCronJobs creates, in the dry-run mode, a Job from the job template
+	// of every deployed CronJob, so that the Jobs which would be rejected, e.g.
+	// by admission webhooks, fail the deploy instead of the next scheduled run
+	// of the CronJob.
+	VerifyCronJobs bool
+	// MigrateCRDStoredVersions migrates the stored objects of the
+	// CustomResourceDefinitions whose update removes the versions still listed
+	// in their status.storedVersions before the rollout, rather than failing
+	// the deploy.
+	MigrateCRDStoredVersions bool
+	// ReleaseDependencies are releases, in the format of ParseReleaseDependency,
+	// to wait for before the deploy in addition to the ones declared by the
+	// ReleaseDependencyAnnotationPrefix chart annotations. They are waited for
+	// up to Timeout.
+	ReleaseDependencies []string
 
 	StagesSplitter              phases.Splitter
 	StagesExternalDepsGenerator phases.ExternalDepsGenerator
+	DeployExtender              phases.DeployExtender
 	DeployReportPath            string
+	// DeployReportFormat is the format of the deploy report, "json" (default) or "yaml".
+	DeployReportFormat string
+	// ProgressOutput, if set, receives the progress events of the deploy as JSON lines, see release.ProgressStream.
+	ProgressOutput io.Writer
+	// LogsTailWindow limits the logs of every container of the tracked resources shown by the
+	// ResourcesWaiter of the kube client to the last lines or the last period, see kube.LogsOptions.
+	LogsTailWindow kube.LogsTailWindow
+	// HideLogs turns the logs of the containers of the tracked resources off, keeping the other
+	// messages of the tracking.
+	HideLogs bool
+	// LogsDir, if set, is the directory the streamed logs of the containers of the tracked resources
+	// are written to, per resource and container, see kube.ContainerLogFiles.
+	LogsDir string
+	// Notifiers are notified of the start and the end of the deploy.
+	Notifiers []Notifier
+	// NotificationReportURL is the link to the deploy report passed to the Notifiers, e.g. the one
+	// of the report of DeployReportPath published by the CI.
+	NotificationReportURL string
 }
 
 // NewRollback creates a new Rollback object with the given configuration.
@@ -63,7 +171,7 @@ func NewRollback(cfg *Configuration, stagesSplitter phases.Splitter, stagesExter
 	}
 
 	if stagesExternalDepsGenerator == nil {
-		stagesExternalDepsGenerator = &phases.NoExternalDepsGenerator{}
+		stagesExternalDepsGenerator = cfg.externalDepsGenerator()
 	}
 
 	return &Rollback{
@@ -71,41 +179,118 @@ func NewRollback(cfg *Configuration, stagesSplitter phases.Splitter, stagesExter
 
 		StagesSplitter:              stagesSplitter,
 		StagesExternalDepsGenerator: stagesExternalDepsGenerator,
+		DeployExtender:              &phases.NoDeployExtender{},
 	}
 }
 
 // Run executes 'helm rollback' against the given release.
 func (r *Rollback) Run(name string) error {
+	return r.RunWithContext(context.Background(), name)
+}
+
+// RunWithContext executes 'helm rollback' against the given release with
+// context. When the task is cancelled through ctx or its deadline is
+// exceeded, the Kubernetes API calls and the waits of the rollback are
+// cancelled.
+func (r *Rollback) RunWithContext(ctx context.Context, name string) error {
+	var warnings int32
+	cfg := r.cfg
+	r.cfg = cfg.withContext(ctx).withWarningsCounter(&warnings)
+	defer func() { r.cfg = cfg }()
+
+	err := r.run(ctx, name)
+	r.result = newDeployResult(err, atomic.LoadInt32(&warnings))
+
+	return err
+}
+
+// Result returns the result of the last run of the rollback.
+func (r *Rollback) Result() DeployResult {
+	return r.result
+}
+
+func (r *Rollback) run(ctx context.Context, name string) error {
+	if err := release.ValidateDeployReportFormat(r.DeployReportFormat); err != nil {
+		return newDeployError(DeployResultFailedValidation, err)
+	}
+	if _, err := phases.ParsePrunePolicy(r.PrunePolicy); err != nil {
+		return newDeployError(DeployResultFailedValidation, err)
+	}
+	if _, err := phases.ParseUnsupportedResourcesPolicy(r.UnsupportedResourcesPolicy); err != nil {
+		return newDeployError(DeployResultFailedValidation, err)
+	}
+
 	if err := r.cfg.KubeClient.IsReachable(); err != nil {
 		return err
 	}
 
 	r.cfg.Releases.MaxHistory = r.MaxHistory
 
+	// Concurrent deploys of the release wait for each other, if the storage
+	// supports it.
+	if !r.atomicUpgrade {
+		unlock, err := r.cfg.Releases.LockRelease(name)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
 	r.cfg.Log("preparing rollback of %s", name)
 	currentRelease, targetRelease, err := r.prepareRollback(name)
 	if err != nil {
 		return err
 	}
 
+	r.deployReport = release.NewDeployReport()
+	r.progress = release.NewProgressStream(r.ProgressOutput)
+	logFiles := kube.NewContainerLogFiles(r.LogsDir)
+	defer func() {
+		if err := logFiles.Close(); err != nil {
+			r.cfg.warn("%s", err)
+		}
+	}()
+	r.cfg = r.cfg.withLogsOptions(newLogsOptions(r.HideLogs, r.LogsTailWindow, logFiles, r.progress, targetRelease))
+	r.metrics = r.cfg.Metrics.startDeploy("rollback", targetRelease)
+
 	if !r.DryRun && r.DeployReportPath != "" {
 		defer func() {
-			deployReportData, err := release.NewDeployReport().FromRelease(targetRelease).ToJSONData()
+			deployReportData, err := r.deployReport.FromRelease(targetRelease).ToData(r.DeployReportFormat)
 			if err != nil {
-				r.cfg.Log("warning: error creating deploy report data: %s", err)
+				r.cfg.warn("error creating deploy report data: %s", err)
 				return
 			}
 
 			if err := os.WriteFile(r.DeployReportPath, deployReportData, 0o644); err != nil {
-				r.cfg.Log("warning: error writing deploy report file: %s", err)
+				r.cfg.warn("error writing deploy report file: %s", err)
+				return
+			}
+		}()
+	}
+
+	if !r.DryRun {
+		notifier := startDeployNotifications(r.cfg, r.Notifiers, r.NotificationReportURL, "rollback", targetRelease)
+		defer func() {
+			report := r.deployReport.FromRelease(targetRelease)
+			r.metrics.finish(report)
+			notifier.finish(report)
+			if r.atomicUpgrade {
 				return
 			}
+			if err := r.DeployExtender.AfterDeploy(targetRelease, report); err != nil {
+				r.cfg.warn("error after deploy: %s", err)
+			}
 		}()
 	}
 
 	if !r.DryRun {
+		if err := r.cfg.waitForReleaseDependencies(ctx, targetRelease.Chart, r.ReleaseDependencies, targetRelease.Namespace, r.Timeout); err != nil {
+			return err
+		}
+
 		r.cfg.Log("creating rolled back release for %s", name)
-		if err := r.cfg.Releases.Create(targetRelease); err != nil {
+		// Another deploy might have taken the revision since the history was read.
+		if err := r.cfg.Releases.CreateRevision(targetRelease); err != nil {
 			return err
 		}
 	}
@@ -140,16 +325,36 @@ func (r *Rollback) prepareRollback(name string) (*release.Release, *release.Rele
 		return nil, nil, err
 	}
 
-	previousVersion := r.Version
-	if r.Version == 0 {
-		previousVersion = currentRelease.Version - 1
-	}
-
 	historyReleases, err := r.cfg.Releases.History(name)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	previousVersion := r.Version
+	if r.ToLastSuccessful {
+		if r.Version != 0 {
+			return nil, nil, errors.New("a revision can't be specified when rolling back to the last successful revision")
+		}
+
+		var previous []*release.Release
+		for _, historyRelease := range historyReleases {
+			if historyRelease.Version != currentRelease.Version {
+				previous = append(previous, historyRelease)
+			}
+		}
+
+		lastSuccessful := lastPinnedRelease(previous)
+		if lastSuccessful == nil {
+			lastSuccessful = lastSuccessfulRelease(previous)
+		}
+		if lastSuccessful == nil {
+			return nil, nil, errors.Errorf("release %s has no successful revision to roll back to", name)
+		}
+		previousVersion = lastSuccessful.Version
+	} else if r.Version == 0 {
+		previousVersion = currentRelease.Version - 1
+	}
+
 	// Check if the history version to be rolled back exists
 	previousVersionExist := false
 	for _, historyRelease := range historyReleases {
@@ -178,7 +383,7 @@ func (r *Rollback) prepareRollback(name string) (*release.Release, *release.Rele
 		Config:    previousRelease.Config,
 		Info: &release.Info{
 			FirstDeployed: currentRelease.Info.FirstDeployed,
-			LastDeployed:  helmtime.Now(),
+			LastDeployed:  Timestamper(),
 			Status:        release.StatusPendingRollback,
 			Notes:         previousRelease.Info.Notes,
 			// Because we lose the reference to previous version elsewhere, we set the
@@ -187,8 +392,13 @@ func (r *Rollback) prepareRollback(name string) (*release.Release, *release.Rele
 		},
 		Version:  currentRelease.Version + 1,
 		Labels:   previousRelease.Labels,
+		Metadata: r.Metadata,
 		Manifest: previousRelease.Manifest,
 		Hooks:    previousRelease.Hooks,
+		// The chart and values are the same, so are the dependencies.
+		Dependencies: previousRelease.Dependencies,
+		// Prefer the names of the resources that are currently deployed.
+		GeneratedNames: mergeStrStrMaps(previousRelease.GeneratedNames, currentRelease.GeneratedNames),
 	})
 
 	return currentRelease, targetRelease, nil
@@ -202,12 +412,38 @@ func (r *Rollback) performRollback(currentRelease, targetRelease *release.Releas
 
 	target, err := r.cfg.KubeClient.Build(bytes.NewBufferString(targetRelease.Manifest), false)
 	if err != nil {
-		return targetRelease, errors.Wrap(err, "unable to build kubernetes objects from new release manifest")
+		return targetRelease, newDeployError(DeployResultFailedValidation, errors.Wrap(err, "unable to build kubernetes objects from new release manifest"))
+	}
+
+	if err := target.Visit(releaseutil.SetGeneratedNamesVisitor(targetRelease.GeneratedNames)); err != nil {
+		return targetRelease, err
+	}
+
+	target, skippedTarget, err := phases.SplitResourcesByDeployOn(target, phases.DeployTypeRollback)
+	if err != nil {
+		return targetRelease, newDeployError(DeployResultFailedValidation, err)
+	}
+
+	r.untrackedResources = nil
+	if r.Wait && !r.WaitForOwnedResources {
+		var unsupportedResources kube.ResourceList
+		target, unsupportedResources, r.untrackedResources, err = r.cfg.handleUnsupportedResources(target, r.UnsupportedResourcesPolicy, r.deployReport)
+		if err != nil {
+			return targetRelease, newDeployError(DeployResultFailedValidation, err)
+		}
+		skippedTarget.Merge(unsupportedResources)
 	}
 
 	// pre-rollback hooks
 	if !r.DisableHooks {
-		if err := r.cfg.execHook(targetRelease, release.HookPreRollback, r.Timeout); err != nil {
+		if err := r.DeployExtender.BeforePhase(targetRelease, release.PhaseHooksPre); err != nil {
+			return targetRelease, err
+		}
+		r.progress.PhaseStarted(targetRelease, release.PhaseHooksPre)
+		r.metrics.phaseStarted(release.PhaseHooksPre)
+		err := r.cfg.execHook(targetRelease, release.HookPreRollback, r.Timeout, r.HooksTimeout, r.HooksConcurrency, r.HooksMaxFailures)
+		r.progress.HooksFinished(targetRelease, release.HookPreRollback)
+		if err != nil {
 			return targetRelease, err
 		}
 	} else {
@@ -220,44 +456,110 @@ func (r *Rollback) performRollback(currentRelease, targetRelease *release.Releas
 		return targetRelease, errors.Wrap(err, "unable to set metadata visitor from target release")
 	}
 
+	if r.InjectDeployMetadata {
+		current, err := r.cfg.KubeClient.Build(bytes.NewBufferString(currentRelease.Manifest), false)
+		if err != nil {
+			return targetRelease, errors.Wrap(err, "unable to build kubernetes objects from current release manifest")
+		}
+		if err := target.Visit(releaseutil.SetDeployMetadataVisitor(current, targetRelease.Version, targetRelease.Info.LastDeployed.Time)); err != nil {
+			return targetRelease, err
+		}
+	}
+
 	history, err := r.cfg.Releases.HistoryUntilRevision(targetRelease.Name, targetRelease.Version)
 	if err != nil {
 		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
 		return targetRelease, err
 	}
 
+	if err := r.DeployExtender.BeforePlan(targetRelease, target); err != nil {
+		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
+		return targetRelease, err
+	}
+
 	rolloutPhase, err := phases.NewRolloutPhase(targetRelease, r.StagesSplitter, r.cfg.KubeClient).
 		ParseStages(target)
 	if err != nil {
 		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
 		return targetRelease, err
 	}
+	rolloutPhase.SkipResources(skippedTarget)
 
 	if err := rolloutPhase.GenerateStagesExternalDeps(r.StagesExternalDepsGenerator); err != nil {
 		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
 		return targetRelease, err
 	}
 
+	if err := r.DeployExtender.AfterPlan(targetRelease, rolloutPhase.SortedStages); err != nil {
+		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
+		return targetRelease, err
+	}
+
 	deployedResourcesCalculator := phases.NewDeployedResourcesCalculator(history, r.StagesSplitter, r.cfg.KubeClient)
 
 	rolloutPhaseManager, err := phasemanagers.NewRolloutPhaseManager(rolloutPhase, deployedResourcesCalculator, targetRelease, r.cfg.Releases, r.cfg.KubeClient).
+		WithAPIUnavailabilityBudget(r.APIUnavailabilityBudget, r.cfg.Log).
+		WithWarn(r.cfg.warn).
+		WithImmutableGenerationsToKeep(r.ImmutableGenerationsToKeep).
+		WithPrunePolicy(phases.PrunePolicy(r.PrunePolicy)).
+		WithUnsupportedResources(r.untrackedResources).
+		WithDeployReport(r.deployReport).
+		WithProgressStream(r.progress).
 		AddCalculatedPreviouslyDeployedResources()
 	if err != nil {
 		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
 		return targetRelease, err
 	}
 
-	if err := rolloutPhaseManager.DoStage(
+	if err := r.DeployExtender.BeforePhase(targetRelease, release.PhaseRollout); err != nil {
+		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
+		return targetRelease, err
+	}
+	r.progress.PhaseStarted(targetRelease, release.PhaseRollout)
+	r.metrics.phaseStarted(release.PhaseRollout)
+
+	if err := r.cfg.checkCRDStoredVersions(rolloutPhase.SortedStages.MergedDesiredResources(), r.MigrateCRDStoredVersions); err != nil {
+		err = messages.Errorf(messages.ExecutorCheckStoredVersions, err)
+		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
+		return targetRelease, err
+	}
+
+	restorePodDisruptionBudgets := func() {}
+	if r.RelaxPodDisruptionBudgets {
+		restore, err := r.cfg.relaxPodDisruptionBudgets(rolloutPhase.SortedStages.MergedDesiredResources(), r.deployReport)
+		if err != nil {
+			err = messages.Errorf(messages.ExecutorRelaxPodDisruptionBudgets, err)
+			recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
+			return targetRelease, err
+		}
+		restorePodDisruptionBudgets = restore
+	}
+
+	var eventsWatcher *kube.EventsWatcher
+	if r.WatchEvents {
+		eventsWatcher = r.cfg.startEventsWatcher(targetRelease.Namespace, rolloutPhase.SortedStages)
+		defer eventsWatcher.Stop()
+	}
+
+	err = rolloutPhaseManager.DoStage(
 		func(stgIndex int, stage *stages.Stage) error {
+			// Deploy dependencies with the "ready" state or a condition are awaited even if waiting is disabled.
+			if len(stage.ReadyDependencies) > 0 {
+				if err := r.cfg.KubeClient.WaitWithJobs(stage.ReadyDependencies, r.Timeout); err != nil {
+					return messages.Errorf(messages.ExecutorWaitForDependencies, err)
+				}
+			}
+			if len(stage.ConditionDependencies) > 0 {
+				if err := r.cfg.waitForConditionDependencies(stage.ConditionDependencies, r.Timeout); err != nil {
+					return err
+				}
+			}
+
 			if len(stage.ExternalDependencies) == 0 || !r.Wait {
 				return nil
 			}
 
-			if r.WaitForJobs {
-				return r.cfg.KubeClient.WaitWithJobs(stage.ExternalDependencies.AsResourceList(), r.Timeout)
-			} else {
-				return r.cfg.KubeClient.Wait(stage.ExternalDependencies.AsResourceList(), r.Timeout)
-			}
+			return r.cfg.waitForExternalDependencies(stage.ExternalDependencies, r.WaitForJobs, r.Timeout)
 		},
 		func(stgIndex int, stage *stages.Stage, prevDeployedStgResources kube.ResourceList) error {
 			if len(prevDeployedStgResources) == 0 {
@@ -289,17 +591,41 @@ func (r *Rollback) performRollback(currentRelease, targetRelease *release.Releas
 			return nil
 		},
 		func(stgIndex int, stage *stages.Stage) error {
+			if stage.CanaryStep > 0 {
+				return r.cfg.verifyCanaries(targetRelease, stage, !r.DisableHooks, r.Timeout, r.HooksTimeout, r.HooksConcurrency, r.HooksMaxFailures)
+			}
+
+			if r.VerifyCronJobs {
+				if err := r.cfg.verifyCronJobs(stage.DesiredResources); err != nil {
+					return err
+				}
+			}
+
 			if !r.Wait {
 				return nil
 			}
 
+			tracked, err := kube.TrackedResources(stage.DesiredResources)
+			if err != nil || len(tracked) == 0 {
+				return err
+			}
+
+			if r.WaitForOwnedResources {
+				if kubeClient, ok := r.cfg.KubeClient.(kube.InterfaceWaitOwned); ok {
+					return kubeClient.WaitWithOwned(tracked, r.WaitForJobs, r.Timeout)
+				}
+			}
+
 			if r.WaitForJobs {
-				return r.cfg.KubeClient.WaitWithJobs(stage.DesiredResources, r.Timeout)
+				return r.cfg.KubeClient.WaitWithJobs(tracked, r.Timeout)
 			} else {
-				return r.cfg.KubeClient.Wait(stage.DesiredResources, r.Timeout)
+				return r.cfg.KubeClient.Wait(tracked, r.Timeout)
 			}
 		},
-	); err != nil {
+	)
+	restorePodDisruptionBudgets()
+	if err != nil {
+		err = eventsWatcher.WrapError(err)
 		recordFailedStatus(r.cfg, currentRelease, targetRelease, err)
 
 		if r.CleanupOnFail {
@@ -338,7 +664,14 @@ func (r *Rollback) performRollback(currentRelease, targetRelease *release.Releas
 
 	// post-rollback hooks
 	if !r.DisableHooks {
-		if err := r.cfg.execHook(targetRelease, release.HookPostRollback, r.Timeout); err != nil {
+		if err := r.DeployExtender.BeforePhase(targetRelease, release.PhaseHooksPost); err != nil {
+			return targetRelease, err
+		}
+		r.progress.PhaseStarted(targetRelease, release.PhaseHooksPost)
+		r.metrics.phaseStarted(release.PhaseHooksPost)
+		err := r.cfg.execHook(targetRelease, release.HookPostRollback, r.Timeout, r.HooksTimeout, r.HooksConcurrency, r.HooksMaxFailures)
+		r.progress.HooksFinished(targetRelease, release.HookPostRollback)
+		if err != nil {
 			return targetRelease, err
 		}
 	}
@@ -347,9 +680,10 @@ func (r *Rollback) performRollback(currentRelease, targetRelease *release.Releas
 	if err != nil && !strings.Contains(err.Error(), "has no deployed releases") {
 		return nil, err
 	}
-	// Supersede all previous deployments, see issue #2941.
+	// Supersede all previous deployments, see issue #2941. Pinned revisions
+	// are kept as they are.
 	for _, rel := range deployed {
-		if rel.Version == targetRelease.Version {
+		if rel.Version == targetRelease.Version || rel.Info.Pinned {
 			continue
 		}
 
@@ -359,14 +693,33 @@ func (r *Rollback) performRollback(currentRelease, targetRelease *release.Releas
 	}
 
 	targetRelease.Info.Status = release.StatusDeployed
+	if len(r.Description) > 0 {
+		targetRelease.Info.Description = r.Description
+	}
 
 	return targetRelease, nil
 }
 
+// lastPinnedRelease returns the pinned revision with the highest version, or
+// nil if no revision is pinned.
+func lastPinnedRelease(history []*release.Release) *release.Release {
+	var last *release.Release
+	for _, r := range history {
+		if !r.Info.Pinned {
+			continue
+		}
+		if last == nil || r.Version > last.Version {
+			last = r
+		}
+	}
+
+	return last
+}
+
 func recordFailedStatus(cfg *Configuration, currentRelease, targetRelease *release.Release, err error) {
 	msg := fmt.Sprintf("Rollback %q failed: %s", targetRelease.Name, err)
 
-	cfg.Log("warning: %s", msg)
+	cfg.warn("%s", msg)
 	targetRelease.Info.Description = msg
 
 	currentRelease.Info.Status = release.StatusSuperseded
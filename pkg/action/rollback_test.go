@@ -0,0 +1,105 @@
+package action
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestRollbackToLastSuccessful(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+
+	for version, status := range []release.Status{release.StatusSuperseded, release.StatusSuperseded, release.StatusFailed, release.StatusFailed} {
+		rel := namedReleaseStub("backend", status)
+		rel.Version = version + 1
+		is.NoError(cfg.Releases.Create(rel))
+	}
+
+	rollback := NewRollback(cfg, nil, nil)
+	_, target, err := rollback.prepareRollback("backend")
+	is.NoError(err)
+	is.Equal("Rollback to 3", target.Info.Description, "the previous revision is targeted by default")
+
+	rollback.ToLastSuccessful = true
+	_, target, err = rollback.prepareRollback("backend")
+	is.NoError(err)
+	is.Equal("Rollback to 2", target.Info.Description)
+	is.Equal(5, target.Version)
+
+	rollback.Version = 1
+	_, _, err = rollback.prepareRollback("backend")
+	is.Error(err, "a revision can't be combined with the last successful one")
+}
+
+func TestRollbackToLastPinned(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+
+	for version, status := range []release.Status{release.StatusSuperseded, release.StatusSuperseded, release.StatusSuperseded, release.StatusFailed} {
+		rel := namedReleaseStub("backend", status)
+		rel.Version = version + 1
+		rel.Info.Pinned = rel.Version == 1
+		is.NoError(cfg.Releases.Create(rel))
+	}
+
+	rollback := NewRollback(cfg, nil, nil)
+	rollback.ToLastSuccessful = true
+	_, target, err := rollback.prepareRollback("backend")
+	is.NoError(err)
+	is.Equal("Rollback to 1", target.Info.Description, "the pinned revision is preferred to the last successful one")
+	is.False(target.Info.Pinned)
+}
+
+func TestRollbackKeepsPinnedRevisionsDeployed(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+	cfg := actionConfigFixture(t)
+	cfg.KubeClient = &kubefake.PrintingKubeClient{Out: io.Discard}
+
+	for version, status := range []release.Status{release.StatusSuperseded, release.StatusDeployed} {
+		rel := namedReleaseStub("backend", status)
+		rel.Version = version + 1
+		rel.Info.Pinned = rel.Version == 2
+		req.NoError(cfg.Releases.Create(rel))
+	}
+
+	req.NoError(NewRollback(cfg, nil, nil).Run("backend"))
+
+	pinned, err := cfg.Releases.Get("backend", 2)
+	req.NoError(err)
+	is.Equal(release.StatusDeployed, pinned.Info.Status, "the pinned revision is not superseded")
+
+	last, err := cfg.Releases.Last("backend")
+	req.NoError(err)
+	is.Equal(3, last.Version)
+	is.Equal(release.StatusDeployed, last.Info.Status)
+}
+
+func TestRollbackDescription(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+	cfg := actionConfigFixture(t)
+	cfg.KubeClient = &kubefake.PrintingKubeClient{Out: io.Discard}
+
+	for version, status := range []release.Status{release.StatusSuperseded, release.StatusDeployed} {
+		rel := namedReleaseStub("backend", status)
+		rel.Version = version + 1
+		req.NoError(cfg.Releases.Create(rel))
+	}
+
+	rollback := NewRollback(cfg, nil, nil)
+	rollback.Description = "Revert the broken config"
+	req.NoError(rollback.Run("backend"))
+
+	last, err := cfg.Releases.Last("backend")
+	req.NoError(err)
+	is.Equal(3, last.Version)
+	is.Equal(release.StatusDeployed, last.Info.Status)
+	is.Equal("Revert the broken config", last.Info.Description)
+}
@@ -0,0 +1,192 @@
+package action
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+)
+
+// OrphanReason is why the records of a release are orphaned.
+type OrphanReason string
+
+const (
+	// OrphanReasonUnknownRelease is a release which is not one of the known
+	// releases.
+	OrphanReasonUnknownRelease OrphanReason = "unknown-release"
+	// OrphanReasonNamespaceDeleted is a release whose namespace does not exist
+	// anymore, so neither do its resources.
+	OrphanReasonNamespaceDeleted OrphanReason = "namespace-deleted"
+	// OrphanReasonUninstalled is a release uninstalled with its history kept
+	// for longer than the retention.
+	OrphanReasonUninstalled OrphanReason = "uninstalled"
+)
+
+// OrphanedRelease is a release whose records are pruned by StorageGC.
+type OrphanedRelease struct {
+	Name      string       `json:"name"`
+	Namespace string       `json:"namespace"`
+	Revisions []int        `json:"revisions"`
+	Reason    OrphanReason `json:"reason"`
+}
+
+// StorageGC is the action for pruning the records of orphaned releases, e.g.
+// the release Secrets left in the storage namespace after the releases or
+// their namespaces are gone.
+type StorageGC struct {
+	cfg *Configuration
+
+	// KnownReleases, if not empty, are the releases which are kept, as
+	// "<namespace>/<name>", or as "<name>" for the releases of the name in
+	// all the namespaces. The records of the other releases are orphaned.
+	KnownReleases []string
+	// CheckNamespaces orphans the releases whose namespaces do not exist.
+	CheckNamespaces bool
+	// UninstalledRetention, if positive, is how long the records of the
+	// releases uninstalled with their history kept are kept.
+	UninstalledRetention time.Duration
+	// DryRun only lists the orphaned releases.
+	DryRun bool
+
+	// namespaceExists is replaced in tests.
+	namespaceExists func(namespace string) (bool, error)
+}
+
+// NewStorageGC creates a new StorageGC object with the given configuration.
+func NewStorageGC(cfg *Configuration) *StorageGC {
+	gc := &StorageGC{cfg: cfg}
+	gc.namespaceExists = gc.getNamespace
+
+	return gc
+}
+
+// Run finds the orphaned releases, sorted by name, and deletes all their
+// revisions unless DryRun is set.
+func (gc *StorageGC) Run() ([]*OrphanedRelease, error) {
+	all, err := gc.cfg.Releases.ListReleases()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list releases")
+	}
+
+	// Releases of the same name in different namespaces are different releases.
+	histories := map[string][]*release.Release{}
+	for _, rel := range all {
+		key := rel.Namespace + "/" + rel.Name
+		histories[key] = append(histories[key], rel)
+	}
+
+	var keys []string
+	for key := range histories {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := histories[keys[i]][0], histories[keys[j]][0]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Namespace < b.Namespace
+	})
+
+	// An empty list is no filter rather than orphaning every release.
+	var known map[string]bool
+	if len(gc.KnownReleases) > 0 {
+		known = map[string]bool{}
+		for _, name := range gc.KnownReleases {
+			known[name] = true
+		}
+	}
+
+	var orphaned []*OrphanedRelease
+	namespaces := map[string]bool{}
+	for _, key := range keys {
+		history := histories[key]
+		releaseutil.Reverse(history, releaseutil.SortByRevision)
+		last := history[0]
+
+		reason, err := gc.orphanReason(last, known, namespaces)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			continue
+		}
+
+		orphan := &OrphanedRelease{Name: last.Name, Namespace: last.Namespace, Reason: reason}
+		for _, rel := range history {
+			orphan.Revisions = append(orphan.Revisions, rel.Version)
+		}
+		sort.Ints(orphan.Revisions)
+		orphaned = append(orphaned, orphan)
+	}
+
+	if gc.DryRun {
+		return orphaned, nil
+	}
+
+	for _, orphan := range orphaned {
+		gc.cfg.Log("pruning %d revisions of %s release %s in namespace %s", len(orphan.Revisions), orphan.Reason, orphan.Name, orphan.Namespace)
+		releases := gc.cfg.releasesInNamespace(orphan.Namespace)
+		for _, version := range orphan.Revisions {
+			if _, err := releases.Delete(orphan.Name, version); err != nil {
+				return orphaned, errors.Wrapf(err, "unable to delete revision %d of release %s in namespace %s", version, orphan.Name, orphan.Namespace)
+			}
+		}
+	}
+
+	return orphaned, nil
+}
+
+// orphanReason returns why the release with the last revision is orphaned, or
+// an empty reason if it is not. The existence of the namespaces is cached.
+func (gc *StorageGC) orphanReason(last *release.Release, known, namespaces map[string]bool) (OrphanReason, error) {
+	if known != nil && !known[last.Name] && !known[last.Namespace+"/"+last.Name] {
+		return OrphanReasonUnknownRelease, nil
+	}
+
+	if gc.CheckNamespaces && last.Namespace != "" {
+		exists, checked := namespaces[last.Namespace]
+		if !checked {
+			var err error
+			if exists, err = gc.namespaceExists(last.Namespace); err != nil {
+				return "", errors.Wrapf(err, "unable to check namespace %s", last.Namespace)
+			}
+			namespaces[last.Namespace] = exists
+		}
+		if !exists {
+			return OrphanReasonNamespaceDeleted, nil
+		}
+	}
+
+	if gc.UninstalledRetention > 0 && last.Info != nil && last.Info.Status == release.StatusUninstalled {
+		uninstalled := last.Info.Deleted
+		if uninstalled.IsZero() {
+			uninstalled = last.Info.LastDeployed
+		}
+		if gc.cfg.Now().Sub(uninstalled) > gc.UninstalledRetention {
+			return OrphanReasonUninstalled, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (gc *StorageGC) getNamespace(namespace string) (bool, error) {
+	clientSet, err := gc.cfg.KubernetesClientSet()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = clientSet.CoreV1().Namespaces().Get(gc.cfg.baseContext(), namespace, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,85 @@
+package action
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+	helmtime "github.com/werf/3p-helm/pkg/time"
+)
+
+func TestStorageGC(t *testing.T) {
+	is := assert.New(t)
+	cfg := actionConfigFixture(t)
+
+	create := func(name, namespace string, version int, status release.Status, deleted time.Duration) {
+		rel := namedReleaseStub(name, status)
+		rel.Namespace = namespace
+		rel.Version = version
+		if deleted > 0 {
+			rel.Info.Deleted = helmtime.Now().Add(-deleted)
+		}
+		is.NoError(cfg.Releases.Create(rel))
+	}
+	create("app", "prod", 1, release.StatusSuperseded, 0)
+	create("app", "prod", 2, release.StatusDeployed, 0)
+	create("app", "review-42", 1, release.StatusDeployed, 0)
+	create("legacy", "prod", 1, release.StatusDeployed, 0)
+	create("preview", "review-42", 1, release.StatusDeployed, 0)
+	create("preview", "prod", 1, release.StatusDeployed, 0)
+	create("removed", "prod", 1, release.StatusSuperseded, 0)
+	create("removed", "prod", 2, release.StatusUninstalled, 48*time.Hour)
+	create("paused", "prod", 1, release.StatusUninstalled, time.Hour)
+
+	// The releases of all the namespaces are listed.
+	mem := cfg.Releases.Driver.(*driver.Memory)
+	mem.SetNamespace("")
+
+	gc := NewStorageGC(cfg)
+	gc.KnownReleases = []string{"app", "review-42/preview", "prod/removed", "prod/paused"}
+	gc.CheckNamespaces = true
+	gc.UninstalledRetention = 24 * time.Hour
+	gc.DryRun = true
+	gc.namespaceExists = func(namespace string) (bool, error) {
+		return namespace == "prod", nil
+	}
+
+	expected := []*OrphanedRelease{
+		{Name: "app", Namespace: "review-42", Revisions: []int{1}, Reason: OrphanReasonNamespaceDeleted},
+		{Name: "legacy", Namespace: "prod", Revisions: []int{1}, Reason: OrphanReasonUnknownRelease},
+		{Name: "preview", Namespace: "prod", Revisions: []int{1}, Reason: OrphanReasonUnknownRelease},
+		{Name: "preview", Namespace: "review-42", Revisions: []int{1}, Reason: OrphanReasonNamespaceDeleted},
+		{Name: "removed", Namespace: "prod", Revisions: []int{1, 2}, Reason: OrphanReasonUninstalled},
+	}
+
+	orphaned, err := gc.Run()
+	is.NoError(err)
+	is.Equal(expected, orphaned)
+
+	all, err := cfg.Releases.ListReleases()
+	is.NoError(err)
+	is.Len(all, 9, "dry run deletes nothing")
+
+	gc.KnownReleases = []string{}
+	unfiltered, err := gc.Run()
+	is.NoError(err)
+	is.Len(unfiltered, 3, "an empty list of known releases orphans no release")
+	gc.KnownReleases = []string{"app", "review-42/preview", "prod/removed", "prod/paused"}
+
+	gc.DryRun = false
+	orphaned, err = gc.Run()
+	is.NoError(err)
+	is.Equal(expected, orphaned)
+
+	mem.SetNamespace("")
+	all, err = cfg.Releases.ListReleases()
+	is.NoError(err)
+	var remaining []string
+	for _, rel := range all {
+		remaining = append(remaining, rel.Namespace+"/"+rel.Name)
+	}
+	is.ElementsMatch([]string{"prod/app", "prod/app", "prod/paused"}, remaining)
+}
@@ -55,6 +55,22 @@ type Uninstall struct {
 	DeleteNamespace bool
 	Namespace       string
 	StagesSplitter  phases.Splitter
+	// HooksTimeout, if set, is the time to wait for each hook to complete
+	// instead of Timeout. It is overridden by the werf.io/hook-timeout
+	// annotation of the hook.
+	HooksTimeout time.Duration
+	// HooksConcurrency is how many hooks of the same weight are executed at
+	// once. Hooks are executed one by one if it is 1 or less.
+	HooksConcurrency int
+	// HooksMaxFailures is how many hooks of the same weight may fail before
+	// the remaining ones are not executed: 1, the default, stops at the first
+	// failure, a negative number executes all of them and reports all the
+	// failures. It is overridden by the werf.io/hook-max-failures annotation.
+	HooksMaxFailures int
+	// ConfirmImpact, if set, is called with the impact of the uninstall before
+	// anything is deleted. The uninstall fails with ErrUninstallNotConfirmed
+	// unless it returns true.
+	ConfirmImpact func(impact *DeletionImpact) (bool, error)
 }
 
 // NewUninstall creates a new Uninstall object with the given configuration.
@@ -72,6 +88,17 @@ func NewUninstall(cfg *Configuration, stagesSplitter phases.Splitter) *Uninstall
 
 // Run uninstalls the given release.
 func (u *Uninstall) Run(name string) (*release.UninstallReleaseResponse, error) {
+	return u.RunWithContext(context.Background(), name)
+}
+
+// RunWithContext uninstalls the given release with context. When the task is
+// cancelled through ctx or its deadline is exceeded, the Kubernetes API calls
+// and the waits of the uninstall are cancelled.
+func (u *Uninstall) RunWithContext(ctx context.Context, name string) (*release.UninstallReleaseResponse, error) {
+	cfg := u.cfg
+	u.cfg = cfg.withContext(ctx)
+	defer func() { u.cfg = cfg }()
+
 	if err := u.cfg.KubeClient.IsReachable(); err != nil {
 		return nil, err
 	}
@@ -100,7 +127,7 @@ func (u *Uninstall) Run(name string) (*release.UninstallReleaseResponse, error)
 			u.cfg.Log("No such release %q", name)
 
 			if u.DeleteNamespace && !u.KeepHistory {
-				if err := u.cfg.KubeClient.DeleteNamespace(context.Background(), u.Namespace, kube.DeleteOptions{Wait: true, WaitTimeout: u.Timeout}); err != nil {
+				if err := u.cfg.KubeClient.DeleteNamespace(ctx, u.Namespace, kube.DeleteOptions{Wait: true, WaitTimeout: u.Timeout}); err != nil {
 					if kube.IsNotFound(err) {
 						u.cfg.Log("No such namespace %q", u.Namespace)
 						return &release.UninstallReleaseResponse{}, nil
@@ -135,6 +162,21 @@ func (u *Uninstall) Run(name string) (*release.UninstallReleaseResponse, error)
 		return nil, errors.Errorf("the release named %q is already deleted", name)
 	}
 
+	if u.ConfirmImpact != nil {
+		impact, err := u.impact(rels)
+		if err != nil {
+			return nil, errors.Wrap(err, "uninstall: unable to calculate the impact")
+		}
+
+		confirmed, err := u.ConfirmImpact(impact)
+		if err != nil {
+			return nil, err
+		}
+		if !confirmed {
+			return nil, ErrUninstallNotConfirmed
+		}
+	}
+
 	u.cfg.Log("uninstall: Deleting %s", name)
 	rel.Info.Status = release.StatusUninstalling
 	rel.Info.Deleted = helmtime.Now()
@@ -142,7 +184,7 @@ func (u *Uninstall) Run(name string) (*release.UninstallReleaseResponse, error)
 	res := &release.UninstallReleaseResponse{Release: rel}
 
 	if !u.DisableHooks {
-		if err := u.cfg.execHook(rel, release.HookPreDelete, u.Timeout); err != nil {
+		if err := u.cfg.execHook(rel, release.HookPreDelete, u.Timeout, u.HooksTimeout, u.HooksConcurrency, u.HooksMaxFailures); err != nil {
 			return res, err
 		}
 	} else {
@@ -183,7 +225,7 @@ func (u *Uninstall) Run(name string) (*release.UninstallReleaseResponse, error)
 	}
 
 	if !u.DisableHooks {
-		if err := u.cfg.execHook(rel, release.HookPostDelete, u.Timeout); err != nil {
+		if err := u.cfg.execHook(rel, release.HookPostDelete, u.Timeout, u.HooksTimeout, u.HooksConcurrency, u.HooksMaxFailures); err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -220,7 +262,7 @@ func (u *Uninstall) Run(name string) (*release.UninstallReleaseResponse, error)
 		}
 
 		if u.DeleteNamespace {
-			if err := u.cfg.KubeClient.DeleteNamespace(context.Background(), u.Namespace, kube.DeleteOptions{Wait: true, WaitTimeout: u.Timeout}); err != nil {
+			if err := u.cfg.KubeClient.DeleteNamespace(ctx, u.Namespace, kube.DeleteOptions{Wait: true, WaitTimeout: u.Timeout}); err != nil {
 				return res, errors.Wrapf(err, "unable to delete namespace %s", u.Namespace)
 			}
 		}
@@ -257,25 +299,55 @@ func joinErrors(errs []error) string {
 
 // deleteRelease deletes the release and returns list of delete resources and manifests that were kept in the deletion process
 func (u *Uninstall) deleteRelease(rel *release.Release, res kube.ResourceList) (kube.ResourceList, string, []error) {
-	manifestsStr, err := res.ToYamlDocs()
+	resources, kept, err := u.resourcesToDelete(rel, res)
 	if err != nil {
-		return nil, "", []error{fmt.Errorf("error converting resource list to yaml manifests: %w", err)}
+		return nil, kept, []error{err}
 	}
 
 	var errs []error
+	if len(resources) > 0 {
+		if kubeClient, ok := u.cfg.KubeClient.(kube.InterfaceDeletionPropagation); ok {
+			_, errs = kubeClient.DeleteWithPropagationPolicy(resources, parseCascadingFlag(u.cfg, u.DeletionPropagation), kube.DeleteOptions{
+				Wait:                   true,
+				SkipIfInvalidOwnership: true,
+				ReleaseName:            rel.Name,
+				ReleaseNamespace:       rel.Namespace,
+			})
+			return resources, kept, errs
+		}
+
+		_, errs = u.cfg.KubeClient.Delete(resources, kube.DeleteOptions{
+			Wait:                   true,
+			SkipIfInvalidOwnership: true,
+			ReleaseName:            rel.Name,
+			ReleaseNamespace:       rel.Namespace,
+		})
+	}
+	return resources, kept, errs
+}
+
+// resourcesToDelete returns the deployed resources of the release to delete in
+// the uninstall order, along with the manifests that are kept due to the
+// resource policy.
+func (u *Uninstall) resourcesToDelete(rel *release.Release, res kube.ResourceList) (kube.ResourceList, string, error) {
+	manifestsStr, err := res.ToYamlDocs()
+	if err != nil {
+		return nil, "", fmt.Errorf("error converting resource list to yaml manifests: %w", err)
+	}
+
 	caps, err := u.cfg.getCapabilities()
 	if err != nil {
-		return nil, manifestsStr, []error{errors.Wrap(err, "could not get apiVersions from Kubernetes")}
+		return nil, manifestsStr, errors.Wrap(err, "could not get apiVersions from Kubernetes")
 	}
 
 	manifests := releaseutil.SplitManifests(manifestsStr)
-	_, files, err := releaseutil.SortManifests(manifests, caps.APIVersions, releaseutil.UninstallOrder)
+	_, files, err := releaseutil.SortManifests(manifests, caps.APIVersions, u.cfg.uninstallOrder())
 	if err != nil {
 		// We could instead just delete everything in no particular order.
 		// FIXME: One way to delete at this point would be to try a label-based
 		// deletion. The problem with this is that we could get a false positive
 		// and delete something that was not legitimately part of this release.
-		return nil, manifestsStr, []error{errors.Wrap(err, "corrupted release record. You must manually delete the resources")}
+		return nil, manifestsStr, errors.Wrap(err, "corrupted release record. You must manually delete the resources")
 	}
 
 	filesToKeep, filesToDelete := filterManifestsToKeep(files)
@@ -291,27 +363,13 @@ func (u *Uninstall) deleteRelease(rel *release.Release, res kube.ResourceList) (
 
 	resources, err := u.cfg.KubeClient.Build(strings.NewReader(builder.String()), false)
 	if err != nil {
-		return nil, "", []error{errors.Wrap(err, "unable to build kubernetes objects for delete")}
+		return nil, "", errors.Wrap(err, "unable to build kubernetes objects for delete")
 	}
-	if len(resources) > 0 {
-		if kubeClient, ok := u.cfg.KubeClient.(kube.InterfaceDeletionPropagation); ok {
-			_, errs = kubeClient.DeleteWithPropagationPolicy(resources, parseCascadingFlag(u.cfg, u.DeletionPropagation), kube.DeleteOptions{
-				Wait:                   true,
-				SkipIfInvalidOwnership: true,
-				ReleaseName:            rel.Name,
-				ReleaseNamespace:       rel.Namespace,
-			})
-			return resources, kept, errs
-		}
-
-		_, errs = u.cfg.KubeClient.Delete(resources, kube.DeleteOptions{
-			Wait:                   true,
-			SkipIfInvalidOwnership: true,
-			ReleaseName:            rel.Name,
-			ReleaseNamespace:       rel.Namespace,
-		})
+	if err := resources.Visit(releaseutil.SetGeneratedNamesVisitor(rel.GeneratedNames)); err != nil {
+		return nil, "", err
 	}
-	return resources, kept, errs
+
+	return resources, kept, nil
 }
 
 func parseCascadingFlag(cfg *Configuration, cascadingFlag string) v1.DeletionPropagation {
@@ -0,0 +1,355 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/werf/3p-helm/pkg/chartutil"
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+)
+
+// ErrUninstallNotConfirmed is returned by Uninstall.Run if the impact of the
+// uninstall is not confirmed.
+var ErrUninstallNotConfirmed = errors.New("uninstall not confirmed")
+
+// DeletionImpact describes what uninstalling a release deletes, with the data
+// that is lost or left behind.
+type DeletionImpact struct {
+	Release   string
+	Namespace string
+	// Resources are the resources deleted by the uninstall, as "Kind/name".
+	Resources []string
+	// Kept are the resources kept due to the resource policy, as "Kind/name".
+	Kept []string
+	// PersistentVolumeClaims are deleted by the uninstall. The data of their
+	// volumes is lost, unless the reclaim policy of the volume is Retain.
+	PersistentVolumeClaims []PersistentVolumeClaimImpact
+	// OrphanedPersistentVolumeClaims are created from the volume claim
+	// templates of the StatefulSets of the release. They are not deleted and
+	// keep their data after the uninstall.
+	OrphanedPersistentVolumeClaims []string
+	// CustomResourceDefinitions are deleted by the uninstall along with all
+	// of their custom resources.
+	CustomResourceDefinitions []CustomResourceDefinitionImpact
+}
+
+// PersistentVolumeClaimImpact is a PersistentVolumeClaim deleted by an
+// uninstall.
+type PersistentVolumeClaimImpact struct {
+	Name string
+	// Volume is empty if the claim is not bound.
+	Volume        string
+	ReclaimPolicy corev1.PersistentVolumeReclaimPolicy
+}
+
+// LosesData reports whether the data of the claim is deleted with it.
+func (i PersistentVolumeClaimImpact) LosesData() bool {
+	return i.Volume != "" && i.ReclaimPolicy != corev1.PersistentVolumeReclaimRetain
+}
+
+// CustomResourceDefinitionImpact is a CustomResourceDefinition deleted by an
+// uninstall.
+type CustomResourceDefinitionImpact struct {
+	Name string
+	// CustomResources is the number of existing custom resources of the
+	// definition, in all namespaces.
+	CustomResources int
+}
+
+// Destructive reports whether the uninstall deletes data beyond the
+// resources of the release: volumes or custom resources.
+func (i *DeletionImpact) Destructive() bool {
+	for _, pvc := range i.PersistentVolumeClaims {
+		if pvc.LosesData() {
+			return true
+		}
+	}
+	for _, crd := range i.CustomResourceDefinitions {
+		if crd.CustomResources > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String formats the impact as a human readable report.
+func (i *DeletionImpact) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Uninstalling release %q in namespace %q deletes %d resource(s):\n", i.Release, i.Namespace, len(i.Resources))
+	for _, res := range i.Resources {
+		fmt.Fprintf(&b, "  %s\n", res)
+	}
+
+	if len(i.Kept) > 0 {
+		b.WriteString("Resources kept due to the resource policy:\n")
+		for _, res := range i.Kept {
+			fmt.Fprintf(&b, "  %s\n", res)
+		}
+	}
+
+	if len(i.PersistentVolumeClaims) > 0 {
+		b.WriteString("PersistentVolumeClaims deleted:\n")
+		for _, pvc := range i.PersistentVolumeClaims {
+			switch {
+			case pvc.Volume == "":
+				fmt.Fprintf(&b, "  %s: not bound\n", pvc.Name)
+			case pvc.LosesData():
+				fmt.Fprintf(&b, "  %s: DATA IS LOST, volume %s has reclaim policy %s\n", pvc.Name, pvc.Volume, pvc.ReclaimPolicy)
+			default:
+				fmt.Fprintf(&b, "  %s: volume %s is retained\n", pvc.Name, pvc.Volume)
+			}
+		}
+	}
+
+	if len(i.OrphanedPersistentVolumeClaims) > 0 {
+		b.WriteString("PersistentVolumeClaims of StatefulSets left behind with their data:\n")
+		for _, name := range i.OrphanedPersistentVolumeClaims {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+
+	if len(i.CustomResourceDefinitions) > 0 {
+		b.WriteString("CustomResourceDefinitions deleted:\n")
+		for _, crd := range i.CustomResourceDefinitions {
+			if crd.CustomResources > 0 {
+				fmt.Fprintf(&b, "  %s: DATA IS LOST, %d custom resource(s) are deleted\n", crd.Name, crd.CustomResources)
+			} else {
+				fmt.Fprintf(&b, "  %s: no custom resources\n", crd.Name)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// Impact returns what uninstalling the release would delete, without changing
+// anything.
+func (u *Uninstall) Impact(name string) (*DeletionImpact, error) {
+	if err := u.cfg.KubeClient.IsReachable(); err != nil {
+		return nil, err
+	}
+
+	if err := chartutil.ValidateReleaseName(name); err != nil {
+		return nil, errors.Errorf("uninstall: Release name is invalid: %s", name)
+	}
+
+	rels, err := u.cfg.Releases.History(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "uninstall: Release not loaded: %s", name)
+	}
+	if len(rels) < 1 {
+		return nil, errMissingRelease
+	}
+
+	releaseutil.SortByRevision(rels)
+
+	return u.impact(rels)
+}
+
+// impact returns what uninstalling the last release of the history would
+// delete.
+func (u *Uninstall) impact(rels []*release.Release) (*DeletionImpact, error) {
+	rel := rels[len(rels)-1]
+	impact := &DeletionImpact{Release: rel.Name, Namespace: rel.Namespace}
+
+	if rel.Info.Status == release.StatusUninstalled {
+		return impact, nil
+	}
+
+	deployedResources, err := phases.NewDeployedResourcesCalculator(rels, u.StagesSplitter, u.cfg.KubeClient).Calculate()
+	if err != nil {
+		return nil, fmt.Errorf("error calculating deployed resources: %w", err)
+	}
+
+	resources, kept, err := u.resourcesToDelete(rel, deployedResources)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, res := range resources {
+		impact.Resources = append(impact.Resources, fmt.Sprintf("%s/%s", res.Mapping.GroupVersionKind.Kind, res.Name))
+	}
+	for _, line := range strings.Split(strings.TrimSpace(kept), "\n") {
+		// Kept manifests are listed as "[Kind] name".
+		if kind, name, found := strings.Cut(strings.TrimPrefix(line, "["), "] "); found {
+			impact.Kept = append(impact.Kept, fmt.Sprintf("%s/%s", kind, name))
+		}
+	}
+
+	if !needsClusterInspection(resources) {
+		return impact, nil
+	}
+
+	clientSet, err := u.cfg.KubernetesClientSet()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to inspect the cluster")
+	}
+	restConfig, err := u.cfg.RESTClientGetter.ToRESTConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to generate config for kubernetes client")
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to inspect the cluster")
+	}
+
+	if err := inspectDeletionImpact(u.cfg.baseContext(), clientSet, dynamicClient, impact, resources); err != nil {
+		return nil, err
+	}
+
+	return impact, nil
+}
+
+func needsClusterInspection(resources kube.ResourceList) bool {
+	for _, res := range resources {
+		switch res.Mapping.GroupVersionKind.Kind {
+		case "PersistentVolumeClaim", "StatefulSet", "CustomResourceDefinition":
+			return true
+		}
+	}
+
+	return false
+}
+
+// inspectDeletionImpact adds the volumes and custom resources affected by the
+// deletion of the resources to the impact.
+func inspectDeletionImpact(ctx context.Context, clientSet kubernetes.Interface, dynamicClient dynamic.Interface, impact *DeletionImpact, resources kube.ResourceList) error {
+	for _, res := range resources {
+		obj, ok := res.Object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		switch res.Mapping.GroupVersionKind.Kind {
+		case "PersistentVolumeClaim":
+			pvcImpact, err := persistentVolumeClaimImpact(ctx, clientSet, res.Namespace, res.Name)
+			if err != nil {
+				return err
+			}
+			if pvcImpact != nil {
+				impact.PersistentVolumeClaims = append(impact.PersistentVolumeClaims, *pvcImpact)
+			}
+		case "StatefulSet":
+			orphaned, err := statefulSetClaims(ctx, clientSet, obj)
+			if err != nil {
+				return err
+			}
+			impact.OrphanedPersistentVolumeClaims = append(impact.OrphanedPersistentVolumeClaims, orphaned...)
+		case "CustomResourceDefinition":
+			count, err := countCustomResources(ctx, dynamicClient, obj)
+			if err != nil {
+				return err
+			}
+			impact.CustomResourceDefinitions = append(impact.CustomResourceDefinitions, CustomResourceDefinitionImpact{
+				Name:            res.Name,
+				CustomResources: count,
+			})
+		}
+	}
+
+	return nil
+}
+
+// persistentVolumeClaimImpact returns nil if the claim does not exist.
+func persistentVolumeClaimImpact(ctx context.Context, clientSet kubernetes.Interface, namespace, name string) (*PersistentVolumeClaimImpact, error) {
+	pvc, err := clientSet.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "unable to get PersistentVolumeClaim %s", name)
+	}
+
+	impact := &PersistentVolumeClaimImpact{Name: name, Volume: pvc.Spec.VolumeName}
+	if impact.Volume == "" {
+		return impact, nil
+	}
+
+	pv, err := clientSet.CoreV1().PersistentVolumes().Get(ctx, impact.Volume, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get PersistentVolume %s", impact.Volume)
+	}
+	impact.ReclaimPolicy = pv.Spec.PersistentVolumeReclaimPolicy
+
+	return impact, nil
+}
+
+// statefulSetClaims returns the existing claims created from the volume claim
+// templates of the StatefulSet, named "<template>-<statefulset>-<ordinal>".
+func statefulSetClaims(ctx context.Context, clientSet kubernetes.Interface, sts *unstructured.Unstructured) ([]string, error) {
+	templates, _, _ := unstructured.NestedSlice(sts.Object, "spec", "volumeClaimTemplates")
+	if len(templates) == 0 {
+		return nil, nil
+	}
+
+	pvcs, err := clientSet.CoreV1().PersistentVolumeClaims(sts.GetNamespace()).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list PersistentVolumeClaims of StatefulSet %s", sts.GetName())
+	}
+
+	var result []string
+	for _, template := range templates {
+		templateName, _, _ := unstructured.NestedString(template.(map[string]interface{}), "metadata", "name")
+		prefix := fmt.Sprintf("%s-%s-", templateName, sts.GetName())
+
+		for _, pvc := range pvcs.Items {
+			ordinal, found := strings.CutPrefix(pvc.Name, prefix)
+			if found && ordinal != "" && strings.Trim(ordinal, "0123456789") == "" {
+				result = append(result, pvc.Name)
+			}
+		}
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+func countCustomResources(ctx context.Context, dynamicClient dynamic.Interface, crd *unstructured.Unstructured) (int, error) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+
+	var version string
+	for _, v := range versions {
+		v, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if served, _, _ := unstructured.NestedBool(v, "served"); served {
+			version, _, _ = unstructured.NestedString(v, "name")
+			break
+		}
+	}
+	if version == "" {
+		// The v1beta1 definitions have a single version.
+		version, _, _ = unstructured.NestedString(crd.Object, "spec", "version")
+	}
+	if group == "" || plural == "" || version == "" {
+		return 0, nil
+	}
+
+	list, err := dynamicClient.Resource(schema.GroupVersionResource{Group: group, Version: version, Resource: plural}).
+		List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "unable to list custom resources of %s", crd.GetName())
+	}
+
+	return len(list.Items), nil
+}
@@ -0,0 +1,134 @@
+package action
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func impactResource(gvk schema.GroupVersionKind, name string, content map[string]interface{}) *resource.Info {
+	obj := &unstructured.Unstructured{Object: content}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(name)
+	obj.SetNamespace("spaced")
+
+	return &resource.Info{
+		Name:      name,
+		Namespace: "spaced",
+		Object:    obj,
+		Mapping:   &meta.RESTMapping{GroupVersionKind: gvk},
+	}
+}
+
+func TestInspectDeletionImpact(t *testing.T) {
+	is := assert.New(t)
+
+	pvc := func(name, volume string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "spaced"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: volume},
+		}
+	}
+	pv := func(name string, policy corev1.PersistentVolumeReclaimPolicy) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.PersistentVolumeSpec{PersistentVolumeReclaimPolicy: policy},
+		}
+	}
+
+	clientSet := fake.NewSimpleClientset(
+		pvc("uploads", "pv-uploads"), pv("pv-uploads", corev1.PersistentVolumeReclaimDelete),
+		pvc("backups", "pv-backups"), pv("pv-backups", corev1.PersistentVolumeReclaimRetain),
+		pvc("pending", ""),
+		pvc("data-db-0", "pv-db-0"), pvc("data-db-1", "pv-db-1"), pvc("data-db-old", "pv-db-old"),
+	)
+
+	widgets := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.com/v1")
+	widget.SetKind("Widget")
+	widget.SetName("first")
+	widget.SetNamespace("other")
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{widgets: "WidgetList"}, widget)
+
+	pvcKind := schema.GroupVersionKind{Version: "v1", Kind: "PersistentVolumeClaim"}
+	crdKind := schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}
+	resources := kube.ResourceList{
+		impactResource(pvcKind, "uploads", map[string]interface{}{}),
+		impactResource(pvcKind, "backups", map[string]interface{}{}),
+		impactResource(pvcKind, "pending", map[string]interface{}{}),
+		impactResource(pvcKind, "missing", map[string]interface{}{}),
+		impactResource(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}, "db", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"volumeClaimTemplates": []interface{}{
+					map[string]interface{}{"metadata": map[string]interface{}{"name": "data"}},
+				},
+			},
+		}),
+		impactResource(crdKind, "widgets.example.com", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"group":    "example.com",
+				"names":    map[string]interface{}{"plural": "widgets"},
+				"versions": []interface{}{map[string]interface{}{"name": "v1", "served": true}},
+			},
+		}),
+	}
+
+	impact := &DeletionImpact{Release: "app", Namespace: "spaced"}
+	is.NoError(inspectDeletionImpact(context.Background(), clientSet, dynamicClient, impact, resources))
+
+	is.Equal([]PersistentVolumeClaimImpact{
+		{Name: "uploads", Volume: "pv-uploads", ReclaimPolicy: corev1.PersistentVolumeReclaimDelete},
+		{Name: "backups", Volume: "pv-backups", ReclaimPolicy: corev1.PersistentVolumeReclaimRetain},
+		{Name: "pending"},
+	}, impact.PersistentVolumeClaims)
+	is.Equal([]string{"data-db-0", "data-db-1"}, impact.OrphanedPersistentVolumeClaims)
+	is.Equal([]CustomResourceDefinitionImpact{{Name: "widgets.example.com", CustomResources: 1}}, impact.CustomResourceDefinitions)
+	is.True(impact.Destructive())
+
+	report := impact.String()
+	is.Contains(report, "uploads: DATA IS LOST, volume pv-uploads has reclaim policy Delete")
+	is.Contains(report, "backups: volume pv-backups is retained")
+	is.Contains(report, "widgets.example.com: DATA IS LOST, 1 custom resource(s) are deleted")
+
+	is.False((&DeletionImpact{PersistentVolumeClaims: []PersistentVolumeClaimImpact{{Name: "pending"}}}).Destructive())
+}
+
+func TestUninstallRelease_NotConfirmed(t *testing.T) {
+	is := assert.New(t)
+
+	unAction := uninstallAction(t)
+	unAction.DisableHooks = true
+
+	rel := releaseStub()
+	rel.Name = "keep-me"
+	unAction.cfg.Releases.Create(rel)
+
+	var confirmedImpact *DeletionImpact
+	unAction.ConfirmImpact = func(impact *DeletionImpact) (bool, error) {
+		confirmedImpact = impact
+		return false, nil
+	}
+
+	_, err := unAction.Run(rel.Name)
+	is.ErrorIs(err, ErrUninstallNotConfirmed)
+	is.Equal("keep-me", confirmedImpact.Release)
+
+	stored, err := unAction.cfg.Releases.Get(rel.Name, rel.Version)
+	is.NoError(err)
+	is.Equal(release.StatusDeployed, stored.Info.Status)
+}
@@ -0,0 +1,87 @@
+package action
+
+import (
+	"strings"
+
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+// handleUnsupportedResources handles the resources whose readiness can't be
+// tracked according to the unsupported resources policy. It returns the
+// resources to deploy, the skipped ones and the ones deployed without
+// tracking them. The skipped resources, or the ones the deploy fails on, are
+// recorded in the report.
+func (cfg *Configuration) handleUnsupportedResources(resources kube.ResourceList, policy string, report *release.DeployReport) (deploy, skipped, untracked kube.ResourceList, err error) {
+	unsupportedPolicy, err := phases.ParseUnsupportedResourcesPolicy(policy)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	defaultEngine := kube.ReadinessEngineBuiltin
+	if kubeClient, ok := cfg.KubeClient.(kube.InterfaceReadinessEngine); ok {
+		defaultEngine = kubeClient.DefaultReadinessEngine()
+	}
+
+	unsupported, err := phases.UnsupportedResources(resources, defaultEngine)
+	if err != nil || len(unsupported) == 0 {
+		return resources, nil, nil, err
+	}
+
+	switch unsupportedPolicy {
+	case phases.UnsupportedResourcesPolicyFail:
+		var names []string
+		for _, res := range unsupported {
+			names = append(names, kube.ResourceNameNamespaceKind(res))
+		}
+		err := messages.Errorf(messages.ValidationUnsupportedResources, len(unsupported), unsupportedPolicy, strings.Join(names, ", "))
+		reportUnsupportedResources(report, unsupported, err)
+
+		return nil, nil, nil, err
+	case phases.UnsupportedResourcesPolicySkip:
+		for _, res := range unsupported {
+			cfg.Log(messages.Format(messages.ExecutorUnsupportedResourceSkipped), kube.ResourceNameNamespaceKind(res))
+		}
+		reportUnsupportedResources(report, unsupported, nil)
+
+		return resources.Difference(unsupported), unsupported, nil, nil
+	default:
+		for _, res := range unsupported {
+			cfg.warn(messages.Format(messages.ExecutorUnsupportedResourceNotTracked), kube.ResourceNameNamespaceKind(res))
+		}
+
+		return resources, nil, unsupported, nil
+	}
+}
+
+func reportUnsupportedResources(report *release.DeployReport, resources kube.ResourceList, err error) {
+	if report == nil {
+		return
+	}
+
+	for _, res := range resources {
+		report.AddResources(newUnsupportedResourceReport(res, err))
+	}
+}
+
+func newUnsupportedResourceReport(res *resource.Info, err error) *release.ResourceReport {
+	report := &release.ResourceReport{
+		Kind:        res.Mapping.GroupVersionKind.Kind,
+		Name:        res.Name,
+		Namespace:   res.Namespace,
+		Operation:   release.ResourceOperationSkip,
+		Phase:       release.PhaseRollout,
+		Status:      release.ResourceStatusSucceeded,
+		Unsupported: true,
+	}
+	if err != nil {
+		report.Status = release.ResourceStatusFailed
+		report.Error = err.Error()
+	}
+
+	return report
+}
@@ -0,0 +1,71 @@
+package action
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+func TestHandleUnsupportedResources(t *testing.T) {
+	is := assert.New(t)
+
+	newResources := func() (kube.ResourceList, kube.ResourceList) {
+		deployment := impactResource(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "app", nil)
+		database := impactResource(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Database"}, "db", nil)
+		untracked := impactResource(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Database"}, "cache", nil)
+		untracked.Object.(*unstructured.Unstructured).SetAnnotations(map[string]string{kube.TrackAnnotation: "false"})
+
+		return kube.ResourceList{deployment, database, untracked}, kube.ResourceList{database}
+	}
+
+	cfg := actionConfigFixture(t)
+
+	resources, unsupported := newResources()
+	report := release.NewDeployReport()
+	deploy, skipped, untracked, err := cfg.handleUnsupportedResources(resources, "", report)
+	is.NoError(err)
+	is.Equal(resources, deploy)
+	is.Empty(skipped)
+	is.Equal(unsupported, untracked)
+	is.Empty(report.Resources)
+
+	resources, unsupported = newResources()
+	report = release.NewDeployReport()
+	deploy, skipped, untracked, err = cfg.handleUnsupportedResources(resources, string(phases.UnsupportedResourcesPolicySkip), report)
+	is.NoError(err)
+	is.Equal(kube.ResourceList{resources[0], resources[2]}, deploy)
+	is.Equal(unsupported, skipped)
+	is.Empty(untracked)
+	if is.Len(report.Resources, 1) {
+		is.Equal(release.ResourceOperationSkip, report.Resources[0].Operation)
+		is.Equal(release.ResourceStatusSucceeded, report.Resources[0].Status)
+		is.True(report.Resources[0].Unsupported)
+	}
+
+	resources, _ = newResources()
+	report = release.NewDeployReport()
+	_, _, _, err = cfg.handleUnsupportedResources(resources, string(phases.UnsupportedResourcesPolicyFail), report)
+	is.ErrorContains(err, "db")
+	if is.Len(report.Resources, 1) {
+		is.Equal(release.ResourceStatusFailed, report.Resources[0].Status)
+		is.True(report.Resources[0].Unsupported)
+	}
+
+	_, _, _, err = cfg.handleUnsupportedResources(resources, "ignore", report)
+	is.Error(err)
+
+	// kstatus tracks the custom resources.
+	cfg.KubeClient = &kube.Client{ReadinessEngine: kube.ReadinessEngineKStatus}
+	resources, _ = newResources()
+	deploy, skipped, untracked, err = cfg.handleUnsupportedResources(resources, string(phases.UnsupportedResourcesPolicyFail), release.NewDeployReport())
+	is.NoError(err)
+	is.Equal(resources, deploy)
+	is.Empty(skipped)
+	is.Empty(untracked)
+}
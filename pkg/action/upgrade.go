@@ -20,12 +20,15 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/werf/3p-helm/pkg/messages"
 	"github.com/werf/3p-helm/pkg/phases"
 	"github.com/werf/3p-helm/pkg/phases/phasemanagers"
 	"github.com/werf/3p-helm/pkg/phases/stages"
@@ -47,6 +50,19 @@ import (
 // It provides the implementation of 'helm upgrade'.
 type Upgrade struct {
 	cfg *Configuration
+	// deployReport collects the results of the rollout for DeployReportPath and the DeployExtender.
+	deployReport *release.DeployReport
+	// progress emits the progress events of the deploy to ProgressOutput.
+	progress *release.ProgressStream
+	// metrics records the metrics of the deploy if the configuration has Metrics.
+	metrics *deployMetrics
+	// result is the result of the last run.
+	result DeployResult
+	// untrackedResources are the unsupported resources applied without tracking them.
+	untrackedResources kube.ResourceList
+	// deployType selects the resources by the deploy-on annotation, install if the
+	// last release was uninstalled or never installed, upgrade otherwise.
+	deployType phases.DeployType
 
 	ChartPathOptions
 
@@ -68,6 +84,26 @@ type Upgrade struct {
 	SkipCRDs bool
 	// Timeout is the timeout for this operation
 	Timeout time.Duration
+	// InjectDeployMetadata annotates the pod templates of workloads with the
+	// release revision and the deploy time. Workloads with an unchanged pod
+	// template keep their annotations, so that they are not restarted.
+	InjectDeployMetadata bool
+	// WaitForOwnedResources, if set with Wait, also waits for the resources owned
+	// by custom resources, such as the workloads created by operators, and reports
+	// their failures.
+	WaitForOwnedResources bool
+	// HooksTimeout, if set, is the time to wait for each hook to complete
+	// instead of Timeout. It is overridden by the werf.io/hook-timeout
+	// annotation of the hook.
+	HooksTimeout time.Duration
+	// HooksConcurrency is how many hooks of the same weight are executed at
+	// once. Hooks are executed one by one if it is 1 or less.
+	HooksConcurrency int
+	// HooksMaxFailures is how many hooks of the same weight may fail before
+	// the remaining ones are not executed: 1, the default, stops at the first
+	// failure, a negative number executes all of them and reports all the
+	// failures. It is overridden by the werf.io/hook-max-failures annotation.
+	HooksMaxFailures int
 	// Wait determines whether the wait operation should be performed after the upgrade is requested.
 	Wait bool
 	// WaitForJobs determines whether the wait operation for the Jobs should be performed after the upgrade is requested.
@@ -101,6 +137,75 @@ type Upgrade struct {
 	// Description is the description of this operation
 	Description string
 	Labels      map[string]string
+	// Metadata is arbitrary data recorded in the new revision. It is not
+	// inherited from the previous revision.
+	Metadata map[string]string
+	// RenderDebugDir, if set, is the directory to write the output, the context
+	// and the render time of every chart template into.
+	RenderDebugDir string
+	// RenderTimeout and TemplateRenderTimeout, if set, limit the total render
+	// time of the chart and the render time of every template.
+	RenderTimeout         time.Duration
+	TemplateRenderTimeout time.Duration
+	// ImageDigestCacheFile, if set, is the JSON file the image digests resolved
+	// by the "werf_image" template function are stored in. It is read when the
+	// registry is unreachable.
+	ImageDigestCacheFile string
+	// ManifestLimits are enforced on the rendered manifests.
+	ManifestLimits ManifestLimits
+	// IncludeResources and ExcludeResources select the chart resources to deploy,
+	// e.g. "Deployment/backend-*" or "label:app.kubernetes.io/component=db". The
+	// excluded resources are left as is in the cluster.
+	IncludeResources []string
+	ExcludeResources []string
+	// WatchEvents collects the Warning events of the release resources and of the
+	// objects they create, e.g. Pods, while deploying and adds them to the error
+	// if the deploy fails.
+	WatchEvents bool
+	// APIUnavailabilityBudget is how long the deploy is paused, in total, while
+	// the Kubernetes API server is unavailable before it fails. Zero disables
+	// pausing.
+	APIUnavailabilityBudget time.Duration
+	// ImmutableGenerationsToKeep is how many of the last revisions keep their
+	// generations of immutable ConfigMaps and Secrets instead of deleting them
+	// after the deploy. Zero deletes them as any other orphaned resource.
+	ImmutableGenerationsToKeep int
+	// PrunePolicy is what is done with the orphaned resources after the
+	// rollout: "prune" (default) deletes them, "warn-only" keeps them with a
+	// warning and "keep" keeps them. Resources annotated with
+	// phases.NoPruneAnnotation are always kept.
+	PrunePolicy string
+	// UnsupportedResourcesPolicy is what is done, when waiting for the
+	// resources without their owned resources, with the resources whose
+	// readiness can't be tracked: "warn" (default) applies them without
+	// tracking with a warning, "fail" fails the deploy and "skip" skips them.
+	UnsupportedResourcesPolicy string
+	// RelaxPodDisruptionBudgets lets the pods selected by the
+	// PodDisruptionBudgets of the workloads be disrupted while the resources
+	// are applied and tracked, setting maxUnavailable of the budgets to 100%
+	// and restoring them after the rollout. The budgets which are resources of
+	// the release are not relaxed.
+	RelaxPodDisruptionBudgets bool
+	// VerifyCronJobs creates, in the dry-run mode, a Job from the job template
+	// of every deployed CronJob, so that the Jobs which would be rejected, e.g.
+	// by admission webhooks, fail the deploy instead of the next scheduled run
+	// of the CronJob.
+	VerifyCronJobs bool
+	// MigrateCRDStoredVersions migrates the stored objects of the
+	// CustomResourceDefinitions whose update removes the versions still listed
+	// in their status.storedVersions before the rollout, rather than failing
+	// the deploy.
+	MigrateCRDStoredVersions bool
+	// ReleaseDependencies are releases, in the format of ParseReleaseDependency,
+	// to wait for before the deploy in addition to the ones declared by the
+	// ReleaseDependencyAnnotationPrefix chart annotations. They are waited for
+	// up to Timeout.
+	ReleaseDependencies []string
+	// AdoptResources are matchers, in the format of phases.ParseResourceMatcher,
+	// of the existing resources not belonging to any release which are adopted
+	// by the release instead of failing the deploy. They are matched against
+	// the live objects, e.g. "label:app.kubernetes.io/instance=backend".
+	AdoptResources []string
 	// PostRender is an optional post-renderer
 	//
 	// If this is non-nil, then after templates are rendered, they will be sent to the
@@ -114,10 +219,41 @@ type Upgrade struct {
 	Lock sync.Mutex
 	// Enable DNS lookups when rendering templates
 	EnableDNS bool
-
-	DeployReportPath            string
+	// ClusterScoped forbids namespaced resources in the release. The release namespace is only used to
+	// store the release records.
+	ClusterScoped bool
+	// ControlNamespace, if set, is the namespace of the ClusterScoped release, which its records are
+	// stored in, instead of the namespace of the configuration.
+	ControlNamespace string
+
+	DeployReportPath   string
+	DeployReportFormat string
+	// PlanOutputPath, if set, is the file the DeployPlan of the upgrade is written to before
+	// the upgrade, e.g. for the CI to archive and review what is deployed.
+	PlanOutputPath string
+	// PlanOutputFormat is the format of the deploy plan, "json" (default) or "yaml".
+	PlanOutputFormat string
+	// ProgressOutput, if set, receives the progress events of the deploy as JSON lines, see release.ProgressStream.
+	ProgressOutput io.Writer
+	// LogsTailWindow limits the logs of every container of the tracked resources shown by the
+	// ResourcesWaiter of the kube client to the last lines or the last period, see kube.LogsOptions.
+	LogsTailWindow kube.LogsTailWindow
+	// HideLogs turns the logs of the containers of the tracked resources off, keeping the other
+	// messages of the tracking.
+	HideLogs bool
+	// LogsDir, if set, is the directory the streamed logs of the containers of the tracked resources
+	// are written to, per resource and container, see kube.ContainerLogFiles.
+	LogsDir string
+	// Notifiers are notified of the start and the end of the deploy.
+	Notifiers []Notifier
+	// NotificationReportURL is the link to the deploy report passed to the Notifiers, e.g. the one
+	// of the report of DeployReportPath published by the CI.
+	NotificationReportURL string
+	// ValuesFiles are the values files the values were merged from, in order, recorded in the deploy report.
+	ValuesFiles                 []string
 	StagesSplitter              phases.Splitter
 	StagesExternalDepsGenerator phases.ExternalDepsGenerator
+	DeployExtender              phases.DeployExtender
 	IgnorePending               bool
 }
 
@@ -129,6 +265,7 @@ type resultMessage struct {
 type UpgradeOptions struct {
 	StagesSplitter              phases.Splitter
 	StagesExternalDepsGenerator phases.ExternalDepsGenerator
+	DeployExtender              phases.DeployExtender
 	IgnorePending               bool
 }
 
@@ -141,7 +278,12 @@ func NewUpgrade(cfg *Configuration, opts UpgradeOptions) *Upgrade {
 
 	stagesExternalDepsGenerator := opts.StagesExternalDepsGenerator
 	if stagesExternalDepsGenerator == nil {
-		stagesExternalDepsGenerator = &phases.NoExternalDepsGenerator{}
+		stagesExternalDepsGenerator = cfg.externalDepsGenerator()
+	}
+
+	deployExtender := opts.DeployExtender
+	if deployExtender == nil {
+		deployExtender = &phases.NoDeployExtender{}
 	}
 
 	up := &Upgrade{
@@ -149,6 +291,7 @@ func NewUpgrade(cfg *Configuration, opts UpgradeOptions) *Upgrade {
 
 		StagesSplitter:              stagesSplitter,
 		StagesExternalDepsGenerator: stagesExternalDepsGenerator,
+		DeployExtender:              deployExtender,
 		IgnorePending:               opts.IgnorePending,
 	}
 	up.ChartPathOptions.registryClient = cfg.RegistryClient
@@ -168,7 +311,45 @@ func (u *Upgrade) Run(name string, chart *chart.Chart, vals map[string]interface
 }
 
 // RunWithContext executes the upgrade on the given release with context.
+//
+// When the task is cancelled through ctx or its deadline is exceeded, the
+// Kubernetes API calls and the waits of the upgrade are cancelled, and the
+// function returns once the upgrade is stopped.
 func (u *Upgrade) RunWithContext(ctx context.Context, name string, chart *chart.Chart, vals map[string]interface{}) (*release.Release, error) {
+	var warnings int32
+	cfg := u.cfg
+	u.cfg = cfg.withContext(ctx).withWarningsCounter(&warnings)
+	defer func() { u.cfg = cfg }()
+
+	rel, err := u.run(ctx, name, chart, vals)
+	u.result = newDeployResult(err, atomic.LoadInt32(&warnings))
+
+	return rel, err
+}
+
+// Result returns the result of the last run of the upgrade.
+func (u *Upgrade) Result() DeployResult {
+	return u.result
+}
+
+func (u *Upgrade) run(ctx context.Context, name string, chart *chart.Chart, vals map[string]interface{}) (*release.Release, error) {
+	if err := release.ValidateDeployReportFormat(u.DeployReportFormat); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+	if err := ValidateDeployPlanFormat(u.PlanOutputFormat); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+	if _, err := phases.ParsePrunePolicy(u.PrunePolicy); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+	if _, err := phases.ParseUnsupportedResourcesPolicy(u.UnsupportedResourcesPolicy); err != nil {
+		return nil, newDeployError(DeployResultFailedValidation, err)
+	}
+
+	if u.ClusterScoped && u.ControlNamespace != "" {
+		u.cfg = u.cfg.withControlNamespace(u.ControlNamespace)
+	}
+
 	if err := u.cfg.KubeClient.IsReachable(); err != nil {
 		return nil, err
 	}
@@ -178,8 +359,16 @@ func (u *Upgrade) RunWithContext(ctx context.Context, name string, chart *chart.
 	u.Wait = u.Wait || u.Atomic
 
 	if err := chartutil.ValidateReleaseName(name); err != nil {
-		return nil, errors.Errorf("release name is invalid: %s", name)
+		return nil, newDeployError(DeployResultFailedValidation, errors.Errorf("release name is invalid: %s", name))
+	}
+
+	// Concurrent deploys of the release wait for each other, if the storage
+	// supports it.
+	unlock, err := u.cfg.Releases.LockRelease(name)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 
 	u.cfg.Log("preparing upgrade for %s", name)
 	currentRelease, upgradedRelease, err := u.prepareUpgrade(name, chart, vals)
@@ -187,21 +376,45 @@ func (u *Upgrade) RunWithContext(ctx context.Context, name string, chart *chart.
 		return nil, err
 	}
 
+	u.deployReport = release.NewDeployReport()
+	u.progress = release.NewProgressStream(u.ProgressOutput)
+	logFiles := kube.NewContainerLogFiles(u.LogsDir)
+	defer func() {
+		if err := logFiles.Close(); err != nil {
+			u.cfg.warn("%s", err)
+		}
+	}()
+	u.cfg = u.cfg.withLogsOptions(newLogsOptions(u.HideLogs, u.LogsTailWindow, logFiles, u.progress, upgradedRelease))
+	u.metrics = u.cfg.Metrics.startDeploy("upgrade", upgradedRelease)
+	u.deployReport.ValuesFiles = u.ValuesFiles
+
 	if !u.isDryRun() && u.DeployReportPath != "" {
 		defer func() {
-			deployReportData, err := release.NewDeployReport().FromRelease(upgradedRelease).ToJSONData()
+			deployReportData, err := u.deployReport.FromRelease(upgradedRelease).ToData(u.DeployReportFormat)
 			if err != nil {
-				u.cfg.Log("warning: error creating deploy report data: %s", err)
+				u.cfg.warn("error creating deploy report data: %s", err)
 				return
 			}
 
 			if err := os.WriteFile(u.DeployReportPath, deployReportData, 0o644); err != nil {
-				u.cfg.Log("warning: error writing deploy report file: %s", err)
+				u.cfg.warn("error writing deploy report file: %s", err)
 				return
 			}
 		}()
 	}
 
+	if !u.isDryRun() {
+		notifier := startDeployNotifications(u.cfg, u.Notifiers, u.NotificationReportURL, "upgrade", upgradedRelease)
+		defer func() {
+			report := u.deployReport.FromRelease(upgradedRelease)
+			u.metrics.finish(report)
+			notifier.finish(report)
+			if err := u.DeployExtender.AfterDeploy(upgradedRelease, report); err != nil {
+				u.cfg.warn("error after deploy: %s", err)
+			}
+		}()
+	}
+
 	u.cfg.Releases.MaxHistory = u.MaxHistory
 
 	u.cfg.Log("performing update for %s", name)
@@ -273,10 +486,22 @@ func (u *Upgrade) prepareUpgrade(name string, chart *chart.Chart, vals map[strin
 		return nil, nil, err
 	}
 
-	if err := chartutil.ProcessDependenciesWithMerge(chart, &vals); err != nil {
+	caps, err := u.cfg.getCapabilities()
+	if err != nil {
 		return nil, nil, err
 	}
 
+	// Dependency conditions may reference the capabilities.
+	dependencies, err := chartutil.ProcessDependenciesWithMergeAndReport(chart, &vals, caps)
+	if err != nil {
+		return nil, nil, newDeployError(DeployResultFailedRender, err)
+	}
+
+	u.deployType = phases.DeployTypeInstall
+	if isUpgrade {
+		u.deployType = phases.DeployTypeUpgrade
+	}
+
 	// Increment revision count. This is passed to templates, and also stored on
 	// the release object.
 	revision := lastRelease.Version + 1
@@ -289,13 +514,9 @@ func (u *Upgrade) prepareUpgrade(name string, chart *chart.Chart, vals map[strin
 		IsUpgrade: isUpgrade,
 	}
 
-	caps, err := u.cfg.getCapabilities()
-	if err != nil {
-		return nil, nil, err
-	}
 	valuesToRender, err := chartutil.ToRenderValues(chart, vals, options, caps)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, newDeployError(DeployResultFailedRender, err)
 	}
 
 	// Determine whether or not to interact with remote
@@ -304,13 +525,20 @@ func (u *Upgrade) prepareUpgrade(name string, chart *chart.Chart, vals map[strin
 		interactWithRemote = true
 	}
 
-	hooks, manifestDoc, notesTxt, err := u.cfg.renderResources(chart, valuesToRender, "", "", u.SubNotes, false, false, u.PostRenderer, interactWithRemote, u.EnableDNS)
+	hooks, manifestDoc, notesTxt, err := u.cfg.renderResources(chart, valuesToRender, "", "", u.SubNotes, false, false, u.PostRenderer, interactWithRemote, u.EnableDNS, renderOptions{
+		DebugDir:             u.RenderDebugDir,
+		TemplateTimeout:      u.TemplateRenderTimeout,
+		Timeout:              u.RenderTimeout,
+		Limits:               u.ManifestLimits,
+		ImageResolver:        imageResolver(u.registryClient, u.cfg.RegistryClient),
+		ImageDigestCacheFile: u.ImageDigestCacheFile,
+	})
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, newDeployError(DeployResultFailedRender, err)
 	}
 
 	if driver.ContainsSystemLabels(u.Labels) {
-		return nil, nil, fmt.Errorf("user suplied labels contains system reserved label name. System labels: %+v", driver.GetSystemLabels())
+		return nil, nil, newDeployError(DeployResultFailedValidation, fmt.Errorf("user suplied labels contains system reserved label name. System labels: %+v", driver.GetSystemLabels()))
 	}
 
 	// Store an upgraded release.
@@ -329,37 +557,99 @@ func (u *Upgrade) prepareUpgrade(name string, chart *chart.Chart, vals map[strin
 		Manifest: manifestDoc.String(),
 		Hooks:    hooks,
 		Labels:   mergeCustomLabels(lastRelease.Labels, u.Labels),
+		Metadata: u.Metadata,
+		// Dependencies are reported as they were resolved for this revision.
+		Dependencies: dependencies,
+		// Resources using metadata.generateName keep their names across revisions.
+		GeneratedNames: mergeStrStrMaps(currentRelease.GeneratedNames, nil),
 	})
 
 	if len(notesTxt) > 0 {
 		upgradedRelease.Info.Notes = notesTxt
 	}
 	err = validateManifest(u.cfg.KubeClient, manifestDoc.Bytes(), !u.DisableOpenAPIValidation)
-	return currentRelease, upgradedRelease, err
+	return currentRelease, upgradedRelease, newDeployError(DeployResultFailedValidation, err)
 }
 
-func (u *Upgrade) performUpgrade(ctx context.Context, originalRelease, upgradedRelease *release.Release) (*release.Release, error) {
-	current, err := u.cfg.KubeClient.Build(bytes.NewBufferString(originalRelease.Manifest), false)
+// buildResources builds the resources of the current and the upgraded
+// releases. Returns the resources to deploy, the ones skipped because of
+// werf.io/deploy-on or the resource selection and the ones not in the current
+// release.
+func (u *Upgrade) buildResources(originalRelease, upgradedRelease *release.Release) (target, skippedTarget, toBeCreated kube.ResourceList, err error) {
+	var current kube.ResourceList
+	current, err = u.cfg.KubeClient.Build(bytes.NewBufferString(originalRelease.Manifest), false)
+	if err == nil {
+		err = current.Visit(releaseutil.SetGeneratedNamesVisitor(originalRelease.GeneratedNames))
+	}
+	if err == nil {
+		err = phases.VersionImmutableResources(current, originalRelease.Hooks, originalRelease.Namespace)
+	}
 	if err != nil {
 		// Checking for removed Kubernetes API error so can provide a more informative error message to the user
 		// Ref: https://github.com/helm/helm/issues/7219
 		if strings.Contains(err.Error(), "unable to recognize \"\": no matches for kind") {
-			return upgradedRelease, errors.Wrap(err, "current release manifest contains removed kubernetes api(s) for this "+
+			return nil, nil, nil, errors.Wrap(err, "current release manifest contains removed kubernetes api(s) for this "+
 				"kubernetes version and it is therefore unable to build the kubernetes "+
 				"objects for performing the diff. error from kubernetes; "+fmt.Sprintf("unable to load original manifests:\n%s\n---\nupgraded release manifests:\n%s\n---\nPlease report to https://github.com/werf/werf/issues if this error have occured for an actual api version", originalRelease.Manifest, upgradedRelease.Manifest))
 
 		}
-		return upgradedRelease, errors.Wrap(err, "unable to build kubernetes objects from current release manifest")
+		return nil, nil, nil, errors.Wrap(err, "unable to build kubernetes objects from current release manifest")
 	}
-	target, err := u.cfg.KubeClient.Build(bytes.NewBufferString(upgradedRelease.Manifest), !u.DisableOpenAPIValidation)
+	target, err = u.cfg.KubeClient.Build(bytes.NewBufferString(upgradedRelease.Manifest), !u.DisableOpenAPIValidation)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "unable to build kubernetes objects from new release manifest")
+	}
+
+	if err := target.Visit(releaseutil.SetGeneratedNamesVisitor(upgradedRelease.GeneratedNames)); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Conflicts and adoption are checked against the names the resources are deployed with.
+	if err := phases.VersionImmutableResources(target, upgradedRelease.Hooks, upgradedRelease.Namespace); err != nil {
+		return nil, nil, nil, err
+	}
+
+	target, skippedTarget, err = phases.SplitResourcesByDeployOn(target, u.deployType)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	target, excludedTarget, err := selectResources(upgradedRelease, target, u.IncludeResources, u.ExcludeResources)
 	if err != nil {
-		return upgradedRelease, errors.Wrap(err, "unable to build kubernetes objects from new release manifest")
+		return nil, nil, nil, err
+	}
+	skippedTarget.Merge(excludedTarget)
+
+	u.untrackedResources = nil
+	if u.Wait && !u.WaitForOwnedResources {
+		var unsupportedResources kube.ResourceList
+		target, unsupportedResources, u.untrackedResources, err = u.cfg.handleUnsupportedResources(target, u.UnsupportedResourcesPolicy, u.deployReport)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		skippedTarget.Merge(unsupportedResources)
+	}
+
+	if u.ClusterScoped {
+		if err := validateClusterScoped(u.cfg.KubeClient, target, upgradedRelease.Hooks); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if err := kube.ValidateLoggedContainers(target); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// It is safe to use force only on target because these are resources currently rendered by the chart.
 	err = target.Visit(releaseutil.SetMetadataVisitor(upgradedRelease.Name, upgradedRelease.Namespace, true))
 	if err != nil {
-		return upgradedRelease, err
+		return nil, nil, nil, err
+	}
+
+	if u.InjectDeployMetadata {
+		if err := target.Visit(releaseutil.SetDeployMetadataVisitor(current, upgradedRelease.Version, upgradedRelease.Info.LastDeployed.Time)); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
 	// Do a basic diff using gvk + name to figure out what new resources are being created so we can validate they don't already exist
@@ -368,16 +658,24 @@ func (u *Upgrade) performUpgrade(ctx context.Context, originalRelease, upgradedR
 		existingResources[objectKey(r)] = true
 	}
 
-	var toBeCreated kube.ResourceList
 	for _, r := range target {
 		if !existingResources[objectKey(r)] {
 			toBeCreated = append(toBeCreated, r)
 		}
 	}
 
-	toBeAdopted, err := existingResourceConflict(toBeCreated, upgradedRelease.Name, upgradedRelease.Namespace)
+	return target, skippedTarget, toBeCreated, nil
+}
+
+func (u *Upgrade) performUpgrade(ctx context.Context, originalRelease, upgradedRelease *release.Release) (*release.Release, error) {
+	target, skippedTarget, toBeCreated, err := u.buildResources(originalRelease, upgradedRelease)
+	if err != nil {
+		return upgradedRelease, newDeployError(DeployResultFailedValidation, err)
+	}
+
+	toBeAdopted, err := existingResourceConflict(toBeCreated, upgradedRelease.Name, upgradedRelease.Namespace, u.cfg, u.AdoptResources)
 	if err != nil {
-		return nil, errors.Wrap(err, "Unable to continue with update")
+		return nil, newDeployError(DeployResultFailedValidation, errors.Wrap(err, "Unable to continue with update"))
 	}
 
 	// Run if it is a dry run
@@ -391,53 +689,57 @@ func (u *Upgrade) performUpgrade(ctx context.Context, originalRelease, upgradedR
 		return upgradedRelease, nil
 	}
 
-	u.cfg.Log("creating upgraded release for %s", upgradedRelease.Name)
-	if err := u.cfg.Releases.Create(upgradedRelease); err != nil {
+	if u.PlanOutputPath != "" {
+		if err := u.cfg.writeDeployPlan(u.PlanOutputPath, u.PlanOutputFormat, upgradedRelease, target, skippedTarget, toBeAdopted, u.deployPlanOptions()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := u.cfg.waitForReleaseDependencies(ctx, upgradedRelease.Chart, u.ReleaseDependencies, upgradedRelease.Namespace, u.Timeout); err != nil {
 		return nil, err
 	}
-	rChan := make(chan resultMessage)
-	ctxChan := make(chan resultMessage)
-	doneChan := make(chan interface{})
-	defer close(doneChan)
-	go u.releasingUpgrade(rChan, upgradedRelease, toBeAdopted, target, originalRelease)
-	go u.handleContext(ctx, doneChan, ctxChan, upgradedRelease)
-	select {
-	case result := <-rChan:
-		return result.r, result.e
-	case result := <-ctxChan:
-		return result.r, result.e
+
+	u.cfg.Log("creating upgraded release for %s", upgradedRelease.Name)
+	// Another upgrade might have taken the revision since the history was read.
+	if err := u.cfg.Releases.CreateRevision(upgradedRelease); err != nil {
+		return nil, err
 	}
+	rChan := make(chan resultMessage, 1)
+	go u.releasingUpgrade(rChan, upgradedRelease, toBeAdopted, target, skippedTarget, originalRelease)
+	result := <-rChan
+	return result.r, result.e
 }
 
 // Function used to lock the Mutex, this is important for the case when the atomic flag is set.
 // In that case the upgrade will finish before the rollback is finished so it is necessary to wait for the rollback to finish.
 // The rollback will be trigger by the function failRelease
+//
+// If the upgrade was cancelled, it fails with the error of the context.
 func (u *Upgrade) reportToPerformUpgrade(c chan<- resultMessage, rel *release.Release, created kube.ResourceList, err error) {
 	u.Lock.Lock()
 	if err != nil {
+		if ctxErr := u.cfg.baseContext().Err(); ctxErr != nil {
+			err = ctxErr
+		}
 		rel, err = u.failRelease(rel, created, err)
 	}
 	c <- resultMessage{r: rel, e: err}
 	u.Lock.Unlock()
 }
 
-// Setup listener for SIGINT and SIGTERM
-func (u *Upgrade) handleContext(ctx context.Context, done chan interface{}, c chan<- resultMessage, upgradedRelease *release.Release) {
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-
-		// when the atomic flag is set the ongoing release finish first and doesn't give time for the rollback happens.
-		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, err)
-	case <-done:
-		return
-	}
-}
-func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *release.Release, toBeAdopted kube.ResourceList, target kube.ResourceList, originalRelease *release.Release) {
+func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *release.Release, toBeAdopted, target, skippedTarget kube.ResourceList, originalRelease *release.Release) {
 	// pre-upgrade hooks
 
 	if !u.DisableHooks {
-		if err := u.cfg.execHook(upgradedRelease, release.HookPreUpgrade, u.Timeout); err != nil {
+		if err := u.DeployExtender.BeforePhase(upgradedRelease, release.PhaseHooksPre); err != nil {
+			u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorBeforeHooks, release.HookPreUpgrade, err))
+			return
+		}
+		u.progress.PhaseStarted(upgradedRelease, release.PhaseHooksPre)
+		u.metrics.phaseStarted(release.PhaseHooksPre)
+		err := u.cfg.execHook(upgradedRelease, release.HookPreUpgrade, u.Timeout, u.HooksTimeout, u.HooksConcurrency, u.HooksMaxFailures)
+		u.progress.HooksFinished(upgradedRelease, release.HookPreUpgrade)
+		if err != nil {
 			u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, fmt.Errorf("pre-upgrade hooks failed: %s", err))
 			return
 		}
@@ -448,7 +750,13 @@ func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *rele
 	history, err := u.cfg.Releases.HistoryUntilRevision(upgradedRelease.Name, upgradedRelease.Version)
 	if err != nil {
 		u.cfg.recordRelease(originalRelease)
-		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, fmt.Errorf("error getting release history: %w", err))
+		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorGetReleaseHistory, err))
+		return
+	}
+
+	if err := u.DeployExtender.BeforePlan(upgradedRelease, target); err != nil {
+		u.cfg.recordRelease(originalRelease)
+		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorBeforePlanningRollout, err))
 		return
 	}
 
@@ -456,13 +764,20 @@ func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *rele
 		ParseStages(target)
 	if err != nil {
 		u.cfg.recordRelease(originalRelease)
-		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, fmt.Errorf("error parsing stages for rollout phase: %w", err))
+		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorParseStages, err))
 		return
 	}
+	rolloutPhase.SkipResources(skippedTarget)
 
 	if err := rolloutPhase.GenerateStagesExternalDeps(u.StagesExternalDepsGenerator); err != nil {
 		u.cfg.recordRelease(originalRelease)
-		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, fmt.Errorf("error generating external deps for rollout phase: %w", err))
+		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorGenerateExternalDependencies, err))
+		return
+	}
+
+	if err := u.DeployExtender.AfterPlan(upgradedRelease, rolloutPhase.SortedStages); err != nil {
+		u.cfg.recordRelease(originalRelease)
+		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorAfterPlanningRollout, err))
 		return
 	}
 
@@ -470,24 +785,70 @@ func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *rele
 
 	rolloutPhaseManager, err := phasemanagers.NewRolloutPhaseManager(rolloutPhase, deployedResourcesCalculator, upgradedRelease, u.cfg.Releases, u.cfg.KubeClient).
 		AddPreviouslyDeployedResources(toBeAdopted).
+		WithAPIUnavailabilityBudget(u.APIUnavailabilityBudget, u.cfg.Log).
+		WithWarn(u.cfg.warn).
+		WithImmutableGenerationsToKeep(u.ImmutableGenerationsToKeep).
+		WithPrunePolicy(phases.PrunePolicy(u.PrunePolicy)).
+		WithUnsupportedResources(u.untrackedResources).
+		WithDeployReport(u.deployReport).
+		WithProgressStream(u.progress).
 		AddCalculatedPreviouslyDeployedResources()
 	if err != nil {
 		u.cfg.recordRelease(originalRelease)
-		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, fmt.Errorf("error calculating previously deployed resources for rollout phase manager: %w", err))
+		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorCalculatePreviouslyDeployed, err))
+		return
+	}
+
+	if err := u.DeployExtender.BeforePhase(upgradedRelease, release.PhaseRollout); err != nil {
+		u.cfg.recordRelease(originalRelease)
+		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorBeforeRollout, err))
 		return
 	}
+	u.progress.PhaseStarted(upgradedRelease, release.PhaseRollout)
+	u.metrics.phaseStarted(release.PhaseRollout)
+
+	if err := u.cfg.checkCRDStoredVersions(rolloutPhase.SortedStages.MergedDesiredResources(), u.MigrateCRDStoredVersions); err != nil {
+		u.cfg.recordRelease(originalRelease)
+		u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorCheckStoredVersions, err))
+		return
+	}
+
+	restorePodDisruptionBudgets := func() {}
+	if u.RelaxPodDisruptionBudgets {
+		restore, err := u.cfg.relaxPodDisruptionBudgets(rolloutPhase.SortedStages.MergedDesiredResources(), u.deployReport)
+		if err != nil {
+			u.cfg.recordRelease(originalRelease)
+			u.reportToPerformUpgrade(c, upgradedRelease, kube.ResourceList{}, messages.Errorf(messages.ExecutorRelaxPodDisruptionBudgets, err))
+			return
+		}
+		restorePodDisruptionBudgets = restore
+	}
 
-	if err := rolloutPhaseManager.DoStage(
+	var eventsWatcher *kube.EventsWatcher
+	if u.WatchEvents {
+		eventsWatcher = u.cfg.startEventsWatcher(upgradedRelease.Namespace, rolloutPhase.SortedStages)
+		defer eventsWatcher.Stop()
+	}
+
+	err = rolloutPhaseManager.DoStage(
 		func(stgIndex int, stage *stages.Stage) error {
+			// Deploy dependencies with the "ready" state or a condition are awaited even if waiting is disabled.
+			if len(stage.ReadyDependencies) > 0 {
+				if err := u.cfg.KubeClient.WaitWithJobs(stage.ReadyDependencies, u.Timeout); err != nil {
+					return messages.Errorf(messages.ExecutorWaitForDependencies, err)
+				}
+			}
+			if len(stage.ConditionDependencies) > 0 {
+				if err := u.cfg.waitForConditionDependencies(stage.ConditionDependencies, u.Timeout); err != nil {
+					return err
+				}
+			}
+
 			if len(stage.ExternalDependencies) == 0 || !u.Wait {
 				return nil
 			}
 
-			if u.WaitForJobs {
-				return u.cfg.KubeClient.WaitWithJobs(stage.ExternalDependencies.AsResourceList(), u.Timeout)
-			} else {
-				return u.cfg.KubeClient.Wait(stage.ExternalDependencies.AsResourceList(), u.Timeout)
-			}
+			return u.cfg.waitForExternalDependencies(stage.ExternalDependencies, u.WaitForJobs, u.Timeout)
 		},
 		func(stgIndex int, stage *stages.Stage, prevDeployedStgResources kube.ResourceList) error {
 			if len(prevDeployedStgResources) == 0 {
@@ -519,17 +880,41 @@ func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *rele
 			return nil
 		},
 		func(stgIndex int, stage *stages.Stage) error {
+			if stage.CanaryStep > 0 {
+				return u.cfg.verifyCanaries(upgradedRelease, stage, !u.DisableHooks, u.Timeout, u.HooksTimeout, u.HooksConcurrency, u.HooksMaxFailures)
+			}
+
+			if u.VerifyCronJobs {
+				if err := u.cfg.verifyCronJobs(stage.DesiredResources); err != nil {
+					return err
+				}
+			}
+
 			if !u.Wait {
 				return nil
 			}
 
+			tracked, err := kube.TrackedResources(stage.DesiredResources)
+			if err != nil || len(tracked) == 0 {
+				return err
+			}
+
+			if u.WaitForOwnedResources {
+				if kubeClient, ok := u.cfg.KubeClient.(kube.InterfaceWaitOwned); ok {
+					return kubeClient.WaitWithOwned(tracked, u.WaitForJobs, u.Timeout)
+				}
+			}
+
 			if u.WaitForJobs {
-				return u.cfg.KubeClient.WaitWithJobs(stage.DesiredResources, u.Timeout)
+				return u.cfg.KubeClient.WaitWithJobs(tracked, u.Timeout)
 			} else {
-				return u.cfg.KubeClient.Wait(stage.DesiredResources, u.Timeout)
+				return u.cfg.KubeClient.Wait(tracked, u.Timeout)
 			}
 		},
-	); err != nil {
+	)
+	restorePodDisruptionBudgets()
+	if err != nil {
+		err = eventsWatcher.WrapError(err)
 		u.cfg.recordRelease(originalRelease)
 
 		createdResourcesToDelete := kube.ResourceList{}
@@ -538,7 +923,7 @@ func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *rele
 			createdResourcesToDelete = rolloutPhaseManager.Phase.SortedStages[applyErr.StageIndex].Result.Created
 		}
 
-		u.reportToPerformUpgrade(c, upgradedRelease, createdResourcesToDelete, fmt.Errorf("error processing rollout phase stage: %w", err))
+		u.reportToPerformUpgrade(c, upgradedRelease, createdResourcesToDelete, messages.Errorf(messages.ExecutorProcessStage, err))
 
 		return
 	}
@@ -549,7 +934,15 @@ func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *rele
 
 	// post-upgrade hooks
 	if !u.DisableHooks {
-		if err := u.cfg.execHook(upgradedRelease, release.HookPostUpgrade, u.Timeout); err != nil {
+		if err := u.DeployExtender.BeforePhase(upgradedRelease, release.PhaseHooksPost); err != nil {
+			u.reportToPerformUpgrade(c, upgradedRelease, rolloutPhaseManager.Phase.SortedStages.MergedCreatedResources(), messages.Errorf(messages.ExecutorBeforeHooks, release.HookPostUpgrade, err))
+			return
+		}
+		u.progress.PhaseStarted(upgradedRelease, release.PhaseHooksPost)
+		u.metrics.phaseStarted(release.PhaseHooksPost)
+		err := u.cfg.execHook(upgradedRelease, release.HookPostUpgrade, u.Timeout, u.HooksTimeout, u.HooksConcurrency, u.HooksMaxFailures)
+		u.progress.HooksFinished(upgradedRelease, release.HookPostUpgrade)
+		if err != nil {
 			u.reportToPerformUpgrade(c, upgradedRelease, rolloutPhaseManager.Phase.SortedStages.MergedCreatedResources(), fmt.Errorf("post-upgrade hooks failed: %s", err))
 			return
 		}
@@ -569,14 +962,18 @@ func (u *Upgrade) releasingUpgrade(c chan<- resultMessage, upgradedRelease *rele
 
 func (u *Upgrade) failRelease(rel *release.Release, created kube.ResourceList, err error) (*release.Release, error) {
 	msg := fmt.Sprintf("Upgrade %q failed: %s", rel.Name, err)
-	u.cfg.Log("warning: %s", msg)
+	u.cfg.warn("%s", msg)
 
 	rel.Info.Status = release.StatusFailed
 	rel.Info.Description = msg
 	u.cfg.recordRelease(rel)
+
+	// The cleanup and the rollback are done even if the upgrade was cancelled.
+	cfg := u.cfg.withContext(context.Background())
+
 	if u.CleanupOnFail && len(created) > 0 {
 		u.cfg.Log("Cleanup on fail set, cleaning up %d resources", len(created))
-		_, errs := u.cfg.KubeClient.Delete(created, kube.DeleteOptions{
+		_, errs := cfg.KubeClient.Delete(created, kube.DeleteOptions{
 			Wait:                   true,
 			WaitTimeout:            u.Timeout,
 			SkipIfInvalidOwnership: true,
@@ -597,44 +994,81 @@ func (u *Upgrade) failRelease(rel *release.Release, created kube.ResourceList, e
 
 		// As a protection, get the last successful release before rollback.
 		// If there are no successful releases, bail out
-		hist := NewHistory(u.cfg)
+		hist := NewHistory(cfg)
 		fullHistory, herr := hist.Run(rel.Name)
 		if herr != nil {
 			return rel, errors.Wrapf(herr, "an error occurred while finding last successful release. original upgrade error: %s", err)
 		}
 
-		// There isn't a way to tell if a previous release was successful, but
-		// generally failed releases do not get superseded unless the next
-		// release is successful, so this should be relatively safe
-		filteredHistory := releaseutil.FilterFunc(func(r *release.Release) bool {
-			return r.Info.Status == release.StatusSuperseded || r.Info.Status == release.StatusDeployed
-		}).Filter(fullHistory)
-		if len(filteredHistory) == 0 {
+		lastSuccessful := lastSuccessfulRelease(fullHistory)
+		if lastSuccessful == nil {
 			return rel, errors.Wrap(err, "unable to find a previously successful release when attempting to rollback. original upgrade error")
 		}
 
-		releaseutil.Reverse(filteredHistory, releaseutil.SortByRevision)
-
-		rollin := NewRollback(u.cfg, u.StagesSplitter, u.StagesExternalDepsGenerator)
-		rollin.Version = filteredHistory[0].Version
+		// The rollback is tracked the same way and with the same timeouts as
+		// the failed upgrade.
+		rollin := NewRollback(cfg, u.StagesSplitter, u.StagesExternalDepsGenerator)
+		rollin.atomicUpgrade = true
+		rollin.DeployExtender = u.DeployExtender
+		rollin.Version = lastSuccessful.Version
 		rollin.Wait = true
 		rollin.WaitForJobs = u.WaitForJobs
+		rollin.WaitForOwnedResources = u.WaitForOwnedResources
+		rollin.InjectDeployMetadata = u.InjectDeployMetadata
 		rollin.DisableHooks = u.DisableHooks
 		rollin.Recreate = u.Recreate
 		rollin.Force = u.Force
 		rollin.Timeout = u.Timeout
+		rollin.HooksTimeout = u.HooksTimeout
+		rollin.HooksConcurrency = u.HooksConcurrency
+		rollin.HooksMaxFailures = u.HooksMaxFailures
+		rollin.WatchEvents = u.WatchEvents
+		rollin.APIUnavailabilityBudget = u.APIUnavailabilityBudget
+		rollin.MaxHistory = u.MaxHistory
 
 		rollin.CleanupOnFail = u.CleanupOnFail
+		rollin.ImmutableGenerationsToKeep = u.ImmutableGenerationsToKeep
+		rollin.PrunePolicy = u.PrunePolicy
+		rollin.UnsupportedResourcesPolicy = u.UnsupportedResourcesPolicy
+		rollin.RelaxPodDisruptionBudgets = u.RelaxPodDisruptionBudgets
+		rollin.VerifyCronJobs = u.VerifyCronJobs
+		rollin.MigrateCRDStoredVersions = u.MigrateCRDStoredVersions
+		rollin.ProgressOutput = u.ProgressOutput
+		rollin.LogsTailWindow = u.LogsTailWindow
+		rollin.HideLogs = u.HideLogs
+		rollin.LogsDir = u.LogsDir
+		rollin.Notifiers = u.Notifiers
+		rollin.NotificationReportURL = u.NotificationReportURL
 
 		if rollErr := rollin.Run(rel.Name); rollErr != nil {
 			return rel, errors.Wrapf(rollErr, "an error occurred while rolling back the release. original upgrade error: %s", err)
 		}
-		return rel, errors.Wrapf(err, "release %s failed, and has been rolled back due to atomic being set", rel.Name)
+		return rel, newDeployError(DeployResultRolledBack, errors.Wrapf(err, "release %s failed, and has been rolled back due to atomic being set", rel.Name))
 	}
 
 	return rel, err
 }
 
+// lastSuccessfulRelease returns the last revision that was deployed
+// successfully, or nil if there is none.
+//
+// There isn't a way to tell if a previous release was successful, but
+// generally failed releases do not get superseded unless the next release is
+// successful, so this should be relatively safe.
+func lastSuccessfulRelease(history []*release.Release) *release.Release {
+	var last *release.Release
+	for _, r := range history {
+		if r.Info.Status != release.StatusSuperseded && r.Info.Status != release.StatusDeployed {
+			continue
+		}
+		if last == nil || r.Version > last.Version {
+			last = r
+		}
+	}
+
+	return last
+}
+
 // reuseValues copies values from the current release to a new release if the
 // new release does not have any values.
 //
@@ -706,7 +1140,7 @@ func recreate(cfg *Configuration, resources kube.ResourceList) error {
 			return errors.Wrapf(err, "unable to recreate pods for object %s/%s because an error occurred", res.Namespace, res.Name)
 		}
 
-		pods, err := client.CoreV1().Pods(res.Namespace).List(context.Background(), metav1.ListOptions{
+		pods, err := client.CoreV1().Pods(res.Namespace).List(cfg.baseContext(), metav1.ListOptions{
 			LabelSelector: selector.String(),
 		})
 		if err != nil {
@@ -716,7 +1150,7 @@ func recreate(cfg *Configuration, resources kube.ResourceList) error {
 		// Restart pods
 		for _, pod := range pods.Items {
 			// Delete each pod for get them restarted with changed spec.
-			if err := client.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, *metav1.NewPreconditionDeleteOptions(string(pod.UID))); err != nil {
+			if err := client.CoreV1().Pods(pod.Namespace).Delete(cfg.baseContext(), pod.Name, *metav1.NewPreconditionDeleteOptions(string(pod.UID))); err != nil {
 				return errors.Wrapf(err, "unable to recreate pods for object %s/%s because an error occurred", res.Namespace, res.Name)
 			}
 		}
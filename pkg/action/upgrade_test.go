@@ -19,6 +19,7 @@ package action
 import (
 	"context"
 	"fmt"
+	"io"
 	"reflect"
 	"testing"
 	"time"
@@ -29,7 +30,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/werf/3p-helm/pkg/kube"
 	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/phases/stages"
 	"github.com/werf/3p-helm/pkg/release"
 	helmtime "github.com/werf/3p-helm/pkg/time"
 )
@@ -535,3 +539,149 @@ func TestUpgradeRelease_SystemLabels(t *testing.T) {
 
 	is.Equal(fmt.Errorf("user suplied labels contains system reserved label name. System labels: %+v", driver.GetSystemLabels()), err)
 }
+
+func TestLastSuccessfulRelease(t *testing.T) {
+	is := assert.New(t)
+
+	revision := func(version int, status release.Status) *release.Release {
+		rel := namedReleaseStub("history", status)
+		rel.Version = version
+		return rel
+	}
+
+	last := lastSuccessfulRelease([]*release.Release{
+		revision(1, release.StatusSuperseded),
+		revision(4, release.StatusFailed),
+		revision(3, release.StatusSuperseded),
+		revision(2, release.StatusFailed),
+		revision(5, release.StatusPendingUpgrade),
+	})
+	is.Equal(3, last.Version)
+
+	is.Nil(lastSuccessfulRelease([]*release.Release{revision(1, release.StatusFailed)}))
+}
+
+// recordingDeployExtender records the calls of the DeployExtender.
+type recordingDeployExtender struct {
+	calls []string
+}
+
+func (e *recordingDeployExtender) BeforePlan(rel *release.Release, _ kube.ResourceList) error {
+	e.calls = append(e.calls, fmt.Sprintf("before plan %d", rel.Version))
+	return nil
+}
+
+func (e *recordingDeployExtender) AfterPlan(rel *release.Release, _ stages.SortedStageList) error {
+	e.calls = append(e.calls, fmt.Sprintf("after plan %d", rel.Version))
+	return nil
+}
+
+func (e *recordingDeployExtender) BeforePhase(rel *release.Release, phase release.Phase) error {
+	e.calls = append(e.calls, fmt.Sprintf("before %s %d", phase, rel.Version))
+	return nil
+}
+
+func (e *recordingDeployExtender) AfterDeploy(rel *release.Release, report *release.DeployReport) error {
+	e.calls = append(e.calls, fmt.Sprintf("after deploy %d: %s", rel.Version, report.Status))
+	return nil
+}
+
+var _ phases.DeployExtender = (*recordingDeployExtender)(nil)
+
+// failingWaitKubeClient fails the first waits.
+type failingWaitKubeClient struct {
+	logsStreamingKubeClient
+
+	failures int
+}
+
+func (c *failingWaitKubeClient) WithLogsOptions(kube.LogsOptions) kube.Interface {
+	return c
+}
+
+func (c *failingWaitKubeClient) Wait(kube.ResourceList, time.Duration) error {
+	if c.failures > 0 {
+		c.failures--
+		return fmt.Errorf("timed out waiting for the resources")
+	}
+
+	return nil
+}
+
+func TestUpgradeRelease_DeployExtender(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	upAction := upgradeAction(t)
+	extender := &recordingDeployExtender{}
+	upAction.DeployExtender = extender
+	upAction.Wait = true
+
+	manifest := configMapManifest("app")
+	rel := releaseStub()
+	rel.Manifest = manifest
+	req.NoError(upAction.cfg.Releases.Create(rel))
+
+	ch := planTestChart("app")
+	upAction.cfg.KubeClient = &failingWaitKubeClient{logsStreamingKubeClient: logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}}
+	_, err := upAction.Run(rel.Name, ch, map[string]interface{}{})
+	req.NoError(err)
+	is.Equal([]string{
+		"before hooks-pre 2",
+		"before plan 2",
+		"after plan 2",
+		"before rollout 2",
+		"before hooks-post 2",
+		"after deploy 2: deployed",
+	}, extender.calls)
+
+	// The rollback of a failed atomic upgrade is part of the upgrade.
+	extender.calls = nil
+	upAction.Atomic = true
+	upAction.cfg.KubeClient = &failingWaitKubeClient{logsStreamingKubeClient: logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}, failures: 1}
+	_, err = upAction.Run(rel.Name, planTestChart("app"), map[string]interface{}{})
+	req.Error(err)
+	is.Contains(err.Error(), "has been rolled back")
+	is.Equal([]string{
+		"before hooks-pre 3",
+		"before plan 3",
+		"after plan 3",
+		"before rollout 3",
+		"before hooks-pre 4",
+		"before plan 4",
+		"after plan 4",
+		"before rollout 4",
+		"before hooks-post 4",
+		"after deploy 3: failed",
+	}, extender.calls)
+}
+
+func TestUpgradeRelease_DeployOnInstallAfterUninstall(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	upAction := upgradeAction(t)
+	upAction.cfg.KubeClient = &logsStreamingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+
+	rel := releaseStub()
+	rel.Info.Status = release.StatusUninstalled
+	req.NoError(upAction.cfg.Releases.Create(rel))
+
+	annotated := func(name, deployOn string) *chart.File {
+		manifest := configMapManifest(name) + "  annotations:\n    " + phases.DeployOnAnnotation + ": " + deployOn + "\n"
+		return &chart.File{Name: "templates/" + name, Data: []byte(manifest)}
+	}
+	ch := planTestChart("app")
+	ch.Templates = append(ch.Templates, annotated("setup", "install"), annotated("migrate", "upgrade"))
+
+	// The last release was uninstalled, so the upgrade installs it anew.
+	plan, err := BuildDeployPlan(context.Background(), upAction, rel.Name, ch, map[string]interface{}{})
+	req.NoError(err)
+
+	var skipped []string
+	for _, res := range plan.Skipped {
+		skipped = append(skipped, res.Name)
+	}
+	is.Equal([]string{"migrate"}, skipped)
+	is.Contains(plan.String(), "create spaced:ConfigMap/setup")
+}
@@ -18,22 +18,41 @@ package action
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
 	"github.com/werf/3p-helm/pkg/releaseutil"
+	"github.com/werf/3p-helm/pkg/storage"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/cli-runtime/pkg/resource"
 )
 
-func existingResourceConflict(resources kube.ResourceList, releaseName, releaseNamespace string) (kube.ResourceList, error) {
+// existingResourceConflict returns the existing resources to be adopted by the
+// release. Resources not belonging to any release are adopted if they match any
+// of the adopt matchers, in the format of phases.ParseResourceMatcher, which are
+// matched against the live objects.
+func existingResourceConflict(resources kube.ResourceList, releaseName, releaseNamespace string, cfg *Configuration, adopt []string) (kube.ResourceList, error) {
 	var requireUpdate kube.ResourceList
 
-	err := resources.Visit(func(info *resource.Info, err error) error {
+	adoptSelector, err := phases.NewResourceSelector(adopt, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid adopted resources")
+	}
+
+	err = resources.Visit(func(info *resource.Info, err error) error {
 		if err != nil {
 			return err
 		}
 
+		// Resources with metadata.generateName and no assigned name yet are always created.
+		if info.Name == "" {
+			return nil
+		}
+
 		helper := resource.NewHelper(info.Client, info.Mapping)
 		existing, err := helper.Get(info.Namespace, info.Name)
 		if err != nil {
@@ -45,7 +64,16 @@ func existingResourceConflict(resources kube.ResourceList, releaseName, releaseN
 
 		// Allow adoption of the resource if it is managed by Helm and is annotated with correct release name and namespace.
 		if err := releaseutil.CheckOwnership(existing, releaseName, releaseNamespace); err != nil {
-			return fmt.Errorf("%s exists and cannot be imported into the current release: %s", releaseutil.ResourceString(info), err)
+			adoptable, adoptErr := isAdoptable(adoptSelector, info, existing)
+			if adoptErr != nil {
+				return adoptErr
+			}
+			if adoptable {
+				requireUpdate.Append(info)
+				return nil
+			}
+
+			return fmt.Errorf("%s exists and cannot be imported into the current release: %s%s", releaseutil.ResourceString(info), err, ownershipConflictHint(info, existing, releaseName, releaseNamespace, cfg))
 		}
 
 		requireUpdate.Append(info)
@@ -56,5 +84,92 @@ func existingResourceConflict(resources kube.ResourceList, releaseName, releaseN
 }
 
 func ExistingResourceConflict(resources kube.ResourceList, releaseName, releaseNamespace string) (kube.ResourceList, error) {
-	return existingResourceConflict(resources, releaseName, releaseNamespace)
+	return existingResourceConflict(resources, releaseName, releaseNamespace, nil, nil)
+}
+
+// isAdoptable returns true if the existing resource does not belong to any
+// release and matches the adopt selector.
+func isAdoptable(adoptSelector *phases.ResourceSelector, info *resource.Info, existing runtime.Object) (bool, error) {
+	if adoptSelector.IsEmpty() {
+		return false, nil
+	}
+	if ownerName, _ := releaseutil.GetOwnerRelease(existing); ownerName != "" {
+		return false, nil
+	}
+
+	live := *info
+	live.Object = existing
+	selected, _, err := adoptSelector.Split(kube.ResourceList{&live})
+	if err != nil {
+		return false, err
+	}
+
+	return len(selected) > 0, nil
+}
+
+// ownershipConflictHint describes the release owning the existing resource, if
+// any, and how to transfer the ownership to the current release. The owner
+// release is looked up in the release storage of its namespace when cfg is not
+// nil.
+func ownershipConflictHint(info *resource.Info, existing runtime.Object, releaseName, releaseNamespace string, cfg *Configuration) string {
+	var hint string
+
+	if ownerName, ownerNamespace := releaseutil.GetOwnerRelease(existing); ownerName != "" {
+		hint += fmt.Sprintf("; it belongs to release %q in namespace %q", ownerName, ownerNamespace)
+		if owner := cfg.lastReleaseInNamespace(ownerName, ownerNamespace); owner != nil && owner.Info != nil {
+			hint += fmt.Sprintf(" (revision %d, %s", owner.Version, owner.Info.Status)
+			if !owner.Info.LastDeployed.IsZero() {
+				hint += fmt.Sprintf(", last deployed %s", owner.Info.LastDeployed.Format(time.RFC3339))
+			}
+			hint += ")"
+		}
+	}
+
+	hint += fmt.Sprintf("; to transfer the ownership to release %q in namespace %q run: %s", releaseName, releaseNamespace, releaseutil.OwnershipTransferHint(info, releaseName, releaseNamespace))
+
+	return hint
+}
+
+// lastReleaseInNamespace returns the last revision of the release in the
+// namespace. The release is looked up in the current release storage first,
+// then in the storage of its namespace, which may differ from the current one,
+// e.g. for the owners of the cluster-scoped resources.
+func (cfg *Configuration) lastReleaseInNamespace(name, namespace string) *release.Release {
+	if cfg == nil {
+		return nil
+	}
+	if last := lastReleaseInStorage(cfg.Releases, name, namespace); last != nil {
+		return last
+	}
+	if cfg.ReleasesInNamespace == nil {
+		return nil
+	}
+
+	releases, err := cfg.ReleasesInNamespace(namespace)
+	if err != nil {
+		cfg.Log("unable to look up release %q in namespace %q: %s", name, namespace, err)
+		return nil
+	}
+
+	return lastReleaseInStorage(releases, name, namespace)
+}
+
+func lastReleaseInStorage(releases *storage.Storage, name, namespace string) *release.Release {
+	if releases == nil {
+		return nil
+	}
+
+	history, err := releases.History(name)
+	if err != nil {
+		return nil
+	}
+
+	var last *release.Release
+	for _, rel := range history {
+		if rel.Namespace == namespace && (last == nil || rel.Version > last.Version) {
+			last = rel
+		}
+	}
+
+	return last
 }
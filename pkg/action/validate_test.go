@@ -0,0 +1,130 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/chart/charttest"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/storage"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+	helmtime "github.com/werf/3p-helm/pkg/time"
+)
+
+func TestOwnershipConflictHint(t *testing.T) {
+	is := assert.New(t)
+	config := actionConfigFixture(t)
+
+	owner := charttest.BuildRelease("owner", charttest.WithNamespace("ns-a"), charttest.WithRevision(3), charttest.WithStatus(release.StatusDeployed))
+	owner.Info.LastDeployed = helmtime.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	is.NoError(config.Releases.Create(owner))
+
+	info := &resource.Info{
+		Name:      "cm",
+		Namespace: "ns-a",
+		Mapping: &meta.RESTMapping{
+			Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+			GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+		},
+	}
+	existing := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:      "cm",
+		Namespace: "ns-a",
+		Annotations: map[string]string{
+			"meta.helm.sh/release-name":      "owner",
+			"meta.helm.sh/release-namespace": "ns-a",
+		},
+	}}
+
+	transfer := `; to transfer the ownership to release "current" in namespace "ns-a" run: kubectl annotate --overwrite -n ns-a configmaps/cm meta.helm.sh/release-name=current meta.helm.sh/release-namespace=ns-a && kubectl label --overwrite -n ns-a configmaps/cm app.kubernetes.io/managed-by=Helm`
+
+	is.Equal(
+		`; it belongs to release "owner" in namespace "ns-a" (revision 3, deployed, last deployed 2024-01-02T03:04:05Z)`+transfer,
+		ownershipConflictHint(info, existing, "current", "ns-a", config),
+	)
+	is.Equal(
+		`; it belongs to release "owner" in namespace "ns-a"`+transfer,
+		ownershipConflictHint(info, existing, "current", "ns-a", nil),
+	)
+
+	// The owner of a cluster-scoped resource may be in another namespace.
+	otherReleases := storage.Init(driver.NewMemory())
+	is.NoError(otherReleases.Create(charttest.BuildRelease("other-owner", charttest.WithNamespace("ns-b"), charttest.WithRevision(2), charttest.WithStatus(release.StatusFailed))))
+	config.ReleasesInNamespace = func(namespace string) (*storage.Storage, error) {
+		is.Equal("ns-b", namespace)
+		return otherReleases, nil
+	}
+	existing.Annotations["meta.helm.sh/release-name"] = "other-owner"
+	existing.Annotations["meta.helm.sh/release-namespace"] = "ns-b"
+	is.Contains(
+		ownershipConflictHint(info, existing, "current", "ns-a", config),
+		`; it belongs to release "other-owner" in namespace "ns-b" (revision 2, failed`,
+	)
+
+	existing.Annotations = nil
+	is.Equal(transfer, ownershipConflictHint(info, existing, "current", "ns-a", config))
+}
+
+func TestIsAdoptable(t *testing.T) {
+	is := assert.New(t)
+
+	info := &resource.Info{Name: "cm", Namespace: "ns-a"}
+	existing := &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cm",
+			Namespace: "ns-a",
+			Labels:    map[string]string{"app.kubernetes.io/instance": "backend"},
+		},
+	}
+
+	for adopt, expect := range map[string]bool{
+		"label:app.kubernetes.io/instance=back*": true,
+		"label:app.kubernetes.io/instance=front": false,
+		"ConfigMap/cm":                           true,
+		"Secret/*":                               false,
+	} {
+		selector, err := phases.NewResourceSelector([]string{adopt}, nil)
+		is.NoError(err)
+
+		adoptable, err := isAdoptable(selector, info, existing)
+		is.NoError(err)
+		is.Equal(expect, adoptable, adopt)
+	}
+
+	selector, err := phases.NewResourceSelector([]string{"ConfigMap/cm"}, nil)
+	is.NoError(err)
+
+	existing.Annotations = map[string]string{"meta.helm.sh/release-name": "owner"}
+	adoptable, err := isAdoptable(selector, info, existing)
+	is.NoError(err)
+	is.False(adoptable, "resources of another release are not adopted")
+
+	adoptable, err = isAdoptable(&phases.ResourceSelector{}, info, existing)
+	is.NoError(err)
+	is.False(adoptable)
+}
@@ -0,0 +1,126 @@
+// Package cachestats collects the statistics of the caches of the deploy
+// engine, so that the operators of busy CI runners can see how effective the
+// caches are and tune them.
+package cachestats
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Discovery is the cache of the discovery documents of the API server.
+	Discovery = "discovery"
+	// ChartDependencies is the directory of the prepared chart dependencies.
+	ChartDependencies = "chart-dependencies"
+	// ImageDigests is the cache of the digests of the images resolved by the
+	// werf_image template function.
+	ImageDigests = "image-digests"
+)
+
+// Stats are the statistics of a cache since the start of the process.
+type Stats struct {
+	Name   string `json:"name"`
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Entries is the number of the entries of the cache, or the number of the
+	// entries added to it if the cache is not shared by the whole process.
+	Entries int64 `json:"entries"`
+}
+
+// HitRate is the ratio of the hits to all the lookups, 0 if there were none.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Counter counts the lookups and the entries of a cache.
+type Counter struct {
+	name    string
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+	entries atomic.Int64
+	// entriesFunc, if set, counts the entries instead.
+	entriesFunc func() (int64, error)
+}
+
+var (
+	mu       sync.Mutex
+	counters = map[string]*Counter{}
+)
+
+// For returns the Counter of the cache with the given name, registering it on
+// the first call.
+func For(name string) *Counter {
+	mu.Lock()
+	defer mu.Unlock()
+
+	counter, found := counters[name]
+	if !found {
+		counter = &Counter{name: name}
+		counters[name] = counter
+	}
+
+	return counter
+}
+
+// Hit counts a lookup which was found in the cache.
+func (c *Counter) Hit() {
+	c.hits.Add(1)
+}
+
+// Miss counts a lookup which was not found in the cache.
+func (c *Counter) Miss() {
+	c.misses.Add(1)
+}
+
+// AddEntries counts the entries added to the cache, or removed if n is
+// negative.
+func (c *Counter) AddEntries(n int64) {
+	c.entries.Add(n)
+}
+
+// CountEntriesWith makes the entries be counted with f when the statistics are
+// taken, e.g. for a cache on disk shared by several processes.
+func (c *Counter) CountEntriesWith(f func() (int64, error)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	c.entriesFunc = f
+}
+
+// Snapshot returns the statistics of all the registered caches, sorted by
+// name. The entries of a cache which can't be counted are -1.
+func Snapshot() []Stats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var result []Stats
+	for name, counter := range counters {
+		stats := Stats{
+			Name:    name,
+			Hits:    counter.hits.Load(),
+			Misses:  counter.misses.Load(),
+			Entries: counter.entries.Load(),
+		}
+		if counter.entriesFunc != nil {
+			entries, err := counter.entriesFunc()
+			if err != nil {
+				entries = -1
+			}
+			stats.Entries = entries
+		}
+
+		result = append(result, stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
@@ -0,0 +1,43 @@
+package cachestats
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	counter := For("test-lookups")
+	if For("test-lookups") != counter {
+		t.Fatal("expected the same counter for the same cache")
+	}
+
+	counter.Hit()
+	counter.Hit()
+	counter.Hit()
+	counter.Miss()
+	counter.AddEntries(1)
+
+	For("test-on-disk").CountEntriesWith(func() (int64, error) {
+		return 0, errors.New("unreadable")
+	})
+
+	stats := map[string]Stats{}
+	for _, s := range Snapshot() {
+		stats[s.Name] = s
+	}
+
+	lookups := stats["test-lookups"]
+	if lookups.Hits != 3 || lookups.Misses != 1 || lookups.Entries != 1 {
+		t.Errorf("unexpected stats %+v", lookups)
+	}
+	if rate := lookups.HitRate(); rate != 0.75 {
+		t.Errorf("expected hit rate 0.75, got %v", rate)
+	}
+
+	if entries := stats["test-on-disk"].Entries; entries != -1 {
+		t.Errorf("expected -1 entries of a cache which can't be counted, got %d", entries)
+	}
+	if rate := stats["test-on-disk"].HitRate(); rate != 0 {
+		t.Errorf("expected hit rate 0 without lookups, got %v", rate)
+	}
+}
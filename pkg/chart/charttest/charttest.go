@@ -0,0 +1,206 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package charttest provides builders for charts, hooks and releases to be used
+as fixtures in tests.
+*/
+package charttest
+
+import (
+	"github.com/werf/3p-helm/pkg/chart"
+)
+
+// ManifestWithHook is a ConfigMap hook running on post-install, pre-delete
+// and post-upgrade.
+const ManifestWithHook = `kind: ConfigMap
+metadata:
+  name: test-cm
+  annotations:
+    "helm.sh/hook": post-install,pre-delete,post-upgrade
+data:
+  name: value`
+
+// ManifestWithTestHook is a Pod test hook.
+const ManifestWithTestHook = `kind: Pod
+  metadata:
+	name: finding-nemo,
+	annotations:
+	  "helm.sh/hook": test
+  spec:
+	containers:
+	- name: nemo-test
+	  image: fake-image
+	  cmd: fake-command
+  `
+
+// RBACManifests is a template of a Role and a RoleBinding.
+const RBACManifests = `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: schedule-agents
+rules:
+- apiGroups: [""]
+  resources: ["pods", "pods/exec", "pods/log"]
+  verbs: ["*"]
+
+---
+
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: schedule-agents
+  namespace: {{ default .Release.Namespace}}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: schedule-agents
+subjects:
+- kind: ServiceAccount
+  name: schedule-agents
+  namespace: {{ .Release.Namespace }}
+`
+
+// Option configures a chart built by Build.
+type Option func(*chart.Chart)
+
+// Build creates a chart named "hello" with a basic template and a hook, then
+// applies the given options to it.
+func Build(opts ...Option) *chart.Chart {
+	c := &chart.Chart{
+		// TODO: This should be more complete.
+		Metadata: &chart.Metadata{
+			APIVersion: "v1",
+			Name:       "hello",
+			Version:    "0.1.0",
+		},
+		// This adds a basic template and hooks.
+		Templates: []*chart.File{
+			{Name: "templates/hello", Data: []byte("hello: world")},
+			{Name: "templates/hooks", Data: []byte(ManifestWithHook)},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// WithName sets the chart name.
+func WithName(name string) Option {
+	return func(c *chart.Chart) {
+		c.Metadata.Name = name
+	}
+}
+
+// WithVersion sets the chart version.
+func WithVersion(version string) Option {
+	return func(c *chart.Chart) {
+		c.Metadata.Version = version
+	}
+}
+
+// WithSampleValues sets nested sample values.
+func WithSampleValues() Option {
+	values := map[string]interface{}{
+		"someKey": "someValue",
+		"nestedKey": map[string]interface{}{
+			"simpleKey": "simpleValue",
+			"anotherNestedKey": map[string]interface{}{
+				"yetAnotherNestedKey": map[string]interface{}{
+					"youReadyForAnotherNestedKey": "No",
+				},
+			},
+		},
+	}
+	return func(c *chart.Chart) {
+		c.Values = values
+	}
+}
+
+// WithValues sets the chart values.
+func WithValues(values map[string]interface{}) Option {
+	return func(c *chart.Chart) {
+		c.Values = values
+	}
+}
+
+// WithNotes adds a NOTES.txt template.
+func WithNotes(notes string) Option {
+	return func(c *chart.Chart) {
+		c.Templates = append(c.Templates, &chart.File{
+			Name: "templates/NOTES.txt",
+			Data: []byte(notes),
+		})
+	}
+}
+
+// WithTemplates adds the given templates.
+func WithTemplates(templates ...*chart.File) Option {
+	return func(c *chart.Chart) {
+		c.Templates = append(c.Templates, templates...)
+	}
+}
+
+// WithDependency adds a subchart built with the given options.
+func WithDependency(dependencyOpts ...Option) Option {
+	return func(c *chart.Chart) {
+		c.AddDependency(Build(dependencyOpts...))
+	}
+}
+
+// WithMetadataDependency adds a dependency to the Chart.yaml metadata.
+func WithMetadataDependency(dependency chart.Dependency) Option {
+	return func(c *chart.Chart) {
+		c.Metadata.Dependencies = append(c.Metadata.Dependencies, &dependency)
+	}
+}
+
+// WithSampleTemplates adds basic templates and partials.
+func WithSampleTemplates() Option {
+	return WithTemplates(
+		&chart.File{Name: "templates/goodbye", Data: []byte("goodbye: world")},
+		&chart.File{Name: "templates/empty", Data: []byte("")},
+		&chart.File{Name: "templates/with-partials", Data: []byte(`hello: {{ template "_planet" . }}`)},
+		&chart.File{Name: "templates/partials/_planet", Data: []byte(`{{define "_planet"}}Earth{{end}}`)},
+	)
+}
+
+// WithSampleIncludingIncorrectTemplates adds basic templates and partials
+// along with a template that fails to render.
+func WithSampleIncludingIncorrectTemplates() Option {
+	return WithTemplates(
+		&chart.File{Name: "templates/goodbye", Data: []byte("goodbye: world")},
+		&chart.File{Name: "templates/empty", Data: []byte("")},
+		&chart.File{Name: "templates/incorrect", Data: []byte("{{ .Values.bad.doh }}")},
+		&chart.File{Name: "templates/with-partials", Data: []byte(`hello: {{ template "_planet" . }}`)},
+		&chart.File{Name: "templates/partials/_planet", Data: []byte(`{{define "_planet"}}Earth{{end}}`)},
+	)
+}
+
+// WithMultipleManifestTemplate adds a template rendering multiple manifests.
+func WithMultipleManifestTemplate() Option {
+	return WithTemplates(&chart.File{Name: "templates/rbac", Data: []byte(RBACManifests)})
+}
+
+// WithKube sets the kubeVersion constraint of the chart.
+func WithKube(version string) Option {
+	return func(c *chart.Chart) {
+		c.Metadata.KubeVersion = version
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package charttest
+
+import (
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/time"
+)
+
+// HookOption configures a hook built by BuildHook.
+type HookOption func(*release.Hook)
+
+// BuildHook creates a hook with the given name, kind and events.
+func BuildHook(name, kind string, events []release.HookEvent, opts ...HookOption) *release.Hook {
+	h := &release.Hook{
+		Name:   name,
+		Kind:   kind,
+		Path:   name,
+		Events: events,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// WithHookManifest sets the hook manifest.
+func WithHookManifest(manifest string) HookOption {
+	return func(h *release.Hook) {
+		h.Manifest = manifest
+	}
+}
+
+// WithHookWeight sets the hook weight.
+func WithHookWeight(weight int) HookOption {
+	return func(h *release.Hook) {
+		h.Weight = weight
+	}
+}
+
+// WithHookDeletePolicies sets the hook delete policies.
+func WithHookDeletePolicies(policies ...release.HookDeletePolicy) HookOption {
+	return func(h *release.Hook) {
+		h.DeletePolicies = policies
+	}
+}
+
+// ReleaseOption configures a release built by BuildRelease.
+type ReleaseOption func(*release.Release)
+
+// BuildRelease creates the first revision of a deployed release with a chart
+// built with sample templates, a post-install/pre-delete hook and a test hook.
+func BuildRelease(name string, opts ...ReleaseOption) *release.Release {
+	now := time.Now()
+	r := &release.Release{
+		Name: name,
+		Info: &release.Info{
+			FirstDeployed: now,
+			LastDeployed:  now,
+			Status:        release.StatusDeployed,
+			Description:   "Named Release Stub",
+		},
+		Chart:   Build(WithSampleTemplates()),
+		Config:  map[string]interface{}{"name": "value"},
+		Version: 1,
+		Hooks: []*release.Hook{
+			BuildHook("test-cm", "ConfigMap",
+				[]release.HookEvent{release.HookPostInstall, release.HookPreDelete},
+				WithHookManifest(ManifestWithHook)),
+			BuildHook("finding-nemo", "Pod",
+				[]release.HookEvent{release.HookTest},
+				WithHookManifest(ManifestWithTestHook)),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithStatus sets the release status.
+func WithStatus(status release.Status) ReleaseOption {
+	return func(r *release.Release) {
+		r.Info.Status = status
+	}
+}
+
+// WithRevision sets the release revision.
+func WithRevision(revision int) ReleaseOption {
+	return func(r *release.Release) {
+		r.Version = revision
+	}
+}
+
+// WithNamespace sets the release namespace.
+func WithNamespace(namespace string) ReleaseOption {
+	return func(r *release.Release) {
+		r.Namespace = namespace
+	}
+}
+
+// WithChart sets the release chart.
+func WithChart(c *chart.Chart) ReleaseOption {
+	return func(r *release.Release) {
+		r.Chart = c
+	}
+}
+
+// WithConfig sets the user-supplied values of the release.
+func WithConfig(config map[string]interface{}) ReleaseOption {
+	return func(r *release.Release) {
+		r.Config = config
+	}
+}
+
+// WithManifest sets the rendered manifest of the release.
+func WithManifest(manifest string) ReleaseOption {
+	return func(r *release.Release) {
+		r.Manifest = manifest
+	}
+}
+
+// WithHooks replaces the release hooks.
+func WithHooks(hooks ...*release.Hook) ReleaseOption {
+	return func(r *release.Release) {
+		r.Hooks = hooks
+	}
+}
@@ -0,0 +1,27 @@
+package chart
+
+// DependencyDecision is what decided whether a dependency is enabled.
+type DependencyDecision string
+
+const (
+	// DependencyDecisionCondition means a condition of the dependency resolved to a bool value.
+	DependencyDecisionCondition DependencyDecision = "condition"
+	// DependencyDecisionTags means the tags of the dependency decided.
+	DependencyDecisionTags DependencyDecision = "tags"
+	// DependencyDecisionDefault means neither conditions nor tags were set, the dependency is enabled.
+	DependencyDecisionDefault DependencyDecision = "default"
+)
+
+// DependencyResolution describes whether a dependency was enabled and why.
+type DependencyResolution struct {
+	// Path is the values path of the dependency, e.g. "subchart.nested".
+	Path string `json:"path"`
+	// Version is the version range of the dependency from Chart.yaml.
+	Version string `json:"version,omitempty"`
+	// Enabled is true if the dependency is rendered.
+	Enabled bool `json:"enabled"`
+	// DecidedBy is what decided whether the dependency is enabled.
+	DecidedBy DependencyDecision `json:"decided_by"`
+	// Key is the condition path or the tag that decided, if any.
+	Key string `json:"key,omitempty"`
+}
@@ -0,0 +1,126 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/pkg/errors"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/ignore"
+)
+
+// FSLoader loads a chart from a directory or an archive in a file system, e.g.
+// a chart embedded into the binary with go:embed.
+type FSLoader struct {
+	FS   fs.FS
+	Name string
+}
+
+// Load loads the chart
+func (l FSLoader) Load(options chart.LoadOptions) (*chart.Chart, error) {
+	return LoadFSWithOptions(l.FS, l.Name, options)
+}
+
+// LoadFS loads a chart from a directory or a chart archive in the file system.
+// The name is a slash-separated path in the file system, "." is its root.
+func LoadFS(fsys fs.FS, name string) (*chart.Chart, error) {
+	return LoadFSWithOptions(fsys, name, *GlobalLoadOptions)
+}
+
+func LoadFSWithOptions(fsys fs.FS, name string, options chart.LoadOptions) (*chart.Chart, error) {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return LoadArchiveWithOptions(f, options)
+	}
+
+	files, err := GetFilesFromFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadFiles(files, options)
+}
+
+// GetFilesFromFS reads the files of the chart in the directory of the file
+// system, skipping the ones matching .helmignore.
+func GetFilesFromFS(fsys fs.FS, dir string) ([]*BufferedFile, error) {
+	rules := ignore.Empty()
+	if f, err := fsys.Open(path.Join(dir, ignore.HelmIgnore)); err == nil {
+		r, err := ignore.Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		rules = r
+	}
+	rules.AddDefaults()
+
+	files := []*BufferedFile{}
+
+	walk := func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == dir {
+			// No need to process top level. Avoid bug with helmignore .* matching
+			// empty names. See issue 1779.
+			return nil
+		}
+
+		n := name
+		if dir != "." {
+			n = name[len(dir)+1:]
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			// Directory-based ignore rules should involve skipping the entire
+			// contents of that directory.
+			if rules.Ignore(n, fi) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		// If a .helmignore file matches, skip this file.
+		if rules.Ignore(n, fi) {
+			return nil
+		}
+
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("cannot load irregular file %s as it has file mode type bits set", name)
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", n)
+		}
+
+		data = bytes.TrimPrefix(data, utf8bom)
+
+		files = append(files, &BufferedFile{Name: n, Data: data})
+		return nil
+	}
+	if err := fs.WalkDir(fsys, dir, walk); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
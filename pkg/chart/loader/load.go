@@ -17,7 +17,6 @@ limitations under the License.
 package loader
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"log"
@@ -82,6 +81,10 @@ type BufferedFile struct {
 
 // LoadFiles loads from in-memory files.
 func LoadFiles(files []*BufferedFile, options chart.LoadOptions) (*chart.Chart, error) {
+	return loadFiles(files, options, chart.CurrentChartType)
+}
+
+func loadFiles(files []*BufferedFile, options chart.LoadOptions, chartType chart.ChartType) (*chart.Chart, error) {
 	c := new(chart.Chart)
 	subcharts := make(map[string][]*BufferedFile)
 
@@ -168,7 +171,7 @@ func LoadFiles(files []*BufferedFile, options chart.LoadOptions) (*chart.Chart,
 		}
 	}
 
-	switch chart.CurrentChartType {
+	switch chartType {
 	case chart.ChartTypeBundle:
 		if err := c.SecretsRuntimeData.DecodeAndLoadSecrets(
 			context.Background(),
@@ -279,49 +282,11 @@ func LoadFiles(files []*BufferedFile, options chart.LoadOptions) (*chart.Chart,
 		return c, err
 	}
 
-	for n, files := range subcharts {
-		var sc *chart.Chart
-		var err error
-		switch {
-		case strings.IndexAny(n, "_.") == 0:
-			continue
-		case filepath.Ext(n) == ".tgz":
-			file := files[0]
-			if file.Name != n {
-				return c, errors.Errorf("error unpacking tar in %s: expected %s, got %s", c.Name(), n, file.Name)
-			}
-
-			// Untar the chart and add to c.Dependencies
-			originalChartType := chart.CurrentChartType
-			chart.CurrentChartType = chart.ChartTypeSubchart
-			defer func() {
-				chart.CurrentChartType = originalChartType
-			}()
-			sc, err = LoadArchiveWithOptions(bytes.NewBuffer(file.Data), chart.LoadOptions{})
-		default:
-			// We have to trim the prefix off of every file, and ignore any file
-			// that is in charts/, but isn't actually a chart.
-			buff := make([]*BufferedFile, 0, len(files))
-			for _, f := range files {
-				parts := strings.SplitN(f.Name, "/", 2)
-				if len(parts) < 2 {
-					continue
-				}
-				f.Name = parts[1]
-				buff = append(buff, f)
-			}
-
-			originalChartType := chart.CurrentChartType
-			chart.CurrentChartType = chart.ChartTypeSubchart
-			defer func() {
-				chart.CurrentChartType = originalChartType
-			}()
-			sc, err = LoadFiles(buff, chart.LoadOptions{})
-		}
-
-		if err != nil {
-			return c, errors.Wrapf(err, "error unpacking %s in %s", n, c.Name())
-		}
+	deps, err := loadSubcharts(c, subcharts)
+	if err != nil {
+		return c, err
+	}
+	for _, sc := range deps {
 		c.AddDependency(sc)
 	}
 
@@ -357,4 +322,8 @@ func init() {
 var WithoutDefaultSecretValues bool
 var WithoutDefaultValues bool
 var SecretValuesFiles []string
+
+// SubchartsLoadConcurrency limits how many subcharts are loaded in parallel.
+// Zero means the number of available CPUs.
+var SubchartsLoadConcurrency int
 var ChartFileReader file.ChartFileReader
@@ -17,6 +17,7 @@ import (
 	"github.com/pkg/errors"
 	"sigs.k8s.io/yaml"
 
+	"github.com/werf/3p-helm/pkg/cachestats"
 	"github.com/werf/3p-helm/pkg/chart"
 	"github.com/werf/3p-helm/pkg/werf/file"
 	chart2 "github.com/werf/common-go/pkg/lock"
@@ -183,9 +184,15 @@ func prepareDependenciesDir(ctx context.Context, metadataBytes, metadataLockByte
 
 	depsDir := filepath.Join(chartDependenciesCacheDir, util.Sha256Hash(string(metadataLockBytes)))
 
+	stats := cachestats.For(cachestats.ChartDependencies)
+	stats.CountEntriesWith(func() (int64, error) {
+		return countChartDependenciesDirs(chartDependenciesCacheDir)
+	})
+
 	_, err = os.Stat(depsDir)
 	switch {
 	case os.IsNotExist(err):
+		stats.Miss()
 		if err := logger.LogProcess("Preparing chart dependencies").DoError(func() error {
 			logger.LogF("Using chart dependencies directory: %s\n", depsDir)
 			_, lock, err := chart2.AcquireHostLock(ctx, depsDir, lockgate.AcquireOptions{})
@@ -223,12 +230,33 @@ func prepareDependenciesDir(ctx context.Context, metadataBytes, metadataLockByte
 	case err != nil:
 		return "", fmt.Errorf("error accessing %q: %w", depsDir, err)
 	default:
+		stats.Hit()
 		logger.LogF("Using cached chart dependencies directory: %s\n", depsDir)
 	}
 
 	return depsDir, nil
 }
 
+// countChartDependenciesDirs counts the prepared dependencies directories in
+// the cache dir, skipping the ones being prepared.
+func countChartDependenciesDirs(cacheDir string) (int64, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.Contains(entry.Name(), ".tmp.") {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
 func createChartDependenciesDir(destDir string, metadataBytes, metadataLockBytes []byte) error {
 	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
 		return fmt.Errorf("error creating dir %q: %w", destDir, err)
@@ -0,0 +1,94 @@
+package loader
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/werf/3p-helm/pkg/chart"
+)
+
+// loadSubcharts loads the subcharts found in the charts/ directory of c. Each
+// subchart is unarchived and loaded by a pool of workers, the result is in the
+// order of the subchart names regardless of the order the loading finishes in.
+func loadSubcharts(c *chart.Chart, subcharts map[string][]*BufferedFile) ([]*chart.Chart, error) {
+	var names []string
+	for n := range subcharts {
+		if strings.IndexAny(n, "_.") == 0 {
+			continue
+		}
+		if filepath.Ext(n) == ".tgz" && subcharts[n][0].Name != n {
+			return nil, errors.Errorf("error unpacking tar in %s: expected %s, got %s", c.Name(), n, subcharts[n][0].Name)
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	results := make([]*chart.Chart, len(names))
+	errs := make([]error, len(names))
+
+	workers := SubchartsLoadConcurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(names) {
+		workers = len(names)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = loadSubchart(names[i], subcharts[names[i]])
+			}
+		}()
+	}
+
+	for i := range names {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, n := range names {
+		if errs[i] != nil {
+			return nil, errors.Wrapf(errs[i], "error unpacking %s in %s", n, c.Name())
+		}
+	}
+
+	return results, nil
+}
+
+func loadSubchart(name string, files []*BufferedFile) (*chart.Chart, error) {
+	if filepath.Ext(name) == ".tgz" {
+		// Untar the chart and add to c.Dependencies
+		archiveFiles, err := LoadArchiveFiles(bytes.NewBuffer(files[0].Data))
+		if err != nil {
+			return nil, err
+		}
+
+		return loadFiles(archiveFiles, chart.LoadOptions{}, chart.ChartTypeSubchart)
+	}
+
+	// We have to trim the prefix off of every file, and ignore any file
+	// that is in charts/, but isn't actually a chart.
+	buff := make([]*BufferedFile, 0, len(files))
+	for _, f := range files {
+		parts := strings.SplitN(f.Name, "/", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		f.Name = parts[1]
+		buff = append(buff, f)
+	}
+
+	return loadFiles(buff, chart.LoadOptions{}, chart.ChartTypeSubchart)
+}
@@ -21,12 +21,14 @@ import (
 	"bytes"
 	"compress/gzip"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/werf/3p-helm/pkg/chart"
@@ -646,3 +648,122 @@ func verifyBomStripped(t *testing.T, files []*chart.File) {
 		}
 	}
 }
+
+func TestLoadFilesSubchartsOrder(t *testing.T) {
+	defer func(concurrency int) { SubchartsLoadConcurrency = concurrency }(SubchartsLoadConcurrency)
+	SubchartsLoadConcurrency = 3
+
+	files := []*BufferedFile{
+		{
+			Name: "Chart.yaml",
+			Data: []byte("apiVersion: v2\nname: umbrella\nversion: 0.1.0\n"),
+		},
+	}
+	names := []string{"sub-e", "sub-b", "sub-d", "sub-a", "sub-c", "sub-f", "sub-g"}
+	for _, name := range names {
+		files = append(files,
+			&BufferedFile{
+				Name: "charts/" + name + "/Chart.yaml",
+				Data: []byte("apiVersion: v2\nname: " + name + "\nversion: 0.1.0\n"),
+			},
+			&BufferedFile{
+				Name: "charts/" + name + "/templates/configmap.yaml",
+				Data: []byte("kind: ConfigMap"),
+			},
+		)
+	}
+
+	c, err := LoadFiles(files, chart.LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"sub-a", "sub-b", "sub-c", "sub-d", "sub-e", "sub-f", "sub-g"}
+	if len(c.Dependencies()) != len(expected) {
+		t.Fatalf("expected %d dependencies, got %d", len(expected), len(c.Dependencies()))
+	}
+	for i, dep := range c.Dependencies() {
+		if dep.Name() != expected[i] {
+			t.Errorf("expected dependency %d to be %q, got %q", i, expected[i], dep.Name())
+		}
+		if len(dep.Templates) != 1 || dep.Templates[0].Name != "templates/configmap.yaml" {
+			t.Errorf("unexpected templates of %q: %v", dep.Name(), dep.Templates)
+		}
+		if dep.Parent() != c {
+			t.Errorf("expected parent of %q to be the umbrella chart", dep.Name())
+		}
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"charts/app/Chart.yaml":                    {Data: []byte("apiVersion: v2\nname: app\nversion: 0.1.0\n")},
+		"charts/app/values.yaml":                   {Data: []byte("replicas: 2\n")},
+		"charts/app/.helmignore":                   {Data: []byte("*.bak\nignored/\n")},
+		"charts/app/templates/deployment.yaml":     {Data: []byte("kind: Deployment")},
+		"charts/app/templates/deployment.yaml.bak": {Data: []byte("kind: Deployment")},
+		"charts/app/ignored/file.txt":              {Data: []byte("ignored")},
+		"charts/app/charts/sub/Chart.yaml":         {Data: []byte("apiVersion: v2\nname: sub\nversion: 0.2.0\n")},
+	}
+
+	appFS, err := fs.Sub(fsys, "charts/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		fsys fs.FS
+		name string
+	}{
+		{fsys: fsys, name: "charts/app"},
+		{fsys: appFS, name: "."},
+	} {
+		name := tt.name
+		c, err := FSLoader{FS: tt.fsys, Name: name}.Load(chart.LoadOptions{})
+		if err != nil {
+			t.Fatalf("%q: failed to load chart: %s", name, err)
+		}
+
+		if c.Name() != "app" {
+			t.Errorf("%q: expected chart name app, got %q", name, c.Name())
+		}
+		if c.Values["replicas"] != float64(2) {
+			t.Errorf("%q: expected replicas to be 2, got %v", name, c.Values["replicas"])
+		}
+		for _, f := range c.Raw {
+			if strings.HasSuffix(f.Name, ".bak") || strings.HasPrefix(f.Name, "ignored/") {
+				t.Errorf("%q: expected %s to be ignored", name, f.Name)
+			}
+		}
+		if !containsTemplate(c, "templates/deployment.yaml") {
+			t.Errorf("%q: expected templates/deployment.yaml to be loaded", name)
+		}
+		if len(c.Dependencies()) != 1 || c.Dependencies()[0].Name() != "sub" {
+			t.Errorf("%q: expected subchart sub to be loaded", name)
+		}
+	}
+}
+
+func TestLoadFSArchive(t *testing.T) {
+	data, err := os.ReadFile("testdata/frobnitz-1.2.3.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadFS(fstest.MapFS{"frobnitz-1.2.3.tgz": {Data: data}}, "frobnitz-1.2.3.tgz")
+	if err != nil {
+		t.Fatalf("failed to load chart archive: %s", err)
+	}
+	if c.Name() != "frobnitz" {
+		t.Errorf("expected chart name frobnitz, got %q", c.Name())
+	}
+}
+
+func containsTemplate(c *chart.Chart, name string) bool {
+	for _, t := range c.Templates {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
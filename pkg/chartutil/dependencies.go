@@ -44,24 +44,52 @@ func ProcessDependencies(c *chart.Chart, v *map[string]interface{}) error {
 // It is similar to ProcessDependencies but it does not remove nil values during
 // the import/export handling process.
 func ProcessDependenciesWithMerge(c *chart.Chart, v *map[string]interface{}) error {
+	_, err := ProcessDependenciesWithMergeAndReport(c, v, nil)
+	return err
+}
+
+// ProcessDependenciesWithMergeAndReport is ProcessDependenciesWithMerge that also
+// reports which dependencies were enabled or disabled and which condition or tag
+// decided it. Dependencies of disabled charts are not reported.
+//
+// Conditions referencing Capabilities are evaluated against caps. They are
+// skipped if caps is nil.
+func ProcessDependenciesWithMergeAndReport(c *chart.Chart, v *map[string]interface{}, caps *Capabilities) ([]*chart.DependencyResolution, error) {
 	if err := processDependencyExportExtraValues(c, v, true); err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := processDependencyEnabled(c, *v, ""); err != nil {
-		return err
+	var report []*chart.DependencyResolution
+	if err := resolveDependencyEnabled(c, *v, "", caps, &report); err != nil {
+		return nil, err
 	}
 
-	return processDependencyImportExportValues(c, true)
+	return report, processDependencyImportExportValues(c, true)
 }
 
 // processDependencyConditions disables charts based on condition path value in values
-func processDependencyConditions(reqs []*chart.Dependency, cvals Values, cpath string) {
+func processDependencyConditions(reqs []*chart.Dependency, cvals Values, cpath string, caps *Capabilities, resolutions map[*chart.Dependency]*chart.DependencyResolution) {
 	if reqs == nil {
 		return
 	}
 	for _, r := range reqs {
 		for _, c := range strings.Split(strings.TrimSpace(r.Condition), ",") {
+			if isCapabilitiesCondition(c) {
+				// capabilities are not available, e.g. when linting
+				if caps == nil {
+					continue
+				}
+				c = strings.TrimSpace(c)
+				bv, err := evaluateCapabilitiesCondition(c, caps)
+				if err != nil {
+					log.Printf("Warning: Condition for chart %s: %s", r.Name, err)
+					continue
+				}
+				r.Enabled = bv
+				resolutions[r].DecidedBy = chart.DependencyDecisionCondition
+				resolutions[r].Key = c
+				break
+			}
 			if len(c) > 0 {
 				// retrieve value
 				vv, err := cvals.PathValue(cpath + c)
@@ -69,6 +97,8 @@ func processDependencyConditions(reqs []*chart.Dependency, cvals Values, cpath s
 					// if not bool, warn
 					if bv, ok := vv.(bool); ok {
 						r.Enabled = bv
+						resolutions[r].DecidedBy = chart.DependencyDecisionCondition
+						resolutions[r].Key = c
 						break
 					}
 					log.Printf("Warning: Condition path '%s' for chart %s returned non-bool value", c, r.Name)
@@ -82,7 +112,7 @@ func processDependencyConditions(reqs []*chart.Dependency, cvals Values, cpath s
 }
 
 // processDependencyTags disables charts based on tags in values
-func processDependencyTags(reqs []*chart.Dependency, cvals Values) {
+func processDependencyTags(reqs []*chart.Dependency, cvals Values, resolutions map[*chart.Dependency]*chart.DependencyResolution) {
 	if reqs == nil {
 		return
 	}
@@ -92,14 +122,17 @@ func processDependencyTags(reqs []*chart.Dependency, cvals Values) {
 	}
 	for _, r := range reqs {
 		var hasTrue, hasFalse bool
+		var trueTag, falseTag string
 		for _, k := range r.Tags {
 			if b, ok := vt[k]; ok {
 				// if not bool, warn
 				if bv, ok := b.(bool); ok {
-					if bv {
+					if bv && !hasTrue {
 						hasTrue = true
-					} else {
+						trueTag = k
+					} else if !bv && !hasFalse {
 						hasFalse = true
+						falseTag = k
 					}
 				} else {
 					log.Printf("Warning: Tag '%s' for chart %s returned non-bool value", k, r.Name)
@@ -108,8 +141,14 @@ func processDependencyTags(reqs []*chart.Dependency, cvals Values) {
 		}
 		if !hasTrue && hasFalse {
 			r.Enabled = false
+			resolutions[r].DecidedBy = chart.DependencyDecisionTags
+			resolutions[r].Key = falseTag
 		} else if hasTrue || !hasTrue && !hasFalse {
 			r.Enabled = true
+			if hasTrue {
+				resolutions[r].DecidedBy = chart.DependencyDecisionTags
+				resolutions[r].Key = trueTag
+			}
 		}
 	}
 }
@@ -140,6 +179,13 @@ func getAliasDependency(charts []*chart.Chart, dep *chart.Dependency) *chart.Cha
 
 // processDependencyEnabled removes disabled charts from dependencies
 func processDependencyEnabled(c *chart.Chart, v map[string]interface{}, path string) error {
+	return resolveDependencyEnabled(c, v, path, nil, nil)
+}
+
+// resolveDependencyEnabled removes disabled charts from dependencies and, if
+// report is not nil, appends the resolution of every dependency to it. Conditions
+// referencing Capabilities are evaluated only if caps is not nil.
+func resolveDependencyEnabled(c *chart.Chart, v map[string]interface{}, path string, caps *Capabilities, report *[]*chart.DependencyResolution) error {
 	if c.Metadata.Dependencies == nil {
 		return nil
 	}
@@ -174,16 +220,28 @@ Loop:
 	c.SetDependencies(chartDependencies...)
 
 	// set all to true
+	resolutions := map[*chart.Dependency]*chart.DependencyResolution{}
 	for _, lr := range c.Metadata.Dependencies {
 		lr.Enabled = true
+		resolutions[lr] = &chart.DependencyResolution{
+			Path:      path + lr.Name,
+			Version:   lr.Version,
+			DecidedBy: chart.DependencyDecisionDefault,
+		}
 	}
 	cvals, err := CoalesceValues(c, v)
 	if err != nil {
 		return err
 	}
 	// flag dependencies as enabled/disabled
-	processDependencyTags(c.Metadata.Dependencies, cvals)
-	processDependencyConditions(c.Metadata.Dependencies, cvals, path)
+	processDependencyTags(c.Metadata.Dependencies, cvals, resolutions)
+	processDependencyConditions(c.Metadata.Dependencies, cvals, path, caps, resolutions)
+	if report != nil {
+		for _, r := range c.Metadata.Dependencies {
+			resolutions[r].Enabled = r.Enabled
+			*report = append(*report, resolutions[r])
+		}
+	}
 	// make a map of charts to remove
 	rm := map[string]struct{}{}
 	for _, r := range c.Metadata.Dependencies {
@@ -212,7 +270,7 @@ Loop:
 	// recursively call self to process sub dependencies
 	for _, t := range cd {
 		subpath := path + t.Metadata.Name + "."
-		if err := processDependencyEnabled(t, cvals, subpath); err != nil {
+		if err := resolveDependencyEnabled(t, cvals, subpath, caps, report); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,69 @@
+package chartutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/werf/3p-helm/pkg/chart"
+)
+
+const (
+	capabilitiesConditionPrefix = "Capabilities."
+	apiVersionsHasCondition     = "Capabilities.APIVersions.Has"
+	kubeVersionCondition        = "Capabilities.KubeVersion"
+)
+
+// isCapabilitiesCondition reports whether the dependency condition references
+// Capabilities rather than a values path.
+func isCapabilitiesCondition(condition string) bool {
+	return strings.HasPrefix(strings.TrimSpace(condition), capabilitiesConditionPrefix)
+}
+
+// evaluateCapabilitiesCondition evaluates a dependency condition referencing
+// Capabilities. Supported conditions are:
+//
+//	Capabilities.APIVersions.Has <apiVersion or resource>, e.g. "Capabilities.APIVersions.Has monitoring.coreos.com/v1"
+//	Capabilities.KubeVersion <constraint>, e.g. "Capabilities.KubeVersion >=1.25.0-0"
+//
+// Since conditions are separated by commas, constraints of several versions
+// must be separated by spaces.
+func evaluateCapabilitiesCondition(condition string, caps *Capabilities) (bool, error) {
+	expr, arg, _ := strings.Cut(condition, " ")
+	arg = strings.Trim(strings.TrimSpace(arg), `"`)
+	if arg == "" {
+		return false, fmt.Errorf("condition %q has no argument", condition)
+	}
+
+	switch expr {
+	case apiVersionsHasCondition:
+		return caps.APIVersions.Has(arg), nil
+	case kubeVersionCondition:
+		return IsCompatibleRange(arg, caps.KubeVersion.Version), nil
+	default:
+		return false, fmt.Errorf("unsupported condition %q, expected %q or %q", condition, apiVersionsHasCondition, kubeVersionCondition)
+	}
+}
+
+// DependencyConditionsUseCapabilities reports whether a condition of any
+// dependency of the chart or its subcharts references Capabilities, i.e.
+// whether the capabilities are needed to process the dependencies.
+func DependencyConditionsUseCapabilities(c *chart.Chart) bool {
+	for _, dep := range c.Metadata.Dependencies {
+		if dep == nil {
+			continue
+		}
+		for _, condition := range strings.Split(dep.Condition, ",") {
+			if isCapabilitiesCondition(condition) {
+				return true
+			}
+		}
+	}
+
+	for _, sc := range c.Dependencies() {
+		if DependencyConditionsUseCapabilities(sc) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -17,12 +17,14 @@ package chartutil
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"testing"
 
 	"github.com/werf/3p-helm/pkg/chart"
 	"github.com/werf/3p-helm/pkg/chart/loader"
+	"github.com/werf/3p-helm/pkg/werf/secrets"
 )
 
 func loadChart(t *testing.T, path string) *chart.Chart {
@@ -570,3 +572,112 @@ func TestDependentChartsWithSomeSubchartsSpecifiedInDependency(t *testing.T) {
 		t.Fatalf("expected 1 dependency specified in Chart.yaml, got %d", len(c.Metadata.Dependencies))
 	}
 }
+
+func TestProcessDependenciesWithMergeAndReport(t *testing.T) {
+	newChart := func(name string, deps ...*chart.Chart) *chart.Chart {
+		c := &chart.Chart{
+			Metadata:           &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: "0.1.0"},
+			SecretsRuntimeData: secrets.NewSecretsRuntimeData(),
+		}
+		c.SetDependencies(deps...)
+		return c
+	}
+
+	c := newChart("parent",
+		newChart("database"),
+		newChart("cache", newChart("metrics")),
+		newChart("common"),
+		newChart("tagged"),
+	)
+	c.Metadata.Dependencies = []*chart.Dependency{
+		{Name: "database", Version: "0.1.0", Condition: "database.missing,database.enabled"},
+		{Name: "cache", Version: "0.1.0", Tags: []string{"unset", "backend"}},
+		{Name: "common", Version: "0.1.0"},
+		{Name: "tagged", Version: "0.1.0", Tags: []string{"frontend"}, Condition: "tagged.enabled"},
+	}
+	c.Dependencies()[1].Metadata.Dependencies = []*chart.Dependency{
+		{Name: "metrics", Version: "0.1.0", Condition: "metrics.enabled"},
+	}
+
+	vals := map[string]interface{}{
+		"database": map[string]interface{}{"enabled": false},
+		"tags":     map[string]interface{}{"backend": true, "frontend": false},
+		"tagged":   map[string]interface{}{"enabled": true},
+		"cache":    map[string]interface{}{"metrics": map[string]interface{}{"enabled": false}},
+	}
+
+	report, err := ProcessDependenciesWithMergeAndReport(c, &vals, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []chart.DependencyResolution{
+		{Path: "database", Version: "0.1.0", Enabled: false, DecidedBy: chart.DependencyDecisionCondition, Key: "database.enabled"},
+		{Path: "cache", Version: "0.1.0", Enabled: true, DecidedBy: chart.DependencyDecisionTags, Key: "backend"},
+		{Path: "common", Version: "0.1.0", Enabled: true, DecidedBy: chart.DependencyDecisionDefault},
+		{Path: "tagged", Version: "0.1.0", Enabled: true, DecidedBy: chart.DependencyDecisionCondition, Key: "tagged.enabled"},
+		{Path: "cache.metrics", Version: "0.1.0", Enabled: false, DecidedBy: chart.DependencyDecisionCondition, Key: "metrics.enabled"},
+	}
+	if len(report) != len(expected) {
+		t.Fatalf("expected %d resolutions, got %d", len(expected), len(report))
+	}
+	for i, r := range report {
+		if *r != expected[i] {
+			t.Errorf("expected resolution %d to be %+v, got %+v", i, expected[i], *r)
+		}
+	}
+}
+
+func TestProcessDependenciesCapabilitiesConditions(t *testing.T) {
+	newChart := func() *chart.Chart {
+		c := &chart.Chart{
+			Metadata:           &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "parent", Version: "0.1.0"},
+			SecretsRuntimeData: secrets.NewSecretsRuntimeData(),
+		}
+		for _, name := range []string{"monitoring", "gateway", "legacy", "overridden"} {
+			c.AddDependency(&chart.Chart{
+				Metadata:           &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: "0.1.0"},
+				SecretsRuntimeData: secrets.NewSecretsRuntimeData(),
+			})
+		}
+		c.Metadata.Dependencies = []*chart.Dependency{
+			{Name: "monitoring", Version: "0.1.0", Condition: "Capabilities.APIVersions.Has monitoring.coreos.com/v1"},
+			{Name: "gateway", Version: "0.1.0", Condition: "Capabilities.APIVersions.Has gateway.networking.k8s.io/v1"},
+			{Name: "legacy", Version: "0.1.0", Condition: "Capabilities.KubeVersion <1.20.0-0"},
+			{Name: "overridden", Version: "0.1.0", Condition: "overridden.enabled, Capabilities.APIVersions.Has monitoring.coreos.com/v1"},
+		}
+		return c
+	}
+
+	caps := DefaultCapabilities.Copy()
+	caps.APIVersions = append(caps.APIVersions, "monitoring.coreos.com/v1")
+
+	if !DependencyConditionsUseCapabilities(newChart()) {
+		t.Fatal("expected dependency conditions to use capabilities")
+	}
+
+	vals := map[string]interface{}{"overridden": map[string]interface{}{"enabled": false}}
+	c := newChart()
+	if _, err := ProcessDependenciesWithMergeAndReport(c, &vals, caps); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, dep := range c.Dependencies() {
+		names = append(names, dep.Name())
+	}
+	sort.Strings(names)
+	if expected := []string{"monitoring"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected enabled dependencies %v, got %v", expected, names)
+	}
+
+	// Without capabilities the conditions referencing them are skipped.
+	vals = map[string]interface{}{"overridden": map[string]interface{}{"enabled": false}}
+	c = newChart()
+	if _, err := ProcessDependenciesWithMergeAndReport(c, &vals, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Dependencies()) != 3 {
+		t.Errorf("expected 3 enabled dependencies without capabilities, got %d", len(c.Dependencies()))
+	}
+}
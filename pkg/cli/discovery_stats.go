@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/util/homedir"
+
+	"github.com/werf/3p-helm/pkg/cachestats"
+)
+
+// discoveryStatsRESTClientGetter counts the lookups of the discovery client
+// in the cachestats.Discovery statistics. A lookup is a miss if the discovery
+// client had to request the API server for it, and a hit if it was served from
+// the discovery cache.
+type discoveryStatsRESTClientGetter struct {
+	*genericclioptions.ConfigFlags
+
+	// requests counts the discovery requests made to the API server.
+	requests atomic.Uint64
+}
+
+func newDiscoveryStatsRESTClientGetter(flags *genericclioptions.ConfigFlags) *discoveryStatsRESTClientGetter {
+	getter := &discoveryStatsRESTClientGetter{ConfigFlags: flags}
+
+	wrapConfig := flags.WrapConfigFn
+	flags.WrapConfigFn = func(config *rest.Config) *rest.Config {
+		if wrapConfig != nil {
+			config = wrapConfig(config)
+		}
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &discoveryCountingRoundTripper{wrapped: rt, requests: &getter.requests}
+		})
+		return config
+	}
+
+	cachestats.For(cachestats.Discovery).CountEntriesWith(func() (int64, error) {
+		return countDiscoveryCacheEntries(discoveryCacheDir())
+	})
+
+	return getter
+}
+
+func (g *discoveryStatsRESTClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	client, err := g.ConfigFlags.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingDiscoveryClient{CachedDiscoveryInterface: client, requests: &g.requests}, nil
+}
+
+// ToRESTMapper builds the mapper as ConfigFlags does, but on top of the
+// counting discovery client.
+func (g *discoveryStatsRESTClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	client, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(client)
+	return restmapper.NewShortcutExpander(mapper, client, func(string) {}), nil
+}
+
+// countingDiscoveryClient counts the lookups of the resources and the groups
+// of the API server. The lookups made concurrently by the same client may be
+// counted as misses together if one of them requests the API server.
+type countingDiscoveryClient struct {
+	discovery.CachedDiscoveryInterface
+
+	requests *atomic.Uint64
+}
+
+func (c *countingDiscoveryClient) count(lookup func()) {
+	before := c.requests.Load()
+	lookup()
+	if c.requests.Load() == before {
+		cachestats.For(cachestats.Discovery).Hit()
+	} else {
+		cachestats.For(cachestats.Discovery).Miss()
+	}
+}
+
+func (c *countingDiscoveryClient) ServerGroups() (result *metav1.APIGroupList, err error) {
+	c.count(func() { result, err = c.CachedDiscoveryInterface.ServerGroups() })
+	return result, err
+}
+
+func (c *countingDiscoveryClient) ServerResourcesForGroupVersion(groupVersion string) (result *metav1.APIResourceList, err error) {
+	c.count(func() { result, err = c.CachedDiscoveryInterface.ServerResourcesForGroupVersion(groupVersion) })
+	return result, err
+}
+
+func (c *countingDiscoveryClient) ServerGroupsAndResources() (groups []*metav1.APIGroup, resources []*metav1.APIResourceList, err error) {
+	c.count(func() { groups, resources, err = c.CachedDiscoveryInterface.ServerGroupsAndResources() })
+	return groups, resources, err
+}
+
+func (c *countingDiscoveryClient) ServerPreferredResources() (result []*metav1.APIResourceList, err error) {
+	c.count(func() { result, err = c.CachedDiscoveryInterface.ServerPreferredResources() })
+	return result, err
+}
+
+func (c *countingDiscoveryClient) ServerPreferredNamespacedResources() (result []*metav1.APIResourceList, err error) {
+	c.count(func() { result, err = c.CachedDiscoveryInterface.ServerPreferredNamespacedResources() })
+	return result, err
+}
+
+type discoveryCountingRoundTripper struct {
+	wrapped  http.RoundTripper
+	requests *atomic.Uint64
+}
+
+func (rt *discoveryCountingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isDiscoveryPath(req.URL.Path) {
+		rt.requests.Add(1)
+	}
+
+	return rt.wrapped.RoundTrip(req)
+}
+
+// isDiscoveryPath reports whether the path is one of the discovery documents
+// of the API server: "/api", "/api/<version>", "/apis", "/apis/<group>" or
+// "/apis/<group>/<version>", possibly behind the path prefix of a proxy.
+func isDiscoveryPath(path string) bool {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		switch part {
+		case "api":
+			return len(parts)-i <= 2
+		case "apis":
+			return len(parts)-i <= 3
+		}
+	}
+
+	return false
+}
+
+// discoveryCacheDir is the directory ConfigFlags caches the discovery
+// documents in, for all the clusters.
+func discoveryCacheDir() string {
+	cacheDir := os.Getenv("KUBECACHEDIR")
+	if cacheDir == "" {
+		cacheDir = filepath.Join(homedir.HomeDir(), ".kube", "cache")
+	}
+
+	return filepath.Join(cacheDir, "discovery")
+}
+
+// countDiscoveryCacheEntries counts the group versions cached in the
+// directory.
+func countDiscoveryCacheEntries(dir string) (int64, error) {
+	var count int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && entry.Name() == "serverresources.json" {
+			count++
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	return count, err
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"github.com/werf/3p-helm/pkg/cachestats"
+)
+
+func discoveryStats() cachestats.Stats {
+	for _, stats := range cachestats.Snapshot() {
+		if stats.Name == cachestats.Discovery {
+			return stats
+		}
+	}
+
+	return cachestats.Stats{}
+}
+
+func TestDiscoveryStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body interface{}
+		switch r.URL.Path {
+		case "/api":
+			body = &metav1.APIVersions{Versions: []string{"v1"}}
+		case "/apis":
+			body = &metav1.APIGroupList{}
+		case "/api/v1":
+			body = &metav1.APIResourceList{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "pods", Namespaced: true, Kind: "Pod"}}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+	t.Setenv("KUBECACHEDIR", cacheDir)
+
+	kubeConfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeConfig, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	flags := genericclioptions.NewConfigFlags(false)
+	flags.KubeConfig, flags.APIServer = &kubeConfig, &server.URL
+	getter := newDiscoveryStatsRESTClientGetter(flags)
+
+	before := discoveryStats()
+	for i := 0; i < 2; i++ {
+		client, err := getter.ToDiscoveryClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ServerResourcesForGroupVersion("v1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after := discoveryStats()
+
+	if misses := after.Misses - before.Misses; misses != 1 {
+		t.Errorf("expected the first lookup to miss the cache, got %d misses", misses)
+	}
+	if hits := after.Hits - before.Hits; hits != 1 {
+		t.Errorf("expected the second lookup to be served from the cache, got %d hits", hits)
+	}
+	if after.Entries != 1 {
+		t.Errorf("expected a cached group version, got %d entries", after.Entries)
+	}
+}
+
+func TestIsDiscoveryPath(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"/api":                              true,
+		"/api/v1":                           true,
+		"/apis":                             true,
+		"/apis/apps":                        true,
+		"/apis/apps/v1":                     true,
+		"/k8s/clusters/c-1/apis/apps/v1":    true,
+		"/api/v1/namespaces":                false,
+		"/apis/apps/v1/deployments":         false,
+		"/version":                          false,
+		"/api/v1/namespaces/api/configmaps": false,
+	} {
+		if actual := isDiscoveryPath(path); actual != expected {
+			t.Errorf("expected %t for %q, got %t", expected, path, actual)
+		}
+	}
+}
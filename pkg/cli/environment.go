@@ -111,8 +111,8 @@ func New() *EnvSettings {
 	}
 	env.Debug, _ = strconv.ParseBool(os.Getenv("HELM_DEBUG"))
 
-	// bind to kubernetes config flags
-	env.config = &genericclioptions.ConfigFlags{
+	// bind to kubernetes config flags, counting the discovery cache lookups
+	env.config = newDiscoveryStatsRESTClientGetter(&genericclioptions.ConfigFlags{
 		Namespace:        &env.namespace,
 		Context:          &env.KubeContext,
 		BearerToken:      &env.KubeToken,
@@ -132,7 +132,7 @@ func New() *EnvSettings {
 			config.UserAgent = version.GetUserAgent()
 			return config
 		},
-	}
+	})
 	return env
 }
 
@@ -0,0 +1,182 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package output
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AnnotationLevel is the severity of a CI annotation
+type AnnotationLevel string
+
+const (
+	AnnotationNotice  AnnotationLevel = "notice"
+	AnnotationWarning AnnotationLevel = "warning"
+	AnnotationError   AnnotationLevel = "error"
+)
+
+// Annotation is a single message that CI systems can attach to a file (and
+// optionally a line) in the pipeline UI
+type Annotation struct {
+	Level   AnnotationLevel
+	File    string
+	Line    int
+	Title   string
+	Message string
+}
+
+// CIWriter is an interface that types can implement to support the GitHub
+// and GitLab output formats in addition to the ones required by Writer
+type CIWriter interface {
+	// WriteCI will write the result through the given CIReporter, returning
+	// an error if any occur
+	WriteCI(r *CIReporter) error
+}
+
+// CIReporter writes annotations and collapsible sections in a format
+// understood by a CI system
+type CIReporter struct {
+	format Format
+	out    io.Writer
+	now    func() time.Time
+}
+
+// NewCIReporter creates a CIReporter writing into out. The format must be
+// either GitHub or GitLab.
+func NewCIReporter(out io.Writer, format Format) *CIReporter {
+	return &CIReporter{
+		format: format,
+		out:    out,
+		now:    time.Now,
+	}
+}
+
+// Annotate writes a single annotation.
+//
+// GitHub Actions renders annotations natively. GitLab CI has no annotations,
+// so they are written as plain log lines prefixed with the level.
+func (r *CIReporter) Annotate(a Annotation) error {
+	var err error
+	switch r.format {
+	case GitHub:
+		var props []string
+		if a.File != "" {
+			props = append(props, "file="+escapeGitHubProperty(a.File))
+			if a.Line > 0 {
+				props = append(props, fmt.Sprintf("line=%d", a.Line))
+			}
+		}
+		if a.Title != "" {
+			props = append(props, "title="+escapeGitHubProperty(a.Title))
+		}
+
+		cmd := "::" + string(a.Level)
+		if len(props) > 0 {
+			cmd += " " + strings.Join(props, ",")
+		}
+		_, err = fmt.Fprintf(r.out, "%s::%s\n", cmd, escapeGitHubData(a.Message))
+	case GitLab:
+		location := a.File
+		if location != "" && a.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location, a.Line)
+		}
+
+		var parts []string
+		for _, p := range []string{location, a.Title, a.Message} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		_, err = fmt.Fprintf(r.out, "%s: %s\n", strings.ToUpper(string(a.Level)), strings.Join(parts, ": "))
+	default:
+		return ErrInvalidFormatType
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to write CI annotation")
+	}
+	return nil
+}
+
+// Section wraps everything written by fn into a collapsible section with the
+// given header. The name identifies the section and is only used by GitLab.
+func (r *CIReporter) Section(name, header string, fn func() error) error {
+	var err error
+	switch r.format {
+	case GitHub:
+		_, err = fmt.Fprintf(r.out, "::group::%s\n", escapeGitHubData(header))
+	case GitLab:
+		name = gitlabSectionName(name)
+		_, err = fmt.Fprintf(r.out, "\x1b[0Ksection_start:%d:%s[collapsed=true]\r\x1b[0K%s\n", r.now().Unix(), name, header)
+	default:
+		return ErrInvalidFormatType
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to write CI section")
+	}
+
+	fnErr := fn()
+
+	switch r.format {
+	case GitHub:
+		_, err = fmt.Fprintln(r.out, "::endgroup::")
+	case GitLab:
+		_, err = fmt.Fprintf(r.out, "\x1b[0Ksection_end:%d:%s\r\x1b[0K\n", r.now().Unix(), name)
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to write CI section")
+	}
+	return nil
+}
+
+// Printf writes a plain log line
+func (r *CIReporter) Printf(format string, a ...interface{}) error {
+	if _, err := fmt.Fprintf(r.out, format, a...); err != nil {
+		return errors.Wrap(err, "unable to write CI output")
+	}
+	return nil
+}
+
+var gitlabSectionNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// gitlabSectionName returns name with the characters that GitLab does not
+// allow in section names replaced
+func gitlabSectionName(name string) string {
+	return gitlabSectionNameInvalidChars.ReplaceAllString(name, "_")
+}
+
+// escapeGitHubData escapes the message part of a GitHub workflow command
+func escapeGitHubData(s string) string {
+	s = strings.ReplaceAll(s, "%", "%25")
+	s = strings.ReplaceAll(s, "\r", "%0D")
+	return strings.ReplaceAll(s, "\n", "%0A")
+}
+
+// escapeGitHubProperty escapes a property value of a GitHub workflow command
+func escapeGitHubProperty(s string) string {
+	s = escapeGitHubData(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, ",", "%2C")
+}
@@ -0,0 +1,118 @@
+/*
+Copyright The Helm Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package output
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCIReporterAnnotate(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     Format
+		annotation Annotation
+		expect     string
+	}{
+		{
+			name:   "github with file and line",
+			format: GitHub,
+			annotation: Annotation{
+				Level:   AnnotationError,
+				File:    "chart/templates/a,b.yaml",
+				Line:    3,
+				Title:   "Lint: error",
+				Message: "100% broken\nsecond line",
+			},
+			expect: "::error file=chart/templates/a%2Cb.yaml,line=3,title=Lint%3A error::100%25 broken%0Asecond line\n",
+		},
+		{
+			name:       "github without properties",
+			format:     GitHub,
+			annotation: Annotation{Level: AnnotationNotice, Message: "deployed"},
+			expect:     "::notice::deployed\n",
+		},
+		{
+			name:   "gitlab",
+			format: GitLab,
+			annotation: Annotation{
+				Level:   AnnotationWarning,
+				File:    "chart/Chart.yaml",
+				Line:    1,
+				Title:   "Lint warning",
+				Message: "icon is recommended",
+			},
+			expect: "WARNING: chart/Chart.yaml:1: Lint warning: icon is recommended\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewCIReporter(&buf, tt.format).Annotate(tt.annotation); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expect {
+				t.Errorf("expected %q, got %q", tt.expect, buf.String())
+			}
+		})
+	}
+}
+
+func TestCIReporterSection(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewCIReporter(&buf, GitHub)
+	if err := r.Section("release", "Release foo", func() error {
+		return r.Printf("STATUS: %s\n", "deployed")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "::group::Release foo\nSTATUS: deployed\n::endgroup::\n"
+	if buf.String() != expect {
+		t.Errorf("expected %q, got %q", expect, buf.String())
+	}
+
+	buf.Reset()
+	r = NewCIReporter(&buf, GitLab)
+	r.now = func() time.Time { return time.Unix(1700000000, 0) }
+	sectionErr := errors.New("boom")
+	if err := r.Section("release foo", "Release foo", func() error {
+		return sectionErr
+	}); err != sectionErr {
+		t.Fatalf("expected section error to be returned, got %v", err)
+	}
+	expect = "\x1b[0Ksection_start:1700000000:release_foo[collapsed=true]\r\x1b[0KRelease foo\n" +
+		"\x1b[0Ksection_end:1700000000:release_foo\r\x1b[0K\n"
+	if buf.String() != expect {
+		t.Errorf("expected %q, got %q", expect, buf.String())
+	}
+}
+
+type tableOnlyWriter struct{}
+
+func (tableOnlyWriter) WriteTable(io.Writer) error { return nil }
+func (tableOnlyWriter) WriteJSON(io.Writer) error  { return nil }
+func (tableOnlyWriter) WriteYAML(io.Writer) error  { return nil }
+
+func TestWriteCIFormatWithoutCIWriter(t *testing.T) {
+	if err := GitHub.Write(io.Discard, tableOnlyWriter{}); err != ErrInvalidFormatType {
+		t.Errorf("expected %v, got %v", ErrInvalidFormatType, err)
+	}
+}
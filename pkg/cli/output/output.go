@@ -30,9 +30,11 @@ import (
 type Format string
 
 const (
-	Table Format = "table"
-	JSON  Format = "json"
-	YAML  Format = "yaml"
+	Table  Format = "table"
+	JSON   Format = "json"
+	YAML   Format = "yaml"
+	GitHub Format = "github"
+	GitLab Format = "gitlab"
 )
 
 // Formats returns a list of the string representation of the supported formats
@@ -50,6 +52,21 @@ func FormatsWithDesc() map[string]string {
 	}
 }
 
+// CIFormats returns a list of the string representation of the CI formats,
+// supported only by the writers implementing CIWriter
+func CIFormats() []string {
+	return []string{GitHub.String(), GitLab.String()}
+}
+
+// CIFormatsWithDesc returns a list of the string representation of the CI
+// formats including a description
+func CIFormatsWithDesc() map[string]string {
+	return map[string]string{
+		GitHub.String(): "Output result as GitHub Actions workflow commands",
+		GitLab.String(): "Output result as GitLab CI collapsible sections",
+	}
+}
+
 // ErrInvalidFormatType is returned when an unsupported format type is used
 var ErrInvalidFormatType = fmt.Errorf("invalid format type")
 
@@ -68,6 +85,10 @@ func (o Format) Write(out io.Writer, w Writer) error {
 		return w.WriteJSON(out)
 	case YAML:
 		return w.WriteYAML(out)
+	case GitHub, GitLab:
+		if ciw, ok := w.(CIWriter); ok {
+			return ciw.WriteCI(NewCIReporter(out, o))
+		}
 	}
 	return ErrInvalidFormatType
 }
@@ -82,6 +103,10 @@ func ParseFormat(s string) (out Format, err error) {
 		out, err = JSON, nil
 	case YAML.String():
 		out, err = YAML, nil
+	case GitHub.String():
+		out, err = GitHub, nil
+	case GitLab.String():
+		out, err = GitLab, nil
 	default:
 		out, err = "", ErrInvalidFormatType
 	}
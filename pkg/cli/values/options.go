@@ -17,13 +17,21 @@ limitations under the License.
 package values
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/yaml"
 
 	"github.com/werf/3p-helm/pkg/chart"
@@ -34,6 +42,7 @@ import (
 
 // Options captures the different ways to specify values
 type Options struct {
+	ValueDirs     []string // --values-dir
 	ValueFiles    []string // -f/--values
 	StringValues  []string // --set-string
 	Values        []string // --set
@@ -42,33 +51,116 @@ type Options struct {
 	LiteralValues []string // --set-literal
 }
 
-// MergeValues merges values from files specified via -f/--values and directly
-// via --set-json, --set, --set-string, or --set-file, marshaling them to YAML
+// ResolvedValueFiles returns the values files in the order they are merged:
+// the YAML (.yaml, .yml) and JSON (.json) files of every --values-dir directory
+// in lexical order, followed by the -f/--values files. Subdirectories and
+// hidden files of the directories are ignored.
+func (opts *Options) ResolvedValueFiles() ([]string, error) {
+	files, err := opts.valueDirFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(files, opts.ValueFiles...), nil
+}
+
+// valueDirFiles returns the values files of the --values-dir directories in
+// the order they are merged.
+func (opts *Options) valueDirFiles() ([]string, error) {
+	var files []string
+	for _, dir := range opts.ValueDirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read values directory")
+		}
+
+		var names []string
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+
+			switch strings.ToLower(filepath.Ext(name)) {
+			case ".yaml", ".yml", ".json":
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+
+	return files, nil
+}
+
+// MergeValues merges values from files specified via --values-dir and
+// -f/--values and directly via --set-json, --set, --set-string, or --set-file,
+// marshaling them to YAML
 func (opts *Options) MergeValues(p getter.Providers) (map[string]interface{}, error) {
 	base := map[string]interface{}{}
 
-	// User specified a values files via -f/--values
-	for _, filePath := range opts.ValueFiles {
-		currentMap := map[string]interface{}{}
+	dirFiles, err := opts.valueDirFiles()
+	if err != nil {
+		return nil, err
+	}
+	valueFiles := append(dirFiles, opts.ValueFiles...)
 
-		var bytes []byte
+	// User specified a values files via --values-dir or -f/--values
+	for i, filePath := range valueFiles {
+		var content []byte
 		var err error
 		if chart.CurrentChartType == chart.ChartTypeChart {
-			bytes, err = loader.ChartFileReader.ReadChartFile(context.Background(), filePath)
+			content, err = loader.ChartFileReader.ReadChartFile(context.Background(), filePath)
 			if err != nil {
 				return nil, err
 			}
 		} else if data, err := readFile(filePath, p); err != nil {
 			return nil, err
 		} else {
-			bytes = data
+			content = data
+		}
+
+		if isJSONFile(filePath) {
+			currentMap := map[string]interface{}{}
+			if err := unmarshalJSONValues(content, &currentMap); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", filePath)
+			}
+			// Merge with the previous map
+			base = mergeMaps(base, currentMap)
+			continue
 		}
 
-		if err := yaml.Unmarshal(bytes, &currentMap); err != nil {
-			return nil, errors.Wrapf(err, "failed to parse %s", filePath)
+		if i >= len(dirFiles) {
+			currentMap := map[string]interface{}{}
+			if err := yaml.Unmarshal(content, &currentMap); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", filePath)
+			}
+			// Merge with the previous map
+			base = mergeMaps(base, currentMap)
+			continue
+		}
+
+		// Every document of a YAML file of a --values-dir directory is
+		// merged in order, as overlays of the directory
+		reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+		for {
+			document, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", filePath)
+			}
+
+			currentMap := map[string]interface{}{}
+			if err := yaml.Unmarshal(document, &currentMap); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s", filePath)
+			}
+			// Merge with the previous map
+			base = mergeMaps(base, currentMap)
 		}
-		// Merge with the previous map
-		base = mergeMaps(base, currentMap)
 	}
 
 	// User specified a value via --set-json
@@ -142,6 +234,30 @@ func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
 	return out
 }
 
+// isJSONFile reports whether the values file, local or remote, has the .json
+// extension.
+func isJSONFile(filePath string) bool {
+	if u, err := url.Parse(filePath); err == nil && u.Scheme != "" && u.Path != "" {
+		filePath = u.Path
+	}
+	return strings.EqualFold(path.Ext(filePath), ".json")
+}
+
+// unmarshalJSONValues parses a JSON values file. The values are the same as if
+// the file was parsed as YAML, but syntax errors point to the line and column.
+func unmarshalJSONValues(data []byte, currentMap *map[string]interface{}) error {
+	err := json.Unmarshal(data, currentMap)
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := 1 + bytes.Count(data[:syntaxErr.Offset], []byte("\n"))
+		column := int(syntaxErr.Offset) - bytes.LastIndexByte(data[:syntaxErr.Offset], '\n') - 1
+		return fmt.Errorf("line %d, column %d: %w", line, column, err)
+	}
+
+	return err
+}
+
 // readFile load a file from stdin, the local directory, or a remote file with a url.
 func readFile(filePath string, p getter.Providers) ([]byte, error) {
 	if strings.TrimSpace(filePath) == "-" {
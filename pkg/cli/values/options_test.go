@@ -17,9 +17,13 @@ limitations under the License.
 package values
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/werf/3p-helm/pkg/chart"
 	"github.com/werf/3p-helm/pkg/getter"
 )
 
@@ -86,3 +90,110 @@ func TestReadFile(t *testing.T) {
 		t.Errorf("Expected error when has special strings")
 	}
 }
+
+func TestMergeValuesJSONFiles(t *testing.T) {
+	defer func(chartType chart.ChartType) { chart.CurrentChartType = chartType }(chart.CurrentChartType)
+	chart.CurrentChartType = chart.ChartTypeSubchart
+
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "values.yaml")
+	jsonFile := filepath.Join(dir, "generated.JSON")
+	invalidFile := filepath.Join(dir, "invalid.json")
+
+	if err := os.WriteFile(yamlFile, []byte("replicas: 1\nimage:\n  repository: app\n  tag: v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jsonFile, []byte(`{"replicas": 3, "image": {"tag": "v2"}, "ports": [80, 443]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalidFile, []byte("{\n  \"replicas\": 3,\n  \"image\" {}\n}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Options{ValueFiles: []string{yamlFile, jsonFile}}
+	vals, err := opts.MergeValues(getter.Providers{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"replicas": float64(3),
+		"image": map[string]interface{}{
+			"repository": "app",
+			"tag":        "v2",
+		},
+		"ports": []interface{}{float64(80), float64(443)},
+	}
+	if !reflect.DeepEqual(vals, expected) {
+		t.Errorf("Expected %v, got %v", expected, vals)
+	}
+
+	opts = &Options{ValueFiles: []string{invalidFile}}
+	if _, err := opts.MergeValues(getter.Providers{}); err == nil || !strings.Contains(err.Error(), "line 3, column 11") {
+		t.Errorf("Expected a syntax error pointing to line 3, column 11, got %v", err)
+	}
+}
+
+func TestMergeValuesDirectories(t *testing.T) {
+	defer func(chartType chart.ChartType) { chart.CurrentChartType = chartType }(chart.CurrentChartType)
+	chart.CurrentChartType = chart.ChartTypeSubchart
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"20-region.yml":      "region: eu\nimage:\n  tag: v2\n---\nreplicas: 2\n",
+		"10-base.yaml":       "replicas: 1\nregion: us\nimage:\n  repository: app\n  tag: v1\n",
+		"30-generated.json":  `{"replicas": 3}`,
+		".hidden.yaml":       "replicas: 100\n",
+		"README.md":          "not values\n",
+		"nested/zz-sub.yaml": "replicas: 200\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	overrideFile := filepath.Join(t.TempDir(), "override.yaml")
+	if err := os.WriteFile(overrideFile, []byte("image:\n  tag: v3\n---\nregion: ap\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &Options{ValueDirs: []string{dir}, ValueFiles: []string{overrideFile}}
+
+	files, err := opts.ResolvedValueFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := []string{
+		filepath.Join(dir, "10-base.yaml"),
+		filepath.Join(dir, "20-region.yml"),
+		filepath.Join(dir, "30-generated.json"),
+		overrideFile,
+	}
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Errorf("Expected files %v, got %v", expectedFiles, files)
+	}
+
+	vals, err := opts.MergeValues(getter.Providers{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"replicas": float64(3),
+		"region":   "eu",
+		"image": map[string]interface{}{
+			"repository": "app",
+			"tag":        "v3",
+		},
+	}
+	if !reflect.DeepEqual(vals, expected) {
+		t.Errorf("Expected %v, got %v", expected, vals)
+	}
+
+	opts = &Options{ValueDirs: []string{filepath.Join(dir, "missing")}}
+	if _, err := opts.MergeValues(getter.Providers{}); err == nil {
+		t.Error("Expected an error for a missing values directory")
+	}
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/chartutil"
+)
+
+// syntheticChart returns the chart of the app rendering the number of the
+// resources, a Deployment, a Service and a ConfigMap per app of the values,
+// and its values ready for rendering.
+func syntheticChart(resources int) (*chart.Chart, chartutil.Values) {
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "app", Version: "1.0.0"},
+		Templates: []*chart.File{
+			{Name: "templates/_helpers.tpl", Data: []byte(`{{- define "app.labels" -}}
+app.kubernetes.io/name: {{ .name }}
+app.kubernetes.io/managed-by: helm
+{{- end -}}`)},
+			{Name: "templates/deployments.yaml", Data: []byte(`{{- range .Values.apps }}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .name }}
+  labels:
+{{ include "app.labels" . | indent 4 }}
+spec:
+  replicas: {{ .replicas }}
+  selector:
+    matchLabels:
+{{ include "app.labels" . | indent 6 }}
+  template:
+    metadata:
+      labels:
+{{ include "app.labels" . | indent 8 }}
+    spec:
+      containers:
+      - name: app
+        image: {{ printf "%s:%s" $.Values.image.repository .tag | quote }}
+        envFrom:
+        - configMapRef:
+            name: {{ .name }}
+{{- end }}`)},
+			{Name: "templates/services.yaml", Data: []byte(`{{- range .Values.apps }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .name }}
+  labels:
+{{ include "app.labels" . | indent 4 }}
+spec:
+  selector:
+{{ include "app.labels" . | indent 4 }}
+  ports:
+  - port: 80
+    targetPort: 8080
+{{- end }}`)},
+			{Name: "templates/configmaps.yaml", Data: []byte(`{{- range .Values.apps }}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .name }}
+data:
+{{ toYaml .env | indent 2 }}
+{{- end }}`)},
+		},
+	}
+
+	var apps []interface{}
+	for i := 0; i < resources/3; i++ {
+		apps = append(apps, map[string]interface{}{
+			"name":     fmt.Sprintf("app-%d", i),
+			"replicas": 2,
+			"tag":      fmt.Sprintf("v%d", i),
+			"env":      map[string]interface{}{"LOG_LEVEL": "info", "LISTEN": ":8080"},
+		})
+	}
+
+	values := chartutil.Values{
+		"Values": map[string]interface{}{
+			"image": map[string]interface{}{"repository": "registry.example.com/app"},
+			"apps":  apps,
+		},
+		"Release": map[string]interface{}{"Name": "app", "Namespace": "bench"},
+	}
+
+	return c, values
+}
+
+func BenchmarkRender(b *testing.B) {
+	for _, size := range []int{1000, 5000} {
+		c, values := syntheticChart(size)
+		b.Run(fmt.Sprintf("%dk", size/1000), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Render(c, values); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
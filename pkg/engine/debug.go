@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/chartutil"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+)
+
+// renderDebugger writes the output of every executed template, the context it
+// was executed with and the time the execution took into a directory.
+type renderDebugger struct {
+	dir     string
+	timings []templateTiming
+}
+
+type templateTiming struct {
+	name     string
+	duration time.Duration
+	err      error
+}
+
+// record writes the output and the context of the template. The output of a
+// failed template is the partial output produced before the failure. Secrets
+// and resources annotated with releaseutil.SensitiveAnnotation are redacted in
+// the output. The values are redacted in the context, only their keys are kept.
+func (d *renderDebugger) record(filename string, vals chartutil.Values, output string, duration time.Duration, execErr error) error {
+	d.timings = append(d.timings, templateTiming{name: filename, duration: duration, err: execErr})
+
+	outputPath := filepath.Join(d.dir, filepath.FromSlash(filename))
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return errors.Wrap(err, "unable to create render debug directory")
+	}
+
+	if err := os.WriteFile(outputPath, []byte(releaseutil.RedactSensitiveManifest(output)), 0644); err != nil {
+		return errors.Wrapf(err, "unable to write rendered output of %s", filename)
+	}
+
+	// Files are left out as they are the same for every template and may be large.
+	context := map[string]interface{}{}
+	for k, v := range vals {
+		switch k {
+		case "Files":
+		case "Values":
+			context[k] = redactValuesTree(v)
+		default:
+			context[k] = v
+		}
+	}
+
+	data, err := yaml.Marshal(context)
+	if err != nil {
+		data = []byte(fmt.Sprintf("# unable to marshal the template context: %s\n", err))
+	}
+
+	if err := os.WriteFile(outputPath+".context.yaml", data, 0644); err != nil {
+		return errors.Wrapf(err, "unable to write context of %s", filename)
+	}
+
+	return nil
+}
+
+// redactValuesTree replaces every value of the tree with
+// releaseutil.RedactedValue, keeping the keys of the maps.
+func redactValuesTree(value interface{}) interface{} {
+	switch v := value.(type) {
+	case chartutil.Values:
+		return redactValuesTree(map[string]interface{}(v))
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			result[key] = redactValuesTree(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = redactValuesTree(val)
+		}
+		return result
+	case nil:
+		return nil
+	default:
+		return releaseutil.RedactedValue
+	}
+}
+
+// writeTimings writes the execution times of the templates, slowest first.
+func (d *renderDebugger) writeTimings() error {
+	timings := make([]templateTiming, len(d.timings))
+	copy(timings, d.timings)
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].duration > timings[j].duration
+	})
+
+	var total time.Duration
+	var b strings.Builder
+	for _, t := range timings {
+		total += t.duration
+		fmt.Fprintf(&b, "%-12s %s", t.duration.Round(time.Microsecond), t.name)
+		if t.err != nil {
+			b.WriteString(" (failed)")
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%-12s total for %d templates\n", total.Round(time.Microsecond), len(timings))
+
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return errors.Wrap(err, "unable to create render debug directory")
+	}
+
+	if err := os.WriteFile(filepath.Join(d.dir, "timings.txt"), []byte(b.String()), 0644); err != nil {
+		return errors.Wrap(err, "unable to write template timings")
+	}
+
+	return nil
+}
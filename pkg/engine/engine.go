@@ -17,6 +17,7 @@ limitations under the License.
 package engine
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path"
@@ -25,6 +26,7 @@ import (
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/pkg/errors"
 	"k8s.io/client-go/rest"
@@ -46,6 +48,19 @@ type Engine struct {
 	clientProvider *ClientProvider
 	// EnableDNS tells the engine to allow DNS lookups when rendering templates
 	EnableDNS bool
+	// DebugDir, if set, enables the debug render mode: the output of every
+	// template, the context it was rendered with and the render time of every
+	// template are written into this directory.
+	DebugDir string
+	// TemplateTimeout, if set, limits the render time of every template.
+	TemplateTimeout time.Duration
+	// RenderTimeout, if set, limits the total render time of all templates.
+	RenderTimeout time.Duration
+	// ImageResolver resolves the image digests for the "werf_image" function.
+	ImageResolver ImageDigestResolver
+	// ImageDigestCacheFile, if set, is the JSON file the resolved image
+	// digests are stored in and read from when the registry is unreachable.
+	ImageDigestCacheFile string
 }
 
 // New creates a new instance of Engine using the passed in rest config.
@@ -128,9 +143,12 @@ func warnWrap(warn string) string {
 
 // 'include' needs to be defined in the scope of a 'tpl' template as
 // well as regular file-loaded templates.
-func includeFun(t *template.Template, includedNames map[string]int) func(string, interface{}) (string, error) {
+func includeFun(t *template.Template, includedNames map[string]int, rc *renderContext) func(string, interface{}) (string, error) {
 	return func(name string, data interface{}) (string, error) {
-		var buf strings.Builder
+		buf := rc.writer()
+		if err := buf.err(); err != nil {
+			return "", err
+		}
 		if v, ok := includedNames[name]; ok {
 			if v > recursionMaxNums {
 				return "", errors.Wrapf(fmt.Errorf("unable to execute template"), "rendering template has a nested reference name: %s", name)
@@ -139,7 +157,7 @@ func includeFun(t *template.Template, includedNames map[string]int) func(string,
 		} else {
 			includedNames[name] = 1
 		}
-		err := t.ExecuteTemplate(&buf, name, data)
+		err := t.ExecuteTemplate(buf, name, data)
 		includedNames[name]--
 		return buf.String(), err
 	}
@@ -147,13 +165,17 @@ func includeFun(t *template.Template, includedNames map[string]int) func(string,
 
 // As does 'tpl', so that nested calls to 'tpl' see the templates
 // defined by their enclosing contexts.
-func tplFun(parent *template.Template, includedNames map[string]int, strict bool) func(string, interface{}) (string, error) {
+func tplFun(parent *template.Template, includedNames map[string]int, strict bool, rc *renderContext) func(string, interface{}) (string, error) {
 	return func(tpl string, vals interface{}) (string, error) {
 		// No templating required if plain text with no templates passed.
 		if !strings.Contains(tpl, "{{") && !strings.Contains(tpl, "}}") {
 			return tpl, nil
 		}
 
+		if err := rc.err(); err != nil {
+			return "", err
+		}
+
 		t, err := parent.Clone()
 		if err != nil {
 			return "", errors.Wrapf(err, "cannot clone template")
@@ -171,8 +193,8 @@ func tplFun(parent *template.Template, includedNames map[string]int, strict bool
 		// Re-inject 'include' so that it can close over our clone of t;
 		// this lets any 'define's inside tpl be 'include'd.
 		t.Funcs(template.FuncMap{
-			"include": includeFun(t, includedNames),
-			"tpl":     tplFun(t, includedNames, strict),
+			"include": includeFun(t, includedNames, rc),
+			"tpl":     tplFun(t, includedNames, strict, rc),
 		})
 
 		// We need a .New template, as template text which is just blanks
@@ -186,8 +208,8 @@ func tplFun(parent *template.Template, includedNames map[string]int, strict bool
 			return "", errors.Wrapf(err, "cannot parse template %q", tpl)
 		}
 
-		var buf strings.Builder
-		if err := t.Execute(&buf, vals); err != nil {
+		buf := rc.writer()
+		if err := t.Execute(buf, vals); err != nil {
 			return "", errors.Wrapf(err, "error during tpl function execution for %q", tpl)
 		}
 
@@ -197,13 +219,14 @@ func tplFun(parent *template.Template, includedNames map[string]int, strict bool
 }
 
 // initFunMap creates the Engine's FuncMap and adds context-specific functions.
-func (e Engine) initFunMap(t *template.Template, secretsRuntimeData runtimedata.RuntimeData) {
+// The template-rendering functions fail once the render context is done.
+func (e Engine) initFunMap(t *template.Template, secretsRuntimeData runtimedata.RuntimeData, rc *renderContext) {
 	funcMap := funcMap()
 	includedNames := make(map[string]int)
 
 	// Add the template-rendering functions here so we can close over t.
-	funcMap["include"] = includeFun(t, includedNames)
-	funcMap["tpl"] = tplFun(t, includedNames, e.Strict)
+	funcMap["include"] = includeFun(t, includedNames, rc)
+	funcMap["tpl"] = tplFun(t, includedNames, e.Strict, rc)
 
 	// Add the `required` function here so we can use lintMode
 	funcMap["required"] = func(warn string, val interface{}) (interface{}, error) {
@@ -243,6 +266,11 @@ func (e Engine) initFunMap(t *template.Template, secretsRuntimeData runtimedata.
 		funcMap["lookup"] = newLookupFunction(*e.clientProvider)
 	}
 
+	// Without a registry client or a digest cache, images are left unpinned.
+	if !e.LintMode && (e.ImageResolver != nil || e.ImageDigestCacheFile != "") {
+		funcMap["werf_image"] = newImageFunction(e.ImageResolver, e.ImageDigestCacheFile)
+	}
+
 	// When DNS lookups are not enabled override the sprig function and return
 	// an empty string.
 	if !e.EnableDNS {
@@ -286,7 +314,8 @@ func (e Engine) render(tpls map[string]renderable, secretsRuntimeData runtimedat
 		t.Option("missingkey=zero")
 	}
 
-	e.initFunMap(t, secretsRuntimeData)
+	rc := &renderContext{}
+	e.initFunMap(t, secretsRuntimeData, rc)
 
 	// We want to parse the templates in a predictable order. The order favors
 	// higher-level (in file system) templates over deeply nested templates.
@@ -299,6 +328,30 @@ func (e Engine) render(tpls map[string]renderable, secretsRuntimeData runtimedat
 		}
 	}
 
+	var debugger *renderDebugger
+	if e.DebugDir != "" {
+		debugger = &renderDebugger{dir: e.DebugDir}
+		defer func() {
+			if timingsErr := debugger.writeTimings(); timingsErr != nil && err == nil {
+				err = timingsErr
+			}
+		}()
+	}
+
+	renderCtx := context.Background()
+	if e.RenderTimeout > 0 || e.TemplateTimeout > 0 {
+		// Stops the template left running in the background after a timeout
+		// once the render is over.
+		var cancel context.CancelFunc
+		renderCtx, cancel = context.WithCancel(renderCtx)
+		defer cancel()
+	}
+	if e.RenderTimeout > 0 {
+		var cancel context.CancelFunc
+		renderCtx, cancel = context.WithTimeout(renderCtx, e.RenderTimeout)
+		defer cancel()
+	}
+
 	rendered = make(map[string]string, len(keys))
 	for _, filename := range keys {
 		// Don't render partials. We don't care out the direct output of partials.
@@ -309,15 +362,21 @@ func (e Engine) render(tpls map[string]renderable, secretsRuntimeData runtimedat
 		// At render time, add information about the template that is being rendered.
 		vals := tpls[filename].vals
 		vals["Template"] = chartutil.Values{"Name": filename, "BasePath": tpls[filename].basePath}
-		var buf strings.Builder
-		if err := t.ExecuteTemplate(&buf, filename, vals); err != nil {
-			return map[string]string{}, cleanupExecError(filename, err)
+		start := time.Now()
+		output, execErr := e.executeTemplate(renderCtx, rc, t, filename, vals)
+		if debugger != nil {
+			if err := debugger.record(filename, vals, output, time.Since(start), execErr); err != nil {
+				return map[string]string{}, err
+			}
+		}
+		if execErr != nil {
+			return map[string]string{}, cleanupExecError(filename, execErr)
 		}
 
 		// Work around the issue where Go will emit "<no value>" even if Options(missing=zero)
 		// is set. Since missing=error will never get here, we do not need to handle
 		// the Strict case.
-		rendered[filename] = strings.ReplaceAll(buf.String(), "<no value>", "")
+		rendered[filename] = strings.ReplaceAll(output, "<no value>", "")
 	}
 
 	return rendered, nil
@@ -17,12 +17,17 @@ limitations under the License.
 package engine
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path"
+	"path/filepath"
+	goruntime "runtime"
 	"strings"
 	"sync"
 	"testing"
 	"text/template"
+	"time"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -1300,3 +1305,149 @@ func TestRenderTplMissingKeyString(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRenderDebugDir(t *testing.T) {
+	dir := t.TempDir()
+	vals := chartutil.Values{"Values": map[string]interface{}{"name": "moby", "db": map[string]interface{}{"passwords": []interface{}{"hunter2"}}}}
+
+	tpls := map[string]renderable{
+		"moby/templates/ok":     {tpl: `hello {{ .Values.name }}`, vals: vals},
+		"moby/templates/failed": {tpl: `partial {{ fail "broken" }}`, vals: vals},
+		"moby/templates/secret": {tpl: "kind: Secret\nmetadata:\n  name: {{ .Values.name }}\nstringData:\n  password: hunter2\n", vals: vals},
+	}
+	if _, err := (Engine{DebugDir: dir}).render(tpls, nil); err == nil {
+		t.Fatal("Expected failures while rendering")
+	}
+
+	for file, expected := range map[string]string{
+		"moby/templates/ok":                  "hello moby",
+		"moby/templates/failed":              "partial ",
+		"moby/templates/failed.context.yaml": "Template:\n  BasePath: \"\"\n  Name: moby/templates/failed\nValues:\n  db:\n    passwords:\n    - <redacted>\n  name: <redacted>\n",
+		"moby/templates/secret":              "kind: Secret\nmetadata:\n  name: moby\nstringData:\n  password: <redacted>\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %s to be %q, got %q", file, expected, data)
+		}
+	}
+
+	timings, err := os.ReadFile(filepath.Join(dir, "timings.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(timings), "moby/templates/failed (failed)\n") || !strings.Contains(string(timings), "total for 3 templates\n") {
+		t.Errorf("Unexpected timings:\n%s", timings)
+	}
+}
+
+func TestRenderTimeout(t *testing.T) {
+	vals := chartutil.Values{"Values": map[string]interface{}{}}
+	endless := `header
+{{- range until 1000 }}{{ range until 1000 }}{{ range until 1000 }}.{{ end }}{{ end }}{{ end }}`
+
+	for _, e := range []Engine{{TemplateTimeout: 100 * time.Millisecond}, {RenderTimeout: 100 * time.Millisecond}} {
+		tpls := map[string]renderable{
+			"moby/templates/endless": {tpl: endless, vals: vals},
+		}
+		_, err := e.render(tpls, nil)
+
+		var timeoutErr *RenderTimeoutError
+		if !errors.As(err, &timeoutErr) {
+			t.Fatalf("Expected a render timeout error, got %v", err)
+		}
+		if timeoutErr.Template != "moby/templates/endless" {
+			t.Errorf("Expected the timed out template to be moby/templates/endless, got %s", timeoutErr.Template)
+		}
+		if timeoutErr.Total != (e.RenderTimeout > 0) || timeoutErr.Timeout != 100*time.Millisecond {
+			t.Errorf("Unexpected timeout in error: %v", err)
+		}
+		if !strings.HasPrefix(timeoutErr.PartialOutput, "header..") {
+			t.Errorf("Expected the partial output to be returned, got %q", timeoutErr.PartialOutput)
+		}
+	}
+}
+
+func TestRenderTimeoutStopsIncludedTemplates(t *testing.T) {
+	vals := chartutil.Values{"Values": map[string]interface{}{}}
+	tpls := map[string]renderable{
+		"moby/templates/_loop":   {tpl: `{{- range until 1000 }}{{ range until 1000 }}{{ range until 1000 }}.{{ end }}{{ end }}{{ end }}`, vals: vals},
+		"moby/templates/include": {tpl: `{{ include "moby/templates/_loop" . }}`, vals: vals},
+	}
+
+	goroutines := goruntime.NumGoroutine()
+	_, err := Engine{TemplateTimeout: 100 * time.Millisecond}.render(tpls, nil)
+
+	var timeoutErr *RenderTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected a render timeout error, got %v", err)
+	}
+
+	// The included template writes into its own buffer, it must be stopped
+	// rather than left running in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for goruntime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the timed out template to stop, %d goroutines left running", goruntime.NumGoroutine()-goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type stubImageResolver struct {
+	digests map[string]string
+	calls   int
+}
+
+func (r *stubImageResolver) ResolveDigest(ref string) (string, error) {
+	r.calls++
+	if digest, found := r.digests[ref]; found {
+		return digest, nil
+	}
+	return "", errors.New("registry unreachable")
+}
+
+func TestRenderWerfImage(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "digests.json")
+	vals := chartutil.Values{"Values": map[string]interface{}{}}
+	tpls := map[string]renderable{
+		"moby/templates/images": {tpl: `{{ werf_image "nginx:1.25" }} {{ werf_image "nginx:1.25" }} {{ werf_image "redis@sha256:abc" }}`, vals: vals},
+	}
+
+	resolver := &stubImageResolver{digests: map[string]string{"nginx:1.25": "sha256:def"}}
+	out, err := (Engine{ImageResolver: resolver, ImageDigestCacheFile: cacheFile}).render(tpls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "nginx:1.25@sha256:def nginx:1.25@sha256:def redis@sha256:abc"; out["moby/templates/images"] != expected {
+		t.Errorf("Expected %q, got %q", expected, out["moby/templates/images"])
+	}
+	if resolver.calls != 1 {
+		t.Errorf("Expected the image to be resolved once, got %d calls", resolver.calls)
+	}
+
+	// The registry is unreachable, so the cached digest is used.
+	out, err = (Engine{ImageResolver: &stubImageResolver{}, ImageDigestCacheFile: cacheFile}).render(tpls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "nginx:1.25@sha256:def nginx:1.25@sha256:def redis@sha256:abc"; out["moby/templates/images"] != expected {
+		t.Errorf("Expected %q, got %q", expected, out["moby/templates/images"])
+	}
+
+	tpls["moby/templates/images"] = renderable{tpl: `{{ werf_image "nginx:1.26" }}`, vals: vals}
+	if _, err := (Engine{ImageResolver: &stubImageResolver{}, ImageDigestCacheFile: cacheFile}).render(tpls, nil); err == nil || !strings.Contains(err.Error(), "registry unreachable") {
+		t.Errorf("Expected an error for an image neither resolved nor cached, got %v", err)
+	}
+
+	// Without a resolver and a cache file the image is left as it is.
+	out, err = (Engine{}).render(tpls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["moby/templates/images"] != "nginx:1.26" {
+		t.Errorf("Expected the image to be left unpinned, got %q", out["moby/templates/images"])
+	}
+}
@@ -66,6 +66,9 @@ func funcMap() template.FuncMap {
 		"lookup": func(string, string, string, string) (map[string]interface{}, error) {
 			return map[string]interface{}{}, nil
 		},
+		// Provide a placeholder for the "werf_image" function, which requires a
+		// registry client. The image is left unpinned.
+		"werf_image": func(ref string) (string, error) { return ref, nil },
 	}
 
 	for k, v := range extra {
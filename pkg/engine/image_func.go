@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/werf/3p-helm/pkg/cachestats"
+)
+
+// ImageDigestResolver resolves the digest of the manifest of an image, e.g.
+// "sha256:..." for "nginx:1.25". It is implemented by registry.Client.
+type ImageDigestResolver interface {
+	ResolveDigest(ref string) (string, error)
+}
+
+// newImageFunction returns the "werf_image" function, which pins the image
+// reference to its digest, e.g. "nginx:1.25" becomes "nginx:1.25@sha256:...".
+// References already pinned are returned as they are. Every image is resolved
+// once per render. Resolved digests are stored in the cache file, if any,
+// which is the fallback when the registry is unreachable.
+func newImageFunction(resolver ImageDigestResolver, cacheFile string) func(string) (string, error) {
+	cache := &imageDigestCache{file: cacheFile}
+	resolved := map[string]string{}
+	var mu sync.Mutex
+
+	return func(ref string) (string, error) {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			return "", errors.New("werf_image: empty image reference")
+		}
+		if strings.Contains(ref, "@") {
+			return ref, nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		stats := cachestats.For(cachestats.ImageDigests)
+		if digest, found := resolved[ref]; found {
+			stats.Hit()
+			return ref + "@" + digest, nil
+		}
+		stats.Miss()
+
+		var resolveErr error
+		if resolver != nil {
+			digest, err := resolver.ResolveDigest(ref)
+			if err == nil {
+				resolved[ref] = digest
+				stats.AddEntries(1)
+				if err := cache.store(ref, digest); err != nil {
+					log.Printf("[WARNING] werf_image: unable to store digest of image %q: %s", ref, err)
+				}
+				return ref + "@" + digest, nil
+			}
+			resolveErr = err
+		} else {
+			resolveErr = errors.New("no registry client")
+		}
+
+		digest, found, err := cache.load(ref)
+		if err != nil {
+			return "", errors.Wrapf(err, "werf_image: unable to resolve digest of image %q: %s", ref, resolveErr)
+		}
+		if !found {
+			return "", errors.Errorf("werf_image: unable to resolve digest of image %q: %s", ref, resolveErr)
+		}
+
+		log.Printf("[WARNING] werf_image: using cached digest of image %q: %s", ref, resolveErr)
+		resolved[ref] = digest
+		stats.AddEntries(1)
+		return ref + "@" + digest, nil
+	}
+}
+
+// imageDigestCache is a JSON file mapping image references to digests.
+type imageDigestCache struct {
+	file    string
+	digests map[string]string
+}
+
+func (c *imageDigestCache) load(ref string) (string, bool, error) {
+	if err := c.read(); err != nil {
+		return "", false, err
+	}
+
+	digest, found := c.digests[ref]
+	return digest, found, nil
+}
+
+func (c *imageDigestCache) store(ref, digest string) error {
+	if c.file == "" {
+		return nil
+	}
+	if err := c.read(); err != nil {
+		return err
+	}
+	if c.digests[ref] == digest {
+		return nil
+	}
+
+	c.digests[ref] = digest
+	data, err := json.MarshalIndent(c.digests, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.file, data, 0644)
+}
+
+func (c *imageDigestCache) read() error {
+	if c.digests != nil {
+		return nil
+	}
+	c.digests = map[string]string{}
+
+	if c.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &c.digests); err != nil {
+		return errors.Wrapf(err, "invalid image digest cache %s", c.file)
+	}
+
+	return nil
+}
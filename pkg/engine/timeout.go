@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// maxPartialOutputInError limits how much of the partial output is included in
+// the message of RenderTimeoutError.
+const maxPartialOutputInError = 1024
+
+// RenderTimeoutError is returned when a template is not rendered in time.
+type RenderTimeoutError struct {
+	// Template is the name of the template that was being rendered.
+	Template string
+	// Timeout is the timeout that was exceeded.
+	Timeout time.Duration
+	// Total is true if the total render timeout was exceeded rather than the
+	// timeout of a single template.
+	Total bool
+	// PartialOutput is the output of the template rendered before the timeout.
+	PartialOutput string
+}
+
+func (e *RenderTimeoutError) Error() string {
+	kind := "template render timeout"
+	if e.Total {
+		kind = "total render timeout"
+	}
+
+	msg := fmt.Sprintf("%s of %s exceeded while rendering %s", kind, e.Timeout, e.Template)
+	if e.PartialOutput != "" {
+		// The end of the output is the closest to where the template got stuck.
+		output := e.PartialOutput
+		if len(output) > maxPartialOutputInError {
+			output = "..." + output[len(output)-maxPartialOutputInError:]
+		}
+		msg += fmt.Sprintf(", partial output:\n%s", output)
+	}
+
+	return msg
+}
+
+// cancelableWriter fails every write once the context is done, which stops the
+// execution of the template on its next output.
+type cancelableWriter struct {
+	ctx context.Context
+
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (w *cancelableWriter) Write(p []byte) (int, error) {
+	if err := w.err(); err != nil {
+		return 0, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.Write(p)
+}
+
+func (w *cancelableWriter) err() error {
+	if w.ctx == nil {
+		return nil
+	}
+
+	return w.ctx.Err()
+}
+
+func (w *cancelableWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.String()
+}
+
+// renderContext holds the context of the template being executed. It is shared
+// with the template-rendering functions, include and tpl, so that the templates
+// they execute are stopped as well once the context is done.
+type renderContext struct {
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+func (rc *renderContext) set(ctx context.Context) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.ctx = ctx
+}
+
+// writer returns a writer failing once the context of the template being
+// executed is done.
+func (rc *renderContext) writer() *cancelableWriter {
+	if rc == nil {
+		return &cancelableWriter{}
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return &cancelableWriter{ctx: rc.ctx}
+}
+
+func (rc *renderContext) err() error {
+	return rc.writer().err()
+}
+
+// executeTemplate executes the template within the render context, limited by
+// the template timeout if there is one. Returns a RenderTimeoutError if any of
+// the timeouts is exceeded.
+func (e Engine) executeTemplate(renderCtx context.Context, rc *renderContext, t *template.Template, name string, vals interface{}) (string, error) {
+	ctx := renderCtx
+	if e.TemplateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.TemplateTimeout)
+		defer cancel()
+	}
+	rc.set(ctx)
+
+	output, err := executeTemplateWithContext(ctx, t, name, vals)
+	if err != nil && ctx.Err() != nil {
+		timeoutErr := &RenderTimeoutError{
+			Template:      name,
+			Timeout:       e.TemplateTimeout,
+			PartialOutput: output,
+		}
+		if renderCtx.Err() != nil {
+			timeoutErr.Timeout = e.RenderTimeout
+			timeoutErr.Total = true
+		}
+		return output, timeoutErr
+	}
+
+	return output, err
+}
+
+// executeTemplateWithContext executes the template and returns its output. If
+// the context is done before the execution finishes, the partial output and the
+// context error are returned right away. The execution itself is stopped on the
+// next output of the template or the next call of include or tpl. A template
+// looping without doing either, e.g. ranging over a huge list without output,
+// cannot be interrupted by text/template and keeps running in the background
+// until that loop finishes.
+func executeTemplateWithContext(ctx context.Context, t *template.Template, name string, vals interface{}) (string, error) {
+	if ctx.Done() == nil {
+		var buf strings.Builder
+		err := t.ExecuteTemplate(&buf, name, vals)
+		return buf.String(), err
+	}
+
+	w := &cancelableWriter{ctx: ctx}
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("rendering template failed: %v", r)
+			}
+		}()
+		done <- t.ExecuteTemplate(w, name, vals)
+	}()
+
+	select {
+	case err := <-done:
+		return w.String(), err
+	case <-ctx.Done():
+		return w.String(), ctx.Err()
+	}
+}
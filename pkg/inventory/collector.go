@@ -0,0 +1,164 @@
+package inventory
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+	"github.com/werf/3p-helm/pkg/storage"
+)
+
+const namespace = "helm_release"
+
+var statuses = []release.Status{
+	release.StatusUnknown,
+	release.StatusDeployed,
+	release.StatusUninstalled,
+	release.StatusSuperseded,
+	release.StatusFailed,
+	release.StatusUninstalling,
+	release.StatusPendingInstall,
+	release.StatusPendingUpgrade,
+	release.StatusPendingRollback,
+}
+
+var (
+	infoDesc = prometheus.NewDesc(
+		namespace+"_info",
+		"Information about the latest revision of the release.",
+		[]string{"name", "namespace", "chart", "chart_version", "app_version"}, nil,
+	)
+	statusDesc = prometheus.NewDesc(
+		namespace+"_status",
+		"Status of the latest revision of the release, 1 for the current status and 0 for the others.",
+		[]string{"name", "namespace", "status"}, nil,
+	)
+	revisionDesc = prometheus.NewDesc(
+		namespace+"_revision",
+		"Latest revision of the release.",
+		[]string{"name", "namespace"}, nil,
+	)
+	firstDeployedDesc = prometheus.NewDesc(
+		namespace+"_first_deployed_timestamp_seconds",
+		"Unix time of the first deploy of the release. The release age is time() minus this value.",
+		[]string{"name", "namespace"}, nil,
+	)
+	lastDeployedDesc = prometheus.NewDesc(
+		namespace+"_last_deployed_timestamp_seconds",
+		"Unix time of the last deploy of the release.",
+		[]string{"name", "namespace"}, nil,
+	)
+	resourcesDesc = prometheus.NewDesc(
+		namespace+"_resources",
+		"Number of resources of the kind in the manifest of the latest revision of the release.",
+		[]string{"name", "namespace", "kind"}, nil,
+	)
+)
+
+// Collector exports the inventory of the releases in the storage as Prometheus
+// gauges. Releases are listed on every scrape, so that the metrics always show
+// the current state of the storage, as kube-state-metrics does for Kubernetes
+// objects. Only the latest revision of each release is exported.
+type Collector struct {
+	releases *storage.Storage
+}
+
+func NewCollector(releases *storage.Storage) *Collector {
+	return &Collector{releases: releases}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- infoDesc
+	ch <- statusDesc
+	ch <- revisionDesc
+	ch <- firstDeployedDesc
+	ch <- lastDeployedDesc
+	ch <- resourcesDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	rels, err := c.releases.ListReleases()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(infoDesc, fmt.Errorf("error listing releases: %w", err))
+		return
+	}
+
+	for _, rel := range latestRevisions(rels) {
+		c.collectRelease(ch, rel)
+	}
+}
+
+func (c *Collector) collectRelease(ch chan<- prometheus.Metric, rel *release.Release) {
+	var chartName, chartVersion, appVersion string
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		chartName = rel.Chart.Metadata.Name
+		chartVersion = rel.Chart.Metadata.Version
+		appVersion = rel.Chart.Metadata.AppVersion
+	}
+	ch <- prometheus.MustNewConstMetric(infoDesc, prometheus.GaugeValue, 1, rel.Name, rel.Namespace, chartName, chartVersion, appVersion)
+
+	ch <- prometheus.MustNewConstMetric(revisionDesc, prometheus.GaugeValue, float64(rel.Version), rel.Name, rel.Namespace)
+
+	if rel.Info != nil {
+		for _, status := range statuses {
+			var value float64
+			if rel.Info.Status == status {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(statusDesc, prometheus.GaugeValue, value, rel.Name, rel.Namespace, status.String())
+		}
+
+		if !rel.Info.FirstDeployed.IsZero() {
+			ch <- prometheus.MustNewConstMetric(firstDeployedDesc, prometheus.GaugeValue, float64(rel.Info.FirstDeployed.Unix()), rel.Name, rel.Namespace)
+		}
+		if !rel.Info.LastDeployed.IsZero() {
+			ch <- prometheus.MustNewConstMetric(lastDeployedDesc, prometheus.GaugeValue, float64(rel.Info.LastDeployed.Unix()), rel.Name, rel.Namespace)
+		}
+	}
+
+	for kind, count := range countResourcesByKind(rel.Manifest) {
+		ch <- prometheus.MustNewConstMetric(resourcesDesc, prometheus.GaugeValue, float64(count), rel.Name, rel.Namespace, kind)
+	}
+}
+
+// Returns the latest revision of every release, releases are identified by
+// their name and namespace.
+func latestRevisions(rels []*release.Release) []*release.Release {
+	type key struct{ name, namespace string }
+
+	latest := map[key]*release.Release{}
+	var order []key
+	for _, rel := range rels {
+		k := key{rel.Name, rel.Namespace}
+		current, found := latest[k]
+		if !found {
+			order = append(order, k)
+		}
+		if !found || rel.Version > current.Version {
+			latest[k] = rel
+		}
+	}
+
+	result := make([]*release.Release, 0, len(order))
+	for _, k := range order {
+		result = append(result, latest[k])
+	}
+
+	return result
+}
+
+func countResourcesByKind(manifest string) map[string]int {
+	result := map[string]int{}
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		var head releaseutil.SimpleHead
+		if err := yaml.Unmarshal([]byte(doc), &head); err != nil || head.Kind == "" {
+			continue
+		}
+		result[head.Kind]++
+	}
+
+	return result
+}
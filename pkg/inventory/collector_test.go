@@ -0,0 +1,141 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/werf/3p-helm/pkg/chart"
+	"github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/storage"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+	helmtime "github.com/werf/3p-helm/pkg/time"
+)
+
+const manifest = `---
+# Source: backend/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+---
+# Source: backend/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: backend
+---
+# Source: backend/templates/configmap-env.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: backend-env
+`
+
+func newRelease(name, namespace string, version int, status release.Status) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: namespace,
+		Version:   version,
+		Manifest:  manifest,
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "backend", Version: "1.2.3", AppVersion: "2.0"}},
+		Info: &release.Info{
+			Status:        status,
+			FirstDeployed: helmtime.Unix(1700000000, 0),
+			LastDeployed:  helmtime.Unix(1700000000+int64(version)*60, 0),
+		},
+	}
+}
+
+func TestCollector(t *testing.T) {
+	mem := driver.NewMemory()
+	releases := storage.Init(mem)
+	for _, rel := range []*release.Release{
+		newRelease("backend", "prod", 1, release.StatusSuperseded),
+		newRelease("backend", "prod", 2, release.StatusFailed),
+		newRelease("backend", "staging", 1, release.StatusDeployed),
+	} {
+		mem.SetNamespace(rel.Namespace)
+		if err := releases.Create(rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// List the releases of all the namespaces.
+	mem.SetNamespace("")
+
+	expected := `
+# HELP helm_release_info Information about the latest revision of the release.
+# TYPE helm_release_info gauge
+helm_release_info{app_version="2.0",chart="backend",chart_version="1.2.3",name="backend",namespace="prod"} 1
+helm_release_info{app_version="2.0",chart="backend",chart_version="1.2.3",name="backend",namespace="staging"} 1
+# HELP helm_release_revision Latest revision of the release.
+# TYPE helm_release_revision gauge
+helm_release_revision{name="backend",namespace="prod"} 2
+helm_release_revision{name="backend",namespace="staging"} 1
+# HELP helm_release_last_deployed_timestamp_seconds Unix time of the last deploy of the release.
+# TYPE helm_release_last_deployed_timestamp_seconds gauge
+helm_release_last_deployed_timestamp_seconds{name="backend",namespace="prod"} 1.70000012e+09
+helm_release_last_deployed_timestamp_seconds{name="backend",namespace="staging"} 1.70000006e+09
+# HELP helm_release_resources Number of resources of the kind in the manifest of the latest revision of the release.
+# TYPE helm_release_resources gauge
+helm_release_resources{kind="ConfigMap",name="backend",namespace="prod"} 2
+helm_release_resources{kind="ConfigMap",name="backend",namespace="staging"} 2
+helm_release_resources{kind="Deployment",name="backend",namespace="prod"} 1
+helm_release_resources{kind="Deployment",name="backend",namespace="staging"} 1
+`
+	if err := testutil.CollectAndCompare(NewCollector(releases), strings.NewReader(expected),
+		"helm_release_info", "helm_release_revision", "helm_release_last_deployed_timestamp_seconds", "helm_release_resources"); err != nil {
+		t.Error(err)
+	}
+
+	if count := testutil.CollectAndCount(NewCollector(releases), "helm_release_status"); count != 2*len(statuses) {
+		t.Errorf("expected a status metric per status and release, got %d", count)
+	}
+
+	expectedStatus := `
+# HELP helm_release_status Status of the latest revision of the release, 1 for the current status and 0 for the others.
+# TYPE helm_release_status gauge
+`
+	for _, status := range statuses {
+		prod, staging := "0", "0"
+		if status == release.StatusFailed {
+			prod = "1"
+		}
+		if status == release.StatusDeployed {
+			staging = "1"
+		}
+		expectedStatus += `helm_release_status{name="backend",namespace="prod",status="` + status.String() + `"} ` + prod + "\n"
+		expectedStatus += `helm_release_status{name="backend",namespace="staging",status="` + status.String() + `"} ` + staging + "\n"
+	}
+	if err := testutil.CollectAndCompare(NewCollector(releases), strings.NewReader(expectedStatus), "helm_release_status"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLatestRevisions(t *testing.T) {
+	latest := latestRevisions([]*release.Release{
+		newRelease("backend", "prod", 1, release.StatusSuperseded),
+		newRelease("frontend", "prod", 3, release.StatusDeployed),
+		newRelease("backend", "prod", 3, release.StatusDeployed),
+		newRelease("backend", "prod", 2, release.StatusSuperseded),
+		newRelease("backend", "staging", 1, release.StatusDeployed),
+	})
+
+	var got []string
+	for _, rel := range latest {
+		got = append(got, fmt.Sprintf("%s/%s@%d", rel.Namespace, rel.Name, rel.Version))
+	}
+	expected := []string{"prod/backend@3", "prod/frontend@3", "staging/backend@1"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestCountResourcesByKind(t *testing.T) {
+	counts := countResourcesByKind(manifest + "---\n# Source: backend/templates/empty.yaml\n")
+	if len(counts) != 2 || counts["ConfigMap"] != 2 || counts["Deployment"] != 1 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
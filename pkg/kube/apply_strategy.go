@@ -0,0 +1,138 @@
+package kube
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/util/csaupgrade"
+)
+
+// ApplyStrategyAnnotation forces the ApplyStrategy used to update the
+// resource, overriding Client.ApplyStrategy.
+const ApplyStrategyAnnotation = "werf.io/apply-strategy"
+
+// ApplyStrategy is how an existing resource is updated.
+type ApplyStrategy string
+
+const (
+	// ApplyStrategyThreeWayMerge updates the resource with a client-side
+	// three-way strategic merge patch (a JSON merge patch for custom
+	// resources). It is the default.
+	ApplyStrategyThreeWayMerge ApplyStrategy = "three-way-merge"
+	// ApplyStrategyServerSide updates the resource with server-side apply.
+	ApplyStrategyServerSide ApplyStrategy = "server-side"
+	// ApplyStrategyAuto updates the resource with server-side apply and falls
+	// back to the three-way merge if the API server doesn't support it for the
+	// resource, e.g. an aggregated API without server-side apply, or if the
+	// conversion webhook of the custom resource fails.
+	ApplyStrategyAuto ApplyStrategy = "auto"
+)
+
+// ParseApplyStrategy parses an ApplyStrategy, ApplyStrategyThreeWayMerge if
+// empty.
+func ParseApplyStrategy(value string) (ApplyStrategy, error) {
+	switch strategy := ApplyStrategy(strings.TrimSpace(value)); strategy {
+	case "":
+		return ApplyStrategyThreeWayMerge, nil
+	case ApplyStrategyThreeWayMerge, ApplyStrategyServerSide, ApplyStrategyAuto:
+		return strategy, nil
+	default:
+		return "", errors.Errorf("unknown apply strategy %q: expected %q, %q or %q", value, ApplyStrategyThreeWayMerge, ApplyStrategyServerSide, ApplyStrategyAuto)
+	}
+}
+
+// applyStrategyOf returns the strategy of ApplyStrategyAnnotation of the
+// object, or the given default one.
+func applyStrategyOf(obj runtime.Object, defaultStrategy ApplyStrategy) (ApplyStrategy, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+
+	value, found := accessor.GetAnnotations()[ApplyStrategyAnnotation]
+	if !found {
+		return ParseApplyStrategy(string(defaultStrategy))
+	}
+
+	strategy, err := ParseApplyStrategy(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid annotation %s", ApplyStrategyAnnotation)
+	}
+
+	return strategy, nil
+}
+
+// serverSideApply applies the target with server-side apply, taking over the
+// conflicting fields. Ignored fields are left out, so they are not owned. The
+// fields the field manager owns from the previous updates of the resource with
+// the three-way merge are migrated to server-side apply first, so that the
+// fields removed from the target are removed from the resource too.
+func serverSideApply(helper *resource.Helper, target *resource.Info) (runtime.Object, error) {
+	if err := upgradeManagedFields(helper, target); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(target.Object)
+	if err != nil {
+		return nil, errors.Wrap(err, "serializing target configuration")
+	}
+
+	ignoredFields, err := ignoredFieldsOf(target.Object)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = removeIgnoredFields(data, ignoredFields); err != nil {
+		return nil, errors.Wrap(err, "removing ignored fields from target configuration")
+	}
+
+	force := true
+	return helper.Patch(target.Namespace, target.Name, types.ApplyPatchType, data, &metav1.PatchOptions{Force: &force})
+}
+
+// upgradeManagedFields makes the fields the field manager of the helper owns
+// with Update operations owned by its Apply operations.
+func upgradeManagedFields(helper *resource.Helper, target *resource.Info) error {
+	live, err := helper.Get(target.Namespace, target.Name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "unable to get data for current object %s/%s", target.Namespace, target.Name)
+	}
+
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(live, sets.New(helper.FieldManager), helper.FieldManager)
+	if err != nil {
+		return errors.Wrap(err, "migrating managed fields to server-side apply")
+	}
+	if patch == nil {
+		return nil
+	}
+
+	if _, err := helper.Patch(target.Namespace, target.Name, types.JSONPatchType, patch, nil); err != nil {
+		return errors.Wrap(err, "migrating managed fields to server-side apply")
+	}
+
+	return nil
+}
+
+// isServerSideApplyRejected returns true if the error means the API server
+// doesn't support server-side apply of the resource, rather than the resource
+// being invalid or the API server failing.
+func isServerSideApplyRejected(err error) bool {
+	return apierrors.IsUnsupportedMediaType(err) || apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err) ||
+		isConversionWebhookFailure(err)
+}
+
+// isConversionWebhookFailure returns true if the error is the failure of the
+// conversion webhook of a custom resource, e.g. of one still stored in an old
+// version, which the API server returns as an internal error.
+func isConversionWebhookFailure(err error) bool {
+	return apierrors.IsInternalError(err) && strings.Contains(err.Error(), "conversion webhook")
+}
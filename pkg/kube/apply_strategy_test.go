@@ -0,0 +1,179 @@
+package kube
+
+import (
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest/fake"
+	cmdtesting "k8s.io/kubectl/pkg/cmd/testing"
+)
+
+func TestParseApplyStrategy(t *testing.T) {
+	for value, expect := range map[string]ApplyStrategy{
+		"":                ApplyStrategyThreeWayMerge,
+		"three-way-merge": ApplyStrategyThreeWayMerge,
+		" server-side ":   ApplyStrategyServerSide,
+		"auto":            ApplyStrategyAuto,
+	} {
+		strategy, err := ParseApplyStrategy(value)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", value, err)
+		} else if strategy != expect {
+			t.Errorf("expected %q for %q, got %q", expect, value, strategy)
+		}
+	}
+
+	if _, err := ParseApplyStrategy("ssa"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+
+	pod := newPod("otter")
+	if strategy, err := applyStrategyOf(&pod, ApplyStrategyAuto); err != nil || strategy != ApplyStrategyAuto {
+		t.Errorf("expected the default strategy, got %q, %v", strategy, err)
+	}
+	pod.Annotations = map[string]string{ApplyStrategyAnnotation: "three-way-merge"}
+	if strategy, err := applyStrategyOf(&pod, ApplyStrategyAuto); err != nil || strategy != ApplyStrategyThreeWayMerge {
+		t.Errorf("expected the annotated strategy, got %q, %v", strategy, err)
+	}
+	pod.Annotations[ApplyStrategyAnnotation] = "replace"
+	if _, err := applyStrategyOf(&pod, ApplyStrategyAuto); err == nil {
+		t.Error("expected an error for an invalid annotation")
+	}
+}
+
+var applyStatusReasons = map[int]metav1.StatusReason{
+	http.StatusUnsupportedMediaType: metav1.StatusReasonUnsupportedMediaType,
+	http.StatusMethodNotAllowed:     metav1.StatusReasonMethodNotAllowed,
+	http.StatusNotFound:             metav1.StatusReasonNotFound,
+	http.StatusInternalServerError:  metav1.StatusReasonInternalError,
+	http.StatusUnprocessableEntity:  metav1.StatusReasonInvalid,
+}
+
+func TestUpdateApplyStrategy(t *testing.T) {
+	current := newPod("otter")
+	target := newPod("otter")
+	target.Spec.Containers[0].Image = "abc/app:v5"
+
+	const conversionWebhookFailure = `conversion webhook for example.com/v1beta1, Kind=Otter failed: Post "https://otter-webhook.default.svc:443/convert": service "otter-webhook" not found`
+
+	for _, test := range []struct {
+		strategy     ApplyStrategy
+		applyStatus  int
+		applyMessage string
+		expect       []types.PatchType
+		err          bool
+	}{
+		{ApplyStrategyThreeWayMerge, http.StatusOK, "", []types.PatchType{types.StrategicMergePatchType}, false},
+		{ApplyStrategyServerSide, http.StatusOK, "", []types.PatchType{types.ApplyPatchType}, false},
+		{ApplyStrategyAuto, http.StatusUnsupportedMediaType, "", []types.PatchType{types.ApplyPatchType, types.StrategicMergePatchType}, false},
+		{ApplyStrategyAuto, http.StatusMethodNotAllowed, "", []types.PatchType{types.ApplyPatchType, types.StrategicMergePatchType}, false},
+		{ApplyStrategyAuto, http.StatusNotFound, "", []types.PatchType{types.ApplyPatchType, types.StrategicMergePatchType}, false},
+		{ApplyStrategyAuto, http.StatusInternalServerError, conversionWebhookFailure, []types.PatchType{types.ApplyPatchType, types.StrategicMergePatchType}, false},
+		{ApplyStrategyServerSide, http.StatusUnsupportedMediaType, "", []types.PatchType{types.ApplyPatchType}, true},
+		{ApplyStrategyServerSide, http.StatusInternalServerError, conversionWebhookFailure, []types.PatchType{types.ApplyPatchType}, true},
+		{ApplyStrategyAuto, http.StatusInternalServerError, "", []types.PatchType{types.ApplyPatchType}, true},
+		{ApplyStrategyAuto, http.StatusUnprocessableEntity, "", []types.PatchType{types.ApplyPatchType}, true},
+	} {
+		t.Run(string(test.strategy)+" "+http.StatusText(test.applyStatus)+" "+test.applyMessage, func(t *testing.T) {
+			var patches []types.PatchType
+
+			c := newTestClient(t)
+			c.ApplyStrategy = test.strategy
+			c.Factory.(*cmdtesting.TestFactory).UnstructuredClient = &fake.RESTClient{
+				NegotiatedSerializer: unstructuredSerializer,
+				Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+					switch req.Method {
+					case "GET":
+						return newResponse(http.StatusOK, &current)
+					case "PATCH":
+						patchType := types.PatchType(req.Header.Get("Content-Type"))
+						patches = append(patches, patchType)
+						if patchType == types.ApplyPatchType && test.applyStatus != http.StatusOK {
+							return newResponse(test.applyStatus, &metav1.Status{
+								Status:  metav1.StatusFailure,
+								Code:    int32(test.applyStatus),
+								Reason:  applyStatusReasons[test.applyStatus],
+								Message: test.applyMessage,
+							})
+						}
+						return newResponse(http.StatusOK, &target)
+					default:
+						t.Fatalf("unexpected request: %s %s", req.Method, req.URL.Path)
+						return nil, nil
+					}
+				}),
+			}
+
+			resources, err := c.Build(objBody(&target), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = updateResource(c, resources[0], &current, false)
+			if test.err && err == nil {
+				t.Error("expected an error")
+			} else if !test.err && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+
+			if len(patches) != len(test.expect) {
+				t.Fatalf("expected patches %v, got %v", test.expect, patches)
+			}
+			for i := range patches {
+				if patches[i] != test.expect[i] {
+					t.Errorf("expected patches %v, got %v", test.expect, patches)
+				}
+			}
+		})
+	}
+}
+
+func TestServerSideApplyUpgradesManagedFields(t *testing.T) {
+	defer func(manager string) { ManagedFieldsManager = manager }(ManagedFieldsManager)
+	ManagedFieldsManager = "helm"
+
+	current := newPod("otter")
+	current.ManagedFields = []metav1.ManagedFieldsEntry{{
+		Manager:    "helm",
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: "v1",
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:containers":{}}}`)},
+	}}
+	target := newPod("otter")
+
+	var patches []types.PatchType
+	c := newTestClient(t)
+	c.ApplyStrategy = ApplyStrategyServerSide
+	c.Factory.(*cmdtesting.TestFactory).UnstructuredClient = &fake.RESTClient{
+		NegotiatedSerializer: unstructuredSerializer,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			switch req.Method {
+			case "GET":
+				return newResponse(http.StatusOK, &current)
+			case "PATCH":
+				patches = append(patches, types.PatchType(req.Header.Get("Content-Type")))
+				return newResponse(http.StatusOK, &target)
+			default:
+				t.Fatalf("unexpected request: %s %s", req.Method, req.URL.Path)
+				return nil, nil
+			}
+		}),
+	}
+
+	resources, err := c.Build(objBody(&target), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := updateResource(c, resources[0], &current, false); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []types.PatchType{types.JSONPatchType, types.ApplyPatchType}
+	if len(patches) != len(expect) || patches[0] != expect[0] || patches[1] != expect[1] {
+		t.Errorf("expected patches %v, got %v", expect, patches)
+	}
+}
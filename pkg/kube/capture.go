@@ -0,0 +1,125 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// capturedAnnotations are set by kubectl and controllers and must not become
+// part of a manifest.
+var capturedAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+}
+
+// capturedMetadataFields are set by the API server and must not become part of
+// a manifest.
+var capturedMetadataFields = []string{
+	"uid",
+	"resourceVersion",
+	"generation",
+	"creationTimestamp",
+	"deletionTimestamp",
+	"deletionGracePeriodSeconds",
+	"managedFields",
+	"selfLink",
+}
+
+// Capture returns the live objects of the given kinds matching the label
+// selector, along with the objects referenced explicitly as "<kind>/<name>",
+// in the namespace of the client. Objects managed by a controller, such as the
+// ReplicaSets of a Deployment, are skipped when found by the label selector, as
+// they are recreated by their controllers. The objects are normalized with
+// NormalizeCapturedObject, so that they can be used as manifests.
+func (c *Client) Capture(kinds []string, selector string, names []string) (ResourceList, error) {
+	var result ResourceList
+	seen := map[string]bool{}
+
+	add := func(infos []*resource.Info, skipControlled bool) error {
+		for _, info := range infos {
+			obj, ok := info.Object.(*unstructured.Unstructured)
+			if !ok {
+				return fmt.Errorf("unexpected object type %T of %s", info.Object, info.ObjectName())
+			}
+
+			if skipControlled && metav1.GetControllerOf(obj) != nil {
+				c.Log("skipping %s/%s managed by a controller", info.Mapping.GroupVersionKind.Kind, info.Name)
+				continue
+			}
+
+			key := fmt.Sprintf("%s/%s/%s", info.Mapping.GroupVersionKind.GroupKind(), info.Namespace, info.Name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			NormalizeCapturedObject(obj)
+			result.Append(info)
+		}
+
+		return nil
+	}
+
+	if len(kinds) > 0 {
+		infos, err := c.newBuilder().
+			Unstructured().
+			ResourceTypeOrNameArgs(true, strings.Join(kinds, ",")).
+			LabelSelectorParam(selector).
+			Do().Infos()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get %s matching selector %q", strings.Join(kinds, ","), selector)
+		}
+		if err := add(infos, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(names) > 0 {
+		infos, err := c.newBuilder().
+			Unstructured().
+			ResourceTypeOrNameArgs(true, names...).
+			Do().Infos()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get %s", strings.Join(names, ", "))
+		}
+		if err := add(infos, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// NormalizeCapturedObject strips the fields of a live object that are managed
+// by the cluster: the status, the metadata set by the API server, the
+// annotations of kubectl and controllers and the allocated cluster IPs of
+// Services.
+func NormalizeCapturedObject(obj *unstructured.Unstructured) {
+	for _, field := range capturedMetadataFields {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	if annotations := obj.GetAnnotations(); annotations != nil {
+		for _, annotation := range capturedAnnotations {
+			delete(annotations, annotation)
+		}
+		if len(annotations) == 0 {
+			annotations = nil
+		}
+		obj.SetAnnotations(annotations)
+	}
+
+	if obj.GetKind() == "Service" {
+		// Headless Services have "None" set by the user.
+		if clusterIP, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP"); clusterIP != "None" {
+			unstructured.RemoveNestedField(obj.Object, "spec", "clusterIP")
+			unstructured.RemoveNestedField(obj.Object, "spec", "clusterIPs")
+		}
+	}
+}
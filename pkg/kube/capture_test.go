@@ -0,0 +1,64 @@
+package kube
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNormalizeCapturedObject(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":              "backend",
+			"namespace":         "default",
+			"uid":               "e0b1c3f2",
+			"resourceVersion":   "12345",
+			"creationTimestamp": "2024-01-01T00:00:00Z",
+			"managedFields":     []interface{}{map[string]interface{}{"manager": "kubectl"}},
+			"labels":            map[string]interface{}{"app": "backend"},
+			"annotations": map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			},
+		},
+		"spec": map[string]interface{}{
+			"clusterIP":  "10.96.0.10",
+			"clusterIPs": []interface{}{"10.96.0.10"},
+			"ports":      []interface{}{map[string]interface{}{"port": int64(80)}},
+		},
+		"status": map[string]interface{}{"loadBalancer": map[string]interface{}{}},
+	}}
+
+	NormalizeCapturedObject(obj)
+
+	expected := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":      "backend",
+			"namespace": "default",
+			"labels":    map[string]interface{}{"app": "backend"},
+		},
+		"spec": map[string]interface{}{
+			"ports": []interface{}{map[string]interface{}{"port": int64(80)}},
+		},
+	}
+	if !reflect.DeepEqual(obj.Object, expected) {
+		t.Errorf("expected normalized object %v, got %v", expected, obj.Object)
+	}
+
+	headless := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "db"},
+		"spec":       map[string]interface{}{"clusterIP": "None"},
+	}}
+
+	NormalizeCapturedObject(headless)
+
+	if clusterIP, _, _ := unstructured.NestedString(headless.Object, "spec", "clusterIP"); clusterIP != "None" {
+		t.Errorf("expected the cluster IP of a headless service to be kept, got %q", clusterIP)
+	}
+}
@@ -88,6 +88,32 @@ type Client struct {
 
 	ResourcesWaiter ResourcesWaiter
 	Extender        ClientExtender
+
+	// UpdateConcurrency is how many resources of the same kind Update applies at
+	// once. Resources are applied one by one if it is less than 2.
+	UpdateConcurrency int
+
+	// ApplyStrategy is how Update updates existing resources,
+	// ApplyStrategyThreeWayMerge if empty. ApplyStrategyAnnotation overrides
+	// it per resource.
+	ApplyStrategy ApplyStrategy
+
+	// ReadinessEngine is how the readiness of the resources is checked while
+	// waiting for them, ReadinessEngineBuiltin if empty.
+	// ReadinessEngineAnnotation overrides it per resource.
+	ReadinessEngine ReadinessEngine
+
+	// MaxErrorSize is the maximum size, in bytes, of the messages of the
+	// errors of creating and updating resources, DefaultMaxErrorSize if 0 and
+	// unlimited if negative. The longer messages are truncated, see
+	// TruncatedError.
+	MaxErrorSize int
+	// ErrorDumpDir, if set, is the directory the truncated errors are written
+	// to in full, with the manifests of their resources.
+	ErrorDumpDir string
+
+	// ctx, if set by WithContext, bounds the operations of the client.
+	ctx context.Context
 }
 
 var addToScheme sync.Once
@@ -115,6 +141,48 @@ func New(getter genericclioptions.RESTClientGetter) *Client {
 
 var nopLogger = func(_ string, _ ...interface{}) {}
 
+// WithContext returns a copy of the client whose operations, including waits,
+// watches and the ResourcesWaiter calls, are cancelled when ctx is done.
+func (c *Client) WithContext(ctx context.Context) Interface {
+	// Share the clientset, so that it is created once.
+	_, _ = c.getKubeClient()
+
+	client := *c
+	client.ctx = ctx
+
+	return &client
+}
+
+// WithLogsOptions returns a copy of the client whose ResourcesWaiter, if it is
+// a LogsResourcesWaiter, shows the logs of the containers with the options.
+func (c *Client) WithLogsOptions(opts LogsOptions) Interface {
+	client := *c
+	if waiter, ok := c.ResourcesWaiter.(LogsResourcesWaiter); ok {
+		client.ResourcesWaiter = waiter.WithLogsOptions(opts)
+	}
+
+	return &client
+}
+
+// DefaultReadinessEngine returns the engine the readiness of the resources not
+// annotated with ReadinessEngineAnnotation is checked with.
+func (c *Client) DefaultReadinessEngine() ReadinessEngine {
+	if c.ReadinessEngine == "" {
+		return ReadinessEngineBuiltin
+	}
+
+	return c.ReadinessEngine
+}
+
+// baseContext returns the context the operations of the client are bound to.
+func (c *Client) baseContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
 // getKubeClient get or create a new KubernetesClientSet
 func (c *Client) getKubeClient() (*kubernetes.Clientset, error) {
 	var err error
@@ -159,7 +227,14 @@ func (c *Client) Create(resources ResourceList, opts CreateOptions) (*Result, er
 		fn = createResource
 	}
 
-	return performWithResult(resources, fn)
+	return performWithResult(resources, func(info *resource.Info) (performResourceStatus, error) {
+		status, err := fn(info)
+		if err != nil {
+			return status, c.truncateResourceError(info, err)
+		}
+
+		return status, nil
+	})
 }
 
 func transformRequests(req *rest.Request) {
@@ -300,15 +375,16 @@ func getResource(info *resource.Info) (runtime.Object, error) {
 // Wait waits up to the given timeout for the specified resources to be ready.
 func (c *Client) Wait(resources ResourceList, timeout time.Duration) error {
 	if c.ResourcesWaiter != nil {
-		return c.ResourcesWaiter.Wait(context.Background(), resources, timeout)
+		return c.ResourcesWaiter.Wait(c.baseContext(), resources, timeout)
 	}
 
 	cs, err := c.getKubeClient()
 	if err != nil {
 		return err
 	}
-	checker := NewReadyChecker(cs, c.Log, PausedAsReady(true))
+	checker := NewReadyChecker(cs, c.Log, PausedAsReady(true), DefaultReadinessEngine(c.ReadinessEngine))
 	w := waiter{
+		ctx:     c.baseContext(),
 		c:       checker,
 		log:     c.Log,
 		timeout: timeout,
@@ -319,15 +395,16 @@ func (c *Client) Wait(resources ResourceList, timeout time.Duration) error {
 // WaitWithJobs wait up to the given timeout for the specified resources to be ready, including jobs.
 func (c *Client) WaitWithJobs(resources ResourceList, timeout time.Duration) error {
 	if c.ResourcesWaiter != nil {
-		return c.ResourcesWaiter.Wait(context.Background(), resources, timeout)
+		return c.ResourcesWaiter.Wait(c.baseContext(), resources, timeout)
 	}
 
 	cs, err := c.getKubeClient()
 	if err != nil {
 		return err
 	}
-	checker := NewReadyChecker(cs, c.Log, PausedAsReady(true), CheckJobs(true))
+	checker := NewReadyChecker(cs, c.Log, PausedAsReady(true), CheckJobs(true), DefaultReadinessEngine(c.ReadinessEngine))
 	w := waiter{
+		ctx:     c.baseContext(),
 		c:       checker,
 		log:     c.Log,
 		timeout: timeout,
@@ -411,17 +488,14 @@ func (c *Client) BuildTable(reader io.Reader, validate bool) (ResourceList, erro
 // resource updates, creations, and deletions that were attempted. These can be
 // used for cleanup or other logging purposes.
 func (c *Client) Update(original, target ResourceList, force bool, opts UpdateOptions) (*Result, error) {
+	var mu sync.Mutex
 	updateErrors := []string{}
 	res := &Result{}
 
 	c.Log("checking %d resources for changes", len(target))
-	err := target.Visit(func(info *resource.Info, err error) error {
-		if err != nil {
-			return err
-		}
-
+	apply := func(info *resource.Info) error {
 		helper := resource.NewHelper(info.Client, info.Mapping).WithFieldManager(getManagedFieldsManager())
-		if _, err := helper.Get(info.Namespace, info.Name); err != nil {
+		if err := getResourceUnlessGenerateName(helper, info); err != nil {
 			if !apierrors.IsNotFound(err) {
 				return errors.Wrap(err, "could not get information about the resource")
 			}
@@ -433,10 +507,12 @@ func (c *Client) Update(original, target ResourceList, force bool, opts UpdateOp
 			}
 			// Since the resource does not exist, create it.
 			if _, err := createResource(info); err != nil {
-				return errors.Wrap(err, "failed to create resource")
+				return c.truncateResourceError(info, errors.Wrap(err, "failed to create resource"))
 			}
 
+			mu.Lock()
 			res.Created = append(res.Created, info)
+			mu.Unlock()
 
 			kind := info.Mapping.GroupVersionKind.Kind
 			c.Log("Created a new %s called %q in %s\n", kind, info.Name, info.Namespace)
@@ -455,7 +531,12 @@ func (c *Client) Update(original, target ResourceList, force bool, opts UpdateOp
 			}
 		}
 
-		if err := updateResource(c, info, originalInfo.Object, force); err != nil {
+		err := updateResource(c, info, originalInfo.Object, force)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			err = c.truncateResourceError(info, err)
 			c.Log("error updating the resource %q:\n\t %v", info.Name, err)
 			updateErrors = append(updateErrors, err.Error())
 		} else {
@@ -463,7 +544,20 @@ func (c *Client) Update(original, target ResourceList, force bool, opts UpdateOp
 		}
 
 		return nil
-	})
+	}
+
+	var err error
+	if c.UpdateConcurrency > 1 {
+		err = performConcurrentlyByKind(target, c.UpdateConcurrency, apply)
+	} else {
+		err = target.Visit(func(info *resource.Info, err error) error {
+			if err != nil {
+				return err
+			}
+
+			return apply(info)
+		})
+	}
 
 	switch {
 	case err != nil:
@@ -530,6 +624,11 @@ func rdelete(c *Client, resources ResourceList, propagation metav1.DeletionPropa
 	res := &Result{}
 	mtx := sync.Mutex{}
 	err := perform(resources, func(info *resource.Info) error {
+		if info.Name == "" {
+			c.Log("Skipping delete of %s with metadata.generateName because its name is unknown", info.Mapping.GroupVersionKind.Kind)
+			return nil
+		}
+
 		if opts.SkipIfInvalidOwnership {
 			if err := info.Get(); err != nil {
 				c.Log("Skipping delete of %q due to inability to get the object from cluster: %s", info.Name, err)
@@ -589,7 +688,7 @@ func rdelete(c *Client, resources ResourceList, propagation metav1.DeletionPropa
 			})
 		}
 
-		if err := c.ResourcesWaiter.WaitUntilDeleted(context.Background(), specs, opts.WaitTimeout); err != nil {
+		if err := c.ResourcesWaiter.WaitUntilDeleted(c.baseContext(), specs, opts.WaitTimeout); err != nil {
 			return res, []error{fmt.Errorf("waiting until resources are deleted failed: %s", err)}
 		}
 	}
@@ -619,7 +718,7 @@ func (c *Client) watchTimeout(t time.Duration) func(*resource.Info) error {
 // Handling for other kinds will be added as necessary.
 func (c *Client) WatchUntilReady(resources ResourceList, timeout time.Duration) error {
 	if c.ResourcesWaiter != nil {
-		return c.ResourcesWaiter.WatchUntilReady(context.Background(), resources, timeout)
+		return c.ResourcesWaiter.WatchUntilReady(c.baseContext(), resources, timeout)
 	}
 
 	// For jobs, there's also the option to do poll c.Jobs(namespace).Get():
@@ -693,8 +792,19 @@ func createResource(info *resource.Info) (performResourceStatus, error) {
 	return resourceStatusCreated, info.Refresh(obj, true)
 }
 
+// getResourceUnlessGenerateName gets the resource from the cluster. Resources with metadata.generateName and
+// without a previously assigned name are reported as not found, since they always have to be created.
+func getResourceUnlessGenerateName(helper *resource.Helper, info *resource.Info) error {
+	if info.Name == "" {
+		return apierrors.NewNotFound(info.Mapping.Resource.GroupResource(), info.Name)
+	}
+
+	_, err := helper.Get(info.Namespace, info.Name)
+	return err
+}
+
 func createResourceSkipIfExists(info *resource.Info) (performResourceStatus, error) {
-	_, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, info.Name)
+	err := getResourceUnlessGenerateName(resource.NewHelper(info.Client, info.Mapping), info)
 	if apierrors.IsNotFound(err) {
 		return createResource(info)
 	} else if err != nil {
@@ -720,6 +830,19 @@ func createPatch(target *resource.Info, current runtime.Object) ([]byte, types.P
 		return nil, types.StrategicMergePatchType, errors.Wrap(err, "serializing target configuration")
 	}
 
+	// Ignored fields are left out of both configurations, so that the patch
+	// keeps their live values.
+	ignoredFields, err := ignoredFieldsOf(target.Object)
+	if err != nil {
+		return nil, types.StrategicMergePatchType, err
+	}
+	if oldData, err = removeIgnoredFields(oldData, ignoredFields); err != nil {
+		return nil, types.StrategicMergePatchType, errors.Wrap(err, "removing ignored fields from current configuration")
+	}
+	if newData, err = removeIgnoredFields(newData, ignoredFields); err != nil {
+		return nil, types.StrategicMergePatchType, errors.Wrap(err, "removing ignored fields from target configuration")
+	}
+
 	// Fetch the current object for the three way merge
 	helper := resource.NewHelper(target.Client, target.Mapping).WithFieldManager(getManagedFieldsManager())
 	currentObj, err := helper.Get(target.Namespace, target.Name)
@@ -776,6 +899,25 @@ func updateResource(c *Client, target *resource.Info, currentObj runtime.Object,
 		}
 		c.Log("Replaced %q with kind %s for kind %s", target.Name, currentObj.GetObjectKind().GroupVersionKind().Kind, kind)
 	} else {
+		strategy, err := applyStrategyOf(target.Object, c.ApplyStrategy)
+		if err != nil {
+			return err
+		}
+
+		if strategy != ApplyStrategyThreeWayMerge {
+			c.Log("Apply %s %q in namespace %s server-side", kind, target.Name, target.Namespace)
+			obj, err = serverSideApply(helper, target)
+			switch {
+			case err == nil:
+				target.Refresh(obj, true)
+				return nil
+			case strategy == ApplyStrategyAuto && isServerSideApplyRejected(err):
+				c.Log("Server-side apply of %s %q is rejected, falling back to three-way merge: %s", kind, target.Name, err)
+			default:
+				return errors.Wrapf(err, "cannot apply %q with kind %s server-side", target.Name, kind)
+			}
+		}
+
 		patch, patchType, err := createPatch(target, currentObj)
 		if err != nil {
 			return errors.Wrap(err, "failed to create patch")
@@ -826,7 +968,7 @@ func (c *Client) watchUntilReady(timeout time.Duration, info *resource.Info) err
 	// In the future, we might want to add some special logic for types
 	// like Ingress, Volume, etc.
 
-	ctx, cancel := watchtools.ContextWithOptionalTimeout(context.Background(), timeout)
+	ctx, cancel := watchtools.ContextWithOptionalTimeout(c.baseContext(), timeout)
 	defer cancel()
 	_, err = watchtools.UntilWithSync(ctx, lw, &unstructured.Unstructured{}, nil, func(e watch.Event) (bool, error) {
 		// Make sure the incoming object is versioned as we use unstructured
@@ -926,7 +1068,7 @@ func (c *Client) WaitAndGetCompletedPodPhase(name string, timeout time.Duration)
 		return v1.PodUnknown, err
 	}
 	to := int64(timeout)
-	watcher, err := client.CoreV1().Pods(c.namespace()).Watch(context.Background(), metav1.ListOptions{
+	watcher, err := client.CoreV1().Pods(c.namespace()).Watch(c.baseContext(), metav1.ListOptions{
 		FieldSelector:  fmt.Sprintf("metadata.name=%s", name),
 		TimeoutSeconds: &to,
 	})
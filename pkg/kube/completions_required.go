@@ -0,0 +1,74 @@
+package kube
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// TrackCompletionsRequiredAnnotation is the number of the successful
+// completions after which a Job, or another batch workload tracked by an
+// external tracker, is ready, instead of all its spec.completions. It lets
+// e.g. the indexed Jobs whose remaining indexes are not needed by the
+// release finish after the deploy.
+const TrackCompletionsRequiredAnnotation = "werf.io/track-completions-required"
+
+// ParseCompletionsRequired parses the value of
+// TrackCompletionsRequiredAnnotation.
+func ParseCompletionsRequired(value string) (int32, error) {
+	completions, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || completions <= 0 {
+		return 0, errors.Errorf("invalid value %q: expected a positive integer", value)
+	}
+
+	return int32(completions), nil
+}
+
+// CompletionsRequired returns the TrackCompletionsRequiredAnnotation of the
+// resource, 0 if it is not set. The annotation may not exceed the
+// spec.completions of the resource, if they are set.
+func CompletionsRequired(v *resource.Info) (int32, error) {
+	completions, err := completionsRequiredOf(v.Object)
+	if err != nil {
+		return 0, errors.Wrapf(err, "annotation %s of %s", TrackCompletionsRequiredAnnotation, ResourceNameNamespaceKind(v))
+	}
+
+	return completions, nil
+}
+
+// completionsRequiredOf returns the TrackCompletionsRequiredAnnotation of the
+// object, 0 if it is not set.
+func completionsRequiredOf(obj runtime.Object) (int32, error) {
+	annotations, err := metadataAccessor.Annotations(obj)
+	if err != nil {
+		return 0, err
+	}
+
+	value, found := annotations[TrackCompletionsRequiredAnnotation]
+	if !found {
+		return 0, nil
+	}
+
+	required, err := ParseCompletionsRequired(value)
+	if err != nil {
+		return 0, err
+	}
+
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return 0, err
+		}
+		u = &unstructured.Unstructured{Object: content}
+	}
+
+	if completions, found, _ := unstructured.NestedInt64(u.Object, "spec", "completions"); found && int64(required) > completions {
+		return 0, errors.Errorf("%d completions required, but only %d are run", required, completions)
+	}
+
+	return required, nil
+}
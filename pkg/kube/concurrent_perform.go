@@ -0,0 +1,69 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// performConcurrentlyByKind runs fn for the resources, at most concurrency at once. As in batchPerform,
+// consecutive resources of the same kind are processed together and the next kind is not started before
+// the previous one is done, so that the install order of kinds is kept. If fn fails for any resource of a
+// kind, the errors of all the resources of that kind are returned and the remaining kinds are skipped.
+func performConcurrentlyByKind(infos ResourceList, concurrency int, fn func(*resource.Info) error) error {
+	for start := 0; start < len(infos); {
+		kind := infos[start].Object.GetObjectKind().GroupVersionKind().Kind
+		end := start + 1
+		for end < len(infos) && infos[end].Object.GetObjectKind().GroupVersionKind().Kind == kind {
+			end++
+		}
+
+		if err := performConcurrently(infos[start:end], concurrency, fn); err != nil {
+			return err
+		}
+
+		start = end
+	}
+
+	return nil
+}
+
+func performConcurrently(infos ResourceList, concurrency int, fn func(*resource.Info) error) error {
+	errs := make([]error, len(infos))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, info := range infos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, info *resource.Info) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			errs[i] = fn(info)
+		}(i, info)
+	}
+	wg.Wait()
+
+	var firstErr error
+	var msgs []string
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		msgs = append(msgs, fmt.Sprintf("%s: %s", infos[i].ObjectName(), err))
+	}
+
+	if len(msgs) <= 1 {
+		return firstErr
+	}
+
+	return fmt.Errorf("%s", strings.Join(msgs, " && "))
+}
@@ -0,0 +1,83 @@
+package kube
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func newKindInfo(kind, name string) *resource.Info {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind(kind)
+	obj.SetName(name)
+
+	return &resource.Info{Name: name, Object: obj}
+}
+
+func TestPerformConcurrentlyByKind(t *testing.T) {
+	infos := ResourceList{
+		newKindInfo("ConfigMap", "a"),
+		newKindInfo("ConfigMap", "b"),
+		newKindInfo("ConfigMap", "c"),
+		newKindInfo("Deployment", "d"),
+	}
+
+	var mu sync.Mutex
+	var running, maxRunning int32
+	var configMapsDone int
+	err := performConcurrentlyByKind(infos, 2, func(info *resource.Info) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if n > maxRunning {
+			maxRunning = n
+		}
+		switch info.Object.GetObjectKind().GroupVersionKind().Kind {
+		case "ConfigMap":
+			configMapsDone++
+		case "Deployment":
+			if configMapsDone != 3 {
+				t.Errorf("Deployment applied before all ConfigMaps were done")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 resources applied at once, got %d", maxRunning)
+	}
+
+	var applied []string
+	err = performConcurrentlyByKind(infos, 2, func(info *resource.Info) error {
+		mu.Lock()
+		applied = append(applied, info.Name)
+		mu.Unlock()
+
+		if info.Name == "a" || info.Name == "c" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "configmap/a: boom") || !strings.Contains(err.Error(), "configmap/c: boom") {
+		t.Errorf("expected the errors of both failed resources, got %q", err)
+	}
+	for _, name := range applied {
+		if name == "d" {
+			t.Errorf("expected the next kind to be skipped after a failure")
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ContainerLogsWriter receives the logs of the containers of the tracked
+// resources streamed by a LogsResourcesWaiter, see LogsOptions.
+type ContainerLogsWriter interface {
+	// WriteContainerLogs writes the lines of the logs of the container of the
+	// resource. The namespace is empty for the cluster-scoped resources.
+	WriteContainerLogs(kind, name, namespace, container string, lines []string) error
+}
+
+var _ ContainerLogsWriter = (*ContainerLogFiles)(nil)
+
+// ContainerLogFiles writes the logs of the containers of the tracked
+// resources into the files of the resources under a directory, as
+// <dir>/<namespace>/<kind>-<name>/<container>.log, or as
+// <dir>/<kind>-<name>/<container>.log for the cluster-scoped resources, so
+// that the resources of the same name in different namespaces don't share
+// their files. They are to be kept e.g. as CI artifacts for
+// the analysis of the failed deploys. The logs are appended, so that the
+// files keep the logs of a failed upgrade along with the ones of its
+// rollback.
+//
+// A nil ContainerLogFiles, the one of a deploy without a logs directory,
+// writes nothing. It is safe for concurrent use.
+type ContainerLogFiles struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// NewContainerLogFiles returns the ContainerLogFiles writing under the
+// directory, or nil if the directory is empty.
+func NewContainerLogFiles(dir string) *ContainerLogFiles {
+	if dir == "" {
+		return nil
+	}
+
+	return &ContainerLogFiles{dir: dir, files: map[string]*os.File{}}
+}
+
+// WriteContainerLogs appends the lines of the logs of the container of the
+// resource to its file.
+func (f *ContainerLogFiles) WriteContainerLogs(kind, name, namespace, container string, lines []string) error {
+	if f == nil || len(lines) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(f.dir, namespace, strings.ToLower(kind)+"-"+name, container+".log")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[path]
+	if !ok {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return errors.Wrap(err, "unable to create container logs directory")
+		}
+
+		var err error
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return errors.Wrap(err, "unable to open container logs file")
+		}
+		f.files[path] = file
+	}
+
+	if _, err := file.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		return errors.Wrapf(err, "unable to write container logs to %s", path)
+	}
+
+	return nil
+}
+
+// Close closes the files.
+func (f *ContainerLogFiles) Close() error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs []string
+	for path, file := range f.files {
+		if err := file.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+		delete(f.files, path)
+	}
+
+	if len(errs) != 0 {
+		return errors.Errorf("unable to close container logs files: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
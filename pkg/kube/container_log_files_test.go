@@ -0,0 +1,67 @@
+package kube
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainerLogFiles(t *testing.T) {
+	var unset *ContainerLogFiles
+	if err := unset.WriteContainerLogs("Deployment", "app", "prod", "web", []string{"started"}); err != nil {
+		t.Errorf("expected nothing to be written without a directory, got %s", err)
+	}
+
+	dir := t.TempDir()
+	for _, lines := range [][]string{{"starting", "listening on :8080"}, {"shutting down"}} {
+		files := NewContainerLogFiles(dir)
+		if err := files.WriteContainerLogs("Deployment", "app", "prod", "web", lines); err != nil {
+			t.Fatal(err)
+		}
+		if err := files.WriteContainerLogs("Deployment", "app", "staging", "web", []string{"staging"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := files.WriteContainerLogs("ClusterRole", "app", "", "web", []string{"cluster-scoped"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := files.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, expected := range map[string]string{
+		filepath.Join("prod", "deployment-app", "web.log"):    "starting\nlistening on :8080\nshutting down\n",
+		filepath.Join("staging", "deployment-app", "web.log"): "staging\nstaging\n",
+		filepath.Join("clusterrole-app", "web.log"):           "cluster-scoped\ncluster-scoped\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected the logs of both deploys %q in %s, got %q", expected, path, data)
+		}
+	}
+}
+
+type failingLogsWriter struct{}
+
+func (failingLogsWriter) WriteContainerLogs(string, string, string, string, []string) error {
+	return errors.New("disk full")
+}
+
+func TestLogsOptionsWriteContainerLogs(t *testing.T) {
+	dir := t.TempDir()
+	files := NewContainerLogFiles(dir)
+	defer files.Close()
+
+	opts := LogsOptions{Writers: []ContainerLogsWriter{failingLogsWriter{}, files}}
+	if err := opts.WriteContainerLogs("Pod", "app", "prod", "web", []string{"started"}); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected the error of the failing writer, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "prod", "pod-app", "web.log")); err != nil {
+		t.Errorf("expected the logs to be written by the other writers, got %s", err)
+	}
+}
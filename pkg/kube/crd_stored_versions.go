@@ -0,0 +1,192 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	crdGroupKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+	crdResource  = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+)
+
+// CheckCRDStoredVersions fails if updating a CustomResourceDefinition among
+// the resources would remove a version which is still listed in the
+// status.storedVersions of the CustomResourceDefinition in the cluster. The
+// API server rejects such an update, and it would do so in the middle of the
+// rollout, after some of the resources are already updated.
+//
+// If migrate is true, the stored objects of such CustomResourceDefinitions are
+// migrated instead: all of them are rewritten in the current storage version,
+// which the update must keep, and the removed versions are dropped from
+// status.storedVersions.
+func (c *Client) CheckCRDStoredVersions(resources ResourceList, migrate bool) error {
+	dyn, err := c.Factory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	return checkCRDStoredVersions(c.baseContext(), dyn, resources, migrate, c.Log)
+}
+
+func checkCRDStoredVersions(ctx context.Context, dyn dynamic.Interface, resources ResourceList, migrate bool, log func(string, ...interface{})) error {
+	var errs []string
+	for _, info := range resources {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(info.Object)
+		if err != nil {
+			return fmt.Errorf("unable to convert %s to unstructured: %w", info.ObjectName(), err)
+		}
+		desired := &unstructured.Unstructured{Object: content}
+		if desired.GroupVersionKind().GroupKind() != crdGroupKind {
+			continue
+		}
+
+		live, err := dyn.Resource(crdResource).Get(ctx, desired.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("unable to get CustomResourceDefinition %s: %w", desired.GetName(), err)
+		}
+
+		removed := removedStoredVersions(live, desired)
+		if len(removed) == 0 {
+			continue
+		}
+
+		if !migrate {
+			errs = append(errs, fmt.Sprintf("CustomResourceDefinition %s: the removed versions %s are still listed in status.storedVersions, migrate the stored objects to the new storage version and remove the versions from status.storedVersions first, e.g. with --migrate-crd-stored-versions", desired.GetName(), strings.Join(removed, ", ")))
+			continue
+		}
+
+		if err := migrateCRDStoredVersions(ctx, dyn, live, desired, log); err != nil {
+			errs = append(errs, fmt.Sprintf("CustomResourceDefinition %s: %s", desired.GetName(), err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d CustomResourceDefinitions can't be updated: %s", len(errs), strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// removedStoredVersions returns the stored versions of the live
+// CustomResourceDefinition which are not among the versions of the desired
+// one.
+func removedStoredVersions(live, desired *unstructured.Unstructured) []string {
+	storedVersions, _, _ := unstructured.NestedStringSlice(live.Object, "status", "storedVersions")
+
+	versions := map[string]bool{}
+	for _, version := range crdVersions(desired) {
+		versions[version.name] = true
+	}
+
+	var removed []string
+	for _, version := range storedVersions {
+		if !versions[version] {
+			removed = append(removed, version)
+		}
+	}
+
+	return removed
+}
+
+type crdVersion struct {
+	name    string
+	storage bool
+}
+
+// crdVersions returns the versions of the CustomResourceDefinition, including
+// the single spec.version of the apiextensions.k8s.io/v1beta1 ones.
+func crdVersions(crd *unstructured.Unstructured) []crdVersion {
+	var result []crdVersion
+
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(version, "name")
+		storage, _, _ := unstructured.NestedBool(version, "storage")
+		result = append(result, crdVersion{name: name, storage: storage})
+	}
+
+	if len(result) == 0 {
+		if name, _, _ := unstructured.NestedString(crd.Object, "spec", "version"); name != "" {
+			result = append(result, crdVersion{name: name, storage: true})
+		}
+	}
+
+	return result
+}
+
+// migrateCRDStoredVersions rewrites all the objects of the live
+// CustomResourceDefinition, so that they are stored in its current storage
+// version, and leaves only that version in status.storedVersions.
+func migrateCRDStoredVersions(ctx context.Context, dyn dynamic.Interface, live, desired *unstructured.Unstructured, log func(string, ...interface{})) error {
+	var storageVersion string
+	for _, version := range crdVersions(live) {
+		if version.storage {
+			storageVersion = version.name
+		}
+	}
+
+	kept := false
+	for _, version := range crdVersions(desired) {
+		if version.name == storageVersion {
+			kept = true
+		}
+	}
+	if storageVersion == "" || !kept {
+		return fmt.Errorf("the current storage version %q is removed, deploy the CustomResourceDefinition with the new storage version and the old versions kept first", storageVersion)
+	}
+
+	group, _, _ := unstructured.NestedString(live.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(live.Object, "spec", "names", "plural")
+	client := dyn.Resource(schema.GroupVersionResource{Group: group, Version: storageVersion, Resource: plural})
+
+	log("migrating the stored objects of CustomResourceDefinition %s to version %s", live.GetName(), storageVersion)
+	migrated := 0
+	opts := metav1.ListOptions{Limit: 500}
+	for {
+		list, err := client.List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("unable to list the objects: %w", err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			// An update without changes still rewrites the object in the
+			// storage version, as the stored encoding differs.
+			_, err := client.Namespace(obj.GetNamespace()).Update(ctx, obj, metav1.UpdateOptions{})
+			if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+				return fmt.Errorf("unable to migrate %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+			}
+			migrated++
+		}
+
+		if list.GetContinue() == "" {
+			break
+		}
+		opts.Continue = list.GetContinue()
+	}
+
+	if err := unstructured.SetNestedStringSlice(live.Object, []string{storageVersion}, "status", "storedVersions"); err != nil {
+		return err
+	}
+	if _, err := dyn.Resource(crdResource).UpdateStatus(ctx, live, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("unable to update status.storedVersions: %w", err)
+	}
+	log("migrated %d objects of CustomResourceDefinition %s", migrated, live.GetName())
+
+	return nil
+}
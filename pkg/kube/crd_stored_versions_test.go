@@ -0,0 +1,85 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCheckCRDStoredVersions(t *testing.T) {
+	crd := func(storedVersions []string, versions ...string) *unstructured.Unstructured {
+		var specVersions []interface{}
+		for i, version := range versions {
+			specVersions = append(specVersions, map[string]interface{}{"name": version, "served": true, "storage": i == len(versions)-1})
+		}
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata":   map[string]interface{}{"name": "crontabs.stable.example.com"},
+			"spec": map[string]interface{}{
+				"group":    "stable.example.com",
+				"names":    map[string]interface{}{"plural": "crontabs", "kind": "CronTab"},
+				"versions": specVersions,
+			},
+		}}
+		if storedVersions != nil {
+			_ = unstructured.SetNestedStringSlice(obj.Object, storedVersions, "status", "storedVersions")
+		}
+		return obj
+	}
+	cronTab := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "stable.example.com/v2",
+		"kind":       "CronTab",
+		"metadata":   map[string]interface{}{"name": "backup", "namespace": "spaced"},
+	}}
+	cronTabs := schema.GroupVersionResource{Group: "stable.example.com", Version: "v2", Resource: "crontabs"}
+
+	newClient := func() *dynamicfake.FakeDynamicClient {
+		return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			crdResource: "CustomResourceDefinitionList",
+			cronTabs:    "CronTabList",
+		}, crd([]string{"v1", "v2"}, "v1", "v2"), cronTab)
+	}
+	desired := ResourceList{&resource.Info{Name: "crontabs.stable.example.com", Object: crd(nil, "v2")}}
+
+	dyn := newClient()
+	if err := checkCRDStoredVersions(context.Background(), dyn, desired, false, nopLogger); err == nil {
+		t.Fatal("expected the removal of the stored version v1 to fail")
+	}
+
+	kept := ResourceList{&resource.Info{Name: "crontabs.stable.example.com", Object: crd(nil, "v1", "v2", "v3")}}
+	if err := checkCRDStoredVersions(context.Background(), dyn, kept, false, nopLogger); err != nil {
+		t.Fatalf("expected the CustomResourceDefinition keeping the stored versions to pass, got %s", err)
+	}
+
+	dyn = newClient()
+	if err := checkCRDStoredVersions(context.Background(), dyn, desired, true, nopLogger); err != nil {
+		t.Fatalf("expected the stored versions to be migrated, got %s", err)
+	}
+
+	updated := 0
+	for _, action := range dyn.Actions() {
+		if update, ok := action.(k8stesting.UpdateAction); ok && update.GetResource() == cronTabs {
+			updated++
+		}
+	}
+	if updated != 1 {
+		t.Errorf("expected 1 CronTab to be rewritten, got %d", updated)
+	}
+
+	live, err := dyn.Resource(crdResource).Get(context.Background(), "crontabs.stable.example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storedVersions, _, _ := unstructured.NestedStringSlice(live.Object, "status", "storedVersions")
+	if len(storedVersions) != 1 || storedVersions[0] != "v2" {
+		t.Errorf("expected the stored versions to be [v2], got %v", storedVersions)
+	}
+}
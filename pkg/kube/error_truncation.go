@@ -0,0 +1,105 @@
+package kube
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/releaseutil"
+)
+
+// DefaultMaxErrorSize is the default maximum size, in bytes, of the messages
+// of the errors of applying resources.
+const DefaultMaxErrorSize = 4096
+
+// TruncatedError is the error of a resource whose message, e.g. the one of
+// the API server with the whole invalid object, is longer than the maximum
+// size.
+type TruncatedError struct {
+	Err error
+	// Truncated is the number of the bytes of the message cut off.
+	Truncated int
+	// DumpPath is the file with the full error and the manifest of the
+	// resource, if it is kept.
+	DumpPath string
+
+	message string
+}
+
+func (e *TruncatedError) Error() string {
+	if e.DumpPath != "" {
+		return fmt.Sprintf("%s... (%d bytes truncated, see the full error in %s)", e.message, e.Truncated, e.DumpPath)
+	}
+
+	return fmt.Sprintf("%s... (%d bytes truncated)", e.message, e.Truncated)
+}
+
+func (e *TruncatedError) Unwrap() error {
+	return e.Err
+}
+
+// truncateResourceError truncates the error of the resource to the
+// MaxErrorSize of the client, writing the full error and the manifest of the
+// resource into the ErrorDumpDir if it is set.
+func (c *Client) truncateResourceError(info *resource.Info, err error) error {
+	maxSize := c.MaxErrorSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxErrorSize
+	}
+
+	msg := err.Error()
+	if maxSize < 0 || len(msg) <= maxSize {
+		return err
+	}
+
+	cut := maxSize
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+
+	result := &TruncatedError{Err: err, Truncated: len(msg) - cut, message: msg[:cut]}
+
+	if c.ErrorDumpDir != "" {
+		path, dumpErr := dumpResourceError(c.ErrorDumpDir, info, msg)
+		if dumpErr != nil {
+			c.Log("warning: unable to dump the error of %s: %s", ResourceNameNamespaceKind(info), dumpErr)
+		} else {
+			result.DumpPath = path
+		}
+	}
+
+	return result
+}
+
+// dumpResourceError writes the message and the manifest of the resource into
+// the file of the resource in the directory, readable by the user only. The
+// data of the Secrets and of the resources annotated as sensitive is redacted.
+func dumpResourceError(dir string, info *resource.Info, msg string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	name := []string{strings.ToLower(info.Mapping.GroupVersionKind.Kind)}
+	if info.Namespace != "" {
+		name = append(name, info.Namespace)
+	}
+	name = append(name, info.Name)
+	path := filepath.Join(dir, strings.Join(name, "-")+".txt")
+
+	manifest, err := yaml.Marshal(info.Object)
+	if err != nil {
+		return "", err
+	}
+
+	data := fmt.Sprintf("%s\n\n---\n%s", msg, releaseutil.RedactSensitiveManifest(string(manifest)))
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
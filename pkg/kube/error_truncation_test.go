@@ -0,0 +1,103 @@
+package kube
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func TestTruncateResourceError(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	obj.SetName("api")
+	obj.SetNamespace("backend")
+	info := &resource.Info{
+		Name:      "api",
+		Namespace: "backend",
+		Object:    obj,
+		Mapping:   &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}},
+	}
+
+	cause := errors.New(`Deployment.apps "api" is invalid: ` + strings.Repeat("x", 100))
+
+	c := &Client{Log: nopLogger, MaxErrorSize: 200}
+	if err := c.truncateResourceError(info, cause); err != cause {
+		t.Errorf("expected the short error to be kept, got %q", err)
+	}
+
+	c.MaxErrorSize = 40
+	err := c.truncateResourceError(info, cause)
+	if !strings.HasPrefix(err.Error(), `Deployment.apps "api" is invalid: xxxxxx... (94 bytes truncated)`) {
+		t.Errorf("unexpected truncated error %q", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected the truncated error to wrap the full one")
+	}
+
+	c.ErrorDumpDir = t.TempDir()
+	err = c.truncateResourceError(info, cause)
+
+	var truncated *TruncatedError
+	if !errors.As(err, &truncated) || truncated.DumpPath == "" {
+		t.Fatalf("expected the full error to be dumped, got %q", err)
+	}
+	if !strings.HasSuffix(err.Error(), "see the full error in "+truncated.DumpPath+")") {
+		t.Errorf("expected the error to point to the dump, got %q", err)
+	}
+
+	data, readErr := os.ReadFile(truncated.DumpPath)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	if !strings.Contains(string(data), cause.Error()) || !strings.Contains(string(data), "name: api") {
+		t.Errorf("expected the dump to have the full error and the manifest, got:\n%s", data)
+	}
+
+	c.MaxErrorSize = -1
+	if err := c.truncateResourceError(info, cause); err != cause {
+		t.Errorf("expected no truncation without a limit, got %q", err)
+	}
+}
+
+func TestDumpResourceErrorRedactsSecrets(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("Secret")
+	obj.SetName("credentials")
+	obj.SetNamespace("backend")
+	obj.Object["stringData"] = map[string]interface{}{"password": "hunter2"}
+	info := &resource.Info{
+		Name:      "credentials",
+		Namespace: "backend",
+		Object:    obj,
+		Mapping:   &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "Secret"}},
+	}
+
+	path, err := dumpResourceError(t.TempDir(), info, `Secret "credentials" is invalid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), "password: <redacted>") {
+		t.Errorf("expected the data of the Secret to be redacted, got:\n%s", data)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := stat.Mode().Perm(); mode != 0o600 {
+		t.Errorf("expected the dump to be readable by the user only, got %v", mode)
+	}
+}
@@ -0,0 +1,284 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// maxOwnerChainDepth limits how far the owner references of an object are
+// followed, e.g. Pod -> ReplicaSet -> Deployment.
+const maxOwnerChainDepth = 3
+
+// EventsWatcher watches the Warning events of the namespaces of a deploy and
+// collects the ones concerning release resources or the objects they create
+// indirectly, such as the ReplicaSets and Pods of a Deployment.
+type EventsWatcher struct {
+	client     kubernetes.Interface
+	namespaces []string
+	log        func(string, ...interface{})
+
+	mu        sync.Mutex
+	resources map[objectRef]bool
+	owned     map[objectRef]bool
+	warnings  []*corev1.Event
+
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+type objectRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (r objectRef) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", r.Namespace, r.Kind, r.Name)
+}
+
+// NewEventsWatcher creates a new EventsWatcher for the given namespaces, e.g.
+// the release namespace and the other namespaces the release resources or
+// their external dependencies are deployed into.
+func NewEventsWatcher(client kubernetes.Interface, namespaces []string, log func(string, ...interface{})) *EventsWatcher {
+	return &EventsWatcher{
+		client:     client,
+		namespaces: namespaces,
+		log:        log,
+		resources:  map[objectRef]bool{},
+		owned:      map[objectRef]bool{},
+	}
+}
+
+// AddResources registers release resources. Warning events of these resources
+// and of the objects they own are collected.
+func (w *EventsWatcher) AddResources(resources ResourceList) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, res := range resources {
+		w.resources[objectRef{
+			Kind:      res.Mapping.GroupVersionKind.Kind,
+			Namespace: res.Namespace,
+			Name:      res.Name,
+		}] = true
+	}
+}
+
+// Start starts watching the events created from now on in every namespace.
+// The watcher runs until Stop is called.
+func (w *EventsWatcher) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var watchers []watch.Interface
+	for _, namespace := range w.namespaces {
+		watcher, err := w.watchNamespace(ctx, namespace)
+		if err != nil {
+			for _, watcher := range watchers {
+				watcher.Stop()
+			}
+			cancel()
+			return err
+		}
+		watchers = append(watchers, watcher)
+	}
+
+	w.cancel = cancel
+
+	for _, watcher := range watchers {
+		w.done.Add(1)
+		go func(watcher watch.Interface) {
+			defer w.done.Done()
+			defer watcher.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e, ok := <-watcher.ResultChan():
+					if !ok {
+						return
+					}
+					if e.Type != watch.Added && e.Type != watch.Modified {
+						continue
+					}
+					if event, ok := e.Object.(*corev1.Event); ok {
+						w.handleEvent(ctx, event)
+					}
+				}
+			}
+		}(watcher)
+	}
+
+	return nil
+}
+
+func (w *EventsWatcher) watchNamespace(ctx context.Context, namespace string) (watch.Interface, error) {
+	list, err := w.client.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list events in namespace %q", namespace)
+	}
+
+	watcher, err := watchtools.NewRetryWatcher(list.ResourceVersion, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fields.OneTermEqualSelector("type", corev1.EventTypeWarning).String()
+			return w.client.CoreV1().Events(namespace).Watch(ctx, options)
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to watch events in namespace %q", namespace)
+	}
+
+	return watcher, nil
+}
+
+// Stop stops watching the events. Collected warnings are kept. Stop on a nil
+// watcher is a no-op.
+func (w *EventsWatcher) Stop() {
+	if w == nil || w.cancel == nil {
+		return
+	}
+	w.cancel()
+	w.done.Wait()
+	w.cancel = nil
+}
+
+// Warnings returns the collected Warning events formatted one per line.
+func (w *EventsWatcher) Warnings() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var result []string
+	for _, event := range w.warnings {
+		ref := objectRef{Kind: event.InvolvedObject.Kind, Name: event.InvolvedObject.Name}
+		// The namespace only tells the objects apart if there are several.
+		if len(w.namespaces) > 1 {
+			ref.Namespace = event.InvolvedObject.Namespace
+		}
+		line := fmt.Sprintf("%s: %s: %s", ref, event.Reason, strings.TrimSpace(event.Message))
+		if event.Count > 1 {
+			line += fmt.Sprintf(" (x%d)", event.Count)
+		}
+		result = append(result, line)
+	}
+
+	return result
+}
+
+// WrapError appends the collected warnings to err. Returns err unchanged if
+// there are none or the watcher is nil.
+func (w *EventsWatcher) WrapError(err error) error {
+	if w == nil || err == nil {
+		return err
+	}
+
+	warnings := w.Warnings()
+	if len(warnings) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w\nwarning events:\n  %s", err, strings.Join(warnings, "\n  "))
+}
+
+func (w *EventsWatcher) handleEvent(ctx context.Context, event *corev1.Event) {
+	if event.Type != corev1.EventTypeWarning {
+		return
+	}
+
+	ref := objectRef{
+		Kind:      event.InvolvedObject.Kind,
+		Namespace: event.InvolvedObject.Namespace,
+		Name:      event.InvolvedObject.Name,
+	}
+	if !w.belongsToRelease(ctx, ref, 0) {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The same event is updated in place when it repeats.
+	for i, existing := range w.warnings {
+		if existing.UID == event.UID {
+			w.warnings[i] = event
+			return
+		}
+	}
+	w.warnings = append(w.warnings, event)
+}
+
+// belongsToRelease reports whether the object is a release resource or is
+// owned, possibly transitively, by one.
+func (w *EventsWatcher) belongsToRelease(ctx context.Context, ref objectRef, depth int) bool {
+	w.mu.Lock()
+	if w.resources[ref] {
+		w.mu.Unlock()
+		return true
+	}
+	owned, cached := w.owned[ref]
+	w.mu.Unlock()
+	if cached {
+		return owned
+	}
+
+	if depth >= maxOwnerChainDepth {
+		return false
+	}
+
+	ownerRefs, err := w.getOwnerReferences(ctx, ref)
+	if err != nil {
+		w.log("unable to get owners of %s: %s", ref, err)
+		return false
+	}
+
+	owned = false
+	for _, owner := range ownerRefs {
+		if w.belongsToRelease(ctx, objectRef{Kind: owner.Kind, Namespace: ref.Namespace, Name: owner.Name}, depth+1) {
+			owned = true
+			break
+		}
+	}
+
+	w.mu.Lock()
+	w.owned[ref] = owned
+	w.mu.Unlock()
+
+	return owned
+}
+
+// getOwnerReferences returns the owner references of the kinds that are usually
+// created indirectly by release resources. Other kinds are considered to have
+// no owners.
+func (w *EventsWatcher) getOwnerReferences(ctx context.Context, ref objectRef) ([]metav1.OwnerReference, error) {
+	var obj metav1.Object
+	var err error
+
+	switch ref.Kind {
+	case "Pod":
+		obj, err = w.client.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	case "ReplicaSet":
+		obj, err = w.client.AppsV1().ReplicaSets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	case "Job":
+		obj, err = w.client.BatchV1().Jobs(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.GetOwnerReferences(), nil
+}
@@ -0,0 +1,148 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEventsWatcherHandleEvent(t *testing.T) {
+	ns := v1.NamespaceDefault
+	client := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:            "app-5d4f",
+			Namespace:       ns,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "app"}},
+		}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            "app-5d4f-x2x9k",
+			Namespace:       ns,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "app-5d4f"}},
+		}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:      "unrelated",
+			Namespace: ns,
+		}},
+	)
+
+	w := NewEventsWatcher(client, []string{ns}, t.Logf)
+	w.AddResources(ResourceList{{
+		Name:      "app",
+		Namespace: ns,
+		Mapping:   &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}},
+	}})
+
+	newEvent := func(uid, kind, name, eventType, reason string) *v1.Event {
+		return &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{UID: types.UID(uid)},
+			InvolvedObject: v1.ObjectReference{Kind: kind, Namespace: ns, Name: name},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        reason + " message",
+			Count:          1,
+		}
+	}
+
+	ctx := context.Background()
+	w.handleEvent(ctx, newEvent("1", "Deployment", "app", v1.EventTypeNormal, "ScalingReplicaSet"))
+	w.handleEvent(ctx, newEvent("2", "Deployment", "app", v1.EventTypeWarning, "ProgressDeadlineExceeded"))
+	w.handleEvent(ctx, newEvent("3", "Pod", "app-5d4f-x2x9k", v1.EventTypeWarning, "BackOff"))
+	w.handleEvent(ctx, newEvent("4", "Pod", "unrelated", v1.EventTypeWarning, "Failed"))
+	w.handleEvent(ctx, newEvent("5", "Pod", "missing", v1.EventTypeWarning, "Failed"))
+
+	repeated := newEvent("3", "Pod", "app-5d4f-x2x9k", v1.EventTypeWarning, "BackOff")
+	repeated.Count = 5
+	w.handleEvent(ctx, repeated)
+
+	expect := []string{
+		"Deployment/app: ProgressDeadlineExceeded: ProgressDeadlineExceeded message",
+		"Pod/app-5d4f-x2x9k: BackOff: BackOff message (x5)",
+	}
+	got := w.Warnings()
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("expected warnings %q, got %q", expect, got)
+	}
+}
+
+func TestEventsWatcherWrapError(t *testing.T) {
+	w := NewEventsWatcher(fake.NewSimpleClientset(), []string{v1.NamespaceDefault}, t.Logf)
+	w.AddResources(ResourceList{&resource.Info{
+		Name:      "app",
+		Namespace: v1.NamespaceDefault,
+		Mapping:   &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}},
+	}})
+
+	err := context.DeadlineExceeded
+	if got := w.WrapError(err); got != err {
+		t.Errorf("expected error to be unchanged without warnings, got %q", got)
+	}
+
+	w.handleEvent(context.Background(), &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "Deployment", Namespace: v1.NamespaceDefault, Name: "app"},
+		Type:           v1.EventTypeWarning,
+		Reason:         "FailedCreate",
+		Message:        "quota exceeded",
+	})
+
+	expect := "context deadline exceeded\nwarning events:\n  Deployment/app: FailedCreate: quota exceeded"
+	if got := w.WrapError(err); got.Error() != expect {
+		t.Errorf("expected %q, got %q", expect, got)
+	}
+}
+
+func TestEventsWatcherMultipleNamespaces(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:            "migrate-x2x9k",
+			Namespace:       "db",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Job", Name: "migrate"}},
+		}},
+	)
+
+	w := NewEventsWatcher(client, []string{"app", "db"}, t.Logf)
+	w.AddResources(ResourceList{
+		{
+			Name:      "app",
+			Namespace: "app",
+			Mapping:   &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}},
+		},
+		{
+			Name:      "migrate",
+			Namespace: "db",
+			Mapping:   &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}},
+		},
+	})
+
+	newEvent := func(uid, namespace, kind, name, reason string) *v1.Event {
+		return &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{UID: types.UID(uid)},
+			InvolvedObject: v1.ObjectReference{Kind: kind, Namespace: namespace, Name: name},
+			Type:           v1.EventTypeWarning,
+			Reason:         reason,
+			Message:        reason + " message",
+		}
+	}
+
+	ctx := context.Background()
+	w.handleEvent(ctx, newEvent("1", "app", "Deployment", "app", "ProgressDeadlineExceeded"))
+	w.handleEvent(ctx, newEvent("2", "db", "Pod", "migrate-x2x9k", "BackOff"))
+	w.handleEvent(ctx, newEvent("3", "db", "Deployment", "app", "ProgressDeadlineExceeded"))
+
+	expect := []string{
+		"app/Deployment/app: ProgressDeadlineExceeded: ProgressDeadlineExceeded message",
+		"db/Pod/migrate-x2x9k: BackOff: BackOff message",
+	}
+	got := w.Warnings()
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("expected warnings %q, got %q", expect, got)
+	}
+}
@@ -27,7 +27,7 @@ func (c *Client) DeleteNamespace(ctx context.Context, namespace string, opts Del
 		specs := []*ResourcesWaiterDeleteResourceSpec{
 			{ResourceName: namespace, Namespace: "", GroupVersionResource: corev1.SchemeGroupVersion.WithResource("namespaces")},
 		}
-		if err := c.ResourcesWaiter.WaitUntilDeleted(context.Background(), specs, opts.WaitTimeout); err != nil {
+		if err := c.ResourcesWaiter.WaitUntilDeleted(ctx, specs, opts.WaitTimeout); err != nil {
 			return fmt.Errorf("waiting until namespace deleted failed: %s", err)
 		}
 	}
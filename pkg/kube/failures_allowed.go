@@ -0,0 +1,90 @@
+package kube
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// The annotations of the number of the failures of the Pods of a resource,
+// e.g. the restarts of their containers, tolerated while it is tracked.
+const (
+	// FailuresAllowedPerReplicaAnnotation is the number of the failures
+	// tolerated per replica of the resource, DefaultFailuresAllowedPerReplica
+	// if not set.
+	FailuresAllowedPerReplicaAnnotation = "werf.io/failures-allowed-per-replica"
+	// FailuresAllowedAnnotation is the number of the failures tolerated for
+	// the whole resource, whatever its replicas, e.g. for the workloads scaled
+	// by a HorizontalPodAutoscaler, whose replicas in the manifest are not the
+	// live ones. It takes precedence over FailuresAllowedPerReplicaAnnotation.
+	FailuresAllowedAnnotation = "werf.io/failures-allowed"
+)
+
+const DefaultFailuresAllowedPerReplica = 1
+
+// ParseFailuresAllowed parses the value of FailuresAllowedAnnotation or
+// FailuresAllowedPerReplicaAnnotation.
+func ParseFailuresAllowed(value string) (int, error) {
+	failures, err := strconv.Atoi(value)
+	if err != nil || failures < 0 {
+		return 0, errors.Errorf("invalid value %q: expected a non-negative integer", value)
+	}
+
+	return failures, nil
+}
+
+// FailuresAllowed returns the number of the failures of the Pods of the
+// resource tolerated while it is tracked: the FailuresAllowedAnnotation if it
+// is set, otherwise the FailuresAllowedPerReplicaAnnotation, or its default,
+// multiplied by the replicas of the resource.
+func FailuresAllowed(v *resource.Info) (int, error) {
+	annotations, err := metadataAccessor.Annotations(v.Object)
+	if err != nil {
+		return 0, err
+	}
+
+	if value, found := annotations[FailuresAllowedAnnotation]; found {
+		failures, err := ParseFailuresAllowed(value)
+		if err != nil {
+			return 0, errors.Wrapf(err, "annotation %s of %s", FailuresAllowedAnnotation, ResourceNameNamespaceKind(v))
+		}
+
+		return failures, nil
+	}
+
+	perReplica := DefaultFailuresAllowedPerReplica
+	if value, found := annotations[FailuresAllowedPerReplicaAnnotation]; found {
+		if perReplica, err = ParseFailuresAllowed(value); err != nil {
+			return 0, errors.Wrapf(err, "annotation %s of %s", FailuresAllowedPerReplicaAnnotation, ResourceNameNamespaceKind(v))
+		}
+	}
+
+	replicas, err := replicasOf(v.Object)
+	if err != nil {
+		return 0, err
+	}
+
+	return perReplica * replicas, nil
+}
+
+// replicasOf returns the spec.replicas of the object, 1 if it has none.
+func replicasOf(obj runtime.Object) (int, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return 0, err
+		}
+		u = &unstructured.Unstructured{Object: content}
+	}
+
+	replicas, found, err := unstructured.NestedInt64(u.Object, "spec", "replicas")
+	if err != nil || !found {
+		return 1, nil
+	}
+
+	return int(replicas), nil
+}
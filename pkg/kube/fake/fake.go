@@ -18,6 +18,7 @@ limitations under the License.
 package fake
 
 import (
+	"context"
 	"io"
 	"time"
 
@@ -47,6 +48,16 @@ type FailingKubeClient struct {
 	BuildUnstructuredError           error
 	WaitAndGetCompletedPodPhaseError error
 	WaitDuration                     time.Duration
+
+	ctx context.Context
+}
+
+// WithContext returns a copy of the client whose waits are interrupted when
+// ctx is done.
+func (f *FailingKubeClient) WithContext(ctx context.Context) kube.Interface {
+	c := *f
+	c.ctx = ctx
+	return &c
 }
 
 // Create returns the configured error if set or prints
@@ -66,8 +77,17 @@ func (f *FailingKubeClient) Get(resources kube.ResourceList, related bool) (map[
 }
 
 // Waits the amount of time defined on f.WaitDuration, then returns the configured error if set or prints.
+// The wait is interrupted with the error of the context of the client when it is done.
 func (f *FailingKubeClient) Wait(resources kube.ResourceList, d time.Duration) error {
-	time.Sleep(f.WaitDuration)
+	if f.ctx != nil {
+		select {
+		case <-f.ctx.Done():
+			return f.ctx.Err()
+		case <-time.After(f.WaitDuration):
+		}
+	} else {
+		time.Sleep(f.WaitDuration)
+	}
 	if f.WaitError != nil {
 		return f.WaitError
 	}
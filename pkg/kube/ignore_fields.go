@@ -0,0 +1,202 @@
+package kube
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// IgnoreFieldsAnnotation holds comma-separated JSONPaths of the fields of the
+// resource that are not compared with the live object when the resource is
+// updated, e.g. "{.spec.replicas}" managed by a HorizontalPodAutoscaler or
+// ".spec.template.spec.containers[1]" injected by a webhook. The fields are
+// still set when the resource is created. Supported are field names, list
+// indexes, "[*]" for every list item and "['key.with.dots']" for map keys.
+const IgnoreFieldsAnnotation = "werf.io/ignore-fields"
+
+// FieldPath is a parsed JSONPath of IgnoreFieldsAnnotation.
+type FieldPath struct {
+	expression string
+	segments   []fieldPathSegment
+}
+
+type fieldPathSegment struct {
+	// key is set for map keys.
+	key string
+	// index is set for list indexes, -1 for every item.
+	index *int
+}
+
+func (p FieldPath) String() string {
+	return p.expression
+}
+
+// ParseIgnoreFields parses the value of IgnoreFieldsAnnotation.
+func ParseIgnoreFields(value string) ([]FieldPath, error) {
+	var result []FieldPath
+	for _, expression := range strings.Split(value, ",") {
+		expression = strings.TrimSpace(expression)
+		if expression == "" {
+			continue
+		}
+
+		path, err := parseFieldPath(expression)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid field path %q", expression)
+		}
+		result = append(result, path)
+	}
+
+	return result, nil
+}
+
+func parseFieldPath(expression string) (FieldPath, error) {
+	path := FieldPath{expression: expression}
+
+	s := expression
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	s = strings.TrimPrefix(s, "$")
+
+	for s != "" {
+		switch s[0] {
+		case '.':
+			end := strings.IndexAny(s[1:], ".[")
+			if end == -1 {
+				end = len(s) - 1
+			}
+			key := s[1 : end+1]
+			if key == "" {
+				return FieldPath{}, errors.New("empty field name")
+			}
+			path.segments = append(path.segments, fieldPathSegment{key: key})
+			s = s[end+1:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end == -1 {
+				return FieldPath{}, errors.New("unclosed \"[\"")
+			}
+			inner := s[1:end]
+			s = s[end+1:]
+
+			switch {
+			case inner == "*":
+				all := -1
+				path.segments = append(path.segments, fieldPathSegment{index: &all})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				path.segments = append(path.segments, fieldPathSegment{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return FieldPath{}, errors.Errorf("unsupported subscript %q: expected a list index, \"*\" or a quoted key", inner)
+				}
+				path.segments = append(path.segments, fieldPathSegment{index: &index})
+			}
+		default:
+			if len(path.segments) > 0 {
+				return FieldPath{}, errors.Errorf("unexpected %q", s)
+			}
+			// The leading dot is optional.
+			s = "." + s
+		}
+	}
+
+	if len(path.segments) == 0 {
+		return FieldPath{}, errors.New("empty path")
+	}
+
+	return path, nil
+}
+
+// ignoredFieldsOf returns the fields of the object to ignore when comparing it
+// with the live object.
+func ignoredFieldsOf(obj runtime.Object) ([]FieldPath, error) {
+	annotations, err := metadataAccessor.Annotations(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	value, found := annotations[IgnoreFieldsAnnotation]
+	if !found {
+		return nil, nil
+	}
+
+	paths, err := ParseIgnoreFields(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "annotation %s", IgnoreFieldsAnnotation)
+	}
+
+	return paths, nil
+}
+
+// removeIgnoredFields removes the fields from the JSON of an object. Paths
+// which match nothing are skipped.
+func removeIgnoredFields(data []byte, paths []FieldPath) ([]byte, error) {
+	if len(paths) == 0 {
+		return data, nil
+	}
+
+	var obj interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return data, nil
+	}
+
+	for _, path := range paths {
+		obj = removeFieldPath(obj, path.segments)
+	}
+
+	return json.Marshal(obj)
+}
+
+// removeFieldPath returns the node without the field. Lists are returned
+// without the removed items.
+func removeFieldPath(node interface{}, segments []fieldPathSegment) interface{} {
+	seg := segments[0]
+	last := len(segments) == 1
+
+	switch value := node.(type) {
+	case map[string]interface{}:
+		if seg.index != nil {
+			return node
+		}
+		child, found := value[seg.key]
+		if !found {
+			return node
+		}
+		if last {
+			delete(value, seg.key)
+		} else {
+			value[seg.key] = removeFieldPath(child, segments[1:])
+		}
+	case []interface{}:
+		if seg.index == nil {
+			return node
+		}
+		if *seg.index == -1 {
+			if last {
+				return []interface{}{}
+			}
+			for i := range value {
+				value[i] = removeFieldPath(value[i], segments[1:])
+			}
+			return value
+		}
+		i := *seg.index
+		if i >= len(value) {
+			return node
+		}
+		if last {
+			return append(value[:i:i], value[i+1:]...)
+		}
+		value[i] = removeFieldPath(value[i], segments[1:])
+	}
+
+	return node
+}
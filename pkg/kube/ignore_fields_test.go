@@ -0,0 +1,69 @@
+package kube
+
+import (
+	"testing"
+)
+
+func TestParseIgnoreFields(t *testing.T) {
+	paths, err := ParseIgnoreFields("{.spec.replicas}, .spec.template.spec.containers[1] ,metadata.annotations['example.com/revision'],$.spec.ports[*].nodePort")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"{.spec.replicas}",
+		".spec.template.spec.containers[1]",
+		"metadata.annotations['example.com/revision']",
+		"$.spec.ports[*].nodePort",
+	}
+	if len(paths) != len(expect) {
+		t.Fatalf("expected %d paths, got %d", len(expect), len(paths))
+	}
+	for i, path := range paths {
+		if path.String() != expect[i] {
+			t.Errorf("expected %q, got %q", expect[i], path)
+		}
+	}
+
+	for _, value := range []string{
+		".spec..replicas",
+		".spec.containers[",
+		".spec.containers[-1]",
+		".spec.containers[?(@.name==\"app\")]",
+		"{}",
+	} {
+		if _, err := ParseIgnoreFields(value); err == nil {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestRemoveIgnoredFields(t *testing.T) {
+	data := []byte(`{
+		"metadata": {"name": "app", "annotations": {"example.com/revision": "3", "team": "a"}},
+		"spec": {
+			"replicas": 3,
+			"ports": [{"port": 80, "nodePort": 30080}, {"port": 443, "nodePort": 30443}],
+			"template": {"spec": {"containers": [{"name": "app"}, {"name": "sidecar"}, {"name": "debug"}]}}
+		}
+	}`)
+
+	paths, err := ParseIgnoreFields("{.spec.replicas}, .spec.template.spec.containers[1], metadata.annotations['example.com/revision'], .spec.ports[*].nodePort, .status.missing, .spec.template.spec.containers[5]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := removeIgnoredFields(data, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `{"metadata":{"annotations":{"team":"a"},"name":"app"},"spec":{"ports":[{"port":80},{"port":443}],"template":{"spec":{"containers":[{"name":"app"},{"name":"debug"}]}}}}`
+	if string(got) != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, got)
+	}
+
+	if got, err := removeIgnoredFields([]byte("null"), paths); err != nil || string(got) != "null" {
+		t.Errorf("expected null to be kept, got %q, %v", got, err)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
 )
 
 // Interface represents a client capable of communicating with the Kubernetes API.
@@ -112,10 +113,83 @@ type InterfaceResources interface {
 	BuildTable(reader io.Reader, validate bool) (ResourceList, error)
 }
 
+// InterfaceWaitOwned is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceWaitOwned interface {
+	// WaitWithOwned waits up to the given timeout for the specified resources to be ready, including
+	// the resources they own, such as the workloads created by operators for custom resources.
+	// Jobs are checked if waitForJobs is true.
+	WaitWithOwned(resources ResourceList, waitForJobs bool, timeout time.Duration) error
+}
+
+// InterfaceCapture is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceCapture interface {
+	// Capture returns the live objects of the given kinds matching the label selector, along with the
+	// objects referenced explicitly as "<kind>/<name>", normalized so that they can be used as manifests.
+	Capture(kinds []string, selector string, names []string) (ResourceList, error)
+}
+
+// InterfaceWaitSelected is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceWaitSelected interface {
+	// WaitForSelected waits up to the given timeout for at least minReady resources of the type of the given
+	// resource, matching the label selector in its namespace, to be ready. Jobs are checked if waitForJobs is true.
+	WaitForSelected(kind *resource.Info, selector string, minReady int, waitForJobs bool, timeout time.Duration) error
+}
+
+// InterfaceWaitCondition is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceWaitCondition interface {
+	// WaitForCondition waits up to the given timeout for each of the resources to have the condition in its
+	// status.conditions, whatever the readiness of the resources.
+	WaitForCondition(resources ResourceList, cond *ResourceCondition, timeout time.Duration) error
+}
+
+// InterfaceContext is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceContext interface {
+	// WithContext returns a copy of the client whose operations are cancelled when ctx is done and are limited by
+	// its deadline, in addition to their own timeouts.
+	WithContext(ctx context.Context) Interface
+}
+
+// InterfaceLogsOptions is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceLogsOptions interface {
+	// WithLogsOptions returns a copy of the client whose waits show the logs of the containers of the tracked
+	// resources with the options.
+	WithLogsOptions(opts LogsOptions) Interface
+}
+
+// InterfaceVerifyCronJobs is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceVerifyCronJobs interface {
+	// VerifyCronJobs creates, in the dry-run mode, a Job from the job template of every CronJob among the
+	// resources, to catch the Jobs which would be rejected on the next scheduled run of the CronJobs.
+	VerifyCronJobs(resources ResourceList) error
+}
+
+// InterfaceCRDStoredVersions is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceCRDStoredVersions interface {
+	// CheckCRDStoredVersions fails if updating a CustomResourceDefinition among the resources would remove a version
+	// still listed in its status.storedVersions. If migrate is true, the stored objects are migrated instead.
+	CheckCRDStoredVersions(resources ResourceList, migrate bool) error
+}
+
+// InterfaceReadinessEngine is introduced to avoid breaking backwards compatibility for Interface implementers.
+type InterfaceReadinessEngine interface {
+	// DefaultReadinessEngine returns the engine the readiness of the resources is checked with when waiting for
+	// them, unless overridden per resource with ReadinessEngineAnnotation.
+	DefaultReadinessEngine() ReadinessEngine
+}
+
 var _ Interface = (*Client)(nil)
 var _ InterfaceExt = (*Client)(nil)
 var _ InterfaceDeletionPropagation = (*Client)(nil)
 var _ InterfaceResources = (*Client)(nil)
+var _ InterfaceWaitOwned = (*Client)(nil)
+var _ InterfaceCapture = (*Client)(nil)
+var _ InterfaceWaitSelected = (*Client)(nil)
+var _ InterfaceWaitCondition = (*Client)(nil)
+var _ InterfaceContext = (*Client)(nil)
+var _ InterfaceLogsOptions = (*Client)(nil)
+var _ InterfaceVerifyCronJobs = (*Client)(nil)
+var _ InterfaceCRDStoredVersions = (*Client)(nil)
+var _ InterfaceReadinessEngine = (*Client)(nil)
 
 type CreateOptions struct {
 	SkipIfAlreadyExists bool
@@ -0,0 +1,415 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// ReadinessEngineAnnotation forces the ReadinessEngine the readiness of the
+// resource is checked with, overriding Client.ReadinessEngine.
+const ReadinessEngineAnnotation = "werf.io/readiness-engine"
+
+// ReadinessEngine is how the readiness of a resource is checked.
+type ReadinessEngine string
+
+const (
+	// ReadinessEngineBuiltin checks the readiness with the built-in checks of
+	// the kinds of the resources, see ReadyChecker.IsReady. It is the
+	// default.
+	ReadinessEngineBuiltin ReadinessEngine = "builtin"
+	// ReadinessEngineKStatus checks the readiness with the conventions of
+	// kstatus, the status library of sig-cli, see ComputeKStatus. A resource
+	// is ready once it is Current and fails the wait once it is Failed.
+	ReadinessEngineKStatus ReadinessEngine = "kstatus"
+)
+
+// ParseReadinessEngine parses a ReadinessEngine, ReadinessEngineBuiltin if
+// empty.
+func ParseReadinessEngine(value string) (ReadinessEngine, error) {
+	switch engine := ReadinessEngine(strings.TrimSpace(value)); engine {
+	case "":
+		return ReadinessEngineBuiltin, nil
+	case ReadinessEngineBuiltin, ReadinessEngineKStatus:
+		return engine, nil
+	default:
+		return "", errors.Errorf("unknown readiness engine %q: expected %q or %q", value, ReadinessEngineBuiltin, ReadinessEngineKStatus)
+	}
+}
+
+// readinessEngineOf returns the engine of ReadinessEngineAnnotation of the
+// object, or the given default one.
+func readinessEngineOf(obj runtime.Object, defaultEngine ReadinessEngine) (ReadinessEngine, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+
+	value, found := accessor.GetAnnotations()[ReadinessEngineAnnotation]
+	if !found {
+		return ParseReadinessEngine(string(defaultEngine))
+	}
+
+	engine, err := ParseReadinessEngine(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid annotation %s", ReadinessEngineAnnotation)
+	}
+
+	return engine, nil
+}
+
+// DefaultReadinessEngine returns a ReadyCheckerOption that configures a
+// ReadyChecker to check the readiness of the resources with the engine, unless
+// they are annotated with ReadinessEngineAnnotation.
+func DefaultReadinessEngine(engine ReadinessEngine) ReadyCheckerOption {
+	return func(c *ReadyChecker) {
+		c.readinessEngine = engine
+	}
+}
+
+// kstatusReady gets the live object of the resource and computes its kstatus.
+// A Failed resource fails the wait.
+func kstatusReady(v *resource.Info) (bool, error) {
+	live, err := resource.NewHelper(v.Client, v.Mapping).Get(v.Namespace, v.Name)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to convert %s", ResourceNameNamespaceKind(v))
+	}
+
+	result, err := ComputeKStatus(&unstructured.Unstructured{Object: content})
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to compute the status of %s", ResourceNameNamespaceKind(v))
+	}
+
+	switch result.Status {
+	case KStatusCurrent:
+		return true, nil
+	case KStatusFailed:
+		return false, errors.Errorf("%s has failed: %s", ResourceNameNamespaceKind(v), result.Message)
+	default:
+		return false, nil
+	}
+}
+
+// KStatus is the status of a resource computed with the conventions of
+// kstatus.
+type KStatus string
+
+const (
+	KStatusInProgress  KStatus = "InProgress"
+	KStatusFailed      KStatus = "Failed"
+	KStatusCurrent     KStatus = "Current"
+	KStatusTerminating KStatus = "Terminating"
+)
+
+// KStatusResult is the status of a resource along with the reason of it.
+type KStatusResult struct {
+	Status  KStatus
+	Message string
+}
+
+// ComputeKStatus computes the status of the live object the way kstatus does:
+// from the observed generation and the standard Reconciling and Stalled
+// conditions of any kind, and from the status fields of the well-known kinds.
+// The objects of the other kinds are Current unless their conditions say
+// otherwise.
+func ComputeKStatus(obj *unstructured.Unstructured) (*KStatusResult, error) {
+	if obj.GetDeletionTimestamp() != nil {
+		return &KStatusResult{Status: KStatusTerminating, Message: "resource is being deleted"}, nil
+	}
+
+	observedGeneration, found, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if err != nil {
+		return nil, err
+	}
+	if found && observedGeneration != obj.GetGeneration() {
+		return kstatusInProgress("generation %d is not observed yet, observed %d", obj.GetGeneration(), observedGeneration), nil
+	}
+
+	if cond := kstatusCondition(obj, "Stalled"); cond != nil && cond.status == "True" {
+		return &KStatusResult{Status: KStatusFailed, Message: cond.describe()}, nil
+	}
+	if cond := kstatusCondition(obj, "Reconciling"); cond != nil && cond.status == "True" {
+		return &KStatusResult{Status: KStatusInProgress, Message: cond.describe()}, nil
+	}
+
+	gk := obj.GroupVersionKind().GroupKind()
+	switch gk.String() {
+	case "Deployment.apps", "Deployment.extensions":
+		return deploymentKStatus(obj), nil
+	case "StatefulSet.apps":
+		return statefulSetKStatus(obj), nil
+	case "DaemonSet.apps", "DaemonSet.extensions":
+		return daemonSetKStatus(obj, found), nil
+	case "ReplicaSet.apps", "ReplicaSet.extensions":
+		return replicaSetKStatus(obj), nil
+	case "PodDisruptionBudget.policy":
+		return podDisruptionBudgetKStatus(obj, found), nil
+	case "Job.batch":
+		return jobKStatus(obj), nil
+	case "Pod":
+		return podKStatus(obj), nil
+	case "PersistentVolumeClaim":
+		return persistentVolumeClaimKStatus(obj), nil
+	case "Service":
+		return serviceKStatus(obj), nil
+	case "CustomResourceDefinition.apiextensions.k8s.io":
+		return customResourceDefinitionKStatus(obj), nil
+	}
+
+	return kstatusCurrent("resource is current"), nil
+}
+
+func kstatusInProgress(format string, args ...interface{}) *KStatusResult {
+	return &KStatusResult{Status: KStatusInProgress, Message: fmt.Sprintf(format, args...)}
+}
+
+func kstatusCurrent(format string, args ...interface{}) *KStatusResult {
+	return &KStatusResult{Status: KStatusCurrent, Message: fmt.Sprintf(format, args...)}
+}
+
+type kstatusConditionValue struct {
+	condType string
+	status   string
+	reason   string
+	message  string
+}
+
+func (c *kstatusConditionValue) describe() string {
+	if c.message != "" {
+		return fmt.Sprintf("condition %s is %s: %s", c.condType, c.status, c.message)
+	}
+	if c.reason != "" {
+		return fmt.Sprintf("condition %s is %s: %s", c.condType, c.status, c.reason)
+	}
+
+	return fmt.Sprintf("condition %s is %s", c.condType, c.status)
+}
+
+// kstatusCondition returns the condition of the type from status.conditions,
+// or nil if there is none.
+func kstatusCondition(obj *unstructured.Unstructured, condType string) *kstatusConditionValue {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, _, _ := unstructured.NestedString(cond, "type"); t != condType {
+			continue
+		}
+
+		value := &kstatusConditionValue{condType: condType}
+		value.status, _, _ = unstructured.NestedString(cond, "status")
+		value.reason, _, _ = unstructured.NestedString(cond, "reason")
+		value.message, _, _ = unstructured.NestedString(cond, "message")
+		return value
+	}
+
+	return nil
+}
+
+// kstatusInt returns the integer field, or def if it is not set.
+func kstatusInt(obj *unstructured.Unstructured, def int64, fields ...string) int64 {
+	value, found, err := unstructured.NestedInt64(obj.Object, fields...)
+	if err != nil || !found {
+		return def
+	}
+
+	return value
+}
+
+func deploymentKStatus(obj *unstructured.Unstructured) *KStatusResult {
+	if cond := kstatusCondition(obj, "Progressing"); cond != nil && cond.reason == "ProgressDeadlineExceeded" {
+		return &KStatusResult{Status: KStatusFailed, Message: cond.describe()}
+	}
+
+	replicas := kstatusInt(obj, 1, "spec", "replicas")
+	statusReplicas := kstatusInt(obj, 0, "status", "replicas")
+	updated := kstatusInt(obj, 0, "status", "updatedReplicas")
+	ready := kstatusInt(obj, 0, "status", "readyReplicas")
+	available := kstatusInt(obj, 0, "status", "availableReplicas")
+
+	switch {
+	case updated < replicas:
+		return kstatusInProgress("%d of %d replicas are updated", updated, replicas)
+	case statusReplicas > updated:
+		return kstatusInProgress("%d old replicas are pending termination", statusReplicas-updated)
+	case available < updated:
+		return kstatusInProgress("%d of %d updated replicas are available", available, updated)
+	case ready < replicas:
+		return kstatusInProgress("%d of %d replicas are ready", ready, replicas)
+	}
+
+	if cond := kstatusCondition(obj, "Available"); cond != nil && cond.status != "True" {
+		return kstatusInProgress("%s", cond.describe())
+	}
+
+	return kstatusCurrent("deployment is available, replicas: %d", replicas)
+}
+
+func statefulSetKStatus(obj *unstructured.Unstructured) *KStatusResult {
+	if strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type"); strategy == "OnDelete" {
+		return kstatusCurrent("statefulset is updated on delete")
+	}
+
+	replicas := kstatusInt(obj, 1, "spec", "replicas")
+	partition := kstatusInt(obj, 0, "spec", "updateStrategy", "rollingUpdate", "partition")
+	statusReplicas := kstatusInt(obj, 0, "status", "replicas")
+	ready := kstatusInt(obj, 0, "status", "readyReplicas")
+	updated := kstatusInt(obj, 0, "status", "updatedReplicas")
+	currentRevision, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	updateRevision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+
+	switch {
+	case statusReplicas < replicas:
+		return kstatusInProgress("%d of %d replicas are created", statusReplicas, replicas)
+	case ready < replicas:
+		return kstatusInProgress("%d of %d replicas are ready", ready, replicas)
+	case partition > 0 && updated < replicas-partition:
+		return kstatusInProgress("%d of %d replicas above the partition are updated", updated, replicas-partition)
+	case partition == 0 && currentRevision != updateRevision:
+		return kstatusInProgress("%d of %d replicas are updated to revision %s", updated, replicas, updateRevision)
+	}
+
+	return kstatusCurrent("all %d replicas are ready", replicas)
+}
+
+func daemonSetKStatus(obj *unstructured.Unstructured, observed bool) *KStatusResult {
+	if !observed {
+		return kstatusInProgress("daemonset is not observed yet")
+	}
+
+	desired := kstatusInt(obj, 0, "status", "desiredNumberScheduled")
+	scheduled := kstatusInt(obj, 0, "status", "currentNumberScheduled")
+	updated := kstatusInt(obj, 0, "status", "updatedNumberScheduled")
+	available := kstatusInt(obj, 0, "status", "numberAvailable")
+	ready := kstatusInt(obj, 0, "status", "numberReady")
+
+	switch {
+	case scheduled < desired:
+		return kstatusInProgress("%d of %d pods are scheduled", scheduled, desired)
+	case updated < desired:
+		return kstatusInProgress("%d of %d pods are updated", updated, desired)
+	case available < desired:
+		return kstatusInProgress("%d of %d pods are available", available, desired)
+	case ready < desired:
+		return kstatusInProgress("%d of %d pods are ready", ready, desired)
+	}
+
+	return kstatusCurrent("all %d pods are ready", desired)
+}
+
+func replicaSetKStatus(obj *unstructured.Unstructured) *KStatusResult {
+	if cond := kstatusCondition(obj, "ReplicaFailure"); cond != nil && cond.status == "True" {
+		return kstatusInProgress("%s", cond.describe())
+	}
+
+	replicas := kstatusInt(obj, 1, "spec", "replicas")
+	labeled := kstatusInt(obj, 0, "status", "fullyLabeledReplicas")
+	available := kstatusInt(obj, 0, "status", "availableReplicas")
+	ready := kstatusInt(obj, 0, "status", "readyReplicas")
+
+	switch {
+	case labeled < replicas:
+		return kstatusInProgress("%d of %d replicas are labeled", labeled, replicas)
+	case available < replicas:
+		return kstatusInProgress("%d of %d replicas are available", available, replicas)
+	case ready < replicas:
+		return kstatusInProgress("%d of %d replicas are ready", ready, replicas)
+	}
+
+	return kstatusCurrent("all %d replicas are ready", replicas)
+}
+
+func podDisruptionBudgetKStatus(obj *unstructured.Unstructured, observed bool) *KStatusResult {
+	if !observed {
+		return kstatusInProgress("poddisruptionbudget is not observed yet")
+	}
+
+	healthy := kstatusInt(obj, 0, "status", "currentHealthy")
+	desired := kstatusInt(obj, 0, "status", "desiredHealthy")
+	if healthy < desired {
+		return kstatusInProgress("%d of %d desired pods are healthy", healthy, desired)
+	}
+
+	return kstatusCurrent("budget is met, %d pods are healthy", healthy)
+}
+
+func jobKStatus(obj *unstructured.Unstructured) *KStatusResult {
+	if cond := kstatusCondition(obj, "Failed"); cond != nil && cond.status == "True" {
+		return &KStatusResult{Status: KStatusFailed, Message: cond.describe()}
+	}
+	if cond := kstatusCondition(obj, "Complete"); cond != nil && cond.status == "True" {
+		return kstatusCurrent("job is complete")
+	}
+	if startTime, _, _ := unstructured.NestedString(obj.Object, "status", "startTime"); startTime == "" {
+		return kstatusInProgress("job is not started yet")
+	}
+	if required, err := completionsRequiredOf(obj); err == nil && required != 0 {
+		if succeeded := kstatusInt(obj, 0, "status", "succeeded"); succeeded < int64(required) {
+			return kstatusInProgress("%d of %d required completions succeeded", succeeded, required)
+		}
+		return kstatusCurrent("%d required completions succeeded", required)
+	}
+
+	// kstatus considers a started Job current, it doesn't wait for the Job
+	// to complete.
+	return kstatusCurrent("job is in progress, active: %d, succeeded: %d, failed: %d",
+		kstatusInt(obj, 0, "status", "active"), kstatusInt(obj, 0, "status", "succeeded"), kstatusInt(obj, 0, "status", "failed"))
+}
+
+func podKStatus(obj *unstructured.Unstructured) *KStatusResult {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return kstatusCurrent("pod has succeeded")
+	case "Failed":
+		return &KStatusResult{Status: KStatusFailed, Message: "pod has failed"}
+	case "Running":
+		if cond := kstatusCondition(obj, "Ready"); cond != nil && cond.status == "True" {
+			return kstatusCurrent("pod is running and ready")
+		}
+		return kstatusInProgress("pod is running but not ready")
+	}
+
+	return kstatusInProgress("pod is in phase %q", phase)
+}
+
+func persistentVolumeClaimKStatus(obj *unstructured.Unstructured) *KStatusResult {
+	if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); phase != "Bound" {
+		return kstatusInProgress("persistentvolumeclaim is in phase %q", phase)
+	}
+
+	return kstatusCurrent("persistentvolumeclaim is bound")
+}
+
+func serviceKStatus(obj *unstructured.Unstructured) *KStatusResult {
+	if serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type"); serviceType == "LoadBalancer" {
+		if ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress"); len(ingress) == 0 {
+			return kstatusInProgress("load balancer is not provisioned yet")
+		}
+	}
+
+	return kstatusCurrent("service is ready")
+}
+
+func customResourceDefinitionKStatus(obj *unstructured.Unstructured) *KStatusResult {
+	if cond := kstatusCondition(obj, "NamesAccepted"); cond != nil && cond.status == "False" {
+		return &KStatusResult{Status: KStatusFailed, Message: cond.describe()}
+	}
+	if cond := kstatusCondition(obj, "Established"); cond == nil || cond.status != "True" {
+		return kstatusInProgress("customresourcedefinition is not established yet")
+	}
+
+	return kstatusCurrent("customresourcedefinition is established")
+}
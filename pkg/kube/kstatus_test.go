@@ -0,0 +1,151 @@
+package kube
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestComputeKStatus(t *testing.T) {
+	object := func(apiVersion, kind string, generation int64, spec, status map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "foo", "namespace": "bar", "generation": generation},
+			"spec":       spec,
+			"status":     status,
+		}}
+	}
+	condition := func(condType, status, reason string) map[string]interface{} {
+		return map[string]interface{}{"type": condType, "status": status, "reason": reason}
+	}
+	annotated := func(obj *unstructured.Unstructured, annotations map[string]string) *unstructured.Unstructured {
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+
+	tests := []struct {
+		name string
+		obj  *unstructured.Unstructured
+		want KStatus
+	}{
+		{
+			name: "deployment rolled out",
+			obj: object("apps/v1", "Deployment", 2, map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{
+				"observedGeneration": int64(2), "replicas": int64(2), "updatedReplicas": int64(2), "readyReplicas": int64(2), "availableReplicas": int64(2),
+				"conditions": []interface{}{condition("Available", "True", "MinimumReplicasAvailable")},
+			}),
+			want: KStatusCurrent,
+		},
+		{
+			name: "deployment generation not observed",
+			obj: object("apps/v1", "Deployment", 3, map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{
+				"observedGeneration": int64(2), "replicas": int64(2), "updatedReplicas": int64(2), "readyReplicas": int64(2), "availableReplicas": int64(2),
+			}),
+			want: KStatusInProgress,
+		},
+		{
+			name: "deployment with old replicas",
+			obj: object("apps/v1", "Deployment", 2, map[string]interface{}{"replicas": int64(2)}, map[string]interface{}{
+				"observedGeneration": int64(2), "replicas": int64(3), "updatedReplicas": int64(2), "readyReplicas": int64(3), "availableReplicas": int64(3),
+			}),
+			want: KStatusInProgress,
+		},
+		{
+			name: "deployment progress deadline exceeded",
+			obj: object("apps/v1", "Deployment", 1, map[string]interface{}{}, map[string]interface{}{
+				"observedGeneration": int64(1),
+				"conditions":         []interface{}{condition("Progressing", "False", "ProgressDeadlineExceeded")},
+			}),
+			want: KStatusFailed,
+		},
+		{
+			name: "job completed",
+			obj: object("batch/v1", "Job", 1, map[string]interface{}{}, map[string]interface{}{
+				"startTime":  "2024-01-01T00:00:00Z",
+				"conditions": []interface{}{condition("Complete", "True", "")},
+			}),
+			want: KStatusCurrent,
+		},
+		{
+			name: "job not started",
+			obj:  object("batch/v1", "Job", 1, map[string]interface{}{}, map[string]interface{}{}),
+			want: KStatusInProgress,
+		},
+		{
+			name: "job failed",
+			obj: object("batch/v1", "Job", 1, map[string]interface{}{}, map[string]interface{}{
+				"startTime":  "2024-01-01T00:00:00Z",
+				"conditions": []interface{}{condition("Failed", "True", "BackoffLimitExceeded")},
+			}),
+			want: KStatusFailed,
+		},
+		{
+			name: "job short of required completions",
+			obj: annotated(object("batch/v1", "Job", 1, map[string]interface{}{"completions": int64(5)}, map[string]interface{}{
+				"startTime": "2024-01-01T00:00:00Z", "succeeded": int64(1),
+			}), map[string]string{TrackCompletionsRequiredAnnotation: "2"}),
+			want: KStatusInProgress,
+		},
+		{
+			name: "job with required completions succeeded",
+			obj: annotated(object("batch/v1", "Job", 1, map[string]interface{}{"completions": int64(5)}, map[string]interface{}{
+				"startTime": "2024-01-01T00:00:00Z", "succeeded": int64(2),
+			}), map[string]string{TrackCompletionsRequiredAnnotation: "2"}),
+			want: KStatusCurrent,
+		},
+		{
+			name: "pending persistent volume claim",
+			obj:  object("v1", "PersistentVolumeClaim", 1, map[string]interface{}{}, map[string]interface{}{"phase": "Pending"}),
+			want: KStatusInProgress,
+		},
+		{
+			name: "load balancer without ingress",
+			obj:  object("v1", "Service", 1, map[string]interface{}{"type": "LoadBalancer"}, map[string]interface{}{}),
+			want: KStatusInProgress,
+		},
+		{
+			name: "custom resource reconciling",
+			obj: object("example.com/v1", "Database", 1, map[string]interface{}{}, map[string]interface{}{
+				"conditions": []interface{}{condition("Reconciling", "True", "Provisioning")},
+			}),
+			want: KStatusInProgress,
+		},
+		{
+			name: "custom resource stalled",
+			obj: object("example.com/v1", "Database", 1, map[string]interface{}{}, map[string]interface{}{
+				"conditions": []interface{}{condition("Stalled", "True", "InvalidSpec")},
+			}),
+			want: KStatusFailed,
+		},
+		{
+			name: "custom resource without conditions",
+			obj:  object("example.com/v1", "Database", 1, map[string]interface{}{}, map[string]interface{}{}),
+			want: KStatusCurrent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComputeKStatus(tt.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.want {
+				t.Errorf("expected %s, got %s: %s", tt.want, got.Status, got.Message)
+			}
+		})
+	}
+}
+
+func TestParseReadinessEngine(t *testing.T) {
+	if engine, err := ParseReadinessEngine(""); err != nil || engine != ReadinessEngineBuiltin {
+		t.Errorf("expected the builtin engine by default, got %q, %v", engine, err)
+	}
+	if engine, err := ParseReadinessEngine("kstatus"); err != nil || engine != ReadinessEngineKStatus {
+		t.Errorf("expected the kstatus engine, got %q, %v", engine, err)
+	}
+	if _, err := ParseReadinessEngine("kubedog"); err == nil {
+		t.Error("expected an unknown engine to fail")
+	}
+}
@@ -0,0 +1,152 @@
+package kube
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// ShowLogsUntilAnnotation sets until when the logs of the containers of the
+// resource are shown while it is tracked.
+const ShowLogsUntilAnnotation = "werf.io/show-logs-until"
+
+// ShowLogsUntil is the value of ShowLogsUntilAnnotation.
+type ShowLogsUntil string
+
+const (
+	// ShowLogsUntilPodIsReady stops showing the logs of the containers of a
+	// Pod once the Pod is ready.
+	ShowLogsUntilPodIsReady ShowLogsUntil = "PodIsReady"
+	// ShowLogsUntilControllerIsReady stops showing the logs once the
+	// resource is ready. It is the default.
+	ShowLogsUntilControllerIsReady ShowLogsUntil = "ControllerIsReady"
+	// ShowLogsUntilEndOfDeploy shows the logs until the end of the tracking
+	// of all the resources of the deploy.
+	ShowLogsUntilEndOfDeploy ShowLogsUntil = "EndOfDeploy"
+)
+
+// ParseShowLogsUntil parses the value of ShowLogsUntilAnnotation, empty being
+// ShowLogsUntilControllerIsReady.
+func ParseShowLogsUntil(s string) (ShowLogsUntil, error) {
+	switch until := ShowLogsUntil(s); until {
+	case "":
+		return ShowLogsUntilControllerIsReady, nil
+	case ShowLogsUntilPodIsReady, ShowLogsUntilControllerIsReady, ShowLogsUntilEndOfDeploy:
+		return until, nil
+	default:
+		return "", errors.Errorf("unknown value %q: expected %q, %q or %q", s, ShowLogsUntilPodIsReady, ShowLogsUntilControllerIsReady, ShowLogsUntilEndOfDeploy)
+	}
+}
+
+// showLogsUntilOf returns the ShowLogsUntilAnnotation of the resource.
+func showLogsUntilOf(v *resource.Info) (ShowLogsUntil, error) {
+	annotations, err := metadataAccessor.Annotations(v.Object)
+	if err != nil {
+		return "", err
+	}
+
+	until, err := ParseShowLogsUntil(annotations[ShowLogsUntilAnnotation])
+	if err != nil {
+		return "", errors.Wrapf(err, "annotation %s of %s", ShowLogsUntilAnnotation, ResourceNameNamespaceKind(v))
+	}
+
+	return until, nil
+}
+
+// LogsTailWindow limits the logs shown per container to the last lines, the
+// last period or both. The zero LogsTailWindow doesn't limit them.
+//
+// It is a flag value in the format "<lines>", "<duration>" or
+// "<lines>,<duration>", e.g. "100,5m".
+type LogsTailWindow struct {
+	Lines int64
+	Since time.Duration
+}
+
+// ParseLogsTailWindow parses the LogsTailWindow in the format of its flag.
+func ParseLogsTailWindow(s string) (LogsTailWindow, error) {
+	var w LogsTailWindow
+	if s == "" {
+		return w, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		if lines, err := strconv.ParseInt(part, 10, 64); err == nil {
+			if lines < 0 || w.Lines != 0 {
+				return LogsTailWindow{}, errors.Errorf("invalid logs tail window %q: expected \"<lines>,<duration>\"", s)
+			}
+			w.Lines = lines
+			continue
+		}
+
+		since, err := time.ParseDuration(part)
+		if err != nil || since < 0 || w.Since != 0 {
+			return LogsTailWindow{}, errors.Errorf("invalid logs tail window %q: expected \"<lines>,<duration>\"", s)
+		}
+		w.Since = since
+	}
+
+	return w, nil
+}
+
+func (w *LogsTailWindow) String() string {
+	var parts []string
+	if w.Lines != 0 {
+		parts = append(parts, strconv.FormatInt(w.Lines, 10))
+	}
+	if w.Since != 0 {
+		parts = append(parts, w.Since.String())
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (w *LogsTailWindow) Set(s string) error {
+	parsed, err := ParseLogsTailWindow(s)
+	if err != nil {
+		return err
+	}
+	*w = parsed
+
+	return nil
+}
+
+func (w *LogsTailWindow) Type() string {
+	return "logsTailWindow"
+}
+
+// LogsOptions are the options of the logs of the containers of the resources
+// tracked by a LogsResourcesWaiter, see Client.WithLogsOptions.
+type LogsOptions struct {
+	// Hide turns the logs of the containers off, the other messages of the
+	// tracking, e.g. the events and the readiness of the resources, are
+	// still shown.
+	Hide bool
+	// TailWindow limits the logs shown per container.
+	TailWindow LogsTailWindow
+	// Writers receive the streamed logs of the containers, even if they are
+	// hidden, see WriteContainerLogs.
+	Writers []ContainerLogsWriter
+}
+
+// WriteContainerLogs writes the lines of the logs of the container of the
+// resource to all the Writers.
+func (o LogsOptions) WriteContainerLogs(kind, name, namespace, container string, lines []string) error {
+	var errs []string
+	for _, w := range o.Writers {
+		if err := w.WriteContainerLogs(kind, name, namespace, container, lines); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	deploymentutil "github.com/werf/3p-helm/internal/third_party/k8s.io/kubernetes/deployment/util"
+)
+
+// Container waiting reasons that usually mean the container will not start without intervention.
+var failingContainerReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// CheckOwnedResources returns a ReadyCheckerOption that configures a ReadyChecker
+// to consider resources of kinds it does not know, e.g. custom resources, ready
+// only when the workloads they own are ready. This covers the Deployments, Jobs,
+// Pods and other resources created by operators for the custom resources.
+func CheckOwnedResources(checkOwnedResources bool) ReadyCheckerOption {
+	return func(c *ReadyChecker) {
+		if checkOwnedResources {
+			c.ownedResources = &ownedResourcesStatus{notReady: map[string]string{}}
+		} else {
+			c.ownedResources = nil
+		}
+	}
+}
+
+// ownedResourcesStatus keeps why the owned resources were not ready on the last
+// check, to report them if the wait times out. It is shared by the copies of
+// the ReadyChecker.
+type ownedResourcesStatus struct {
+	mu       sync.Mutex
+	notReady map[string]string
+}
+
+func (s *ownedResourcesStatus) set(owner string, reasons []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(reasons) == 0 {
+		delete(s.notReady, owner)
+	} else {
+		s.notReady[owner] = strings.Join(reasons, ", ")
+	}
+}
+
+// Returns the owned resources that were not ready on the last check, one line
+// per owner.
+func (s *ownedResourcesStatus) summary() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []string
+	for owner, reasons := range s.notReady {
+		result = append(result, fmt.Sprintf("%s: %s", owner, reasons))
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// WaitWithOwned waits up to the given timeout for the specified resources to be
+// ready, considering custom resources ready only when the workloads they own are
+// ready. If the wait times out, the owned resources that were not ready are
+// included in the error.
+func (c *Client) WaitWithOwned(resources ResourceList, waitForJobs bool, timeout time.Duration) error {
+	if c.ResourcesWaiter != nil {
+		return c.ResourcesWaiter.Wait(c.baseContext(), resources, timeout)
+	}
+
+	cs, err := c.getKubeClient()
+	if err != nil {
+		return err
+	}
+	checker := NewReadyChecker(cs, c.Log, PausedAsReady(true), CheckJobs(waitForJobs), CheckOwnedResources(true), DefaultReadinessEngine(c.ReadinessEngine))
+	w := waiter{
+		ctx:     c.baseContext(),
+		c:       checker,
+		log:     c.Log,
+		timeout: timeout,
+	}
+	if err := w.waitForResources(resources); err != nil {
+		if notReady := checker.ownedResources.summary(); len(notReady) > 0 {
+			return fmt.Errorf("%w\nowned resources not ready:\n  %s", err, strings.Join(notReady, "\n  "))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ownedResourcesReady checks the readiness of the resources owned by the given
+// resource. A failed owned resource is returned as an error mentioning the owner,
+// since it usually does not recover on its own.
+func (c *ReadyChecker) ownedResourcesReady(ctx context.Context, v *resource.Info) (bool, error) {
+	if err := v.Get(); err != nil {
+		return false, err
+	}
+
+	uid, err := metadataAccessor.UID(v.Object)
+	if err != nil {
+		return false, err
+	}
+
+	owner := fmt.Sprintf("%s/%s", v.Object.GetObjectKind().GroupVersionKind().Kind, v.Name)
+
+	return c.ownedResourcesReadyByUID(ctx, v.Namespace, owner, uid)
+}
+
+func (c *ReadyChecker) ownedResourcesReadyByUID(ctx context.Context, namespace, owner string, uid types.UID) (bool, error) {
+	var notReady []string
+	failed := func(child string, err error) error {
+		return fmt.Errorf("%s owned by %s: %w", child, owner, err)
+	}
+
+	deployments, err := c.client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for i := range deployments.Items {
+		dep := &deployments.Items[i]
+		if !isOwnedBy(dep, uid) || (dep.Spec.Paused && c.pausedAsReady) {
+			continue
+		}
+		rs, err := deploymentutil.GetNewReplicaSet(dep, c.client.AppsV1())
+		if err != nil {
+			return false, err
+		}
+		if dep.Spec.Paused || rs == nil || !c.deploymentReady(rs, dep) {
+			notReady = append(notReady, "Deployment/"+dep.Name)
+		}
+	}
+
+	statefulSets, err := c.client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for i := range statefulSets.Items {
+		sts := &statefulSets.Items[i]
+		if isOwnedBy(sts, uid) && !c.statefulSetReady(sts) {
+			notReady = append(notReady, "StatefulSet/"+sts.Name)
+		}
+	}
+
+	daemonSets, err := c.client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for i := range daemonSets.Items {
+		ds := &daemonSets.Items[i]
+		if isOwnedBy(ds, uid) && !c.daemonSetReady(ds) {
+			notReady = append(notReady, "DaemonSet/"+ds.Name)
+		}
+	}
+
+	jobs, err := c.client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if !isOwnedBy(job, uid) {
+			continue
+		}
+		ready, err := c.jobReady(job)
+		if err != nil {
+			return false, failed("Job/"+job.Name, err)
+		}
+		if !ready {
+			notReady = append(notReady, "Job/"+job.Name)
+		}
+	}
+
+	pods, err := c.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !isOwnedBy(pod, uid) || pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodFailed {
+			return false, failed("Pod/"+pod.Name, fmt.Errorf("pod is failed: %s", podFailureReason(pod)))
+		}
+		if !c.isPodReady(pod) {
+			child := "Pod/" + pod.Name
+			if reason := podFailureReason(pod); reason != "" {
+				child += " (" + reason + ")"
+			}
+			notReady = append(notReady, child)
+		}
+	}
+
+	pvcs, err := c.client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if isOwnedBy(pvc, uid) && !c.volumeReady(pvc) {
+			notReady = append(notReady, "PersistentVolumeClaim/"+pvc.Name)
+		}
+	}
+
+	if c.ownedResources != nil {
+		c.ownedResources.set(owner, notReady)
+	}
+
+	if len(notReady) > 0 {
+		c.log("Resources owned by %s are not ready: %s", owner, strings.Join(notReady, ", "))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func isOwnedBy(obj metav1.Object, uid types.UID) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == uid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// podFailureReason returns why the pod failed or is failing to start, if it is
+// known.
+func podFailureReason(pod *corev1.Pod) string {
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if status.State.Waiting != nil && failingContainerReasons[status.State.Waiting.Reason] {
+			return fmt.Sprintf("container %s: %s", status.Name, status.State.Waiting.Reason)
+		}
+		if pod.Status.Phase == corev1.PodFailed && status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 {
+			return fmt.Sprintf("container %s: %s, exit code %d", status.Name, status.State.Terminated.Reason, status.State.Terminated.ExitCode)
+		}
+	}
+
+	return pod.Status.Reason
+}
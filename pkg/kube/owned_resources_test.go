@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReadyCheckerOwnedResourcesReady(t *testing.T) {
+	const ownerUID = types.UID("owner-uid")
+	ownedBy := func(uid types.UID) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: "example.com/v1", Kind: "Database", Name: "db", UID: uid}}
+	}
+
+	readyPod := newPodWithCondition("ready", corev1.ConditionTrue)
+	readyPod.OwnerReferences = ownedBy(ownerUID)
+
+	crashingPod := newPodWithCondition("crashing", corev1.ConditionFalse)
+	crashingPod.OwnerReferences = ownedBy(ownerUID)
+	crashingPod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "db",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+	}}
+
+	foreignPod := newPodWithCondition("foreign", corev1.ConditionFalse)
+	foreignPod.OwnerReferences = ownedBy("other-uid")
+
+	failedJob := newJob("migrate", 0, intToInt32(1), 0, 1)
+	failedJob.OwnerReferences = ownedBy(ownerUID)
+
+	t.Run("ready", func(t *testing.T) {
+		c := NewReadyChecker(fake.NewSimpleClientset(readyPod, foreignPod), nil, CheckOwnedResources(true))
+		ready, err := c.ownedResourcesReadyByUID(context.Background(), defaultNamespace, "Database/db", ownerUID)
+		if err != nil || !ready {
+			t.Fatalf("expected owned resources to be ready, got ready=%t, err=%v", ready, err)
+		}
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		c := NewReadyChecker(fake.NewSimpleClientset(readyPod, crashingPod), nil, CheckOwnedResources(true))
+		ready, err := c.ownedResourcesReadyByUID(context.Background(), defaultNamespace, "Database/db", ownerUID)
+		if err != nil || ready {
+			t.Fatalf("expected owned resources not to be ready, got ready=%t, err=%v", ready, err)
+		}
+
+		summary := c.ownedResources.summary()
+		expected := "Database/db: Pod/crashing (container db: CrashLoopBackOff)"
+		if len(summary) != 1 || summary[0] != expected {
+			t.Errorf("expected summary %q, got %q", expected, summary)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		c := NewReadyChecker(fake.NewSimpleClientset(readyPod, failedJob), nil, CheckOwnedResources(true))
+		_, err := c.ownedResourcesReadyByUID(context.Background(), defaultNamespace, "Database/db", ownerUID)
+		if err == nil || !strings.Contains(err.Error(), "Job/migrate owned by Database/db") {
+			t.Fatalf("expected an error attributing the failed job to its owner, got %v", err)
+		}
+	})
+}
@@ -29,6 +29,7 @@ import (
 	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/cli-runtime/pkg/resource"
@@ -80,16 +81,44 @@ type ReadyChecker struct {
 	log           func(string, ...interface{})
 	checkJobs     bool
 	pausedAsReady bool
+	// readinessEngine is the engine of the resources not annotated with
+	// ReadinessEngineAnnotation.
+	readinessEngine ReadinessEngine
+	// ownedResources is set if the resources owned by the resources of unknown
+	// kinds have to be checked.
+	ownedResources *ownedResourcesStatus
 }
 
 // IsReady checks if v is ready. It supports checking readiness for pods,
 // deployments, persistent volume claims, services, daemon sets, custom
 // resource definitions, stateful sets, replication controllers, jobs (optional),
-// and replica sets. All other resource kinds are always considered ready.
+// and replica sets. All other resource kinds are always considered ready, unless
+// the checker is configured to check the resources owned by them. Resources
+// annotated with ReadyConditionAnnotation are additionally required to satisfy
+// the condition. The resources checked with ReadinessEngineKStatus are ready
+// once they are Current instead, whatever their kind.
 //
 // IsReady will fetch the latest state of the object from the server prior to
 // performing readiness checks, and it will return any error encountered.
 func (c *ReadyChecker) IsReady(ctx context.Context, v *resource.Info) (bool, error) {
+	cond, err := readyConditionOf(v)
+	if err != nil {
+		return false, err
+	}
+	if cond != nil {
+		if met, err := readyConditionMet(v, cond); err != nil || !met {
+			return false, err
+		}
+	}
+
+	engine, err := readinessEngineOf(v.Object, c.readinessEngine)
+	if err != nil {
+		return false, err
+	}
+	if engine == ReadinessEngineKStatus {
+		return kstatusReady(v)
+	}
+
 	switch value := AsVersioned(v).(type) {
 	case *corev1.Pod:
 		pod, err := c.client.CoreV1().Pods(v.Namespace).Get(ctx, v.Name, metav1.GetOptions{})
@@ -200,10 +229,41 @@ func (c *ReadyChecker) IsReady(ctx context.Context, v *resource.Info) (bool, err
 		if !ready || err != nil {
 			return false, err
 		}
+	case *unstructured.Unstructured:
+		if c.ownedResources != nil {
+			return c.ownedResourcesReady(ctx, v)
+		}
 	}
 	return true, nil
 }
 
+// HasReadinessCheck returns false if the readiness of v can't be checked: its
+// kind is unknown to the client, e.g. it is a custom resource, it is not
+// annotated with ReadyConditionAnnotation, and it is checked with the
+// ReadinessEngineBuiltin, the default engine or the one of its
+// ReadinessEngineAnnotation. Unless the resources owned by it are checked,
+// such a resource is considered ready as soon as it is applied.
+func HasReadinessCheck(v *resource.Info, defaultEngine ReadinessEngine) (bool, error) {
+	cond, err := readyConditionOf(v)
+	if err != nil {
+		return false, err
+	}
+	if cond != nil {
+		return true, nil
+	}
+
+	engine, err := readinessEngineOf(v.Object, defaultEngine)
+	if err != nil {
+		return false, err
+	}
+	if engine == ReadinessEngineKStatus {
+		return true, nil
+	}
+
+	_, unknown := AsVersioned(v).(*unstructured.Unstructured)
+	return !unknown, nil
+}
+
 func (c *ReadyChecker) podsReadyForObject(ctx context.Context, namespace string, obj runtime.Object) (bool, error) {
 	pods, err := c.podsforObject(ctx, namespace, obj)
 	if err != nil {
@@ -243,7 +303,14 @@ func (c *ReadyChecker) jobReady(job *batchv1.Job) (bool, error) {
 		// If a job is failed, it can't recover, so throw an error
 		return false, fmt.Errorf("job is failed: %s/%s", job.GetNamespace(), job.GetName())
 	}
-	if job.Spec.Completions != nil && job.Status.Succeeded < *job.Spec.Completions {
+	required, err := completionsRequiredOf(job)
+	if err != nil {
+		return false, fmt.Errorf("annotation %s of job %s/%s: %w", TrackCompletionsRequiredAnnotation, job.GetNamespace(), job.GetName(), err)
+	}
+	if required == 0 && job.Spec.Completions != nil {
+		required = *job.Spec.Completions
+	}
+	if job.Status.Succeeded < required {
 		c.log("Job is not completed: %s/%s", job.GetNamespace(), job.GetName())
 		return false, nil
 	}
@@ -0,0 +1,125 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ReadyConditionAnnotation holds a JSONPath expression evaluated against the
+// live object while waiting for the resource. The resource is only ready once
+// the expression holds, in addition to the built-in readiness checks of its
+// kind. The expression is either a path, e.g. "{.status.ready}", which holds
+// if it matches values that are neither empty nor "false", or a path compared
+// with a value, e.g. "{.status.phase}=Running", which holds if every value it
+// matches equals the given one. This is the syntax of "kubectl wait
+// --for=jsonpath=...".
+const ReadyConditionAnnotation = "werf.io/ready-condition"
+
+// ReadyCondition is a parsed ReadyConditionAnnotation.
+type ReadyCondition struct {
+	expression string
+	path       *jsonpath.JSONPath
+	// value is compared with the matched values if hasValue is true.
+	value    string
+	hasValue bool
+}
+
+// ParseReadyCondition parses the value of ReadyConditionAnnotation.
+func ParseReadyCondition(expression string) (*ReadyCondition, error) {
+	template, value, hasValue := strings.Cut(expression, "}=")
+	if hasValue {
+		template += "}"
+	}
+	template = strings.TrimSpace(template)
+
+	if !strings.HasPrefix(template, "{") || !strings.HasSuffix(template, "}") {
+		return nil, errors.Errorf("invalid ready condition %q: expected \"{<jsonpath>}\" or \"{<jsonpath>}=<value>\"", expression)
+	}
+
+	path := jsonpath.New(ReadyConditionAnnotation).AllowMissingKeys(true)
+	if err := path.Parse(template); err != nil {
+		return nil, errors.Wrapf(err, "invalid ready condition %q", expression)
+	}
+
+	return &ReadyCondition{
+		expression: expression,
+		path:       path,
+		value:      strings.TrimSpace(value),
+		hasValue:   hasValue,
+	}, nil
+}
+
+// Met reports whether the condition holds for the object content. Missing
+// fields, e.g. a status not reported yet, do not satisfy the condition.
+func (c *ReadyCondition) Met(content map[string]interface{}) (bool, error) {
+	results, err := c.path.FindResults(content)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to evaluate ready condition %q", c.expression)
+	}
+
+	matched := 0
+	for _, result := range results {
+		for _, v := range result {
+			if !v.IsValid() || !v.CanInterface() {
+				continue
+			}
+			matched++
+
+			s := fmt.Sprint(v.Interface())
+			if c.hasValue && s != c.value {
+				return false, nil
+			}
+			if !c.hasValue && (s == "" || s == "false") {
+				return false, nil
+			}
+		}
+	}
+
+	return matched > 0, nil
+}
+
+func (c *ReadyCondition) String() string {
+	return c.expression
+}
+
+// readyConditionOf returns the ready condition of the resource, or nil if it
+// has none.
+func readyConditionOf(v *resource.Info) (*ReadyCondition, error) {
+	annotations, err := metadataAccessor.Annotations(v.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, found := annotations[ReadyConditionAnnotation]
+	if !found {
+		return nil, nil
+	}
+
+	cond, err := ParseReadyCondition(expression)
+	if err != nil {
+		return nil, errors.Wrapf(err, "annotation %s of %s", ReadyConditionAnnotation, ResourceNameNamespaceKind(v))
+	}
+
+	return cond, nil
+}
+
+// readyConditionMet gets the live object of the resource and evaluates the
+// condition against it.
+func readyConditionMet(v *resource.Info, cond *ReadyCondition) (bool, error) {
+	live, err := resource.NewHelper(v.Client, v.Mapping).Get(v.Namespace, v.Name)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to convert %s", ResourceNameNamespaceKind(v))
+	}
+
+	return cond.Met(content)
+}
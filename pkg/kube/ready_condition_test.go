@@ -0,0 +1,82 @@
+package kube
+
+import (
+	"testing"
+)
+
+func TestParseReadyCondition(t *testing.T) {
+	valid := []string{
+		"{.status.ready}",
+		"{.status.phase}=Running",
+		"{.status.conditions[?(@.type==\"Ready\")].status}=True",
+	}
+	for _, expression := range valid {
+		if _, err := ParseReadyCondition(expression); err != nil {
+			t.Errorf("expected %q to be valid, got %v", expression, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		".status.phase",
+		"status.phase=Running",
+		"{.status.phase",
+		"{.status[}",
+	}
+	for _, expression := range invalid {
+		if _, err := ParseReadyCondition(expression); err == nil {
+			t.Errorf("expected %q to be invalid", expression)
+		}
+	}
+}
+
+func TestReadyConditionMet(t *testing.T) {
+	content := map[string]interface{}{
+		"status": map[string]interface{}{
+			"phase":    "Running",
+			"ready":    true,
+			"replicas": int64(3),
+			"paused":   false,
+			"message":  "",
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+				map[string]interface{}{"type": "Synced", "status": "False"},
+			},
+		},
+	}
+
+	tests := []struct {
+		expression string
+		met        bool
+	}{
+		{"{.status.phase}=Running", true},
+		{"{.status.phase}=Pending", false},
+		{"{.status.ready}", true},
+		{"{.status.ready}=true", true},
+		{"{.status.replicas}=3", true},
+		{"{.status.paused}", false},
+		{"{.status.message}", false},
+		{"{.status.missing}", false},
+		{"{.status.missing}=Running", false},
+		{"{.status.conditions[?(@.type==\"Ready\")].status}=True", true},
+		{"{.status.conditions[?(@.type==\"Synced\")].status}=True", false},
+		{"{.status.conditions[*].status}=True", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			cond, err := ParseReadyCondition(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			met, err := cond.Met(content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if met != tt.met {
+				t.Errorf("expected %v, got %v", tt.met, met)
+			}
+		})
+	}
+}
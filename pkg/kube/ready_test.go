@@ -23,8 +23,10 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -413,6 +415,22 @@ func Test_ReadyChecker_jobReady(t *testing.T) {
 			args: args{job: newJob("foo", 0, nil, 1, 0)},
 			want: true,
 		},
+		{
+			name: "job with required completions succeeded",
+			args: args{job: withCompletionsRequired(newJob("foo", 1, intToInt32(5), 2, 0), "2")},
+			want: true,
+		},
+		{
+			name: "job with required completions not succeeded yet",
+			args: args{job: withCompletionsRequired(newJob("foo", 1, nil, 1, 0), "2")},
+			want: false,
+		},
+		{
+			name:    "job with more completions required than run",
+			args:    args{job: withCompletionsRequired(newJob("foo", 1, intToInt32(1), 1, 0), "2")},
+			want:    false,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -463,6 +481,73 @@ func Test_ReadyChecker_volumeReady(t *testing.T) {
 	}
 }
 
+func TestHasReadinessCheck(t *testing.T) {
+	newInfo := func(apiVersion, kind string, annotations map[string]string) *resource.Info {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetName("foo")
+		obj.SetAnnotations(annotations)
+
+		return &resource.Info{Name: "foo", Object: obj}
+	}
+
+	tests := []struct {
+		name          string
+		info          *resource.Info
+		defaultEngine ReadinessEngine
+		want          bool
+	}{
+		{
+			name: "built-in kind",
+			info: newInfo("apps/v1", "Deployment", nil),
+			want: true,
+		},
+		{
+			name: "custom resource",
+			info: newInfo("example.com/v1", "Database", nil),
+			want: false,
+		},
+		{
+			name: "custom resource with a ready condition",
+			info: newInfo("example.com/v1", "Database", map[string]string{ReadyConditionAnnotation: "{.status.ready}=true"}),
+			want: true,
+		},
+		{
+			name: "custom resource checked with kstatus",
+			info: newInfo("example.com/v1", "Database", map[string]string{ReadinessEngineAnnotation: "kstatus"}),
+			want: true,
+		},
+		{
+			name:          "custom resource checked with kstatus by default",
+			info:          newInfo("example.com/v1", "Database", nil),
+			defaultEngine: ReadinessEngineKStatus,
+			want:          true,
+		},
+		{
+			name:          "custom resource checked with the built-in checks despite the default",
+			info:          newInfo("example.com/v1", "Database", map[string]string{ReadinessEngineAnnotation: "builtin"}),
+			defaultEngine: ReadinessEngineKStatus,
+			want:          false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HasReadinessCheck(tt.info, tt.defaultEngine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("HasReadinessCheck() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := HasReadinessCheck(newInfo("example.com/v1", "Database", map[string]string{ReadyConditionAnnotation: ".status.ready"}), ReadinessEngineBuiltin); err == nil {
+		t.Error("expected an error for an invalid ready condition")
+	}
+}
+
 func newStatefulSetWithUpdateRevision(name string, replicas, partition, readyReplicas, updatedReplicas int, updateRevision string, generationInSync bool) *appsv1.StatefulSet {
 	ss := newStatefulSet(name, replicas, partition, readyReplicas, updatedReplicas, generationInSync)
 	ss.Status.UpdateRevision = updateRevision
@@ -669,6 +754,11 @@ func newPersistentVolumeClaim(name string, phase corev1.PersistentVolumeClaimPha
 	}
 }
 
+func withCompletionsRequired(job *batchv1.Job, required string) *batchv1.Job {
+	job.Annotations = map[string]string{TrackCompletionsRequiredAnnotation: required}
+	return job
+}
+
 func newJob(name string, backoffLimit int, completions *int32, succeeded int, failed int) *batchv1.Job {
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
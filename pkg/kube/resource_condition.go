@@ -0,0 +1,114 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+)
+
+// ResourceCondition is a condition of the status.conditions of a resource
+// with the given status, e.g. "Ready=True" or "Synced=True", waited for
+// instead of the readiness of the resource by the dependencies on it.
+type ResourceCondition struct {
+	Type   string
+	Status string
+}
+
+// ParseResourceCondition parses the ResourceCondition in the format
+// "<type>=<status>".
+func ParseResourceCondition(s string) (*ResourceCondition, error) {
+	condType, status, found := strings.Cut(s, "=")
+	condType, status = strings.TrimSpace(condType), strings.TrimSpace(status)
+	if !found || condType == "" || status == "" {
+		return nil, errors.Errorf("invalid condition %q: expected \"<type>=<status>\", e.g. \"Ready=True\"", s)
+	}
+
+	return &ResourceCondition{Type: condType, Status: status}, nil
+}
+
+// Met reports whether the object content has the condition. The statuses are
+// compared case-insensitively, as "True" and "true" are both used by the
+// controllers. A condition reported for an older generation of the object,
+// as told by the observedGeneration of the status or of the condition, is not
+// met yet.
+func (c *ResourceCondition) Met(content map[string]interface{}) bool {
+	generation, _, _ := unstructured.NestedInt64(content, "metadata", "generation")
+	if observed, found, _ := unstructured.NestedInt64(content, "status", "observedGeneration"); found && observed < generation {
+		return false
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(content, "status", "conditions")
+	for _, item := range conditions {
+		cond, ok := item.(map[string]interface{})
+		if !ok || fmt.Sprint(cond["type"]) != c.Type {
+			continue
+		}
+
+		if observed, found, _ := unstructured.NestedInt64(cond, "observedGeneration"); found && observed < generation {
+			return false
+		}
+
+		return strings.EqualFold(fmt.Sprint(cond["status"]), c.Status)
+	}
+
+	return false
+}
+
+func (c *ResourceCondition) String() string {
+	return c.Type + "=" + c.Status
+}
+
+// WaitForCondition waits up to the given timeout for each of the resources to
+// have the condition, whatever the readiness of the resources. The resources
+// which don't exist yet are waited for to be created.
+func (c *Client) WaitForCondition(resources ResourceList, cond *ResourceCondition, timeout time.Duration) error {
+	dyn, err := c.Factory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	c.Log("beginning wait for %d resources to have condition %s with timeout of %v", len(resources), cond, timeout)
+
+	ctx, cancel := context.WithTimeout(c.baseContext(), timeout)
+	defer cancel()
+
+	return waitForCondition(ctx, dyn, resources, cond, 2*time.Second, c.Log)
+}
+
+func waitForCondition(ctx context.Context, dyn dynamic.Interface, resources ResourceList, cond *ResourceCondition, interval time.Duration, log func(string, ...interface{})) error {
+	var pending *resource.Info
+	err := wait.PollUntilContextCancel(ctx, interval, true, func(ctx context.Context) (bool, error) {
+		for _, v := range resources {
+			live, err := dyn.Resource(v.Mapping.Resource).Namespace(v.Namespace).Get(ctx, v.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				log("%s does not exist yet", ResourceNameNamespaceKind(v))
+				pending = v
+				return false, nil
+			} else if err != nil {
+				return false, errors.Wrapf(err, "unable to get %s", ResourceNameNamespaceKind(v))
+			}
+
+			if !cond.Met(live.Object) {
+				log("%s does not have condition %s yet", ResourceNameNamespaceKind(v), cond)
+				pending = v
+				return false, nil
+			}
+		}
+
+		return true, nil
+	})
+	if err != nil && ctx.Err() != nil && pending != nil {
+		return fmt.Errorf("%w: %s does not have condition %s", err, ResourceNameNamespaceKind(pending), cond)
+	}
+
+	return err
+}
@@ -0,0 +1,96 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestResourceCondition(t *testing.T) {
+	cond, err := ParseResourceCondition("Ready=True")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditions := func(items ...map[string]interface{}) map[string]interface{} {
+		var list []interface{}
+		for _, item := range items {
+			list = append(list, item)
+		}
+		return map[string]interface{}{"status": map[string]interface{}{"conditions": list}}
+	}
+
+	withGeneration := func(content map[string]interface{}, generation, observedGeneration int64) map[string]interface{} {
+		content["metadata"] = map[string]interface{}{"generation": generation}
+		content["status"].(map[string]interface{})["observedGeneration"] = observedGeneration
+		return content
+	}
+
+	for _, tt := range []struct {
+		name    string
+		content map[string]interface{}
+		met     bool
+	}{
+		{name: "no status", content: map[string]interface{}{}},
+		{name: "other condition", content: conditions(map[string]interface{}{"type": "Synced", "status": "True"})},
+		{name: "false", content: conditions(map[string]interface{}{"type": "Ready", "status": "False"})},
+		{name: "true", content: conditions(map[string]interface{}{"type": "Synced", "status": "False"}, map[string]interface{}{"type": "Ready", "status": "True"}), met: true},
+		{name: "lowercase", content: conditions(map[string]interface{}{"type": "Ready", "status": "true"}), met: true},
+		{name: "stale status", content: withGeneration(conditions(map[string]interface{}{"type": "Ready", "status": "True"}), 2, 1)},
+		{name: "stale condition", content: withGeneration(conditions(map[string]interface{}{"type": "Ready", "status": "True", "observedGeneration": int64(1)}), 2, 2)},
+		{name: "current generation", content: withGeneration(conditions(map[string]interface{}{"type": "Ready", "status": "True", "observedGeneration": int64(2)}), 2, 2), met: true},
+	} {
+		if met := cond.Met(tt.content); met != tt.met {
+			t.Errorf("%s: expected condition met to be %v, got %v", tt.name, tt.met, met)
+		}
+	}
+
+	for _, value := range []string{"Ready", "=True", "Ready="} {
+		if _, err := ParseResourceCondition(value); err == nil {
+			t.Errorf("expected an error for condition %q", value)
+		}
+	}
+}
+
+func TestWaitForConditionOfResourceNotCreatedYet(t *testing.T) {
+	cond := &ResourceCondition{Type: "Ready", Status: "True"}
+	databases := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "databases"}
+	database := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Database",
+		"metadata":   map[string]interface{}{"name": "db", "namespace": "myns"},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+		},
+	}}
+
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{databases: "DatabaseList"})
+	gets := 0
+	dyn.PrependReactor("get", "databases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 1 {
+			return true, nil, apierrors.NewNotFound(databases.GroupResource(), "db")
+		}
+		return true, database, nil
+	})
+
+	resources := ResourceList{&resource.Info{Name: "db", Namespace: "myns", Mapping: &meta.RESTMapping{Resource: databases}, Object: database}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := waitForCondition(ctx, dyn, resources, cond, time.Millisecond, nopLogger); err != nil {
+		t.Fatalf("expected the condition of the created resource to be met, got %s", err)
+	}
+	if gets != 2 {
+		t.Errorf("expected 2 gets, got %d", gets)
+	}
+}
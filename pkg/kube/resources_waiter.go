@@ -13,6 +13,15 @@ type ResourcesWaiter interface {
 	WaitUntilDeleted(ctx context.Context, specs []*ResourcesWaiterDeleteResourceSpec, timeout time.Duration) error
 }
 
+// LogsResourcesWaiter is a ResourcesWaiter showing the logs of the containers
+// of the tracked resources.
+type LogsResourcesWaiter interface {
+	ResourcesWaiter
+	// WithLogsOptions returns a copy of the waiter showing the logs of the
+	// containers with the options.
+	WithLogsOptions(opts LogsOptions) ResourcesWaiter
+}
+
 type ResourcesWaiterDeleteResourceSpec struct {
 	ResourceName         string
 	Namespace            string
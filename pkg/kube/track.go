@@ -0,0 +1,62 @@
+package kube
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// TrackAnnotation set to "false" excludes the resource from readiness
+// tracking: it is still applied, but the deploy neither waits for it to become
+// ready nor reports its Warning events on failure. Explicit deploy dependencies
+// on its readiness are still waited for.
+const TrackAnnotation = "werf.io/track"
+
+// ParseTrack parses the value of TrackAnnotation.
+func ParseTrack(value string) (bool, error) {
+	track, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Errorf("invalid value %q: expected \"true\" or \"false\"", value)
+	}
+
+	return track, nil
+}
+
+// IsTracked returns false if the resource is excluded from readiness tracking
+// with TrackAnnotation.
+func IsTracked(v *resource.Info) (bool, error) {
+	annotations, err := metadataAccessor.Annotations(v.Object)
+	if err != nil {
+		return false, err
+	}
+
+	value, found := annotations[TrackAnnotation]
+	if !found {
+		return true, nil
+	}
+
+	track, err := ParseTrack(value)
+	if err != nil {
+		return false, errors.Wrapf(err, "annotation %s of %s", TrackAnnotation, ResourceNameNamespaceKind(v))
+	}
+
+	return track, nil
+}
+
+// TrackedResources returns the resources not excluded from readiness tracking
+// with TrackAnnotation.
+func TrackedResources(resources ResourceList) (ResourceList, error) {
+	var tracked ResourceList
+	for _, v := range resources {
+		track, err := IsTracked(v)
+		if err != nil {
+			return nil, err
+		}
+		if track {
+			tracked.Append(v)
+		}
+	}
+
+	return tracked, nil
+}
@@ -0,0 +1,35 @@
+package kube
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func newTrackInfo(name, track string) *resource.Info {
+	info := newKindInfo("Deployment", name)
+	if track != "" {
+		info.Object.(*unstructured.Unstructured).SetAnnotations(map[string]string{TrackAnnotation: track})
+	}
+
+	return info
+}
+
+func TestTrackedResources(t *testing.T) {
+	tracked := newTrackInfo("app", "")
+	explicit := newTrackInfo("worker", "true")
+	untracked := newTrackInfo("report", "false")
+
+	result, err := TrackedResources(ResourceList{tracked, untracked, explicit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0] != tracked || result[1] != explicit {
+		t.Errorf("expected app and worker to be tracked, got %v", result)
+	}
+
+	if _, err := TrackedResources(ResourceList{newTrackInfo("migrate", "sometimes")}); err == nil {
+		t.Error("expected an error for an invalid annotation")
+	}
+}
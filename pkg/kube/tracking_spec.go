@@ -0,0 +1,254 @@
+package kube
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// The annotations selecting the containers whose logs are shown while the
+// workload is tracked.
+const (
+	ShowLogsOnlyForContainersAnnotation = "werf.io/show-logs-only-for-containers"
+	SkipLogsForContainersAnnotation     = "werf.io/skip-logs-for-containers"
+	// LogRegexForContainerAnnotationPrefix followed by a container name holds
+	// the regular expression the log lines of the container are filtered with.
+	LogRegexForContainerAnnotationPrefix = "werf.io/log-regex-for-"
+)
+
+// TrackingSpec is how a resource is tracked during the deploy, derived from its
+// annotations. It lets external runners, e.g. controllers or UIs, track the
+// resources with the same semantics as the deploy, without tracking them.
+type TrackingSpec struct {
+	APIVersion string `json:"api_version"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	// Tracked is false if the resource is excluded from readiness tracking
+	// with TrackAnnotation.
+	Tracked bool `json:"tracked"`
+	// ReadyCondition is the ReadyConditionAnnotation the resource must meet
+	// in addition to the built-in readiness checks of its kind.
+	ReadyCondition string `json:"ready_condition,omitempty"`
+	// ShowLogsOnlyForContainers and SkipLogsForContainers select the
+	// containers whose logs are shown.
+	ShowLogsOnlyForContainers []string `json:"show_logs_only_for_containers,omitempty"`
+	SkipLogsForContainers     []string `json:"skip_logs_for_containers,omitempty"`
+	// LogRegexForContainers maps container names to the regular expression
+	// their log lines are filtered with.
+	LogRegexForContainers map[string]string `json:"log_regex_for_containers,omitempty"`
+	// ShowLogsUntil is until when the logs of the containers are shown, see
+	// ShowLogsUntilAnnotation.
+	ShowLogsUntil ShowLogsUntil `json:"show_logs_until"`
+	// FailuresAllowed is the number of the failures of the Pods of the
+	// resource tolerated while it is tracked, see FailuresAllowed.
+	FailuresAllowed int `json:"failures_allowed"`
+	// CompletionsRequired is the number of the successful completions after
+	// which the resource is ready, see TrackCompletionsRequiredAnnotation.
+	CompletionsRequired int32 `json:"completions_required,omitempty"`
+}
+
+// NewTrackingSpec returns the TrackingSpec of the resource. The annotations are
+// validated the way the deploy validates them.
+func NewTrackingSpec(v *resource.Info) (*TrackingSpec, error) {
+	annotations, err := metadataAccessor.Annotations(v.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	gvk := v.Object.GetObjectKind().GroupVersionKind()
+	spec := &TrackingSpec{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Namespace:  v.Namespace,
+		Name:       v.Name,
+	}
+
+	if spec.Tracked, err = IsTracked(v); err != nil {
+		return nil, err
+	}
+
+	if cond, err := readyConditionOf(v); err != nil {
+		return nil, err
+	} else if cond != nil {
+		spec.ReadyCondition = cond.String()
+	}
+
+	if spec.ShowLogsUntil, err = showLogsUntilOf(v); err != nil {
+		return nil, err
+	}
+
+	if spec.FailuresAllowed, err = FailuresAllowed(v); err != nil {
+		return nil, err
+	}
+
+	if spec.CompletionsRequired, err = CompletionsRequired(v); err != nil {
+		return nil, err
+	}
+
+	if err := validateLoggedContainers(v, annotations); err != nil {
+		return nil, err
+	}
+
+	for key, value := range annotations {
+		switch {
+		case key == ShowLogsOnlyForContainersAnnotation:
+			spec.ShowLogsOnlyForContainers = splitContainerNames(value)
+		case key == SkipLogsForContainersAnnotation:
+			spec.SkipLogsForContainers = splitContainerNames(value)
+		case strings.HasPrefix(key, LogRegexForContainerAnnotationPrefix):
+			if _, err := regexp.Compile(value); err != nil {
+				return nil, errors.Wrapf(err, "annotation %s of %s", key, ResourceNameNamespaceKind(v))
+			}
+			if spec.LogRegexForContainers == nil {
+				spec.LogRegexForContainers = map[string]string{}
+			}
+			spec.LogRegexForContainers[strings.TrimPrefix(key, LogRegexForContainerAnnotationPrefix)] = value
+		}
+	}
+
+	return spec, nil
+}
+
+// TrackingSpecs returns the TrackingSpec of every resource, in the order of
+// the resources.
+func TrackingSpecs(resources ResourceList) ([]*TrackingSpec, error) {
+	specs := []*TrackingSpec{}
+	for _, v := range resources {
+		spec, err := NewTrackingSpec(v)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+// ValidateLoggedContainers checks that the containers named in the
+// ShowLogsOnlyForContainersAnnotation, SkipLogsForContainersAnnotation and
+// LogRegexForContainerAnnotationPrefix annotations of the workloads exist in
+// their pod templates, including the init containers. Otherwise the
+// annotations would be silently ignored while the workloads are tracked.
+func ValidateLoggedContainers(resources ResourceList) error {
+	var errs []string
+	for _, v := range resources {
+		annotations, err := metadataAccessor.Annotations(v.Object)
+		if err != nil {
+			return err
+		}
+
+		if err := validateLoggedContainers(v, annotations); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func validateLoggedContainers(v *resource.Info, annotations map[string]string) error {
+	containers, err := podTemplateContainers(v)
+	if err != nil || containers == nil {
+		return err
+	}
+
+	type reference struct{ annotation, container string }
+	var references []reference
+	for key, value := range annotations {
+		switch {
+		case key == ShowLogsOnlyForContainersAnnotation || key == SkipLogsForContainersAnnotation:
+			for _, name := range splitContainerNames(value) {
+				references = append(references, reference{annotation: key, container: name})
+			}
+		case strings.HasPrefix(key, LogRegexForContainerAnnotationPrefix):
+			references = append(references, reference{annotation: key, container: strings.TrimPrefix(key, LogRegexForContainerAnnotationPrefix)})
+		}
+	}
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].annotation != references[j].annotation {
+			return references[i].annotation < references[j].annotation
+		}
+		return references[i].container < references[j].container
+	})
+
+	var errs []string
+	for _, ref := range references {
+		if !containers[ref.container] {
+			errs = append(errs, fmt.Sprintf("%s: annotation %s refers to container %q, which is not in the pod template (containers: %s)",
+				ResourceNameNamespaceKind(v), ref.annotation, ref.container, strings.Join(sortedContainerNames(containers), ", ")))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// podTemplateContainers returns the names of the containers and the init
+// containers of the pod template of the workload, or nil if the resource is not
+// a workload or its pod template has no containers.
+func podTemplateContainers(v *resource.Info) (map[string]bool, error) {
+	var path []string
+	switch v.Object.GetObjectKind().GroupVersionKind().Kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		path = []string{"spec", "template", "spec"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		return nil, nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(v.Object)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to convert %s", ResourceNameNamespaceKind(v))
+	}
+
+	names := map[string]bool{}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(content, append(path, field)...)
+		for _, container := range containers {
+			if container, ok := container.(map[string]interface{}); ok {
+				names[fmt.Sprint(container["name"])] = true
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	return names, nil
+}
+
+func sortedContainerNames(containers map[string]bool) []string {
+	names := make([]string, 0, len(containers))
+	for name := range containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func splitContainerNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
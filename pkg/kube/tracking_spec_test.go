@@ -0,0 +1,228 @@
+package kube
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func TestTrackingSpecs(t *testing.T) {
+	app := newKindInfo("Deployment", "app")
+	app.Namespace = "prod"
+	app.Object.(*unstructured.Unstructured).SetAnnotations(map[string]string{
+		ReadyConditionAnnotation:                       "{.status.ready}=true",
+		ShowLogsOnlyForContainersAnnotation:            "web, sidecar",
+		LogRegexForContainerAnnotationPrefix + "web":   "^ERROR",
+		SkipLogsForContainersAnnotation:                "",
+		ShowLogsUntilAnnotation:                        "EndOfDeploy",
+		FailuresAllowedAnnotation:                      "5",
+		FailuresAllowedPerReplicaAnnotation:            "2",
+		"werf.io/unrelated":                            "value",
+		LogRegexForContainerAnnotationPrefix + "proxy": "panic|fatal",
+	})
+	report := newTrackInfo("report", "false")
+
+	specs, err := TrackingSpecs(ResourceList{app, report})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*TrackingSpec{
+		{
+			APIVersion:                "v1",
+			Kind:                      "Deployment",
+			Namespace:                 "prod",
+			Name:                      "app",
+			Tracked:                   true,
+			ReadyCondition:            "{.status.ready}=true",
+			ShowLogsOnlyForContainers: []string{"sidecar", "web"},
+			LogRegexForContainers:     map[string]string{"web": "^ERROR", "proxy": "panic|fatal"},
+			ShowLogsUntil:             ShowLogsUntilEndOfDeploy,
+			FailuresAllowed:           5,
+		},
+		{APIVersion: "v1", Kind: "Deployment", Name: "report", ShowLogsUntil: ShowLogsUntilControllerIsReady, FailuresAllowed: 1},
+	}
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, specs)
+	}
+
+	for annotation, value := range map[string]string{
+		TrackAnnotation:                              "sometimes",
+		ReadyConditionAnnotation:                     ".status.ready",
+		LogRegexForContainerAnnotationPrefix + "web": "(",
+		ShowLogsUntilAnnotation:                      "Forever",
+		FailuresAllowedAnnotation:                    "-1",
+		FailuresAllowedPerReplicaAnnotation:          "some",
+	} {
+		info := newKindInfo("Deployment", "invalid")
+		info.Object.(*unstructured.Unstructured).SetAnnotations(map[string]string{annotation: value})
+		if _, err := NewTrackingSpec(info); err == nil {
+			t.Errorf("expected an error for %s: %q", annotation, value)
+		}
+	}
+}
+
+func TestParseLogsTailWindow(t *testing.T) {
+	for value, expected := range map[string]LogsTailWindow{
+		"":        {},
+		"100":     {Lines: 100},
+		"5m":      {Since: 5 * time.Minute},
+		"100, 5m": {Lines: 100, Since: 5 * time.Minute},
+		"30s,20":  {Lines: 20, Since: 30 * time.Second},
+	} {
+		w, err := ParseLogsTailWindow(value)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", value, err)
+		} else if w != expected {
+			t.Errorf("expected %+v for %q, got %+v", expected, value, w)
+		}
+	}
+
+	for _, value := range []string{"-1", "10,20", "5m,1h", "many"} {
+		if _, err := ParseLogsTailWindow(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
+
+// logsWaiter records the LogsOptions it is given.
+type logsWaiter struct {
+	ResourcesWaiter
+
+	opts LogsOptions
+}
+
+func (w *logsWaiter) WithLogsOptions(opts LogsOptions) ResourcesWaiter {
+	return &logsWaiter{opts: opts}
+}
+
+func TestWithLogsOptions(t *testing.T) {
+	waiter := &logsWaiter{}
+	c := &Client{ResourcesWaiter: waiter}
+
+	opts := LogsOptions{Hide: true, TailWindow: LogsTailWindow{Lines: 100}}
+	withLogs := c.WithLogsOptions(opts).(*Client)
+	if got := withLogs.ResourcesWaiter.(*logsWaiter).opts; !reflect.DeepEqual(got, opts) {
+		t.Errorf("expected the waiter to get %+v, got %+v", opts, got)
+	}
+	if c.ResourcesWaiter != waiter || !reflect.DeepEqual(waiter.opts, LogsOptions{}) {
+		t.Error("expected the waiter of the client to be left as it is")
+	}
+
+	if withLogs := (&Client{}).WithLogsOptions(opts).(*Client); withLogs.ResourcesWaiter != nil {
+		t.Errorf("expected no waiter, got %v", withLogs.ResourcesWaiter)
+	}
+}
+
+func TestValidateLoggedContainers(t *testing.T) {
+	newWorkload := func(kind, name string, path []string, annotations map[string]string) *resource.Info {
+		info := newKindInfo(kind, name)
+		obj := info.Object.(*unstructured.Unstructured)
+		obj.SetAnnotations(annotations)
+		containers := []interface{}{map[string]interface{}{"name": "web"}}
+		initContainers := []interface{}{map[string]interface{}{"name": "migrate"}}
+		if err := unstructured.SetNestedSlice(obj.Object, containers, append(path, "containers")...); err != nil {
+			t.Fatal(err)
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, initContainers, append(path, "initContainers")...); err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	deploymentPath := []string{"spec", "template", "spec"}
+	cronJobPath := []string{"spec", "jobTemplate", "spec", "template", "spec"}
+
+	valid := ResourceList{
+		newWorkload("Deployment", "app", deploymentPath, map[string]string{
+			ShowLogsOnlyForContainersAnnotation:          "web, migrate",
+			LogRegexForContainerAnnotationPrefix + "web": "^ERROR",
+		}),
+		newWorkload("CronJob", "report", cronJobPath, map[string]string{SkipLogsForContainersAnnotation: "migrate"}),
+		newKindInfo("ConfigMap", "config"),
+	}
+	if err := ValidateLoggedContainers(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for annotation, value := range map[string]string{
+		ShowLogsOnlyForContainersAnnotation:            "web,proxy",
+		SkipLogsForContainersAnnotation:                "proxy",
+		LogRegexForContainerAnnotationPrefix + "proxy": "panic",
+	} {
+		info := newWorkload("Deployment", "app", deploymentPath, map[string]string{annotation: value})
+		if err := ValidateLoggedContainers(ResourceList{info}); err == nil || !strings.Contains(err.Error(), `"proxy"`) {
+			t.Errorf("expected an error about the proxy container for %s: %q, got %v", annotation, value, err)
+		}
+		if _, err := NewTrackingSpec(info); err == nil {
+			t.Errorf("expected the tracking spec to be rejected for %s: %q", annotation, value)
+		}
+	}
+}
+
+func TestFailuresAllowed(t *testing.T) {
+	for _, tt := range []struct {
+		annotations map[string]string
+		replicas    int64
+		expected    int
+	}{
+		{expected: 1},
+		{replicas: 3, expected: 3},
+		{annotations: map[string]string{FailuresAllowedPerReplicaAnnotation: "2"}, replicas: 3, expected: 6},
+		{annotations: map[string]string{FailuresAllowedAnnotation: "4"}, replicas: 3, expected: 4},
+		{annotations: map[string]string{FailuresAllowedAnnotation: "0", FailuresAllowedPerReplicaAnnotation: "2"}, replicas: 3, expected: 0},
+	} {
+		info := newKindInfo("Deployment", "app")
+		obj := info.Object.(*unstructured.Unstructured)
+		obj.SetAnnotations(tt.annotations)
+		if tt.replicas != 0 {
+			if err := unstructured.SetNestedField(obj.Object, tt.replicas, "spec", "replicas"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		failures, err := FailuresAllowed(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failures != tt.expected {
+			t.Errorf("expected %d failures allowed for %v with %d replicas, got %d", tt.expected, tt.annotations, tt.replicas, failures)
+		}
+	}
+}
+
+func TestCompletionsRequired(t *testing.T) {
+	for _, tt := range []struct {
+		annotations map[string]string
+		completions int64
+		expected    int32
+		expectErr   bool
+	}{
+		{expected: 0},
+		{annotations: map[string]string{TrackCompletionsRequiredAnnotation: "3"}, expected: 3},
+		{annotations: map[string]string{TrackCompletionsRequiredAnnotation: "3"}, completions: 10, expected: 3},
+		{annotations: map[string]string{TrackCompletionsRequiredAnnotation: "3"}, completions: 2, expectErr: true},
+		{annotations: map[string]string{TrackCompletionsRequiredAnnotation: "0"}, expectErr: true},
+		{annotations: map[string]string{TrackCompletionsRequiredAnnotation: "all"}, expectErr: true},
+	} {
+		info := newKindInfo("Job", "migrate")
+		obj := info.Object.(*unstructured.Unstructured)
+		obj.SetAnnotations(tt.annotations)
+		if tt.completions != 0 {
+			if err := unstructured.SetNestedField(obj.Object, tt.completions, "spec", "completions"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		completions, err := CompletionsRequired(info)
+		if (err != nil) != tt.expectErr {
+			t.Fatalf("unexpected error for %v with %d completions: %v", tt.annotations, tt.completions, err)
+		}
+		if completions != tt.expected {
+			t.Errorf("expected %d completions required for %v, got %d", tt.expected, tt.annotations, completions)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// VerifyCronJobs creates, in the dry-run mode, a Job from the job template of
+// every CronJob among the resources, as the CronJob controller does on the next
+// scheduled run. So the Jobs rejected by the admission webhooks, the quotas or
+// the validation of the API server fail the deploy instead of the next run of
+// the CronJobs. The suspended CronJobs are verified too, with a warning that
+// they won't run.
+func (c *Client) VerifyCronJobs(resources ResourceList) error {
+	cs, err := c.getKubeClient()
+	if err != nil {
+		return err
+	}
+
+	return verifyCronJobs(c.baseContext(), cs, resources, c.Log)
+}
+
+func verifyCronJobs(ctx context.Context, cs kubernetes.Interface, resources ResourceList, log func(string, ...interface{})) error {
+	var errs []string
+	for _, info := range resources {
+		cronJob, ok := AsVersioned(info).(*batchv1.CronJob)
+		if !ok {
+			continue
+		}
+
+		if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+			log("warning: CronJob %s/%s is suspended, its Jobs won't be created until it is resumed", info.Namespace, info.Name)
+		}
+
+		log("verifying a Job of CronJob %s/%s with a dry-run", info.Namespace, info.Name)
+		_, err := cs.BatchV1().Jobs(info.Namespace).Create(ctx, jobFromCronJob(cronJob, info.Namespace), metav1.CreateOptions{
+			DryRun: []string{metav1.DryRunAll},
+		})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("CronJob %s/%s: %s", info.Namespace, info.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("the Jobs of %d CronJobs would be rejected on their next run: %s", len(errs), strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// jobFromCronJob returns the Job the CronJob controller would create from the
+// CronJob.
+func jobFromCronJob(cronJob *batchv1.CronJob, namespace string) *batchv1.Job {
+	template := cronJob.Spec.JobTemplate.DeepCopy()
+
+	annotations := template.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations["cronjob.kubernetes.io/instantiate"] = "manual"
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			// CronJob names are at most 52 characters long, so that the
+			// suffix of the scheduled time of the Jobs fits.
+			Name:        cronJob.Name + "-verify",
+			Namespace:   namespace,
+			Labels:      template.Labels,
+			Annotations: annotations,
+		},
+		Spec: template.Spec,
+	}
+}
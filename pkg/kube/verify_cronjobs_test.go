@@ -0,0 +1,59 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var errForbiddenImage = errors.New("image is not allowed")
+
+func TestVerifyCronJobs(t *testing.T) {
+	cronJob := func(name, image string) *resource.Info {
+		return &resource.Info{Name: name, Namespace: "spaced", Object: &batchv1.CronJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "spaced"},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "*/5 * * * *",
+				JobTemplate: batchv1.JobTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+					Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "main", Image: image}},
+					}}},
+				},
+			},
+		}}
+	}
+
+	cs := fake.NewSimpleClientset()
+	var created []*batchv1.Job
+	cs.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateAction)
+		job := create.GetObject().(*batchv1.Job)
+		created = append(created, job)
+		if job.Spec.Template.Spec.Containers[0].Image == "untrusted" {
+			return true, nil, apierrors.NewForbidden(batchv1.Resource("jobs"), job.Name, errForbiddenImage)
+		}
+		return true, job, nil
+	})
+
+	err := verifyCronJobs(context.Background(), cs, ResourceList{cronJob("backup", "trusted"), cronJob("report", "untrusted")}, nopLogger)
+	if err == nil {
+		t.Fatal("expected the Job of the CronJob with the untrusted image to be rejected")
+	}
+	if len(created) != 2 {
+		t.Fatalf("expected 2 Jobs to be verified, got %d", len(created))
+	}
+	if created[0].Name != "backup-verify" || created[0].Labels["app"] != "backup" {
+		t.Errorf("unexpected Job %s with labels %v", created[0].Name, created[0].Labels)
+	}
+}
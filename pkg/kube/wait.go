@@ -37,17 +37,27 @@ import (
 )
 
 type waiter struct {
+	// ctx, if set, bounds the wait along with the timeout.
+	ctx     context.Context
 	c       ReadyChecker
 	timeout time.Duration
 	log     func(string, ...interface{})
 }
 
+func (w *waiter) baseContext() context.Context {
+	if w.ctx == nil {
+		return context.Background()
+	}
+
+	return w.ctx
+}
+
 // waitForResources polls to get the current status of all pods, PVCs, Services and
 // Jobs(optional) until all are ready or a timeout is reached
 func (w *waiter) waitForResources(created ResourceList) error {
 	w.log("beginning wait for %d resources with timeout of %v", len(created), w.timeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	ctx, cancel := context.WithTimeout(w.baseContext(), w.timeout)
 	defer cancel()
 
 	return wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
@@ -65,7 +75,7 @@ func (w *waiter) waitForResources(created ResourceList) error {
 func (w *waiter) waitForDeletedResources(deleted ResourceList) error {
 	w.log("beginning wait for %d resources to be deleted with timeout of %v", len(deleted), w.timeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	ctx, cancel := context.WithTimeout(w.baseContext(), w.timeout)
 	defer cancel()
 
 	return wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
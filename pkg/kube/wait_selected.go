@@ -0,0 +1,68 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// WaitForSelected waits up to the given timeout for at least minReady resources
+// of the type of the given resource, matching the label selector in its
+// namespace, to be ready. The resources are listed on every check, so the ones
+// created while waiting, e.g. by an operator, are taken into account.
+func (c *Client) WaitForSelected(kind *resource.Info, selector string, minReady int, waitForJobs bool, timeout time.Duration) error {
+	cs, err := c.getKubeClient()
+	if err != nil {
+		return err
+	}
+	checker := NewReadyChecker(cs, c.Log, PausedAsReady(true), CheckJobs(waitForJobs), DefaultReadinessEngine(c.ReadinessEngine))
+
+	namespace := kind.Namespace
+	if namespace == "" {
+		namespace = c.namespace()
+	}
+	resourceType := kind.Mapping.Resource.GroupResource().String()
+
+	c.Log("beginning wait for at least %d %s matching %q with timeout of %v", minReady, resourceType, selector, timeout)
+
+	ctx, cancel := context.WithTimeout(c.baseContext(), timeout)
+	defer cancel()
+
+	var ready, total int
+	err = wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		infos, err := c.Factory.NewBuilder().
+			Unstructured().
+			ContinueOnError().
+			NamespaceParam(namespace).
+			DefaultNamespace().
+			ResourceTypeOrNameArgs(true, resourceType).
+			LabelSelectorParam(selector).
+			Flatten().
+			Do().Infos()
+		if err != nil {
+			return false, errors.Wrapf(err, "unable to get %s matching selector %q", resourceType, selector)
+		}
+
+		ready, total = 0, len(infos)
+		for _, info := range infos {
+			isReady, err := checker.IsReady(ctx, info)
+			if err != nil {
+				return false, err
+			}
+			if isReady {
+				ready++
+			}
+		}
+
+		return ready >= minReady, nil
+	})
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %d of %d %s matching %q are ready, at least %d expected", err, ready, total, resourceType, selector, minReady)
+	}
+
+	return err
+}
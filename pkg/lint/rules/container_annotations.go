@@ -0,0 +1,35 @@
+package rules
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+// validateContainerAnnotations checks that the containers named in the container-targeting werf
+// annotations of workloads exist in their pod templates the way the deploy does, see
+// kube.ValidateLoggedContainers. Otherwise the annotations are silently ignored during the deploy.
+func validateContainerAnnotations(manifest string) error {
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(manifest), 4096)
+
+	var resources kube.ResourceList
+	for {
+		var obj map[string]interface{}
+		if err := decoder.Decode(&obj); err != nil {
+			// Invalid YAML is reported by the other rules.
+			break
+		}
+		if obj == nil {
+			continue
+		}
+
+		u := &unstructured.Unstructured{Object: obj}
+		resources = append(resources, &resource.Info{Name: u.GetName(), Namespace: u.GetNamespace(), Object: u})
+	}
+
+	return kube.ValidateLoggedContainers(resources)
+}
@@ -0,0 +1,78 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateContainerAnnotations(t *testing.T) {
+	manifest := func(annotations string) string {
+		return `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: backend
+  annotations:
+` + annotations + `
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+      containers:
+      - name: app
+      - name: sidecar
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  annotations:
+    werf.io/show-logs-only-for-containers: anything
+`
+	}
+
+	valid := []string{
+		`    werf.io/show-logs-only-for-containers: app, migrate`,
+		`    werf.io/skip-logs-for-containers: sidecar`,
+		`    werf.io/log-regex-for-app: ".*ERROR.*"`,
+	}
+	for _, annotations := range valid {
+		if err := validateContainerAnnotations(manifest(annotations)); err != nil {
+			t.Errorf("unexpected error for %q: %s", annotations, err)
+		}
+	}
+
+	invalid := map[string]string{
+		`    werf.io/show-logs-only-for-containers: app,backend`: `refers to container "backend"`,
+		`    werf.io/skip-logs-for-containers: worker`:           `refers to container "worker"`,
+		`    werf.io/log-regex-for-web: ".*"`:                    `annotation werf.io/log-regex-for-web refers to container "web"`,
+	}
+	for annotations, expected := range invalid {
+		err := validateContainerAnnotations(manifest(annotations))
+		if err == nil {
+			t.Errorf("expected an error for %q", annotations)
+			continue
+		}
+		if !strings.Contains(err.Error(), expected) || !strings.Contains(err.Error(), "containers: app, migrate, sidecar") {
+			t.Errorf("unexpected error for %q: %s", annotations, err)
+		}
+	}
+
+	cronJob := `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+  annotations:
+    werf.io/skip-logs-for-containers: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: cleanup
+`
+	if err := validateContainerAnnotations(cronJob); err != nil {
+		t.Errorf("unexpected error for CronJob: %s", err)
+	}
+}
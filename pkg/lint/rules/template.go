@@ -36,7 +36,9 @@ import (
 	"github.com/werf/3p-helm/pkg/chart/loader"
 	"github.com/werf/3p-helm/pkg/chartutil"
 	"github.com/werf/3p-helm/pkg/engine"
+	"github.com/werf/3p-helm/pkg/kube"
 	"github.com/werf/3p-helm/pkg/lint/support"
+	"github.com/werf/3p-helm/pkg/phases"
 )
 
 var (
@@ -107,7 +109,7 @@ func TemplatesWithKubeVersion(linter *support.Linter, values map[string]interfac
 	}
 
 	/* Iterate over all the templates to check:
-	- It is a .yaml file
+	- It is a .yaml or .json file
 	- All the values in the template file is defined
 	- {{}} include | quote
 	- Generated content is a valid Yaml file
@@ -123,8 +125,8 @@ func TemplatesWithKubeVersion(linter *support.Linter, values map[string]interfac
 		linter.RunLinterRule(support.WarningSev, fpath, validateNoCRDHooks(data))
 		linter.RunLinterRule(support.ErrorSev, fpath, validateNoReleaseTime(data))
 
-		// We only apply the following lint rules to yaml files
-		if filepath.Ext(fileName) != ".yaml" || filepath.Ext(fileName) == ".yml" {
+		// We only apply the following lint rules to yaml and json files
+		if ext := filepath.Ext(fileName); ext != ".yaml" && ext != ".json" {
 			continue
 		}
 
@@ -165,8 +167,17 @@ func TemplatesWithKubeVersion(linter *support.Linter, values map[string]interfac
 
 					linter.RunLinterRule(support.ErrorSev, fpath, validateMatchSelector(yamlStruct, renderedContent))
 					linter.RunLinterRule(support.ErrorSev, fpath, validateListAnnotations(yamlStruct, renderedContent))
+					linter.RunLinterRule(support.ErrorSev, fpath, validateReadyConditionAnnotation(yamlStruct))
+					linter.RunLinterRule(support.ErrorSev, fpath, validateIgnoreFieldsAnnotation(yamlStruct))
+					linter.RunLinterRule(support.ErrorSev, fpath, validateTrackAnnotation(yamlStruct))
+					linter.RunLinterRule(support.ErrorSev, fpath, validateFailuresAllowedAnnotations(yamlStruct))
+					linter.RunLinterRule(support.ErrorSev, fpath, validateTrackCompletionsRequiredAnnotation(yamlStruct))
+					linter.RunLinterRule(support.ErrorSev, fpath, validatePhaseAnnotation(yamlStruct))
+					linter.RunLinterRule(support.ErrorSev, fpath, validateCanaryStepsAnnotation(yamlStruct))
 				}
 			}
+
+			linter.RunLinterRule(support.ErrorSev, fpath, validateContainerAnnotations(renderedContent))
 		}
 	}
 }
@@ -209,7 +220,7 @@ func validateTemplatesDir(templatesPath string) error {
 
 func validateAllowedExtension(fileName string) error {
 	ext := filepath.Ext(fileName)
-	validExtensions := []string{".yaml", ".yml", ".tpl", ".txt"}
+	validExtensions := []string{".yaml", ".yml", ".json", ".tpl", ".txt"}
 
 	for _, b := range validExtensions {
 		if b == ext {
@@ -217,7 +228,7 @@ func validateAllowedExtension(fileName string) error {
 		}
 	}
 
-	return errors.Errorf("file extension '%s' not valid. Valid extensions are .yaml, .yml, .tpl, or .txt", ext)
+	return errors.Errorf("file extension '%s' not valid. Valid extensions are .yaml, .yml, .json, .tpl, or .txt", ext)
 }
 
 func validateYamlContent(err error) error {
@@ -335,6 +346,111 @@ func validateListAnnotations(yamlStruct *K8sYamlStruct, manifest string) error {
 	return nil
 }
 
+// validateReadyConditionAnnotation ensures that the readiness condition of the
+// resource, if any, is a valid JSONPath expression.
+func validateReadyConditionAnnotation(yamlStruct *K8sYamlStruct) error {
+	expression, found := yamlStruct.Metadata.Annotations[kube.ReadyConditionAnnotation]
+	if !found {
+		return nil
+	}
+
+	if _, err := kube.ParseReadyCondition(expression); err != nil {
+		return fmt.Errorf("annotation %s of %s %q: %w", kube.ReadyConditionAnnotation, yamlStruct.Kind, yamlStruct.Metadata.Name, err)
+	}
+	return nil
+}
+
+// validateIgnoreFieldsAnnotation ensures that the fields ignored when updating
+// the resource, if any, are valid paths.
+func validateIgnoreFieldsAnnotation(yamlStruct *K8sYamlStruct) error {
+	value, found := yamlStruct.Metadata.Annotations[kube.IgnoreFieldsAnnotation]
+	if !found {
+		return nil
+	}
+
+	if _, err := kube.ParseIgnoreFields(value); err != nil {
+		return fmt.Errorf("annotation %s of %s %q: %w", kube.IgnoreFieldsAnnotation, yamlStruct.Kind, yamlStruct.Metadata.Name, err)
+	}
+	return nil
+}
+
+// validateTrackAnnotation ensures that the readiness tracking of the resource,
+// if set, is a boolean.
+func validateTrackAnnotation(yamlStruct *K8sYamlStruct) error {
+	value, found := yamlStruct.Metadata.Annotations[kube.TrackAnnotation]
+	if !found {
+		return nil
+	}
+
+	if _, err := kube.ParseTrack(value); err != nil {
+		return fmt.Errorf("annotation %s of %s %q: %w", kube.TrackAnnotation, yamlStruct.Kind, yamlStruct.Metadata.Name, err)
+	}
+	return nil
+}
+
+// validateFailuresAllowedAnnotations ensures that the numbers of the failures
+// tolerated while tracking the resource, if set, are non-negative integers.
+func validateFailuresAllowedAnnotations(yamlStruct *K8sYamlStruct) error {
+	for _, annotation := range []string{kube.FailuresAllowedAnnotation, kube.FailuresAllowedPerReplicaAnnotation} {
+		value, found := yamlStruct.Metadata.Annotations[annotation]
+		if !found {
+			continue
+		}
+
+		if _, err := kube.ParseFailuresAllowed(value); err != nil {
+			return fmt.Errorf("annotation %s of %s %q: %w", annotation, yamlStruct.Kind, yamlStruct.Metadata.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateTrackCompletionsRequiredAnnotation ensures that the number of the
+// completions after which the resource is ready, if set, is a positive
+// integer.
+func validateTrackCompletionsRequiredAnnotation(yamlStruct *K8sYamlStruct) error {
+	value, found := yamlStruct.Metadata.Annotations[kube.TrackCompletionsRequiredAnnotation]
+	if !found {
+		return nil
+	}
+
+	if _, err := kube.ParseCompletionsRequired(value); err != nil {
+		return fmt.Errorf("annotation %s of %s %q: %w", kube.TrackCompletionsRequiredAnnotation, yamlStruct.Kind, yamlStruct.Metadata.Name, err)
+	}
+	return nil
+}
+
+// validatePhaseAnnotation ensures that the rollout phase the resource is pinned
+// to, if set, is known.
+func validatePhaseAnnotation(yamlStruct *K8sYamlStruct) error {
+	value, found := yamlStruct.Metadata.Annotations[phases.PhaseAnnotation]
+	if !found {
+		return nil
+	}
+
+	if _, err := phases.ParsePhase(value); err != nil {
+		return fmt.Errorf("annotation %s of %s %q: %w", phases.PhaseAnnotation, yamlStruct.Kind, yamlStruct.Metadata.Name, err)
+	}
+	return nil
+}
+
+// validateCanaryStepsAnnotation ensures that the canary steps, if set, are
+// set on a Deployment and are ascending percentages of its replicas.
+func validateCanaryStepsAnnotation(yamlStruct *K8sYamlStruct) error {
+	value, found := yamlStruct.Metadata.Annotations[phases.CanaryStepsAnnotation]
+	if !found {
+		return nil
+	}
+
+	if yamlStruct.Kind != "Deployment" || !strings.HasPrefix(yamlStruct.APIVersion, "apps/") {
+		return fmt.Errorf("annotation %s of %s %q: only Deployments are supported", phases.CanaryStepsAnnotation, yamlStruct.Kind, yamlStruct.Metadata.Name)
+	}
+
+	if _, err := phases.ParseCanarySteps(value); err != nil {
+		return fmt.Errorf("annotation %s of %s %q: %w", phases.CanaryStepsAnnotation, yamlStruct.Kind, yamlStruct.Metadata.Name, err)
+	}
+	return nil
+}
+
 // K8sYamlStruct stubs a Kubernetes YAML file.
 //
 // DEPRECATED: In Helm 4, this will be made a private type, as it is for use only within
@@ -346,6 +462,7 @@ type K8sYamlStruct struct {
 }
 
 type k8sYamlMetadata struct {
-	Namespace string
-	Name      string
+	Namespace   string
+	Name        string
+	Annotations map[string]string
 }
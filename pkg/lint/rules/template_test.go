@@ -34,11 +34,11 @@ func TestValidateAllowedExtension(t *testing.T) {
 	var failTest = []string{"/foo", "/test.toml"}
 	for _, test := range failTest {
 		err := validateAllowedExtension(test)
-		if err == nil || !strings.Contains(err.Error(), "Valid extensions are .yaml, .yml, .tpl, or .txt") {
-			t.Errorf("validateAllowedExtension('%s') to return \"Valid extensions are .yaml, .yml, .tpl, or .txt\", got no error", test)
+		if err == nil || !strings.Contains(err.Error(), "Valid extensions are .yaml, .yml, .json, .tpl, or .txt") {
+			t.Errorf("validateAllowedExtension('%s') to return \"Valid extensions are .yaml, .yml, .json, .tpl, or .txt\", got no error", test)
 		}
 	}
-	var successTest = []string{"/foo.yaml", "foo.yaml", "foo.tpl", "/foo/bar/baz.yaml", "NOTES.txt"}
+	var successTest = []string{"/foo.yaml", "foo.yaml", "foo.tpl", "/foo/bar/baz.yaml", "foo.json", "NOTES.txt"}
 	for _, test := range successTest {
 		err := validateAllowedExtension(test)
 		if err != nil {
@@ -458,3 +458,147 @@ items:
 		t.Fatalf("List objects keep annotations should pass. got: %s", err)
 	}
 }
+
+func TestValidateReadyConditionAnnotation(t *testing.T) {
+	md := &K8sYamlStruct{
+		APIVersion: "example.com/v1",
+		Kind:       "Database",
+		Metadata: k8sYamlMetadata{
+			Name:        "db",
+			Annotations: map[string]string{"werf.io/ready-condition": "{.status.phase}=Running"},
+		},
+	}
+	if err := validateReadyConditionAnnotation(md); err != nil {
+		t.Fatalf("valid ready condition should pass. got: %s", err)
+	}
+
+	md.Metadata.Annotations["werf.io/ready-condition"] = ".status.phase == 'Running'"
+	if err := validateReadyConditionAnnotation(md); err == nil {
+		t.Fatal("expected invalid ready condition to fail")
+	}
+
+	md.Metadata.Annotations = nil
+	if err := validateReadyConditionAnnotation(md); err != nil {
+		t.Fatalf("resources without a ready condition should pass. got: %s", err)
+	}
+}
+
+func TestValidateIgnoreFieldsAnnotation(t *testing.T) {
+	md := &K8sYamlStruct{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata: k8sYamlMetadata{
+			Name:        "app",
+			Annotations: map[string]string{"werf.io/ignore-fields": "{.spec.replicas}, .spec.template.spec.containers[1]"},
+		},
+	}
+	if err := validateIgnoreFieldsAnnotation(md); err != nil {
+		t.Fatalf("valid ignored fields should pass. got: %s", err)
+	}
+
+	md.Metadata.Annotations["werf.io/ignore-fields"] = ".spec.containers[?(@.name==\"sidecar\")]"
+	if err := validateIgnoreFieldsAnnotation(md); err == nil {
+		t.Fatal("expected invalid ignored fields to fail")
+	}
+}
+
+func TestValidateTrackAnnotation(t *testing.T) {
+	md := &K8sYamlStruct{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata: k8sYamlMetadata{
+			Name:        "app",
+			Annotations: map[string]string{"werf.io/track": "false"},
+		},
+	}
+	if err := validateTrackAnnotation(md); err != nil {
+		t.Fatalf("valid tracking should pass. got: %s", err)
+	}
+
+	md.Metadata.Annotations["werf.io/track"] = "never"
+	if err := validateTrackAnnotation(md); err == nil {
+		t.Fatal("expected invalid tracking to fail")
+	}
+}
+
+func TestValidateFailuresAllowedAnnotations(t *testing.T) {
+	md := &K8sYamlStruct{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata: k8sYamlMetadata{
+			Name:        "app",
+			Annotations: map[string]string{"werf.io/failures-allowed": "3", "werf.io/failures-allowed-per-replica": "0"},
+		},
+	}
+	if err := validateFailuresAllowedAnnotations(md); err != nil {
+		t.Fatalf("valid failures allowed should pass. got: %s", err)
+	}
+
+	md.Metadata.Annotations["werf.io/failures-allowed"] = "-1"
+	if err := validateFailuresAllowedAnnotations(md); err == nil {
+		t.Fatal("expected negative failures allowed to fail")
+	}
+}
+
+func TestValidateTrackCompletionsRequiredAnnotation(t *testing.T) {
+	md := &K8sYamlStruct{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Metadata: k8sYamlMetadata{
+			Name:        "migrate",
+			Annotations: map[string]string{"werf.io/track-completions-required": "3"},
+		},
+	}
+	if err := validateTrackCompletionsRequiredAnnotation(md); err != nil {
+		t.Fatalf("valid completions required should pass. got: %s", err)
+	}
+
+	md.Metadata.Annotations["werf.io/track-completions-required"] = "0"
+	if err := validateTrackCompletionsRequiredAnnotation(md); err == nil {
+		t.Fatal("expected zero completions required to fail")
+	}
+}
+
+func TestValidatePhaseAnnotation(t *testing.T) {
+	md := &K8sYamlStruct{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata: k8sYamlMetadata{
+			Name:        "maintenance-page",
+			Annotations: map[string]string{"werf.io/phase": "pre-rollout"},
+		},
+	}
+	if err := validatePhaseAnnotation(md); err != nil {
+		t.Fatalf("valid phase should pass. got: %s", err)
+	}
+
+	md.Metadata.Annotations["werf.io/phase"] = "before"
+	if err := validatePhaseAnnotation(md); err == nil {
+		t.Fatal("expected unknown phase to fail")
+	}
+}
+
+func TestValidateCanaryStepsAnnotation(t *testing.T) {
+	md := &K8sYamlStruct{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata: k8sYamlMetadata{
+			Name:        "app",
+			Annotations: map[string]string{"werf.io/canary-steps": "10,50"},
+		},
+	}
+	if err := validateCanaryStepsAnnotation(md); err != nil {
+		t.Fatalf("valid canary steps should pass. got: %s", err)
+	}
+
+	md.Metadata.Annotations["werf.io/canary-steps"] = "50,10"
+	if err := validateCanaryStepsAnnotation(md); err == nil {
+		t.Fatal("expected descending canary steps to fail")
+	}
+
+	md.Metadata.Annotations["werf.io/canary-steps"] = "10"
+	md.APIVersion, md.Kind = "apps/v1", "StatefulSet"
+	if err := validateCanaryStepsAnnotation(md); err == nil {
+		t.Fatal("expected canary steps of a StatefulSet to fail")
+	}
+}
@@ -0,0 +1,216 @@
+// Package messages is the catalog of the user-facing messages of the deploy
+// engine: the errors and the log messages of the rollout, of the deploy
+// executor and of the validation of the release. Embedders shipping
+// non-English tooling translate them by setting a Localizer instead of forking
+// the strings.
+package messages
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ID identifies a message of the catalog.
+type ID string
+
+// The rollout messages.
+const (
+	RolloutCalculatePreviouslyDeployed ID = "rollout.calculate-previously-deployed"
+	RolloutTrackExternalDependencies   ID = "rollout.track-external-dependencies"
+	RolloutUpdateRelease               ID = "rollout.update-release"
+	RolloutTrackResources              ID = "rollout.track-resources"
+	RolloutCalculateGenerations        ID = "rollout.calculate-generations"
+	RolloutSplitOrphans                ID = "rollout.split-orphans"
+	RolloutDeleteOrphans               ID = "rollout.delete-orphans"
+	RolloutOrphanKeptByPolicy          ID = "rollout.orphan-kept-by-policy"
+	RolloutOrphanKeptByAnnotation      ID = "rollout.orphan-kept-by-annotation"
+	RolloutAPIServerReachable          ID = "rollout.api-server-reachable"
+	RolloutAPIServerUnavailable        ID = "rollout.api-server-unavailable"
+	RolloutAPIServerBudgetExceeded     ID = "rollout.api-server-budget-exceeded"
+	RolloutDeleteCanaries              ID = "rollout.delete-canaries"
+)
+
+// The messages of the deploy executor running the hooks and the rollout of
+// the install, upgrade and rollback.
+const (
+	ExecutorGetReleaseHistory             ID = "executor.get-release-history"
+	ExecutorBeforeHooks                   ID = "executor.before-hooks"
+	ExecutorBeforePlanningRollout         ID = "executor.before-planning-rollout"
+	ExecutorParseStages                   ID = "executor.parse-stages"
+	ExecutorGenerateExternalDependencies  ID = "executor.generate-external-dependencies"
+	ExecutorAfterPlanningRollout          ID = "executor.after-planning-rollout"
+	ExecutorCalculatePreviouslyDeployed   ID = "executor.calculate-previously-deployed"
+	ExecutorBeforeRollout                 ID = "executor.before-rollout"
+	ExecutorCheckStoredVersions           ID = "executor.check-stored-versions"
+	ExecutorRelaxPodDisruptionBudgets     ID = "executor.relax-pod-disruption-budgets"
+	ExecutorRestorePodDisruptionBudget    ID = "executor.restore-pod-disruption-budget"
+	ExecutorWaitForDependencies           ID = "executor.wait-for-dependencies"
+	ExecutorWaitForExternalDependency     ID = "executor.wait-for-external-dependency"
+	ExecutorExternalDependencyNotReady    ID = "executor.external-dependency-not-ready"
+	ExecutorExternalDependencyGoingOn     ID = "executor.external-dependency-going-on"
+	ExecutorExternalDependencySkipped     ID = "executor.external-dependency-skipped"
+	ExecutorWaitForCanaries               ID = "executor.wait-for-canaries"
+	ExecutorProcessStage                  ID = "executor.process-stage"
+	ExecutorUnsupportedResourceSkipped    ID = "executor.unsupported-resource-skipped"
+	ExecutorUnsupportedResourceNotTracked ID = "executor.unsupported-resource-not-tracked"
+)
+
+// The validation messages of the release and of its deploy annotations.
+const (
+	ValidationUnknownPhase          ID = "validation.unknown-phase"
+	ValidationInvalidAnnotation     ID = "validation.invalid-annotation"
+	ValidationDependencyLaterPhase  ID = "validation.dependency-later-phase"
+	ValidationDependencyLaterStage  ID = "validation.dependency-later-stage"
+	ValidationDependencyNotFound    ID = "validation.dependency-not-found"
+	ValidationDependencyCycle       ID = "validation.dependency-cycle"
+	ValidationDependencyOption      ID = "validation.dependency-option"
+	ValidationDependencyState       ID = "validation.dependency-state"
+	ValidationDependencyCondition   ID = "validation.dependency-condition"
+	ValidationDependencyFormat      ID = "validation.dependency-format"
+	ValidationDependencyAPIVersion  ID = "validation.dependency-api-version"
+	ValidationDependencyKindAndName ID = "validation.dependency-kind-and-name"
+	ValidationCanarySteps           ID = "validation.canary-steps"
+	ValidationCanaryKind            ID = "validation.canary-kind"
+	ValidationImmutableKind         ID = "validation.immutable-kind"
+	ValidationImmutableReference    ID = "validation.immutable-reference"
+	ValidationMaxResources          ID = "validation.max-resources"
+	ValidationMaxManifestSize       ID = "validation.max-manifest-size"
+	ValidationMaxTotalManifestSize  ID = "validation.max-total-manifest-size"
+	ValidationUnsupportedResources  ID = "validation.unsupported-resources"
+	ValidationClusterScoped         ID = "validation.cluster-scoped"
+)
+
+// WarningPrefix starts the messages logged as warnings. It is not translated,
+// so that the warnings are told apart whatever the Localizer.
+const WarningPrefix = "warning: "
+
+// catalog holds the default English formats of the messages. The formats of
+// the errors wrapping another error end with %w.
+var catalog = map[ID]string{
+	RolloutCalculatePreviouslyDeployed: "error calculating previously deployed resources: %w",
+	RolloutTrackExternalDependencies:   "error tracking external dependencies: %w",
+	RolloutUpdateRelease:               "error updating release in storage: %w",
+	RolloutTrackResources:              "error tracking resources: %w",
+	RolloutCalculateGenerations:        "error calculating generations of immutable resources: %w",
+	RolloutSplitOrphans:                "error splitting orphaned resources by prune policy: %w",
+	RolloutDeleteOrphans:               "while deleting previously deployed but now orphaned resources got %d error(s): %s",
+	RolloutOrphanKeptByPolicy:          "orphaned resource %s is kept by the %s prune policy",
+	RolloutOrphanKeptByAnnotation:      "orphaned resource %s is kept due to the %s annotation",
+	RolloutAPIServerReachable:          "Kubernetes API server is reachable again, resuming %s",
+	RolloutAPIServerUnavailable:        "Kubernetes API server is unavailable while %s, rollout paused, next check in %s (%s of the budget left): %s",
+	RolloutAPIServerBudgetExceeded:     "Kubernetes API server has been unavailable for longer than %s while %s: %w",
+	RolloutDeleteCanaries:              "unable to delete canaries: %s",
+
+	ExecutorGetReleaseHistory:             "error getting release history: %w",
+	ExecutorBeforeHooks:                   "error before %s hooks: %w",
+	ExecutorBeforePlanningRollout:         "error before planning rollout phase: %w",
+	ExecutorParseStages:                   "error parsing stages for rollout phase: %w",
+	ExecutorGenerateExternalDependencies:  "error generating external deps for rollout phase: %w",
+	ExecutorAfterPlanningRollout:          "error after planning rollout phase: %w",
+	ExecutorCalculatePreviouslyDeployed:   "error calculating previously deployed resources for rollout phase manager: %w",
+	ExecutorBeforeRollout:                 "error before rollout phase: %w",
+	ExecutorCheckStoredVersions:           "error checking stored versions of custom resource definitions: %w",
+	ExecutorRelaxPodDisruptionBudgets:     "error relaxing pod disruption budgets: %w",
+	ExecutorRestorePodDisruptionBudget:    "unable to restore PodDisruptionBudget %s/%s: %s",
+	ExecutorWaitForDependencies:           "error waiting for deploy dependencies to become ready: %w",
+	ExecutorWaitForExternalDependency:     "error waiting for external dependency %q: %w",
+	ExecutorExternalDependencyNotReady:    "external dependency %q is not ready after %s: %w",
+	ExecutorExternalDependencyGoingOn:     "external dependency %q is not ready after %s, going on: %s",
+	ExecutorExternalDependencySkipped:     "external dependency %q is not ready after %s, skipping it",
+	ExecutorWaitForCanaries:               "error waiting for canaries of step %d to become ready: %w",
+	ExecutorProcessStage:                  "error processing rollout phase stage: %w",
+	ExecutorUnsupportedResourceSkipped:    "resource %s is skipped, as its readiness can't be tracked",
+	ExecutorUnsupportedResourceNotTracked: "the readiness of resource %s can't be tracked, it is applied without tracking",
+
+	ValidationUnknownPhase:          "unknown phase %q, expected %q, %q or %q",
+	ValidationInvalidAnnotation:     "invalid annotation %q of %q: %w",
+	ValidationDependencyLaterPhase:  "%q depends on %q, which is deployed in the later %s phase, fix annotation %q or %q",
+	ValidationDependencyLaterStage:  "%q depends on %q, which is deployed in a later stage with weight %d, fix the weights or annotation %q",
+	ValidationDependencyNotFound:    "%q depends on %q, which is not a resource of the release, fix annotation %q",
+	ValidationDependencyCycle:       "deploy dependency cycle: %s",
+	ValidationDependencyOption:      "unexpected option %q: expected \"state=%s\", \"state=%s\" or \"condition=<type>=<status>\"",
+	ValidationDependencyState:       "unexpected state %q: expected %q or %q",
+	ValidationDependencyCondition:   "unexpected condition %q: expected \"<type>=<status>\", e.g. \"Ready=True\"",
+	ValidationDependencyFormat:      "unexpected value %q: expected \"<apiVersion>:<kind>[:<namespace>]:<name>\"",
+	ValidationDependencyAPIVersion:  "invalid apiVersion %q",
+	ValidationDependencyKindAndName: "unexpected value %q: kind and name must not be empty",
+	ValidationCanarySteps:           "unexpected canary steps %q: expected ascending percentages of the replicas from 1 to 99, e.g. \"10,50\"",
+	ValidationCanaryKind:            "%q has annotation %q, which is only supported for Deployments",
+	ValidationImmutableKind:         "%q has annotation %q, which is only supported for immutable ConfigMaps and Secrets",
+	ValidationImmutableReference:    "%s %q can't be versioned: %s references it at %q, which can't be rewritten, remove annotation %q",
+	ValidationMaxResources:          "release has %d resources including hooks, which exceeds the limit of %d resources",
+	ValidationMaxManifestSize:       "manifest of %s is %d bytes, which exceeds the limit of %d bytes per manifest",
+	ValidationMaxTotalManifestSize:  "manifests of the release are %d bytes in total, which exceeds the limit of %d bytes",
+	ValidationUnsupportedResources:  "the readiness of %d resources can't be tracked, which the %q unsupported resources policy doesn't allow: %s",
+	ValidationClusterScoped:         "release is deployed in the cluster-scoped mode, but has %d namespaced resource(s): %s",
+}
+
+// Localizer translates the messages of the catalog.
+type Localizer interface {
+	// Localize returns the translated format of the message with the default
+	// English format, or an empty string to keep the default one. The
+	// translation must have the same verbs, in the same order, as the
+	// default format.
+	Localize(id ID, format string) string
+}
+
+// MapLocalizer is a Localizer with the translated formats by message ID.
+type MapLocalizer map[ID]string
+
+func (l MapLocalizer) Localize(id ID, _ string) string {
+	return l[id]
+}
+
+var (
+	mu        sync.RWMutex
+	localizer Localizer
+)
+
+// SetLocalizer sets the Localizer of the messages of the process, nil
+// restores the default English messages.
+func SetLocalizer(l Localizer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	localizer = l
+}
+
+// Catalog returns the default English formats of all the messages, e.g. to
+// make the translations from.
+func Catalog() map[ID]string {
+	result := make(map[ID]string, len(catalog))
+	for id, format := range catalog {
+		result[id] = format
+	}
+
+	return result
+}
+
+// Format returns the format of the message, translated by the Localizer if
+// it is set. The formats of the warnings don't include WarningPrefix, which
+// is added when they are logged.
+func Format(id ID) string {
+	format := catalog[id]
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if localizer != nil {
+		if localized := localizer.Localize(id, format); localized != "" {
+			return localized
+		}
+	}
+
+	return format
+}
+
+// Sprintf formats the message with the arguments.
+func Sprintf(id ID, args ...interface{}) string {
+	return fmt.Sprintf(Format(id), args...)
+}
+
+// Errorf returns the error with the message formatted with the arguments,
+// wrapping the argument of the %w verb.
+func Errorf(id ID, args ...interface{}) error {
+	return fmt.Errorf(Format(id), args...)
+}
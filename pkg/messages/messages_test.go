@@ -0,0 +1,38 @@
+package messages
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLocalizer(t *testing.T) {
+	cause := errors.New("connection refused")
+
+	err := Errorf(RolloutTrackResources, cause)
+	if err.Error() != "error tracking resources: connection refused" {
+		t.Errorf("unexpected default message %q", err)
+	}
+
+	SetLocalizer(MapLocalizer{RolloutTrackResources: "Fehler beim Verfolgen der Ressourcen: %w"})
+	defer SetLocalizer(nil)
+
+	err = Errorf(RolloutTrackResources, cause)
+	if err.Error() != "Fehler beim Verfolgen der Ressourcen: connection refused" {
+		t.Errorf("unexpected localized message %q", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected the localized error to wrap the cause")
+	}
+
+	if msg := Sprintf(ValidationDependencyCycle, "a -> b -> a"); msg != "deploy dependency cycle: a -> b -> a" {
+		t.Errorf("expected the messages without translation to keep the default format, got %q", msg)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	for id, format := range Catalog() {
+		if format == "" {
+			t.Errorf("message %s has no format", id)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package phases
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/phases/stages/externaldeps"
+)
+
+var _ ExternalDepsGenerator = (*AnnotationsExternalDepsGenerator)(nil)
+
+// Generates the external dependencies of the stages from the annotations of their resources, see
+// externaldeps.AnnotationSuffix. The resource types of the dependencies are resolved with the GVKBuilder behind a
+// CachingGVKBuilder, so that the resources annotated with the dependencies on the same types don't resolve them
+// again. The dependencies without a namespace are in the given one, usually the namespace of the release, or in
+// the namespace of their resource if it is empty.
+func NewAnnotationsExternalDepsGenerator(gvkBuilder externaldeps.GVKBuilder, mapper meta.RESTMapper, namespace string) *AnnotationsExternalDepsGenerator {
+	return &AnnotationsExternalDepsGenerator{
+		gvkBuilder: externaldeps.NewCachingGVKBuilder(gvkBuilder),
+		mapper:     mapper,
+		namespace:  namespace,
+	}
+}
+
+type AnnotationsExternalDepsGenerator struct {
+	gvkBuilder externaldeps.GVKBuilder
+	mapper     meta.RESTMapper
+	namespace  string
+}
+
+func (g *AnnotationsExternalDepsGenerator) Generate(sortedStages stages.SortedStageList) error {
+	for _, stg := range sortedStages {
+		for _, res := range stg.DesiredResources {
+			annotations, err := metadataAccessor.Annotations(res.Object)
+			if err != nil {
+				return fmt.Errorf("error getting annotations of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+			}
+
+			deps, err := externaldeps.ParseAnnotations(annotations)
+			if err != nil {
+				return fmt.Errorf("error parsing external dependencies of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+			}
+
+			for _, dep := range deps {
+				if dep.Namespace == "" {
+					dep.Namespace = g.namespace
+				}
+				if dep.Namespace == "" {
+					dep.Namespace = res.Namespace
+				}
+
+				if err := dep.GenerateInfo(g.gvkBuilder, metadataAccessor, g.mapper); err != nil {
+					return fmt.Errorf("error generating external dependency %q of %q: %w", dep.Name, kube.ResourceNameNamespaceKind(res), err)
+				}
+			}
+
+			stg.ExternalDependencies = append(stg.ExternalDependencies, deps...)
+		}
+	}
+
+	return nil
+}
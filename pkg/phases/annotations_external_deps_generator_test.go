@@ -0,0 +1,113 @@
+package phases
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/phases/stages"
+)
+
+var widgetGVK = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+// countingGVKBuilder resolves the widgets and counts the resolutions, failing for the other resources, which are
+// only resolved by the table of the common resources of the CachingGVKBuilder.
+type countingGVKBuilder struct {
+	calls int
+}
+
+func (b *countingGVKBuilder) BuildFromResource(resource string) (*schema.GroupVersionKind, error) {
+	b.calls++
+	if resource != "widgets" {
+		return nil, fmt.Errorf("unknown resource %q", resource)
+	}
+
+	gvk := widgetGVK
+	return &gvk, nil
+}
+
+func newAnnotatedResource(name string, annotations map[string]string) *resource.Info {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetName(name)
+	obj.SetAnnotations(annotations)
+
+	return &resource.Info{Name: name, Namespace: "app", Object: obj}
+}
+
+func TestAnnotationsExternalDepsGenerator(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(widgetGVK, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	stg := &stages.Stage{}
+	stg.DesiredResources.Append(newAnnotatedResource("first", map[string]string{
+		"db.external-dependency.werf.io/resource":      "widgets/db",
+		"backend.external-dependency.werf.io/resource": "deploy/backend",
+		"unrelated": "annotation",
+	}))
+	stg.DesiredResources.Append(newAnnotatedResource("second", map[string]string{
+		"cache.external-dependency.werf.io/resource":  "widgets/cache",
+		"cache.external-dependency.werf.io/namespace": "infra",
+	}))
+	stg.DesiredResources.Append(newAnnotatedResource("third", nil))
+
+	builder := &countingGVKBuilder{}
+	if err := NewAnnotationsExternalDepsGenerator(builder, mapper, "app").Generate(stages.SortedStageList{stg}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, dep := range stg.ExternalDependencies {
+		got = append(got, dep.Name+" "+dep.Info.Namespace+"/"+dep.Info.Object.GetObjectKind().GroupVersionKind().Kind+"/"+dep.Info.Name)
+	}
+	expected := []string{"backend app/Deployment/backend", "db app/Widget/db", "cache infra/Widget/cache"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, got)
+			break
+		}
+	}
+
+	if builder.calls != 2 {
+		t.Errorf("expected the widgets and the deployments to be resolved once, got %d resolutions", builder.calls)
+	}
+}
+
+func TestAnnotationsExternalDepsGeneratorResourceNamespace(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(widgetGVK, meta.RESTScopeNamespace)
+
+	stg := &stages.Stage{}
+	stg.DesiredResources.Append(newAnnotatedResource("first", map[string]string{
+		"db.external-dependency.werf.io/resource": "widgets/db",
+	}))
+
+	if err := NewAnnotationsExternalDepsGenerator(&countingGVKBuilder{}, mapper, "").Generate(stages.SortedStageList{stg}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := stg.ExternalDependencies[0].Info.Namespace; got != "app" {
+		t.Errorf("expected the dependency in the namespace of its resource, got %q", got)
+	}
+}
+
+func TestAnnotationsExternalDepsGeneratorInvalidAnnotation(t *testing.T) {
+	stg := &stages.Stage{}
+	stg.DesiredResources.Append(newAnnotatedResource("first", map[string]string{
+		"db.external-dependency.werf.io/resource": "widgets",
+	}))
+
+	err := NewAnnotationsExternalDepsGenerator(&countingGVKBuilder{}, meta.NewDefaultRESTMapper(nil), "app").Generate(stages.SortedStageList{stg})
+	if err == nil {
+		t.Error("expected an error for a dependency without a resource name or a selector")
+	}
+}
@@ -0,0 +1,164 @@
+package phases
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+)
+
+// Rolls the new version of a Deployment out to a part of its replicas first, e.g. "werf.io/canary-steps: 10,50". For
+// every step, a stage applying a canary of the Deployment, a copy with the new pod template named with the "-canary"
+// suffix, with the percentage of the replicas of the step, is inserted before the stage of the Deployment. The canary
+// is waited for to be ready and verified with the "canary-verify" hooks of the release after every step. Its pods
+// keep the labels of the pods of the Deployment, so that they get the traffic of its Services, along with
+// CanaryLabel. The full update of the Deployment follows the last step, and the canary is deleted once the stage of
+// the Deployment is tracked, or if the deploy fails.
+const CanaryStepsAnnotation = "werf.io/canary-steps"
+
+// Set to the name of the Deployment on its canary, on the pods of the canary and in the selector of the canary, so
+// that the canary doesn't select the pods of the Deployment.
+const CanaryLabel = "werf.io/canary"
+
+const canaryNameSuffix = "-canary"
+
+// Parses the value of CanaryStepsAnnotation: the ascending percentages of the replicas of the steps.
+func ParseCanarySteps(value string) ([]int, error) {
+	var steps []int
+	for _, part := range strings.Split(value, ",") {
+		percent, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || percent < 1 || percent > 99 || len(steps) > 0 && percent <= steps[len(steps)-1] {
+			return nil, messages.Errorf(messages.ValidationCanarySteps, value)
+		}
+		steps = append(steps, percent)
+	}
+
+	return steps, nil
+}
+
+// Inserts the stages applying the canaries of the Deployments annotated with CanaryStepsAnnotation before their
+// stages, one stage per step. The first canary stage takes over the dependencies of the stage of the Deployments, so
+// that they are met before the canaries are applied. Stages without canaries are kept as they are.
+func SplitStagesByCanarySteps(sortedStages stages.SortedStageList) (stages.SortedStageList, error) {
+	var result stages.SortedStageList
+	for _, stg := range sortedStages {
+		var canaryStages stages.SortedStageList
+		for _, res := range stg.DesiredResources {
+			steps, err := canaryStepsOf(res)
+			if err != nil {
+				return nil, err
+			}
+
+			for i, percent := range steps {
+				canary, err := newCanary(res, percent)
+				if err != nil {
+					return nil, err
+				}
+
+				if len(canaryStages) <= i {
+					canaryStages = append(canaryStages, &stages.Stage{Phase: stg.Phase, Weight: stg.Weight, CanaryStep: i + 1})
+				}
+				canaryStages[i].DesiredResources.Append(canary)
+
+				if i == len(steps)-1 {
+					stg.Canaries.Append(canary)
+				}
+			}
+		}
+
+		if len(canaryStages) > 0 {
+			first := canaryStages[0]
+			first.ExternalDependencies, stg.ExternalDependencies = stg.ExternalDependencies, nil
+			first.ReadyDependencies, stg.ReadyDependencies = stg.ReadyDependencies, nil
+			first.ConditionDependencies, stg.ConditionDependencies = stg.ConditionDependencies, nil
+		}
+
+		result = append(result, canaryStages...)
+		result = append(result, stg)
+	}
+
+	return result, nil
+}
+
+// Returns nil if the resource has no CanaryStepsAnnotation.
+func canaryStepsOf(res *resource.Info) ([]int, error) {
+	annotations, err := metadataAccessor.Annotations(res.Object)
+	if err != nil {
+		return nil, fmt.Errorf("error getting annotations of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	value, found := annotations[CanaryStepsAnnotation]
+	if !found {
+		return nil, nil
+	}
+
+	if gvk := res.Object.GetObjectKind().GroupVersionKind(); gvk.Group != "apps" || gvk.Kind != "Deployment" {
+		return nil, messages.Errorf(messages.ValidationCanaryKind, kube.ResourceNameNamespaceKind(res), CanaryStepsAnnotation)
+	}
+
+	steps, err := ParseCanarySteps(value)
+	if err != nil {
+		return nil, messages.Errorf(messages.ValidationInvalidAnnotation, CanaryStepsAnnotation, kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	return steps, nil
+}
+
+// Returns the canary of the Deployment running the percentage of its replicas, at least one.
+func newCanary(res *resource.Info, percent int) (*resource.Info, error) {
+	obj, ok := res.Object.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T of %q", res.Object, kube.ResourceNameNamespaceKind(res))
+	}
+
+	canary := obj.DeepCopy()
+	canary.SetName(obj.GetName() + canaryNameSuffix)
+
+	// The canary is ordered by the stage of the Deployment, its own annotations would only order it once more.
+	annotations := canary.GetAnnotations()
+	for key := range annotations {
+		if key == CanaryStepsAnnotation || strings.HasPrefix(key, DeployDependencyAnnotationPrefix) {
+			delete(annotations, key)
+		}
+	}
+	canary.SetAnnotations(annotations)
+
+	labels := canary.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[CanaryLabel] = obj.GetName()
+	canary.SetLabels(labels)
+
+	for _, path := range [][]string{{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}} {
+		if err := unstructured.SetNestedField(canary.Object, obj.GetName(), append(path, CanaryLabel)...); err != nil {
+			return nil, fmt.Errorf("error setting canary label of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+		}
+	}
+
+	replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if err != nil || !found {
+		replicas = 1
+	}
+	canaryReplicas := (replicas*int64(percent) + 99) / 100
+	if canaryReplicas < 1 {
+		canaryReplicas = 1
+	}
+	if err := unstructured.SetNestedField(canary.Object, canaryReplicas, "spec", "replicas"); err != nil {
+		return nil, fmt.Errorf("error setting canary replicas of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	return &resource.Info{
+		Client:    res.Client,
+		Mapping:   res.Mapping,
+		Namespace: res.Namespace,
+		Name:      canary.GetName(),
+		Object:    canary,
+	}, nil
+}
@@ -0,0 +1,344 @@
+package phases
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+)
+
+// Annotations with this prefix declare that the resource depends on another resource of the release, e.g.
+// "werf.io/deploy-dependency-db: apps/v1:StatefulSet:postgres,state=ready". The dependency is referenced as
+// "<apiVersion>:<kind>[:<namespace>]:<name>", the namespace of the dependent resource is used if omitted.
+// With the default "present" state the resource is applied after the dependency is applied, with the "ready"
+// state also after the dependency becomes ready. With the "condition=<type>=<status>" option, e.g.
+// "apps/v1:StatefulSet:postgres,condition=Ready=True", the resource is applied once the dependency has the
+// condition in its status.conditions, e.g. for the custom resources whose readiness is only reported with a
+// condition.
+const DeployDependencyAnnotationPrefix = "werf.io/deploy-dependency-"
+
+type DeployDependencyState string
+
+const (
+	DeployDependencyStatePresent DeployDependencyState = "present"
+	DeployDependencyStateReady   DeployDependencyState = "ready"
+)
+
+type deployDependency struct {
+	annotation string
+
+	groupKind schema.GroupKind
+	namespace string
+	name      string
+	state     DeployDependencyState
+	condition *kube.ResourceCondition
+	// Detected from the spec of the resource rather than declared with an annotation.
+	detected bool
+}
+
+func (d *deployDependency) String() string {
+	if d.namespace == "" {
+		return fmt.Sprintf("%s/%s", d.groupKind.Kind, d.name)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", d.namespace, d.groupKind.Kind, d.name)
+}
+
+func (d *deployDependency) matches(dependent, res *resource.Info) bool {
+	gvk := res.Object.GetObjectKind().GroupVersionKind()
+	if gvk.GroupKind() != d.groupKind || res.Name != d.name {
+		return false
+	}
+
+	if d.namespace != "" {
+		return res.Namespace == d.namespace
+	}
+
+	return res.Namespace == dependent.Namespace || res.Namespace == ""
+}
+
+// DeployDependency is a dependency of a resource of the release on another one.
+type DeployDependency struct {
+	Dependent *resource.Info
+	Target    *resource.Info
+	State     DeployDependencyState
+	// Condition, if set, is the condition the target has to have before the dependent resource is applied.
+	Condition *kube.ResourceCondition
+	// Detected is true if the dependency is implied by the spec of the dependent resource rather than declared
+	// with an annotation.
+	Detected bool
+}
+
+// Returns the dependencies between the resources of the stages, in the order of the dependent resources. A
+// dependency on a resource in a later stage and on a resource which is not in the release are errors, unless
+// the dependency is detected, in which case it is omitted.
+func DeployDependencies(sortedStages stages.SortedStageList) ([]*DeployDependency, error) {
+	stageIndexes := map[*resource.Info]int{}
+	for i, stg := range sortedStages {
+		for _, res := range stg.DesiredResources {
+			stageIndexes[res] = i
+		}
+	}
+
+	crdNames, err := customResourceDefinitionNames(sortedStages)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*DeployDependency
+	for i, stg := range sortedStages {
+		for _, res := range stg.DesiredResources {
+			deps, err := parseDeployDependencyAnnotations(res)
+			if err != nil {
+				return nil, err
+			}
+
+			detectedDeps, err := detectInternalDependencies(res, crdNames)
+			if err != nil {
+				return nil, err
+			}
+			deps = append(deps, detectedDeps...)
+
+			for _, dep := range deps {
+				target, err := findDeployDependency(sortedStages, res, dep)
+				if dep.detected && (err != nil || stageIndexes[target] > i) {
+					continue
+				} else if err != nil {
+					return nil, err
+				}
+
+				if targetStage := sortedStages[stageIndexes[target]]; stageIndexes[target] > i && targetStage.Phase != sortedStages[i].Phase {
+					return nil, messages.Errorf(messages.ValidationDependencyLaterPhase, kube.ResourceNameNamespaceKind(res), dep, targetStage.Phase, PhaseAnnotation, dep.annotation)
+				} else if stageIndexes[target] > i {
+					return nil, messages.Errorf(messages.ValidationDependencyLaterStage, kube.ResourceNameNamespaceKind(res), dep, sortedStages[stageIndexes[target]].Weight, dep.annotation)
+				}
+
+				result = append(result, &DeployDependency{
+					Dependent: res,
+					Target:    target,
+					State:     dep.state,
+					Condition: dep.condition,
+					Detected:  dep.detected,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Splits every stage into consecutive stages of the same weight, so that resources are applied after the
+// resources of the release they depend on, see DeployDependencies. Dependency cycles are errors. The
+// dependencies implied by the specs of the resources with DetectDeployDependenciesAnnotation, e.g. of an Ingress
+// on its backend Services, are detected. Stages without dependencies between their resources are kept as they are.
+func SplitStagesByDeployDependencies(sortedStages stages.SortedStageList) (stages.SortedStageList, error) {
+	deps, err := DeployDependencies(sortedStages)
+	if err != nil {
+		return nil, err
+	}
+
+	stageIndexes := map[*resource.Info]int{}
+	for i, stg := range sortedStages {
+		for _, res := range stg.DesiredResources {
+			stageIndexes[res] = i
+		}
+	}
+
+	var result stages.SortedStageList
+	for i, stg := range sortedStages {
+		levels := map[*resource.Info]int{}
+		readyDeps := map[*resource.Info]kube.ResourceList{}
+		conditionDeps := map[*resource.Info][]*stages.ConditionDependency{}
+		sameStageDeps := map[*resource.Info]kube.ResourceList{}
+
+		for _, dep := range deps {
+			if stageIndexes[dep.Dependent] != i {
+				continue
+			}
+
+			if stageIndexes[dep.Target] == i {
+				sameStageDeps[dep.Dependent] = append(sameStageDeps[dep.Dependent], dep.Target)
+			}
+			if dep.State == DeployDependencyStateReady {
+				readyDeps[dep.Dependent] = append(readyDeps[dep.Dependent], dep.Target)
+			}
+			if dep.Condition != nil {
+				conditionDeps[dep.Dependent] = append(conditionDeps[dep.Dependent], &stages.ConditionDependency{Resource: dep.Target, Condition: dep.Condition})
+			}
+		}
+
+		if len(sameStageDeps) == 0 && len(readyDeps) == 0 && len(conditionDeps) == 0 {
+			result = append(result, stg)
+			continue
+		}
+
+		for _, res := range stg.DesiredResources {
+			if _, err := deployDependencyLevel(res, sameStageDeps, levels, map[*resource.Info]bool{}, nil); err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, splitStageByLevels(stg, levels, readyDeps, conditionDeps)...)
+	}
+
+	return result, nil
+}
+
+// Returns nil if the resource has no deploy-dependency annotations.
+func parseDeployDependencyAnnotations(res *resource.Info) ([]*deployDependency, error) {
+	annotations, err := metadataAccessor.Annotations(res.Object)
+	if err != nil {
+		return nil, fmt.Errorf("error getting annotations of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	var result []*deployDependency
+	for key, value := range annotations {
+		if !strings.HasPrefix(key, DeployDependencyAnnotationPrefix) {
+			continue
+		}
+
+		dep, err := parseDeployDependency(key, value)
+		if err != nil {
+			return nil, messages.Errorf(messages.ValidationInvalidAnnotation, key, kube.ResourceNameNamespaceKind(res), err)
+		}
+		result = append(result, dep)
+	}
+
+	// Annotations come from a map, keep the errors stable.
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].annotation < result[j].annotation
+	})
+
+	return result, nil
+}
+
+func parseDeployDependency(annotation, value string) (*deployDependency, error) {
+	dep := &deployDependency{annotation: annotation, state: DeployDependencyStatePresent}
+
+	ref, options, _ := strings.Cut(value, ",")
+	for _, option := range strings.Split(options, ",") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+
+		if condition, found := strings.CutPrefix(option, "condition="); found {
+			cond, err := kube.ParseResourceCondition(condition)
+			if err != nil {
+				return nil, messages.Errorf(messages.ValidationDependencyCondition, condition)
+			}
+			dep.condition = cond
+			continue
+		}
+
+		state, found := strings.CutPrefix(option, "state=")
+		switch DeployDependencyState(state) {
+		case DeployDependencyStatePresent, DeployDependencyStateReady:
+			dep.state = DeployDependencyState(state)
+		default:
+			if !found {
+				return nil, messages.Errorf(messages.ValidationDependencyOption, option, DeployDependencyStatePresent, DeployDependencyStateReady)
+			}
+			return nil, messages.Errorf(messages.ValidationDependencyState, state, DeployDependencyStatePresent, DeployDependencyStateReady)
+		}
+	}
+
+	parts := strings.Split(strings.TrimSpace(ref), ":")
+	switch len(parts) {
+	case 3:
+		dep.name = parts[2]
+	case 4:
+		dep.namespace = parts[2]
+		dep.name = parts[3]
+	default:
+		return nil, messages.Errorf(messages.ValidationDependencyFormat, value)
+	}
+
+	gv, err := schema.ParseGroupVersion(parts[0])
+	if err != nil || parts[0] == "" {
+		return nil, messages.Errorf(messages.ValidationDependencyAPIVersion, parts[0])
+	}
+	if parts[1] == "" || dep.name == "" {
+		return nil, messages.Errorf(messages.ValidationDependencyKindAndName, value)
+	}
+	dep.groupKind = schema.GroupKind{Group: gv.Group, Kind: parts[1]}
+
+	return dep, nil
+}
+
+func findDeployDependency(sortedStages stages.SortedStageList, dependent *resource.Info, dep *deployDependency) (*resource.Info, error) {
+	for _, stg := range sortedStages {
+		for _, res := range stg.DesiredResources {
+			if res != dependent && dep.matches(dependent, res) {
+				return res, nil
+			}
+		}
+	}
+
+	return nil, messages.Errorf(messages.ValidationDependencyNotFound, kube.ResourceNameNamespaceKind(dependent), dep, dep.annotation)
+}
+
+// Returns the number of resources of the same stage which have to be applied one after another before
+// the resource, following the dependencies depth-first.
+func deployDependencyLevel(res *resource.Info, deps map[*resource.Info]kube.ResourceList, levels map[*resource.Info]int, visiting map[*resource.Info]bool, path []string) (int, error) {
+	if level, found := levels[res]; found {
+		return level, nil
+	}
+
+	path = append(path, kube.ResourceNameNamespaceKind(res))
+	if visiting[res] {
+		return 0, messages.Errorf(messages.ValidationDependencyCycle, strings.Join(path, " -> "))
+	}
+	visiting[res] = true
+
+	level := 0
+	for _, dep := range deps[res] {
+		depLevel, err := deployDependencyLevel(dep, deps, levels, visiting, path)
+		if err != nil {
+			return 0, err
+		}
+		if depLevel+1 > level {
+			level = depLevel + 1
+		}
+	}
+
+	delete(visiting, res)
+	levels[res] = level
+
+	return level, nil
+}
+
+func splitStageByLevels(stg *stages.Stage, levels map[*resource.Info]int, readyDeps map[*resource.Info]kube.ResourceList, conditionDeps map[*resource.Info][]*stages.ConditionDependency) stages.SortedStageList {
+	maxLevel := 0
+	for _, level := range levels {
+		if level > maxLevel {
+			maxLevel = level
+		}
+	}
+
+	result := make(stages.SortedStageList, maxLevel+1)
+	for i := range result {
+		result[i] = &stages.Stage{Phase: stg.Phase, Weight: stg.Weight}
+	}
+	result[0].ExternalDependencies = stg.ExternalDependencies
+
+	for _, res := range stg.DesiredResources {
+		subStage := result[levels[res]]
+		subStage.DesiredResources.Append(res)
+
+		for _, dep := range readyDeps[res] {
+			if !subStage.ReadyDependencies.Contains(dep) {
+				subStage.ReadyDependencies.Append(dep)
+			}
+		}
+		subStage.ConditionDependencies = append(subStage.ConditionDependencies, conditionDeps[res]...)
+	}
+
+	return result
+}
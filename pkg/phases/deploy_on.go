@@ -0,0 +1,77 @@
+package phases
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+// Comma-separated list of deploy types on which the resource is deployed, e.g. "install" for one-time
+// setup resources. Resources are deployed on any deploy type if the annotation is not set.
+const DeployOnAnnotation = "werf.io/deploy-on"
+
+type DeployType string
+
+const (
+	DeployTypeInstall  DeployType = "install"
+	DeployTypeUpgrade  DeployType = "upgrade"
+	DeployTypeRollback DeployType = "rollback"
+)
+
+var metadataAccessor = meta.NewAccessor()
+
+// Splits resources into the ones that should be deployed on this deploy type and the ones that should
+// be skipped. Skipped resources are kept in the release and are never deleted as orphans.
+func SplitResourcesByDeployOn(resources kube.ResourceList, deployType DeployType) (deploy, skip kube.ResourceList, err error) {
+	if err := resources.Visit(func(res *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		deployTypes, err := parseDeployOnAnnotation(res)
+		if err != nil {
+			return err
+		}
+
+		if deployTypes == nil || deployTypes[deployType] {
+			deploy.Append(res)
+		} else {
+			skip.Append(res)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("error visiting resources list: %w", err)
+	}
+
+	return deploy, skip, nil
+}
+
+// Returns nil if the resource has no deploy-on annotation.
+func parseDeployOnAnnotation(res *resource.Info) (map[DeployType]bool, error) {
+	annotations, err := metadataAccessor.Annotations(res.Object)
+	if err != nil {
+		return nil, fmt.Errorf("error getting annotations of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	value, found := annotations[DeployOnAnnotation]
+	if !found {
+		return nil, nil
+	}
+
+	result := map[DeployType]bool{}
+	for _, v := range strings.Split(value, ",") {
+		switch deployType := DeployType(strings.TrimSpace(v)); deployType {
+		case DeployTypeInstall, DeployTypeUpgrade, DeployTypeRollback:
+			result[deployType] = true
+		default:
+			return nil, fmt.Errorf("invalid value %q of annotation %q of %q: expected comma-separated list of %q, %q or %q", value, DeployOnAnnotation, kube.ResourceNameNamespaceKind(res), DeployTypeInstall, DeployTypeUpgrade, DeployTypeRollback)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,55 @@
+package phases
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+func TestSplitResourcesByDeployOn(t *testing.T) {
+	resources := kube.ResourceList{
+		newAnnotatedResource("always", nil),
+		newAnnotatedResource("setup", map[string]string{DeployOnAnnotation: "install"}),
+		newAnnotatedResource("migrate", map[string]string{DeployOnAnnotation: "upgrade, rollback"}),
+	}
+
+	names := func(resources kube.ResourceList) []string {
+		var result []string
+		for _, res := range resources {
+			result = append(result, res.Name)
+		}
+		return result
+	}
+
+	for _, tt := range []struct {
+		deployType DeployType
+		deploy     []string
+		skip       []string
+	}{
+		{deployType: DeployTypeInstall, deploy: []string{"always", "setup"}, skip: []string{"migrate"}},
+		{deployType: DeployTypeUpgrade, deploy: []string{"always", "migrate"}, skip: []string{"setup"}},
+		{deployType: DeployTypeRollback, deploy: []string{"always", "migrate"}, skip: []string{"setup"}},
+	} {
+		deploy, skip, err := SplitResourcesByDeployOn(resources, tt.deployType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(deploy); !reflect.DeepEqual(got, tt.deploy) {
+			t.Errorf("%s: expected to deploy %v, got %v", tt.deployType, tt.deploy, got)
+		}
+		if got := names(skip); !reflect.DeepEqual(got, tt.skip) {
+			t.Errorf("%s: expected to skip %v, got %v", tt.deployType, tt.skip, got)
+		}
+	}
+}
+
+func TestSplitResourcesByDeployOnInvalidAnnotation(t *testing.T) {
+	resources := kube.ResourceList{newAnnotatedResource("setup", map[string]string{DeployOnAnnotation: "install,delete"})}
+
+	_, _, err := SplitResourcesByDeployOn(resources, DeployTypeInstall)
+	if err == nil || !strings.Contains(err.Error(), `invalid value "install,delete" of annotation "werf.io/deploy-on"`) {
+		t.Errorf("expected an invalid annotation error, got %v", err)
+	}
+}
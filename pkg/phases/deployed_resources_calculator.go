@@ -51,6 +51,7 @@ func (c *DeployedResourcesCalculator) Calculate() (kube.ResourceList, error) {
 			}
 
 			result.Merge(mainPhase.DeployedResources())
+			result.Merge(mainPhase.Canaries())
 		case rel.StatusUninstalled, rel.StatusUnknown:
 		default:
 			panic(fmt.Sprintf("unexpected release status: %s", release.Info.Status))
@@ -60,6 +61,39 @@ func (c *DeployedResourcesCalculator) Calculate() (kube.ResourceList, error) {
 	return result, nil
 }
 
+// Returns the generations of immutable ConfigMaps and Secrets, see VersionImmutableResources, deployed by the
+// releases of the history. The generations of the last keepRevisions releases are kept, so that the workloads of
+// these revisions can still use them, e.g. during a rolling update or after a rollback. Older generations are
+// expired and can be deleted, unless the current release deploys them again.
+func (c *DeployedResourcesCalculator) CalculateImmutableGenerations(keepRevisions int) (kept, expired kube.ResourceList, err error) {
+	for i, release := range c.history {
+		switch release.Info.Status {
+		case rel.StatusUninstalled, rel.StatusUnknown:
+			continue
+		}
+
+		phase, err := NewRolloutPhase(release, c.stagesSplitter, c.kubeClient).
+			ParseStagesFromString(release.Manifest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating main phase of revision %d: %w", release.Version, err)
+		}
+
+		for _, res := range phase.AllResources() {
+			if !IsImmutableGeneration(res) {
+				continue
+			}
+
+			if i >= len(c.history)-keepRevisions {
+				kept.Merge(kube.ResourceList{res})
+			} else {
+				expired.Merge(kube.ResourceList{res})
+			}
+		}
+	}
+
+	return kept, expired.Difference(kept), nil
+}
+
 func (c *DeployedResourcesCalculator) calculateRevisionToStartAt(lastDeployedReleaseIndex, lastUninstalledReleaseIndex *int) *int {
 	if lastDeployedReleaseIndex == nil && lastUninstalledReleaseIndex == nil {
 		firstRev := 0
@@ -0,0 +1,375 @@
+package phases
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	rel "github.com/werf/3p-helm/pkg/release"
+)
+
+// Opts an immutable ConfigMap or Secret into versioning, see VersionImmutableResources, e.g.
+// "werf.io/version-immutable: "true"".
+const VersionImmutableAnnotation = "werf.io/version-immutable"
+
+// Set on immutable ConfigMaps and Secrets renamed by VersionImmutableResources, holds the name from the chart.
+const ImmutableOriginalNameAnnotation = "werf.io/immutable-original-name"
+
+const immutableNameHashLength = 10
+
+// Paths to the pod spec of the workloads which can reference ConfigMaps and Secrets.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// ConfigMaps and Secrets with "immutable: true" can't be updated, so every generation of the content of the ones
+// annotated with VersionImmutableAnnotation gets its own name: the name from the chart suffixed with the hash of the
+// content. References to them in the pod specs of the workloads and in the TLS of the Ingresses of the same namespace
+// are rewritten to the new name. The resource is not versioned if any other resource or hook of the release still
+// references it, since that reference would break: any field whose path mentions the kind, e.g. "spec.secretRef.name",
+// holding the original name is considered a reference. Previous generations become orphans and are deleted after the
+// rollout, unless they are kept for a few revisions, see DeployedResourcesCalculator.CalculateImmutableGenerations, and
+// so does the resource with the original name deployed before the annotation was set.
+func VersionImmutableResources(resources kube.ResourceList, hooks []*rel.Hook, namespace string) error {
+	// Namespace -> kind -> original name -> versioned name.
+	renames := map[string]map[string]map[string]string{}
+	versionedResources := map[*resource.Info]bool{}
+
+	for _, res := range resources {
+		obj, ok := res.Object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		if optedIn, err := versionImmutableOf(res, obj); err != nil {
+			return err
+		} else if !optedIn {
+			continue
+		}
+
+		originalName, versioned := obj.GetAnnotations()[ImmutableOriginalNameAnnotation]
+		if !versioned {
+			originalName = obj.GetName()
+
+			hash, err := immutableContentHash(obj)
+			if err != nil {
+				return fmt.Errorf("error hashing content of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+			}
+
+			annotations := obj.GetAnnotations()
+			annotations[ImmutableOriginalNameAnnotation] = originalName
+			obj.SetAnnotations(annotations)
+
+			obj.SetName(fmt.Sprintf("%s-%s", originalName, hash))
+			res.Name = obj.GetName()
+		}
+
+		if renames[res.Namespace] == nil {
+			renames[res.Namespace] = map[string]map[string]string{}
+		}
+		if renames[res.Namespace][obj.GetKind()] == nil {
+			renames[res.Namespace][obj.GetKind()] = map[string]string{}
+		}
+		renames[res.Namespace][obj.GetKind()][originalName] = obj.GetName()
+		versionedResources[res] = true
+	}
+
+	if len(renames) == 0 {
+		return nil
+	}
+
+	for _, res := range resources {
+		obj, ok := res.Object.(*unstructured.Unstructured)
+		if !ok || renames[res.Namespace] == nil {
+			continue
+		}
+
+		if err := rewriteImmutableReferences(obj, renames[res.Namespace]); err != nil {
+			return fmt.Errorf("error rewriting references to immutable resources in %q: %w", kube.ResourceNameNamespaceKind(res), err)
+		}
+	}
+
+	for _, res := range resources {
+		obj, ok := res.Object.(*unstructured.Unstructured)
+		if !ok || versionedResources[res] {
+			continue
+		}
+
+		if err := validateNoImmutableReferences(obj.Object, renames[res.Namespace], fmt.Sprintf("%q", kube.ResourceNameNamespaceKind(res))); err != nil {
+			return err
+		}
+	}
+
+	// Hooks are not rewritten: the pre hooks run before the new generations are created.
+	for _, hook := range hooks {
+		content := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(hook.Manifest), &content); err != nil {
+			return fmt.Errorf("error parsing manifest of hook %q: %w", hook.Name, err)
+		}
+
+		hookNamespace := namespace
+		if ns, found, _ := unstructured.NestedString(content, "metadata", "namespace"); found && ns != "" {
+			hookNamespace = ns
+		}
+
+		if err := validateNoImmutableReferences(content, renames[hookNamespace], fmt.Sprintf("hook %q", hook.Name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Whether the resource is a ConfigMap or Secret renamed by VersionImmutableResources.
+func IsImmutableGeneration(res *resource.Info) bool {
+	annotations, err := metadataAccessor.Annotations(res.Object)
+	if err != nil {
+		return false
+	}
+
+	_, found := annotations[ImmutableOriginalNameAnnotation]
+
+	return found
+}
+
+// Whether the resource is opted into versioning with VersionImmutableAnnotation. Only immutable ConfigMaps and
+// Secrets can be.
+func versionImmutableOf(res *resource.Info, obj *unstructured.Unstructured) (bool, error) {
+	value, found := obj.GetAnnotations()[VersionImmutableAnnotation]
+	if !found {
+		return false, nil
+	}
+
+	optedIn, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, messages.Errorf(messages.ValidationInvalidAnnotation, VersionImmutableAnnotation, kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	if optedIn && !isImmutableConfig(obj) {
+		return false, messages.Errorf(messages.ValidationImmutableKind, kube.ResourceNameNamespaceKind(res), VersionImmutableAnnotation)
+	}
+
+	return optedIn, nil
+}
+
+func isImmutableConfig(obj *unstructured.Unstructured) bool {
+	if obj.GroupVersionKind().Group != "" || obj.GetKind() != "ConfigMap" && obj.GetKind() != "Secret" {
+		return false
+	}
+
+	immutable, _, _ := unstructured.NestedBool(obj.Object, "immutable")
+
+	return immutable
+}
+
+func immutableContentHash(obj *unstructured.Unstructured) (string, error) {
+	content := map[string]interface{}{}
+	for _, field := range []string{"type", "data", "binaryData", "stringData"} {
+		if value, found := obj.Object[field]; found {
+			content[field] = value
+		}
+	}
+
+	// Map keys are marshaled sorted, so the hash is stable.
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])[:immutableNameHashLength], nil
+}
+
+// Rewrites the references in the pod spec of the workload or in the TLS of the Ingress.
+func rewriteImmutableReferences(obj *unstructured.Unstructured, renames map[string]map[string]string) error {
+	if obj.GetKind() == "Ingress" {
+		for _, tls := range nestedMaps(obj.Object, "spec", "tls") {
+			renameImmutableReference(tls, renames, "Secret", "secretName")
+		}
+
+		return nil
+	}
+
+	path, found := podSpecPaths[obj.GetKind()]
+	if !found {
+		return nil
+	}
+
+	podSpec, found, err := unstructured.NestedMap(obj.Object, path...)
+	if err != nil || !found {
+		return nil
+	}
+
+	rewritePodSpecImmutableReferences(podSpec, renames)
+
+	return unstructured.SetNestedMap(obj.Object, podSpec, path...)
+}
+
+func renameImmutableReference(m map[string]interface{}, renames map[string]map[string]string, kind, field string) {
+	if name, ok := m[field].(string); ok {
+		if versioned, found := renames[kind][name]; found {
+			m[field] = versioned
+		}
+	}
+}
+
+func rewritePodSpecImmutableReferences(podSpec map[string]interface{}, renames map[string]map[string]string) {
+	rename := func(m map[string]interface{}, kind, field string) {
+		renameImmutableReference(m, renames, kind, field)
+	}
+
+	for _, volume := range nestedMaps(podSpec, "volumes") {
+		if cm, ok := volume["configMap"].(map[string]interface{}); ok {
+			rename(cm, "ConfigMap", "name")
+		}
+		if secret, ok := volume["secret"].(map[string]interface{}); ok {
+			rename(secret, "Secret", "secretName")
+		}
+		if projected, ok := volume["projected"].(map[string]interface{}); ok {
+			for _, source := range nestedMaps(projected, "sources") {
+				if cm, ok := source["configMap"].(map[string]interface{}); ok {
+					rename(cm, "ConfigMap", "name")
+				}
+				if secret, ok := source["secret"].(map[string]interface{}); ok {
+					rename(secret, "Secret", "name")
+				}
+			}
+		}
+	}
+
+	for _, containersField := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		for _, container := range nestedMaps(podSpec, containersField) {
+			for _, env := range nestedMaps(container, "env") {
+				valueFrom, ok := env["valueFrom"].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if ref, ok := valueFrom["configMapKeyRef"].(map[string]interface{}); ok {
+					rename(ref, "ConfigMap", "name")
+				}
+				if ref, ok := valueFrom["secretKeyRef"].(map[string]interface{}); ok {
+					rename(ref, "Secret", "name")
+				}
+			}
+
+			for _, envFrom := range nestedMaps(container, "envFrom") {
+				if ref, ok := envFrom["configMapRef"].(map[string]interface{}); ok {
+					rename(ref, "ConfigMap", "name")
+				}
+				if ref, ok := envFrom["secretRef"].(map[string]interface{}); ok {
+					rename(ref, "Secret", "name")
+				}
+			}
+		}
+	}
+
+	for _, ref := range nestedMaps(podSpec, "imagePullSecrets") {
+		rename(ref, "Secret", "name")
+	}
+}
+
+// Returns the objects of the slice at the path without copying them, so that they can be modified in place.
+func nestedMaps(obj map[string]interface{}, fields ...string) []map[string]interface{} {
+	for _, field := range fields[:len(fields)-1] {
+		var ok bool
+		if obj, ok = obj[field].(map[string]interface{}); !ok {
+			return nil
+		}
+	}
+
+	items, ok := obj[fields[len(fields)-1]].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var result []map[string]interface{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
+
+// Returns an error if the content still references any of the renamed resources by its original name.
+func validateNoImmutableReferences(content map[string]interface{}, renames map[string]map[string]string, referrer string) error {
+	kinds := make([]string, 0, len(renames))
+	for kind := range renames {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		names := make([]string, 0, len(renames[kind]))
+		for originalName := range renames[kind] {
+			names = append(names, originalName)
+		}
+		sort.Strings(names)
+
+		for _, originalName := range names {
+			if path, found := findImmutableReference(content, kind, originalName, ""); found {
+				return messages.Errorf(messages.ValidationImmutableReference, kind, originalName, referrer, path, VersionImmutableAnnotation)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the path of the first field holding the name whose path mentions the kind, case-insensitively. The metadata
+// and the data of the object are skipped.
+func findImmutableReference(value interface{}, kind, name, path string) (string, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			if path == "" && (key == "metadata" || key == "data" || key == "binaryData" || key == "stringData") {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+
+			if found, ok := findImmutableReference(v[key], kind, name, fieldPath); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if found, ok := findImmutableReference(item, kind, name, fmt.Sprintf("%s[%d]", path, i)); ok {
+				return found, true
+			}
+		}
+	case string:
+		if v == name && strings.Contains(strings.ToLower(path), strings.ToLower(kind)) {
+			return path, true
+		}
+	}
+
+	return "", false
+}
@@ -3,6 +3,7 @@ package phases
 import (
 	"github.com/werf/3p-helm/pkg/kube"
 	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/release"
 )
 
 type Splitter interface {
@@ -12,3 +13,19 @@ type Splitter interface {
 type ExternalDepsGenerator interface {
 	Generate(stages stages.SortedStageList) error
 }
+
+// DeployExtender allows embedders to hook into the deploy of a release, e.g. to warm up images
+// before the rollout. An error returned by BeforePlan, AfterPlan or BeforePhase fails the deploy.
+type DeployExtender interface {
+	// BeforePlan is called with the resources of the release before they are split into stages.
+	BeforePlan(rel *release.Release, resources kube.ResourceList) error
+	// AfterPlan is called with the stages the resources of the release are going to be deployed in.
+	AfterPlan(rel *release.Release, stages stages.SortedStageList) error
+	// BeforePhase is called before the pre hooks, the rollout and the post hooks are deployed.
+	BeforePhase(rel *release.Release, phase release.Phase) error
+	// AfterDeploy is called with the report of the deploy once it is finished, whether it
+	// succeeded or failed. Its error is only logged, as the deploy is already over. It is
+	// called once for an atomic upgrade, with the report of the upgrade, even if the
+	// upgrade is rolled back.
+	AfterDeploy(rel *release.Release, report *release.DeployReport) error
+}
@@ -0,0 +1,176 @@
+package phases
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+)
+
+var (
+	serviceGroupKind        = schema.GroupKind{Kind: "Service"}
+	serviceAccountGroupKind = schema.GroupKind{Kind: "ServiceAccount"}
+	storageClassGroupKind   = schema.GroupKind{Group: "storage.k8s.io", Kind: "StorageClass"}
+	crdGroupKind            = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+)
+
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+// Opts the resource into the detection of its dependencies, see detectInternalDependencies, e.g.
+// "werf.io/detect-deploy-dependencies: "true"". A resource is applied in a later stage than its dependencies, so
+// with waiting enabled it is only applied once they are ready.
+const DetectDeployDependenciesAnnotation = "werf.io/detect-deploy-dependencies"
+
+// Detects the dependencies implied by the spec of the resource on other resources of the release, which are
+// ordered as if declared with "present" deploy-dependency annotations. Returns nil unless the resource has
+// DetectDeployDependenciesAnnotation. The detected dependencies are:
+//   - an Ingress or a Gateway API route depends on its backend Services;
+//   - a PersistentVolumeClaim, or a StatefulSet with volume claim templates, depends on its StorageClasses;
+//   - a Pod or a workload depends on the ServiceAccount of its Pod template;
+//   - a custom resource depends on its CustomResourceDefinition.
+//
+// Unlike the annotations, the detected dependencies on resources which are not in the release or are deployed
+// in later stages are ignored.
+func detectInternalDependencies(res *resource.Info, crdNames map[schema.GroupKind]string) ([]*deployDependency, error) {
+	annotations, err := metadataAccessor.Annotations(res.Object)
+	if err != nil {
+		return nil, fmt.Errorf("error getting annotations of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	if value, found := annotations[DetectDeployDependenciesAnnotation]; !found {
+		return nil, nil
+	} else if detect, err := strconv.ParseBool(value); err != nil {
+		return nil, messages.Errorf(messages.ValidationInvalidAnnotation, DetectDeployDependenciesAnnotation, kube.ResourceNameNamespaceKind(res), err)
+	} else if !detect {
+		return nil, nil
+	}
+
+	gvk := res.Object.GetObjectKind().GroupVersionKind()
+
+	if crdName, found := crdNames[gvk.GroupKind()]; found {
+		return []*deployDependency{newDetectedDependency(crdGroupKind, crdName)}, nil
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(res.Object)
+	if err != nil {
+		return nil, fmt.Errorf("error converting %q to unstructured: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	var result []*deployDependency
+	add := func(groupKind schema.GroupKind, name string) {
+		if name != "" {
+			result = append(result, newDetectedDependency(groupKind, name))
+		}
+	}
+
+	switch gvk.GroupKind() {
+	case schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}, schema.GroupKind{Group: "extensions", Kind: "Ingress"}:
+		for _, backend := range ingressBackends(obj) {
+			add(serviceGroupKind, nestedString(backend, "service", "name"))
+			add(serviceGroupKind, nestedString(backend, "serviceName"))
+		}
+	case schema.GroupKind{Group: gatewayAPIGroup, Kind: "HTTPRoute"},
+		schema.GroupKind{Group: gatewayAPIGroup, Kind: "GRPCRoute"},
+		schema.GroupKind{Group: gatewayAPIGroup, Kind: "TLSRoute"},
+		schema.GroupKind{Group: gatewayAPIGroup, Kind: "TCPRoute"},
+		schema.GroupKind{Group: gatewayAPIGroup, Kind: "UDPRoute"}:
+		for _, rule := range nestedMaps(obj, "spec", "rules") {
+			for _, ref := range nestedMaps(rule, "backendRefs") {
+				group, kind := nestedString(ref, "group"), nestedString(ref, "kind")
+				// Backend references are Services unless the group or the kind are set otherwise.
+				if group != "" || (kind != "" && kind != "Service") {
+					continue
+				}
+				// Backends in other namespaces are never in the same stage.
+				if namespace := nestedString(ref, "namespace"); namespace != "" && namespace != res.Namespace {
+					continue
+				}
+				add(serviceGroupKind, nestedString(ref, "name"))
+			}
+		}
+	case schema.GroupKind{Kind: "PersistentVolumeClaim"}:
+		add(storageClassGroupKind, nestedString(obj, "spec", "storageClassName"))
+	default:
+		if path, found := podSpecPaths[gvk.Kind]; found {
+			podSpec, _, _ := unstructured.NestedMap(obj, path...)
+			serviceAccount := nestedString(podSpec, "serviceAccountName")
+			if serviceAccount == "" {
+				serviceAccount = nestedString(podSpec, "serviceAccount")
+			}
+			add(serviceAccountGroupKind, serviceAccount)
+		}
+
+		if gvk.GroupKind() == (schema.GroupKind{Group: "apps", Kind: "StatefulSet"}) {
+			for _, claim := range nestedMaps(obj, "spec", "volumeClaimTemplates") {
+				add(storageClassGroupKind, nestedString(claim, "spec", "storageClassName"))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func newDetectedDependency(groupKind schema.GroupKind, name string) *deployDependency {
+	return &deployDependency{
+		groupKind: groupKind,
+		name:      name,
+		state:     DeployDependencyStatePresent,
+		detected:  true,
+	}
+}
+
+// Returns the names of the CustomResourceDefinitions of the release by the group and the kind of their custom
+// resources.
+func customResourceDefinitionNames(sortedStages stages.SortedStageList) (map[schema.GroupKind]string, error) {
+	result := map[schema.GroupKind]string{}
+	for _, stg := range sortedStages {
+		for _, res := range stg.DesiredResources {
+			if res.Object.GetObjectKind().GroupVersionKind().GroupKind() != crdGroupKind {
+				continue
+			}
+
+			obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(res.Object)
+			if err != nil {
+				return nil, fmt.Errorf("error converting %q to unstructured: %w", kube.ResourceNameNamespaceKind(res), err)
+			}
+
+			kind := nestedString(obj, "spec", "names", "kind")
+			if kind != "" {
+				result[schema.GroupKind{Group: nestedString(obj, "spec", "group"), Kind: kind}] = res.Name
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func ingressBackends(obj map[string]interface{}) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, field := range []string{"defaultBackend", "backend"} {
+		if backend, found, _ := unstructured.NestedMap(obj, "spec", field); found {
+			result = append(result, backend)
+		}
+	}
+
+	for _, rule := range nestedMaps(obj, "spec", "rules") {
+		for _, path := range nestedMaps(rule, "http", "paths") {
+			if backend, found, _ := unstructured.NestedMap(path, "backend"); found {
+				result = append(result, backend)
+			}
+		}
+	}
+
+	return result
+}
+
+func nestedString(obj map[string]interface{}, fields ...string) string {
+	value, _, _ := unstructured.NestedString(obj, fields...)
+	return value
+}
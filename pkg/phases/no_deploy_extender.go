@@ -0,0 +1,25 @@
+package phases
+
+import (
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	"github.com/werf/3p-helm/pkg/release"
+)
+
+type NoDeployExtender struct{}
+
+func (e *NoDeployExtender) BeforePlan(_ *release.Release, _ kube.ResourceList) error {
+	return nil
+}
+
+func (e *NoDeployExtender) AfterPlan(_ *release.Release, _ stages.SortedStageList) error {
+	return nil
+}
+
+func (e *NoDeployExtender) BeforePhase(_ *release.Release, _ release.Phase) error {
+	return nil
+}
+
+func (e *NoDeployExtender) AfterDeploy(_ *release.Release, _ *release.DeployReport) error {
+	return nil
+}
@@ -0,0 +1,84 @@
+package phasemanagers
+
+import (
+	"time"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+)
+
+var (
+	apiUnavailabilityInitialBackoff = time.Second
+	apiUnavailabilityMaxBackoff     = 30 * time.Second
+)
+
+// Pauses the rollout while the Kubernetes API server is unavailable instead of failing it. The rollout
+// is resumed from the current operation once the API server is reachable again, unless the budget has
+// passed since the API server first became unavailable during the rollout: all the outages of the
+// rollout share the budget. A zero budget disables pausing.
+func (m *RolloutPhaseManager) WithAPIUnavailabilityBudget(budget time.Duration, log func(string, ...interface{})) *RolloutPhaseManager {
+	m.apiUnavailabilityBudget = budget
+	m.log = log
+
+	return m
+}
+
+// Runs the operation, retrying it after the API server becomes reachable again if it failed because
+// the API server was unavailable. The first attempt is passed to the operation, so that it can
+// account for changes partially made by the failed one.
+func (m *RolloutPhaseManager) withAPIUnavailabilityRetry(operation string, fn func(firstAttempt bool) error) error {
+	err := fn(true)
+	if err == nil || m.apiUnavailabilityBudget <= 0 {
+		return err
+	}
+
+	for err != nil && m.isAPIServerUnavailable(err) {
+		if m.apiUnavailabilityDeadline.IsZero() {
+			m.apiUnavailabilityDeadline = time.Now().Add(m.apiUnavailabilityBudget)
+		}
+
+		if waitErr := m.waitForAPIServer(operation, m.apiUnavailabilityDeadline, err); waitErr != nil {
+			return waitErr
+		}
+
+		m.log(messages.Format(messages.RolloutAPIServerReachable), operation)
+		err = fn(false)
+	}
+
+	return err
+}
+
+func (m *RolloutPhaseManager) isAPIServerUnavailable(err error) bool {
+	return kube.IsAPIServerUnavailable(err) || m.kubeClient.IsReachable() != nil
+}
+
+// Waits with exponential backoff until the API server is reachable, logging a heartbeat message on every
+// check. Returns an error wrapping cause if the deadline passes first.
+func (m *RolloutPhaseManager) waitForAPIServer(operation string, deadline time.Time, cause error) error {
+	backoff := apiUnavailabilityInitialBackoff
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return messages.Errorf(messages.RolloutAPIServerBudgetExceeded, m.apiUnavailabilityBudget, operation, cause)
+		}
+
+		wait := backoff
+		if wait > left {
+			wait = left
+		}
+
+		m.log(messages.Format(messages.RolloutAPIServerUnavailable), operation, wait, left.Round(time.Second), cause)
+		time.Sleep(wait)
+
+		if err := m.kubeClient.IsReachable(); err == nil {
+			return nil
+		} else {
+			cause = err
+		}
+
+		backoff *= 2
+		if backoff > apiUnavailabilityMaxBackoff {
+			backoff = apiUnavailabilityMaxBackoff
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package phasemanagers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+)
+
+// unreachableKubeClient is unreachable until the given time.
+type unreachableKubeClient struct {
+	kubefake.PrintingKubeClient
+
+	until time.Time
+}
+
+func (c *unreachableKubeClient) IsReachable() error {
+	if time.Now().Before(c.until) {
+		return errors.New("connection refused")
+	}
+
+	return nil
+}
+
+func newUnavailabilityTestManager(budget time.Duration) (*RolloutPhaseManager, *unreachableKubeClient) {
+	kubeClient := &unreachableKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}}
+	m := (&RolloutPhaseManager{kubeClient: kubeClient}).WithAPIUnavailabilityBudget(budget, func(string, ...interface{}) {})
+
+	return m, kubeClient
+}
+
+// failsWhileUnreachable makes the API server unavailable for the outage and returns an operation failing
+// on its first attempt because of that.
+func failsWhileUnreachable(kubeClient *unreachableKubeClient, outage time.Duration, attempts *int) func(bool) error {
+	return func(firstAttempt bool) error {
+		*attempts++
+		if firstAttempt {
+			kubeClient.until = time.Now().Add(outage)
+			return apierrors.NewServiceUnavailable("unavailable")
+		}
+
+		return nil
+	}
+}
+
+func TestWithAPIUnavailabilityRetry(t *testing.T) {
+	defer func(initial, max time.Duration) {
+		apiUnavailabilityInitialBackoff, apiUnavailabilityMaxBackoff = initial, max
+	}(apiUnavailabilityInitialBackoff, apiUnavailabilityMaxBackoff)
+	apiUnavailabilityInitialBackoff, apiUnavailabilityMaxBackoff = 5*time.Millisecond, 5*time.Millisecond
+
+	t.Run("resumed after the outage", func(t *testing.T) {
+		m, kubeClient := newUnavailabilityTestManager(time.Second)
+
+		var attempts int
+		if err := m.withAPIUnavailabilityRetry("applying", failsWhileUnreachable(kubeClient, 20*time.Millisecond, &attempts)); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 2 {
+			t.Errorf("expected 2 attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("not retried without a budget", func(t *testing.T) {
+		m, kubeClient := newUnavailabilityTestManager(0)
+
+		var attempts int
+		if err := m.withAPIUnavailabilityRetry("applying", failsWhileUnreachable(kubeClient, 20*time.Millisecond, &attempts)); !apierrors.IsServiceUnavailable(err) {
+			t.Errorf("expected the error of the operation, got %v", err)
+		}
+		if attempts != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("not retried on other errors", func(t *testing.T) {
+		m, _ := newUnavailabilityTestManager(time.Second)
+
+		var attempts int
+		err := m.withAPIUnavailabilityRetry("applying", func(bool) error {
+			attempts++
+			return apierrors.NewBadRequest("invalid")
+		})
+		if !apierrors.IsBadRequest(err) {
+			t.Errorf("expected the error of the operation, got %v", err)
+		}
+		if attempts != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("budget shared by the outages of the rollout", func(t *testing.T) {
+		m, kubeClient := newUnavailabilityTestManager(150 * time.Millisecond)
+
+		var attempts int
+		if err := m.withAPIUnavailabilityRetry("applying", failsWhileUnreachable(kubeClient, 100*time.Millisecond, &attempts)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Within the budget on its own, but not along with the first outage.
+		err := m.withAPIUnavailabilityRetry("tracking", failsWhileUnreachable(kubeClient, 100*time.Millisecond, &attempts))
+		if err == nil || !strings.Contains(err.Error(), "longer than 150ms while tracking") {
+			t.Errorf("expected the budget to be exceeded, got %v", err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "connection refused") {
+			t.Errorf("expected the cause of the outage in %v", err)
+		}
+		if attempts != 3 {
+			t.Errorf("expected 3 attempts, got %d", attempts)
+		}
+	})
+}
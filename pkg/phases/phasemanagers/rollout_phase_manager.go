@@ -3,11 +3,16 @@ package phasemanagers
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/resource"
 
 	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
 	"github.com/werf/3p-helm/pkg/phases"
 	"github.com/werf/3p-helm/pkg/phases/stages"
 	rel "github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
 	"github.com/werf/3p-helm/pkg/storage"
 )
 
@@ -29,12 +34,24 @@ type RolloutPhaseManager struct {
 	deployedResourcesCalculator *phases.DeployedResourcesCalculator
 	previouslyDeployedResources kube.ResourceList
 	kubeClient                  kube.Interface
+	apiUnavailabilityBudget     time.Duration
+	immutableGenerationsToKeep  int
+	deployReport                *rel.DeployReport
+	progress                    *rel.ProgressStream
+	prunePolicy                 phases.PrunePolicy
+	unsupportedResources        kube.ResourceList
+	// Canaries applied by the canary steps and not deleted yet.
+	pendingCanaries kube.ResourceList
+	log             func(string, ...interface{})
+	warn            func(string, ...interface{})
+	// Set when the API server first becomes unavailable during the rollout.
+	apiUnavailabilityDeadline time.Time
 }
 
 func (m *RolloutPhaseManager) AddCalculatedPreviouslyDeployedResources() (*RolloutPhaseManager, error) {
 	resources, err := m.deployedResourcesCalculator.Calculate()
 	if err != nil {
-		return nil, fmt.Errorf("error calculating previously deployed resources: %w", err)
+		return nil, messages.Errorf(messages.RolloutCalculatePreviouslyDeployed, err)
 	}
 
 	m.previouslyDeployedResources.Merge(resources)
@@ -48,48 +65,280 @@ func (m *RolloutPhaseManager) AddPreviouslyDeployedResources(resources kube.Reso
 	return m
 }
 
+func (m *RolloutPhaseManager) PreviouslyDeployedResources() kube.ResourceList {
+	return m.previouslyDeployedResources
+}
+
+// Keep the generations of immutable ConfigMaps and Secrets deployed by the last revisions instead of deleting them
+// as orphans. Older generations are deleted.
+func (m *RolloutPhaseManager) WithImmutableGenerationsToKeep(revisions int) *RolloutPhaseManager {
+	m.immutableGenerationsToKeep = revisions
+
+	return m
+}
+
+// Record the results of applying, tracking and deleting resources in the deploy report.
+func (m *RolloutPhaseManager) WithDeployReport(report *rel.DeployReport) *RolloutPhaseManager {
+	m.deployReport = report
+
+	return m
+}
+
+// Emit the progress events of applying, tracking and deleting resources to the stream.
+func (m *RolloutPhaseManager) WithProgressStream(progress *rel.ProgressStream) *RolloutPhaseManager {
+	m.progress = progress
+
+	return m
+}
+
+// What to do with the orphaned resources after the rollout, they are deleted by default.
+func (m *RolloutPhaseManager) WithPrunePolicy(policy phases.PrunePolicy) *RolloutPhaseManager {
+	m.prunePolicy = policy
+
+	return m
+}
+
+// Log the warnings of the rollout with warn, e.g. to count them, instead of the log passed to
+// WithAPIUnavailabilityBudget. The formats passed to warn don't include messages.WarningPrefix.
+func (m *RolloutPhaseManager) WithWarn(warn func(string, ...interface{})) *RolloutPhaseManager {
+	m.warn = warn
+
+	return m
+}
+
+// Mark the resources applied without tracking them because of the unsupported resources policy in the deploy report.
+func (m *RolloutPhaseManager) WithUnsupportedResources(resources kube.ResourceList) *RolloutPhaseManager {
+	m.unsupportedResources = resources
+
+	return m
+}
+
+// The canaries of the Deployments are applied whether they exist or not, and deleted after the stages of their
+// Deployments are tracked, or if a stage fails.
 func (m *RolloutPhaseManager) DoStage(
 	extDepTrackFn func(stgIndex int, stage *stages.Stage) error,
 	applyFn func(stgIndex int, stage *stages.Stage, prevDeployedStgResources kube.ResourceList) error,
 	trackFn func(stgIndex int, stage *stages.Stage) error,
-) error {
+) (err error) {
+	defer func() {
+		// The canaries of a failed rollout would keep running the new version next to the old one.
+		if err != nil && len(m.pendingCanaries) > 0 {
+			m.deleteCanaries(nil, m.pendingCanaries)
+		}
+	}()
+
 	for i, stg := range m.Phase.SortedStages {
-		if err := extDepTrackFn(i, stg); err != nil {
-			return fmt.Errorf("error tracking external dependencies: %w", err)
+		if err := m.withAPIUnavailabilityRetry(fmt.Sprintf("tracking external dependencies of stage %d", i), func(_ bool) error {
+			return extDepTrackFn(i, stg)
+		}); err != nil {
+			return &TrackError{StageIndex: i, Err: messages.Errorf(messages.RolloutTrackExternalDependencies, err)}
 		}
 
-		if err := applyFn(i, stg, m.previouslyDeployedResources.Intersect(stg.DesiredResources)); err != nil {
+		stageStart := time.Now()
+		prevDeployedStgResources := m.previouslyDeployedResources.Intersect(stg.DesiredResources)
+		if stg.CanaryStep > 0 {
+			// The canary is left by the previous step or by a failed deploy if it exists.
+			prevDeployedStgResources = stg.DesiredResources
+		}
+		if err := m.withAPIUnavailabilityRetry(fmt.Sprintf("applying resources of stage %d", i), func(firstAttempt bool) error {
+			if !firstAttempt {
+				// Any of the stage resources might have been applied by the failed attempt.
+				prevDeployedStgResources = stg.DesiredResources
+			}
+
+			return applyFn(i, stg, prevDeployedStgResources)
+		}); err != nil {
+			m.reportStage(i, stg, prevDeployedStgResources, time.Since(stageStart), err)
+			m.progress.StageFailed(m.Release, i, err)
 			return &ApplyError{StageIndex: i, Err: err}
 		}
+		if stg.Result != nil {
+			m.emitResources(rel.ProgressEventResourceApplied, &i, stg.Result.Created)
+			m.emitResources(rel.ProgressEventResourceApplied, &i, stg.Result.Updated)
+		}
+		if stg.CanaryStep > 0 {
+			m.pendingCanaries.Merge(stg.DesiredResources)
+		}
+
+		// The generated names are indexed by the order of the resources in the manifest.
+		resources := m.Phase.Resources
+		if resources == nil {
+			resources = m.Phase.SortedStages.MergedDesiredResources()
+		}
+		m.Release.GeneratedNames = releaseutil.RecordGeneratedNames(m.Release.GeneratedNames, resources)
 
 		rel.SetRolloutPhaseStageInfo(m.Release, i)
-		if err := m.Storage.Update(m.Release); err != nil {
-			return fmt.Errorf("error updating release in storage: %w", err)
+		if err := m.withAPIUnavailabilityRetry(fmt.Sprintf("updating release of stage %d", i), func(_ bool) error {
+			return m.Storage.Update(m.Release)
+		}); err != nil {
+			return messages.Errorf(messages.RolloutUpdateRelease, err)
 		}
 
-		if err := trackFn(i, stg); err != nil {
-			return fmt.Errorf("error tracking resources: %w", err)
+		if err := m.withAPIUnavailabilityRetry(fmt.Sprintf("tracking resources of stage %d", i), func(_ bool) error {
+			return trackFn(i, stg)
+		}); err != nil {
+			m.reportStage(i, stg, prevDeployedStgResources, time.Since(stageStart), err)
+			m.progress.StageFailed(m.Release, i, err)
+			return &TrackError{StageIndex: i, Err: messages.Errorf(messages.RolloutTrackResources, err)}
+		}
+		m.emitResources(rel.ProgressEventResourceReady, &i, stg.DesiredResources)
+
+		m.reportStage(i, stg, prevDeployedStgResources, time.Since(stageStart), nil)
+
+		if len(stg.Canaries) > 0 {
+			m.deleteCanaries(&i, stg.Canaries)
+			m.pendingCanaries = m.pendingCanaries.Difference(stg.Canaries)
 		}
 	}
 
 	return nil
 }
 
+// Failing to delete a canary doesn't fail the rollout, the canary is deleted by the next one.
+func (m *RolloutPhaseManager) deleteCanaries(stgIndex *int, canaries kube.ResourceList) {
+	deleteStart := time.Now()
+	result, errs := m.kubeClient.Delete(canaries, kube.DeleteOptions{
+		Wait:                   true,
+		SkipIfInvalidOwnership: true,
+		ReleaseName:            m.Release.Name,
+		ReleaseNamespace:       m.Release.Namespace,
+	})
+	if result != nil {
+		m.reportResources(result.Deleted, rel.ResourceOperationDelete, stgIndex, time.Since(deleteStart), nil)
+		m.emitResources(rel.ProgressEventResourceDeleted, stgIndex, result.Deleted)
+	}
+	if len(errs) > 0 {
+		m.warning(messages.Format(messages.RolloutDeleteCanaries), joinErrors(errs))
+	}
+}
+
+func (m *RolloutPhaseManager) warning(format string, v ...interface{}) {
+	if m.warn != nil {
+		m.warn(format, v...)
+	} else if m.log != nil {
+		m.log(messages.WarningPrefix+format, v...)
+	}
+}
+
+// Previously deployed resources which are not part of the release anymore, including the expired generations of
+// immutable resources. If the generations can't be calculated, none of them is returned along with the error, but the
+// other orphans still are.
+func (m *RolloutPhaseManager) OrphanedResources() (kube.ResourceList, error) {
+	orphanedResources := m.previouslyDeployedResources.
+		Difference(m.Phase.AllResources()).
+		Difference(m.Phase.SkippedResources)
+
+	keptGenerations, expiredGenerations, err := m.deployedResourcesCalculator.CalculateImmutableGenerations(m.immutableGenerationsToKeep)
+	if err != nil {
+		// Generations might still be in use.
+		return orphanedResources.Filter(func(res *resource.Info) bool {
+			return !phases.IsImmutableGeneration(res)
+		}), messages.Errorf(messages.RolloutCalculateGenerations, err)
+	}
+
+	orphanedResources = orphanedResources.Difference(keptGenerations)
+	orphanedResources.Merge(expiredGenerations.
+		Difference(m.Phase.AllResources()).
+		Difference(m.Phase.SkippedResources))
+
+	return orphanedResources, nil
+}
+
 func (m *RolloutPhaseManager) DeleteOrphanedResources() error {
-	orphanedResources := m.previouslyDeployedResources.Difference(m.Phase.AllResources())
-	_, errs := m.kubeClient.Delete(orphanedResources, kube.DeleteOptions{
+	orphanedResources, generationsErr := m.OrphanedResources()
+
+	prunedResources, keptResources, err := phases.SplitOrphanedResources(orphanedResources, m.prunePolicy)
+	if err != nil {
+		return messages.Errorf(messages.RolloutSplitOrphans, err)
+	}
+
+	m.logKeptResources(keptResources)
+	m.reportResources(keptResources, rel.ResourceOperationKeep, nil, 0, nil)
+
+	deleteStart := time.Now()
+	result, errs := m.kubeClient.Delete(prunedResources, kube.DeleteOptions{
 		Wait:                   true,
 		SkipIfInvalidOwnership: true,
 		ReleaseName:            m.Release.Name,
 		ReleaseNamespace:       m.Release.Namespace,
 	})
+	if result != nil {
+		m.reportResources(result.Deleted, rel.ResourceOperationDelete, nil, time.Since(deleteStart), nil)
+		m.emitResources(rel.ProgressEventResourceDeleted, nil, result.Deleted)
+	}
+	if generationsErr != nil {
+		errs = append(errs, generationsErr)
+	}
 	if len(errs) > 0 {
-		return fmt.Errorf("while deleting previously deployed but now orphaned resources got %d error(s): %s", len(errs), joinErrors(errs))
+		return messages.Errorf(messages.RolloutDeleteOrphans, len(errs), joinErrors(errs))
 	}
 
 	return nil
 }
 
+func (m *RolloutPhaseManager) logKeptResources(resources kube.ResourceList) {
+	for _, res := range resources {
+		switch m.prunePolicy {
+		case phases.PrunePolicyWarnOnly:
+			m.warning(messages.Format(messages.RolloutOrphanKeptByPolicy), kube.ResourceNameNamespaceKind(res), m.prunePolicy)
+		case phases.PrunePolicyKeep:
+		default:
+			if m.log != nil {
+				m.log(messages.Format(messages.RolloutOrphanKeptByAnnotation), kube.ResourceNameNamespaceKind(res), phases.NoPruneAnnotation)
+			}
+		}
+	}
+}
+
+// Resources the stage failed on before applying them are reported as failed, as the failure can't be attributed
+// to a single resource.
+func (m *RolloutPhaseManager) reportStage(stgIndex int, stg *stages.Stage, prevDeployedStgResources kube.ResourceList, duration time.Duration, err error) {
+	if m.deployReport == nil {
+		return
+	}
+
+	result := stg.Result
+	if result == nil {
+		result = &kube.Result{}
+	}
+
+	m.reportResources(result.Created, rel.ResourceOperationCreate, &stgIndex, duration, err)
+	m.reportResources(result.Updated, rel.ResourceOperationUpdate, &stgIndex, duration, err)
+	m.reportResources(result.Deleted, rel.ResourceOperationDelete, &stgIndex, duration, err)
+
+	if err != nil {
+		notApplied := stg.DesiredResources.Difference(result.Created).Difference(result.Updated)
+		m.reportResources(notApplied.Intersect(prevDeployedStgResources), rel.ResourceOperationUpdate, &stgIndex, duration, err)
+		m.reportResources(notApplied.Difference(prevDeployedStgResources), rel.ResourceOperationCreate, &stgIndex, duration, err)
+	}
+}
+
+func (m *RolloutPhaseManager) reportResources(resources kube.ResourceList, operation rel.ResourceOperation, stgIndex *int, duration time.Duration, err error) {
+	if m.deployReport == nil {
+		return
+	}
+
+	for _, res := range resources {
+		report := &rel.ResourceReport{
+			Kind:        res.Mapping.GroupVersionKind.Kind,
+			Name:        res.Name,
+			Namespace:   res.Namespace,
+			Operation:   operation,
+			Phase:       rel.PhaseRollout,
+			Stage:       stgIndex,
+			Duration:    duration.Round(time.Millisecond).String(),
+			Status:      rel.ResourceStatusSucceeded,
+			Unsupported: m.unsupportedResources.Contains(res),
+		}
+		if err != nil {
+			report.Status = rel.ResourceStatusFailed
+			report.Error = err.Error()
+		}
+
+		m.deployReport.AddResources(report)
+	}
+}
+
 func joinErrors(errs []error) string {
 	es := make([]string, 0, len(errs))
 	for _, e := range errs {
@@ -111,3 +360,27 @@ func (e ApplyError) Error() string {
 func (e ApplyError) Unwrap() error {
 	return e.Err
 }
+
+// Error tracking the external dependencies or the resources of the stage.
+type TrackError struct {
+	StageIndex int
+	Err        error
+}
+
+func (e TrackError) Error() string {
+	return e.Err.Error()
+}
+
+func (e TrackError) Unwrap() error {
+	return e.Err
+}
+
+func (m *RolloutPhaseManager) emitResources(eventType rel.ProgressEventType, stgIndex *int, resources kube.ResourceList) {
+	if m.progress == nil {
+		return
+	}
+
+	for _, res := range resources {
+		m.progress.Resource(m.Release, eventType, stgIndex, res.Mapping.GroupVersionKind.Kind, res.Name, res.Namespace)
+	}
+}
@@ -0,0 +1,324 @@
+package phasestest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	rel "github.com/werf/3p-helm/pkg/release"
+)
+
+// benchmarkSizes are the numbers of the resources of the synthetic releases
+// of the benchmarks.
+var benchmarkSizes = []int{1000, 5000}
+
+// benchmarkBaselineFile holds the results of the benchmarks of the last
+// accepted change, in the format of "go test -bench", to be compared with
+// benchstat. Replace it with the results of "make test-benchmarks" when the
+// performance changes on purpose.
+const benchmarkBaselineFile = "testdata/benchmarks.txt"
+
+// allocsTolerance is how much the allocations of an operation may grow over
+// the baseline before TestAllocsRegression fails.
+const allocsTolerance = 1.25
+
+// syntheticRelease is a release of the app with the number of the resources:
+// Deployments, Services depending on them and ConfigMaps. Half of the
+// resources of the release are live, the previous revision of the release
+// has a tenth of them and as many orphaned ConfigMaps.
+type syntheticRelease struct {
+	snapshot *Snapshot
+	release  *rel.Release
+}
+
+func newSyntheticRelease(resources int) *syntheticRelease {
+	const namespace = "bench"
+
+	apps := resources / 3
+
+	var manifest, prevManifest strings.Builder
+	var live []map[string]interface{}
+	for i := 0; i < apps; i++ {
+		name := fmt.Sprintf("app-%d", i)
+
+		fmt.Fprintf(&manifest, `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %[1]s
+  labels: {app: %[1]s}
+spec:
+  replicas: 2
+  selector:
+    matchLabels: {app: %[1]s}
+  template:
+    metadata:
+      labels: {app: %[1]s}
+    spec:
+      containers:
+      - name: app
+        image: registry.example.com/app:%[2]d
+        ports: [{containerPort: 8080}]
+        envFrom: [{configMapRef: {name: %[1]s}}]
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: %[1]s
+  annotations:
+    werf.io/deploy-dependency-app: apps/v1:Deployment:%[1]s
+spec:
+  selector: {app: %[1]s}
+  ports: [{port: 80, targetPort: 8080}]
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: %[1]s
+data:
+  LOG_LEVEL: info
+  LISTEN: ":8080"
+`, name, i)
+
+		if i%2 == 0 {
+			live = append(live,
+				map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]interface{}{"name": name, "namespace": namespace}},
+				map[string]interface{}{"apiVersion": "v1", "kind": "Service", "metadata": map[string]interface{}{"name": name, "namespace": namespace}},
+				map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": name, "namespace": namespace}},
+			)
+		}
+
+		if i%10 == 0 {
+			legacy := fmt.Sprintf("%s-legacy", name)
+			fmt.Fprintf(&prevManifest, "---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: %s\n", name)
+			fmt.Fprintf(&prevManifest, "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n", legacy)
+			live = append(live, map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": legacy, "namespace": namespace}})
+		}
+	}
+
+	return &syntheticRelease{
+		snapshot: &Snapshot{
+			Namespace: namespace,
+			APIResources: []APIResource{
+				{Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Namespaced: true},
+				{Version: "v1", Kind: "Service", Resource: "services", Namespaced: true},
+				{Group: "apps", Version: "v1", Kind: "Deployment", Resource: "deployments", Namespaced: true},
+			},
+			Resources: live,
+			Releases: []*rel.Release{
+				{Name: "app", Namespace: namespace, Version: 1, Info: &rel.Info{Status: rel.StatusDeployed}, Manifest: prevManifest.String()},
+			},
+		},
+		release: &rel.Release{
+			Name:      "app",
+			Namespace: namespace,
+			Version:   2,
+			Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+			Manifest:  manifest.String(),
+		},
+	}
+}
+
+// buildResources builds the resources of the release manifest.
+func (s *syntheticRelease) buildResources() (kube.ResourceList, error) {
+	return s.snapshot.KubeClient().Build(strings.NewReader(s.release.Manifest), false)
+}
+
+// buildPlan builds the resources and the deploy plan of the release.
+func (s *syntheticRelease) buildPlan() (Plan, error) {
+	return Simulate(s.snapshot, s.release, nil, nil)
+}
+
+// buildReport makes the JSON deploy report of the operations of the plan.
+func (s *syntheticRelease) buildReport(plan Plan) ([]byte, error) {
+	report := rel.NewDeployReport()
+	for _, op := range plan {
+		namespaceKind, name, _ := strings.Cut(op.Resource, "/")
+		namespace, kind, _ := strings.Cut(namespaceKind, ":")
+
+		report.AddResources(&rel.ResourceReport{
+			Kind:      kind,
+			Name:      name,
+			Namespace: namespace,
+			Operation: rel.ResourceOperation(op.Type),
+			Phase:     rel.PhaseRollout,
+			Stage:     op.Stage,
+			Duration:  time.Second.String(),
+			Status:    rel.ResourceStatusSucceeded,
+		})
+	}
+
+	return report.FromRelease(s.release).ToJSONData()
+}
+
+func BenchmarkBuildResources(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		s := newSyntheticRelease(size)
+		b.Run(fmt.Sprintf("%dk", size/1000), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.buildResources(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBuildPlan(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		s := newSyntheticRelease(size)
+		b.Run(fmt.Sprintf("%dk", size/1000), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.buildPlan(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBuildReport(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		s := newSyntheticRelease(size)
+		plan, err := s.buildPlan()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(fmt.Sprintf("%dk", size/1000), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.buildReport(plan); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSyntheticReleasePlan(t *testing.T) {
+	plan, err := newSyntheticRelease(30).buildPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[OperationType]int{}
+	for _, op := range plan {
+		counts[op.Type]++
+	}
+	if counts[OperationCreate] != 15 || counts[OperationUpdate] != 15 || counts[OperationDelete] != 1 {
+		t.Errorf("unexpected operations of the synthetic release: %v\n%s", counts, plan)
+	}
+}
+
+// TestAllocsRegression checks the allocations of the operations on the
+// synthetic release of 1k resources against the baseline. Unlike the time,
+// the allocations don't depend on the machine, so the check is stable in CI.
+func TestAllocsRegression(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping allocations regression test in short mode")
+	}
+
+	baseline, err := loadAllocsBaseline(benchmarkBaselineFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSyntheticRelease(1000)
+	plan, err := s.buildPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := map[string]func() error{
+		"BenchmarkBuildResources/1k": func() error {
+			_, err := s.buildResources()
+			return err
+		},
+		"BenchmarkBuildPlan/1k": func() error {
+			_, err := s.buildPlan()
+			return err
+		},
+		"BenchmarkBuildReport/1k": func() error {
+			_, err := s.buildReport(plan)
+			return err
+		},
+	}
+
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			expected, ok := baseline[name]
+			if !ok {
+				t.Fatalf("no baseline for %s in %s", name, benchmarkBaselineFile)
+			}
+
+			var opErr error
+			allocs := testing.AllocsPerRun(3, func() {
+				if err := op(); err != nil {
+					opErr = err
+				}
+			})
+			if opErr != nil {
+				t.Fatal(opErr)
+			}
+
+			if allocs > expected*allocsTolerance {
+				t.Errorf("%s makes %.0f allocs/op, more than %.0f%% over the baseline of %.0f allocs/op, update %s if it is expected",
+					name, allocs, (allocsTolerance-1)*100, expected, benchmarkBaselineFile)
+			}
+		})
+	}
+}
+
+// loadAllocsBaseline returns the allocs/op of the benchmarks in the output of
+// "go test -bench -benchmem", by the benchmark names without the GOMAXPROCS
+// suffix.
+func loadAllocsBaseline(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening benchmarks baseline: %w", err)
+	}
+	defer f.Close()
+
+	result := map[string]float64{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+
+		name := fields[0]
+		if i := strings.LastIndex(name, "-"); i > 0 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				name = name[:i]
+			}
+		}
+
+		for i := 1; i < len(fields); i++ {
+			if fields[i] != "allocs/op" {
+				continue
+			}
+
+			allocs, err := strconv.ParseFloat(fields[i-1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing allocs/op of %s: %w", name, err)
+			}
+			result[name] = allocs
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading benchmarks baseline: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,241 @@
+package phasestest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/phases"
+	"github.com/werf/3p-helm/pkg/phases/phasemanagers"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+	rel "github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
+	"github.com/werf/3p-helm/pkg/storage"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+)
+
+type OperationType string
+
+const (
+	OperationCreate OperationType = "create"
+	OperationUpdate OperationType = "update"
+	OperationDelete OperationType = "delete"
+	OperationKeep   OperationType = "keep"
+)
+
+type Operation struct {
+	Type OperationType
+	// Index of the rollout phase stage. Orphaned resources, which are deleted
+	// or kept after all stages, have no stage.
+	Stage *int
+	// As returned by kube.ResourceNameNamespaceKind.
+	Resource string
+}
+
+func (o Operation) String() string {
+	if o.Stage == nil {
+		return fmt.Sprintf("%s %s", o.Type, o.Resource)
+	}
+
+	return fmt.Sprintf("stage %d: %s %s", *o.Stage, o.Type, o.Resource)
+}
+
+// Plan is the ordered list of operations that a rollout phase would perform.
+type Plan []Operation
+
+func (p Plan) Strings() []string {
+	var result []string
+	for _, op := range p {
+		result = append(result, op.String())
+	}
+
+	return result
+}
+
+func (p Plan) String() string {
+	return strings.Join(p.Strings(), "\n")
+}
+
+// Simulate builds the rollout phase of the release against the Snapshot and
+// drives it with phasemanagers.RolloutPhaseManager the same way Install,
+// Upgrade and Rollback actions do, against a fake cluster holding the live
+// resources of the Snapshot, and returns the operations the phase performed.
+// Nothing is applied to a real cluster. The resources are selected by
+// werf.io/deploy-on by the status of the release, e.g. as an install for
+// rel.StatusPendingInstall. Orphaned resources are pruned unless annotated
+// with phases.NoPruneAnnotation.
+func Simulate(snapshot *Snapshot, release *rel.Release, stagesSplitter phases.Splitter, stagesExternalDepsGenerator phases.ExternalDepsGenerator) (Plan, error) {
+	if stagesSplitter == nil {
+		stagesSplitter = &phases.SingleStageSplitter{}
+	}
+
+	if stagesExternalDepsGenerator == nil {
+		stagesExternalDepsGenerator = &phases.NoExternalDepsGenerator{}
+	}
+
+	liveResources, err := snapshot.LiveResources()
+	if err != nil {
+		return nil, fmt.Errorf("error building live resources: %w", err)
+	}
+
+	kubeClient := &simulatedKubeClient{SnapshotKubeClient: snapshot.KubeClient(), live: liveResources}
+
+	// The rollout records its progress in the release.
+	release = copyRelease(release)
+	releases := storage.Init(driver.NewMemory())
+	if err := releases.Create(release); err != nil {
+		return nil, fmt.Errorf("error storing release: %w", err)
+	}
+
+	resources, err := kubeClient.Build(bytes.NewBufferString(release.Manifest), false)
+	if err != nil {
+		return nil, fmt.Errorf("error building kubernetes objects from manifests: %w", err)
+	}
+
+	if err := resources.Visit(releaseutil.SetGeneratedNamesVisitor(release.GeneratedNames)); err != nil {
+		return nil, fmt.Errorf("error setting generated names: %w", err)
+	}
+
+	resources, skippedResources, err := phases.SplitResourcesByDeployOn(resources, deployTypeOf(release))
+	if err != nil {
+		return nil, err
+	}
+
+	rolloutPhase, err := phases.NewRolloutPhase(release, stagesSplitter, kubeClient).ParseStages(resources)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing stages for rollout phase: %w", err)
+	}
+	rolloutPhase.SkipResources(skippedResources)
+
+	if err := rolloutPhase.GenerateStagesExternalDeps(stagesExternalDepsGenerator); err != nil {
+		return nil, fmt.Errorf("error generating external deps for rollout phase: %w", err)
+	}
+
+	history := snapshot.History(release.Name, release.Version)
+	deployedResourcesCalculator := phases.NewDeployedResourcesCalculator(history, stagesSplitter, kubeClient)
+
+	report := rel.NewDeployReport()
+	rolloutPhaseManager, err := phasemanagers.NewRolloutPhaseManager(rolloutPhase, deployedResourcesCalculator, release, releases, kubeClient).
+		WithPrunePolicy(phases.PrunePolicyPrune).
+		WithDeployReport(report).
+		AddCalculatedPreviouslyDeployedResources()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rolloutPhaseManager.DoStage(
+		func(int, *stages.Stage) error { return nil },
+		func(_ int, stage *stages.Stage, prevDeployedStgResources kube.ResourceList) error {
+			stage.Result, err = kubeClient.Update(prevDeployedStgResources, stage.DesiredResources, false, kube.UpdateOptions{})
+			return err
+		},
+		func(int, *stages.Stage) error { return nil },
+	); err != nil {
+		return nil, err
+	}
+
+	if err := rolloutPhaseManager.DeleteOrphanedResources(); err != nil {
+		return nil, err
+	}
+
+	return planFromReport(report, rolloutPhase.SortedStages), nil
+}
+
+// planFromReport returns the operations recorded in the deploy report of the
+// rollout. The operations of a stage are in the order of its resources, the
+// deleted canaries last, and followed by the orphans.
+func planFromReport(report *rel.DeployReport, sortedStages stages.SortedStageList) Plan {
+	var plan Plan
+	for _, res := range report.Resources {
+		plan = append(plan, Operation{
+			Type:     OperationType(res.Operation),
+			Stage:    res.Stage,
+			Resource: fmt.Sprint(res.Namespace, ":", res.Kind, "/", res.Name),
+		})
+	}
+
+	positions := make([]map[string]int, len(sortedStages))
+	for i, stg := range sortedStages {
+		positions[i] = make(map[string]int, len(stg.DesiredResources))
+		for j, res := range stg.DesiredResources {
+			positions[i][kube.ResourceNameNamespaceKind(res)] = j
+		}
+	}
+
+	positionInStage := func(op Operation) int {
+		if pos, found := positions[*op.Stage][op.Resource]; found {
+			return pos
+		}
+		return len(positions[*op.Stage])
+	}
+
+	sort.SliceStable(plan, func(i, j int) bool {
+		a, b := plan[i], plan[j]
+		switch {
+		case a.Stage == nil || b.Stage == nil:
+			return a.Stage != nil && b.Stage == nil
+		case *a.Stage != *b.Stage:
+			return *a.Stage < *b.Stage
+		default:
+			return positionInStage(a) < positionInStage(b)
+		}
+	})
+
+	return plan
+}
+
+func deployTypeOf(release *rel.Release) phases.DeployType {
+	switch release.Info.Status {
+	case rel.StatusPendingInstall:
+		return phases.DeployTypeInstall
+	case rel.StatusPendingRollback:
+		return phases.DeployTypeRollback
+	default:
+		return phases.DeployTypeUpgrade
+	}
+}
+
+func copyRelease(release *rel.Release) *rel.Release {
+	result := *release
+	info := *release.Info
+	result.Info = &info
+
+	return &result
+}
+
+// simulatedKubeClient is a SnapshotKubeClient which applies and deletes the
+// resources in memory, starting with the live resources of the Snapshot, so
+// the results tell the created resources from the updated ones and skip
+// deleting the missing ones like a real cluster.
+type simulatedKubeClient struct {
+	*SnapshotKubeClient
+
+	live kube.ResourceList
+}
+
+func (c *simulatedKubeClient) Create(resources kube.ResourceList, _ kube.CreateOptions) (*kube.Result, error) {
+	return c.Update(nil, resources, false, kube.UpdateOptions{})
+}
+
+func (c *simulatedKubeClient) Update(_, target kube.ResourceList, _ bool, _ kube.UpdateOptions) (*kube.Result, error) {
+	result := &kube.Result{}
+	for _, res := range target {
+		if c.live.Contains(res) {
+			result.Updated.Append(res)
+		} else {
+			result.Created.Append(res)
+			c.live.Append(res)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *simulatedKubeClient) Delete(resources kube.ResourceList, _ kube.DeleteOptions) (*kube.Result, []error) {
+	result := &kube.Result{Deleted: resources.Intersect(c.live)}
+	c.live = c.live.Difference(resources)
+
+	return result, nil
+}
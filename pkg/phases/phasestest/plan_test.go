@@ -0,0 +1,793 @@
+package phasestest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/werf/3p-helm/pkg/phases"
+	rel "github.com/werf/3p-helm/pkg/release"
+)
+
+func TestSimulateUpgrade(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/upgrade.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   3,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app-credentials
+`,
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"stage 0: update myns:Deployment/app",
+		"stage 0: update myns:Service/app",
+		"stage 0: create myns:Secret/app-credentials",
+		"delete myns:ConfigMap/legacy",
+		"delete :ClusterRole/app-reader",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
+
+func TestSimulateUnknownKind(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/upgrade.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   3,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest:  "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n",
+	}
+
+	if _, err := Simulate(snapshot, release, nil, nil); err == nil {
+		t.Error("expected error for a kind missing from the snapshot discovery data")
+	}
+}
+
+func TestSimulateDeployDependencies(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/upgrade.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   3,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    werf.io/deploy-dependency-credentials: v1:Secret:app-credentials,state=ready
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  annotations:
+    werf.io/deploy-dependency-app: apps/v1:Deployment:myns:app
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app-credentials
+`,
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"stage 0: create myns:Secret/app-credentials",
+		"stage 1: update myns:Deployment/app",
+		"stage 2: update myns:Service/app",
+		"delete myns:ConfigMap/legacy",
+		"delete :ClusterRole/app-reader",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
+
+func TestSimulateConditionDependencies(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/upgrade.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   3,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  annotations:
+    werf.io/deploy-dependency-app: apps/v1:Deployment:app,condition=Available=True
+`,
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"stage 0: update myns:Deployment/app",
+		"stage 1: update myns:Service/app",
+		"delete myns:ConfigMap/legacy",
+		"delete :ClusterRole/app-reader",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
+
+func TestSimulateCanarySteps(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/upgrade.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   3,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    werf.io/canary-steps: 10,50
+    werf.io/deploy-dependency-config: v1:ConfigMap:app-config
+spec:
+  replicas: 4
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+`,
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"stage 0: create myns:ConfigMap/app-config",
+		"stage 1: create myns:Deployment/app-canary",
+		"stage 2: update myns:Deployment/app-canary",
+		"stage 3: update myns:Deployment/app",
+		"stage 3: delete myns:Deployment/app-canary",
+		"delete myns:Service/app",
+		"delete myns:ConfigMap/legacy",
+		"delete :ClusterRole/app-reader",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
+
+func TestSimulateInterruptedCanary(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/canary.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   3,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest:  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app-config\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n",
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The canary left by the interrupted deploy is an orphan.
+	expect := []string{
+		"stage 0: update myns:ConfigMap/app-config",
+		"stage 0: update myns:Deployment/app",
+		"delete myns:Deployment/app-canary",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
+
+func TestSimulatePinnedPhases(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/upgrade.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   3,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: feature-flags
+  annotations:
+    werf.io/phase: post-rollout
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: maintenance-page
+  annotations:
+    werf.io/phase: pre-rollout
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  annotations:
+    werf.io/phase: rollout
+`,
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"stage 0: create myns:ConfigMap/maintenance-page",
+		"stage 1: update myns:Deployment/app",
+		"stage 1: update myns:Service/app",
+		"stage 2: create myns:ConfigMap/feature-flags",
+		"delete myns:ConfigMap/legacy",
+		"delete :ClusterRole/app-reader",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+
+	release.Manifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: maintenance-page
+  annotations:
+    werf.io/phase: pre-rollout
+    werf.io/deploy-dependency-app: apps/v1:Deployment:app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+`
+	if _, err := Simulate(snapshot, release, nil, nil); err == nil {
+		t.Error("expected an error for a dependency on a resource of a later phase")
+	}
+
+	release.Manifest = "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n  annotations:\n    werf.io/phase: later\n"
+	if _, err := Simulate(snapshot, release, nil, nil); err == nil {
+		t.Error("expected an error for an unknown phase")
+	}
+}
+
+func TestSimulateDeployDependencyErrors(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/upgrade.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, manifest := range map[string]string{
+		"missing": `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  annotations:
+    werf.io/deploy-dependency-app: apps/v1:Deployment:app
+`,
+		"cycle": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    werf.io/deploy-dependency-svc: v1:Service:app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  annotations:
+    werf.io/deploy-dependency-app: apps/v1:Deployment:app
+`,
+		"invalid": `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  annotations:
+    werf.io/deploy-dependency-app: Deployment/app
+`,
+		"invalid condition": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  annotations:
+    werf.io/deploy-dependency-app: apps/v1:Deployment:app,condition=Available
+`,
+	} {
+		release := &rel.Release{
+			Name:      "app",
+			Namespace: "myns",
+			Version:   3,
+			Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+			Manifest:  manifest,
+		}
+
+		if _, err := Simulate(snapshot, release, nil, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSimulateImmutableResources(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/immutable.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   3,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: log-level
+  annotations:
+    werf.io/version-immutable: "true"
+immutable: true
+data:
+  level: "3"
+`,
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generations of the previous revisions are deleted, the same content gets the same name.
+	expect := []string{
+		"stage 0: update myns:Deployment/app",
+		"stage 0: create myns:ConfigMap/log-level-0fe4a6f0cd",
+		"delete myns:ConfigMap/log-level-2c836903dc",
+		"delete myns:ConfigMap/log-level-72df34a78a",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
+
+func TestVersionImmutableResources(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/immutable.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := snapshot.KubeClient().Build(strings.NewReader(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      volumes:
+      - name: config
+        configMap:
+          name: log-level
+      - name: other
+        configMap:
+          name: other
+      containers:
+      - name: app
+        envFrom:
+        - configMapRef:
+            name: log-level
+        env:
+        - name: LEVEL
+          valueFrom:
+            configMapKeyRef:
+              name: log-level
+              key: level
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: log-level
+  annotations:
+    werf.io/version-immutable: "true"
+immutable: true
+data:
+  level: "1"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+data:
+  level: "1"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: tls
+  annotations:
+    werf.io/version-immutable: "true"
+immutable: true
+data:
+  tls.crt: Y3J0
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+spec:
+  tls:
+  - secretName: tls
+`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Versioning is idempotent.
+	for i := 0; i < 2; i++ {
+		if err := phases.VersionImmutableResources(resources, nil, "myns"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	for _, res := range resources {
+		names = append(names, res.Name)
+	}
+	if expect := []string{"app", "log-level-2c836903dc", "other", "tls-5fa71ff3eb", "app"}; !reflect.DeepEqual(names, expect) {
+		t.Errorf("expected names %v, got %v", expect, names)
+	}
+
+	deployment := resources[0].Object.(*unstructured.Unstructured).Object
+	podSpec, _, _ := unstructured.NestedMap(deployment, "spec", "template", "spec")
+	refs := []string{
+		podSpec["volumes"].([]interface{})[0].(map[string]interface{})["configMap"].(map[string]interface{})["name"].(string),
+		podSpec["volumes"].([]interface{})[1].(map[string]interface{})["configMap"].(map[string]interface{})["name"].(string),
+	}
+	container := podSpec["containers"].([]interface{})[0].(map[string]interface{})
+	envFrom, _, _ := unstructured.NestedString(container["envFrom"].([]interface{})[0].(map[string]interface{}), "configMapRef", "name")
+	env, _, _ := unstructured.NestedString(container["env"].([]interface{})[0].(map[string]interface{}), "valueFrom", "configMapKeyRef", "name")
+	refs = append(refs, envFrom, env)
+
+	tls, _, _ := unstructured.NestedSlice(resources[4].Object.(*unstructured.Unstructured).Object, "spec", "tls")
+	refs = append(refs, tls[0].(map[string]interface{})["secretName"].(string))
+
+	if expect := []string{"log-level-2c836903dc", "other", "log-level-2c836903dc", "log-level-2c836903dc", "tls-5fa71ff3eb"}; !reflect.DeepEqual(refs, expect) {
+		t.Errorf("expected references %v, got %v", expect, refs)
+	}
+}
+
+func TestVersionImmutableResourcesErrors(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/immutable.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configMap := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: log-level
+  annotations:
+    werf.io/version-immutable: "true"
+immutable: true
+data:
+  level: "1"
+`
+
+	for name, test := range map[string]struct {
+		manifest string
+		hooks    []*rel.Hook
+	}{
+		"mutable resource": {
+			manifest: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: log-level\n  annotations:\n    werf.io/version-immutable: \"true\"\n",
+		},
+		"invalid annotation": {
+			manifest: strings.Replace(configMap, `"true"`, "maybe", 1),
+		},
+		"reference by a custom resource": {
+			manifest: configMap + `---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: app
+spec:
+  configMapRef:
+    name: log-level
+`,
+		},
+		"reference by a hook": {
+			manifest: configMap,
+			hooks: []*rel.Hook{{
+				Name: "migrate",
+				Manifest: `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      volumes:
+      - name: config
+        configMap:
+          name: log-level
+`,
+			}},
+		},
+	} {
+		resources, err := snapshot.KubeClient().Build(strings.NewReader(test.manifest), false)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if err := phases.VersionImmutableResources(resources, test.hooks, "myns"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSimulateUnversionedImmutableResources(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/immutable_unversioned.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   2,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: log-level
+  annotations:
+    werf.io/version-immutable: "true"
+immutable: true
+data:
+  level: "1"
+`,
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The resource deployed before it was opted into versioning is an orphan.
+	expect := []string{
+		"stage 0: create myns:ConfigMap/log-level-2c836903dc",
+		"delete myns:ConfigMap/log-level",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
+
+func TestSimulateNoPrune(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/prune.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   2,
+		Info:      &rel.Info{Status: rel.StatusPendingUpgrade},
+		Manifest:  "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n",
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"stage 0: update myns:Deployment/app",
+		"keep myns:ConfigMap/seed",
+		"delete myns:ConfigMap/legacy",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
+
+func TestSimulateInternalDependencies(t *testing.T) {
+	snapshot, err := LoadSnapshot("testdata/internal_dependencies.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := &rel.Release{
+		Name:      "app",
+		Namespace: "myns",
+		Version:   1,
+		Info:      &rel.Info{Status: rel.StatusPendingInstall},
+		Manifest: `apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+  annotations:
+    werf.io/detect-deploy-dependencies: "true"
+spec:
+  defaultBackend:
+    service:
+      name: external
+  rules:
+  - http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    werf.io/detect-deploy-dependencies: "true"
+spec:
+  template:
+    spec:
+      serviceAccountName: app
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  annotations:
+    werf.io/detect-deploy-dependencies: "true"
+spec:
+  storageClassName: fast
+---
+apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: fast
+---
+apiVersion: example.com/v1
+kind: Backup
+metadata:
+  name: data
+  annotations:
+    werf.io/detect-deploy-dependencies: "true"
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: other
+spec:
+  defaultBackend:
+    service:
+      name: app
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: backups.example.com
+spec:
+  group: example.com
+  names:
+    kind: Backup
+    plural: backups
+`,
+	}
+
+	plan, err := Simulate(snapshot, release, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The dependency of the Ingress on the Service "external", which is not in the release, is ignored, and so are
+	// the dependencies of the resources without the annotation.
+	expect := []string{
+		"stage 0: create myns:Service/app",
+		"stage 0: create myns:ServiceAccount/app",
+		"stage 0: create :StorageClass/fast",
+		"stage 0: create myns:Ingress/other",
+		"stage 0: create :CustomResourceDefinition/backups.example.com",
+		"stage 1: create myns:Ingress/app",
+		"stage 1: create myns:Deployment/app",
+		"stage 1: create myns:PersistentVolumeClaim/data",
+		"stage 1: create myns:Backup/data",
+	}
+	if got := plan.Strings(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected plan:\nexpected:\n%v\ngot:\n%v", expect, got)
+	}
+}
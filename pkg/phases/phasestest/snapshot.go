@@ -0,0 +1,165 @@
+package phasestest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/cli-runtime/pkg/resource"
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	kubefake "github.com/werf/3p-helm/pkg/kube/fake"
+	rel "github.com/werf/3p-helm/pkg/release"
+)
+
+// Snapshot is a recorded state of a cluster: discovery data, live resources
+// and the release records stored in it.
+type Snapshot struct {
+	Namespace    string                   `json:"namespace"`
+	APIResources []APIResource            `json:"apiResources"`
+	Resources    []map[string]interface{} `json:"resources"`
+	Releases     []*rel.Release           `json:"releases"`
+}
+
+// APIResource is a single discovery entry of a Snapshot.
+type APIResource struct {
+	Group      string `json:"group"`
+	Version    string `json:"version"`
+	Kind       string `json:"kind"`
+	Resource   string `json:"resource"`
+	Namespaced bool   `json:"namespaced"`
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot file: %w", err)
+	}
+
+	snapshot := &Snapshot{}
+	if err := yaml.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("error unmarshalling snapshot %q: %w", path, err)
+	}
+
+	if snapshot.Namespace == "" {
+		snapshot.Namespace = "default"
+	}
+
+	return snapshot, nil
+}
+
+func (s *Snapshot) RESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, r := range s.APIResources {
+		scope := meta.RESTScopeRoot
+		if r.Namespaced {
+			scope = meta.RESTScopeNamespace
+		}
+
+		mapper.AddSpecific(
+			schema.GroupVersionKind{Group: r.Group, Version: r.Version, Kind: r.Kind},
+			schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource},
+			schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource},
+			scope,
+		)
+	}
+
+	return mapper
+}
+
+// LiveResources builds the recorded live resources of the cluster.
+func (s *Snapshot) LiveResources() (kube.ResourceList, error) {
+	var buf bytes.Buffer
+	for _, obj := range s.Resources {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling snapshot resource: %w", err)
+		}
+
+		buf.WriteString("---\n")
+		buf.Write(data)
+	}
+
+	return s.KubeClient().Build(&buf, false)
+}
+
+// History returns the recorded release records of the release with the
+// given name and revision lower than the specified one.
+func (s *Snapshot) History(releaseName string, beforeRevision int) []*rel.Release {
+	var history []*rel.Release
+	for _, r := range s.Releases {
+		if r.Name == releaseName && r.Version < beforeRevision {
+			history = append(history, r)
+		}
+	}
+
+	return history
+}
+
+// KubeClient returns a kube.Interface which builds resources using the
+// discovery data of the Snapshot and never contacts a cluster.
+func (s *Snapshot) KubeClient() *SnapshotKubeClient {
+	return &SnapshotKubeClient{
+		PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard},
+		namespace:          s.Namespace,
+		mapper:             s.RESTMapper(),
+	}
+}
+
+type SnapshotKubeClient struct {
+	kubefake.PrintingKubeClient
+
+	namespace string
+	mapper    meta.RESTMapper
+}
+
+func (c *SnapshotKubeClient) Build(reader io.Reader, _ bool) (kube.ResourceList, error) {
+	var result kube.ResourceList
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, fmt.Errorf("error decoding manifest: %w", err)
+		}
+
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		gvk := obj.GroupVersionKind()
+		mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("error getting resource mapping for %q: %w", gvk.String(), err)
+		}
+
+		info := &resource.Info{
+			Mapping: mapping,
+			Object:  obj,
+			Name:    obj.GetName(),
+		}
+
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(c.namespace)
+			}
+
+			info.Namespace = obj.GetNamespace()
+		}
+
+		result.Append(info)
+	}
+
+	return result, nil
+}
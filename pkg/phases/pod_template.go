@@ -0,0 +1,35 @@
+package phases
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+// Returns the labels of the pods of the resource, which are its own labels for a Pod and the labels of its pod
+// template for a workload. False is returned if the resource has no pods.
+func PodTemplateLabels(res *resource.Info) (map[string]string, bool, error) {
+	kind := res.Object.GetObjectKind().GroupVersionKind().Kind
+	path, found := podSpecPaths[kind]
+	if !found {
+		return nil, false, nil
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(res.Object)
+	if err != nil {
+		return nil, false, fmt.Errorf("error converting %q to unstructured: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	// The metadata is next to the pod spec.
+	labelsPath := append(append([]string{}, path[:len(path)-1]...), "metadata", "labels")
+	labels, _, err := unstructured.NestedStringMap(obj, labelsPath...)
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting pod labels of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	return labels, true, nil
+}
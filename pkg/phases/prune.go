@@ -0,0 +1,90 @@
+package phases
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+// Set to "true" to keep the resource in the cluster when it becomes an orphan, i.e. when it is removed from the
+// chart, regardless of the prune policy. The resource is no longer managed by the release.
+const NoPruneAnnotation = "werf.io/no-prune"
+
+// What is done after the rollout with the orphaned resources, the previously deployed resources which are not part
+// of the release anymore.
+type PrunePolicy string
+
+const (
+	// Delete the orphaned resources. The default.
+	PrunePolicyPrune PrunePolicy = "prune"
+	// Keep the orphaned resources, warning about each of them.
+	PrunePolicyWarnOnly PrunePolicy = "warn-only"
+	// Keep the orphaned resources.
+	PrunePolicyKeep PrunePolicy = "keep"
+)
+
+// An empty policy is PrunePolicyPrune.
+func ParsePrunePolicy(value string) (PrunePolicy, error) {
+	switch policy := PrunePolicy(value); policy {
+	case "":
+		return PrunePolicyPrune, nil
+	case PrunePolicyPrune, PrunePolicyWarnOnly, PrunePolicyKeep:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown prune policy %q: expected %q, %q or %q", value, PrunePolicyPrune, PrunePolicyWarnOnly, PrunePolicyKeep)
+	}
+}
+
+// Splits orphaned resources into the ones to delete and the ones to keep because of the policy or the no-prune
+// annotation.
+func SplitOrphanedResources(orphans kube.ResourceList, policy PrunePolicy) (prune, keep kube.ResourceList, err error) {
+	policy, err = ParsePrunePolicy(string(policy))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := orphans.Visit(func(res *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		noPrune, err := hasNoPruneAnnotation(res)
+		if err != nil {
+			return err
+		}
+
+		if policy != PrunePolicyPrune || noPrune {
+			keep.Append(res)
+		} else {
+			prune.Append(res)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("error visiting resources list: %w", err)
+	}
+
+	return prune, keep, nil
+}
+
+func hasNoPruneAnnotation(res *resource.Info) (bool, error) {
+	annotations, err := metadataAccessor.Annotations(res.Object)
+	if err != nil {
+		return false, fmt.Errorf("error getting annotations of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	value, found := annotations[NoPruneAnnotation]
+	if !found {
+		return false, nil
+	}
+
+	noPrune, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q of annotation %s of %q: expected \"true\" or \"false\"", value, NoPruneAnnotation, kube.ResourceNameNamespaceKind(res))
+	}
+
+	return noPrune, nil
+}
@@ -0,0 +1,164 @@
+package phases
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+// Matches resources either by kind and name, e.g. "Deployment/backend-*" or "*/backend", or by label,
+// e.g. "label:app.kubernetes.io/component=db*". Kind, name and label value are glob patterns.
+type ResourceMatcher struct {
+	raw string
+
+	kind  glob.Glob
+	name  glob.Glob
+	label string
+	value glob.Glob
+}
+
+func ParseResourceMatcher(s string) (*ResourceMatcher, error) {
+	m := &ResourceMatcher{raw: s}
+
+	var err error
+	if labelSelector, isLabel := strings.CutPrefix(s, "label:"); isLabel {
+		key, value, found := strings.Cut(labelSelector, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid resource matcher %q: expected \"label:<key>=<value>\"", s)
+		}
+
+		m.label = key
+		if m.value, err = glob.Compile(value); err != nil {
+			return nil, fmt.Errorf("invalid label value pattern in resource matcher %q: %w", s, err)
+		}
+
+		return m, nil
+	}
+
+	kind, name, found := strings.Cut(s, "/")
+	if !found || kind == "" || name == "" {
+		return nil, fmt.Errorf("invalid resource matcher %q: expected \"<kind>/<name>\" or \"label:<key>=<value>\"", s)
+	}
+
+	if m.kind, err = glob.Compile(kind); err != nil {
+		return nil, fmt.Errorf("invalid kind pattern in resource matcher %q: %w", s, err)
+	}
+	if m.name, err = glob.Compile(name); err != nil {
+		return nil, fmt.Errorf("invalid name pattern in resource matcher %q: %w", s, err)
+	}
+
+	return m, nil
+}
+
+func (m *ResourceMatcher) Match(res *resource.Info) (bool, error) {
+	if m.label != "" {
+		labels, err := metadataAccessor.Labels(res.Object)
+		if err != nil {
+			return false, fmt.Errorf("error getting labels of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+		}
+
+		value, found := labels[m.label]
+
+		return found && m.value.Match(value), nil
+	}
+
+	return m.kind.Match(res.Object.GetObjectKind().GroupVersionKind().Kind) && m.name.Match(res.Name), nil
+}
+
+func (m *ResourceMatcher) String() string {
+	return m.raw
+}
+
+// Selects a subset of the chart resources to deploy. If there are include matchers, only the resources
+// matching any of them are selected. Resources matching any of the exclude matchers are never selected.
+type ResourceSelector struct {
+	Include []*ResourceMatcher
+	Exclude []*ResourceMatcher
+}
+
+func NewResourceSelector(include, exclude []string) (*ResourceSelector, error) {
+	selector := &ResourceSelector{}
+
+	for _, s := range include {
+		m, err := ParseResourceMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		selector.Include = append(selector.Include, m)
+	}
+
+	for _, s := range exclude {
+		m, err := ParseResourceMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		selector.Exclude = append(selector.Exclude, m)
+	}
+
+	return selector, nil
+}
+
+func (s *ResourceSelector) IsEmpty() bool {
+	return len(s.Include) == 0 && len(s.Exclude) == 0
+}
+
+// Splits resources into the selected ones and the excluded ones.
+func (s *ResourceSelector) Split(resources kube.ResourceList) (selected, excluded kube.ResourceList, err error) {
+	if s.IsEmpty() {
+		return resources, nil, nil
+	}
+
+	if err := resources.Visit(func(res *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		isSelected, err := s.isSelected(res)
+		if err != nil {
+			return err
+		}
+
+		if isSelected {
+			selected.Append(res)
+		} else {
+			excluded.Append(res)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("error visiting resources list: %w", err)
+	}
+
+	return selected, excluded, nil
+}
+
+func (s *ResourceSelector) isSelected(res *resource.Info) (bool, error) {
+	if len(s.Include) > 0 {
+		included, err := matchAny(s.Include, res)
+		if err != nil || !included {
+			return false, err
+		}
+	}
+
+	excluded, err := matchAny(s.Exclude, res)
+	if err != nil {
+		return false, err
+	}
+
+	return !excluded, nil
+}
+
+func matchAny(matchers []*ResourceMatcher, res *resource.Info) (bool, error) {
+	for _, m := range matchers {
+		match, err := m.Match(res)
+		if err != nil || match {
+			return match, err
+		}
+	}
+
+	return false, nil
+}
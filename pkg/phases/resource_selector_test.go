@@ -0,0 +1,109 @@
+package phases
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+func newLabeledResource(kind, name string, labels map[string]string) *resource.Info {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+
+	return &resource.Info{Name: name, Namespace: "app", Object: obj}
+}
+
+func TestResourceSelectorSplit(t *testing.T) {
+	resources := kube.ResourceList{
+		newLabeledResource("Deployment", "backend-api", map[string]string{"app.kubernetes.io/component": "api"}),
+		newLabeledResource("Deployment", "backend-worker", nil),
+		newLabeledResource("Service", "backend-api", nil),
+		newLabeledResource("StatefulSet", "postgres", map[string]string{"app.kubernetes.io/component": "db-main"}),
+	}
+
+	names := func(resources kube.ResourceList) []string {
+		var result []string
+		for _, res := range resources {
+			result = append(result, res.Object.GetObjectKind().GroupVersionKind().Kind+"/"+res.Name)
+		}
+		return result
+	}
+
+	for _, tt := range []struct {
+		name     string
+		include  []string
+		exclude  []string
+		selected []string
+		excluded []string
+	}{
+		{
+			name:     "no matchers",
+			selected: []string{"Deployment/backend-api", "Deployment/backend-worker", "Service/backend-api", "StatefulSet/postgres"},
+		},
+		{
+			name:     "include by kind and name",
+			include:  []string{"Deployment/backend-*"},
+			selected: []string{"Deployment/backend-api", "Deployment/backend-worker"},
+			excluded: []string{"Service/backend-api", "StatefulSet/postgres"},
+		},
+		{
+			name:     "include by label",
+			include:  []string{"label:app.kubernetes.io/component=db*"},
+			selected: []string{"StatefulSet/postgres"},
+			excluded: []string{"Deployment/backend-api", "Deployment/backend-worker", "Service/backend-api"},
+		},
+		{
+			name:     "exclude by name of any kind",
+			exclude:  []string{"*/backend-api"},
+			selected: []string{"Deployment/backend-worker", "StatefulSet/postgres"},
+			excluded: []string{"Deployment/backend-api", "Service/backend-api"},
+		},
+		{
+			name:     "exclude wins over include",
+			include:  []string{"Deployment/*"},
+			exclude:  []string{"label:app.kubernetes.io/component=api"},
+			selected: []string{"Deployment/backend-worker"},
+			excluded: []string{"Deployment/backend-api", "Service/backend-api", "StatefulSet/postgres"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := NewResourceSelector(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			selected, excluded, err := selector.Split(resources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(selected); !reflect.DeepEqual(got, tt.selected) {
+				t.Errorf("expected to select %v, got %v", tt.selected, got)
+			}
+			if got := names(excluded); !reflect.DeepEqual(got, tt.excluded) {
+				t.Errorf("expected to exclude %v, got %v", tt.excluded, got)
+			}
+		})
+	}
+}
+
+func TestParseResourceMatcherInvalid(t *testing.T) {
+	for matcher, expected := range map[string]string{
+		"backend":         `expected "<kind>/<name>" or "label:<key>=<value>"`,
+		"Deployment/":     `expected "<kind>/<name>" or "label:<key>=<value>"`,
+		"label:component": `expected "label:<key>=<value>"`,
+		"label:=api":      `expected "label:<key>=<value>"`,
+		"Deployment/[":    "invalid name pattern",
+	} {
+		if _, err := ParseResourceMatcher(matcher); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", matcher, expected, err)
+		}
+	}
+}
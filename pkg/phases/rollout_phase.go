@@ -7,6 +7,7 @@ import (
 	"github.com/werf/3p-helm/pkg/kube"
 	"github.com/werf/3p-helm/pkg/phases/stages"
 	rel "github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/releaseutil"
 )
 
 func NewRolloutPhase(release *rel.Release, stagesSplitter Splitter, kubeClient kube.Interface) *RolloutPhase {
@@ -19,7 +20,11 @@ func NewRolloutPhase(release *rel.Release, stagesSplitter Splitter, kubeClient k
 
 type RolloutPhase struct {
 	SortedStages stages.SortedStageList
-	Release      *rel.Release
+	// Resources are the resources of the stages in the order of the manifest.
+	Resources kube.ResourceList
+	Release   *rel.Release
+	// Resources of the release which are not deployed on this deploy type.
+	SkippedResources kube.ResourceList
 
 	stagesSplitter Splitter
 	kubeClient     kube.Interface
@@ -31,19 +36,45 @@ func (m *RolloutPhase) ParseStagesFromString(manifests string) (*RolloutPhase, e
 		return nil, fmt.Errorf("error building kubernetes objects from manifests: %w", err)
 	}
 
+	if err := resources.Visit(releaseutil.SetGeneratedNamesVisitor(m.Release.GeneratedNames)); err != nil {
+		return nil, fmt.Errorf("error setting generated names: %w", err)
+	}
+
 	return m.ParseStages(resources)
 }
 
 func (m *RolloutPhase) ParseStages(resources kube.ResourceList) (*RolloutPhase, error) {
+	if err := VersionImmutableResources(resources, m.Release.Hooks, m.Release.Namespace); err != nil {
+		return nil, fmt.Errorf("error versioning immutable resources: %w", err)
+	}
+
+	m.Resources = resources
+
 	var err error
-	m.SortedStages, err = m.stagesSplitter.Split(resources)
+	m.SortedStages, err = splitStagesByPhases(m.stagesSplitter, resources)
 	if err != nil {
 		return nil, fmt.Errorf("error splitting rollout stage resources list: %w", err)
 	}
 
+	m.SortedStages, err = SplitStagesByDeployDependencies(m.SortedStages)
+	if err != nil {
+		return nil, fmt.Errorf("error ordering rollout stage resources by deploy dependencies: %w", err)
+	}
+
+	m.SortedStages, err = SplitStagesByCanarySteps(m.SortedStages)
+	if err != nil {
+		return nil, fmt.Errorf("error splitting rollout stages by canary steps: %w", err)
+	}
+
 	return m, nil
 }
 
+func (m *RolloutPhase) SkipResources(resources kube.ResourceList) *RolloutPhase {
+	m.SkippedResources.Merge(resources)
+
+	return m
+}
+
 func (m *RolloutPhase) GenerateStagesExternalDeps(stagesExternalDepsGenerator ExternalDepsGenerator) error {
 	if err := stagesExternalDepsGenerator.Generate(m.SortedStages); err != nil {
 		return fmt.Errorf("error generating external deps for stages: %w", err)
@@ -65,6 +96,24 @@ func (m *RolloutPhase) DeployedResources() kube.ResourceList {
 	return m.SortedStages.MergedDesiredResourcesInStagesRange(0, *lastDeployedStageIndex)
 }
 
+// The canaries of all the canary steps, see SplitStagesByCanarySteps. A canary is applied before its stage is recorded
+// as deployed and is left running if the deploy is interrupted before deleting it, so it is considered deployed
+// whatever the last deployed stage is.
+func (m *RolloutPhase) Canaries() kube.ResourceList {
+	if !m.IsPhaseStarted() {
+		return nil
+	}
+
+	var result kube.ResourceList
+	for _, stg := range m.SortedStages {
+		if stg.CanaryStep > 0 {
+			result.Merge(stg.DesiredResources)
+		}
+	}
+
+	return result
+}
+
 func (m *RolloutPhase) AllResources() kube.ResourceList {
 	return m.SortedStages.MergedDesiredResources()
 }
@@ -125,6 +174,10 @@ func (m *RolloutPhase) validateStagesExternalDeps() error {
 
 	for _, stage := range m.SortedStages {
 		for _, stageExtDep := range stage.ExternalDependencies {
+			if stageExtDep.IsSelector() {
+				continue
+			}
+
 			for _, phaseDesiredRes := range phaseDesiredResources {
 				if kube.ResourceNameNamespaceKind(stageExtDep.Info) == kube.ResourceNameNamespaceKind(phaseDesiredRes) {
 					return fmt.Errorf("resources from current release can't be external dependencies: remove external dependency on %q", kube.ResourceNameNamespaceKind(stageExtDep.Info))
@@ -0,0 +1,98 @@
+package phases
+
+import (
+	"fmt"
+
+	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
+	"github.com/werf/3p-helm/pkg/messages"
+	"github.com/werf/3p-helm/pkg/phases/stages"
+)
+
+// Pins the resource to a standard phase of the rollout: "pre-rollout" resources, e.g. maintenance pages, are
+// deployed before all the other resources, whatever their weights, and "post-rollout" resources, e.g. feature
+// flags, after them. Resources are deployed in the "rollout" phase if the annotation is not set.
+const PhaseAnnotation = "werf.io/phase"
+
+// Parses the value of PhaseAnnotation.
+func ParsePhase(value string) (stages.Phase, error) {
+	for _, phase := range stages.Phases {
+		if stages.Phase(value) == phase {
+			return phase, nil
+		}
+	}
+
+	return "", messages.Errorf(messages.ValidationUnknownPhase, value, stages.PhasePreRollout, stages.PhaseRollout, stages.PhasePostRollout)
+}
+
+// Splits the resources of every phase into stages with the splitter, the stages of the earlier phases first.
+func splitStagesByPhases(splitter Splitter, resources kube.ResourceList) (stages.SortedStageList, error) {
+	phaseResources := map[stages.Phase]kube.ResourceList{}
+	if err := resources.Visit(func(res *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		phase, err := phaseOf(res)
+		if err != nil {
+			return err
+		}
+		phaseResources[phase] = append(phaseResources[phase], res)
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("error visiting resources list: %w", err)
+	}
+
+	// Without pinned resources the stages are split as they were before the phases were introduced.
+	if len(phaseResources[stages.PhasePreRollout]) == 0 && len(phaseResources[stages.PhasePostRollout]) == 0 {
+		sortedStages, err := splitter.Split(resources)
+		if err != nil {
+			return nil, err
+		}
+		for _, stg := range sortedStages {
+			stg.Phase = stages.PhaseRollout
+		}
+
+		return sortedStages, nil
+	}
+
+	var result stages.SortedStageList
+	for _, phase := range stages.Phases {
+		if len(phaseResources[phase]) == 0 {
+			continue
+		}
+
+		sortedStages, err := splitter.Split(phaseResources[phase])
+		if err != nil {
+			return nil, fmt.Errorf("error splitting %s phase: %w", phase, err)
+		}
+		for _, stg := range sortedStages {
+			stg.Phase = phase
+		}
+
+		result = append(result, sortedStages...)
+	}
+
+	return result, nil
+}
+
+func phaseOf(res *resource.Info) (stages.Phase, error) {
+	annotations, err := metadataAccessor.Annotations(res.Object)
+	if err != nil {
+		return "", fmt.Errorf("error getting annotations of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	value, found := annotations[PhaseAnnotation]
+	if !found {
+		return stages.PhaseRollout, nil
+	}
+
+	phase, err := ParsePhase(value)
+	if err != nil {
+		return "", messages.Errorf(messages.ValidationInvalidAnnotation, PhaseAnnotation, kube.ResourceNameNamespaceKind(res), err)
+	}
+
+	return phase, nil
+}
@@ -0,0 +1,133 @@
+package externaldeps
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+// Annotations of the form "<id>.external-dependency.werf.io/<field>" declare the external dependency <id> of a
+// resource, e.g. "db.external-dependency.werf.io/resource: statefulset/postgres", in the namespace set with the
+// "namespace" field. Instead of a single named resource the dependency can be on the resources of a type matching
+// a label selector, e.g. "workers.external-dependency.werf.io/resource: deployment" along with
+// "workers.external-dependency.werf.io/selector: pool=workers", of which at least "min-ready" (1 by default) have
+// to be ready. The dependency is waited for up to "timeout" instead of the deploy timeout, and "on-timeout" is what
+// happens if it is not ready in time: the deploy fails ("fail", the default), goes on with a warning ("warn") or
+// silently goes on ("skip"). A dependency on a named resource with the "condition" field, e.g.
+// "db.external-dependency.werf.io/condition: Ready=True", is waited for until the resource has the condition in
+// its status.conditions instead of until it is ready.
+const AnnotationSuffix = ".external-dependency.werf.io/"
+
+const (
+	resourceField  = "resource"
+	namespaceField = "namespace"
+	selectorField  = "selector"
+	minReadyField  = "min-ready"
+	timeoutField   = "timeout"
+	onTimeoutField = "on-timeout"
+	conditionField = "condition"
+)
+
+// Parses the external dependency annotations, ignoring the other ones. The dependencies are sorted by name and
+// have no namespace unless it is set with an annotation.
+func ParseAnnotations(annotations map[string]string) (ExternalDependencyList, error) {
+	fields := map[string]map[string]string{}
+	for key, value := range annotations {
+		index := strings.Index(key, AnnotationSuffix)
+		if index <= 0 {
+			continue
+		}
+
+		name, field := key[:index], key[index+len(AnnotationSuffix):]
+		switch field {
+		case resourceField, namespaceField, selectorField, minReadyField, timeoutField, onTimeoutField, conditionField:
+		default:
+			return nil, fmt.Errorf("unknown external dependency annotation %q: expected field %q, %q, %q, %q, %q, %q or %q", key, resourceField, namespaceField, selectorField, minReadyField, timeoutField, onTimeoutField, conditionField)
+		}
+
+		if fields[name] == nil {
+			fields[name] = map[string]string{}
+		}
+		fields[name][field] = strings.TrimSpace(value)
+	}
+
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result ExternalDependencyList
+	for _, name := range names {
+		dep, err := newExternalDependencyFromFields(name, fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid external dependency %q: %w", name, err)
+		}
+		result = append(result, dep)
+	}
+
+	return result, nil
+}
+
+func newExternalDependencyFromFields(name string, fields map[string]string) (*ExternalDependency, error) {
+	resource, found := fields[resourceField]
+	if !found || resource == "" {
+		return nil, fmt.Errorf("annotation %q is required", name+AnnotationSuffix+resourceField)
+	}
+	resourceType, resourceName, hasName := strings.Cut(resource, "/")
+
+	var dep *ExternalDependency
+	selector, hasSelector := fields[selectorField]
+	switch {
+	case hasSelector && hasName:
+		return nil, fmt.Errorf("either a resource name %q or a label selector %q is expected, not both", resourceName, selector)
+	case hasSelector:
+		minReady := 1
+		if value, found := fields[minReadyField]; found {
+			var err error
+			if minReady, err = strconv.Atoi(value); err != nil || minReady < 1 {
+				return nil, fmt.Errorf("invalid %s %q: expected a positive number", minReadyField, value)
+			}
+		}
+		dep = NewSelectorExternalDependency(name, resourceType, selector, minReady)
+	case hasName && resourceName != "":
+		if _, found := fields[minReadyField]; found {
+			return nil, fmt.Errorf("%s is only supported along with a label selector", minReadyField)
+		}
+		dep = NewExternalDependency(name, resourceType, resourceName)
+	default:
+		return nil, fmt.Errorf("resource %q is expected as \"<type>/<name>\", or as \"<type>\" along with a label selector", resource)
+	}
+
+	dep.Namespace = fields[namespaceField]
+
+	if value, found := fields[conditionField]; found {
+		if dep.IsSelector() {
+			return nil, fmt.Errorf("%s is only supported along with a resource name", conditionField)
+		}
+
+		var err error
+		if dep.Condition, err = kube.ParseResourceCondition(value); err != nil {
+			return nil, err
+		}
+	}
+
+	if value, found := fields[timeoutField]; found {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: expected a positive duration, e.g. \"5m\"", timeoutField, value)
+		}
+		dep.Timeout = timeout
+	}
+
+	var err error
+	if dep.OnTimeout, err = ParseTimeoutPolicy(fields[onTimeoutField]); err != nil {
+		return nil, err
+	}
+
+	return dep, nil
+}
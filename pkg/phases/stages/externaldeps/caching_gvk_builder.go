@@ -0,0 +1,116 @@
+package externaldeps
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ GVKBuilder = (*CachingGVKBuilder)(nil)
+
+// Wraps another GVKBuilder, which usually hits the discovery API, and remembers resolved resource strings for
+// the rest of the run. Common built-in resources are resolved with a table of their usual versions only if the
+// wrapped builder fails, e.g. if the discovery API is unavailable, as the cluster may serve them in another
+// version.
+func NewCachingGVKBuilder(builder GVKBuilder) *CachingGVKBuilder {
+	return &CachingGVKBuilder{
+		builder: builder,
+		cache:   map[string]schema.GroupVersionKind{},
+	}
+}
+
+type CachingGVKBuilder struct {
+	builder GVKBuilder
+
+	mu    sync.Mutex
+	cache map[string]schema.GroupVersionKind
+}
+
+func (b *CachingGVKBuilder) BuildFromResource(resource string) (*schema.GroupVersionKind, error) {
+	key := strings.ToLower(strings.TrimSpace(resource))
+
+	b.mu.Lock()
+	gvk, found := b.cache[key]
+	b.mu.Unlock()
+	if found {
+		return &gvk, nil
+	}
+
+	result, err := b.builder.BuildFromResource(resource)
+	if err != nil {
+		gvk, found := commonResourcesGVKs[key]
+		if !found {
+			return nil, fmt.Errorf("error building GroupVersionKind for %q: %w", resource, err)
+		}
+
+		result = &gvk
+	}
+
+	b.mu.Lock()
+	b.cache[key] = *result
+	b.mu.Unlock()
+
+	return result, nil
+}
+
+type commonResource struct {
+	gvr        schema.GroupVersionResource
+	kind       string
+	singular   string
+	shortNames []string
+}
+
+var commonResources = []commonResource{
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, kind: "ConfigMap", singular: "configmap", shortNames: []string{"cm"}},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "endpoints"}, kind: "Endpoints", singular: "endpoints", shortNames: []string{"ep"}},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, kind: "Namespace", singular: "namespace", shortNames: []string{"ns"}},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}, kind: "PersistentVolumeClaim", singular: "persistentvolumeclaim", shortNames: []string{"pvc"}},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumes"}, kind: "PersistentVolume", singular: "persistentvolume", shortNames: []string{"pv"}},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}, kind: "Pod", singular: "pod", shortNames: []string{"po"}},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, kind: "Secret", singular: "secret"},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "serviceaccounts"}, kind: "ServiceAccount", singular: "serviceaccount", shortNames: []string{"sa"}},
+	{gvr: schema.GroupVersionResource{Version: "v1", Resource: "services"}, kind: "Service", singular: "service", shortNames: []string{"svc"}},
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, kind: "DaemonSet", singular: "daemonset", shortNames: []string{"ds"}},
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, kind: "Deployment", singular: "deployment", shortNames: []string{"deploy"}},
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}, kind: "ReplicaSet", singular: "replicaset", shortNames: []string{"rs"}},
+	{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}, kind: "StatefulSet", singular: "statefulset", shortNames: []string{"sts"}},
+	{gvr: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}, kind: "CronJob", singular: "cronjob", shortNames: []string{"cj"}},
+	{gvr: schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}, kind: "Job", singular: "job"},
+	{gvr: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, kind: "Ingress", singular: "ingress", shortNames: []string{"ing"}},
+	{gvr: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}, kind: "NetworkPolicy", singular: "networkpolicy", shortNames: []string{"netpol"}},
+	{gvr: schema.GroupVersionResource{Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"}, kind: "PodDisruptionBudget", singular: "poddisruptionbudget", shortNames: []string{"pdb"}},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}, kind: "ClusterRoleBinding", singular: "clusterrolebinding"},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}, kind: "ClusterRole", singular: "clusterrole"},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}, kind: "RoleBinding", singular: "rolebinding"},
+	{gvr: schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}, kind: "Role", singular: "role"},
+	{gvr: schema.GroupVersionResource{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"}, kind: "StorageClass", singular: "storageclass", shortNames: []string{"sc"}},
+	{gvr: schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}, kind: "CustomResourceDefinition", singular: "customresourcedefinition", shortNames: []string{"crd", "crds"}},
+}
+
+// Maps every kubectl-style spelling of the common resources, e.g. "deploy", "deployments",
+// "deployment.apps" or "deployments.v1.apps", to their GroupVersionKind.
+var commonResourcesGVKs = buildCommonResourcesGVKs()
+
+func buildCommonResourcesGVKs() map[string]schema.GroupVersionKind {
+	result := map[string]schema.GroupVersionKind{}
+	for _, res := range commonResources {
+		gvk := res.gvr.GroupVersion().WithKind(res.kind)
+
+		names := append([]string{res.gvr.Resource, res.singular}, res.shortNames...)
+		for _, name := range names {
+			if res.gvr.Group == "" {
+				result[name] = gvk
+				result[fmt.Sprintf("%s.%s", name, res.gvr.Version)] = gvk
+				continue
+			}
+
+			result[name] = gvk
+			result[fmt.Sprintf("%s.%s", name, res.gvr.Group)] = gvk
+			result[fmt.Sprintf("%s.%s.%s", name, res.gvr.Version, res.gvr.Group)] = gvk
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,89 @@
+package externaldeps
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// countingGVKBuilder resolves the widgets and counts the resolutions, failing for the other resources as if the
+// discovery API was unavailable.
+type countingGVKBuilder struct {
+	calls []string
+}
+
+func (b *countingGVKBuilder) BuildFromResource(resource string) (*schema.GroupVersionKind, error) {
+	b.calls = append(b.calls, resource)
+	if !strings.Contains(strings.ToLower(resource), "widget") {
+		return nil, errors.New("the server is currently unable to handle the request")
+	}
+
+	return &schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, nil
+}
+
+func TestCachingGVKBuilder(t *testing.T) {
+	wrapped := &countingGVKBuilder{}
+	builder := NewCachingGVKBuilder(wrapped)
+
+	for _, resource := range []string{"widgets", " Widgets ", "widgets"} {
+		gvk, err := builder.BuildFromResource(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gvk.Kind != "Widget" {
+			t.Errorf("expected a Widget for %q, got %v", resource, *gvk)
+		}
+	}
+	if len(wrapped.calls) != 1 {
+		t.Errorf("expected the resource to be resolved once, got %v", wrapped.calls)
+	}
+
+	if _, err := builder.BuildFromResource("gadgets"); err == nil {
+		t.Error("expected an error for an unknown resource the wrapped builder fails to resolve")
+	}
+}
+
+func TestCachingGVKBuilderCommonResourcesFallback(t *testing.T) {
+	wrapped := &countingGVKBuilder{}
+	builder := NewCachingGVKBuilder(wrapped)
+
+	for resource, expected := range map[string]schema.GroupVersionKind{
+		"deploy":                      {Group: "apps", Version: "v1", Kind: "Deployment"},
+		"deployments.v1.apps":         {Group: "apps", Version: "v1", Kind: "Deployment"},
+		"cm":                          {Version: "v1", Kind: "ConfigMap"},
+		"Secret":                      {Version: "v1", Kind: "Secret"},
+		"crd":                         {Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"},
+		"ingresses.networking.k8s.io": {Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+	} {
+		gvk, err := builder.BuildFromResource(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *gvk != expected {
+			t.Errorf("expected %v for %q, got %v", expected, resource, *gvk)
+		}
+	}
+
+	if _, err := builder.BuildFromResource("cm"); err != nil {
+		t.Fatal(err)
+	}
+	if len(wrapped.calls) != 6 {
+		t.Errorf("expected the common resources to be resolved with the wrapped builder first and once, got %v", wrapped.calls)
+	}
+}
+
+func TestCachingGVKBuilderPrefersWrappedBuilder(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"}, meta.RESTScopeNamespace)
+
+	gvk, err := NewCachingGVKBuilder(NewRESTMapperGVKBuilder(mapper)).BuildFromResource("cronjobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (schema.GroupVersionKind{Group: "batch", Version: "v1beta1", Kind: "CronJob"}); *gvk != expected {
+		t.Errorf("expected the version served by the cluster %v, got %v", expected, *gvk)
+	}
+}
@@ -2,10 +2,15 @@ package externaldeps
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/cli-runtime/pkg/resource"
+
+	"github.com/werf/3p-helm/pkg/kube"
 )
 
 func NewExternalDependency(name, resourceType, resourceName string) *ExternalDependency {
@@ -16,13 +21,67 @@ func NewExternalDependency(name, resourceType, resourceName string) *ExternalDep
 	}
 }
 
+// Creates an external dependency on at least minReady resources of the type matching the label selector being
+// ready, e.g. on a pool of resources created by an operator.
+func NewSelectorExternalDependency(name, resourceType, selector string, minReady int) *ExternalDependency {
+	return &ExternalDependency{
+		Name:         name,
+		ResourceType: resourceType,
+		Selector:     selector,
+		MinReady:     minReady,
+	}
+}
+
+// What happens when an external dependency is not ready in time.
+type TimeoutPolicy string
+
+const (
+	// The deploy fails. It is the default.
+	TimeoutPolicyFail TimeoutPolicy = "fail"
+	// A warning is logged and the deploy goes on.
+	TimeoutPolicyWarn TimeoutPolicy = "warn"
+	// The deploy silently goes on.
+	TimeoutPolicySkip TimeoutPolicy = "skip"
+)
+
+func ParseTimeoutPolicy(value string) (TimeoutPolicy, error) {
+	switch policy := TimeoutPolicy(strings.TrimSpace(value)); policy {
+	case "":
+		return TimeoutPolicyFail, nil
+	case TimeoutPolicyFail, TimeoutPolicyWarn, TimeoutPolicySkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown timeout policy %q: expected %q, %q or %q", value, TimeoutPolicyFail, TimeoutPolicyWarn, TimeoutPolicySkip)
+	}
+}
+
 type ExternalDependency struct {
 	Name         string
 	ResourceType string
 	ResourceName string
+	// Selector is the label selector of the resources the dependency is on, if it is not on a single named
+	// resource. At least MinReady of them have to be ready.
+	Selector string
+	MinReady int
+	// Timeout, if set, is how long the dependency is waited for instead of the deploy timeout.
+	Timeout time.Duration
+	// OnTimeout is what happens if the dependency is not ready in time, TimeoutPolicyFail if empty.
+	OnTimeout TimeoutPolicy
+	// Condition, if set, is the condition the named resource has to have instead of being ready.
+	Condition *kube.ResourceCondition
 
 	Namespace string
-	Info      *resource.Info
+	// Info is the named resource, or has only the type and the namespace of the selected resources.
+	Info *resource.Info
+}
+
+func (d *ExternalDependency) IsSelector() bool {
+	return d.Selector != ""
+}
+
+// Returns true if the dependency has its own timeout or timeout policy, so it has to be waited for on its own.
+func (d *ExternalDependency) HasOwnTimeout() bool {
+	return d.Timeout > 0 || (d.OnTimeout != "" && d.OnTimeout != TimeoutPolicyFail)
 }
 
 func (d *ExternalDependency) GenerateInfo(gvkBuilder GVKBuilder, metaAccessor meta.MetadataAccessor, mapper meta.RESTMapper) error {
@@ -36,6 +95,15 @@ func (d *ExternalDependency) GenerateInfo(gvkBuilder GVKBuilder, metaAccessor me
 		return fmt.Errorf("error getting resource mapping: %w", err)
 	}
 
+	if d.IsSelector() {
+		if _, err := labels.Parse(d.Selector); err != nil {
+			return fmt.Errorf("error parsing label selector %q: %w", d.Selector, err)
+		}
+		if d.MinReady < 1 {
+			return fmt.Errorf("at least one resource matching label selector %q has to be ready, got %d", d.Selector, d.MinReady)
+		}
+	}
+
 	object := unstructured.Unstructured{}
 	object.SetGroupVersionKind(*gvk)
 	object.SetName(d.ResourceName)
@@ -6,11 +6,26 @@ import (
 
 type ExternalDependencyList []*ExternalDependency
 
+// Returns the resources of the dependencies on named resources. The dependencies on resources matching a label
+// selector are returned by SelectorDependencies.
 func (l ExternalDependencyList) AsResourceList() kube.ResourceList {
 	resourceList := kube.ResourceList{}
 	for _, extDep := range l {
-		resourceList = append(resourceList, extDep.Info)
+		if !extDep.IsSelector() {
+			resourceList = append(resourceList, extDep.Info)
+		}
 	}
 
 	return resourceList
 }
+
+func (l ExternalDependencyList) SelectorDependencies() ExternalDependencyList {
+	var result ExternalDependencyList
+	for _, extDep := range l {
+		if extDep.IsSelector() {
+			result = append(result, extDep)
+		}
+	}
+
+	return result
+}
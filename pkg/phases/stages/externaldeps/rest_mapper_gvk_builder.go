@@ -0,0 +1,41 @@
+package externaldeps
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ GVKBuilder = (*RESTMapperGVKBuilder)(nil)
+
+// Resolves kubectl-style resource strings, e.g. "deploy", "deployments.apps" or "deployments.v1.apps", with the
+// RESTMapper, which usually hits the discovery API. The short names are only resolved if the RESTMapper expands
+// them, as the one of the kubectl configuration flags does.
+func NewRESTMapperGVKBuilder(mapper meta.RESTMapper) *RESTMapperGVKBuilder {
+	return &RESTMapperGVKBuilder{
+		mapper: mapper,
+	}
+}
+
+type RESTMapperGVKBuilder struct {
+	mapper meta.RESTMapper
+}
+
+func (b *RESTMapperGVKBuilder) BuildFromResource(resource string) (*schema.GroupVersionKind, error) {
+	fullySpecifiedGVR, groupResource := schema.ParseResourceArg(strings.ToLower(strings.TrimSpace(resource)))
+
+	if fullySpecifiedGVR != nil {
+		if gvk, err := b.mapper.KindFor(*fullySpecifiedGVR); err == nil {
+			return &gvk, nil
+		}
+	}
+
+	gvk, err := b.mapper.KindFor(groupResource.WithVersion(""))
+	if err != nil {
+		return nil, fmt.Errorf("error mapping resource %q to its kind: %w", resource, err)
+	}
+
+	return &gvk, nil
+}
@@ -0,0 +1,38 @@
+package externaldeps
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRESTMapperGVKBuilder(t *testing.T) {
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(deployment, meta.RESTScopeNamespace)
+	mapper.Add(configMap, meta.RESTScopeNamespace)
+	builder := NewRESTMapperGVKBuilder(mapper)
+
+	for resource, expected := range map[string]schema.GroupVersionKind{
+		"deployments":         deployment,
+		"Deployment":          deployment,
+		"deployments.apps":    deployment,
+		"deployments.v1.apps": deployment,
+		"configmaps":          configMap,
+	} {
+		gvk, err := builder.BuildFromResource(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *gvk != expected {
+			t.Errorf("expected %v for %q, got %v", expected, resource, *gvk)
+		}
+	}
+
+	if _, err := builder.BuildFromResource("widgets"); err == nil {
+		t.Error("expected an error for a resource unknown to the RESTMapper")
+	}
+}
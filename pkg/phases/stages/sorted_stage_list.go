@@ -1,6 +1,8 @@
 package stages
 
 import (
+	"sort"
+
 	"github.com/werf/3p-helm/pkg/kube"
 )
 
@@ -98,3 +100,40 @@ func (l SortedStageList) MergedDesiredResourcesInStagesRange(first, last int) ku
 
 	return resources
 }
+
+func (l SortedStageList) MergedExternalDependencies() kube.ResourceList {
+	resources := kube.ResourceList{}
+	for _, stg := range l {
+		for _, extDep := range stg.ExternalDependencies {
+			if extDep.Info != nil && !resources.Contains(extDep.Info) {
+				resources.Append(extDep.Info)
+			}
+		}
+	}
+
+	return resources
+}
+
+// Returns the sorted namespaces the desired resources and external dependencies of the stages are in, which is
+// where they have to be tracked. The release namespace is always included, since the events of cluster-scoped
+// resources and the resources without a namespace end up there.
+func (l SortedStageList) Namespaces(releaseNamespace string) []string {
+	seen := map[string]bool{releaseNamespace: true}
+	namespaces := []string{releaseNamespace}
+
+	add := func(resources kube.ResourceList) {
+		for _, res := range resources {
+			if res.Namespace == "" || seen[res.Namespace] {
+				continue
+			}
+			seen[res.Namespace] = true
+			namespaces = append(namespaces, res.Namespace)
+		}
+	}
+	add(l.MergedDesiredResources())
+	add(l.MergedExternalDependencies())
+
+	sort.Strings(namespaces)
+
+	return namespaces
+}
@@ -1,13 +1,47 @@
 package stages
 
 import (
+	"k8s.io/cli-runtime/pkg/resource"
+
 	"github.com/werf/3p-helm/pkg/kube"
 	"github.com/werf/3p-helm/pkg/phases/stages/externaldeps"
 )
 
+// Phase is the standard phase of the rollout a stage belongs to. The stages of
+// the pre-rollout phase are deployed before the stages of the rollout phase,
+// and the stages of the post-rollout phase after them, whatever their weights.
+type Phase string
+
+const (
+	PhasePreRollout  Phase = "pre-rollout"
+	PhaseRollout     Phase = "rollout"
+	PhasePostRollout Phase = "post-rollout"
+)
+
+// Phases are the phases of the rollout in the order they are deployed.
+var Phases = []Phase{PhasePreRollout, PhaseRollout, PhasePostRollout}
+
 type Stage struct {
+	// Phase of the stage, the rollout phase if empty.
+	Phase                Phase
 	Weight               int
 	ExternalDependencies externaldeps.ExternalDependencyList
-	DesiredResources     kube.ResourceList
-	Result               *kube.Result
+	// Resources of the release from this or earlier stages that have to be ready before the stage is applied.
+	ReadyDependencies kube.ResourceList
+	// Resources of the release from this or earlier stages that have to have a condition before the stage is
+	// applied.
+	ConditionDependencies []*ConditionDependency
+	// CanaryStep is the 1-based step of the stages applying the canaries of the Deployments of a later stage, see
+	// phases.CanaryStepsAnnotation, 0 for the other stages.
+	CanaryStep int
+	// Canaries of the Deployments of the stage, deleted once the stage is tracked.
+	Canaries         kube.ResourceList
+	DesiredResources kube.ResourceList
+	Result           *kube.Result
+}
+
+// ConditionDependency is a resource the stage waits to have the condition, whatever its readiness.
+type ConditionDependency struct {
+	Resource  *resource.Info
+	Condition *kube.ResourceCondition
 }
@@ -0,0 +1,57 @@
+package phases
+
+import (
+	"fmt"
+
+	"github.com/werf/3p-helm/pkg/kube"
+)
+
+// What is done with the unsupported resources of the release when the deploy waits for its resources: the ones
+// whose readiness can't be tracked (see kube.HasReadinessCheck). Resources excluded from tracking with the
+// werf.io/track annotation are not unsupported.
+type UnsupportedResourcesPolicy string
+
+const (
+	// Apply the unsupported resources without tracking them, warning about each of them. The default.
+	UnsupportedResourcesPolicyWarn UnsupportedResourcesPolicy = "warn"
+	// Fail the deploy before applying anything.
+	UnsupportedResourcesPolicyFail UnsupportedResourcesPolicy = "fail"
+	// Skip the unsupported resources, which are neither applied nor deleted, like the resources skipped by
+	// werf.io/deploy-on.
+	UnsupportedResourcesPolicySkip UnsupportedResourcesPolicy = "skip"
+)
+
+// An empty policy is UnsupportedResourcesPolicyWarn.
+func ParseUnsupportedResourcesPolicy(value string) (UnsupportedResourcesPolicy, error) {
+	switch policy := UnsupportedResourcesPolicy(value); policy {
+	case "":
+		return UnsupportedResourcesPolicyWarn, nil
+	case UnsupportedResourcesPolicyWarn, UnsupportedResourcesPolicyFail, UnsupportedResourcesPolicySkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown unsupported resources policy %q: expected %q, %q or %q", value, UnsupportedResourcesPolicyWarn, UnsupportedResourcesPolicyFail, UnsupportedResourcesPolicySkip)
+	}
+}
+
+// Returns the tracked resources whose readiness can't be tracked with the default readiness engine of the kube
+// client.
+func UnsupportedResources(resources kube.ResourceList, defaultEngine kube.ReadinessEngine) (kube.ResourceList, error) {
+	tracked, err := kube.TrackedResources(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var result kube.ResourceList
+	for _, res := range tracked {
+		supported, err := kube.HasReadinessCheck(res, defaultEngine)
+		if err != nil {
+			return nil, fmt.Errorf("error checking readiness support of %q: %w", kube.ResourceNameNamespaceKind(res), err)
+		}
+
+		if !supported {
+			result.Append(res)
+		}
+	}
+
+	return result, nil
+}
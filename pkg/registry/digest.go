@@ -0,0 +1,33 @@
+package registry
+
+import (
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/pkg/errors"
+	"oras.land/oras-go/pkg/registry"
+)
+
+// ResolveDigest returns the digest of the manifest of the image, referenced as
+// in a pod spec, e.g. "nginx:1.25" or "registry.example.com/app:v1".
+func (c *Client) ResolveDigest(ref string) (string, error) {
+	named, err := docker.ParseDockerRef(ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", ref)
+	}
+
+	parsedRef, err := registry.ParseReference(named.String())
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image reference %q", ref)
+	}
+
+	resolver, err := c.resolver(parsedRef)
+	if err != nil {
+		return "", err
+	}
+
+	_, desc, err := resolver.Resolve(ctx(c.out, c.debug), parsedRef.String())
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to resolve image %q", ref)
+	}
+
+	return desc.Digest.String(), nil
+}
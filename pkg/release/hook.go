@@ -17,6 +17,8 @@ limitations under the License.
 package release
 
 import (
+	stdtime "time"
+
 	"github.com/werf/3p-helm/pkg/time"
 )
 
@@ -34,6 +36,7 @@ const (
 	HookPreRollback  HookEvent = "pre-rollback"
 	HookPostRollback HookEvent = "post-rollback"
 	HookTest         HookEvent = "test"
+	HookCanaryVerify HookEvent = "canary-verify"
 )
 
 func (x HookEvent) String() string { return string(x) }
@@ -59,6 +62,15 @@ const HookWeightAnnotation = "helm.sh/hook-weight"
 // HookDeleteAnnotation is the label name for the delete policy for a hook
 const HookDeleteAnnotation = "helm.sh/hook-delete-policy"
 
+// HookTimeoutAnnotation is the annotation name for the time to wait for a hook
+// to complete, overriding the hooks timeout of the operation
+const HookTimeoutAnnotation = "werf.io/hook-timeout"
+
+// HookMaxFailuresAnnotation is the annotation name for how many hooks of the
+// same weight may fail before the remaining ones are not executed, overriding
+// the hooks max failures of the operation. A negative number executes all of them
+const HookMaxFailuresAnnotation = "werf.io/hook-max-failures"
+
 // Hook defines a hook object.
 type Hook struct {
 	Name string `json:"name,omitempty"`
@@ -76,6 +88,13 @@ type Hook struct {
 	Weight int `json:"weight,omitempty"`
 	// DeletePolicies are the policies that indicate when to delete the hook
 	DeletePolicies []HookDeletePolicy `json:"delete_policies,omitempty"`
+	// Timeout is the time to wait for the hook to complete, zero means the
+	// hooks timeout of the operation
+	Timeout stdtime.Duration `json:"timeout,omitempty"`
+	// MaxFailures is how many hooks of the same weight may fail before the
+	// remaining ones are not executed, negative means all of them are
+	// executed, zero means the hooks max failures of the operation
+	MaxFailures int `json:"max_failures,omitempty"`
 }
 
 // A HookExecution records the result for the last execution of a hook for a given release.
@@ -86,6 +105,10 @@ type HookExecution struct {
 	CompletedAt time.Time `json:"completed_at,omitempty"`
 	// Phase indicates whether the hook completed successfully
 	Phase HookPhase `json:"phase"`
+	// IdempotencyKey identifies the release revision and hook event this execution belongs to
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// CanaryStep is the canary step this execution belongs to, if the hook is executed once per step
+	CanaryStep int `json:"canary_step,omitempty"`
 }
 
 // A HookPhase indicates the state of a hook execution
@@ -0,0 +1,27 @@
+package release
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// Set on hook resources to find out whether the live resources were created by the same hook execution.
+const HookIdempotencyKeyAnnotation = "werf.io/hook-idempotency-key"
+
+// Stays the same when a hook is executed again for the same release revision and hook event, so the
+// hook execution can be recognized after retry or resume.
+func HookIdempotencyKey(rel *Release, hook *Hook, event HookEvent) string {
+	return HookStepIdempotencyKey(rel, hook, event, 0)
+}
+
+// Like HookIdempotencyKey, but for the hooks executed once per canary step, e.g. the canary-verify hooks, so that the
+// execution of the previous step isn't taken for the one of the step. The step 0 is no step.
+func HookStepIdempotencyKey(rel *Release, hook *Hook, event HookEvent, step int) string {
+	key := fmt.Sprintf("%s/%s/%d/%s/%s/%s", rel.Namespace, rel.Name, rel.Version, event, hook.Kind, hook.Name)
+	if step > 0 {
+		key = fmt.Sprintf("%s/%d", key, step)
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("%x", sum[:16])
+}
@@ -37,6 +37,9 @@ type Info struct {
 	Notes string `json:"notes,omitempty"`
 	// Contains the deployed resources information
 	Resources map[string][]runtime.Object `json:"resources,omitempty"`
+	// Pinned revisions, e.g. known good ones, are never pruned from the
+	// history, see storage.Storage.Pin.
+	Pinned bool `json:"pinned,omitempty"`
 
 	LastPhase *Phase `json:"last_phase,omitempty"`
 	LastStage *int   `json:"last_stage,omitempty"`
@@ -20,6 +20,8 @@ func PhaseFromHookEvent(hookEvent HookEvent) Phase {
 		phase = PhaseHooksPre
 	case HookPostInstall, HookPostDelete, HookPostUpgrade, HookPostRollback:
 		phase = PhaseHooksPost
+	case HookCanaryVerify:
+		phase = PhaseRollout
 	case HookTest:
 	default:
 		panic(fmt.Sprintf("unexpected HookEvent: %s", hookEvent.String()))
@@ -38,6 +40,11 @@ func SetInitPhaseStageInfo(rel *Release) *Release {
 }
 
 func SetHookPhaseStageInfo(rel *Release, hookIndex int, hook HookEvent) *Release {
+	// The canary-verify hooks are executed within a stage of the rollout, which stays the last one.
+	if hook == HookCanaryVerify {
+		return rel
+	}
+
 	lastPhase := PhaseFromHookEvent(hook)
 	rel.Info.LastPhase = &lastPhase
 	rel.Info.LastStage = &hookIndex
@@ -0,0 +1,170 @@
+package release
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	stdtime "time"
+)
+
+type ProgressEventType string
+
+const (
+	ProgressEventPhaseStarted    ProgressEventType = "phase-started"
+	ProgressEventResourceApplied ProgressEventType = "resource-applied"
+	ProgressEventResourceReady   ProgressEventType = "resource-ready"
+	ProgressEventResourceDeleted ProgressEventType = "resource-deleted"
+	ProgressEventStageFailed     ProgressEventType = "stage-failed"
+	ProgressEventHookSucceeded   ProgressEventType = "hook-succeeded"
+	ProgressEventHookFailed      ProgressEventType = "hook-failed"
+	// ProgressEventContainerLogs carries the logs of the containers of the
+	// tracked resources streamed by the ResourcesWaiter of the kube client,
+	// see kube.LogsOptions.
+	ProgressEventContainerLogs ProgressEventType = "container-logs"
+)
+
+// ProgressEvent is a step of the deploy of a release, written by
+// ProgressStream as a line of JSON.
+type ProgressEvent struct {
+	Time     stdtime.Time      `json:"time"`
+	Type     ProgressEventType `json:"type"`
+	Release  string            `json:"release"`
+	Revision int               `json:"revision,omitempty"`
+	Phase    Phase             `json:"phase,omitempty"`
+	// Stage is the index of the rollout stage of the event.
+	Stage *int `json:"stage,omitempty"`
+
+	// Kind, Name and Namespace are those of the resource or the hook of the
+	// event.
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+
+	// Container and Lines are the container logs of
+	// ProgressEventContainerLogs.
+	Container string   `json:"container,omitempty"`
+	Lines     []string `json:"lines,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// ProgressStream writes the progress events of a deploy as JSON lines, so
+// that UIs and CI plugins can render the progress live without parsing the
+// log. A nil ProgressStream discards the events.
+//
+// Safe for concurrent use.
+type ProgressStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	// err is the first write error, after which the events are discarded.
+	err error
+	// now is replaced in tests.
+	now func() stdtime.Time
+}
+
+// NewProgressStream returns nil if w is nil.
+func NewProgressStream(w io.Writer) *ProgressStream {
+	if w == nil {
+		return nil
+	}
+
+	return &ProgressStream{enc: json.NewEncoder(w), now: stdtime.Now}
+}
+
+// Emit writes the event, setting its time if it is not set. The deploy
+// doesn't fail if the event can't be written, see Err.
+func (s *ProgressStream) Emit(event *ProgressEvent) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = s.now()
+	}
+	s.err = s.enc.Encode(event)
+}
+
+// Err returns the error the events stopped being written with.
+func (s *ProgressStream) Err() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *ProgressStream) PhaseStarted(rel *Release, phase Phase) {
+	s.Emit(&ProgressEvent{Type: ProgressEventPhaseStarted, Release: rel.Name, Revision: rel.Version, Phase: phase})
+}
+
+// Resource emits an event of a resource of the rollout stage.
+func (s *ProgressStream) Resource(rel *Release, eventType ProgressEventType, stage *int, kind, name, namespace string) {
+	s.Emit(&ProgressEvent{
+		Type:      eventType,
+		Release:   rel.Name,
+		Revision:  rel.Version,
+		Phase:     PhaseRollout,
+		Stage:     stage,
+		Kind:      kind,
+		Name:      name,
+		Namespace: namespace,
+	})
+}
+
+func (s *ProgressStream) StageFailed(rel *Release, stage int, err error) {
+	s.Emit(&ProgressEvent{Type: ProgressEventStageFailed, Release: rel.Name, Revision: rel.Version, Phase: PhaseRollout, Stage: &stage, Error: err.Error()})
+}
+
+// HooksFinished emits an event for every hook of the event which was run for
+// the release revision, taking its result from its last run.
+func (s *ProgressStream) HooksFinished(rel *Release, event HookEvent) {
+	if s == nil {
+		return
+	}
+
+	for _, hook := range rel.Hooks {
+		if hook.LastRun.IdempotencyKey != HookStepIdempotencyKey(rel, hook, event, hook.LastRun.CanaryStep) {
+			continue
+		}
+		if hook.LastRun.Phase != HookPhaseSucceeded && hook.LastRun.Phase != HookPhaseFailed {
+			continue
+		}
+
+		progress := &ProgressEvent{
+			Type:     ProgressEventHookSucceeded,
+			Release:  rel.Name,
+			Revision: rel.Version,
+			Phase:    PhaseFromHookEvent(event),
+			Kind:     hook.Kind,
+			Name:     hook.Name,
+		}
+		if hook.LastRun.Phase == HookPhaseFailed {
+			progress.Type = ProgressEventHookFailed
+			progress.Error = "hook finished with phase " + hook.LastRun.Phase.String()
+		}
+		s.Emit(progress)
+	}
+}
+
+// ContainerLogs emits the lines of the logs of a container of a resource.
+func (s *ProgressStream) ContainerLogs(rel *Release, kind, name, namespace, container string, lines []string) {
+	s.Emit(&ProgressEvent{
+		Type:      ProgressEventContainerLogs,
+		Release:   rel.Name,
+		Revision:  rel.Version,
+		Kind:      kind,
+		Name:      name,
+		Namespace: namespace,
+		Container: container,
+		Lines:     lines,
+	})
+}
@@ -40,6 +40,17 @@ type Release struct {
 	// Labels of the release.
 	// Disabled encoding into Json cause labels are stored in storage driver metadata field.
 	Labels map[string]string `json:"-"`
+	// Metadata is arbitrary user-supplied data attached to this revision of
+	// the release, e.g. a ticket ID, a git commit or an approver.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// ExcludedResources are the resources of the manifest that were excluded from
+	// this deploy by resource matchers, in the "namespace:Kind/name" form.
+	ExcludedResources []string `json:"excluded_resources,omitempty"`
+	// Dependencies describe which chart dependencies were enabled or disabled
+	// by their conditions and tags.
+	Dependencies []*chart.DependencyResolution `json:"dependencies,omitempty"`
+	// GeneratedNames are the server-assigned names of resources using metadata.generateName.
+	GeneratedNames map[string]string `json:"generated_names,omitempty"`
 }
 
 // SetStatus is a helper for setting the status on a release.
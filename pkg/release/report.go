@@ -3,10 +3,30 @@ package release
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
+	stdtime "time"
 
+	"sigs.k8s.io/yaml"
+
+	"github.com/werf/3p-helm/pkg/chart"
 	"github.com/werf/3p-helm/pkg/time"
 )
 
+const (
+	DeployReportFormatJSON = "json"
+	DeployReportFormatYAML = "yaml"
+)
+
+func ValidateDeployReportFormat(format string) error {
+	switch format {
+	case "", DeployReportFormatJSON, DeployReportFormatYAML:
+		return nil
+	default:
+		return fmt.Errorf("unsupported deploy report format %q: expected %q or %q", format, DeployReportFormatJSON, DeployReportFormatYAML)
+	}
+}
+
 func NewDeployReport() *DeployReport {
 	return &DeployReport{}
 }
@@ -20,9 +40,75 @@ type DeployReport struct {
 	LastStage         *int      `json:"last_stage,omitempty"`
 	FirstDeployedTime time.Time `json:"first_deployed,omitempty"`
 	LastDeployedTime  time.Time `json:"last_deployed,omitempty"`
+
+	Dependencies []*chart.DependencyResolution `json:"dependencies,omitempty"`
+	// ValuesFiles are the values files the values were merged from, in the
+	// order they were merged.
+	ValuesFiles []string `json:"values_files,omitempty"`
+
+	// Resources are the results of the operations on the release resources
+	// and hooks, in the order of the phases.
+	Resources []*ResourceReport `json:"resources,omitempty"`
+
+	mu sync.Mutex
+}
+
+type ResourceOperation string
+
+const (
+	ResourceOperationCreate ResourceOperation = "create"
+	ResourceOperationUpdate ResourceOperation = "update"
+	ResourceOperationDelete ResourceOperation = "delete"
+	ResourceOperationHook   ResourceOperation = "hook"
+	ResourceOperationAdopt  ResourceOperation = "adopt"
+	ResourceOperationKeep   ResourceOperation = "keep"
+	// ResourceOperationSkip is the operation of the unsupported resources
+	// skipped by the unsupported resources policy.
+	ResourceOperationSkip ResourceOperation = "skip"
+	// ResourceOperationRelax and ResourceOperationRestore are the operations
+	// of the PodDisruptionBudgets relaxed during the rollout.
+	ResourceOperationRelax   ResourceOperation = "relax"
+	ResourceOperationRestore ResourceOperation = "restore"
+)
+
+type ResourceStatus string
+
+const (
+	ResourceStatusSucceeded ResourceStatus = "succeeded"
+	ResourceStatusFailed    ResourceStatus = "failed"
+)
+
+type ResourceReport struct {
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace,omitempty"`
+	Operation ResourceOperation `json:"operation"`
+	Phase     Phase             `json:"phase"`
+	// Stage is the index of the rollout stage of the resource.
+	Stage *int `json:"stage,omitempty"`
+	// Duration is the time taken by the operation, including waiting for the
+	// resource. Rollout resources share the duration of their stage.
+	Duration string         `json:"duration,omitempty"`
+	Status   ResourceStatus `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	// Unsupported is set for the resources whose readiness can't be tracked,
+	// which are handled according to the unsupported resources policy.
+	Unsupported bool `json:"unsupported,omitempty"`
+}
+
+// Safe for concurrent use.
+func (r *DeployReport) AddResources(resources ...*ResourceReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Resources = append(r.Resources, resources...)
 }
 
+// Hook results are taken from the runs of the release hooks for the release revision.
 func (r *DeployReport) FromRelease(release *Release) *DeployReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	r.Release = release.Name
 	r.Namespace = release.Namespace
 	r.Revision = release.Version
@@ -31,11 +117,77 @@ func (r *DeployReport) FromRelease(release *Release) *DeployReport {
 	r.LastStage = release.Info.LastStage
 	r.FirstDeployedTime = release.Info.FirstDeployed
 	r.LastDeployedTime = release.Info.LastDeployed
+	r.Dependencies = release.Dependencies
+
+	var resources []*ResourceReport
+	for _, res := range r.Resources {
+		if res.Operation != ResourceOperationHook {
+			resources = append(resources, res)
+		}
+	}
+	for _, hook := range release.Hooks {
+		if hookReport := newHookReport(release, hook); hookReport != nil {
+			resources = append(resources, hookReport)
+		}
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		return phaseOrder(resources[i].Phase) < phaseOrder(resources[j].Phase)
+	})
+	r.Resources = resources
 
 	return r
 }
 
+// Returns nil if the hook was not run for the release revision.
+func newHookReport(release *Release, hook *Hook) *ResourceReport {
+	var phase Phase
+	var found bool
+	for _, event := range hook.Events {
+		if hook.LastRun.IdempotencyKey == HookStepIdempotencyKey(release, hook, event, hook.LastRun.CanaryStep) {
+			phase = PhaseFromHookEvent(event)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	report := &ResourceReport{
+		Kind:      hook.Kind,
+		Name:      hook.Name,
+		Operation: ResourceOperationHook,
+		Phase:     phase,
+		Status:    ResourceStatusSucceeded,
+	}
+	if !hook.LastRun.CompletedAt.IsZero() {
+		report.Duration = hook.LastRun.CompletedAt.Sub(hook.LastRun.StartedAt).Round(stdtime.Millisecond).String()
+	}
+	if hook.LastRun.Phase != HookPhaseSucceeded {
+		report.Status = ResourceStatusFailed
+		report.Error = fmt.Sprintf("hook finished with phase %s", hook.LastRun.Phase)
+	}
+
+	return report
+}
+
+func phaseOrder(phase Phase) int {
+	switch phase {
+	case PhaseHooksPre:
+		return 0
+	case PhaseRollout, PhaseUninstall:
+		return 1
+	case PhaseHooksPost:
+		return 2
+	default:
+		return 3
+	}
+}
+
 func (r *DeployReport) ToJSONData() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	data, err := json.MarshalIndent(r, "", "\t")
 	if err != nil {
 		return nil, fmt.Errorf("error marshalling deploy report: %w", err)
@@ -43,3 +195,27 @@ func (r *DeployReport) ToJSONData() ([]byte, error) {
 
 	return data, nil
 }
+
+func (r *DeployReport) ToYAMLData() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling deploy report: %w", err)
+	}
+
+	return data, nil
+}
+
+// Format is one of DeployReportFormatJSON (default) or DeployReportFormatYAML.
+func (r *DeployReport) ToData(format string) ([]byte, error) {
+	switch format {
+	case "", DeployReportFormatJSON:
+		return r.ToJSONData()
+	case DeployReportFormatYAML:
+		return r.ToYAMLData()
+	default:
+		return nil, ValidateDeployReportFormat(format)
+	}
+}
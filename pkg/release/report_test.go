@@ -0,0 +1,88 @@
+package release
+
+import (
+	"strings"
+	"testing"
+	stdtime "time"
+
+	"github.com/werf/3p-helm/pkg/time"
+)
+
+func TestDeployReportFromRelease(t *testing.T) {
+	rel := &Release{
+		Name:      "app",
+		Namespace: "ns",
+		Version:   2,
+		Info:      &Info{Status: StatusFailed},
+	}
+
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, stdtime.UTC)
+	migrate := &Hook{Name: "migrate", Kind: "Job", Events: []HookEvent{HookPreUpgrade}}
+	migrate.LastRun = HookExecution{
+		StartedAt:      started,
+		CompletedAt:    started.Add(1500 * stdtime.Millisecond),
+		Phase:          HookPhaseSucceeded,
+		IdempotencyKey: HookStepIdempotencyKey(rel, migrate, HookPreUpgrade, 0),
+	}
+	notify := &Hook{Name: "notify", Kind: "Job", Events: []HookEvent{HookPostUpgrade}}
+	notify.LastRun = HookExecution{
+		Phase:          HookPhaseFailed,
+		IdempotencyKey: HookStepIdempotencyKey(rel, notify, HookPostUpgrade, 0),
+	}
+	// Run for the previous revision, so it is not reported.
+	seed := &Hook{Name: "seed", Kind: "Job", Events: []HookEvent{HookPreUpgrade}}
+	seed.LastRun = HookExecution{
+		Phase:          HookPhaseSucceeded,
+		IdempotencyKey: HookStepIdempotencyKey(&Release{Name: "app", Namespace: "ns", Version: 1}, seed, HookPreUpgrade, 0),
+	}
+	rel.Hooks = []*Hook{notify, migrate, seed}
+
+	report := NewDeployReport()
+	report.AddResources(
+		&ResourceReport{Kind: "Deployment", Name: "app", Operation: ResourceOperationUpdate, Phase: PhaseRollout, Status: ResourceStatusFailed, Error: "timed out"},
+		&ResourceReport{Kind: "Job", Name: "stale", Operation: ResourceOperationHook, Phase: PhaseHooksPre, Status: ResourceStatusSucceeded},
+	)
+	report.FromRelease(rel)
+
+	if report.Release != "app" || report.Namespace != "ns" || report.Revision != 2 || report.Status != StatusFailed {
+		t.Errorf("unexpected release of the report: %s/%s revision %d %s", report.Namespace, report.Release, report.Revision, report.Status)
+	}
+
+	var got []string
+	for _, res := range report.Resources {
+		got = append(got, strings.Join([]string{string(res.Phase), string(res.Operation), res.Kind + "/" + res.Name, string(res.Status), res.Duration, res.Error}, " "))
+	}
+	expected := []string{
+		"hooks-pre hook Job/migrate succeeded 1.5s ",
+		"rollout update Deployment/app failed  timed out",
+		"hooks-post hook Job/notify failed  hook finished with phase Failed",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected resources of the report:\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestDeployReportToData(t *testing.T) {
+	stage := 0
+	report := NewDeployReport()
+	report.Release = "app"
+	report.AddResources(&ResourceReport{Kind: "Deployment", Name: "app", Operation: ResourceOperationCreate, Phase: PhaseRollout, Stage: &stage, Status: ResourceStatusSucceeded})
+
+	for format, expected := range map[string]string{
+		"":                     "\"release\": \"app\"",
+		DeployReportFormatJSON: "\"operation\": \"create\"",
+		DeployReportFormatYAML: "- kind: Deployment\n  name: app\n  operation: create\n  phase: rollout\n  stage: 0\n  status: succeeded\n",
+	} {
+		data, err := report.ToData(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("expected the %q report to contain %q, got:\n%s", format, expected, data)
+		}
+	}
+
+	if _, err := report.ToData("xml"); err == nil || !strings.Contains(err.Error(), `unsupported deploy report format "xml"`) {
+		t.Errorf("expected an unsupported format error, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package releaseutil
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+const (
+	// DeployRevisionAnnotation is set on the pod templates of workloads to the release revision that
+	// produced the running pods.
+	DeployRevisionAnnotation = "werf.io/release-revision"
+	// DeployedAtAnnotation is set on the pod templates of workloads to the time of the deploy that
+	// produced the running pods.
+	DeployedAtAnnotation = "werf.io/deployed-at"
+)
+
+// Paths to the pod templates of the workload kinds.
+var podTemplatePaths = map[string][]string{
+	"Deployment":            {"spec", "template"},
+	"StatefulSet":           {"spec", "template"},
+	"DaemonSet":             {"spec", "template"},
+	"ReplicaSet":            {"spec", "template"},
+	"ReplicationController": {"spec", "template"},
+	"Job":                   {"spec", "template"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template"},
+}
+
+// SetDeployMetadataVisitor annotates the pod templates of workloads with the release revision and the
+// deploy time, so that running pods can expose which deploy produced them. Workloads whose pod template
+// is the same as in the previously deployed resources are not annotated: the annotations already set in
+// the cluster are kept by the three-way merge, and the pods are not restarted on every deploy only
+// because of new annotation values.
+func SetDeployMetadataVisitor(previous []*resource.Info, revision int, deployedAt time.Time) resource.VisitorFunc {
+	return func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		obj, ok := info.Object.(*unstructured.Unstructured)
+		if !ok {
+			return nil
+		}
+
+		path, ok := podTemplatePaths[obj.GetKind()]
+		if !ok {
+			return nil
+		}
+
+		template, found, err := unstructured.NestedMap(obj.Object, path...)
+		if err != nil || !found {
+			return nil
+		}
+
+		if prev := findResource(previous, info); prev != nil {
+			if prevObj, ok := prev.Object.(*unstructured.Unstructured); ok {
+				prevTemplate, _, _ := unstructured.NestedMap(prevObj.Object, path...)
+				if reflect.DeepEqual(template, prevTemplate) {
+					return nil
+				}
+			}
+		}
+
+		annotations, _, _ := unstructured.NestedStringMap(template, "metadata", "annotations")
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[DeployRevisionAnnotation] = strconv.Itoa(revision)
+		annotations[DeployedAtAnnotation] = deployedAt.UTC().Format(time.RFC3339)
+
+		if err := unstructured.SetNestedStringMap(obj.Object, annotations, append(path, "metadata", "annotations")...); err != nil {
+			return fmt.Errorf("%s pod template annotations could not be updated: %w", ResourceString(info), err)
+		}
+
+		return nil
+	}
+}
+
+// findResource returns the resource with the same kind, namespace and name as the given one.
+func findResource(resources []*resource.Info, info *resource.Info) *resource.Info {
+	for _, r := range resources {
+		if r.Name == info.Name && r.Namespace == info.Namespace &&
+			r.Object.GetObjectKind().GroupVersionKind().GroupKind() == info.Object.GetObjectKind().GroupVersionKind().GroupKind() {
+			return r
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package releaseutil
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func newWorkloadInfo(kind, name, image string) *resource.Info {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace("default")
+	_ = unstructured.SetNestedSlice(obj.Object, []interface{}{
+		map[string]interface{}{"name": "app", "image": image},
+	}, "spec", "template", "spec", "containers")
+
+	return &resource.Info{Name: name, Namespace: "default", Object: obj}
+}
+
+func TestSetDeployMetadataVisitor(t *testing.T) {
+	deployedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	previous := []*resource.Info{
+		newWorkloadInfo("Deployment", "unchanged", "app:1"),
+		newWorkloadInfo("Deployment", "changed", "app:1"),
+	}
+	unchanged := newWorkloadInfo("Deployment", "unchanged", "app:1")
+	changed := newWorkloadInfo("Deployment", "changed", "app:2")
+	created := newWorkloadInfo("StatefulSet", "created", "db:1")
+	configMap := &resource.Info{Name: "config", Namespace: "default", Object: &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "config", "namespace": "default"},
+	}}}
+
+	visitor := SetDeployMetadataVisitor(previous, 3, deployedAt)
+	for _, info := range []*resource.Info{unchanged, changed, created, configMap} {
+		if err := visitor(info, nil); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	podAnnotations := func(info *resource.Info) map[string]string {
+		annotations, _, _ := unstructured.NestedStringMap(info.Object.(*unstructured.Unstructured).Object, "spec", "template", "metadata", "annotations")
+		return annotations
+	}
+
+	for _, info := range []*resource.Info{changed, created} {
+		annotations := podAnnotations(info)
+		if annotations[DeployRevisionAnnotation] != "3" {
+			t.Errorf("expected %s to have revision annotation 3, got %q", info.Name, annotations[DeployRevisionAnnotation])
+		}
+		if annotations[DeployedAtAnnotation] != "2024-01-02T03:04:05Z" {
+			t.Errorf("expected %s to have deployed-at annotation, got %q", info.Name, annotations[DeployedAtAnnotation])
+		}
+	}
+
+	if annotations := podAnnotations(unchanged); len(annotations) != 0 {
+		t.Errorf("expected the unchanged workload not to be annotated, got %v", annotations)
+	}
+
+	if _, found, _ := unstructured.NestedMap(configMap.Object.(*unstructured.Unstructured).Object, "spec"); found {
+		t.Errorf("expected the ConfigMap not to be modified")
+	}
+}
@@ -0,0 +1,95 @@
+package releaseutil
+
+import (
+	"fmt"
+
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// GeneratedNameKey returns the key under which the server-assigned name of a resource using
+// metadata.generateName is recorded in the release. The index tells apart the resources with the same namespace,
+// kind and generateName by their order in the manifest. The first one has no index in its key, so that the names
+// recorded before the index was added are still found. Returns false if the resource does not use generateName.
+func GeneratedNameKey(info *resource.Info, index int) (string, bool) {
+	key, ok := generatedNameBaseKey(info)
+	if !ok || index == 0 {
+		return key, ok
+	}
+
+	return fmt.Sprintf("%s#%d", key, index), true
+}
+
+func generatedNameBaseKey(info *resource.Info) (string, bool) {
+	generateName, err := accessor.GenerateName(info.Object)
+	if err != nil || generateName == "" {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s:%s/%s", info.Namespace, info.Mapping.GroupVersionKind.GroupKind().String(), generateName), true
+}
+
+// generatedNameKeys returns the key of every resource using metadata.generateName, see GeneratedNameKey, which
+// the resources are indexed for by their order.
+func generatedNameKeys() func(info *resource.Info) (string, bool) {
+	indexes := map[string]int{}
+	return func(info *resource.Info) (string, bool) {
+		baseKey, ok := generatedNameBaseKey(info)
+		if !ok {
+			return "", false
+		}
+
+		index := indexes[baseKey]
+		indexes[baseKey]++
+
+		return GeneratedNameKey(info, index)
+	}
+}
+
+// SetGeneratedNamesVisitor sets the previously recorded server-assigned names for resources using
+// metadata.generateName, so that they are updated, tracked and deleted instead of being created again. The
+// resources must be visited in the order of the manifest.
+func SetGeneratedNamesVisitor(generatedNames map[string]string) resource.VisitorFunc {
+	keyOf := generatedNameKeys()
+	return func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		key, ok := keyOf(info)
+		if !ok || info.Name != "" {
+			return nil
+		}
+
+		name, found := generatedNames[key]
+		if !found {
+			return nil
+		}
+
+		if err := accessor.SetName(info.Object, name); err != nil {
+			return fmt.Errorf("unable to set generated name for %s: %w", ResourceString(info), err)
+		}
+		info.Name = name
+
+		return nil
+	}
+}
+
+// RecordGeneratedNames saves the server-assigned names of created resources using metadata.generateName. The
+// resources must be all the resources of the release in the order of the manifest, as visited by
+// SetGeneratedNamesVisitor, including the ones not created yet.
+func RecordGeneratedNames(generatedNames map[string]string, resources []*resource.Info) map[string]string {
+	keyOf := generatedNameKeys()
+	for _, info := range resources {
+		key, ok := keyOf(info)
+		if !ok || info.Name == "" {
+			continue
+		}
+
+		if generatedNames == nil {
+			generatedNames = map[string]string{}
+		}
+		generatedNames[key] = info.Name
+	}
+
+	return generatedNames
+}
@@ -0,0 +1,79 @@
+package releaseutil
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+func newGenerateNameInfo(name, generateName string) *resource.Info {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("batch/v1")
+	obj.SetKind("Job")
+	obj.SetNamespace("ns")
+	obj.SetName(name)
+	obj.SetGenerateName(generateName)
+
+	return &resource.Info{
+		Name:      name,
+		Namespace: "ns",
+		Object:    obj,
+		Mapping: &meta.RESTMapping{
+			GroupVersionKind: schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"},
+		},
+	}
+}
+
+func TestGeneratedNames(t *testing.T) {
+	created := newGenerateNameInfo("migrate-x7k2p", "migrate-")
+	regular := newGenerateNameInfo("regular", "")
+
+	names := RecordGeneratedNames(nil, []*resource.Info{created, regular})
+	if len(names) != 1 || names["ns:Job.batch/migrate-"] != "migrate-x7k2p" {
+		t.Fatalf("unexpected recorded names: %v", names)
+	}
+
+	rendered := newGenerateNameInfo("", "migrate-")
+	if err := SetGeneratedNamesVisitor(names)(rendered, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Name != "migrate-x7k2p" || rendered.Object.(*unstructured.Unstructured).GetName() != "migrate-x7k2p" {
+		t.Errorf("expected recorded name to be set, got %q", rendered.Name)
+	}
+
+	unknown := newGenerateNameInfo("", "seed-")
+	if err := SetGeneratedNamesVisitor(names)(unknown, nil); err != nil {
+		t.Fatal(err)
+	}
+	if unknown.Name != "" {
+		t.Errorf("expected name to stay empty for an unrecorded resource, got %q", unknown.Name)
+	}
+}
+
+func TestGeneratedNamesOfResourcesWithSameGenerateName(t *testing.T) {
+	first := newGenerateNameInfo("migrate-x7k2p", "migrate-")
+	second := newGenerateNameInfo("migrate-q9w4z", "migrate-")
+	notCreated := newGenerateNameInfo("", "migrate-")
+
+	names := RecordGeneratedNames(nil, []*resource.Info{first, notCreated, second})
+	expected := map[string]string{"ns:Job.batch/migrate-": "migrate-x7k2p", "ns:Job.batch/migrate-#2": "migrate-q9w4z"}
+	if len(names) != len(expected) || names["ns:Job.batch/migrate-"] != expected["ns:Job.batch/migrate-"] || names["ns:Job.batch/migrate-#2"] != expected["ns:Job.batch/migrate-#2"] {
+		t.Fatalf("expected recorded names %v, got %v", expected, names)
+	}
+
+	rendered := []*resource.Info{newGenerateNameInfo("", "migrate-"), newGenerateNameInfo("", "migrate-"), newGenerateNameInfo("", "migrate-")}
+	visitor := SetGeneratedNamesVisitor(names)
+	for _, info := range rendered {
+		if err := visitor(info, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, expected := range []string{"migrate-x7k2p", "", "migrate-q9w4z"} {
+		if rendered[i].Name != expected {
+			t.Errorf("expected resource %d to be named %q, got %q", i, expected, rendered[i].Name)
+		}
+	}
+}
@@ -109,6 +109,49 @@ var UninstallOrder KindSortOrder = []string{
 	"PriorityClass",
 }
 
+// InsertBefore returns a copy of the ordering with kind placed right before
+// the other kind. The kind is moved if it is already in the ordering. If the
+// other kind is not in the ordering, the kind is placed last.
+func (o KindSortOrder) InsertBefore(kind, other string) KindSortOrder {
+	return o.insert(kind, other, 0)
+}
+
+// InsertAfter returns a copy of the ordering with kind placed right after the
+// other kind. The kind is moved if it is already in the ordering. If the other
+// kind is not in the ordering, the kind is placed last.
+func (o KindSortOrder) InsertAfter(kind, other string) KindSortOrder {
+	return o.insert(kind, other, 1)
+}
+
+func (o KindSortOrder) insert(kind, other string, offset int) KindSortOrder {
+	result := make(KindSortOrder, 0, len(o)+1)
+	for _, k := range o {
+		if k != kind {
+			result = append(result, k)
+		}
+	}
+
+	for i, k := range result {
+		if k == other {
+			i += offset
+			result = append(result[:i], append(KindSortOrder{kind}, result[i:]...)...)
+			return result
+		}
+	}
+
+	return append(result, kind)
+}
+
+// Reverse returns a copy of the ordering in the reverse order.
+func (o KindSortOrder) Reverse() KindSortOrder {
+	result := make(KindSortOrder, len(o))
+	for i, k := range o {
+		result[len(o)-1-i] = k
+	}
+
+	return result
+}
+
 // sort manifests by kind.
 //
 // Results are sorted by 'ordering', keeping order of items with equal kind/priority
@@ -18,6 +18,7 @@ package releaseutil
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 
 	"github.com/werf/3p-helm/pkg/release"
@@ -337,3 +338,30 @@ func TestKindSorterForHooks(t *testing.T) {
 		})
 	}
 }
+
+func TestKindSortOrderInsert(t *testing.T) {
+	order := KindSortOrder{"Namespace", "Secret", "Deployment"}
+
+	for _, test := range []struct {
+		description string
+		order       KindSortOrder
+		expected    KindSortOrder
+	}{
+		{"insert before", order.InsertBefore("Issuer", "Secret"), KindSortOrder{"Namespace", "Issuer", "Secret", "Deployment"}},
+		{"insert after", order.InsertAfter("Issuer", "Deployment"), KindSortOrder{"Namespace", "Secret", "Deployment", "Issuer"}},
+		{"move before", order.InsertBefore("Deployment", "Namespace"), KindSortOrder{"Deployment", "Namespace", "Secret"}},
+		{"move after", order.InsertAfter("Namespace", "Secret"), KindSortOrder{"Secret", "Namespace", "Deployment"}},
+		{"unknown other", order.InsertBefore("Issuer", "Certificate"), KindSortOrder{"Namespace", "Secret", "Deployment", "Issuer"}},
+		{"reverse", order.Reverse(), KindSortOrder{"Deployment", "Secret", "Namespace"}},
+	} {
+		t.Run(test.description, func(t *testing.T) {
+			if !reflect.DeepEqual(test.order, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, test.order)
+			}
+		})
+	}
+
+	if !reflect.DeepEqual(order, KindSortOrder{"Namespace", "Secret", "Deployment"}) {
+		t.Errorf("Expected the ordering to stay the same, got %v", order)
+	}
+}
@@ -17,10 +17,15 @@ limitations under the License.
 package releaseutil
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"sigs.k8s.io/yaml"
 )
 
 // SimpleHead defines what the structure of the head of a manifest file
@@ -45,7 +50,10 @@ func SplitManifests(bigFile string) map[string]string {
 	res := map[string]string{}
 	// Making sure that any extra whitespace in YAML stream doesn't interfere in splitting documents correctly.
 	bigFileTmp := strings.TrimSpace(bigFile)
-	docs := sep.Split(bigFileTmp, -1)
+	var docs []string
+	for _, d := range sep.Split(bigFileTmp, -1) {
+		docs = append(docs, splitJSONStream(d)...)
+	}
 	var count int
 	for _, d := range docs {
 		d = strings.TrimSpace(d)
@@ -75,6 +83,35 @@ func SplitManifests(bigFile string) map[string]string {
 	return res
 }
 
+// splitJSONStream converts a stream of JSON documents, as rendered from
+// ".json" templates or output by generators like CDK8s, into YAML documents,
+// so they are handled like any other manifest. Documents which are not JSON,
+// or not valid JSON, are returned as they are.
+func splitJSONStream(doc string) []string {
+	if !strings.HasPrefix(strings.TrimSpace(doc), "{") {
+		return []string{doc}
+	}
+
+	var docs []string
+	decoder := json.NewDecoder(strings.NewReader(doc))
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil || !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			return []string{doc}
+		}
+
+		converted, err := yaml.JSONToYAML(raw)
+		if err != nil {
+			return []string{doc}
+		}
+		docs = append(docs, string(converted))
+	}
+
+	return docs
+}
+
 // BySplitManifestsOrder sorts by in-file manifest order, as provided in function `SplitManifests`
 type BySplitManifestsOrder []string
 
@@ -22,6 +22,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"sigs.k8s.io/yaml"
@@ -62,6 +63,7 @@ var events = map[string]release.HookEvent{
 	release.HookPreRollback.String():  release.HookPreRollback,
 	release.HookPostRollback.String(): release.HookPostRollback,
 	release.HookTest.String():         release.HookTest,
+	release.HookCanaryVerify.String(): release.HookCanaryVerify,
 	// Support test-success for backward compatibility with Helm 2 tests
 	"test-success": release.HookTest,
 }
@@ -167,6 +169,16 @@ func (file *manifestFile) sort(result *result) error {
 
 		hw := calculateHookWeight(entry)
 
+		ht, err := calculateHookTimeout(entry)
+		if err != nil {
+			return errors.Wrapf(err, "invalid hook %s in %s", entry.Metadata.Name, file.path)
+		}
+
+		hmf, err := calculateHookMaxFailures(entry)
+		if err != nil {
+			return errors.Wrapf(err, "invalid hook %s in %s", entry.Metadata.Name, file.path)
+		}
+
 		h := &release.Hook{
 			Name:           entry.Metadata.Name,
 			Kind:           entry.Kind,
@@ -175,6 +187,8 @@ func (file *manifestFile) sort(result *result) error {
 			Events:         []release.HookEvent{},
 			Weight:         hw,
 			DeletePolicies: []release.HookDeletePolicy{},
+			Timeout:        ht,
+			MaxFailures:    hmf,
 		}
 
 		isUnknownHook := false
@@ -222,6 +236,47 @@ func calculateHookWeight(entry SimpleHead) int {
 	return hw
 }
 
+// calculateHookTimeout finds the timeout in the hook timeout annotation.
+//
+// If no timeout is found, the assigned timeout is 0
+func calculateHookTimeout(entry SimpleHead) (time.Duration, error) {
+	hts, ok := entry.Metadata.Annotations[release.HookTimeoutAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	ht, err := time.ParseDuration(strings.TrimSpace(hts))
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to parse %s annotation", release.HookTimeoutAnnotation)
+	}
+	if ht <= 0 {
+		return 0, errors.Errorf("%s annotation must be positive, got %q", release.HookTimeoutAnnotation, hts)
+	}
+
+	return ht, nil
+}
+
+// calculateHookMaxFailures finds the failures budget in the hook max failures
+// annotation.
+//
+// If no budget is found, the assigned budget is 0
+func calculateHookMaxFailures(entry SimpleHead) (int, error) {
+	hmfs, ok := entry.Metadata.Annotations[release.HookMaxFailuresAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	hmf, err := strconv.Atoi(strings.TrimSpace(hmfs))
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to parse %s annotation", release.HookMaxFailuresAnnotation)
+	}
+	if hmf == 0 {
+		return 0, errors.Errorf("%s annotation must not be zero", release.HookMaxFailuresAnnotation)
+	}
+
+	return hmf, nil
+}
+
 // operateAnnotationValues finds the given annotation and runs the operate function with the value of that annotation
 func operateAnnotationValues(entry SimpleHead, annotation string, operate func(p string)) {
 	if dps, ok := entry.Metadata.Annotations[annotation]; ok {
@@ -19,6 +19,7 @@ package releaseutil
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"sigs.k8s.io/yaml"
 
@@ -226,3 +227,65 @@ metadata:
 		}
 	}
 }
+
+func TestSortManifestsHookTimeout(t *testing.T) {
+	hookManifest := func(timeout string) string {
+		return `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    "helm.sh/hook": pre-install
+    "werf.io/hook-timeout": "` + timeout + `"
+`
+	}
+
+	hs, _, err := SortManifests(map[string]string{"templates/migrate.yaml": hookManifest("15m")}, chartutil.VersionSet{"v1"}, InstallOrder)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(hs) != 1 {
+		t.Fatalf("Expected 1 hook, got %d", len(hs))
+	}
+	if hs[0].Timeout != 15*time.Minute {
+		t.Errorf("Expected hook timeout 15m, got %s", hs[0].Timeout)
+	}
+
+	for _, invalid := range []string{"fifteen minutes", "0s", "-1m"} {
+		if _, _, err := SortManifests(map[string]string{"templates/migrate.yaml": hookManifest(invalid)}, chartutil.VersionSet{"v1"}, InstallOrder); err == nil {
+			t.Errorf("Expected an error for hook timeout %q", invalid)
+		}
+	}
+}
+
+func TestSortManifestsHookMaxFailures(t *testing.T) {
+	hookManifest := func(maxFailures string) string {
+		return `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    "helm.sh/hook": pre-install
+    "werf.io/hook-max-failures": "` + maxFailures + `"
+`
+	}
+
+	for value, expected := range map[string]int{"3": 3, "-1": -1} {
+		hs, _, err := SortManifests(map[string]string{"templates/migrate.yaml": hookManifest(value)}, chartutil.VersionSet{"v1"}, InstallOrder)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(hs) != 1 {
+			t.Fatalf("Expected 1 hook, got %d", len(hs))
+		}
+		if hs[0].MaxFailures != expected {
+			t.Errorf("Expected hook max failures %d, got %d", expected, hs[0].MaxFailures)
+		}
+	}
+
+	for _, invalid := range []string{"three", "0"} {
+		if _, _, err := SortManifests(map[string]string{"templates/migrate.yaml": hookManifest(invalid)}, chartutil.VersionSet{"v1"}, InstallOrder); err == nil {
+			t.Errorf("Expected an error for hook max failures %q", invalid)
+		}
+	}
+}
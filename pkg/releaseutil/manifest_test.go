@@ -59,3 +59,26 @@ func TestSplitManifest(t *testing.T) {
 		t.Errorf("Expected %v, got %v", expected, manifests)
 	}
 }
+
+func TestSplitManifestJSON(t *testing.T) {
+	manifests := SplitManifests(`{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "first"}}
+{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "second"}, "data": {"replicas": "3"}}
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: third
+---
+{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "broken"}
+`)
+
+	expected := map[string]string{
+		"manifest-0": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: first\n",
+		"manifest-1": "apiVersion: v1\ndata:\n  replicas: \"3\"\nkind: ConfigMap\nmetadata:\n  name: second\n",
+		"manifest-2": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: third\n",
+		"manifest-3": "{\"apiVersion\": \"v1\", \"kind\": \"Secret\", \"metadata\": {\"name\": \"broken\"}\n",
+	}
+	if !reflect.DeepEqual(manifests, expected) {
+		t.Errorf("Expected %v, got %v", expected, manifests)
+	}
+}
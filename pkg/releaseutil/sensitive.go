@@ -0,0 +1,101 @@
+package releaseutil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// SensitiveAnnotation marks a resource whose content must not be shown in
+// debug output. Secrets are always treated as sensitive.
+const SensitiveAnnotation = "werf.io/sensitive"
+
+// RedactedValue replaces the values of sensitive fields.
+const RedactedValue = "<redacted>"
+
+var sensitiveHint = regexp.MustCompile(`(?m)^kind:\s*["']?Secret["']?\s*$|` + regexp.QuoteMeta(SensitiveAnnotation))
+
+// IsSensitive returns whether the resource content must be redacted.
+func IsSensitive(head *SimpleHead) bool {
+	if head.Kind == "Secret" {
+		return true
+	}
+
+	return head.Metadata != nil && head.Metadata.Annotations[SensitiveAnnotation] == "true"
+}
+
+// RedactSensitiveManifest redacts the sensitive resources of a multi-document
+// manifest. The keys of data, stringData and binaryData are kept and their
+// values are replaced, other fields except apiVersion, kind and metadata are
+// replaced as a whole. Documents which look sensitive but cannot be parsed are
+// replaced with a comment. The manifest is returned as is if nothing is
+// redacted.
+func RedactSensitiveManifest(manifest string) string {
+	docs := sep.Split(manifest, -1)
+
+	var redacted bool
+	for i, doc := range docs {
+		if !sensitiveHint.MatchString(doc) {
+			continue
+		}
+
+		var head SimpleHead
+		if err := yaml.Unmarshal([]byte(doc), &head); err != nil {
+			docs[i] = "# " + RedactedValue + ": unable to parse the resource\n"
+			redacted = true
+			continue
+		}
+		if !IsSensitive(&head) {
+			continue
+		}
+
+		docs[i] = redactDocument(doc)
+		redacted = true
+	}
+
+	if !redacted {
+		return manifest
+	}
+
+	return strings.Join(docs, "---\n")
+}
+
+func redactDocument(doc string) string {
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+		return "# " + RedactedValue + ": unable to parse the resource\n"
+	}
+
+	for field, value := range obj {
+		switch field {
+		case "apiVersion", "kind", "metadata":
+		case "data", "stringData", "binaryData":
+			obj[field] = redactValues(value)
+		default:
+			obj[field] = RedactedValue
+		}
+	}
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Sprintf("# %s: unable to marshal the resource: %s\n", RedactedValue, err)
+	}
+
+	return string(data)
+}
+
+func redactValues(value interface{}) interface{} {
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		return RedactedValue
+	}
+
+	result := make(map[string]interface{}, len(values))
+	for key := range values {
+		result[key] = RedactedValue
+	}
+
+	return result
+}
@@ -0,0 +1,57 @@
+package releaseutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactSensitiveManifest(t *testing.T) {
+	manifest := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: plain
+data:
+  visible: "yes"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+type: Opaque
+data:
+  password: c2VjcmV0
+stringData:
+  token: plaintext-token
+---
+apiVersion: example.com/v1
+kind: Database
+metadata:
+  name: db
+  annotations:
+    werf.io/sensitive: "true"
+spec:
+  connection: postgres://user:hunter2@db
+---
+kind: Secret
+data: [unparseable
+`
+
+	got := RedactSensitiveManifest(manifest)
+
+	for _, leaked := range []string{"c2VjcmV0", "plaintext-token", "hunter2", "Opaque", "unparseable"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("expected %q to be redacted:\n%s", leaked, got)
+		}
+	}
+	for _, kept := range []string{"visible: \"yes\"", "password: <redacted>", "token: <redacted>", "spec: <redacted>", "name: creds", "# <redacted>: unable to parse the resource"} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("expected %q to be kept:\n%s", kept, got)
+		}
+	}
+
+	plain := "hello moby"
+	if got := RedactSensitiveManifest(plain); got != plain {
+		t.Errorf("expected %q to be unchanged, got %q", plain, got)
+	}
+}
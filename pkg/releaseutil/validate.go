@@ -66,6 +66,33 @@ func CheckOwnership(obj runtime.Object, releaseName, releaseNamespace string) er
 	return nil
 }
 
+// GetOwnerRelease returns the name and namespace of the release that owns obj
+// according to its ownership annotations. Empty strings are returned if obj is
+// not owned by any release.
+func GetOwnerRelease(obj runtime.Object) (name, namespace string) {
+	annos, err := accessor.Annotations(obj)
+	if err != nil {
+		return "", ""
+	}
+	return annos[helmReleaseNameAnnotation], annos[helmReleaseNamespaceAnnotation]
+}
+
+// OwnershipTransferHint returns the kubectl commands that set the ownership
+// metadata of the resource so that it can be adopted by the given release.
+func OwnershipTransferHint(info *resource.Info, releaseName, releaseNamespace string) string {
+	ref := fmt.Sprintf("%s/%s", info.Mapping.Resource.GroupResource().String(), info.Name)
+	nsFlag := ""
+	if info.Namespace != "" {
+		nsFlag = fmt.Sprintf(" -n %s", info.Namespace)
+	}
+
+	return fmt.Sprintf(
+		"kubectl annotate --overwrite%s %s %s=%s %s=%s && kubectl label --overwrite%s %s %s=%s",
+		nsFlag, ref, helmReleaseNameAnnotation, releaseName, helmReleaseNamespaceAnnotation, releaseNamespace,
+		nsFlag, ref, appManagedByLabel, appManagedByHelm,
+	)
+}
+
 func requireValue(meta map[string]string, k, v string) error {
 	actual, ok := meta[k]
 	if !ok {
@@ -87,3 +87,25 @@ func TestCheckOwnership(t *testing.T) {
 	err = CheckOwnership(deployFoo.Object, "rel-a", "ns-a")
 	assert.EqualError(t, err, `invalid ownership metadata; label validation error: key "app.kubernetes.io/managed-by" must equal "Helm": current value is "helm"`)
 }
+
+func TestOwnershipTransferHint(t *testing.T) {
+	deployFoo := newDeploymentResource("foo", "ns-a")
+	deployFoo.Namespace = "ns-a"
+
+	name, namespace := GetOwnerRelease(deployFoo.Object)
+	assert.Empty(t, name)
+	assert.Empty(t, namespace)
+
+	_ = accessor.SetAnnotations(deployFoo.Object, map[string]string{
+		helmReleaseNameAnnotation:      "rel-a",
+		helmReleaseNamespaceAnnotation: "ns-a",
+	})
+	name, namespace = GetOwnerRelease(deployFoo.Object)
+	assert.Equal(t, "rel-a", name)
+	assert.Equal(t, "ns-a", namespace)
+
+	assert.Equal(t,
+		`kubectl annotate --overwrite -n ns-a deployment.apps/foo meta.helm.sh/release-name=rel-b meta.helm.sh/release-namespace=ns-b && kubectl label --overwrite -n ns-a deployment.apps/foo app.kubernetes.io/managed-by=Helm`,
+		OwnershipTransferHint(deployFoo, "rel-b", "ns-b"),
+	)
+}
@@ -59,7 +59,7 @@ func TestUncompressedConfigMapGet(t *testing.T) {
 	rel := releaseStub(name, vers, namespace, rspb.StatusDeployed)
 
 	// Create a test fixture which contains an uncompressed release
-	cfgmap, err := newConfigMapsObject(key, rel, nil)
+	cfgmap, err := newConfigMapsObject(key, rel, nil, CompressionGzip, nil)
 	if err != nil {
 		t.Fatalf("Failed to create configmap: %s", err)
 	}
@@ -0,0 +1,388 @@
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kblabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	rspb "github.com/werf/3p-helm/pkg/release"
+)
+
+var _ Driver = (*ChunkedSecrets)(nil)
+
+// ChunkedSecretsDriverName is the string name of the driver.
+const ChunkedSecretsDriverName = "ChunkedSecret"
+
+// DefaultChunkSize is the default maximum size of the release data stored in
+// a single Secret, leaving room for the metadata below the 1MiB limit of a
+// Secret.
+const DefaultChunkSize = 900 * 1024
+
+const (
+	// chunkOwner is the owner label of the chunks, so that they are not
+	// listed as releases.
+	chunkOwner = "helm-chunk"
+	chunkType  = "helm.sh/release-chunk.v1"
+
+	chunksDataKey = "chunks"
+	digestDataKey = "digest"
+	chunkDataKey  = "chunk"
+)
+
+// ChunkedSecrets stores releases in Secrets like Secrets, except that the
+// compressed releases which are larger than ChunkSize are split across
+// multiple chunk Secrets. The Secret of such a release is an index holding the
+// number of its chunks and the digest of the release data instead of the
+// release, and the chunks are named after it with the number of the chunk,
+// starting at 1. Releases are reassembled from their chunks when they are read.
+//
+// Releases which are not larger than ChunkSize are stored as by Secrets, so
+// both drivers can read them.
+type ChunkedSecrets struct {
+	impl corev1.SecretInterface
+	Log  func(string, ...interface{})
+	// Compression of the stored releases, gzip if empty.
+	Compression Compression
+	// Encryption of the stored releases, not encrypted if nil.
+	Encryption *Encryption
+	// ChunkSize is the maximum size of the release data stored in a single
+	// Secret, DefaultChunkSize if not positive.
+	ChunkSize int
+}
+
+// NewChunkedSecrets initializes a new ChunkedSecrets wrapping an
+// implementation of the kubernetes SecretsInterface.
+func NewChunkedSecrets(impl corev1.SecretInterface) *ChunkedSecrets {
+	return &ChunkedSecrets{
+		impl: impl,
+		Log:  func(_ string, _ ...interface{}) {},
+	}
+}
+
+// Name returns the name of the driver.
+func (secrets *ChunkedSecrets) Name() string {
+	return ChunkedSecretsDriverName
+}
+
+// Get fetches the release named by key, reassembled from its chunks. The
+// corresponding release is returned or error if not found.
+func (secrets *ChunkedSecrets) Get(key string) (*rspb.Release, error) {
+	obj, err := secrets.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrReleaseNotFound
+		}
+		return nil, errors.Wrapf(err, "get: failed to get %q", key)
+	}
+
+	r, err := secrets.decode(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get: failed to decode data %q", key)
+	}
+	r.Labels = filterSystemLabels(obj.ObjectMeta.Labels)
+	return r, nil
+}
+
+// List fetches all releases and returns the list releases such
+// that filter(release) == true. An error is returned if the
+// secret fails to retrieve the releases.
+func (secrets *ChunkedSecrets) List(filter func(*rspb.Release) bool) ([]*rspb.Release, error) {
+	lsel := kblabels.Set{"owner": "helm"}.AsSelector()
+	opts := metav1.ListOptions{LabelSelector: lsel.String()}
+
+	list, err := secrets.impl.List(context.Background(), opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "list: failed to list")
+	}
+
+	var results []*rspb.Release
+	for i := range list.Items {
+		rls, err := secrets.decode(&list.Items[i])
+		if isDecryptionError(err) {
+			return nil, errors.Wrapf(err, "list: failed to decode release %q", list.Items[i].Name)
+		}
+		if err != nil {
+			secrets.Log("list: failed to decode release %q: %s", list.Items[i].Name, err)
+			continue
+		}
+
+		rls.Labels = list.Items[i].ObjectMeta.Labels
+
+		if filter(rls) {
+			results = append(results, rls)
+		}
+	}
+	return results, nil
+}
+
+// Query fetches all releases that match the provided map of labels.
+// An error is returned if the secret fails to retrieve the releases.
+func (secrets *ChunkedSecrets) Query(labels map[string]string) ([]*rspb.Release, error) {
+	ls := kblabels.Set{}
+	for k, v := range labels {
+		if errs := validation.IsValidLabelValue(v); len(errs) != 0 {
+			return nil, errors.Errorf("invalid label value: %q: %s", v, strings.Join(errs, "; "))
+		}
+		ls[k] = v
+	}
+
+	opts := metav1.ListOptions{LabelSelector: ls.AsSelector().String()}
+
+	list, err := secrets.impl.List(context.Background(), opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "query: failed to query with labels")
+	}
+
+	var results []*rspb.Release
+	for i := range list.Items {
+		// The chunks of the releases are never queried as releases.
+		if list.Items[i].Type == chunkType {
+			continue
+		}
+
+		rls, err := secrets.decode(&list.Items[i])
+		if isDecryptionError(err) {
+			return nil, errors.Wrapf(err, "query: failed to decode release %q", list.Items[i].Name)
+		}
+		if err != nil {
+			secrets.Log("query: failed to decode release: %s", err)
+			continue
+		}
+		rls.Labels = list.Items[i].ObjectMeta.Labels
+		results = append(results, rls)
+	}
+
+	if len(results) == 0 {
+		return nil, ErrReleaseNotFound
+	}
+	return results, nil
+}
+
+// Create creates a new Secret holding the release, along with its chunks if
+// it is chunked. If the Secret already exists, ErrReleaseExists is returned.
+func (secrets *ChunkedSecrets) Create(key string, rls *rspb.Release) error {
+	var lbs labels
+
+	lbs.init()
+	lbs.fromMap(rls.Labels)
+	lbs.set("createdAt", strconv.Itoa(int(time.Now().Unix())))
+
+	obj, err := newSecretsObject(key, rls, lbs, secrets.Compression, secrets.Encryption)
+	if err != nil {
+		return errors.Wrapf(err, "create: failed to encode release %q", rls.Name)
+	}
+
+	// The chunks are written before the index, so the release is not
+	// overwritten by writing the chunks if it already exists.
+	if _, err := secrets.impl.Get(context.Background(), key, metav1.GetOptions{}); err == nil {
+		return ErrReleaseExists
+	} else if !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "create: failed to get %q", key)
+	}
+
+	if err := secrets.writeChunks(obj, rls); err != nil {
+		return errors.Wrap(err, "create: failed to write chunks")
+	}
+
+	if _, err := secrets.impl.Create(context.Background(), obj, metav1.CreateOptions{}); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return ErrReleaseExists
+		}
+
+		return errors.Wrap(err, "create: failed to create")
+	}
+	return nil
+}
+
+// Update updates the Secret holding the release along with its chunks,
+// deleting the chunks which are not needed anymore.
+func (secrets *ChunkedSecrets) Update(key string, rls *rspb.Release) error {
+	var lbs labels
+
+	lbs.init()
+	lbs.fromMap(rls.Labels)
+	lbs.set("modifiedAt", strconv.Itoa(int(time.Now().Unix())))
+
+	obj, err := newSecretsObject(key, rls, lbs, secrets.Compression, secrets.Encryption)
+	if err != nil {
+		return errors.Wrapf(err, "update: failed to encode release %q", rls.Name)
+	}
+
+	prev, err := secrets.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "update: failed to update")
+	}
+	prevChunks, err := chunksOf(prev)
+	if err != nil {
+		return errors.Wrapf(err, "update: invalid index %q", key)
+	}
+
+	if err := secrets.writeChunks(obj, rls); err != nil {
+		return errors.Wrap(err, "update: failed to write chunks")
+	}
+
+	if _, err := secrets.impl.Update(context.Background(), obj, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrap(err, "update: failed to update")
+	}
+
+	chunks, _ := chunksOf(obj)
+	return errors.Wrap(secrets.deleteChunks(key, chunks+1, prevChunks), "update: failed to delete chunks")
+}
+
+// Delete deletes the Secret holding the release named by key along with its
+// chunks.
+func (secrets *ChunkedSecrets) Delete(key string) (*rspb.Release, error) {
+	obj, err := secrets.impl.Get(context.Background(), key, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrReleaseNotFound
+		}
+		return nil, errors.Wrapf(err, "delete: failed to get %q", key)
+	}
+
+	rls, err := secrets.decode(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "delete: failed to decode data %q", key)
+	}
+	rls.Labels = filterSystemLabels(obj.ObjectMeta.Labels)
+
+	if err := secrets.impl.Delete(context.Background(), key, metav1.DeleteOptions{}); err != nil {
+		return rls, err
+	}
+
+	chunks, _ := chunksOf(obj)
+	return rls, errors.Wrap(secrets.deleteChunks(key, 1, chunks), "delete: failed to delete chunks")
+}
+
+// writeChunks splits the release data of the Secret into chunks, if it is
+// larger than the chunk size, and writes them, replacing the release data
+// with the index of the chunks.
+func (secrets *ChunkedSecrets) writeChunks(obj *v1.Secret, rls *rspb.Release) error {
+	chunkSize := secrets.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	data := obj.Data["release"]
+	if len(data) <= chunkSize {
+		return nil
+	}
+
+	digest := sha256.Sum256(data)
+	chunks := 0
+	for start := 0; start < len(data); start += chunkSize {
+		end := start + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks++
+
+		chunk := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: chunkName(obj.Name, chunks),
+				Labels: map[string]string{
+					"name":    rls.Name,
+					"owner":   chunkOwner,
+					"version": strconv.Itoa(rls.Version),
+				},
+			},
+			Type: chunkType,
+			Data: map[string][]byte{chunkDataKey: data[start:end]},
+		}
+		if err := secrets.writeChunk(chunk); err != nil {
+			return err
+		}
+	}
+
+	obj.Data = map[string][]byte{
+		chunksDataKey: []byte(strconv.Itoa(chunks)),
+		digestDataKey: []byte(hex.EncodeToString(digest[:])),
+	}
+
+	return nil
+}
+
+// writeChunk creates the chunk, or updates it if it is left from a previous
+// write.
+func (secrets *ChunkedSecrets) writeChunk(chunk *v1.Secret) error {
+	_, err := secrets.impl.Create(context.Background(), chunk, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = secrets.impl.Update(context.Background(), chunk, metav1.UpdateOptions{})
+	}
+
+	return errors.Wrapf(err, "failed to write chunk %q", chunk.Name)
+}
+
+// deleteChunks deletes the chunks from first to last of the release named by
+// key. Chunks which are already deleted are ignored.
+func (secrets *ChunkedSecrets) deleteChunks(key string, first, last int) error {
+	for i := first; i <= last; i++ {
+		err := secrets.impl.Delete(context.Background(), chunkName(key, i), metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete chunk %q", chunkName(key, i))
+		}
+	}
+
+	return nil
+}
+
+// decode decodes the release stored in the Secret, reassembling it from its
+// chunks if it is chunked.
+func (secrets *ChunkedSecrets) decode(obj *v1.Secret) (*rspb.Release, error) {
+	chunks, err := chunksOf(obj)
+	if err != nil {
+		return nil, err
+	}
+	if chunks == 0 {
+		return decodeRelease(string(obj.Data["release"]), secrets.Encryption)
+	}
+
+	var data []byte
+	for i := 1; i <= chunks; i++ {
+		chunk, err := secrets.impl.Get(context.Background(), chunkName(obj.Name, i), metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get chunk %d of %d", i, chunks)
+		}
+		data = append(data, chunk.Data[chunkDataKey]...)
+	}
+
+	// The digest detects the chunks which were changed by a concurrent write.
+	digest := sha256.Sum256(data)
+	if hex.EncodeToString(digest[:]) != string(obj.Data[digestDataKey]) {
+		return nil, errors.New("digest of the chunks does not match the index")
+	}
+
+	return decodeRelease(string(data), secrets.Encryption)
+}
+
+// chunksOf returns the number of chunks of the release stored in the Secret,
+// zero if it is not chunked.
+func chunksOf(obj *v1.Secret) (int, error) {
+	value, chunked := obj.Data[chunksDataKey]
+	if !chunked {
+		return 0, nil
+	}
+
+	chunks, err := strconv.Atoi(string(value))
+	if err != nil || chunks < 1 {
+		return 0, errors.Errorf("invalid number of chunks %q", value)
+	}
+
+	return chunks, nil
+}
+
+func chunkName(key string, i int) string {
+	return fmt.Sprintf("%s.%d", key, i)
+}
@@ -0,0 +1,185 @@
+package driver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	rspb "github.com/werf/3p-helm/pkg/release"
+)
+
+// newTestFixtureChunkedSecrets initializes a MockSecretsInterface with a
+// chunk size small enough for the releases of chunkedReleaseStub to be
+// chunked, but not the ones of releaseStub.
+func newTestFixtureChunkedSecrets(t *testing.T) (*ChunkedSecrets, *MockSecretsInterface) {
+	var mock MockSecretsInterface
+	mock.Init(t)
+
+	secrets := NewChunkedSecrets(&mock)
+	secrets.ChunkSize = 256
+
+	return secrets, &mock
+}
+
+func chunkedReleaseStub(name string, vers int, namespace string, status rspb.Status) *rspb.Release {
+	rls := releaseStub(name, vers, namespace, status)
+	// Random enough not to be compressed into a single chunk.
+	var manifest strings.Builder
+	for i := 0; i < 64; i++ {
+		manifest.WriteString(testKey(name, i*vers*7919))
+	}
+	rls.Manifest = manifest.String()
+
+	return rls
+}
+
+func TestChunkedSecretName(t *testing.T) {
+	c, _ := newTestFixtureChunkedSecrets(t)
+	if c.Name() != ChunkedSecretsDriverName {
+		t.Errorf("Expected name to be %q, got %q", ChunkedSecretsDriverName, c.Name())
+	}
+}
+
+func TestChunkedSecretCreateGet(t *testing.T) {
+	secrets, mock := newTestFixtureChunkedSecrets(t)
+
+	key := testKey("smug-pigeon", 1)
+	rel := chunkedReleaseStub("smug-pigeon", 1, "default", rspb.StatusDeployed)
+	if err := secrets.Create(key, rel); err != nil {
+		t.Fatalf("Failed to create release with key %q: %s", key, err)
+	}
+
+	chunks, err := chunksOf(mock.objects[key])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks < 2 {
+		t.Fatalf("Expected the release to be chunked, got %d chunks", chunks)
+	}
+	if len(mock.objects) != chunks+1 {
+		t.Errorf("Expected %d Secrets, got %d", chunks+1, len(mock.objects))
+	}
+
+	got, err := secrets.Get(key)
+	if err != nil {
+		t.Fatalf("Failed to get release: %s", err)
+	}
+	if !reflect.DeepEqual(rel, got) {
+		t.Errorf("Expected {%v}, got {%v}", rel, got)
+	}
+
+	if err := secrets.Create(key, rel); err != ErrReleaseExists {
+		t.Errorf("Expected %v, got %v", ErrReleaseExists, err)
+	}
+
+	// A chunk changed by a concurrent write does not match the index.
+	mock.objects[chunkName(key, 1)].Data[chunkDataKey][0] ^= 1
+	if _, err := secrets.Get(key); err == nil {
+		t.Error("Expected an error for a changed chunk")
+	}
+}
+
+func TestChunkedSecretSmallRelease(t *testing.T) {
+	secrets, mock := newTestFixtureChunkedSecrets(t)
+	secrets.ChunkSize = 0
+
+	key := testKey("smug-pigeon", 1)
+	rel := releaseStub("smug-pigeon", 1, "default", rspb.StatusDeployed)
+	if err := secrets.Create(key, rel); err != nil {
+		t.Fatalf("Failed to create release with key %q: %s", key, err)
+	}
+	if len(mock.objects) != 1 {
+		t.Errorf("Expected a single Secret, got %d", len(mock.objects))
+	}
+
+	// The release can be read by the Secrets driver.
+	got, err := NewSecrets(mock).Get(key)
+	if err != nil {
+		t.Fatalf("Failed to get release: %s", err)
+	}
+	if !reflect.DeepEqual(rel, got) {
+		t.Errorf("Expected {%v}, got {%v}", rel, got)
+	}
+}
+
+func TestChunkedSecretListQuery(t *testing.T) {
+	secrets, _ := newTestFixtureChunkedSecrets(t)
+
+	for vers, status := range []rspb.Status{rspb.StatusSuperseded, rspb.StatusSuperseded, rspb.StatusDeployed} {
+		rel := chunkedReleaseStub("smug-pigeon", vers+1, "default", status)
+		if err := secrets.Create(testKey(rel.Name, rel.Version), rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := secrets.List(func(*rspb.Release) bool { return true })
+	if err != nil {
+		t.Fatalf("Failed to list releases: %s", err)
+	}
+	if len(all) != 3 {
+		t.Errorf("Expected 3 releases, got %d", len(all))
+	}
+
+	history, err := secrets.Query(map[string]string{"name": "smug-pigeon"})
+	if err != nil {
+		t.Fatalf("Failed to query releases: %s", err)
+	}
+	if len(history) != 3 {
+		t.Errorf("Expected 3 releases, got %d", len(history))
+	}
+
+	deployed, err := secrets.Query(map[string]string{"name": "smug-pigeon", "owner": "helm", "status": "deployed"})
+	if err != nil {
+		t.Fatalf("Failed to query releases: %s", err)
+	}
+	if len(deployed) != 1 || deployed[0].Version != 3 {
+		t.Errorf("Expected the revision 3 to be deployed, got %v", deployed)
+	}
+}
+
+func TestChunkedSecretUpdateDelete(t *testing.T) {
+	secrets, mock := newTestFixtureChunkedSecrets(t)
+
+	key := testKey("smug-pigeon", 1)
+	rel := chunkedReleaseStub("smug-pigeon", 1, "default", rspb.StatusDeployed)
+	if err := secrets.Create(key, rel); err != nil {
+		t.Fatal(err)
+	}
+
+	// Updated to a release which is not chunked, the chunks are deleted.
+	rel = releaseStub("smug-pigeon", 1, "default", rspb.StatusSuperseded)
+	if err := secrets.Update(key, rel); err != nil {
+		t.Fatalf("Failed to update release: %s", err)
+	}
+	if len(mock.objects) != 1 {
+		t.Errorf("Expected the chunks to be deleted, got %d Secrets", len(mock.objects))
+	}
+
+	got, err := secrets.Get(key)
+	if err != nil {
+		t.Fatalf("Failed to get release: %s", err)
+	}
+	if got.Info.Status != rspb.StatusSuperseded {
+		t.Errorf("Expected status %s, got %s", rspb.StatusSuperseded, got.Info.Status)
+	}
+
+	rel = chunkedReleaseStub("smug-pigeon", 1, "default", rspb.StatusFailed)
+	if err := secrets.Update(key, rel); err != nil {
+		t.Fatalf("Failed to update release: %s", err)
+	}
+
+	got, err = secrets.Delete(key)
+	if err != nil {
+		t.Fatalf("Failed to delete release: %s", err)
+	}
+	if !reflect.DeepEqual(rel, got) {
+		t.Errorf("Expected {%v}, got {%v}", rel, got)
+	}
+	if len(mock.objects) != 0 {
+		t.Errorf("Expected the release and its chunks to be deleted, got %d Secrets", len(mock.objects))
+	}
+
+	if _, err := secrets.Get(key); err != ErrReleaseNotFound {
+		t.Errorf("Expected %v, got %v", ErrReleaseNotFound, err)
+	}
+}
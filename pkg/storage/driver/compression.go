@@ -0,0 +1,91 @@
+package driver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm used to compress releases before they are stored.
+type Compression string
+
+const (
+	// CompressionGzip is the default, releases stored by any Helm version can be read.
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd compresses releases better, but releases stored with it can
+	// only be read by versions that support it.
+	CompressionZstd Compression = "zstd"
+)
+
+var magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// ParseCompression parses the name of a compression algorithm. An empty name
+// means gzip.
+func ParseCompression(name string) (Compression, error) {
+	switch c := Compression(name); c {
+	case "":
+		return CompressionGzip, nil
+	case CompressionGzip, CompressionZstd:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown release compression %q, expected %q or %q", name, CompressionGzip, CompressionZstd)
+	}
+}
+
+func compress(data []byte, compression Compression) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch compression {
+	case "", CompressionGzip:
+		w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(data); err != nil {
+			return nil, err
+		}
+		w.Close()
+	case CompressionZstd:
+		w, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown release compression %q", compression)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decompress detects the compression of data by its magic bytes. Data without
+// known magic bytes is returned as is, for backwards compatibility with
+// releases that were stored before compression was introduced.
+func decompress(data []byte) ([]byte, error) {
+	switch {
+	case len(data) > 3 && bytes.Equal(data[0:3], magicGzip):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case len(data) > 4 && bytes.Equal(data[0:4], magicZstd):
+		r, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return data, nil
+	}
+}
@@ -33,6 +33,8 @@ var (
 	ErrInvalidKey = errors.New("release: invalid key")
 	// ErrNoDeployedReleases indicates that there are no releases with the given key in the deployed state
 	ErrNoDeployedReleases = errors.New("has no deployed releases")
+	// ErrReleaseConflict indicates that a release was modified by someone else since it was read.
+	ErrReleaseConflict = errors.New("release: modified concurrently")
 )
 
 // StorageDriverError records an error and the release name that caused it
@@ -103,3 +105,21 @@ type Driver interface {
 	Queryor
 	Name() string
 }
+
+// HistoryPager is implemented by the drivers that can page the history of a
+// release in the storage backend instead of loading all of its revisions.
+//
+// HistoryPage returns up to limit revisions of the named release, newest
+// first, skipping the offset newest ones. A limit of 0 means no limit.
+type HistoryPager interface {
+	HistoryPage(name string, offset, limit int) ([]*rspb.Release, error)
+}
+
+// Locker is implemented by the drivers that can lock a release in the storage
+// backend, so that concurrent deploys of the release wait for each other.
+//
+// LockRelease blocks until the named release is locked, and returns the
+// function unlocking it.
+type Locker interface {
+	LockRelease(name string) (unlock func() error, err error)
+}
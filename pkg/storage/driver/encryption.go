@@ -0,0 +1,148 @@
+package driver
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// magicEncrypted prefixes the releases encrypted by Encryption. It can't be
+// confused with the magic bytes of the compressions.
+var magicEncrypted = []byte("helm:enc:aesgcm:v1:")
+
+// Encryption encrypts the compressed releases with AES-GCM before they are
+// stored, so the manifests and values of the releases can't be read from the
+// Secrets, ConfigMaps or SQL tables without the key. Releases which were
+// stored unencrypted are still read, so the encryption can be enabled for the
+// existing releases.
+type Encryption struct {
+	aead cipher.AEAD
+}
+
+// EncryptionKeySource is where the key of an Encryption is read from. The key
+// is base64 encoded and must be 16, 24 or 32 bytes long, selecting AES-128,
+// AES-192 or AES-256. Only one of the fields may be set.
+type EncryptionKeySource struct {
+	// Key is the key itself.
+	Key string
+	// File is the path of the file holding the key.
+	File string
+	// KMSPlugin is the command, split by spaces, printing the key to its
+	// standard output, e.g. after decrypting it with a key management service.
+	KMSPlugin string
+}
+
+// NewEncryption returns the Encryption with the key, which must be 16, 24 or
+// 32 bytes long.
+func NewEncryption(key []byte) (*Encryption, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid release encryption key")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encryption{aead: aead}, nil
+}
+
+// LoadEncryption returns the Encryption with the key read from the source, or
+// nil if the source is empty.
+func LoadEncryption(source EncryptionKeySource) (*Encryption, error) {
+	var set int
+	for _, s := range []string{source.Key, source.File, source.KMSPlugin} {
+		if s != "" {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return nil, nil
+	case set > 1:
+		return nil, errors.New("only one source of the release encryption key may be set")
+	}
+
+	encoded := source.Key
+	switch {
+	case source.File != "":
+		data, err := os.ReadFile(source.File)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read the release encryption key")
+		}
+		encoded = string(data)
+	case source.KMSPlugin != "":
+		args := strings.Fields(source.KMSPlugin)
+		var stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		data, err := cmd.Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get the release encryption key from KMS plugin %q: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		encoded = string(data)
+	}
+
+	key, err := b64.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "release encryption key is not base64 encoded")
+	}
+
+	return NewEncryption(key)
+}
+
+func (e *Encryption) encrypt(data []byte) ([]byte, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	result := append(append([]byte{}, magicEncrypted...), nonce...)
+	return e.aead.Seal(result, nonce, data, magicEncrypted), nil
+}
+
+// decrypt decrypts the data if it is encrypted. Data which is not encrypted is
+// returned as is. Encrypted data which can't be decrypted fails with a
+// decryptionError.
+func (e *Encryption) decrypt(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, magicEncrypted) {
+		return data, nil
+	}
+	if e == nil {
+		return nil, decryptionError{errors.New("release is encrypted, but no release encryption key is configured")}
+	}
+
+	data = data[len(magicEncrypted):]
+	if len(data) < e.aead.NonceSize() {
+		return nil, decryptionError{errors.New("encrypted release is truncated")}
+	}
+
+	nonce, ciphertext := data[:e.aead.NonceSize()], data[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, ciphertext, magicEncrypted)
+	if err != nil {
+		return nil, decryptionError{errors.Wrap(err, "unable to decrypt release, the release encryption key may be wrong")}
+	}
+
+	return plaintext, nil
+}
+
+// decryptionError is the error of a release which is encrypted, but can't be
+// decrypted. Unlike other releases which can't be decoded, such releases are
+// never skipped when listing the releases: with a misconfigured key they would
+// look like they don't exist, e.g. making an upgrade a fresh install.
+type decryptionError struct {
+	error
+}
+
+func isDecryptionError(err error) bool {
+	var decryptionErr decryptionError
+	return errors.As(err, &decryptionErr)
+}
@@ -103,7 +103,7 @@ func (mock *MockConfigMapsInterface) Init(t *testing.T, releases ...*rspb.Releas
 	for _, rls := range releases {
 		objkey := testKey(rls.Name, rls.Version)
 
-		cfgmap, err := newConfigMapsObject(objkey, rls, nil)
+		cfgmap, err := newConfigMapsObject(objkey, rls, nil, CompressionGzip, nil)
 		if err != nil {
 			t.Fatalf("Failed to create configmap: %s", err)
 		}
@@ -189,7 +189,7 @@ func (mock *MockSecretsInterface) Init(t *testing.T, releases ...*rspb.Release)
 	for _, rls := range releases {
 		objkey := testKey(rls.Name, rls.Version)
 
-		secret, err := newSecretsObject(objkey, rls, nil)
+		secret, err := newSecretsObject(objkey, rls, nil, CompressionGzip, nil)
 		if err != nil {
 			t.Fatalf("Failed to create secret: %s", err)
 		}
@@ -267,3 +267,10 @@ func newTestFixtureSQL(t *testing.T, _ ...*rspb.Release) (*SQL, sqlmock.Sqlmock)
 		statementBuilder: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
 	}, mock
 }
+
+func newTestFixtureMySQL(t *testing.T) (*SQL, sqlmock.Sqlmock) {
+	sqlDriver, mock := newTestFixtureSQL(t)
+	sqlDriver.dialect = SQLDialectMySQL
+	sqlDriver.statementBuilder = sq.StatementBuilder.PlaceholderFormat(sq.Question)
+	return sqlDriver, mock
+}
@@ -43,6 +43,10 @@ const SecretsDriverName = "Secret"
 type Secrets struct {
 	impl corev1.SecretInterface
 	Log  func(string, ...interface{})
+	// Compression of the stored releases, gzip if empty.
+	Compression Compression
+	// Encryption of the stored releases, not encrypted if nil.
+	Encryption *Encryption
 }
 
 // NewSecrets initializes a new Secrets wrapping an implementation of
@@ -71,9 +75,12 @@ func (secrets *Secrets) Get(key string) (*rspb.Release, error) {
 		return nil, errors.Wrapf(err, "get: failed to get %q", key)
 	}
 	// found the secret, decode the base64 data string
-	r, err := decodeRelease(string(obj.Data["release"]))
+	r, err := decodeRelease(string(obj.Data["release"]), secrets.Encryption)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get: failed to decode data %q", key)
+	}
 	r.Labels = filterSystemLabels(obj.ObjectMeta.Labels)
-	return r, errors.Wrapf(err, "get: failed to decode data %q", key)
+	return r, nil
 }
 
 // List fetches all releases and returns the list releases such
@@ -93,7 +100,10 @@ func (secrets *Secrets) List(filter func(*rspb.Release) bool) ([]*rspb.Release,
 	// iterate over the secrets object list
 	// and decode each release
 	for _, item := range list.Items {
-		rls, err := decodeRelease(string(item.Data["release"]))
+		rls, err := decodeRelease(string(item.Data["release"]), secrets.Encryption)
+		if isDecryptionError(err) {
+			return nil, errors.Wrapf(err, "list: failed to decode release %q", item.Name)
+		}
 		if err != nil {
 			secrets.Log("list: failed to decode release: %v: %s", item, err)
 			continue
@@ -132,7 +142,10 @@ func (secrets *Secrets) Query(labels map[string]string) ([]*rspb.Release, error)
 
 	var results []*rspb.Release
 	for _, item := range list.Items {
-		rls, err := decodeRelease(string(item.Data["release"]))
+		rls, err := decodeRelease(string(item.Data["release"]), secrets.Encryption)
+		if isDecryptionError(err) {
+			return nil, errors.Wrapf(err, "query: failed to decode release %q", item.Name)
+		}
 		if err != nil {
 			secrets.Log("query: failed to decode release: %s", err)
 			continue
@@ -154,7 +167,7 @@ func (secrets *Secrets) Create(key string, rls *rspb.Release) error {
 	lbs.set("createdAt", strconv.Itoa(int(time.Now().Unix())))
 
 	// create a new secret to hold the release
-	obj, err := newSecretsObject(key, rls, lbs)
+	obj, err := newSecretsObject(key, rls, lbs, secrets.Compression, secrets.Encryption)
 	if err != nil {
 		return errors.Wrapf(err, "create: failed to encode release %q", rls.Name)
 	}
@@ -180,7 +193,7 @@ func (secrets *Secrets) Update(key string, rls *rspb.Release) error {
 	lbs.set("modifiedAt", strconv.Itoa(int(time.Now().Unix())))
 
 	// create a new secret object to hold the release
-	obj, err := newSecretsObject(key, rls, lbs)
+	obj, err := newSecretsObject(key, rls, lbs, secrets.Compression, secrets.Encryption)
 	if err != nil {
 		return errors.Wrapf(err, "update: failed to encode release %q", rls.Name)
 	}
@@ -212,11 +225,11 @@ func (secrets *Secrets) Delete(key string) (rls *rspb.Release, err error) {
 //	"status"         - status of the release (see pkg/release/status.go for variants)
 //	"owner"          - owner of the secret, currently "helm".
 //	"name"           - name of the release.
-func newSecretsObject(key string, rls *rspb.Release, lbs labels) (*v1.Secret, error) {
+func newSecretsObject(key string, rls *rspb.Release, lbs labels, compression Compression, encryption *Encryption) (*v1.Secret, error) {
 	const owner = "helm"
 
 	// encode the release
-	s, err := encodeRelease(rls)
+	s, err := encodeRelease(rls, compression, encryption)
 	if err != nil {
 		return nil, err
 	}
@@ -14,6 +14,7 @@ limitations under the License.
 package driver
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"reflect"
@@ -59,7 +60,7 @@ func TestUNcompressedSecretGet(t *testing.T) {
 	rel := releaseStub(name, vers, namespace, rspb.StatusDeployed)
 
 	// Create a test fixture which contains an uncompressed release
-	secret, err := newSecretsObject(key, rel, nil)
+	secret, err := newSecretsObject(key, rel, nil, CompressionGzip, nil)
 	if err != nil {
 		t.Fatalf("Failed to create secret: %s", err)
 	}
@@ -83,6 +84,39 @@ func TestUNcompressedSecretGet(t *testing.T) {
 	}
 }
 
+func TestSecretEncryptedWithWrongKey(t *testing.T) {
+	vers := 1
+	name := "smug-pigeon"
+	key := testKey(name, vers)
+	rel := releaseStub(name, vers, "default", rspb.StatusDeployed)
+
+	encryption, err := NewEncryption(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("Failed to create encryption: %s", err)
+	}
+	secret, err := newSecretsObject(key, rel, nil, CompressionGzip, encryption)
+	if err != nil {
+		t.Fatalf("Failed to create secret: %s", err)
+	}
+	var mock MockSecretsInterface
+	mock.objects = map[string]*v1.Secret{key: secret}
+	secrets := NewSecrets(&mock)
+	if secrets.Encryption, err = NewEncryption(bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatalf("Failed to create encryption: %s", err)
+	}
+
+	if _, err := secrets.Get(key); err == nil {
+		t.Error("Expected an error getting the release with a wrong key")
+	}
+	// The release must not look like it does not exist.
+	if _, err := secrets.List(func(*rspb.Release) bool { return true }); err == nil {
+		t.Error("Expected an error listing the releases with a wrong key")
+	}
+	if _, err := secrets.Query(map[string]string{"name": name}); err == nil || err == ErrReleaseNotFound {
+		t.Errorf("Expected a decryption error querying the releases with a wrong key, got %v", err)
+	}
+}
+
 func TestSecretList(t *testing.T) {
 	secrets := newTestFixtureSecrets(t, []*rspb.Release{
 		releaseStub("key-1", 1, "default", rspb.StatusUninstalled),
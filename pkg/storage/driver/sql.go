@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -27,13 +28,16 @@ import (
 
 	sq "github.com/Masterminds/squirrel"
 
-	// Import pq for postgres dialect
+	// Import mysql and pq for the mysql and postgres dialects
+	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 
 	rspb "github.com/werf/3p-helm/pkg/release"
 )
 
 var _ Driver = (*SQL)(nil)
+var _ HistoryPager = (*SQL)(nil)
+var _ Locker = (*SQL)(nil)
 
 var labelMap = map[string]struct{}{
 	"modifiedAt": {},
@@ -44,13 +48,18 @@ var labelMap = map[string]struct{}{
 	"name":       {},
 }
 
-const postgreSQLDialect = "postgres"
+// The SQL dialects, which are also the names of the database/sql drivers.
+const (
+	SQLDialectPostgreSQL = "postgres"
+	SQLDialectMySQL      = "mysql"
+)
 
 // SQLDriverName is the string name of this driver.
 const SQLDriverName = "SQL"
 
 const sqlReleaseTableName = "releases_v1"
 const sqlCustomLabelsTableName = "custom_labels_v1"
+const sqlReleaseLocksTableName = "release_locks_v1"
 
 const (
 	sqlReleaseTableKeyColumn        = "key"
@@ -63,11 +72,16 @@ const (
 	sqlReleaseTableOwnerColumn      = "owner"
 	sqlReleaseTableCreatedAtColumn  = "createdAt"
 	sqlReleaseTableModifiedAtColumn = "modifiedAt"
+	// Incremented on every update, used for optimistic locking.
+	sqlReleaseTableResourceVersionColumn = "resourceVersion"
 
 	sqlCustomLabelsTableReleaseKeyColumn       = "releaseKey"
 	sqlCustomLabelsTableReleaseNamespaceColumn = "releaseNamespace"
 	sqlCustomLabelsTableKeyColumn              = "key"
 	sqlCustomLabelsTableValueColumn            = "value"
+
+	sqlReleaseLocksTableNameColumn      = "name"
+	sqlReleaseLocksTableNamespaceColumn = "namespace"
 )
 
 // Following limits based on k8s labels limits - https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#syntax-and-character-set
@@ -86,8 +100,34 @@ type SQL struct {
 	db               *sqlx.DB
 	namespace        string
 	statementBuilder sq.StatementBuilderType
+	// SQLDialectPostgreSQL if empty.
+	dialect string
 
 	Log func(string, ...interface{})
+	// Compression of the stored releases, gzip if empty.
+	Compression Compression
+	// Encryption of the stored releases, not encrypted if nil.
+	Encryption *Encryption
+
+	// Resource versions of the releases as they were read or written by this driver, keyed by
+	// namespace and release key. Updates of these releases fail with ErrReleaseConflict if the
+	// release was changed by someone else in the meantime.
+	resourceVersionsMu sync.Mutex
+	resourceVersions   map[string]int
+}
+
+// ForNamespace returns a driver for the releases of the namespace sharing the
+// connection and the configuration of the driver.
+func (s *SQL) ForNamespace(namespace string) *SQL {
+	return &SQL{
+		db:               s.db,
+		namespace:        namespace,
+		statementBuilder: s.statementBuilder,
+		dialect:          s.dialect,
+		Log:              s.Log,
+		Compression:      s.Compression,
+		Encryption:       s.Encryption,
+	}
 }
 
 // Name returns the name of the driver.
@@ -105,7 +145,7 @@ func (s *SQL) checkAlreadyApplied(migrations []*migrate.Migration) bool {
 
 	// get list of applied migrations
 	migrate.SetDisableCreateTable(true)
-	records, err := migrate.GetMigrationRecords(s.db.DB, postgreSQLDialect)
+	records, err := migrate.GetMigrationRecords(s.db.DB, s.sqlDialect())
 	migrate.SetDisableCreateTable(false)
 	if err != nil {
 		s.Log("checkAlreadyApplied: failed to get migration records: %v", err)
@@ -130,109 +170,9 @@ func (s *SQL) checkAlreadyApplied(migrations []*migrate.Migration) bool {
 }
 
 func (s *SQL) ensureDBSetup() error {
-
-	migrations := &migrate.MemoryMigrationSource{
-		Migrations: []*migrate.Migration{
-			{
-				Id: "init",
-				Up: []string{
-					fmt.Sprintf(`
-						CREATE TABLE %s (
-							%s VARCHAR(90),
-							%s VARCHAR(64) NOT NULL,
-							%s TEXT NOT NULL,
-							%s VARCHAR(64) NOT NULL,
-							%s VARCHAR(64) NOT NULL,
-							%s INTEGER NOT NULL,
-							%s TEXT NOT NULL,
-							%s TEXT NOT NULL,
-							%s INTEGER NOT NULL,
-							%s INTEGER NOT NULL DEFAULT 0,
-							PRIMARY KEY(%s, %s)
-						);
-						CREATE INDEX ON %s (%s, %s);
-						CREATE INDEX ON %s (%s);
-						CREATE INDEX ON %s (%s);
-						CREATE INDEX ON %s (%s);
-						CREATE INDEX ON %s (%s);
-						CREATE INDEX ON %s (%s);
-	
-						GRANT ALL ON %s TO PUBLIC;
-	
-						ALTER TABLE %s ENABLE ROW LEVEL SECURITY;
-					`,
-						sqlReleaseTableName,
-						sqlReleaseTableKeyColumn,
-						sqlReleaseTableTypeColumn,
-						sqlReleaseTableBodyColumn,
-						sqlReleaseTableNameColumn,
-						sqlReleaseTableNamespaceColumn,
-						sqlReleaseTableVersionColumn,
-						sqlReleaseTableStatusColumn,
-						sqlReleaseTableOwnerColumn,
-						sqlReleaseTableCreatedAtColumn,
-						sqlReleaseTableModifiedAtColumn,
-						sqlReleaseTableKeyColumn,
-						sqlReleaseTableNamespaceColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableKeyColumn,
-						sqlReleaseTableNamespaceColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableVersionColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableStatusColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableOwnerColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableCreatedAtColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableModifiedAtColumn,
-						sqlReleaseTableName,
-						sqlReleaseTableName,
-					),
-				},
-				Down: []string{
-					fmt.Sprintf(`
-						DROP TABLE %s;
-					`, sqlReleaseTableName),
-				},
-			},
-			{
-				Id: "custom_labels",
-				Up: []string{
-					fmt.Sprintf(`
-						CREATE TABLE %s (
-							%s VARCHAR(64),
-							%s VARCHAR(67),
-							%s VARCHAR(%d), 
-							%s VARCHAR(%d)
-						);
-						CREATE INDEX ON %s (%s, %s);
-						
-						GRANT ALL ON %s TO PUBLIC;
-						ALTER TABLE %s ENABLE ROW LEVEL SECURITY;
-					`,
-						sqlCustomLabelsTableName,
-						sqlCustomLabelsTableReleaseKeyColumn,
-						sqlCustomLabelsTableReleaseNamespaceColumn,
-						sqlCustomLabelsTableKeyColumn,
-						sqlCustomLabelsTableKeyMaxLenght,
-						sqlCustomLabelsTableValueColumn,
-						sqlCustomLabelsTableValueMaxLenght,
-						sqlCustomLabelsTableName,
-						sqlCustomLabelsTableReleaseKeyColumn,
-						sqlCustomLabelsTableReleaseNamespaceColumn,
-						sqlCustomLabelsTableName,
-						sqlCustomLabelsTableName,
-					),
-				},
-				Down: []string{
-					fmt.Sprintf(`
-						DELETE TABLE %s;
-					`, sqlCustomLabelsTableName),
-				},
-			},
-		},
+	migrations := &migrate.MemoryMigrationSource{Migrations: postgreSQLMigrations()}
+	if s.sqlDialect() == SQLDialectMySQL {
+		migrations.Migrations = mySQLMigrations()
 	}
 
 	// Check that init migration already applied
@@ -241,10 +181,25 @@ func (s *SQL) ensureDBSetup() error {
 	}
 
 	// Populate the database with the relations we need if they don't exist yet
-	_, err := migrate.Exec(s.db.DB, postgreSQLDialect, migrations, migrate.Up)
+	_, err := migrate.Exec(s.db.DB, s.sqlDialect(), migrations, migrate.Up)
 	return err
 }
 
+func (s *SQL) sqlDialect() string {
+	if s.dialect == "" {
+		return SQLDialectPostgreSQL
+	}
+	return s.dialect
+}
+
+// column returns the column name quoted for the dialect, as some of the names are reserved words in MySQL.
+func (s *SQL) column(name string) string {
+	if s.sqlDialect() == SQLDialectMySQL {
+		return "`" + name + "`"
+	}
+	return name
+}
+
 // SQLReleaseWrapper describes how Helm releases are stored in an SQL database
 type SQLReleaseWrapper struct {
 	// The primary key, made of {release-name}.{release-version}
@@ -266,6 +221,9 @@ type SQLReleaseWrapper struct {
 	Owner      string `db:"owner"`
 	CreatedAt  int    `db:"createdAt"`
 	ModifiedAt int    `db:"modifiedAt"`
+
+	// PostgreSQL folds unquoted column names to lower case
+	ResourceVersion int `db:"resourceversion"`
 }
 
 type SQLReleaseCustomLabelWrapper struct {
@@ -275,9 +233,25 @@ type SQLReleaseCustomLabelWrapper struct {
 	Value            string `db:"value"`
 }
 
-// NewSQL initializes a new sql driver.
+// NewSQL initializes a new sql driver backed by PostgreSQL.
 func NewSQL(connectionString string, logger func(string, ...interface{}), namespace string) (*SQL, error) {
-	db, err := sqlx.Connect(postgreSQLDialect, connectionString)
+	return NewSQLWithDialect(SQLDialectPostgreSQL, connectionString, logger, namespace)
+}
+
+// NewSQLWithDialect initializes a new sql driver backed by the database of the dialect, SQLDialectPostgreSQL or
+// SQLDialectMySQL. The schema of the database is migrated to the current version.
+func NewSQLWithDialect(dialect, connectionString string, logger func(string, ...interface{}), namespace string) (*SQL, error) {
+	var placeholderFormat sq.PlaceholderFormat
+	switch dialect {
+	case SQLDialectPostgreSQL:
+		placeholderFormat = sq.Dollar
+	case SQLDialectMySQL:
+		placeholderFormat = sq.Question
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect %q: expected %q or %q", dialect, SQLDialectPostgreSQL, SQLDialectMySQL)
+	}
+
+	db, err := sqlx.Connect(dialect, connectionString)
 	if err != nil {
 		return nil, err
 	}
@@ -285,7 +259,8 @@ func NewSQL(connectionString string, logger func(string, ...interface{}), namesp
 	driver := &SQL{
 		db:               db,
 		Log:              logger,
-		statementBuilder: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+		statementBuilder: sq.StatementBuilder.PlaceholderFormat(placeholderFormat),
+		dialect:          dialect,
 	}
 
 	if err := driver.ensureDBSetup(); err != nil {
@@ -302,10 +277,10 @@ func (s *SQL) Get(key string) (*rspb.Release, error) {
 	var record SQLReleaseWrapper
 
 	qb := s.statementBuilder.
-		Select(sqlReleaseTableBodyColumn).
+		Select(s.column(sqlReleaseTableBodyColumn), s.column(sqlReleaseTableResourceVersionColumn)).
 		From(sqlReleaseTableName).
-		Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
-		Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace})
+		Where(sq.Eq{s.column(sqlReleaseTableKeyColumn): key}).
+		Where(sq.Eq{s.column(sqlReleaseTableNamespaceColumn): s.namespace})
 
 	query, args, err := qb.ToSql()
 	if err != nil {
@@ -319,7 +294,7 @@ func (s *SQL) Get(key string) (*rspb.Release, error) {
 		return nil, ErrReleaseNotFound
 	}
 
-	release, err := decodeRelease(record.Body)
+	release, err := decodeRelease(record.Body, s.Encryption)
 	if err != nil {
 		s.Log("get: failed to decode data %q: %v", key, err)
 		return nil, err
@@ -330,19 +305,21 @@ func (s *SQL) Get(key string) (*rspb.Release, error) {
 		return nil, err
 	}
 
+	s.setResourceVersion(s.namespace, key, record.ResourceVersion)
+
 	return release, nil
 }
 
 // List returns the list of all releases such that filter(release) == true
 func (s *SQL) List(filter func(*rspb.Release) bool) ([]*rspb.Release, error) {
 	sb := s.statementBuilder.
-		Select(sqlReleaseTableKeyColumn, sqlReleaseTableNamespaceColumn, sqlReleaseTableBodyColumn).
+		Select(s.column(sqlReleaseTableKeyColumn), s.column(sqlReleaseTableNamespaceColumn), s.column(sqlReleaseTableBodyColumn)).
 		From(sqlReleaseTableName).
-		Where(sq.Eq{sqlReleaseTableOwnerColumn: sqlReleaseDefaultOwner})
+		Where(sq.Eq{s.column(sqlReleaseTableOwnerColumn): sqlReleaseDefaultOwner})
 
 	// If a namespace was specified, we only list releases from that namespace
 	if s.namespace != "" {
-		sb = sb.Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace})
+		sb = sb.Where(sq.Eq{s.column(sqlReleaseTableNamespaceColumn): s.namespace})
 	}
 
 	query, args, err := sb.ToSql()
@@ -359,7 +336,10 @@ func (s *SQL) List(filter func(*rspb.Release) bool) ([]*rspb.Release, error) {
 
 	var releases []*rspb.Release
 	for _, record := range records {
-		release, err := decodeRelease(record.Body)
+		release, err := decodeRelease(record.Body, s.Encryption)
+		if isDecryptionError(err) {
+			return nil, fmt.Errorf("failed to decode release %q: %w", record.Key, err)
+		}
 		if err != nil {
 			s.Log("list: failed to decode release: %v: %v", record, err)
 			continue
@@ -384,7 +364,7 @@ func (s *SQL) List(filter func(*rspb.Release) bool) ([]*rspb.Release, error) {
 // Query returns the set of releases that match the provided set of labels.
 func (s *SQL) Query(labels map[string]string) ([]*rspb.Release, error) {
 	sb := s.statementBuilder.
-		Select(sqlReleaseTableKeyColumn, sqlReleaseTableNamespaceColumn, sqlReleaseTableBodyColumn).
+		Select(s.column(sqlReleaseTableKeyColumn), s.column(sqlReleaseTableNamespaceColumn), s.column(sqlReleaseTableBodyColumn), s.column(sqlReleaseTableResourceVersionColumn)).
 		From(sqlReleaseTableName)
 
 	keys := make([]string, 0, len(labels))
@@ -394,7 +374,7 @@ func (s *SQL) Query(labels map[string]string) ([]*rspb.Release, error) {
 	sort.Strings(keys)
 	for _, key := range keys {
 		if _, ok := labelMap[key]; ok {
-			sb = sb.Where(sq.Eq{key: labels[key]})
+			sb = sb.Where(sq.Eq{s.column(key): labels[key]})
 		} else {
 			s.Log("unknown label %s", key)
 			return nil, fmt.Errorf("unknown label %s", key)
@@ -403,7 +383,7 @@ func (s *SQL) Query(labels map[string]string) ([]*rspb.Release, error) {
 
 	// If a namespace was specified, we only list releases from that namespace
 	if s.namespace != "" {
-		sb = sb.Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace})
+		sb = sb.Where(sq.Eq{s.column(sqlReleaseTableNamespaceColumn): s.namespace})
 	}
 
 	// Build our query
@@ -423,9 +403,69 @@ func (s *SQL) Query(labels map[string]string) ([]*rspb.Release, error) {
 		return nil, ErrReleaseNotFound
 	}
 
+	releases, err := s.decodeRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(releases) == 0 {
+		return nil, ErrReleaseNotFound
+	}
+
+	return releases, nil
+}
+
+// HistoryPage returns up to limit revisions of the named release, newest first, skipping the
+// offset newest ones. Paging is done by the database, so that only the requested revisions are
+// fetched and decoded.
+func (s *SQL) HistoryPage(name string, offset, limit int) ([]*rspb.Release, error) {
+	sb := s.statementBuilder.
+		Select(s.column(sqlReleaseTableKeyColumn), s.column(sqlReleaseTableNamespaceColumn), s.column(sqlReleaseTableBodyColumn), s.column(sqlReleaseTableResourceVersionColumn)).
+		From(sqlReleaseTableName).
+		Where(sq.Eq{s.column(sqlReleaseTableNameColumn): name}).
+		Where(sq.Eq{s.column(sqlReleaseTableOwnerColumn): sqlReleaseDefaultOwner})
+
+	// If a namespace was specified, we only list releases from that namespace
+	if s.namespace != "" {
+		sb = sb.Where(sq.Eq{s.column(sqlReleaseTableNamespaceColumn): s.namespace})
+	}
+
+	sb = sb.OrderBy(s.column(sqlReleaseTableVersionColumn) + " DESC")
+	if limit > 0 {
+		sb = sb.Limit(uint64(limit))
+	}
+	if offset > 0 {
+		sb = sb.Offset(uint64(offset))
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		s.Log("failed to build query: %v", err)
+		return nil, err
+	}
+
+	var records = []SQLReleaseWrapper{}
+	if err := s.db.Select(&records, query, args...); err != nil {
+		s.Log("history: failed to query release history: %v", err)
+		return nil, err
+	}
+
+	if len(records) == 0 && offset == 0 {
+		return nil, ErrReleaseNotFound
+	}
+
+	return s.decodeRecords(records)
+}
+
+// decodeRecords decodes the releases of the records and gets their custom labels. Records that
+// cannot be decoded are skipped.
+func (s *SQL) decodeRecords(records []SQLReleaseWrapper) ([]*rspb.Release, error) {
 	var releases []*rspb.Release
 	for _, record := range records {
-		release, err := decodeRelease(record.Body)
+		release, err := decodeRelease(record.Body, s.Encryption)
+		if isDecryptionError(err) {
+			return nil, fmt.Errorf("failed to decode release %q: %w", record.Key, err)
+		}
 		if err != nil {
 			s.Log("list: failed to decode release: %v: %v", record, err)
 			continue
@@ -436,11 +476,9 @@ func (s *SQL) Query(labels map[string]string) ([]*rspb.Release, error) {
 			return nil, err
 		}
 
-		releases = append(releases, release)
-	}
+		s.setResourceVersion(record.Namespace, record.Key, record.ResourceVersion)
 
-	if len(releases) == 0 {
-		return nil, ErrReleaseNotFound
+		releases = append(releases, release)
 	}
 
 	return releases, nil
@@ -454,7 +492,7 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 	}
 	s.namespace = namespace
 
-	body, err := encodeRelease(rls)
+	body, err := encodeRelease(rls, s.Compression, s.Encryption)
 	if err != nil {
 		s.Log("failed to encode release: %v", err)
 		return err
@@ -469,15 +507,15 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 	insertQuery, args, err := s.statementBuilder.
 		Insert(sqlReleaseTableName).
 		Columns(
-			sqlReleaseTableKeyColumn,
-			sqlReleaseTableTypeColumn,
-			sqlReleaseTableBodyColumn,
-			sqlReleaseTableNameColumn,
-			sqlReleaseTableNamespaceColumn,
-			sqlReleaseTableVersionColumn,
-			sqlReleaseTableStatusColumn,
-			sqlReleaseTableOwnerColumn,
-			sqlReleaseTableCreatedAtColumn,
+			s.column(sqlReleaseTableKeyColumn),
+			s.column(sqlReleaseTableTypeColumn),
+			s.column(sqlReleaseTableBodyColumn),
+			s.column(sqlReleaseTableNameColumn),
+			s.column(sqlReleaseTableNamespaceColumn),
+			s.column(sqlReleaseTableVersionColumn),
+			s.column(sqlReleaseTableStatusColumn),
+			s.column(sqlReleaseTableOwnerColumn),
+			s.column(sqlReleaseTableCreatedAtColumn),
 		).
 		Values(
 			key,
@@ -499,10 +537,10 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 		defer transaction.Rollback()
 
 		selectQuery, args, buildErr := s.statementBuilder.
-			Select(sqlReleaseTableKeyColumn).
+			Select(s.column(sqlReleaseTableKeyColumn)).
 			From(sqlReleaseTableName).
-			Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
-			Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace}).
+			Where(sq.Eq{s.column(sqlReleaseTableKeyColumn): key}).
+			Where(sq.Eq{s.column(sqlReleaseTableNamespaceColumn): s.namespace}).
 			ToSql()
 		if buildErr != nil {
 			s.Log("failed to build select query: %v", buildErr)
@@ -524,10 +562,10 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 		insertLabelsQuery, args, err := s.statementBuilder.
 			Insert(sqlCustomLabelsTableName).
 			Columns(
-				sqlCustomLabelsTableReleaseKeyColumn,
-				sqlCustomLabelsTableReleaseNamespaceColumn,
-				sqlCustomLabelsTableKeyColumn,
-				sqlCustomLabelsTableValueColumn,
+				s.column(sqlCustomLabelsTableReleaseKeyColumn),
+				s.column(sqlCustomLabelsTableReleaseNamespaceColumn),
+				s.column(sqlCustomLabelsTableKeyColumn),
+				s.column(sqlCustomLabelsTableValueColumn),
 			).
 			Values(
 				key,
@@ -550,6 +588,8 @@ func (s *SQL) Create(key string, rls *rspb.Release) error {
 	}
 	defer transaction.Commit()
 
+	s.setResourceVersion(namespace, key, 0)
+
 	return nil
 }
 
@@ -561,34 +601,51 @@ func (s *SQL) Update(key string, rls *rspb.Release) error {
 	}
 	s.namespace = namespace
 
-	body, err := encodeRelease(rls)
+	body, err := encodeRelease(rls, s.Compression, s.Encryption)
 	if err != nil {
 		s.Log("failed to encode release: %v", err)
 		return err
 	}
 
-	query, args, err := s.statementBuilder.
+	ub := s.statementBuilder.
 		Update(sqlReleaseTableName).
-		Set(sqlReleaseTableBodyColumn, body).
-		Set(sqlReleaseTableNameColumn, rls.Name).
-		Set(sqlReleaseTableVersionColumn, int(rls.Version)).
-		Set(sqlReleaseTableStatusColumn, rls.Info.Status.String()).
-		Set(sqlReleaseTableOwnerColumn, sqlReleaseDefaultOwner).
-		Set(sqlReleaseTableModifiedAtColumn, int(time.Now().Unix())).
-		Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
-		Where(sq.Eq{sqlReleaseTableNamespaceColumn: namespace}).
-		ToSql()
-
+		Set(s.column(sqlReleaseTableBodyColumn), body).
+		Set(s.column(sqlReleaseTableNameColumn), rls.Name).
+		Set(s.column(sqlReleaseTableVersionColumn), int(rls.Version)).
+		Set(s.column(sqlReleaseTableStatusColumn), rls.Info.Status.String()).
+		Set(s.column(sqlReleaseTableOwnerColumn), sqlReleaseDefaultOwner).
+		Set(s.column(sqlReleaseTableModifiedAtColumn), int(time.Now().Unix())).
+		Set(s.column(sqlReleaseTableResourceVersionColumn), sq.Expr(s.column(sqlReleaseTableResourceVersionColumn)+" + 1")).
+		Where(sq.Eq{s.column(sqlReleaseTableKeyColumn): key}).
+		Where(sq.Eq{s.column(sqlReleaseTableNamespaceColumn): namespace})
+
+	// Only update the release if nobody else did since it was read or written by this driver
+	resourceVersion, known := s.getResourceVersion(namespace, key)
+	if known {
+		ub = ub.Where(sq.Eq{s.column(sqlReleaseTableResourceVersionColumn): resourceVersion})
+	}
+
+	query, args, err := ub.ToSql()
 	if err != nil {
 		s.Log("failed to build update query: %v", err)
 		return err
 	}
 
-	if _, err := s.db.Exec(query, args...); err != nil {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
 		s.Log("failed to update release %s in SQL database: %v", key, err)
 		return err
 	}
 
+	if known {
+		if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+			s.Log("release %s was modified concurrently", key)
+			s.forgetResourceVersion(namespace, key)
+			return ErrReleaseConflict
+		}
+		s.setResourceVersion(namespace, key, resourceVersion+1)
+	}
+
 	return nil
 }
 
@@ -601,10 +658,10 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 	}
 
 	selectQuery, args, err := s.statementBuilder.
-		Select(sqlReleaseTableBodyColumn).
+		Select(s.column(sqlReleaseTableBodyColumn)).
 		From(sqlReleaseTableName).
-		Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
-		Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace}).
+		Where(sq.Eq{s.column(sqlReleaseTableKeyColumn): key}).
+		Where(sq.Eq{s.column(sqlReleaseTableNamespaceColumn): s.namespace}).
 		ToSql()
 	if err != nil {
 		s.Log("failed to build select query: %v", err)
@@ -618,7 +675,7 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 		return nil, ErrReleaseNotFound
 	}
 
-	release, err := decodeRelease(record.Body)
+	release, err := decodeRelease(record.Body, s.Encryption)
 	if err != nil {
 		s.Log("failed to decode release %s: %v", key, err)
 		transaction.Rollback()
@@ -628,8 +685,8 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 
 	deleteQuery, args, err := s.statementBuilder.
 		Delete(sqlReleaseTableName).
-		Where(sq.Eq{sqlReleaseTableKeyColumn: key}).
-		Where(sq.Eq{sqlReleaseTableNamespaceColumn: s.namespace}).
+		Where(sq.Eq{s.column(sqlReleaseTableKeyColumn): key}).
+		Where(sq.Eq{s.column(sqlReleaseTableNamespaceColumn): s.namespace}).
 		ToSql()
 	if err != nil {
 		s.Log("failed to build delete query: %v", err)
@@ -649,8 +706,8 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 
 	deleteCustomLabelsQuery, args, err := s.statementBuilder.
 		Delete(sqlCustomLabelsTableName).
-		Where(sq.Eq{sqlCustomLabelsTableReleaseKeyColumn: key}).
-		Where(sq.Eq{sqlCustomLabelsTableReleaseNamespaceColumn: s.namespace}).
+		Where(sq.Eq{s.column(sqlCustomLabelsTableReleaseKeyColumn): key}).
+		Where(sq.Eq{s.column(sqlCustomLabelsTableReleaseNamespaceColumn): s.namespace}).
 		ToSql()
 
 	if err != nil {
@@ -658,16 +715,103 @@ func (s *SQL) Delete(key string) (*rspb.Release, error) {
 		return nil, err
 	}
 	_, err = transaction.Exec(deleteCustomLabelsQuery, args...)
+	if err == nil {
+		s.forgetResourceVersion(s.namespace, key)
+	}
 	return release, err
 }
 
+// LockRelease locks the named release in the namespace of the driver with a row lock, which is held by a
+// transaction until the release is unlocked, or by the database until the connection is lost.
+func (s *SQL) LockRelease(name string) (func() error, error) {
+	namespace := s.namespace
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	transaction, err := s.db.Beginx()
+	if err != nil {
+		s.Log("failed to start SQL transaction: %v", err)
+		return nil, fmt.Errorf("error beginning transaction: %v", err)
+	}
+
+	ib := s.statementBuilder.
+		Insert(sqlReleaseLocksTableName).
+		Columns(s.column(sqlReleaseLocksTableNameColumn), s.column(sqlReleaseLocksTableNamespaceColumn)).
+		Values(name, namespace)
+	if s.sqlDialect() == SQLDialectMySQL {
+		ib = ib.Options("IGNORE")
+	} else {
+		ib = ib.Suffix("ON CONFLICT DO NOTHING")
+	}
+
+	insertQuery, args, err := ib.ToSql()
+	if err != nil {
+		transaction.Rollback()
+		s.Log("failed to build insert query: %v", err)
+		return nil, err
+	}
+
+	if _, err := transaction.Exec(insertQuery, args...); err != nil {
+		transaction.Rollback()
+		s.Log("failed to create lock of release %s: %v", name, err)
+		return nil, err
+	}
+
+	lockQuery, args, err := s.statementBuilder.
+		Select(s.column(sqlReleaseLocksTableNameColumn)).
+		From(sqlReleaseLocksTableName).
+		Where(sq.Eq{s.column(sqlReleaseLocksTableNameColumn): name}).
+		Where(sq.Eq{s.column(sqlReleaseLocksTableNamespaceColumn): namespace}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		transaction.Rollback()
+		s.Log("failed to build lock query: %v", err)
+		return nil, err
+	}
+
+	if _, err := transaction.Exec(lockQuery, args...); err != nil {
+		transaction.Rollback()
+		s.Log("failed to lock release %s: %v", name, err)
+		return nil, err
+	}
+
+	return transaction.Commit, nil
+}
+
+func (s *SQL) getResourceVersion(namespace, key string) (int, bool) {
+	s.resourceVersionsMu.Lock()
+	defer s.resourceVersionsMu.Unlock()
+
+	resourceVersion, found := s.resourceVersions[namespace+"/"+key]
+	return resourceVersion, found
+}
+
+func (s *SQL) setResourceVersion(namespace, key string, resourceVersion int) {
+	s.resourceVersionsMu.Lock()
+	defer s.resourceVersionsMu.Unlock()
+
+	if s.resourceVersions == nil {
+		s.resourceVersions = map[string]int{}
+	}
+	s.resourceVersions[namespace+"/"+key] = resourceVersion
+}
+
+func (s *SQL) forgetResourceVersion(namespace, key string) {
+	s.resourceVersionsMu.Lock()
+	defer s.resourceVersionsMu.Unlock()
+
+	delete(s.resourceVersions, namespace+"/"+key)
+}
+
 // Get release custom labels from database
 func (s *SQL) getReleaseCustomLabels(key string, _ string) (map[string]string, error) {
 	query, args, err := s.statementBuilder.
-		Select(sqlCustomLabelsTableKeyColumn, sqlCustomLabelsTableValueColumn).
+		Select(s.column(sqlCustomLabelsTableKeyColumn), s.column(sqlCustomLabelsTableValueColumn)).
 		From(sqlCustomLabelsTableName).
-		Where(sq.Eq{sqlCustomLabelsTableReleaseKeyColumn: key,
-			sqlCustomLabelsTableReleaseNamespaceColumn: s.namespace}).
+		Where(sq.Eq{s.column(sqlCustomLabelsTableReleaseKeyColumn): key,
+			s.column(sqlCustomLabelsTableReleaseNamespaceColumn): s.namespace}).
 		ToSql()
 	if err != nil {
 		return nil, err
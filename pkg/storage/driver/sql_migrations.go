@@ -0,0 +1,274 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// Migrations are applied in order and never changed once released: a change of the schema is a new migration, which
+// has to be added for every dialect.
+
+func postgreSQLMigrations() []*migrate.Migration {
+	return []*migrate.Migration{
+		{
+			Id: "init",
+			Up: []string{
+				fmt.Sprintf(`
+					CREATE TABLE %s (
+						%s VARCHAR(90),
+						%s VARCHAR(64) NOT NULL,
+						%s TEXT NOT NULL,
+						%s VARCHAR(64) NOT NULL,
+						%s VARCHAR(64) NOT NULL,
+						%s INTEGER NOT NULL,
+						%s TEXT NOT NULL,
+						%s TEXT NOT NULL,
+						%s INTEGER NOT NULL,
+						%s INTEGER NOT NULL DEFAULT 0,
+						PRIMARY KEY(%s, %s)
+					);
+					CREATE INDEX ON %s (%s, %s);
+					CREATE INDEX ON %s (%s);
+					CREATE INDEX ON %s (%s);
+					CREATE INDEX ON %s (%s);
+					CREATE INDEX ON %s (%s);
+					CREATE INDEX ON %s (%s);
+
+					GRANT ALL ON %s TO PUBLIC;
+
+					ALTER TABLE %s ENABLE ROW LEVEL SECURITY;
+				`,
+					sqlReleaseTableName,
+					sqlReleaseTableKeyColumn,
+					sqlReleaseTableTypeColumn,
+					sqlReleaseTableBodyColumn,
+					sqlReleaseTableNameColumn,
+					sqlReleaseTableNamespaceColumn,
+					sqlReleaseTableVersionColumn,
+					sqlReleaseTableStatusColumn,
+					sqlReleaseTableOwnerColumn,
+					sqlReleaseTableCreatedAtColumn,
+					sqlReleaseTableModifiedAtColumn,
+					sqlReleaseTableKeyColumn,
+					sqlReleaseTableNamespaceColumn,
+					sqlReleaseTableName,
+					sqlReleaseTableKeyColumn,
+					sqlReleaseTableNamespaceColumn,
+					sqlReleaseTableName,
+					sqlReleaseTableVersionColumn,
+					sqlReleaseTableName,
+					sqlReleaseTableStatusColumn,
+					sqlReleaseTableName,
+					sqlReleaseTableOwnerColumn,
+					sqlReleaseTableName,
+					sqlReleaseTableCreatedAtColumn,
+					sqlReleaseTableName,
+					sqlReleaseTableModifiedAtColumn,
+					sqlReleaseTableName,
+					sqlReleaseTableName,
+				),
+			},
+			Down: []string{
+				fmt.Sprintf(`
+					DROP TABLE %s;
+				`, sqlReleaseTableName),
+			},
+		},
+		{
+			Id: "custom_labels",
+			Up: []string{
+				fmt.Sprintf(`
+					CREATE TABLE %s (
+						%s VARCHAR(64),
+						%s VARCHAR(67),
+						%s VARCHAR(%d), 
+						%s VARCHAR(%d)
+					);
+					CREATE INDEX ON %s (%s, %s);
+					
+					GRANT ALL ON %s TO PUBLIC;
+					ALTER TABLE %s ENABLE ROW LEVEL SECURITY;
+				`,
+					sqlCustomLabelsTableName,
+					sqlCustomLabelsTableReleaseKeyColumn,
+					sqlCustomLabelsTableReleaseNamespaceColumn,
+					sqlCustomLabelsTableKeyColumn,
+					sqlCustomLabelsTableKeyMaxLenght,
+					sqlCustomLabelsTableValueColumn,
+					sqlCustomLabelsTableValueMaxLenght,
+					sqlCustomLabelsTableName,
+					sqlCustomLabelsTableReleaseKeyColumn,
+					sqlCustomLabelsTableReleaseNamespaceColumn,
+					sqlCustomLabelsTableName,
+					sqlCustomLabelsTableName,
+				),
+			},
+			Down: []string{
+				fmt.Sprintf(`
+					DELETE TABLE %s;
+				`, sqlCustomLabelsTableName),
+			},
+		},
+		{
+			Id: "resource_version",
+			Up: []string{
+				fmt.Sprintf(`
+					ALTER TABLE %s ADD COLUMN %s INTEGER NOT NULL DEFAULT 0;
+				`, sqlReleaseTableName, sqlReleaseTableResourceVersionColumn),
+			},
+			Down: []string{
+				fmt.Sprintf(`
+					ALTER TABLE %s DROP COLUMN %s;
+				`, sqlReleaseTableName, sqlReleaseTableResourceVersionColumn),
+			},
+		},
+		{
+			Id: "release_locks",
+			Up: []string{
+				fmt.Sprintf(`
+					CREATE TABLE %s (
+						%s VARCHAR(64) NOT NULL,
+						%s VARCHAR(64) NOT NULL,
+						PRIMARY KEY(%s, %s)
+					);
+
+					GRANT ALL ON %s TO PUBLIC;
+					ALTER TABLE %s ENABLE ROW LEVEL SECURITY;
+				`,
+					sqlReleaseLocksTableName,
+					sqlReleaseLocksTableNameColumn,
+					sqlReleaseLocksTableNamespaceColumn,
+					sqlReleaseLocksTableNameColumn,
+					sqlReleaseLocksTableNamespaceColumn,
+					sqlReleaseLocksTableName,
+					sqlReleaseLocksTableName,
+				),
+			},
+			Down: []string{
+				fmt.Sprintf(`
+					DROP TABLE %s;
+				`, sqlReleaseLocksTableName),
+			},
+		},
+	}
+}
+
+// The MySQL migrations have the same ids as the PostgreSQL ones. Every statement is executed separately, as MySQL
+// connections do not allow multiple statements by default, and the indexes are named, as MySQL requires.
+func mySQLMigrations() []*migrate.Migration {
+	quote := func(column string) string {
+		return "`" + column + "`"
+	}
+	index := func(table string, columns ...string) string {
+		name, quoted := table, make([]string, 0, len(columns))
+		for _, column := range columns {
+			name += "_" + column
+			quoted = append(quoted, quote(column))
+		}
+		return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, strings.Join(quoted, ", "))
+	}
+
+	return []*migrate.Migration{
+		{
+			Id: "init",
+			Up: []string{
+				fmt.Sprintf(`
+					CREATE TABLE %s (
+						%s VARCHAR(90),
+						%s VARCHAR(64) NOT NULL,
+						%s LONGTEXT NOT NULL,
+						%s VARCHAR(64) NOT NULL,
+						%s VARCHAR(64) NOT NULL,
+						%s INTEGER NOT NULL,
+						%s VARCHAR(64) NOT NULL,
+						%s VARCHAR(64) NOT NULL,
+						%s INTEGER NOT NULL,
+						%s INTEGER NOT NULL DEFAULT 0,
+						PRIMARY KEY(%s, %s)
+					)
+				`,
+					sqlReleaseTableName,
+					quote(sqlReleaseTableKeyColumn),
+					quote(sqlReleaseTableTypeColumn),
+					quote(sqlReleaseTableBodyColumn),
+					quote(sqlReleaseTableNameColumn),
+					quote(sqlReleaseTableNamespaceColumn),
+					quote(sqlReleaseTableVersionColumn),
+					quote(sqlReleaseTableStatusColumn),
+					quote(sqlReleaseTableOwnerColumn),
+					quote(sqlReleaseTableCreatedAtColumn),
+					quote(sqlReleaseTableModifiedAtColumn),
+					quote(sqlReleaseTableKeyColumn),
+					quote(sqlReleaseTableNamespaceColumn),
+				),
+				index(sqlReleaseTableName, sqlReleaseTableNameColumn, sqlReleaseTableNamespaceColumn),
+				index(sqlReleaseTableName, sqlReleaseTableVersionColumn),
+				index(sqlReleaseTableName, sqlReleaseTableStatusColumn),
+				index(sqlReleaseTableName, sqlReleaseTableOwnerColumn),
+				index(sqlReleaseTableName, sqlReleaseTableCreatedAtColumn),
+				index(sqlReleaseTableName, sqlReleaseTableModifiedAtColumn),
+			},
+			Down: []string{
+				fmt.Sprintf("DROP TABLE %s", sqlReleaseTableName),
+			},
+		},
+		{
+			Id: "custom_labels",
+			Up: []string{
+				fmt.Sprintf(`
+					CREATE TABLE %s (
+						%s VARCHAR(64),
+						%s VARCHAR(67),
+						%s VARCHAR(%d),
+						%s VARCHAR(%d)
+					)
+				`,
+					sqlCustomLabelsTableName,
+					quote(sqlCustomLabelsTableReleaseKeyColumn),
+					quote(sqlCustomLabelsTableReleaseNamespaceColumn),
+					quote(sqlCustomLabelsTableKeyColumn),
+					sqlCustomLabelsTableKeyMaxLenght,
+					quote(sqlCustomLabelsTableValueColumn),
+					sqlCustomLabelsTableValueMaxLenght,
+				),
+				index(sqlCustomLabelsTableName, sqlCustomLabelsTableReleaseKeyColumn, sqlCustomLabelsTableReleaseNamespaceColumn),
+			},
+			Down: []string{
+				fmt.Sprintf("DROP TABLE %s", sqlCustomLabelsTableName),
+			},
+		},
+		{
+			Id: "resource_version",
+			Up: []string{
+				// Lower case, as the column is read into SQLReleaseWrapper by the name PostgreSQL folds it to.
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s INTEGER NOT NULL DEFAULT 0", sqlReleaseTableName, quote(strings.ToLower(sqlReleaseTableResourceVersionColumn))),
+			},
+			Down: []string{
+				fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", sqlReleaseTableName, quote(strings.ToLower(sqlReleaseTableResourceVersionColumn))),
+			},
+		},
+		{
+			Id: "release_locks",
+			Up: []string{
+				fmt.Sprintf(`
+					CREATE TABLE %s (
+						%s VARCHAR(64) NOT NULL,
+						%s VARCHAR(64) NOT NULL,
+						PRIMARY KEY(%s, %s)
+					)
+				`,
+					sqlReleaseLocksTableName,
+					quote(sqlReleaseLocksTableNameColumn),
+					quote(sqlReleaseLocksTableNamespaceColumn),
+					quote(sqlReleaseLocksTableNameColumn),
+					quote(sqlReleaseLocksTableNamespaceColumn),
+				),
+			},
+			Down: []string{
+				fmt.Sprintf("DROP TABLE %s", sqlReleaseLocksTableName),
+			},
+		},
+	}
+}
@@ -40,13 +40,14 @@ func TestSQLGet(t *testing.T) {
 	key := testKey(name, vers)
 	rel := releaseStub(name, vers, namespace, rspb.StatusDeployed)
 
-	body, _ := encodeRelease(rel)
+	body, _ := encodeRelease(rel, CompressionGzip, nil)
 
 	sqlDriver, mock := newTestFixtureSQL(t)
 
 	query := fmt.Sprintf(
-		regexp.QuoteMeta("SELECT %s FROM %s WHERE %s = $1 AND %s = $2"),
+		regexp.QuoteMeta("SELECT %s, %s FROM %s WHERE %s = $1 AND %s = $2"),
 		sqlReleaseTableBodyColumn,
+		sqlReleaseTableResourceVersionColumn,
 		sqlReleaseTableName,
 		sqlReleaseTableKeyColumn,
 		sqlReleaseTableNamespaceColumn,
@@ -105,7 +106,7 @@ func TestSQLList(t *testing.T) {
 			sqlReleaseTableBodyColumn,
 		})
 		for _, r := range releases {
-			body, _ := encodeRelease(r)
+			body, _ := encodeRelease(r, CompressionGzip, nil)
 			rows.AddRow(body)
 		}
 		mock.
@@ -178,7 +179,7 @@ func TestSqlCreate(t *testing.T) {
 	rel := releaseStub(name, vers, namespace, rspb.StatusDeployed)
 
 	sqlDriver, mock := newTestFixtureSQL(t)
-	body, _ := encodeRelease(rel)
+	body, _ := encodeRelease(rel, CompressionGzip, nil)
 
 	query := fmt.Sprintf(
 		"INSERT INTO %s (%s,%s,%s,%s,%s,%s,%s,%s,%s) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)",
@@ -235,7 +236,7 @@ func TestSqlCreateAlreadyExists(t *testing.T) {
 	rel := releaseStub(name, vers, namespace, rspb.StatusDeployed)
 
 	sqlDriver, mock := newTestFixtureSQL(t)
-	body, _ := encodeRelease(rel)
+	body, _ := encodeRelease(rel, CompressionGzip, nil)
 
 	insertQuery := fmt.Sprintf(
 		"INSERT INTO %s (%s,%s,%s,%s,%s,%s,%s,%s,%s) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)",
@@ -296,10 +297,10 @@ func TestSqlUpdate(t *testing.T) {
 	rel := releaseStub(name, vers, namespace, rspb.StatusDeployed)
 
 	sqlDriver, mock := newTestFixtureSQL(t)
-	body, _ := encodeRelease(rel)
+	body, _ := encodeRelease(rel, CompressionGzip, nil)
 
 	query := fmt.Sprintf(
-		"UPDATE %s SET %s = $1, %s = $2, %s = $3, %s = $4, %s = $5, %s = $6 WHERE %s = $7 AND %s = $8",
+		"UPDATE %s SET %s = $1, %s = $2, %s = $3, %s = $4, %s = $5, %s = $6, %s = %s + 1 WHERE %s = $7 AND %s = $8",
 		sqlReleaseTableName,
 		sqlReleaseTableBodyColumn,
 		sqlReleaseTableNameColumn,
@@ -307,6 +308,8 @@ func TestSqlUpdate(t *testing.T) {
 		sqlReleaseTableStatusColumn,
 		sqlReleaseTableOwnerColumn,
 		sqlReleaseTableModifiedAtColumn,
+		sqlReleaseTableResourceVersionColumn,
+		sqlReleaseTableResourceVersionColumn,
 		sqlReleaseTableKeyColumn,
 		sqlReleaseTableNamespaceColumn,
 	)
@@ -325,6 +328,238 @@ func TestSqlUpdate(t *testing.T) {
 	}
 }
 
+func TestSqlUpdateConflict(t *testing.T) {
+	vers := 1
+	name := "smug-pigeon"
+	namespace := "default"
+	key := testKey(name, vers)
+	rel := releaseStub(name, vers, namespace, rspb.StatusDeployed)
+
+	sqlDriver, mock := newTestFixtureSQL(t)
+	body, _ := encodeRelease(rel, CompressionGzip, nil)
+
+	// The release was read by this driver with resource version 3
+	sqlDriver.setResourceVersion(namespace, key, 3)
+
+	query := fmt.Sprintf(
+		"UPDATE %s SET %s = $1, %s = $2, %s = $3, %s = $4, %s = $5, %s = $6, %s = %s + 1 WHERE %s = $7 AND %s = $8 AND %s = $9",
+		sqlReleaseTableName,
+		sqlReleaseTableBodyColumn,
+		sqlReleaseTableNameColumn,
+		sqlReleaseTableVersionColumn,
+		sqlReleaseTableStatusColumn,
+		sqlReleaseTableOwnerColumn,
+		sqlReleaseTableModifiedAtColumn,
+		sqlReleaseTableResourceVersionColumn,
+		sqlReleaseTableResourceVersionColumn,
+		sqlReleaseTableKeyColumn,
+		sqlReleaseTableNamespaceColumn,
+		sqlReleaseTableResourceVersionColumn,
+	)
+
+	mock.
+		ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs(body, rel.Name, int(rel.Version), rel.Info.Status.String(), sqlReleaseDefaultOwner, int(time.Now().Unix()), key, namespace, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := sqlDriver.Update(key, rel); err != nil {
+		t.Fatalf("failed to update release with key %s: %v", key, err)
+	}
+
+	// Someone else updated the release in the meantime, so nothing matches resource version 4
+	mock.
+		ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs(body, rel.Name, int(rel.Version), rel.Info.Status.String(), sqlReleaseDefaultOwner, int(time.Now().Unix()), key, namespace, 4).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := sqlDriver.Update(key, rel); err != ErrReleaseConflict {
+		t.Fatalf("Expected error {%v}, got {%v}", ErrReleaseConflict, err)
+	}
+
+	if _, known := sqlDriver.getResourceVersion(namespace, key); known {
+		t.Errorf("expected the resource version of %s to be forgotten after a conflict", key)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("sql expectations weren't met: %v", err)
+	}
+}
+
+func TestSqlHistoryPage(t *testing.T) {
+	name := "smug-pigeon"
+	namespace := "default"
+
+	rel2 := releaseStub(name, 2, namespace, rspb.StatusSuperseded)
+	rel2Body, _ := encodeRelease(rel2, CompressionGzip, nil)
+	rel3 := releaseStub(name, 3, namespace, rspb.StatusSuperseded)
+	rel3Body, _ := encodeRelease(rel3, CompressionGzip, nil)
+
+	sqlDriver, mock := newTestFixtureSQL(t)
+
+	query := fmt.Sprintf(
+		"SELECT %s, %s, %s, %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3 ORDER BY %s DESC LIMIT 2 OFFSET 1",
+		sqlReleaseTableKeyColumn,
+		sqlReleaseTableNamespaceColumn,
+		sqlReleaseTableBodyColumn,
+		sqlReleaseTableResourceVersionColumn,
+		sqlReleaseTableName,
+		sqlReleaseTableNameColumn,
+		sqlReleaseTableOwnerColumn,
+		sqlReleaseTableNamespaceColumn,
+		sqlReleaseTableVersionColumn,
+	)
+
+	mock.
+		ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs(name, sqlReleaseDefaultOwner, namespace).
+		WillReturnRows(
+			mock.NewRows([]string{
+				sqlReleaseTableBodyColumn,
+			}).AddRow(
+				rel3Body,
+			).AddRow(
+				rel2Body,
+			),
+		).RowsWillBeClosed()
+
+	mockGetReleaseCustomLabels(mock, "", rel3.Namespace, rel3.Labels)
+	mockGetReleaseCustomLabels(mock, "", rel2.Namespace, rel2.Labels)
+
+	results, err := sqlDriver.HistoryPage(name, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to get release history page for %s: %v", name, err)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected a resultset of size 2, got %d", len(results))
+	}
+	if !reflect.DeepEqual(results[0], rel3) || !reflect.DeepEqual(results[1], rel2) {
+		t.Errorf("Expected releases {%v, %v}, got {%v, %v}", rel3, rel2, results[0], results[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("sql expectations weren't met: %v", err)
+	}
+}
+
+func TestSqlHistoryPageMySQL(t *testing.T) {
+	name := "smug-pigeon"
+	namespace := "default"
+
+	rel := releaseStub(name, 3, namespace, rspb.StatusSuperseded)
+	relBody, _ := encodeRelease(rel, CompressionGzip, nil)
+
+	sqlDriver, mock := newTestFixtureMySQL(t)
+
+	query := fmt.Sprintf(
+		"SELECT `%s`, `%s`, `%s`, `%s` FROM %s WHERE `%s` = ? AND `%s` = ? AND `%s` = ? ORDER BY `%s` DESC LIMIT 1",
+		sqlReleaseTableKeyColumn,
+		sqlReleaseTableNamespaceColumn,
+		sqlReleaseTableBodyColumn,
+		sqlReleaseTableResourceVersionColumn,
+		sqlReleaseTableName,
+		sqlReleaseTableNameColumn,
+		sqlReleaseTableOwnerColumn,
+		sqlReleaseTableNamespaceColumn,
+		sqlReleaseTableVersionColumn,
+	)
+
+	mock.
+		ExpectQuery(regexp.QuoteMeta(query)).
+		WithArgs(name, sqlReleaseDefaultOwner, namespace).
+		WillReturnRows(
+			mock.NewRows([]string{
+				sqlReleaseTableBodyColumn,
+			}).AddRow(
+				relBody,
+			),
+		).RowsWillBeClosed()
+
+	mock.
+		ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(
+			"SELECT `%s`, `%s` FROM %s WHERE `%s` = ? AND `%s` = ?",
+			sqlCustomLabelsTableKeyColumn,
+			sqlCustomLabelsTableValueColumn,
+			sqlCustomLabelsTableName,
+			sqlCustomLabelsTableReleaseKeyColumn,
+			sqlCustomLabelsTableReleaseNamespaceColumn,
+		))).
+		WithArgs("", namespace).
+		WillReturnRows(sqlmock.NewRows([]string{sqlCustomLabelsTableKeyColumn, sqlCustomLabelsTableValueColumn})).
+		RowsWillBeClosed()
+
+	results, err := sqlDriver.HistoryPage(name, 0, 1)
+	if err != nil {
+		t.Fatalf("failed to get release history page for %s: %v", name, err)
+	}
+
+	if len(results) != 1 || results[0].Version != rel.Version {
+		t.Fatalf("expected revision %d, got %v", rel.Version, results)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("sql expectations weren't met: %v", err)
+	}
+}
+
+func TestSqlLockRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixture     func(t *testing.T) (*SQL, sqlmock.Sqlmock)
+		insertQuery string
+		lockQuery   string
+	}{
+		{
+			name: "postgres",
+			fixture: func(t *testing.T) (*SQL, sqlmock.Sqlmock) {
+				return newTestFixtureSQL(t)
+			},
+			insertQuery: "INSERT INTO release_locks_v1 (name,namespace) VALUES ($1,$2) ON CONFLICT DO NOTHING",
+			lockQuery:   "SELECT name FROM release_locks_v1 WHERE name = $1 AND namespace = $2 FOR UPDATE",
+		},
+		{
+			name:        "mysql",
+			fixture:     newTestFixtureMySQL,
+			insertQuery: "INSERT IGNORE INTO release_locks_v1 (`name`,`namespace`) VALUES (?,?)",
+			lockQuery:   "SELECT `name` FROM release_locks_v1 WHERE `name` = ? AND `namespace` = ? FOR UPDATE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDriver, mock := tt.fixture(t)
+
+			mock.ExpectBegin()
+			mock.
+				ExpectExec(regexp.QuoteMeta(tt.insertQuery)).
+				WithArgs("smug-pigeon", "default").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.
+				ExpectExec(regexp.QuoteMeta(tt.lockQuery)).
+				WithArgs("smug-pigeon", "default").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			unlock, err := sqlDriver.LockRelease("smug-pigeon")
+			if err != nil {
+				t.Fatalf("failed to lock release: %v", err)
+			}
+
+			// The lock is held until the release is unlocked.
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("sql expectations weren't met: %v", err)
+			}
+
+			mock.ExpectCommit()
+			if err := unlock(); err != nil {
+				t.Fatalf("failed to unlock release: %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("sql expectations weren't met: %v", err)
+			}
+		})
+	}
+}
+
 func TestSqlQuery(t *testing.T) {
 	// Reflect actual use cases in ../storage.go
 	labelSetUnknown := map[string]string{
@@ -343,18 +578,19 @@ func TestSqlQuery(t *testing.T) {
 	}
 
 	supersededRelease := releaseStub("smug-pigeon", 1, "default", rspb.StatusSuperseded)
-	supersededReleaseBody, _ := encodeRelease(supersededRelease)
+	supersededReleaseBody, _ := encodeRelease(supersededRelease, CompressionGzip, nil)
 	deployedRelease := releaseStub("smug-pigeon", 2, "default", rspb.StatusDeployed)
-	deployedReleaseBody, _ := encodeRelease(deployedRelease)
+	deployedReleaseBody, _ := encodeRelease(deployedRelease, CompressionGzip, nil)
 
 	// Let's actually start our test
 	sqlDriver, mock := newTestFixtureSQL(t)
 
 	query := fmt.Sprintf(
-		"SELECT %s, %s, %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3 AND %s = $4",
+		"SELECT %s, %s, %s, %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3 AND %s = $4",
 		sqlReleaseTableKeyColumn,
 		sqlReleaseTableNamespaceColumn,
 		sqlReleaseTableBodyColumn,
+		sqlReleaseTableResourceVersionColumn,
 		sqlReleaseTableName,
 		sqlReleaseTableNameColumn,
 		sqlReleaseTableOwnerColumn,
@@ -385,10 +621,11 @@ func TestSqlQuery(t *testing.T) {
 	mockGetReleaseCustomLabels(mock, "", deployedRelease.Namespace, deployedRelease.Labels)
 
 	query = fmt.Sprintf(
-		"SELECT %s, %s, %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3",
+		"SELECT %s, %s, %s, %s FROM %s WHERE %s = $1 AND %s = $2 AND %s = $3",
 		sqlReleaseTableKeyColumn,
 		sqlReleaseTableNamespaceColumn,
 		sqlReleaseTableBodyColumn,
+		sqlReleaseTableResourceVersionColumn,
 		sqlReleaseTableName,
 		sqlReleaseTableNameColumn,
 		sqlReleaseTableOwnerColumn,
@@ -456,7 +693,7 @@ func TestSqlDelete(t *testing.T) {
 	key := testKey(name, vers)
 	rel := releaseStub(name, vers, namespace, rspb.StatusDeployed)
 
-	body, _ := encodeRelease(rel)
+	body, _ := encodeRelease(rel, CompressionGzip, nil)
 
 	sqlDriver, mock := newTestFixtureSQL(t)
 
@@ -17,11 +17,8 @@ limitations under the License.
 package driver // import "helm.sh/helm/v3/pkg/storage/driver"
 
 import (
-	"bytes"
-	"compress/gzip"
 	"encoding/base64"
 	"encoding/json"
-	"io"
 
 	rspb "github.com/werf/3p-helm/pkg/release"
 )
@@ -33,49 +30,47 @@ var magicGzip = []byte{0x1f, 0x8b, 0x08}
 var systemLabels = []string{"name", "owner", "status", "version", "createdAt", "modifiedAt"}
 
 // encodeRelease encodes a release returning a base64 encoded
-// gzipped string representation, or error.
-func encodeRelease(rls *rspb.Release) (string, error) {
+// compressed string representation, encrypted if encryption is not nil, or
+// error.
+func encodeRelease(rls *rspb.Release, compression Compression, encryption *Encryption) (string, error) {
 	b, err := json.Marshal(rls)
 	if err != nil {
 		return "", err
 	}
-	var buf bytes.Buffer
-	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+
+	b, err = compress(b, compression)
 	if err != nil {
 		return "", err
 	}
-	if _, err = w.Write(b); err != nil {
-		return "", err
+
+	if encryption != nil {
+		if b, err = encryption.encrypt(b); err != nil {
+			return "", err
+		}
 	}
-	w.Close()
 
-	return b64.EncodeToString(buf.Bytes()), nil
+	return b64.EncodeToString(b), nil
 }
 
 // decodeRelease decodes the bytes of data into a release
-// type. Data must contain a base64 encoded gzipped string of a
-// valid release, otherwise an error is returned.
-func decodeRelease(data string) (*rspb.Release, error) {
+// type. Data must contain a base64 encoded gzipped or zstd compressed
+// string of a valid release, otherwise an error is returned. Encrypted
+// releases are decrypted with encryption.
+func decodeRelease(data string, encryption *Encryption) (*rspb.Release, error) {
 	// base64 decode string
 	b, err := b64.DecodeString(data)
 	if err != nil {
 		return nil, err
 	}
 
-	// For backwards compatibility with releases that were stored before
-	// compression was introduced we skip decompression if the
-	// gzip magic header is not found
-	if len(b) > 3 && bytes.Equal(b[0:3], magicGzip) {
-		r, err := gzip.NewReader(bytes.NewReader(b))
-		if err != nil {
-			return nil, err
-		}
-		defer r.Close()
-		b2, err := io.ReadAll(r)
-		if err != nil {
-			return nil, err
-		}
-		b = b2
+	b, err = encryption.decrypt(b)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = decompress(b)
+	if err != nil {
+		return nil, err
 	}
 
 	var rls rspb.Release
@@ -14,8 +14,11 @@ limitations under the License.
 package driver
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
+
+	rspb "github.com/werf/3p-helm/pkg/release"
 )
 
 func TestGetSystemLabel(t *testing.T) {
@@ -106,3 +109,127 @@ func TestContainsSystemLabels(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeDecodeReleaseCompression(t *testing.T) {
+	rel := releaseStub("smug-pigeon", 1, "default", rspb.StatusDeployed)
+	// Labels are stored outside of the encoded release.
+	rel.Labels = nil
+
+	for _, tt := range []struct {
+		compression Compression
+		magic       []byte
+	}{
+		{compression: "", magic: magicGzip},
+		{compression: CompressionGzip, magic: magicGzip},
+		{compression: CompressionZstd, magic: magicZstd},
+	} {
+		data, err := encodeRelease(rel, tt.compression, nil)
+		if err != nil {
+			t.Fatalf("%q: failed to encode release: %s", tt.compression, err)
+		}
+
+		b, err := b64.DecodeString(data)
+		if err != nil {
+			t.Fatalf("%q: failed to decode base64: %s", tt.compression, err)
+		}
+		if !bytes.HasPrefix(b, tt.magic) {
+			t.Errorf("%q: expected encoded release to start with %x, got %x", tt.compression, tt.magic, b[:4])
+		}
+
+		got, err := decodeRelease(data, nil)
+		if err != nil {
+			t.Fatalf("%q: failed to decode release: %s", tt.compression, err)
+		}
+		if !reflect.DeepEqual(rel, got) {
+			t.Errorf("%q: expected {%v}, got {%v}", tt.compression, rel, got)
+		}
+	}
+}
+
+func TestEncodeDecodeReleaseEncryption(t *testing.T) {
+	rel := releaseStub("smug-pigeon", 1, "default", rspb.StatusDeployed)
+	rel.Labels = nil
+
+	encryption, err := LoadEncryption(EncryptionKeySource{Key: b64.EncodeToString(bytes.Repeat([]byte{1}, 32))})
+	if err != nil {
+		t.Fatalf("failed to load encryption: %s", err)
+	}
+
+	data, err := encodeRelease(rel, CompressionGzip, encryption)
+	if err != nil {
+		t.Fatalf("failed to encode release: %s", err)
+	}
+	b, err := b64.DecodeString(data)
+	if err != nil {
+		t.Fatalf("failed to decode base64: %s", err)
+	}
+	if !bytes.HasPrefix(b, magicEncrypted) {
+		t.Errorf("expected encoded release to start with %q", magicEncrypted)
+	}
+
+	got, err := decodeRelease(data, encryption)
+	if err != nil {
+		t.Fatalf("failed to decode release: %s", err)
+	}
+	if !reflect.DeepEqual(rel, got) {
+		t.Errorf("expected {%v}, got {%v}", rel, got)
+	}
+
+	if _, err := decodeRelease(data, nil); err == nil {
+		t.Error("expected an error decoding an encrypted release without the key")
+	}
+
+	other, err := NewEncryption(bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatalf("failed to create encryption: %s", err)
+	}
+	if _, err := decodeRelease(data, other); err == nil {
+		t.Error("expected an error decoding an encrypted release with a wrong key")
+	}
+
+	// Releases stored before the encryption was enabled are still read.
+	plain, err := encodeRelease(rel, CompressionGzip, nil)
+	if err != nil {
+		t.Fatalf("failed to encode release: %s", err)
+	}
+	if got, err := decodeRelease(plain, encryption); err != nil || !reflect.DeepEqual(rel, got) {
+		t.Errorf("expected {%v}, got {%v} and error %v", rel, got, err)
+	}
+}
+
+func TestLoadEncryption(t *testing.T) {
+	if encryption, err := LoadEncryption(EncryptionKeySource{}); encryption != nil || err != nil {
+		t.Errorf("expected no encryption without a key, got %v and error %v", encryption, err)
+	}
+	if _, err := LoadEncryption(EncryptionKeySource{Key: b64.EncodeToString([]byte("short"))}); err == nil {
+		t.Error("expected an error for a key of invalid length")
+	}
+	if _, err := LoadEncryption(EncryptionKeySource{Key: "a", File: "b"}); err == nil {
+		t.Error("expected an error for multiple sources of the key")
+	}
+
+	key := b64.EncodeToString(bytes.Repeat([]byte{1}, 16))
+	if _, err := LoadEncryption(EncryptionKeySource{KMSPlugin: "echo " + key}); err != nil {
+		t.Errorf("unexpected error loading the key from a KMS plugin: %s", err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, expected := range map[string]Compression{
+		"":     CompressionGzip,
+		"gzip": CompressionGzip,
+		"zstd": CompressionZstd,
+	} {
+		got, err := ParseCompression(name)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", name, err)
+		}
+		if got != expected {
+			t.Errorf("%q: expected %q, got %q", name, expected, got)
+		}
+	}
+
+	if _, err := ParseCompression("lz4"); err == nil {
+		t.Error("expected an error for an unknown compression")
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"github.com/pkg/errors"
+
+	rspb "github.com/werf/3p-helm/pkg/release"
+)
+
+// Mutation is the kind of change made to a release record.
+type Mutation string
+
+const (
+	MutationCreate Mutation = "create"
+	MutationUpdate Mutation = "update"
+	MutationDelete Mutation = "delete"
+)
+
+// MutationEvent describes a change of a release record.
+type MutationEvent struct {
+	Mutation Mutation
+	// Key is the key of the record in the storage driver.
+	Key     string
+	Name    string
+	Version int
+	// Release is the created or updated release. For a deletion it is nil in
+	// the pre hook and the deleted release in the post hook, if the deletion
+	// succeeded.
+	Release *rspb.Release
+}
+
+// MutationHook is called around the changes of release records, e.g. to send
+// webhooks, invalidate caches or replicate releases to an external database.
+// Both functions are optional.
+type MutationHook struct {
+	// Pre is called before the change. If it returns an error, the change is
+	// not made and the error is returned to the caller.
+	Pre func(event MutationEvent) error
+	// Post is called after the change with its error, if any.
+	Post func(event MutationEvent, err error)
+}
+
+// AddMutationHook adds a hook called around every change of release records
+// made through the storage. Hooks are called in the order they are added.
+func (s *Storage) AddMutationHook(hook MutationHook) {
+	s.mutationHooks = append(s.mutationHooks, hook)
+}
+
+// mutate calls the pre hooks, makes the change with fn and calls the post hooks.
+func (s *Storage) mutate(event MutationEvent, fn func() (*rspb.Release, error)) (*rspb.Release, error) {
+	for _, hook := range s.mutationHooks {
+		if hook.Pre == nil {
+			continue
+		}
+		if err := hook.Pre(event); err != nil {
+			return nil, errors.Wrapf(err, "%s of release %q rejected by storage hook", event.Mutation, event.Key)
+		}
+	}
+
+	rls, err := fn()
+
+	if event.Mutation == MutationDelete {
+		event.Release = rls
+	}
+	for _, hook := range s.mutationHooks {
+		if hook.Post != nil {
+			hook.Post(event, err)
+		}
+	}
+
+	return rls, err
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	rspb "github.com/werf/3p-helm/pkg/release"
+	"github.com/werf/3p-helm/pkg/storage/driver"
+)
+
+func TestStorageMutationHooks(t *testing.T) {
+	storage := Init(driver.NewMemory())
+
+	var calls []string
+	storage.AddMutationHook(MutationHook{
+		Pre: func(event MutationEvent) error {
+			calls = append(calls, fmt.Sprintf("pre %s %s.v%d", event.Mutation, event.Name, event.Version))
+			return nil
+		},
+		Post: func(event MutationEvent, err error) {
+			calls = append(calls, fmt.Sprintf("post %s %s.v%d release=%t err=%v", event.Mutation, event.Name, event.Version, event.Release != nil, err))
+		},
+	})
+
+	rls := ReleaseTestData{Name: "angry-beaver", Version: 1, Status: rspb.StatusDeployed}.ToRelease()
+	assertErrNil(t.Fatal, storage.Create(rls), "StoreRelease")
+	assertErrNil(t.Fatal, storage.Update(rls), "UpdateRelease")
+	_, err := storage.Delete(rls.Name, rls.Version)
+	assertErrNil(t.Fatal, err, "DeleteRelease")
+	if _, err := storage.Delete(rls.Name, rls.Version); !errors.Is(err, driver.ErrReleaseNotFound) {
+		t.Fatalf("Expected ErrReleaseNotFound, got %v", err)
+	}
+
+	expected := []string{
+		"pre create angry-beaver.v1",
+		"post create angry-beaver.v1 release=true err=<nil>",
+		"pre update angry-beaver.v1",
+		"post update angry-beaver.v1 release=true err=<nil>",
+		"pre delete angry-beaver.v1",
+		"post delete angry-beaver.v1 release=true err=<nil>",
+		"pre delete angry-beaver.v1",
+		"post delete angry-beaver.v1 release=false err=" + driver.ErrReleaseNotFound.Error(),
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Expected hook calls %q, got %q", expected, calls)
+	}
+}
+
+func TestStorageMutationHookRejects(t *testing.T) {
+	storage := Init(driver.NewMemory())
+
+	rejected := errors.New("replica is unavailable")
+	storage.AddMutationHook(MutationHook{
+		Pre: func(event MutationEvent) error {
+			if event.Mutation == MutationCreate {
+				return rejected
+			}
+			return nil
+		},
+	})
+
+	rls := ReleaseTestData{Name: "angry-beaver", Version: 1}.ToRelease()
+	if err := storage.Create(rls); !errors.Is(err, rejected) {
+		t.Fatalf("Expected the hook error, got %v", err)
+	}
+	if _, err := storage.Get(rls.Name, rls.Version); !errors.Is(err, driver.ErrReleaseNotFound) {
+		t.Fatalf("Expected the release not to be created, got %v", err)
+	}
+}
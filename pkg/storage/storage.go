@@ -40,10 +40,13 @@ type Storage struct {
 
 	// MaxHistory specifies the maximum number of historical releases that will
 	// be retained, including the most recent release. Values of 0 or less are
-	// ignored (meaning no limits are imposed).
+	// ignored (meaning no limits are imposed). The last successful and the last
+	// uninstalled releases are retained beyond the limit.
 	MaxHistory int
 
 	Log func(string, ...interface{})
+
+	mutationHooks []MutationHook
 }
 
 // Get retrieves the release from storage. An error is returned
@@ -61,12 +64,33 @@ func (s *Storage) Create(rls *rspb.Release) error {
 	s.Log("creating release %q", makeKey(rls.Name, rls.Version))
 	if s.MaxHistory > 0 {
 		// Want to make space for one more release.
-		if err := s.removeLeastRecent(rls.Name, s.MaxHistory-1); err != nil &&
+		if err := s.removeLeastRecent(rls.Name, s.MaxHistory-1, rls); err != nil &&
 			!errors.Is(err, driver.ErrReleaseNotFound) {
 			return err
 		}
 	}
-	return s.Driver.Create(makeKey(rls.Name, rls.Version), rls)
+	key := makeKey(rls.Name, rls.Version)
+	_, err := s.mutate(MutationEvent{Mutation: MutationCreate, Key: key, Name: rls.Name, Version: rls.Version, Release: rls}, func() (*rspb.Release, error) {
+		return rls, s.Driver.Create(key, rls)
+	})
+	return err
+}
+
+// ErrConcurrentDeploy indicates that the revision of the release to be created
+// has already been created by a concurrent deploy of the release.
+var ErrConcurrentDeploy = errors.New("the release has been deployed concurrently, run the deploy again")
+
+// CreateRevision creates a new storage entry holding the release, like Create.
+// If a concurrent writer has already stored the same revision of the release,
+// ErrConcurrentDeploy is returned. The release is not stored with another
+// revision instead, since it was rendered and planned against the revision it
+// was going to replace.
+func (s *Storage) CreateRevision(rls *rspb.Release) error {
+	err := s.Create(rls)
+	if errors.Is(err, driver.ErrReleaseExists) {
+		return errors.Wrapf(ErrConcurrentDeploy, "unable to create revision %d of release %q", rls.Version, rls.Name)
+	}
+	return err
 }
 
 // Update updates the release in storage. An error is returned if the
@@ -74,7 +98,36 @@ func (s *Storage) Create(rls *rspb.Release) error {
 // does not exist.
 func (s *Storage) Update(rls *rspb.Release) error {
 	s.Log("updating release %q", makeKey(rls.Name, rls.Version))
-	return s.Driver.Update(makeKey(rls.Name, rls.Version), rls)
+	key := makeKey(rls.Name, rls.Version)
+	_, err := s.mutate(MutationEvent{Mutation: MutationUpdate, Key: key, Name: rls.Name, Version: rls.Version, Release: rls}, func() (*rspb.Release, error) {
+		return rls, s.Driver.Update(key, rls)
+	})
+	return err
+}
+
+// Pin marks the revision of the release as pinned, so that it is never pruned
+// from the history, whatever MaxHistory is, e.g. to keep a known good
+// revision to roll back to.
+func (s *Storage) Pin(name string, version int) error {
+	return s.setPinned(name, version, true)
+}
+
+// Unpin reverts Pin, so that the revision is pruned as usual.
+func (s *Storage) Unpin(name string, version int) error {
+	return s.setPinned(name, version, false)
+}
+
+func (s *Storage) setPinned(name string, version int, pinned bool) error {
+	rls, err := s.Get(name, version)
+	if err != nil {
+		return err
+	}
+	if rls.Info.Pinned == pinned {
+		return nil
+	}
+
+	rls.Info.Pinned = pinned
+	return s.Update(rls)
 }
 
 // Delete deletes the release from storage. An error is returned if
@@ -82,7 +135,10 @@ func (s *Storage) Update(rls *rspb.Release) error {
 // does not exist.
 func (s *Storage) Delete(name string, version int) (*rspb.Release, error) {
 	s.Log("deleting release %q", makeKey(name, version))
-	return s.Driver.Delete(makeKey(name, version))
+	key := makeKey(name, version)
+	return s.mutate(MutationEvent{Mutation: MutationDelete, Key: key, Name: name, Version: version}, func() (*rspb.Release, error) {
+		return s.Driver.Delete(key)
+	})
 }
 
 // ListReleases returns all releases from storage. An error is returned if the
@@ -148,6 +204,28 @@ func (s *Storage) DeployedAll(name string) ([]*rspb.Release, error) {
 	return nil, err
 }
 
+// LockRelease locks the release with the given name, if the driver supports
+// it, so that concurrent deploys of the release wait for each other. The
+// returned function unlocks the release.
+func (s *Storage) LockRelease(name string) (func(), error) {
+	locker, ok := s.Driver.(driver.Locker)
+	if !ok {
+		return func() {}, nil
+	}
+
+	s.Log("locking release %q", name)
+	unlock, err := locker.LockRelease(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to lock release %q", name)
+	}
+
+	return func() {
+		if err := unlock(); err != nil {
+			s.Log("unable to unlock release %q: %s", name, err)
+		}
+	}, nil
+}
+
 // History returns the revision history for the release with the provided name, or
 // returns ErrReleaseNotFound if no such release name exists.
 func (s *Storage) History(name string) ([]*rspb.Release, error) {
@@ -156,12 +234,48 @@ func (s *Storage) History(name string) ([]*rspb.Release, error) {
 	return s.Driver.Query(map[string]string{"name": name, "owner": "helm"})
 }
 
+// HistoryPage returns up to limit revisions of the release with the given name,
+// newest first, skipping the offset newest ones. A limit of 0 means no limit.
+// The paging is done by the driver if it supports it.
+func (s *Storage) HistoryPage(name string, offset, limit int) ([]*rspb.Release, error) {
+	s.Log("getting release history page for %q (offset %d, limit %d)", name, offset, limit)
+
+	if pager, ok := s.Driver.(driver.HistoryPager); ok {
+		return pager.HistoryPage(name, offset, limit)
+	}
+
+	h, err := s.History(name)
+	if err != nil {
+		return nil, err
+	}
+
+	relutil.Reverse(h, relutil.SortByRevision)
+
+	if offset >= len(h) {
+		return nil, nil
+	}
+	h = h[offset:]
+	if limit > 0 && limit < len(h) {
+		h = h[:limit]
+	}
+
+	return h, nil
+}
+
 // removeLeastRecent removes items from history until the length number of releases
 // does not exceed max.
 //
 // We allow max to be set explicitly so that calling functions can "make space"
-// for the new records they are going to write.
-func (s *Storage) removeLeastRecent(name string, max int) error {
+// for the new records they are going to write. The record going to be written
+// next, if any, counts as the newest one of the history, e.g. as the last
+// successful one when it is stored as already deployed.
+//
+// Only the releases older than the last successful one are removed, since the
+// resources of the newer ones, e.g. of failed deploys, are still to be found as
+// orphans. The last successful and the last uninstalled releases are never
+// removed, even if the history exceeds max: without them the next deploy would
+// be mistaken for the first install. Neither are the pinned ones.
+func (s *Storage) removeLeastRecent(name string, max int, next *rspb.Release) error {
 	if max < 0 {
 		return nil
 	}
@@ -176,23 +290,24 @@ func (s *Storage) removeLeastRecent(name string, max int) error {
 	// We want oldest to newest
 	relutil.SortByRevision(h)
 
-	lastDeployed, err := s.Deployed(name)
-	if err != nil && !errors.Is(err, driver.ErrNoDeployedReleases) {
-		return err
+	all := h
+	if next != nil {
+		all = append(h[:len(h):len(h)], next)
 	}
+	lastSuccessful, preserved := preservedRevisions(all)
 
 	var toDelete []*rspb.Release
 	for _, rel := range h {
-		if lastDeployed == nil {
+		if lastSuccessful == nil || rel.Version >= lastSuccessful.Version {
 			break
 		}
 
 		// once we have enough releases to delete to reach the max, stop
-		if len(h)-len(toDelete) == max {
+		if len(h)-len(toDelete) <= max {
 			break
 		}
 
-		if rel.Version < lastDeployed.Version {
+		if !preserved[rel.Version] {
 			toDelete = append(toDelete, rel)
 		}
 	}
@@ -218,6 +333,44 @@ func (s *Storage) removeLeastRecent(name string, max int) error {
 	}
 }
 
+// preservedRevisions returns the last successful release of the history,
+// sorted from oldest to newest, i.e. the last deployed one or else the last
+// superseded one, and the revisions which are kept regardless of MaxHistory:
+// the last successful one and the last uninstalled one, along with the pinned
+// ones.
+func preservedRevisions(h []*rspb.Release) (*rspb.Release, map[int]bool) {
+	var lastDeployed, lastSuperseded, lastUninstalled *rspb.Release
+	for _, rel := range h {
+		switch rel.Info.Status {
+		case rspb.StatusDeployed:
+			lastDeployed = rel
+		case rspb.StatusSuperseded:
+			lastSuperseded = rel
+		case rspb.StatusUninstalled:
+			lastUninstalled = rel
+		}
+	}
+
+	preserved := map[int]bool{}
+	for _, rel := range h {
+		if rel.Info.Pinned {
+			preserved[rel.Version] = true
+		}
+	}
+	lastSuccessful := lastDeployed
+	if lastSuccessful == nil {
+		lastSuccessful = lastSuperseded
+	}
+	if lastSuccessful != nil {
+		preserved[lastSuccessful.Version] = true
+	}
+	if lastUninstalled != nil {
+		preserved[lastUninstalled.Version] = true
+	}
+
+	return lastSuccessful, preserved
+}
+
 func (s *Storage) deleteReleaseVersion(name string, version int) error {
 	key := makeKey(name, version)
 	_, err := s.Delete(name, version)
@@ -266,6 +419,18 @@ func Init(d driver.Driver) *Storage {
 	}
 }
 
+// WithDriver returns a storage with the driver d and the configuration and
+// the mutation hooks of the storage, e.g. to access the releases of another
+// namespace.
+func (s *Storage) WithDriver(d driver.Driver) *Storage {
+	return &Storage{
+		Driver:        d,
+		MaxHistory:    s.MaxHistory,
+		Log:           s.Log,
+		mutationHooks: s.mutationHooks,
+	}
+}
+
 func (s *Storage) HistoryUntilRevision(name string, ignoreSinceRevision int) ([]*rspb.Release, error) {
 	history, err := s.History(name)
 	if err != nil {
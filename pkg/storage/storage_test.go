@@ -49,6 +49,35 @@ func TestStorageCreate(t *testing.T) {
 	}
 }
 
+func TestStorageCreateRevision(t *testing.T) {
+	storage := Init(driver.NewMemory())
+
+	const name = "angry-beaver"
+	for _, version := range []int{1, 2} {
+		rls := ReleaseTestData{Name: name, Version: version, Status: rspb.StatusSuperseded}.ToRelease()
+		assertErrNil(t.Fatal, storage.Create(rls), "StoreRelease")
+	}
+
+	// Both writers computed revision 2 from the history before it was created.
+	rls := ReleaseTestData{Name: name, Version: 2, Status: rspb.StatusPendingUpgrade}.ToRelease()
+	if err := storage.CreateRevision(rls); !errors.Is(err, ErrConcurrentDeploy) {
+		t.Fatalf("Expected error %q, got %v", ErrConcurrentDeploy, err)
+	}
+
+	res, err := storage.Get(name, 2)
+	assertErrNil(t.Fatal, err, "QueryRelease")
+	if res.Info.Status != rspb.StatusSuperseded {
+		t.Fatalf("Expected revision 2 to be kept, got status %q", res.Info.Status)
+	}
+
+	if _, err := storage.Get(name, 3); err == nil {
+		t.Fatal("Expected revision 3 not to be created")
+	}
+
+	rls.Version = 3
+	assertErrNil(t.Fatal, storage.CreateRevision(rls), "CreateRevision")
+}
+
 func TestStorageUpdate(t *testing.T) {
 	// initialize storage
 	storage := Init(driver.NewMemory())
@@ -278,6 +307,43 @@ func TestStorageHistory(t *testing.T) {
 	}
 }
 
+func TestStorageHistoryPage(t *testing.T) {
+	storage := Init(driver.NewMemory())
+
+	const name = "angry-bird"
+
+	for i := 1; i <= 4; i++ {
+		rls := ReleaseTestData{Name: name, Version: i, Status: rspb.StatusSuperseded}.ToRelease()
+		assertErrNil(t.Fatal, storage.Create(rls), fmt.Sprintf("Storing release 'angry-bird' (v%d)", i))
+	}
+
+	tests := []struct {
+		offset, limit int
+		want          []int
+	}{
+		{0, 0, []int{4, 3, 2, 1}},
+		{0, 2, []int{4, 3}},
+		{1, 2, []int{3, 2}},
+		{3, 2, []int{1}},
+		{4, 2, nil},
+	}
+
+	for _, tt := range tests {
+		h, err := storage.HistoryPage(name, tt.offset, tt.limit)
+		if err != nil {
+			t.Fatalf("Failed to query for release history page (%q, offset %d, limit %d): %s\n", name, tt.offset, tt.limit, err)
+		}
+
+		var got []int
+		for _, rls := range h {
+			got = append(got, rls.Version)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expected revisions %v with offset %d and limit %d, got %v", tt.want, tt.offset, tt.limit, got)
+		}
+	}
+}
+
 var errMaxHistoryMockDriverSomethingHappened = errors.New("something happened")
 
 type MaxHistoryMockDriver struct {
@@ -444,6 +510,105 @@ func TestStorageDoNotDeleteDeployed(t *testing.T) {
 	}
 }
 
+func TestStorageDoNotDeleteLastSuccessfulAndUninstalled(t *testing.T) {
+	storage := Init(driver.NewMemory())
+	storage.Log = t.Logf
+
+	const name = "angry-bird"
+
+	// release records
+	rls0 := ReleaseTestData{Name: name, Version: 1, Status: rspb.StatusSuperseded}.ToRelease()
+	rls1 := ReleaseTestData{Name: name, Version: 2, Status: rspb.StatusSuperseded}.ToRelease()
+	rls2 := ReleaseTestData{Name: name, Version: 3, Status: rspb.StatusUninstalled}.ToRelease()
+	rls3 := ReleaseTestData{Name: name, Version: 4, Status: rspb.StatusFailed}.ToRelease()
+	rls4 := ReleaseTestData{Name: name, Version: 5, Status: rspb.StatusFailed}.ToRelease()
+
+	// create the release records in the storage
+	assertErrNil(t.Fatal, storage.Create(rls0), "Storing release 'angry-bird' (v1)")
+	assertErrNil(t.Fatal, storage.Create(rls1), "Storing release 'angry-bird' (v2)")
+	assertErrNil(t.Fatal, storage.Create(rls2), "Storing release 'angry-bird' (v3)")
+	assertErrNil(t.Fatal, storage.Create(rls3), "Storing release 'angry-bird' (v4)")
+	assertErrNil(t.Fatal, storage.Create(rls4), "Storing release 'angry-bird' (v5)")
+
+	storage.MaxHistory = 2
+	rls5 := ReleaseTestData{Name: name, Version: 6, Status: rspb.StatusFailed}.ToRelease()
+	assertErrNil(t.Fatal, storage.Create(rls5), "Storing release 'angry-bird' (v6)")
+
+	// On inserting the 6th record there is no deployed release, so we expect
+	// only the releases older than the last superseded one (v2) to be pruned:
+	// the last uninstalled (v3) and the failed releases after it (v4, v5) are
+	// kept beyond the limit along with the new one.
+	hist, err := storage.History(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedVersions := map[int]bool{
+		2: true,
+		3: true,
+		4: true,
+		5: true,
+		6: true,
+	}
+
+	if len(hist) != len(expectedVersions) {
+		t.Fatalf("expected %d items in history, got %d", len(expectedVersions), len(hist))
+	}
+	for _, item := range hist {
+		if !expectedVersions[item.Version] {
+			t.Errorf("Release version %d, found when not expected", item.Version)
+		}
+	}
+}
+
+func TestStorageDoNotDeletePinned(t *testing.T) {
+	storage := Init(driver.NewMemory())
+	storage.Log = t.Logf
+
+	const name = "angry-bird"
+
+	for version := 1; version <= 4; version++ {
+		rls := ReleaseTestData{Name: name, Version: version, Status: rspb.StatusSuperseded}.ToRelease()
+		assertErrNil(t.Fatal, storage.Create(rls), fmt.Sprintf("Storing release 'angry-bird' (v%d)", version))
+	}
+	assertErrNil(t.Fatal, storage.Pin(name, 1), "Pinning release 'angry-bird' (v1)")
+	assertErrNil(t.Fatal, storage.Pin(name, 2), "Pinning release 'angry-bird' (v2)")
+	assertErrNil(t.Fatal, storage.Unpin(name, 2), "Unpinning release 'angry-bird' (v2)")
+
+	storage.MaxHistory = 2
+	rls := ReleaseTestData{Name: name, Version: 5, Status: rspb.StatusPendingUpgrade}.ToRelease()
+	assertErrNil(t.Fatal, storage.Create(rls), "Storing release 'angry-bird' (v5)")
+
+	// On inserting the 5th record the pinned v1 is kept beyond the limit along
+	// with the last superseded (v4) and the new one.
+	hist, err := storage.History(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedVersions := map[int]bool{
+		1: true,
+		4: true,
+		5: true,
+	}
+
+	if len(hist) != len(expectedVersions) {
+		t.Fatalf("expected %d items in history, got %d", len(expectedVersions), len(hist))
+	}
+	for _, item := range hist {
+		if !expectedVersions[item.Version] {
+			t.Errorf("Release version %d, found when not expected", item.Version)
+		}
+		if item.Info.Pinned != (item.Version == 1) {
+			t.Errorf("Release version %d, expected pinned to be %t", item.Version, item.Version == 1)
+		}
+	}
+
+	if err := storage.Pin(name, 3); err == nil {
+		t.Error("expected an error pinning a pruned revision")
+	}
+}
+
 func TestStorageLast(t *testing.T) {
 	storage := Init(driver.NewMemory())
 